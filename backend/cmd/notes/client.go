@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+)
+
+var (
+	errUnauthorized = errors.New("not logged in or session expired (run `notes login`)")
+	errConflict     = errors.New("the note was changed on the server in the meantime; run the command again")
+)
+
+// client wraps the backend HTTP API with the session cookie saved by login.
+type client struct {
+	baseURL string
+	session *http.Cookie
+	http    *http.Client
+}
+
+func newClient(cfg clientConfig) *client {
+	c := &client{baseURL: strings.TrimRight(cfg.Server, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+	if cfg.CookieName != "" && cfg.CookieValue != "" {
+		c.session = &http.Cookie{Name: cfg.CookieName, Value: cfg.CookieValue}
+	}
+	return c
+}
+
+type noteList struct {
+	Items []store.Note `json:"items"`
+	Total int          `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
+
+type noteBody struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags"`
+	IsFavorite bool     `json:"is_favorite"`
+}
+
+func bodyOf(n store.Note) noteBody {
+	return noteBody{Title: n.Title, Content: n.Content, Tags: n.Tags, IsFavorite: n.IsFavorite}
+}
+
+// login exchanges the password for a session cookie and returns it.
+func (c *client) login(password string) (*http.Cookie, error) {
+	resp, err := c.send(http.MethodPost, "/auth/login", nil, map[string]string{"password": password})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		if errors.Is(err, errUnauthorized) {
+			return nil, errors.New("invalid password")
+		}
+		return nil, err
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Value != "" {
+			return cookie, nil
+		}
+	}
+	return nil, errors.New("server did not return a session cookie")
+}
+
+func (c *client) logout() error {
+	return c.do(http.MethodPost, "/auth/logout", nil, http.StatusOK, nil)
+}
+
+func (c *client) list(query url.Values) (noteList, error) {
+	var out noteList
+	err := c.do(http.MethodGet, "/notes?"+query.Encode(), nil, http.StatusOK, &out)
+	return out, err
+}
+
+func (c *client) get(id string) (store.Note, error) {
+	var n store.Note
+	err := c.do(http.MethodGet, "/notes/"+url.PathEscape(id), nil, http.StatusOK, &n)
+	return n, err
+}
+
+func (c *client) create(body noteBody) (store.Note, error) {
+	var n store.Note
+	err := c.do(http.MethodPost, "/notes", body, http.StatusCreated, &n)
+	return n, err
+}
+
+// update saves body over version of the note; the server refuses when the
+// note has changed since.
+func (c *client) update(id string, version int64, body noteBody) (store.Note, error) {
+	var n store.Note
+	header := http.Header{"If-Match": {fmt.Sprintf(`"%d"`, version)}}
+	err := c.doWith(http.MethodPut, "/notes/"+url.PathEscape(id), header, body, http.StatusOK, &n)
+	return n, err
+}
+
+func (c *client) remove(id string) error {
+	return c.do(http.MethodDelete, "/notes/"+url.PathEscape(id), nil, http.StatusNoContent, nil)
+}
+
+func (c *client) do(method, path string, body any, want int, out any) error {
+	return c.doWith(method, path, nil, body, want, out)
+}
+
+func (c *client) doWith(method, path string, header http.Header, body any, want int, out any) error {
+	resp, err := c.send(method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, want); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *client) send(method, path string, header http.Header, body any) (*http.Response, error) {
+	if c.baseURL == "" {
+		return nil, errors.New("no server configured (run `notes login <url>`)")
+	}
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, &buf)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.session != nil {
+		req.AddCookie(c.session)
+	}
+	return c.http.Do(req)
+}
+
+func checkStatus(resp *http.Response, want int) error {
+	if resp.StatusCode == want {
+		return nil
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return errConflict
+	}
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error != "" {
+		return fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+	}
+	return fmt.Errorf("unexpected HTTP %d", resp.StatusCode)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"golang.org/x/term"
+)
+
+// session loads the config and returns a client that carries the saved
+// session cookie.
+func session() (*client, error) {
+	cfg, err := loadClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newClient(cfg), nil
+}
+
+func runLogin(args []string) error {
+	cfg, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		cfg.Server = args[0]
+	}
+	if cfg.Server == "" {
+		return errors.New("usage: notes login <server-url>")
+	}
+
+	password := os.Getenv("NOTES_PASSWORD")
+	if password == "" {
+		if password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	cookie, err := newClient(cfg).login(password)
+	if err != nil {
+		return err
+	}
+	cfg.CookieName, cfg.CookieValue = cookie.Name, cookie.Value
+	if err := saveClientConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Println("logged in to", cfg.Server)
+	return nil
+}
+
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "password: ")
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(raw), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runLogout([]string) error {
+	cfg, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.CookieValue != "" {
+		// The server forgets the session either way; a failure here only
+		// means it was already gone or unreachable.
+		_ = newClient(cfg).logout()
+	}
+	cfg.CookieName, cfg.CookieValue = "", ""
+	return saveClientConfig(cfg)
+}
+
+func runList(args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	query := flags.String("q", "", "search title and content")
+	tag := flags.String("t", "", "only notes with this tag")
+	favorites := flags.Bool("fav", false, "only favorites")
+	limit := flags.Int("n", 30, "notes per page (max 100)")
+	page := flags.Int("p", 1, "page number")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("query", *query)
+	params.Set("tag", *tag)
+	params.Set("limit", strconv.Itoa(*limit))
+	params.Set("page", strconv.Itoa(*page))
+	if *favorites {
+		params.Set("favorite", "true")
+	}
+	list, err := c.list(params)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUPDATED\tFAV\tTITLE\tTAGS")
+	for _, n := range list.Items {
+		fav := ""
+		if n.IsFavorite {
+			fav = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", n.ID, n.UpdatedAt.Local().Format(time.DateTime), fav,
+			truncate(n.Title, 48), strings.Join(n.Tags, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d note(s), page %d\n", len(list.Items), list.Total, list.Page)
+	return nil
+}
+
+func runCat(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: notes cat <id>")
+	}
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	n, err := c.get(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatNote(n))
+	return nil
+}
+
+func runNew(args []string) error {
+	flags := flag.NewFlagSet("new", flag.ContinueOnError)
+	title := flags.String("title", "", "note title (default: first line of the content)")
+	tags := flags.String("tag", "", "comma-separated tags")
+	favorite := flags.Bool("fav", false, "mark as favorite")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	raw, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	content := strings.TrimRight(string(raw), "\n")
+	if *title == "" {
+		first, rest, _ := strings.Cut(content, "\n")
+		*title = strings.TrimSpace(strings.TrimLeft(first, "# "))
+		content = strings.TrimLeft(rest, "\n")
+	}
+
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	n, err := c.create(noteBody{Title: *title, Content: content, Tags: splitTags(*tags), IsFavorite: *favorite})
+	if err != nil {
+		return err
+	}
+	fmt.Println(n.ID)
+	return nil
+}
+
+// runEdit opens the note in $EDITOR as a small header (title, tags) followed
+// by a blank line and the content, and saves it when the file changed.
+func runEdit(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: notes edit <id>")
+	}
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	n, err := c.get(args[0])
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "note-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	original := formatNote(n)
+	if _, err := tmp.WriteString(original); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// $EDITOR may carry arguments ("code --wait"), so it goes through the shell.
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if string(edited) == original {
+		fmt.Println("no changes")
+		return nil
+	}
+	body := parseNote(string(edited), n)
+	if _, err := c.update(n.ID.String(), n.Version, body); err != nil {
+		return err
+	}
+	fmt.Println("saved", n.ID)
+	return nil
+}
+
+func runRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: notes rm <id>")
+	}
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	return c.remove(args[0])
+}
+
+func runTag(args []string) error {
+	if len(args) < 3 || (args[0] != "add" && args[0] != "rm") {
+		return errors.New("usage: notes tag add|rm <id> <tag>...")
+	}
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	n, err := c.get(args[1])
+	if err != nil {
+		return err
+	}
+
+	body := bodyOf(n)
+	for _, tag := range args[2:] {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case args[0] == "add" && !slices.Contains(body.Tags, tag):
+			body.Tags = append(body.Tags, tag)
+		case args[0] == "rm":
+			body.Tags = slices.DeleteFunc(body.Tags, func(t string) bool { return t == tag })
+		}
+	}
+	updated, err := c.update(n.ID.String(), n.Version, body)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Join(updated.Tags, ","))
+	return nil
+}
+
+func runFavorite(args []string) error {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "on" && args[1] != "off") {
+		return errors.New("usage: notes fav <id> [on|off]")
+	}
+	c, err := session()
+	if err != nil {
+		return err
+	}
+	value := len(args) == 1 || args[1] == "on"
+	return c.do(http.MethodPost, "/notes/"+url.PathEscape(args[0])+"/favorite", map[string]bool{"value": value}, http.StatusOK, nil)
+}
+
+func formatNote(n store.Note) string {
+	return fmt.Sprintf("title: %s\ntags: %s\n\n%s\n", n.Title, strings.Join(n.Tags, ", "), n.Content)
+}
+
+// parseNote reads back the formatNote layout. Header lines it does not
+// recognize are ignored; without a header the whole text is content.
+func parseNote(text string, current store.Note) noteBody {
+	body := bodyOf(current)
+	header, content, found := strings.Cut(text, "\n\n")
+	if !found {
+		body.Content = strings.TrimRight(text, "\n")
+		return body
+	}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		switch strings.TrimSpace(key) {
+		case "title":
+			body.Title = strings.TrimSpace(value)
+		case "tags":
+			body.Tags = splitTags(value)
+		}
+	}
+	body.Content = strings.TrimRight(content, "\n")
+	return body
+}
+
+func splitTags(raw string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
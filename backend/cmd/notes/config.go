@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// clientConfig is persisted between runs. The session cookie grants full
+// access to the notes, so the file is only readable by its owner.
+type clientConfig struct {
+	Server      string `json:"server"`
+	CookieName  string `json:"cookie_name,omitempty"`
+	CookieValue string `json:"cookie_value,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("NOTES_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config dir: %w", err)
+	}
+	return filepath.Join(dir, "notes", "config.json"), nil
+}
+
+func loadClientConfig() (clientConfig, error) {
+	var cfg clientConfig
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	raw, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return cfg, err
+	default:
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	if server := os.Getenv("NOTES_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	return cfg, nil
+}
+
+func saveClientConfig(cfg clientConfig) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o600)
+}
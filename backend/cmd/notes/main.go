@@ -0,0 +1,67 @@
+// Command notes is a terminal client for the notes backend. It logs in once,
+// keeps the session cookie in its config file and talks to the same HTTP API
+// as the web frontend.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"login", "[server-url]", "sign in and remember the session", runLogin},
+		{"logout", "", "end the session and forget it", runLogout},
+		{"ls", "[-q query] [-t tag] [-fav] [-n limit] [-p page]", "list or search notes", runList},
+		{"cat", "<id>", "print a note", runCat},
+		{"new", "[-title T] [-tag a,b] [-fav]", "create a note from stdin", runNew},
+		{"edit", "<id>", "edit a note in $EDITOR", runEdit},
+		{"rm", "<id>", "move a note to the trash", runRemove},
+		{"tag", "add|rm <id> <tag>...", "add or remove tags", runTag},
+		{"fav", "<id> [on|off]", "mark or unmark a favorite", runFavorite},
+		{"help", "", "show this help", func([]string) error { printUsage(os.Stdout); return nil }},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "notes %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	os.Exit(2)
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "usage: %s <command> [arguments]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nThe server URL and session are stored in $NOTES_CONFIG (default: the user config dir); NOTES_SERVER overrides the URL.")
+}
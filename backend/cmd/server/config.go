@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"notes-backend/internal/config"
+)
+
+// runConfig prints the configuration serve would run with, after the file
+// and the environment are merged and defaults filled in.
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+	cfg, err := config.LoadFrom(configFile, settings)
+	if err != nil {
+		return err
+	}
+	return config.Print(os.Stdout, cfg)
+}
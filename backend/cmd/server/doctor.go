@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/config"
+	"notes-backend/internal/encrypt"
+)
+
+// runDoctor reports problems an operator would otherwise find in the logs
+// of a failing deploy. Warnings do not change the exit status; failures do.
+func runDoctor([]string) error {
+	failed := false
+	report := func(level, format string, args ...any) {
+		if level == "FAIL" {
+			failed = true
+		}
+		fmt.Printf("%-4s  %s\n", level, fmt.Sprintf(format, args...))
+	}
+
+	cfg, err := config.LoadFrom(configFile, settings)
+	if err != nil {
+		report("FAIL", "configuration: %v", err)
+		return errors.New("configuration is invalid")
+	}
+	report("OK", "configuration loaded (driver %s)", cfg.DatabaseDriver)
+
+	if cfg.AppPasswordHash == "" {
+		report("WARN", "APP_PASSWORD is stored in plain text; run hash-password and set APP_PASSWORD_HASH instead")
+	}
+	if cfg.AppPasswordHash == "" && len(cfg.AppPassword) < 12 {
+		report("WARN", "APP_PASSWORD is shorter than 12 characters")
+	}
+	if !cfg.CookieSecure {
+		report("WARN", "SESSION_COOKIE_SECURE is off; enable it when serving over HTTPS")
+	}
+	if strings.HasPrefix(cfg.AllowedOrigin, "https://") && !cfg.CookieSecure {
+		report("WARN", "ALLOWED_ORIGIN is HTTPS but session cookies are not marked Secure")
+	}
+
+	if cfg.TLSCertFile != "" {
+		if cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			report("FAIL", "TLS certificate: %v", err)
+		} else if left := time.Until(cert.Leaf.NotAfter); left < 14*24*time.Hour {
+			report("WARN", "TLS certificate for %s expires %s", strings.Join(cert.Leaf.DNSNames, ", "), cert.Leaf.NotAfter.Format(time.DateOnly))
+		} else {
+			report("OK", "TLS certificate for %s valid until %s", strings.Join(cert.Leaf.DNSNames, ", "), cert.Leaf.NotAfter.Format(time.DateOnly))
+		}
+	}
+
+	if len(cfg.EncryptionKeys) > 0 {
+		report("OK", "note content encrypted under key %s (%d retired key(s) accepted)", encrypt.KeyID(cfg.EncryptionKeys[0]), len(cfg.EncryptionKeys)-1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	started := time.Now()
+	migrator, closeDB, err := app.OpenMigrator(ctx, cfg)
+	if err != nil {
+		report("FAIL", "database: %v", err)
+		return errors.New("database is unreachable")
+	}
+	defer closeDB()
+	report("OK", "database reachable (%s)", time.Since(started).Round(time.Millisecond))
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		report("FAIL", "migrations: %v", err)
+		return errors.New("cannot read migration state")
+	}
+	var pending, drifted, missing []string
+	for _, st := range statuses {
+		switch {
+		case st.Missing:
+			missing = append(missing, st.Version)
+		case st.Drifted:
+			drifted = append(drifted, st.Version)
+		case !st.Applied:
+			pending = append(pending, st.Version)
+		}
+	}
+	if len(pending) > 0 {
+		report("WARN", "%d pending migration(s), applied on next start: %s", len(pending), strings.Join(pending, ", "))
+	}
+	if len(drifted) > 0 {
+		report("FAIL", "applied migrations modified on disk: %s (see `migrate repair`)", strings.Join(drifted, ", "))
+	}
+	if len(missing) > 0 {
+		report("WARN", "database records migrations this binary does not know: %s", strings.Join(missing, ", "))
+	}
+	if len(pending)+len(drifted)+len(missing) == 0 {
+		report("OK", "schema up to date (%d migration(s))", len(statuses))
+	}
+
+	if failed {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
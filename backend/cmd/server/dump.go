@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/dump"
+)
+
+// runExport writes a dump, or a ZIP of Markdown files with the dump inside
+// when the file name ends in .zip.
+func runExport(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: export [file]")
+	}
+	write := dump.Write
+	var out io.Writer = os.Stdout
+	if len(args) == 1 && args[0] != "-" {
+		if strings.EqualFold(filepath.Ext(args[0]), ".zip") {
+			write = dump.WriteZip
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	count, err := writeDump(out, write)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d note(s)\n", count)
+	return nil
+}
+
+func runImport(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: import <file | ->")
+	}
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	file, err := dump.Read(in)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, mustLoadConfig())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	created, skipped, err := dump.Restore(ctx, st, file)
+	fmt.Printf("imported %d note(s), skipped %d already present\n", created, skipped)
+	return err
+}
+
+// runBackup writes a dump next to earlier ones; the file only appears under
+// its final name once it is complete.
+func runBackup(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: backup [dir]")
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(dir, "notes-backup-"+time.Now().UTC().Format("20060102-150405")+".json")
+	tmp, err := os.CreateTemp(dir, ".notes-backup-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	count, err := writeDump(tmp, dump.Write)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	fmt.Printf("backed up %d note(s) to %s\n", count, name)
+	return nil
+}
+
+func writeDump(w io.Writer, write func(context.Context, dump.Store, io.Writer, time.Time) (int, error)) (int, error) {
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, mustLoadConfig())
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+	return write(ctx, st, w, time.Now())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/encrypt"
+)
+
+// runRotateKeys re-wraps every note and attachment under the current
+// ENCRYPTION_KEY. The usual rotation is: move the old key to
+// ENCRYPTION_OLD_KEYS, set a new ENCRYPTION_KEY, restart, run rotate-keys,
+// then drop the old key. Running it with a key set for the first time
+// encrypts existing plain-text notes and files.
+func runRotateKeys(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: rotate-keys")
+	}
+	cfg := mustLoadConfig()
+	if len(cfg.EncryptionKeys) == 0 {
+		return errors.New("ENCRYPTION_KEY is not set")
+	}
+
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	encrypted, ok := st.(*encrypt.Store)
+	if !ok {
+		return errors.New("store is not encrypted")
+	}
+
+	started := time.Now()
+	rotated, err := encrypted.Rotate(ctx)
+	if err != nil {
+		return fmt.Errorf("rotated %d notes before failing: %w", rotated, err)
+	}
+	fmt.Printf("rotated %d notes to key %s in %s\n", rotated, encrypt.KeyID(cfg.EncryptionKeys[0]), time.Since(started).Round(time.Millisecond))
+
+	blobs, err := app.OpenBlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	if sealed, ok := blobs.(*encrypt.BlobStore); ok {
+		started = time.Now()
+		rotated, err := encrypted.RotateAttachments(ctx, sealed)
+		if err != nil {
+			return fmt.Errorf("rotated %d attachments before failing: %w", rotated, err)
+		}
+		fmt.Printf("rotated %d attachments in %s\n", rotated, time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"notes-backend/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// listen starts serving handler on PORT, or the LISTEN socket, over HTTPS
+// when TLS is configured, and the HTTP_REDIRECT_PORT listener if there is
+// one. It returns the
+// servers to shut down; ports that cannot be bound are reported before any
+// request is served.
+func listen(cfg config.Config, handler http.Handler) ([]*http.Server, error) {
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	// When Let's Encrypt provides the certificates the redirect listener
+	// also answers its HTTP-01 challenges, which come to port 80.
+	redirect := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, httpsURL(r, cfg.Port), http.StatusMovedPermanently)
+	}))
+	switch {
+	case cfg.TLSCertFile != "":
+		certs := &certFile{certPath: cfg.TLSCertFile, keyPath: cfg.TLSKeyFile}
+		if _, err := certs.get(); err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certs.get()
+			},
+		}
+	case len(cfg.TLSAutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		redirect = manager.HTTPHandler(redirect)
+	}
+
+	ln, err := listenMain(cfg)
+	if err != nil {
+		return nil, err
+	}
+	servers := []*http.Server{srv}
+	if cfg.HTTPRedirectPort != "" {
+		redirectServer := &http.Server{
+			Addr:              ":" + cfg.HTTPRedirectPort,
+			Handler:           redirect,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		redirectLn, err := net.Listen("tcp", redirectServer.Addr)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+		servers = append(servers, redirectServer)
+		go func() {
+			log.Printf("redirecting HTTP on :%s to HTTPS", cfg.HTTPRedirectPort)
+			if err := redirectServer.Serve(redirectLn); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("backend listening on %s (HTTPS)", ln.Addr())
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			log.Printf("backend listening on %s", ln.Addr())
+			err = srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+	return servers, nil
+}
+
+func listenMain(cfg config.Config) (net.Listener, error) {
+	if cfg.ListenSocket == "" {
+		ln, err := net.Listen("tcp", ":"+cfg.Port)
+		if err != nil {
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+		return ln, nil
+	}
+	if err := removeStaleSocket(cfg.ListenSocket); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", cfg.ListenSocket)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	// The socket is created with the umask's permissions. Where the moment
+	// before they are changed matters, the directory should keep others out.
+	if err := os.Chmod(cfg.ListenSocket, cfg.SocketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket deletes the socket a crashed server left behind, which
+// would keep the new one from binding. A socket something still answers
+// on is left alone, as is anything that is not a socket.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("listen: %s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("listen: %s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return nil
+}
+
+// httpsURL is the address of r on the HTTPS port, which browsers assume
+// when it is 443.
+func httpsURL(r *http.Request, port string) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
+
+// certFile is a certificate and key read from files, read again when
+// either changes so that renewals by certbot and the like take effect
+// without a restart. A renewal that cannot be loaded keeps the old pair.
+type certFile struct {
+	certPath, keyPath string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+	checked  time.Time
+}
+
+func (c *certFile) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.cert != nil && now.Sub(c.checked) < time.Minute {
+		return c.cert, nil
+	}
+	c.checked = now
+	modified, err := latestModTime(c.certPath, c.keyPath)
+	if err == nil && c.cert != nil && !modified.After(c.modified) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		if c.cert != nil {
+			log.Printf("tls: keeping the current certificate: %v", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	c.cert, c.modified = &cert, modified
+	return c.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
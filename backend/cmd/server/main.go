@@ -2,41 +2,195 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"notes-backend/internal/app"
 	"notes-backend/internal/config"
+	"notes-backend/internal/selftest"
 )
 
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+	// flags adds the command's own flags to those of the configuration.
+	flags func(*flag.FlagSet)
+}
+
+// commands is filled in init because the help command refers to it.
+var commands []command
+
+// configFile is the -config file settings are read from before the
+// environment; settings are those given with flags, which override both.
+var (
+	configFile string
+	settings   = map[string]string{}
+)
+
+func init() {
+	commands = []command{
+		{"serve", "", "run the HTTP server (default)", runServe, nil},
+		{"migrate", "up | down [N] | to <version> | status | repair | new <name>", "manage the database schema", runMigrate, nil},
+		{"export", "[file]", "write every note as a JSON dump (stdout by default), or a Markdown ZIP to a .zip file", runExport, nil},
+		{"import", "<file | ->", "load notes from a JSON dump, skipping ones that exist", runImport, nil},
+		{"backup", "[dir]", "write a timestamped JSON dump into dir", runBackup, nil},
+		{"create-token", "[-scope read|write] <name>", "create an API token and print its secret", runCreateToken, tokenFlags},
+		{"doctor", "", "check configuration, connectivity and schema state", runDoctor, nil},
+		{"config", "print", "show the effective configuration, secrets redacted", runConfig, nil},
+		{"selftest", "", "exercise the API end to end against the configured DB", runSelftestCommand, nil},
+		{"rotate-keys", "", "re-encrypt notes under the current ENCRYPTION_KEY", runRotateKeys, nil},
+		{"recount", "", "fill in the word and character counts of notes written before they were kept", runRecount, nil},
+		{"telegram-webhook", "<url>", "point the Telegram bot's webhook at this server, reachable at url", runTelegramWebhook, nil},
+		{"hash-password", "", "print an APP_PASSWORD_HASH for a password read from the terminal or stdin", runHashPassword, nil},
+		{"seed", "[count] [random-seed]", "fill the database with fake notes", runSeed, nil},
+		{"help", "", "show this help", func([]string) error { printUsage(os.Stdout); return nil }, nil},
+	}
+}
+
+// addConfigFlags adds the flags every command takes, before its name or
+// after it.
+func addConfigFlags(flags *flag.FlagSet) {
+	flags.StringVar(&configFile, "config", configFile, "read settings from this YAML or TOML `file`; the environment overrides it")
+	flags.Func("set", "override a setting, named as in the config file, with `key=value`; may be repeated", func(pair string) error {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return errors.New("expected key=value")
+		}
+		settings[key] = value
+		return nil
+	})
+	for _, f := range []struct{ name, key, usage string }{
+		{"port", "PORT", "listen on `port` (PORT)"},
+		{"database-url", "DATABASE_URL", "connect to the database at `url` (DATABASE_URL)"},
+		{"database-driver", "DATABASE_DRIVER", "use the database `driver` (DATABASE_DRIVER)"},
+	} {
+		flags.Func(f.name, f.usage, func(value string) error {
+			settings[f.key] = value
+			return nil
+		})
+	}
+}
+
 func main() {
-	cfg, err := config.Load()
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	addConfigFlags(flags)
+	flags.Usage = func() { printUsage(os.Stderr) }
+	flags.Parse(os.Args[1:])
+
+	name := "serve"
+	args := []string{}
+	if flags.NArg() > 0 {
+		name, args = flags.Arg(0), flags.Args()[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		cmdFlags := flag.NewFlagSet(name, flag.ExitOnError)
+		addConfigFlags(cmdFlags)
+		if cmd.flags != nil {
+			cmd.flags(cmdFlags)
+		}
+		cmdFlags.Usage = func() {
+			fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n\nflags:\n", filepath.Base(os.Args[0]), name, cmd.args)
+			cmdFlags.PrintDefaults()
+		}
+		cmdFlags.Parse(args)
+		if err := cmd.run(cmdFlags.Args()); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	os.Exit(2)
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "usage: %s [flags] <command> [flags] [arguments]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nflags, before or after the command:")
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	addConfigFlags(flags)
+	flags.SetOutput(out)
+	flags.PrintDefaults()
+	fmt.Fprintln(out, "\nEvery command reads its configuration from the same environment variables as serve, and from the")
+	fmt.Fprintln(out, "-config file, whose keys are the variables' names in lower case (database_url, or url under database).")
+	fmt.Fprintln(out, "Flags override both.")
+}
+
+func mustLoadConfig() config.Config {
+	cfg, err := config.LoadFrom(configFile, settings)
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
+	return cfg
+}
+
+func runServe(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: serve [flags]")
+	}
+	return serve(mustLoadConfig())
+}
+
+func runSelftestCommand(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: selftest [flags]")
+	}
+	return runSelftest(mustLoadConfig())
+}
 
+func serve(cfg config.Config) error {
 	ctx := context.Background()
 	server, err := app.New(ctx, cfg)
 	if err != nil {
-		log.Fatalf("bootstrap server: %v", err)
+		return fmt.Errorf("bootstrap server: %w", err)
 	}
 	defer server.Close()
+	server.SetConfigSource(func() (config.Config, error) {
+		return config.LoadFrom(configFile, settings)
+	})
 
-	httpServer := &http.Server{
-		Addr:              fmt.Sprintf(":%s", cfg.Port),
-		Handler:           server.Handler(),
-		ReadHeaderTimeout: 5 * time.Second,
+	httpServers, err := listen(cfg, server.Handler())
+	if err != nil {
+		return err
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		log.Printf("backend listening on :%s", cfg.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %v", err)
+		for range hup {
+			result, err := server.Reload()
+			if err != nil {
+				log.Printf("reload: %v", err)
+				continue
+			}
+			log.Printf("reload: applied %v", result.Applied)
+			if len(result.RestartRequired) > 0 {
+				log.Printf("reload: %v change only after a restart", result.RestartRequired)
+			}
 		}
 	}()
 
@@ -46,7 +200,48 @@ func main() {
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("shutdown error: %v", err)
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown error: %v", err)
+		}
+	}
+	return nil
+}
+
+func runSelftest(cfg config.Config) error {
+	// The self-test talks to an in-process listener on 127.0.0.1, so a
+	// configured cookie domain would stop the session cookie from being sent.
+	cfg.CookieDomain = ""
+	// Only a hash of the configured password may be known; the in-process
+	// server can take a throwaway one instead.
+	if cfg.AppPassword == "" {
+		throwaway := make([]byte, 16)
+		if _, err := rand.Read(throwaway); err != nil {
+			return err
+		}
+		cfg.AppPassword, cfg.AppPasswordHash = hex.EncodeToString(throwaway), ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	server, err := app.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("bootstrap server: %w", err)
+	}
+	defer server.Close()
+
+	var listener *httptest.Server
+	if cfg.CookieSecure {
+		listener = httptest.NewTLSServer(server.Handler())
+	} else {
+		listener = httptest.NewServer(server.Handler())
+	}
+	defer listener.Close()
+
+	runner, err := selftest.New(listener.URL, cfg.AppPassword, listener.Client(), os.Stdout)
+	if err != nil {
+		return err
 	}
+	return runner.Run(ctx)
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/config"
+	"notes-backend/internal/migrate"
+)
+
+const migrateUsage = "usage: migrate up | down [N] | to <version> | status | repair | new <name>"
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	if args[0] == "new" {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: migrate new <name>")
+		}
+		return migrateNew(strings.Join(args[1:], " "))
+	}
+
+	cfg := mustLoadConfig()
+	ctx := context.Background()
+	migrator, closeDB, err := app.OpenMigrator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	switch args[0] {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+		return printStatus(ctx, migrator)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		if err := migrator.Down(ctx, steps); err != nil {
+			return err
+		}
+		return printStatus(ctx, migrator)
+	case "to":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate to <version> (0 rolls everything back)")
+		}
+		if err := migrator.To(ctx, args[1]); err != nil {
+			return err
+		}
+		return printStatus(ctx, migrator)
+	case "status":
+		return printStatus(ctx, migrator)
+	case "repair":
+		repaired, err := migrator.Repair(ctx)
+		if err != nil {
+			return err
+		}
+		for _, version := range repaired {
+			fmt.Println("re-baselined", version)
+		}
+		return printStatus(ctx, migrator)
+	default:
+		return fmt.Errorf(migrateUsage)
+	}
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tREVERSIBLE")
+	pending := 0
+	for _, st := range statuses {
+		state, appliedAt := "pending", "-"
+		switch {
+		case st.Applied:
+			state = "applied"
+			appliedAt = st.AppliedAt.Local().Format(time.DateTime)
+		case !st.AppliedAt.IsZero():
+			state = "rolled back"
+			appliedAt = st.AppliedAt.Local().Format(time.DateTime)
+		}
+		switch {
+		case st.Missing:
+			state += ", missing file"
+		case st.Drifted:
+			state += ", modified"
+		}
+		if !st.Applied && !st.Missing {
+			pending++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", st.Version, state, appliedAt, st.Reversible)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d migration(s), %d pending\n", len(statuses), pending)
+	return nil
+}
+
+func migrateNew(name string) error {
+	root := strings.TrimSpace(os.Getenv("MIGRATIONS_DIR"))
+	if root == "" {
+		root = "migrations"
+	}
+	created, err := migrate.Scaffold(root, config.DatabaseDrivers, name, time.Now())
+	for _, path := range created {
+		fmt.Println("created", path)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"notes-backend/internal/password"
+
+	"golang.org/x/term"
+)
+
+// runHashPassword prints an APP_PASSWORD_HASH for a password typed twice on
+// the terminal, or read from the first line of stdin when piped. To rotate
+// the password, set the new hash and restart; sessions already open stay
+// valid until they expire.
+func runHashPassword(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: hash-password")
+	}
+	plain, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	if plain == "" {
+		return errors.New("password is empty")
+	}
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "again: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(first), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/store"
+)
+
+const recountPageSize = 200
+
+// runRecount measures every note again and stores the counts that differ,
+// for notes written before word counts were kept. Locked notes cannot be
+// read and are skipped.
+func runRecount(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: recount")
+	}
+	cfg := mustLoadConfig()
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	started := time.Now()
+	updated := 0
+	for _, trashed := range []bool{false, true} {
+		for offset := 0; ; offset += recountPageSize {
+			items, _, err := st.ListNotes(ctx, store.NoteFilter{Trashed: trashed, Limit: recountPageSize, Offset: offset, SkipCount: true})
+			if err != nil {
+				return fmt.Errorf("recounted %d notes before failing: %w", updated, err)
+			}
+			for _, n := range items {
+				stats := store.MeasureText(n.Content)
+				if n.IsEncrypted || (stats.Words == n.WordCount && stats.Chars == n.CharCount) {
+					continue
+				}
+				err := st.SetNoteStats(ctx, n.ID, stats)
+				if errors.Is(err, store.ErrNotFound) {
+					// Purged while recounting.
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("recounted %d notes before failing: %w", updated, err)
+				}
+				updated++
+			}
+			if len(items) < recountPageSize {
+				break
+			}
+		}
+	}
+	fmt.Printf("recounted %d notes in %s\n", updated, time.Since(started).Round(time.Millisecond))
+	return nil
+}
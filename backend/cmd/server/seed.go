@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/seed"
+)
+
+const seedUsage = "usage: seed [count] [random-seed]"
+
+// runSeed fills the configured database with fake notes. Passing the same
+// random seed twice yields the same content (IDs still differ), which keeps
+// benchmark runs comparable.
+func runSeed(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf(seedUsage)
+	}
+	count := 200
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid note count %q", args[0])
+		}
+		count = n
+	}
+	randomSeed := uint64(time.Now().UnixNano())
+	if len(args) > 1 {
+		n, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid random seed %q", args[1])
+		}
+		randomSeed = n
+	}
+
+	cfg := mustLoadConfig()
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	notes := seed.Generate(rand.New(rand.NewPCG(randomSeed, 0)), count, time.Now())
+	started := time.Now()
+	err = seed.Insert(ctx, st, notes, func(done int) {
+		fmt.Printf("\rseeded %d/%d notes", done, count)
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("done in %s (random seed %d)\n", time.Since(started).Round(time.Millisecond), randomSeed)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"notes-backend/internal/telegram"
+)
+
+// runTelegramWebhook registers the server's /ingest/telegram with
+// Telegram as the bot's webhook, along with its secret token.
+func runTelegramWebhook(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: telegram-webhook <public base URL>")
+	}
+	base, err := url.Parse(strings.TrimRight(args[0], "/"))
+	if err != nil || base.Scheme != "https" || base.Host == "" {
+		return errors.New("the base URL must be https, which Telegram requires of webhooks")
+	}
+	cfg := mustLoadConfig()
+	if cfg.TelegramBotToken == "" {
+		return errors.New("TELEGRAM_BOT_TOKEN is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	webhookURL := base.JoinPath("ingest", "telegram").String()
+	if err := telegram.SetWebhook(ctx, http.DefaultClient, cfg.TelegramBotToken, webhookURL); err != nil {
+		return err
+	}
+	fmt.Printf("webhook set to %s\n", webhookURL)
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/store"
+)
+
+var tokenScope string
+
+func tokenFlags(flags *flag.FlagSet) {
+	flags.StringVar(&tokenScope, "scope", string(store.ScopeWrite), "what the token may do: `read` (GET and HEAD only) or write")
+}
+
+// runCreateToken makes an API token without a signed-in session, for
+// provisioning scripts. The secret goes to stdout, alone, so that it can be
+// captured; it cannot be shown again.
+func runCreateToken(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: create-token [-scope read|write] <name>")
+	}
+	ctx := context.Background()
+	st, err := app.OpenStore(ctx, mustLoadConfig())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	token, secret, err := app.CreateAPIToken(ctx, st, args[0], store.TokenScope(tokenScope), time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created %s token %q (%s); the secret below is not shown again\n", token.Scope, token.Name, token.ID)
+	fmt.Println(secret)
+	return nil
+}
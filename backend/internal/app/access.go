@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// recordAccess logs that a note was opened. A failure is only logged: the
+// note was read all the same.
+func (s *Server) recordAccess(ctx context.Context, noteID uuid.UUID) {
+	if err := s.store.RecordNoteAccess(context.WithoutCancel(ctx), noteID, s.clock.Now()); err != nil {
+		log.Printf("record note access: %v", err)
+	}
+}
+
+// handleRecentNotes lists the notes opened last, with when and how often
+// over the retention period.
+func (s *Server) handleRecentNotes(w http.ResponseWriter, r *http.Request) {
+	s.listAccessedNotes(w, r, s.accessSince(0), false)
+}
+
+// handleFrequentNotes lists the notes opened most, over the last days
+// given or the whole retention period.
+func (s *Server) handleFrequentNotes(w http.ResponseWriter, r *http.Request) {
+	days := parsePositiveInt(r.URL.Query().Get("days"), 0)
+	s.listAccessedNotes(w, r, s.accessSince(time.Duration(days)*24*time.Hour), true)
+}
+
+func (s *Server) listAccessedNotes(w http.ResponseWriter, r *http.Request, since time.Time, byOpens bool) {
+	items, err := s.store.ListAccessedNotes(r.Context(), store.AccessFilter{
+		Since:   since,
+		ByOpens: byOpens,
+		Limit:   min(parsePositiveInt(r.URL.Query().Get("limit"), 20), 100),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// accessSince is where a window of the given length starts, kept within
+// the retention period; 0 asks for all of it.
+func (s *Server) accessSince(window time.Duration) time.Time {
+	if s.cfg.AccessRetention > 0 && (window == 0 || window > s.cfg.AccessRetention) {
+		window = s.cfg.AccessRetention
+	}
+	if window == 0 {
+		return time.Time{}
+	}
+	return s.clock.Now().Add(-window)
+}
+
+// purgeNoteAccess deletes the note opens older than the retention period.
+func (s *Server) purgeNoteAccess(ctx context.Context) {
+	deleted, err := s.store.DeleteNoteAccess(ctx, s.clock.Now().Add(-s.cfg.AccessRetention))
+	if err != nil {
+		log.Printf("purge note access log: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("deleted %d note access log entries", deleted)
+	}
+}
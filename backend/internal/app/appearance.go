@@ -0,0 +1,176 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"notes-backend/internal/store"
+)
+
+// iconMaxBytes bounds an icon; the longest emoji in use, family and flag
+// sequences, stay well under it.
+const iconMaxBytes = 32
+
+const (
+	zeroWidthJoiner    = '\u200d'
+	variationSelector  = '\ufe0f'
+	combiningKeycap    = '\u20e3'
+	blackFlag          = '\U0001f3f4'
+	cancelTag          = '\U000e007f'
+	regionalIndicatorA = '\U0001f1e6'
+	regionalIndicatorZ = '\U0001f1ff'
+)
+
+// emojiRanges are the code points that show as emoji, give or take the
+// odd symbol that only does with a variation selector.
+var emojiRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2190, Hi: 0x21ff, Stride: 1},
+		{Lo: 0x2300, Hi: 0x23ff, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b00, Hi: 0x2bff, Stride: 1},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1f1e5, Stride: 1},
+		{Lo: 0x1f200, Hi: 0x1f3fa, Stride: 1},
+		{Lo: 0x1f400, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+var skinTones = &unicode.RangeTable{R32: []unicode.Range32{{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1}}}
+
+type appearanceRequest struct {
+	Color string `json:"color"`
+	Icon  string `json:"icon"`
+}
+
+// handleSetAppearance sets a note's color, one of store.NoteColors, and
+// its icon, a single emoji; an empty one clears it.
+func (s *Server) handleSetAppearance(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req appearanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	req.Color = strings.ToLower(strings.TrimSpace(req.Color))
+	req.Icon = strings.TrimSpace(req.Icon)
+	var errs []error
+	if req.Color != "" && !slices.Contains(store.NoteColors, req.Color) {
+		errs = append(errs, &fieldError{Field: "color", Message: "color must be one of " + strings.Join(store.NoteColors, ", ")})
+	}
+	if req.Icon != "" && !validIcon(req.Icon) {
+		errs = append(errs, &fieldError{Field: "icon", Message: "icon must be a single emoji"})
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	n, err := s.store.SetAppearance(r.Context(), noteID, req.Color, req.Icon, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusOK, n)
+}
+
+// parseColorFilter reads the color query parameter: a palette color, none
+// for uncolored notes, or empty for any.
+func parseColorFilter(raw string) (*string, bool) {
+	raw = strings.ToLower(raw)
+	switch {
+	case raw == "":
+		return nil, true
+	case raw == "none":
+		none := ""
+		return &none, true
+	case slices.Contains(store.NoteColors, raw):
+		return &raw, true
+	}
+	return nil, false
+}
+
+// validIcon reports whether icon is one emoji as it would be typed: a flag,
+// a keycap, or emoji joined by zero-width joiners, each optionally with a
+// variation selector and a skin tone.
+func validIcon(icon string) bool {
+	if len(icon) > iconMaxBytes {
+		return false
+	}
+	runes := []rune(icon)
+	if len(runes) == 2 && isRegionalIndicator(runes[0]) && isRegionalIndicator(runes[1]) {
+		return true
+	}
+	if isKeycapBase(runes[0]) {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	}
+
+	for i := 0; ; {
+		if i == len(runes) || !unicode.Is(emojiRanges, runes[i]) {
+			return false
+		}
+		base := runes[i]
+		i++
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		}
+		if i < len(runes) && unicode.Is(skinTones, runes[i]) {
+			i++
+		}
+		// Subdivision flags spell their region in tags after a black flag.
+		if base == blackFlag && i < len(runes) && isTag(runes[i]) {
+			for i < len(runes) && isTag(runes[i]) && runes[i] != cancelTag {
+				i++
+			}
+			if i == len(runes) || runes[i] != cancelTag {
+				return false
+			}
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
+
+func isKeycapBase(r rune) bool {
+	return r == '#' || r == '*' || (r >= '0' && r <= '9')
+}
+
+func isTag(r rune) bool {
+	return r >= 0xe0020 && r <= cancelTag
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// atomExcerptRunes is about how much of a note the Atom feed renders;
+// content is cut at the last line break before it.
+const atomExcerptRunes = 600
+
+// atomFeedID names the feed for readers, which need it stable.
+var atomFeedID = "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte("notes-backend/feed.atom")).String()
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// handleAtomFeed serves the notes updated last, limit of them (20 by
+// default, at most 100), as an Atom feed with the start of each rendered
+// as HTML. Archived notes are left out, and so is the content of locked
+// ones.
+func (s *Server) handleAtomFeed(w http.ResponseWriter, r *http.Request) {
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 20), 100)
+	notes, err := s.latestNotes(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	feed := atomFeed{ID: atomFeedID, Title: "Notes", Author: atomAuthor{Name: "Notes"}, Entries: []atomEntry{}}
+	updated := s.clock.Now()
+	if len(notes) > 0 {
+		updated = notes[0].UpdatedAt
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	for _, n := range notes {
+		entry := atomEntry{
+			ID:        "urn:uuid:" + n.ID.String(),
+			Title:     n.Title,
+			Updated:   n.UpdatedAt.UTC().Format(time.RFC3339),
+			Published: n.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		for _, tag := range n.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		if html := s.noteHTML(atomExcerpt(n)); html != "" {
+			entry.Summary = &atomText{Type: "html", Body: html}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
+
+// latestNotes returns the limit live, unarchived notes updated last.
+// Listings put pinned notes first, so pages are read until limit unpinned
+// ones have come, and the pinned ones then take their place by date.
+func (s *Server) latestNotes(ctx context.Context, limit int) ([]store.Note, error) {
+	archived := false
+	var notes []store.Note
+	unpinned := 0
+	for offset := 0; unpinned < limit; offset += limit {
+		page, _, err := s.store.ListNotes(ctx, store.NoteFilter{Archived: &archived, Sort: store.SortUpdated, Limit: limit, Offset: offset, SkipCount: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range page {
+			if !n.IsPinned {
+				unpinned++
+			}
+		}
+		notes = append(notes, page...)
+		if len(page) < limit {
+			break
+		}
+	}
+	slices.SortStableFunc(notes, func(a, b store.Note) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	return notes[:min(len(notes), limit)], nil
+}
+
+// atomExcerpt shortens a note's content to about atomExcerptRunes, ending
+// on a line break when there is one, and marks the cut with an ellipsis.
+func atomExcerpt(n store.Note) store.Note {
+	if utf8.RuneCountInString(n.Content) <= atomExcerptRunes {
+		return n
+	}
+	content, runes := n.Content, 0
+	for i := range n.Content {
+		if runes == atomExcerptRunes {
+			content = n.Content[:i]
+			break
+		}
+		runes++
+	}
+	if line := strings.LastIndexByte(content, '\n'); line > 0 {
+		content = content[:line]
+	}
+	n.Content = strings.TrimRight(content, " \t\n") + "\n\n…"
+	return n
+}
@@ -0,0 +1,398 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"notes-backend/internal/extract"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// multipartMemory is how much of an upload is buffered in memory before
+// the rest spills to a temporary file.
+const multipartMemory = 8 << 20
+
+// inlineTypes are shown in the browser instead of downloaded, so notes can
+// embed pictures. Anything that could run script, SVG included, is not.
+var inlineTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// requireBlobs answers 503 when no blob store is configured, which only
+// happens for servers built around a bare store.
+func (s *Server) requireBlobs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.blobs == nil {
+			writeError(w, http.StatusServiceUnavailable, codeAttachmentsDisabled, "attachments are not configured")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if _, err := s.store.GetNote(r.Context(), noteID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	// Leave room for the multipart framing around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxAttachmentBytes+multipartMemory)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "attachment too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid multipart body")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeFieldError(w, "file", "file is required")
+		return
+	}
+	defer file.Close()
+	if header.Size > s.cfg.MaxAttachmentBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "attachment too large")
+		return
+	}
+
+	a := store.Attachment{
+		ID:          uuid.New(),
+		NoteID:      noteID,
+		Filename:    attachmentFilename(header.Filename),
+		ContentType: attachmentType(header.Header.Get("Content-Type")),
+		Size:        header.Size,
+		CreatedAt:   s.clock.Now(),
+	}
+	body, err := withText(&a, file)
+	if err != nil {
+		log.Printf("read attachment %s: %v", a.ID, err)
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	if err := s.blobs.Put(r.Context(), a.ID.String(), body, a.Size); err != nil {
+		log.Printf("store attachment %s: %v", a.ID, err)
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	if err := s.store.CreateAttachment(r.Context(), a); err != nil {
+		if err := s.blobs.Delete(context.WithoutCancel(r.Context()), a.ID.String()); err != nil {
+			log.Printf("delete attachment %s: %v", a.ID, err)
+		}
+		writeNoteError(w, err)
+		return
+	}
+	setAuditEntity(r.Context(), a.ID.String())
+	setAuditSummary(r.Context(), "note %s", noteID)
+	writeJSON(w, http.StatusCreated, a)
+}
+
+// saveAttachment stores body as a's blob and then writes a's row, deleting
+// the blob again when the row cannot be written.
+func (s *Server) saveAttachment(ctx context.Context, a store.Attachment, body io.Reader) error {
+	body, err := withText(&a, body)
+	if err != nil {
+		return fmt.Errorf("read attachment %s: %w", a.ID, err)
+	}
+	if err := s.blobs.Put(ctx, a.ID.String(), body, a.Size); err != nil {
+		return fmt.Errorf("store attachment %s: %w", a.ID, err)
+	}
+	if err := s.store.CreateAttachment(ctx, a); err != nil {
+		if err := s.blobs.Delete(context.WithoutCancel(ctx), a.ID.String()); err != nil {
+			log.Printf("delete attachment %s: %v", a.ID, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleListAttachments(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if _, err := s.store.GetNote(r.Context(), noteID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	items, err := s.store.ListAttachments(r.Context(), noteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.attachment(w, r)
+	if !ok {
+		return
+	}
+
+	blob, err := s.blobs.Get(r.Context(), a.ID.String())
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("attachment %s has no blob", a.ID)
+		writeError(w, http.StatusNotFound, codeAttachmentNotFound, "attachment not found")
+		return
+	}
+	if err != nil {
+		log.Printf("read attachment %s: %v", a.ID, err)
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	defer blob.Close()
+
+	disposition := "attachment"
+	if inlineTypes[a.ContentType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("send attachment %s: %v", a.ID, err)
+	}
+}
+
+// handleDeleteAttachment removes the blob before the row, so a failure
+// leaves a row to retry with rather than an unreferenced blob.
+func (s *Server) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.attachment(w, r)
+	if !ok {
+		return
+	}
+	if err := s.blobs.Delete(r.Context(), a.ID.String()); err != nil {
+		log.Printf("delete attachment %s: %v", a.ID, err)
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	err := s.store.DeleteAttachment(r.Context(), a.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	s.forgetAttachments(r.Context(), []uuid.UUID{a.ID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachment loads the attachment named by the id parameter, writing the
+// error response itself when that fails.
+func (s *Server) attachment(w http.ResponseWriter, r *http.Request) (store.Attachment, bool) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return store.Attachment{}, false
+	}
+	a, err := s.store.GetAttachment(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeAttachmentNotFound, "attachment not found")
+		return store.Attachment{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return store.Attachment{}, false
+	}
+	return a, true
+}
+
+// deleteDetachedAttachments deletes the blobs of attachments whose notes
+// have been purged, then their rows.
+func (s *Server) deleteDetachedAttachments(ctx context.Context) {
+	const batch = 100
+	deleted := 0
+	defer func() {
+		if deleted > 0 {
+			log.Printf("deleted %d attachment(s) of purged notes", deleted)
+		}
+	}()
+	for {
+		items, err := s.store.DetachedAttachments(ctx, batch)
+		if err != nil {
+			log.Printf("list detached attachments: %v", err)
+			return
+		}
+		ids := make([]uuid.UUID, len(items))
+		for i, a := range items {
+			ids[i] = a.ID
+		}
+		s.forgetAttachments(ctx, ids)
+		for _, a := range items {
+			if err := s.blobs.Delete(ctx, a.ID.String()); err != nil {
+				log.Printf("delete attachment %s: %v", a.ID, err)
+				return
+			}
+			if err := s.store.DeleteAttachment(ctx, a.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+				log.Printf("delete attachment %s: %v", a.ID, err)
+				return
+			}
+			deleted++
+		}
+		if len(items) < batch {
+			return
+		}
+	}
+}
+
+// withText reads the text of a from body, when a is a file extract reads,
+// and returns a reader of body again for storing it.
+func withText(a *store.Attachment, body io.Reader) (io.Reader, error) {
+	if !extract.Supports(a.ContentType, a.Filename) || a.Size > extract.MaxInput {
+		return body, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	a.Text = extract.Text(a.ContentType, a.Filename, data)
+	return bytes.NewReader(data), nil
+}
+
+// forgetAttachments drops deleted attachments from the search index. It is
+// best effort: searches skip deleted attachments the index still has.
+func (s *Server) forgetAttachments(ctx context.Context, ids []uuid.UUID) {
+	if s.search == nil || len(ids) == 0 {
+		return
+	}
+	if err := s.search.ForgetAttachments(ctx, ids); err != nil {
+		log.Printf("remove attachments from search index: %v", err)
+	}
+}
+
+// maxMatches is how many attachments a search lists, and snippetRadius how
+// many characters of text their snippets show on each side of the match.
+const (
+	maxMatches    = 10
+	snippetRadius = 80
+)
+
+// attachmentMatch is an attachment found by a note search, with an
+// HTML-escaped excerpt of its text, the first match in <mark>.
+type attachmentMatch struct {
+	store.Attachment
+	Snippet string `json:"snippet"`
+}
+
+// attachmentMatches returns the attachments that query matches, by filename
+// or text, whatever filters the notes were listed with.
+func (s *Server) attachmentMatches(ctx context.Context, query string) ([]attachmentMatch, error) {
+	items, err := s.store.SearchAttachments(ctx, store.AttachmentFilter{Query: query, Limit: maxMatches})
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]attachmentMatch, len(items))
+	for i, a := range items {
+		matches[i] = attachmentMatch{Attachment: a, Snippet: attachmentSnippet(a.Text, query)}
+	}
+	return matches, nil
+}
+
+// attachmentSnippet excerpts text around the first place a term of query
+// appears, ignoring case and accents, or from its start when none does, as
+// when the filename matched or a typo was forgiven.
+func attachmentSnippet(text, query string) string {
+	runes := []rune(text)
+	// key folds text rune by rune, at mapping each of its bytes back to the
+	// rune it came from.
+	var key strings.Builder
+	at := make([]int, 0, len(text))
+	for i, r := range runes {
+		folded := store.FoldText(string(r))
+		if r < utf8.RuneSelf {
+			folded = strings.ToLower(string(r))
+		}
+		key.WriteString(folded)
+		for range len(folded) {
+			at = append(at, i)
+		}
+	}
+	start, end := 0, 0
+	for _, term := range store.ParseTerms(query) {
+		folded := store.FoldText(term.Text)
+		if term.Exclude || folded == "" {
+			continue
+		}
+		if i := strings.Index(key.String(), folded); i >= 0 && (end == 0 || at[i] < start) {
+			start, end = at[i], at[i+len(folded)-1]+1
+		}
+	}
+	if end == 0 {
+		return excerpt(runes[:min(len(runes), 2*snippetRadius)], false, len(runes) > 2*snippetRadius)
+	}
+	from, to := max(0, start-snippetRadius), min(len(runes), end+snippetRadius)
+	return excerpt(runes[from:start], from > 0, false) + "<mark>" + html.EscapeString(string(runes[start:end])) + "</mark>" +
+		excerpt(runes[end:to], false, to < len(runes))
+}
+
+// excerpt escapes part of a text for a snippet, on one line, marking where
+// it was cut.
+func excerpt(part []rune, cutBefore, cutAfter bool) string {
+	text := strings.Join(strings.Fields(string(part)), " ")
+	// Spaces at the ends separate the part from the match.
+	if len(part) > 0 && unicode.IsSpace(part[0]) {
+		text = " " + text
+	}
+	if len(part) > 0 && unicode.IsSpace(part[len(part)-1]) && text != " " {
+		text += " "
+	}
+	if cutBefore {
+		text = "…" + text
+	}
+	if cutAfter {
+		text += "…"
+	}
+	return html.EscapeString(text)
+}
+
+// attachmentFilename keeps the base name of what the client sent, bounded
+// to what the database column holds.
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+func attachmentType(raw string) string {
+	mediaType, params, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
@@ -0,0 +1,320 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+const auditRecordKey sessionContextKey = "auditRecord"
+
+// auditRecord collects what handlers know about the change a request made,
+// beyond what its route says, before the audit middleware stores it.
+type auditRecord struct {
+	actor    string
+	action   string
+	entityID string
+	summary  string
+	// always records the entry even though the request failed; skip drops
+	// it even though the request succeeded.
+	always bool
+	skip   bool
+}
+
+// auditActions names the actions of routes the rule in auditAction gets
+// wrong.
+var auditActions = map[string]string{
+	"POST /import":                      "note.import",
+	"POST /notes/from-template/{id}":    "note.create",
+	"POST /clip":                        "note.clip",
+	"POST /sync":                        "note.sync",
+	"DELETE /notes/{id}/purge":          "note.purge",
+	"POST /notes/{id}/attachments":      "attachment.create",
+	"POST /ingest/email":                "note.ingest",
+	"POST /ingest/telegram":             "note.ingest",
+	"POST /auth/tokens":                 "token.create",
+	"DELETE /auth/tokens/{id}":          "token.delete",
+	"DELETE /auth/sessions/{id}":        "session.delete",
+	"POST /auth/sessions/revoke-others": "session.revoke_others",
+	"POST /auth/2fa/verify":             "auth.login",
+	"POST /auth/2fa/setup":              "two_factor.setup",
+	"POST /auth/2fa/enable":             "two_factor.enable",
+	"POST /auth/2fa/disable":            "two_factor.disable",
+	"POST /admin/backup":                "backup.create",
+	"POST /admin/restore":               "backup.restore",
+	"POST /admin/maintenance":           "maintenance.set",
+	"POST /admin/reload":                "config.reload",
+}
+
+// auditEntities maps the first segment of a route to the entity it acts on.
+var auditEntities = map[string]string{
+	"notes":       "note",
+	"tags":        "tag",
+	"tasks":       "task",
+	"notebooks":   "notebook",
+	"templates":   "template",
+	"searches":    "saved_search",
+	"attachments": "attachment",
+	"webhooks":    "webhook",
+	"settings":    "settings",
+	"auth":        "auth",
+}
+
+// audit records every request that may change something in the audit log
+// once it has succeeded. Reads are left out, and so is GraphQL, which has
+// no mutations.
+func (s *Server) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+			r.URL.Path == "/graphql" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &auditRecord{actor: "anonymous"}
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditRecordKey, rec)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rec.skip || (status >= 400 && !rec.always) {
+			return
+		}
+
+		// The route is only known once chi has matched all of it.
+		rctx := chi.RouteContext(r.Context())
+		pattern := ""
+		if rctx != nil {
+			pattern = rctx.RoutePattern()
+		}
+		action := rec.action
+		if action == "" {
+			action = auditAction(r.Method, pattern)
+		}
+		entityID := rec.entityID
+		if entityID == "" && rctx != nil {
+			entityID = rctx.URLParam("id")
+			if entityID == "" {
+				entityID = rctx.URLParam("name")
+			}
+		}
+		entity, _, _ := strings.Cut(action, ".")
+
+		entry := store.AuditEntry{
+			ID:        uuid.New(),
+			At:        s.clock.Now(),
+			Actor:     rec.actor,
+			Action:    action,
+			Entity:    entity,
+			EntityID:  entityID,
+			Summary:   rec.summary,
+			IP:        remoteHost(r),
+			RequestID: chimw.GetReqID(r.Context()),
+		}
+		if err := s.store.AddAuditEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+			log.Printf("add audit entry: %v", err)
+		}
+	})
+}
+
+// auditAction derives an action such as "note.update" or "note.share.delete"
+// from a route: the entity is its first segment and the verb its last fixed
+// segment, or the method when it has none.
+func auditAction(method, pattern string) string {
+	if action, ok := auditActions[method+" "+pattern]; ok {
+		return action
+	}
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	entity, ok := auditEntities[segments[0]]
+	if !ok {
+		entity = segments[0]
+	}
+
+	verb := ""
+	for _, seg := range segments[1:] {
+		if seg != "" && !strings.HasPrefix(seg, "{") {
+			verb = seg
+		}
+	}
+	switch {
+	case verb != "" && method == http.MethodDelete:
+		verb += ".delete"
+	case verb != "":
+	case method == http.MethodPost:
+		verb = "create"
+	case method == http.MethodDelete:
+		verb = "delete"
+	default:
+		verb = "update"
+	}
+	return entity + "." + verb
+}
+
+func auditRecordFrom(ctx context.Context) *auditRecord {
+	rec, _ := ctx.Value(auditRecordKey).(*auditRecord)
+	return rec
+}
+
+// setAuditActor names who made the request: "session:<id>" for a
+// signed-in browser or "token:<id>" for an API token.
+func setAuditActor(ctx context.Context, actor string) {
+	if rec := auditRecordFrom(ctx); rec != nil {
+		rec.actor = actor
+	}
+}
+
+// setAuditEntity names what the request acted on when the route does not,
+// like the ID of a note it created.
+func setAuditEntity(ctx context.Context, id string) {
+	if rec := auditRecordFrom(ctx); rec != nil {
+		rec.entityID = id
+	}
+}
+
+func setAuditSummary(ctx context.Context, format string, args ...any) {
+	if rec := auditRecordFrom(ctx); rec != nil {
+		rec.summary = fmt.Sprintf(format, args...)
+	}
+}
+
+// auditFailure records a request that failed under its own action, for
+// failures worth knowing about such as wrong passwords.
+func auditFailure(ctx context.Context, action string) {
+	if rec := auditRecordFrom(ctx); rec != nil {
+		rec.action = action
+		rec.always = true
+	}
+}
+
+// skipAudit leaves out a request that turned out to change nothing.
+func skipAudit(ctx context.Context) {
+	if rec := auditRecordFrom(ctx); rec != nil {
+		rec.skip = true
+	}
+}
+
+// noteChanges lists the fields an update changes, for the audit summary.
+func noteChanges(current store.Note, input store.NoteInput) string {
+	var fields []string
+	if current.Title != input.Title {
+		fields = append(fields, "title")
+	}
+	if current.Content != input.Content {
+		fields = append(fields, "content")
+	}
+	if !slices.Equal(current.Tags, input.Tags) {
+		fields = append(fields, "tags")
+	}
+	if current.IsFavorite != input.IsFavorite {
+		fields = append(fields, "favorite")
+	}
+	if input.Language != "" && current.Language != input.Language {
+		fields = append(fields, "language")
+	}
+	if input.NotebookID != nil && !sameNotebook(current.NotebookID, input.NotebookID) {
+		fields = append(fields, "notebook")
+	}
+	if len(fields) == 0 {
+		return "no changes"
+	}
+	return strings.Join(fields, ", ")
+}
+
+// sameNotebook compares notebook references, in which nil and uuid.Nil
+// both mean no notebook.
+func sameNotebook(a, b *uuid.UUID) bool {
+	deref := func(id *uuid.UUID) uuid.UUID {
+		if id == nil {
+			return uuid.Nil
+		}
+		return *id
+	}
+	return deref(a) == deref(b)
+}
+
+// remoteHost is the client's address without the port, after realIP has
+// applied the forwarding headers of a trusted proxy.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type auditPage struct {
+	Items []store.AuditEntry `json:"items"`
+	Page  int                `json:"page"`
+	Limit int                `json:"limit"`
+	Total int                `json:"total"`
+}
+
+// handleListAudit lists audit entries newest first. from and to take an
+// RFC 3339 instant or a day as in created=, a day in to including all of
+// it.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, ok := s.auditBound(strings.TrimSpace(q.Get("from")), false)
+	if !ok {
+		writeFieldError(w, "from", "from must be an RFC 3339 time, today, yesterday or YYYY-MM-DD")
+		return
+	}
+	to, ok := s.auditBound(strings.TrimSpace(q.Get("to")), true)
+	if !ok {
+		writeFieldError(w, "to", "to must be an RFC 3339 time, today, yesterday or YYYY-MM-DD")
+		return
+	}
+	page := parsePositiveInt(q.Get("page"), 1)
+	limit := min(parsePositiveInt(q.Get("limit"), 30), 100)
+
+	items, total, err := s.store.ListAuditEntries(r.Context(), store.AuditFilter{
+		From:     from,
+		To:       to,
+		Entity:   strings.TrimSpace(q.Get("entity")),
+		EntityID: strings.TrimSpace(q.Get("entity_id")),
+		Action:   strings.TrimSpace(q.Get("action")),
+		Limit:    limit,
+		Offset:   (page - 1) * limit,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, auditPage{items, page, limit, total})
+}
+
+func (s *Server) auditBound(raw string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	start, next, ok := s.dayRange(raw)
+	if end {
+		return next, ok
+	}
+	return start, ok
+}
+
+// purgeAudit deletes audit entries older than the retention period.
+func (s *Server) purgeAudit(ctx context.Context) {
+	deleted, err := s.store.DeleteAuditEntries(ctx, s.clock.Now().Add(-s.cfg.AuditRetention))
+	if err != nil {
+		log.Printf("purge audit log: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("deleted %d audit log entries", deleted)
+	}
+}
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"notes-backend/internal/backup"
+	"notes-backend/internal/dump"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// backupsFailed counts the scheduled backups that failed since start.
+var backupsFailed = expvar.NewInt("backups_failed")
+
+// requireBackups answers 503 when backups are not configured, which only
+// happens for servers built around a bare store.
+func (s *Server) requireBackups(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.backups == nil {
+			writeError(w, http.StatusServiceUnavailable, codeBackupsDisabled, "backups are not configured")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCreateBackup takes a backup right away, as the schedule would.
+func (s *Server) handleCreateBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := s.backups.Run(r.Context(), s.clock.Now())
+	if errors.Is(err, backup.ErrRunning) {
+		writeError(w, http.StatusConflict, codeBackupRunning, "a backup is already running")
+		return
+	}
+	if err != nil {
+		log.Printf("backup: %v", err)
+		writeError(w, http.StatusInternalServerError, codeStorageError, "backup failed")
+		return
+	}
+	setAuditEntity(r.Context(), b.Name)
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := s.backups.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	writeJSON(w, http.StatusOK, itemList[backup.Backup]{Items: backups})
+}
+
+func (s *Server) handleGetBackup(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	body, err := s.backups.Open(r.Context(), name)
+	if errors.Is(err, backup.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeBackupNotFound, "backup not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+	defer body.Close()
+
+	contentType := "application/octet-stream"
+	if strings.HasSuffix(name, ".json") {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("send backup %s: %v", name, err)
+	}
+}
+
+// runBackup takes a scheduled backup.
+func (s *Server) runBackup(ctx context.Context) {
+	b, err := s.backups.Run(ctx, s.clock.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			backupsFailed.Add(1)
+		}
+		log.Printf("scheduled backup: %v", err)
+		return
+	}
+	log.Printf("backed up the database to %s (%d bytes)", b.Name, b.Size)
+}
+
+// maxRestoreBytes bounds a restore upload and what a ZIP of it unpacks to.
+const maxRestoreBytes = 512 << 20
+
+type restoreSummary struct {
+	DryRun     bool      `json:"dry_run"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Notebooks  int       `json:"notebooks"`
+	Notes      int       `json:"notes"`
+	// Skipped counts the notes of the snapshot that are here already.
+	Skipped int `json:"skipped"`
+}
+
+// handleRestore brings back the notes and notebooks of a snapshot that are
+// missing, keeping their IDs, all in one transaction. The snapshot is a
+// stored backup named by backup, or the upload: a JSON dump or a ZIP from
+// GET /export. Notes that exist, even in the trash, are left as they are;
+// dry_run=true reports the same without writing anything.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	file, ok := s.readSnapshot(w, r)
+	if !ok {
+		return
+	}
+	plan, err := dump.Prepare(r.Context(), s.store, file)
+	if errors.Is(err, dump.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, codeInvalidImport, err.Error())
+		return
+	}
+	if err == nil && !dryRun {
+		err = plan.Apply(r.Context(), s.store)
+	}
+	if err != nil {
+		log.Printf("restore: %v", err)
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if dryRun {
+		skipAudit(r.Context())
+	}
+	setAuditSummary(r.Context(), "%d note(s) and %d notebook(s) restored, %d skipped", len(plan.Notes), len(plan.Notebooks), plan.Skipped)
+	writeJSON(w, http.StatusOK, restoreSummary{
+		DryRun:     dryRun,
+		Version:    file.Version,
+		ExportedAt: file.ExportedAt,
+		Notebooks:  len(plan.Notebooks),
+		Notes:      len(plan.Notes),
+		Skipped:    plan.Skipped,
+	})
+}
+
+// readSnapshot reads the snapshot handleRestore restores, writing the
+// error response itself.
+func (s *Server) readSnapshot(w http.ResponseWriter, r *http.Request) (dump.File, bool) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxRestoreBytes)
+	if name := strings.TrimSpace(r.URL.Query().Get("backup")); name != "" {
+		if s.backups == nil {
+			writeError(w, http.StatusServiceUnavailable, codeBackupsDisabled, "backups are not configured")
+			return dump.File{}, false
+		}
+		if !strings.HasSuffix(name, ".json") {
+			writeFieldError(w, "backup", "only json backups can be restored here; use pg_restore for pg_dump archives")
+			return dump.File{}, false
+		}
+		rc, err := s.backups.Open(r.Context(), name)
+		if errors.Is(err, backup.ErrNotFound) {
+			writeError(w, http.StatusNotFound, codeBackupNotFound, "backup not found")
+			return dump.File{}, false
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+			return dump.File{}, false
+		}
+		defer rc.Close()
+		body = rc
+	}
+
+	tmp, err := os.CreateTemp("", "notes-restore-*")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "could not store upload")
+		return dump.File{}, false
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("snapshot is larger than %d MiB", maxRestoreBytes>>20))
+		return dump.File{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "could not read snapshot")
+		return dump.File{}, false
+	}
+
+	head := make([]byte, 4)
+	n, _ := tmp.ReadAt(head, 0)
+	var file dump.File
+	if bytes.HasPrefix(head[:n], []byte("PK\x03\x04")) {
+		file, err = dump.ReadManifest(tmp, size, maxRestoreBytes)
+	} else {
+		file, err = dump.Read(io.NewSectionReader(tmp, 0, size))
+	}
+	switch {
+	case errors.Is(err, dump.ErrVersion):
+		writeError(w, http.StatusUnprocessableEntity, codeUnsupportedDump, err.Error())
+		return dump.File{}, false
+	case errors.Is(err, dump.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("archive unpacks to more than %d MiB", maxRestoreBytes>>20))
+		return dump.File{}, false
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidImport, err.Error())
+		return dump.File{}, false
+	}
+	return file, true
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// maxBulkOps bounds how many operations one bulk request may carry, and so
+// how long its transaction runs.
+const maxBulkOps = 500
+
+var bulkActions = []store.BulkAction{store.BulkDelete, store.BulkTag, store.BulkUntag, store.BulkFavorite, store.BulkMove}
+
+type bulkOperation struct {
+	Action     store.BulkAction `json:"action"`
+	ID         uuid.UUID        `json:"id"`
+	Tags       []string         `json:"tags"`
+	Value      bool             `json:"value"`
+	NotebookID *uuid.UUID       `json:"notebook_id"`
+}
+
+type bulkRequest struct {
+	Operations []bulkOperation `json:"operations"`
+}
+
+type bulkResult struct {
+	ID     uuid.UUID        `json:"id"`
+	Action store.BulkAction `json:"action"`
+	Status string           `json:"status"`
+}
+
+type bulkResponse struct {
+	Results []bulkResult `json:"results"`
+}
+
+// handleBulkNotes applies a list of operations in one transaction. An
+// operation on a note that is missing or in the trash reports not_found and
+// leaves the others to go ahead; an invalid one rejects the whole request.
+func (s *Server) handleBulkNotes(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeFieldError(w, "operations", "operations are required")
+		return
+	}
+	if len(req.Operations) > maxBulkOps {
+		writeFieldError(w, "operations", fmt.Sprintf("at most %d operations per request", maxBulkOps))
+		return
+	}
+
+	var notebooks []store.Notebook
+	ops := make([]store.BulkOp, 0, len(req.Operations))
+	for i, o := range req.Operations {
+		op := store.BulkOp{Action: o.Action, NoteID: o.ID}
+		if !slices.Contains(bulkActions, o.Action) {
+			writeFieldError(w, fmt.Sprintf("operations[%d].action", i), fmt.Sprintf("operations[%d]: unknown action %q", i, o.Action))
+			return
+		}
+		if o.ID == uuid.Nil {
+			writeFieldError(w, fmt.Sprintf("operations[%d].id", i), fmt.Sprintf("operations[%d]: id is required", i))
+			return
+		}
+		switch o.Action {
+		case store.BulkTag, store.BulkUntag:
+			op.Tags = sanitizeTags(o.Tags)
+			if len(op.Tags) == 0 {
+				writeFieldError(w, fmt.Sprintf("operations[%d].tags", i), fmt.Sprintf("operations[%d]: tags are required", i))
+				return
+			}
+		case store.BulkFavorite:
+			op.Favorite = o.Value
+		case store.BulkMove:
+			if o.NotebookID != nil {
+				if notebooks == nil {
+					var err error
+					if notebooks, err = s.store.ListNotebooks(r.Context()); err != nil {
+						writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+						return
+					}
+				}
+				if !slices.ContainsFunc(notebooks, func(nb store.Notebook) bool { return nb.ID == *o.NotebookID }) {
+					writeFieldError(w, fmt.Sprintf("operations[%d].notebook_id", i), fmt.Sprintf("operations[%d]: notebook not found", i))
+					return
+				}
+			}
+			op.NotebookID = o.NotebookID
+		}
+		ops = append(ops, op)
+	}
+
+	applied, err := s.store.ApplyBulk(r.Context(), ops, s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	results := make([]bulkResult, len(ops))
+	done := 0
+	for i, op := range ops {
+		results[i] = bulkResult{ID: op.NoteID, Action: op.Action, Status: "ok"}
+		if !applied[i] {
+			results[i].Status = "not_found"
+			continue
+		}
+		done++
+	}
+	setAuditSummary(r.Context(), "%d of %d operation(s) applied", done, len(ops))
+	writeJSON(w, http.StatusOK, bulkResponse{results})
+}
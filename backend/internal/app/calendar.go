@@ -0,0 +1,154 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+)
+
+// icsTime is the UTC form of iCalendar DATE-TIME values.
+const icsTime = "20060102T150405Z"
+
+// icsLineOctets is where iCalendar folds content lines.
+const icsLineOctets = 75
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+type scheduleRequest struct {
+	DueAt      *time.Time `json:"due_at"`
+	ReminderAt *time.Time `json:"reminder_at"`
+}
+
+// handleScheduleNote sets a note's due date and reminder, both RFC 3339;
+// null or leaving one out clears it.
+func (s *Server) handleScheduleNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "due_at and reminder_at must be RFC 3339 times or null")
+		return
+	}
+
+	n, err := s.store.SetSchedule(r.Context(), noteID, req.DueAt, req.ReminderAt, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusOK, n)
+}
+
+// handleCalendarFeed serves the notes with a due date or a reminder as an
+// iCalendar feed. Each is an event at its due date, or at its reminder
+// when it has none, with an alarm at the reminder; with todo=true notes
+// with a due date are to-dos instead, for task apps. Locked notes keep
+// their content out of the feed.
+func (s *Server) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	todo := false
+	if raw := strings.TrimSpace(r.URL.Query().Get("todo")); raw != "" {
+		var err error
+		if todo, err = strconv.ParseBool(raw); err != nil {
+			writeFieldError(w, "todo", "todo must be true or false")
+			return
+		}
+	}
+	notes, err := s.store.ListScheduledNotes(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	var cal icsWriter
+	cal.line("BEGIN:VCALENDAR")
+	cal.line("VERSION:2.0")
+	cal.line("PRODID:-//notes-backend//calendar//EN")
+	cal.line("CALSCALE:GREGORIAN")
+	cal.line("METHOD:PUBLISH")
+	cal.line("X-WR-CALNAME:Notes")
+	for _, n := range notes {
+		component := "VEVENT"
+		if todo && n.DueAt != nil {
+			component = "VTODO"
+		}
+		cal.line("BEGIN:" + component)
+		cal.line("UID:" + n.ID.String() + "@notes")
+		cal.line("DTSTAMP:" + n.UpdatedAt.UTC().Format(icsTime))
+		cal.line("LAST-MODIFIED:" + n.UpdatedAt.UTC().Format(icsTime))
+		cal.line("SEQUENCE:" + strconv.FormatInt(n.Version, 10))
+		switch {
+		case component == "VTODO":
+			cal.line("DUE:" + n.DueAt.UTC().Format(icsTime))
+		case n.DueAt != nil:
+			cal.line("DTSTART:" + n.DueAt.UTC().Format(icsTime))
+		default:
+			cal.line("DTSTART:" + n.ReminderAt.UTC().Format(icsTime))
+		}
+		cal.line("SUMMARY:" + icsText(n.Title))
+		if !n.IsEncrypted && strings.TrimSpace(n.Content) != "" {
+			cal.line("DESCRIPTION:" + icsText(n.Content))
+		}
+		if len(n.Tags) > 0 {
+			tags := make([]string, len(n.Tags))
+			for i, tag := range n.Tags {
+				tags[i] = icsText(tag)
+			}
+			cal.line("CATEGORIES:" + strings.Join(tags, ","))
+		}
+		if n.ReminderAt != nil {
+			cal.line("BEGIN:VALARM")
+			cal.line("ACTION:DISPLAY")
+			cal.line("DESCRIPTION:" + icsText(n.Title))
+			cal.line("TRIGGER;VALUE=DATE-TIME:" + n.ReminderAt.UTC().Format(icsTime))
+			cal.line("END:VALARM")
+		}
+		cal.line("END:" + component)
+	}
+	cal.line("END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(cal.String()))
+}
+
+// icsText escapes a TEXT value.
+func icsText(text string) string {
+	return icsEscaper.Replace(text)
+}
+
+// icsWriter builds an iCalendar document, ending lines with CRLF and
+// folding them at 75 octets without splitting a character.
+type icsWriter struct {
+	strings.Builder
+}
+
+func (c *icsWriter) line(text string) {
+	limit := icsLineOctets
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		c.WriteString(text[:cut])
+		c.WriteString("\r\n ")
+		text = text[cut:]
+		// The space starting a continuation line counts.
+		limit = icsLineOctets - 1
+	}
+	c.WriteString(text)
+	c.WriteString("\r\n")
+}
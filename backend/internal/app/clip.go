@@ -0,0 +1,150 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"notes-backend/internal/clip"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// clipTag marks the notes made from web pages.
+const clipTag = "clip"
+
+// clipMaxImages is how many pictures of a page are kept as attachments;
+// the rest stay links to the page's copies.
+const clipMaxImages = 20
+
+type clipRequest struct {
+	URL string `json:"url"`
+}
+
+// handleClip makes a note tagged clip of the article in the web page at
+// url: its title, a link back to the page and the article as Markdown,
+// with the pictures in it downloaded as attachments of the note.
+func (s *Server) handleClip(w http.ResponseWriter, r *http.Request) {
+	var req clipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeFieldError(w, "url", "url must be an http or https URL")
+		return
+	}
+
+	ctx := r.Context()
+	if s.cfg.ClipTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.ClipTimeout)
+		defer cancel()
+	}
+	page, err := s.clipper.Fetch(ctx, req.URL)
+	if err != nil {
+		writeClipError(w, err)
+		return
+	}
+
+	title := page.Title
+	if title == "" {
+		title = page.URL.Hostname()
+	}
+	input := store.NoteInput{
+		Title:    store.NormalizeText(title),
+		Content:  store.NormalizeText(clipContent(page, nil)),
+		Tags:     []string{clipTag},
+		Language: s.cfg.DefaultLanguage,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	n, err := s.store.CreateNote(r.Context(), input, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), n.ID.String())
+	setAuditSummary(r.Context(), "%s", page.URL.Redacted())
+
+	// The note points at the attachments, so it comes first and is then
+	// rewritten to use them, without a revision of its first version.
+	if images := s.clipImages(ctx, r.Context(), n.ID, page); len(images) > 0 {
+		input.Content = store.NormalizeText(clipContent(page, images))
+		updated, err := s.store.UpdateNote(r.Context(), n.ID, input, s.clock.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+		n = updated
+	}
+
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusCreated, n)
+}
+
+func clipContent(page *clip.Page, images map[string]string) string {
+	return "Source: <" + page.URL.String() + ">\n\n" + page.Markdown(images)
+}
+
+// clipImages downloads the pictures of page, as far as fetchCtx allows,
+// and stores them as attachments of the note under ctx. It returns where
+// each one it kept is served; pictures that fail are left out.
+func (s *Server) clipImages(fetchCtx, ctx context.Context, noteID uuid.UUID, page *clip.Page) map[string]string {
+	if s.blobs == nil {
+		return nil
+	}
+	images := map[string]string{}
+	for _, src := range page.Images[:min(len(page.Images), clipMaxImages)] {
+		if fetchCtx.Err() != nil {
+			break
+		}
+		img, err := s.clipper.FetchImage(fetchCtx, src, s.cfg.MaxAttachmentBytes)
+		if err != nil {
+			log.Printf("clip image %s: %v", src, err)
+			continue
+		}
+		a := store.Attachment{
+			ID:          uuid.New(),
+			NoteID:      noteID,
+			Filename:    attachmentFilename(img.Filename),
+			ContentType: attachmentType(img.ContentType),
+			Size:        int64(len(img.Data)),
+			CreatedAt:   s.clock.Now(),
+		}
+		if err := s.saveAttachment(ctx, a, bytes.NewReader(img.Data)); err != nil {
+			log.Printf("clip image %s: %v", src, err)
+			continue
+		}
+		images[src] = "/attachments/" + a.ID.String()
+	}
+	return images
+}
+
+func writeClipError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, clip.ErrHostNotAllowed):
+		writeFieldError(w, "url", "url is on a host that may not be clipped")
+	case errors.Is(err, clip.ErrNotHTML):
+		writeFieldError(w, "url", "url is not an HTML page")
+	case errors.Is(err, clip.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "page too large")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, codeTimeout, "page took too long to fetch")
+	default:
+		log.Printf("clip: %v", err)
+		writeError(w, http.StatusBadGateway, codeFetchFailed, "could not fetch the page")
+	}
+}
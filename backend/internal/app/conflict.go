@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// What became of a write made to a version of a note that is no longer
+// current, by CONFLICT_STRATEGY.
+const (
+	resolutionRejected    = "rejected"
+	resolutionOverwritten = "overwritten"
+	resolutionForked      = "forked"
+)
+
+type resolvedConflict struct {
+	Resolution string
+	// Note is the note as it now stands.
+	Note store.Note
+	// Copy is the note a fork saved the write as.
+	Copy *store.Note
+}
+
+// resolveConflict applies input, written to an earlier version of note id,
+// as CONFLICT_STRATEGY says. Last write wins keeps the version it replaces
+// as a revision, and a fork leaves the note alone and saves the write as a
+// new note titled as a conflicted copy. New content for a locked note
+// cannot be written over it, so that only forks.
+func (s *Server) resolveConflict(ctx context.Context, id uuid.UUID, input store.NoteInput) (resolvedConflict, error) {
+	current, err := s.store.GetNote(ctx, id)
+	if err != nil {
+		return resolvedConflict{}, err
+	}
+	locked := current.IsEncrypted && input.Content != current.Content
+	switch {
+	case s.cfg.ConflictStrategy == "last-write-wins" && !locked:
+		input.IfVersion = 0
+		n, err := s.updateNote(ctx, id, input)
+		if err != nil {
+			return resolvedConflict{}, err
+		}
+		return resolvedConflict{Resolution: resolutionOverwritten, Note: n}, nil
+	case s.cfg.ConflictStrategy == "fork":
+		fork, err := s.forkNote(ctx, current, input)
+		if err != nil {
+			return resolvedConflict{}, err
+		}
+		return resolvedConflict{Resolution: resolutionForked, Note: current, Copy: &fork}, nil
+	}
+	return resolvedConflict{Resolution: resolutionRejected, Note: current}, nil
+}
+
+// forkNote saves input as a new note beside current, in the notebook and
+// at the place input would have left current in.
+func (s *Server) forkNote(ctx context.Context, current store.Note, input store.NoteInput) (store.Note, error) {
+	notebookID := current.NotebookID
+	if input.NotebookID != nil {
+		notebookID = nil
+		if *input.NotebookID != uuid.Nil {
+			notebookID = input.NotebookID
+		}
+	}
+	location := current.Location()
+	if input.SetLocation {
+		location = input.Location
+	}
+	n, err := s.store.CreateNote(ctx, store.NoteInput{
+		Title:      input.Title + " (conflicted copy)",
+		Content:    input.Content,
+		Tags:       input.Tags,
+		IsFavorite: input.IsFavorite,
+		Language:   store.LanguageOr(input.Language, current.Language),
+		NotebookID: notebookID,
+		Location:   location,
+	}, s.clock.Now())
+	if err != nil {
+		return store.Note{}, err
+	}
+	if err := s.store.SetLinks(ctx, n.ID, store.LinkTargets(n.Content)); err != nil {
+		return store.Note{}, err
+	}
+	return n, nil
+}
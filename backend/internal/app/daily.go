@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// handleGetDaily returns the journal note of a day, YYYY-MM-DD, today or
+// yesterday in TIME_ZONE. The first time a day is asked for, or after its
+// note was trashed, a note is made for it in the journal notebook from the
+// journal template, and the response is 201 rather than 200. POST does the
+// same; a GET that would make the note is refused as a write would be.
+func (s *Server) handleGetDaily(w http.ResponseWriter, r *http.Request) {
+	start, _, ok := s.dayRange(strings.TrimSpace(chi.URLParam(r, "date")))
+	if !ok || start.IsZero() {
+		writeFieldError(w, "date", "date must be YYYY-MM-DD, today or yesterday")
+		return
+	}
+	renderHTML, ok := parseRender(r)
+	if !ok {
+		writeFieldError(w, "render", "render must be html")
+		return
+	}
+	day := start.Format(time.DateOnly)
+
+	// One request at a time, so that two first visits do not make two
+	// notes; SetDailyNote settles those made by other servers.
+	s.daily.Lock()
+	defer s.daily.Unlock()
+
+	status := http.StatusOK
+	n, err := s.store.GetDailyNote(r.Context(), day)
+	if errors.Is(err, store.ErrNotFound) {
+		// Making the note is a write, though asked for with GET.
+		if maintenance := s.maintenance.Load(); maintenance != nil {
+			writeError(w, http.StatusServiceUnavailable, codeMaintenance, maintenance.Message)
+			return
+		}
+		if readOnlyToken(r.Context()) {
+			writeError(w, http.StatusForbidden, codeReadOnlyToken, "token is read-only")
+			return
+		}
+		var created bool
+		n, created, err = s.createDailyNote(r.Context(), day, start)
+		if created {
+			status = http.StatusCreated
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	s.recordAccess(r.Context(), n.ID)
+
+	if renderHTML {
+		n.HTML = s.noteHTML(n)
+	}
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, status, n)
+}
+
+// createDailyNote makes the note of day, which starts at start, and links
+// it to the day. Placeholders in the template are filled in for that day at
+// the current time of day. When another server linked a note to the day
+// first, the one made here is deleted and that one returned, not created.
+func (s *Server) createDailyNote(ctx context.Context, day string, start time.Time) (store.Note, bool, error) {
+	notebookID, err := s.journalNotebook(ctx)
+	if err != nil {
+		return store.Note{}, false, err
+	}
+	t, err := s.journalTemplate(ctx)
+	if err != nil {
+		return store.Note{}, false, err
+	}
+
+	now := s.clock.Now().In(start.Location())
+	at := time.Date(start.Year(), start.Month(), start.Day(), now.Hour(), now.Minute(), now.Second(), 0, start.Location())
+	title := strings.TrimSpace(expandPlaceholders(t.Title, at, day))
+	if title == "" {
+		title = day
+	}
+	n, err := s.store.CreateNote(ctx, store.NoteInput{
+		Title:      title,
+		Content:    expandPlaceholders(t.Content, at, title),
+		Tags:       sanitizeTags(t.Tags),
+		Language:   s.cfg.DefaultLanguage,
+		NotebookID: notebookID,
+	}, s.clock.Now())
+	if err != nil {
+		return store.Note{}, false, err
+	}
+	if err := s.store.SetLinks(ctx, n.ID, store.LinkTargets(n.Content)); err != nil {
+		return store.Note{}, false, err
+	}
+	dayNoteID, err := s.store.SetDailyNote(ctx, day, n.ID)
+	if err != nil {
+		return store.Note{}, false, err
+	}
+	if dayNoteID != n.ID {
+		if err := s.store.PurgeNote(ctx, n.ID); err != nil {
+			return store.Note{}, false, err
+		}
+		n, err = s.store.GetNote(ctx, dayNoteID)
+		return n, false, err
+	}
+	return n, true, nil
+}
+
+// journalNotebook finds the top-level notebook named JOURNAL_NOTEBOOK,
+// making it if there is none. No name means no notebook.
+func (s *Server) journalNotebook(ctx context.Context) (*uuid.UUID, error) {
+	name := s.cfg.JournalNotebook
+	if name == "" {
+		return nil, nil
+	}
+	notebooks, err := s.store.ListNotebooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, nb := range notebooks {
+		if nb.ParentID == nil && strings.EqualFold(nb.Name, name) {
+			return &nb.ID, nil
+		}
+	}
+	nb, err := s.store.CreateNotebook(ctx, store.NotebookInput{Name: name}, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &nb.ID, nil
+}
+
+// journalTemplate finds the template named JOURNAL_TEMPLATE. Without one,
+// daily notes start empty, titled with their date.
+func (s *Server) journalTemplate(ctx context.Context) (store.Template, error) {
+	if s.cfg.JournalTemplate == "" {
+		return store.Template{}, nil
+	}
+	templates, err := s.store.ListTemplates(ctx)
+	if err != nil {
+		return store.Template{}, err
+	}
+	for _, t := range templates {
+		if strings.EqualFold(t.Name, s.cfg.JournalTemplate) {
+			return t, nil
+		}
+	}
+	return store.Template{}, nil
+}
+
+type dailyCalendar struct {
+	Month string            `json:"month"`
+	Items []store.DailyNote `json:"items"`
+}
+
+// handleDailyCalendar lists the days of a month, YYYY-MM and the current
+// one in TIME_ZONE by default, that have a journal note.
+func (s *Server) handleDailyCalendar(w http.ResponseWriter, r *http.Request) {
+	loc := s.cfg.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	month := s.clock.Now().In(loc)
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, loc)
+	if raw := strings.TrimSpace(r.URL.Query().Get("month")); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01", raw, loc)
+		if err != nil {
+			writeFieldError(w, "month", "month must be YYYY-MM")
+			return
+		}
+		month = parsed
+	}
+
+	last := month.AddDate(0, 1, -1)
+	items, err := s.store.ListDailyNotes(r.Context(), month.Format(time.DateOnly), last.Format(time.DateOnly))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, dailyCalendar{Month: month.Format("2006-01"), Items: items})
+}
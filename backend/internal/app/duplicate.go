@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type duplicateRequest struct {
+	NotebookID json.RawMessage `json:"notebook_id"`
+}
+
+// handleDuplicateNote copies a note's title, with " (copy)" after it,
+// content, tags and language into a new note, in the source's notebook
+// unless the body names another one. Attachments are copied too, and
+// references to them in the content point at the copies; revisions are
+// not, the copy's history starts with it.
+func (s *Server) handleDuplicateNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req duplicateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+			return
+		}
+	}
+	notebookID, ok := s.noteNotebook(w, r, req.NotebookID)
+	if !ok {
+		return
+	}
+
+	source, err := s.store.GetNote(r.Context(), noteID)
+	if err == nil && source.IsEncrypted {
+		err = errNoteEncrypted
+	}
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	if notebookID == nil {
+		notebookID = source.NotebookID
+	}
+	var attachments []store.Attachment
+	if s.blobs != nil {
+		if attachments, err = s.store.ListAttachments(r.Context(), noteID); err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+	}
+
+	// The copies get their IDs up front so the content can refer to them
+	// from the first version.
+	content := source.Content
+	copies := make([]store.Attachment, len(attachments))
+	for i, a := range attachments {
+		copies[i] = a
+		copies[i].ID = uuid.New()
+		copies[i].CreatedAt = s.clock.Now()
+		content = strings.ReplaceAll(content, a.ID.String(), copies[i].ID.String())
+	}
+
+	n, err := s.store.CreateNote(r.Context(), store.NoteInput{
+		Title:      source.Title + " (copy)",
+		Content:    content,
+		Tags:       source.Tags,
+		Language:   source.Language,
+		NotebookID: notebookID,
+		Location:   source.Location(),
+	}, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	for i, a := range attachments {
+		copies[i].NoteID = n.ID
+		if err := s.copyAttachment(r.Context(), a, copies[i]); err != nil {
+			log.Printf("copy attachment %s: %v", a.ID, err)
+			// Purging detaches the copies made so far, and the cleanup job
+			// deletes their blobs.
+			if err := s.store.PurgeNote(context.WithoutCancel(r.Context()), n.ID); err != nil {
+				log.Printf("purge note %s: %v", n.ID, err)
+			}
+			writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+			return
+		}
+	}
+
+	setAuditEntity(r.Context(), n.ID.String())
+	setAuditSummary(r.Context(), "copy of %s", noteID)
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusCreated, n)
+}
+
+func (s *Server) copyAttachment(ctx context.Context, from, to store.Attachment) error {
+	blob, err := s.blobs.Get(ctx, from.ID.String())
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	if err := s.blobs.Put(ctx, to.ID.String(), blob, to.Size); err != nil {
+		return err
+	}
+	if err := s.store.CreateAttachment(ctx, to); err != nil {
+		return errors.Join(err, s.blobs.Delete(context.WithoutCancel(ctx), to.ID.String()))
+	}
+	return nil
+}
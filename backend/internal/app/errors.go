@@ -0,0 +1,176 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"notes-backend/internal/search"
+	"notes-backend/internal/validate"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// Error codes are what clients branch on; messages are for people and may
+// change.
+const (
+	codeInvalidBody           = "invalid_body"
+	codeValidationFailed      = "validation_failed"
+	codeInvalidImport         = "invalid_import"
+	codeInvalidIdempotencyKey = "invalid_idempotency_key"
+	codeUnsupportedDump       = "unsupported_dump_version"
+	codeWebSocket             = "websocket_required"
+	codeInvalidQuery          = "invalid_query"
+
+	codeUnauthorized      = "unauthorized"
+	codeSessionExpired    = "session_expired"
+	codeInvalidPassword   = "invalid_password"
+	codePasswordRequired  = "password_required"
+	codeInvalidCode       = "invalid_code"
+	codeInvalidToken      = "invalid_token"
+	codeInvalidPassphrase = "invalid_passphrase"
+	codeInvalidSignature  = "invalid_signature"
+	codeOriginNotAllowed  = "origin_not_allowed"
+	codeReadOnlyToken     = "read_only_token"
+	codeSessionRequired   = "session_required"
+
+	codeNoteNotFound        = "note_not_found"
+	codeNotebookNotFound    = "notebook_not_found"
+	codeAttachmentNotFound  = "attachment_not_found"
+	codeRevisionNotFound    = "revision_not_found"
+	codeTaskNotFound        = "task_not_found"
+	codeTagNotFound         = "tag_not_found"
+	codeTemplateNotFound    = "template_not_found"
+	codeShareNotFound       = "share_not_found"
+	codeSavedSearchNotFound = "saved_search_not_found"
+	codeTokenNotFound       = "token_not_found"
+	codeSessionNotFound     = "session_not_found"
+	codeWebhookNotFound     = "webhook_not_found"
+	codeFeedsDisabled       = "feeds_disabled"
+	codeAttachmentsDisabled = "attachments_disabled"
+	codeIngestDisabled      = "ingest_disabled"
+	codeBackupNotFound      = "backup_not_found"
+	codeBackupsDisabled     = "backups_disabled"
+
+	codeNoteEncrypted        = "note_encrypted"
+	codeNoteNotEncrypted     = "note_not_encrypted"
+	codeNoteChanged          = "note_changed"
+	codeBackupRunning        = "backup_running"
+	codeTwoFactorEnabled     = "two_factor_enabled"
+	codeTwoFactorDisabled    = "two_factor_disabled"
+	codeTwoFactorRequired    = "two_factor_required"
+	codePreconditionRequired = "precondition_required"
+	codeTooLarge             = "payload_too_large"
+	codeRateLimited          = "rate_limited"
+	codeMaintenance          = "maintenance"
+	codeInvalidConfig        = "invalid_config"
+	codeRequestInProgress    = "request_in_progress"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+
+	codeDatabaseError   = "database_error"
+	codeStorageError    = "storage_error"
+	codeInternal        = "internal_error"
+	codeTimeout         = "timeout"
+	codeFetchFailed     = "fetch_failed"
+	codeDatabaseTimeout = "database_timeout"
+)
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details name the fields a validation_failed error is about.
+	Details []fieldError `json:"details,omitempty"`
+	// Token points at the part of a search an invalid_query error is about.
+	Token     *queryToken `json:"token,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	// Error repeats Message for clients from before codes.
+	Error string `json:"error"`
+}
+
+// fieldError is short for validate.FieldError, which handlers build too.
+type fieldError = validate.FieldError
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorResponse(w, status, errorResponse{Code: code, Message: message})
+}
+
+// writeFieldError answers 400 validation_failed about a single field.
+func writeFieldError(w http.ResponseWriter, field, message string) {
+	writeValidationError(w, &fieldError{Field: field, Message: message})
+}
+
+// writeValidationError answers 400 validation_failed, detailing the
+// fieldErrors err holds, on its own or joined.
+func writeValidationError(w http.ResponseWriter, err error) {
+	writeValidationStatus(w, http.StatusBadRequest, err)
+}
+
+// writeLimitError answers 422 validation_failed for a well-formed note
+// over the limits, detailing the fields like writeValidationError.
+func writeLimitError(w http.ResponseWriter, err error) {
+	writeValidationStatus(w, http.StatusUnprocessableEntity, err)
+}
+
+func writeValidationStatus(w http.ResponseWriter, status int, err error) {
+	body := errorResponse{Code: codeValidationFailed, Details: fieldErrors(err)}
+	messages := make([]string, len(body.Details))
+	for i, d := range body.Details {
+		messages[i] = d.Message
+	}
+	body.Message = strings.Join(messages, "; ")
+	if body.Message == "" {
+		body.Message = err.Error()
+	}
+	writeErrorResponse(w, status, body)
+}
+
+func fieldErrors(err error) []fieldError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var details []fieldError
+		for _, err := range joined.Unwrap() {
+			details = append(details, fieldErrors(err)...)
+		}
+		return details
+	}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return []fieldError{*fe}
+	}
+	return nil
+}
+
+// writeErrorResponse fills in the request ID, which passRequestID has put
+// in the response headers.
+type queryToken struct {
+	Text string `json:"text"`
+	// Offset counts characters from the start of the query.
+	Offset int `json:"offset"`
+}
+
+// writeQueryError answers 400 invalid_query about the query param, with
+// the token at fault when err is a syntax error.
+func writeQueryError(w http.ResponseWriter, err error) {
+	body := errorResponse{Code: codeInvalidQuery, Message: err.Error(), Details: []fieldError{{Field: "query", Message: err.Error()}}}
+	var syntax *search.SyntaxError
+	if errors.As(err, &syntax) {
+		body.Token = &queryToken{Text: syntax.Token, Offset: syntax.Offset}
+	}
+	writeErrorResponse(w, http.StatusBadRequest, body)
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, body errorResponse) {
+	body.RequestID = w.Header().Get(chimw.RequestIDHeader)
+	body.Error = body.Message
+	writeJSON(w, status, body)
+}
+
+// passRequestID sends back the ID chimw.RequestID gave the request, so that
+// a reported error can be found in the logs.
+func passRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := chimw.GetReqID(r.Context()); id != "" {
+			w.Header().Set(chimw.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"notes-backend/internal/store"
+)
+
+// listETag identifies one page of a listing at one state of the collection.
+// It is weak because the body is re-encoded on every request.
+func listETag(seq int64, filter store.NoteFilter) string {
+	favorite := ""
+	if filter.Favorite != nil {
+		favorite = strconv.FormatBool(*filter.Favorite)
+	}
+	archived := ""
+	if filter.Archived != nil {
+		archived = strconv.FormatBool(*filter.Archived)
+	}
+	notebook := ""
+	if filter.Notebook != nil {
+		notebook = filter.Notebook.String()
+	}
+	color := ""
+	if filter.Color != nil {
+		color = "=" + *filter.Color
+	}
+	near := ""
+	if filter.Near != nil {
+		near = fmt.Sprintf("%g,%g,%g", filter.Near.Center.Latitude, filter.Near.Center.Longitude, filter.Near.RadiusKm)
+	}
+	after := ""
+	if filter.After != nil {
+		after = fmt.Sprintf("%t,%s,%s", filter.After.Pinned, filter.After.UpdatedAt.Format(time.RFC3339Nano), filter.After.ID)
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%q|%q|%q|%q|%q|%q|%s|%s|%s|%s|%s|%d|%d|%s|%d|%d|%s", filter.Query, filter.TitleQuery, filter.Tag, filter.Tags, filter.ExcludeTags, filter.Language,
+		favorite, archived, notebook, color, near, filter.CreatedFrom.Unix(), filter.CreatedTo.Unix(), filter.Sort, filter.Limit, filter.Offset, after)
+	return fmt.Sprintf(`W/"%d-%x"`, seq, h.Sum64())
+}
+
+// notModified sets the validator headers and reports whether the request's
+// If-None-Match already covers etag, in which case a 304 has been written.
+// Without If-None-Match, If-Modified-Since is checked against modified,
+// unless that is zero.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() && !modified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// changeClock dates the values of the change counter for Last-Modified:
+// each is dated when this process first read it, at least a second after
+// the one before, so that HTTP dates, which have whole seconds, still tell
+// them apart. It dates when notes last changed at all, which also bounds
+// when any one of them did.
+type changeClock struct {
+	mu  sync.Mutex
+	seq int64
+	at  time.Time
+}
+
+func (c *changeClock) modifiedAt(seq int64, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.at.IsZero() || seq != c.seq {
+		at := now.Truncate(time.Second)
+		if !c.at.IsZero() && !at.After(c.at) {
+			at = c.at.Add(time.Second)
+		}
+		c.seq, c.at = seq, at
+	}
+	return c.at
+}
+
+// noteETag identifies a version of a single note. Clients send it back in
+// If-Match to update the version they edited.
+func noteETag(n store.Note) string {
+	return `"` + strconv.FormatInt(n.Version, 10) + `"`
+}
+
+// ifMatchVersion returns the version an If-Match header asks for: 0 for
+// "*", which matches any version, and -1 for anything that is not one of
+// our ETags, which matches none. Weak forms are accepted because proxies
+// weaken ETags when they compress responses.
+func ifMatchVersion(header string) int64 {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0
+	}
+	raw, ok := strings.CutPrefix(strings.TrimPrefix(header, "W/"), `"`)
+	if !ok {
+		return -1
+	}
+	raw, ok = strings.CutSuffix(raw, `"`)
+	version, err := strconv.ParseInt(raw, 10, 64)
+	if !ok || err != nil || version <= 0 {
+		return -1
+	}
+	return version
+}
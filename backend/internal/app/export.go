@@ -0,0 +1,21 @@
+package app
+
+import (
+	"log"
+	"net/http"
+
+	"notes-backend/internal/dump"
+)
+
+// handleExport streams every note as a ZIP of Markdown files with the JSON
+// snapshot alongside. The archive is written as the notes are read, so an
+// error halfway can only be logged; the client sees a truncated download.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	now := s.clock.Now()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="notes-`+now.UTC().Format("20060102-150405")+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := dump.WriteZip(r.Context(), s.store, w, now); err != nil {
+		log.Printf("export: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// Feed names are what tokens grant, so that a token leaked with one
+// feed's URL opens no other.
+const (
+	feedCalendar = "calendar"
+	feedAtom     = "atom"
+)
+
+type feedLinks struct {
+	// Calendar is the path of the iCalendar feed, its token included.
+	Calendar string `json:"calendar"`
+	// Atom is the path of the Atom feed of recent notes.
+	Atom string `json:"atom"`
+}
+
+// feedToken signs the feed's name with FEED_SECRET. The token carries no
+// expiry: changing the secret is what revokes it.
+func (s *Server) feedToken(feed string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.FeedSecret))
+	mac.Write([]byte("feed:" + feed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// requireFeedToken stands in for requireSession on feeds, which calendar
+// and feed readers fetch by URL alone.
+func (s *Server) requireFeedToken(feed string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.FeedSecret == "" {
+			writeError(w, http.StatusNotFound, codeFeedsDisabled, "feeds are disabled")
+			return
+		}
+		token := r.URL.Query().Get("token")
+		if token == "" || !hmac.Equal([]byte(token), []byte(s.feedToken(feed))) {
+			writeError(w, http.StatusUnauthorized, codeInvalidToken, "invalid feed token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleFeeds hands out the feed URLs to a signed-in session.
+func (s *Server) handleFeeds(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.FeedSecret == "" {
+		writeError(w, http.StatusNotFound, codeFeedsDisabled, "feeds are disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, feedLinks{
+		Calendar: "/calendar.ics?token=" + url.QueryEscape(s.feedToken(feedCalendar)),
+		Atom:     "/feed.atom?token=" + url.QueryEscape(s.feedToken(feedAtom)),
+	})
+}
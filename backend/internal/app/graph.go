@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxGraphNodes bounds the notes in one graph, most recently updated
+	// first; larger collections are truncated.
+	maxGraphNodes = 2000
+	// maxGraphTagNotes is how many nodes a tag may join before it stops
+	// producing edges: past that it ties everything together and only
+	// makes the response quadratic.
+	maxGraphTagNotes = 100
+)
+
+type graphNode struct {
+	ID         uuid.UUID  `json:"id"`
+	Title      string     `json:"title"`
+	Tags       []string   `json:"tags"`
+	NotebookID *uuid.UUID `json:"notebook_id"`
+}
+
+// graphEdge refers to nodes by their index in the nodes array. Tag edges
+// are undirected and carry every tag the two notes share.
+type graphEdge struct {
+	Source int      `json:"source"`
+	Target int      `json:"target"`
+	Kind   string   `json:"kind"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// graphResponse is truncated when the collection had more than
+// maxGraphNodes notes.
+type graphResponse struct {
+	Nodes     []graphNode `json:"nodes"`
+	Edges     []graphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// handleGraph returns the whole note network in one response: the notes
+// as nodes and their links and shared tags as edges.
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeTag(r.URL.Query().Get("tag"))
+	notebook, ok := parseNotebookFilter(strings.TrimSpace(r.URL.Query().Get("notebook")))
+	if !ok {
+		writeFieldError(w, "notebook", "notebook must be a uuid or none")
+		return
+	}
+	archived := false
+	if raw := strings.TrimSpace(r.URL.Query().Get("archived")); raw != "" {
+		var err error
+		if archived, err = strconv.ParseBool(raw); err != nil {
+			writeFieldError(w, "archived", "archived must be true or false")
+			return
+		}
+	}
+	filter := store.NoteFilter{
+		Tag:       tag,
+		Archived:  &archived,
+		Notebook:  notebook,
+		Limit:     maxGraphNodes + 1,
+		SkipCount: true,
+	}
+
+	seq, err := s.store.ChangeSeq(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if notModified(w, r, listETag(seq, filter), s.changes.modifiedAt(seq, s.clock.Now())) {
+		return
+	}
+
+	nodes, edges, truncated, err := s.graph(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, graphResponse{nodes, edges, truncated})
+}
+
+func (s *Server) graph(ctx context.Context, filter store.NoteFilter) ([]graphNode, []graphEdge, bool, error) {
+	notes, _, err := s.store.ListNotes(ctx, filter)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	truncated := len(notes) > maxGraphNodes
+	if truncated {
+		notes = notes[:maxGraphNodes]
+	}
+	links, err := s.store.ListLinks(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	nodes := make([]graphNode, len(notes))
+	index := make(map[uuid.UUID]int, len(notes))
+	tagged := make(map[string][]int)
+	for i, n := range notes {
+		nodes[i] = graphNode{ID: n.ID, Title: n.Title, Tags: n.Tags, NotebookID: n.NotebookID}
+		index[n.ID] = i
+		for _, t := range n.Tags {
+			// Every node has the tag filtered on.
+			if t != filter.Tag {
+				tagged[t] = append(tagged[t], i)
+			}
+		}
+	}
+
+	edges := []graphEdge{}
+	for _, l := range links {
+		source, ok := index[l.Source]
+		target, found := index[l.Target]
+		if ok && found {
+			edges = append(edges, graphEdge{Source: source, Target: target, Kind: "link"})
+		}
+	}
+	slices.SortFunc(edges, func(a, b graphEdge) int {
+		if a.Source != b.Source {
+			return a.Source - b.Source
+		}
+		return a.Target - b.Target
+	})
+
+	names := make([]string, 0, len(tagged))
+	for t, members := range tagged {
+		if len(members) > 1 && len(members) <= maxGraphTagNotes {
+			names = append(names, t)
+		}
+	}
+	slices.Sort(names)
+	shared := make(map[[2]int]int)
+	for _, t := range names {
+		members := tagged[t]
+		for a := 0; a < len(members); a++ {
+			for b := a + 1; b < len(members); b++ {
+				pair := [2]int{members[a], members[b]}
+				if i, ok := shared[pair]; ok {
+					edges[i].Tags = append(edges[i].Tags, t)
+					continue
+				}
+				shared[pair] = len(edges)
+				edges = append(edges, graphEdge{Source: pair[0], Target: pair[1], Kind: "tag", Tags: []string{t}})
+			}
+		}
+	}
+	return nodes, edges, truncated, nil
+}
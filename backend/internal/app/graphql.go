@@ -0,0 +1,333 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"notes-backend/internal/graphql"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxGraphQLBytes bounds a posted query.
+	maxGraphQLBytes = 64 << 10
+	maxGraphQLDepth = 8
+	// maxGraphQLResolves bounds the store reads one query may cause, since
+	// nesting note → backlinks → notes multiplies them.
+	maxGraphQLResolves = 2000
+)
+
+// graphQLResolver answers one query; it caches the notebooks, which many
+// fields look up.
+type graphQLResolver struct {
+	s *Server
+
+	notebooksOnce sync.Once
+	notebooks     []store.Notebook
+	notebooksErr  error
+}
+
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if raw := query.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "variables must be a JSON object"}}})
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBytes)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "invalid json body"}}})
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "query is required"}}})
+		return
+	}
+
+	resolver := &graphQLResolver{s: s}
+	writeJSON(w, http.StatusOK, resolver.schema().Execute(r.Context(), req))
+}
+
+func (g *graphQLResolver) schema() *graphql.Schema {
+	note := &graphql.Object{Name: "Note"}
+	notebook := &graphql.Object{Name: "Notebook"}
+	tag := &graphql.Object{Name: "Tag"}
+	notePage := &graphql.Object{Name: "NotePage", Fields: map[string]*graphql.Field{
+		"items": {Type: graphql.NonNull(graphql.List(graphql.NonNull(note.Type())))},
+		"total": {Type: graphql.NonNull(graphql.Int)},
+	}}
+	task := &graphql.Object{Name: "Task", Fields: map[string]*graphql.Field{
+		"id":   {Type: graphql.NonNull(graphql.ID)},
+		"text": {Type: graphql.NonNull(graphql.String)},
+		"done": {Type: graphql.NonNull(graphql.Boolean)},
+		"line": {Type: graphql.NonNull(graphql.Int)},
+	}}
+	attachment := &graphql.Object{Name: "Attachment", Fields: map[string]*graphql.Field{
+		"id":          {Type: graphql.NonNull(graphql.ID)},
+		"filename":    {Type: graphql.NonNull(graphql.String)},
+		"contentType": {Type: graphql.NonNull(graphql.String)},
+		"size":        {Type: graphql.NonNull(graphql.Float)},
+		"createdAt":   {Type: graphql.NonNull(graphql.String)},
+	}}
+
+	notes := graphql.NonNull(graphql.List(graphql.NonNull(note.Type())))
+	listArgs := map[string]*graphql.Type{
+		"query":    graphql.String,
+		"tag":      graphql.String,
+		"notebook": graphql.ID,
+		"favorite": graphql.Boolean,
+		"archived": graphql.Boolean,
+		"sort":     graphql.String,
+		"lang":     graphql.String,
+		"limit":    graphql.Int,
+		"offset":   graphql.Int,
+	}
+
+	note.Fields = map[string]*graphql.Field{
+		"id":                 {Type: graphql.NonNull(graphql.ID)},
+		"title":              {Type: graphql.NonNull(graphql.String)},
+		"content":            {Type: graphql.NonNull(graphql.String)},
+		"tags":               {Type: graphql.NonNull(graphql.List(graphql.NonNull(graphql.String)))},
+		"isFavorite":         {Type: graphql.NonNull(graphql.Boolean)},
+		"isPinned":           {Type: graphql.NonNull(graphql.Boolean)},
+		"isArchived":         {Type: graphql.NonNull(graphql.Boolean)},
+		"isEncrypted":        {Type: graphql.NonNull(graphql.Boolean)},
+		"language":           {Type: graphql.NonNull(graphql.String)},
+		"sortPosition":       {Type: graphql.NonNull(graphql.Float)},
+		"notebookId":         {Type: graphql.ID},
+		"color":              {Type: graphql.NonNull(graphql.String)},
+		"icon":               {Type: graphql.NonNull(graphql.String)},
+		"latitude":           {Type: graphql.Float},
+		"longitude":          {Type: graphql.Float},
+		"dueAt":              {Type: graphql.String},
+		"reminderAt":         {Type: graphql.String},
+		"createdAt":          {Type: graphql.NonNull(graphql.String)},
+		"updatedAt":          {Type: graphql.NonNull(graphql.String)},
+		"version":            {Type: graphql.NonNull(graphql.Int)},
+		"wordCount":          {Type: graphql.NonNull(graphql.Int)},
+		"charCount":          {Type: graphql.NonNull(graphql.Int)},
+		"readingTimeSeconds": {Type: graphql.NonNull(graphql.Int)},
+		"score":              {Type: graphql.Float},
+		"snippet":            {Type: graphql.String},
+		"html": {Type: graphql.NonNull(graphql.String), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return g.s.noteHTML(source.(store.Note)), nil
+		}},
+		"notebook": {Type: notebook.Type(), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return g.notebook(ctx, source.(store.Note).NotebookID)
+		}},
+		"links": {Type: notes, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			items, err := g.s.store.Links(ctx, source.(store.Note).ID)
+			return items, storeError(err)
+		}},
+		"backlinks": {Type: notes, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			items, err := g.s.store.Backlinks(ctx, source.(store.Note).ID)
+			return items, storeError(err)
+		}},
+		"tasks": {Type: graphql.NonNull(graphql.List(graphql.NonNull(task.Type()))), Args: map[string]*graphql.Type{"done": graphql.Boolean}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			var done *bool
+			if v, ok := args["done"].(bool); ok {
+				done = &v
+			}
+			return noteTasks(source.(store.Note), done), nil
+		}},
+		"attachments": {Type: graphql.NonNull(graphql.List(graphql.NonNull(attachment.Type()))), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			if g.s.blobs == nil {
+				return []store.Attachment{}, nil
+			}
+			items, err := g.s.store.ListAttachments(ctx, source.(store.Note).ID)
+			return items, storeError(err)
+		}},
+	}
+
+	notebook.Fields = map[string]*graphql.Field{
+		"id":        {Type: graphql.NonNull(graphql.ID)},
+		"name":      {Type: graphql.NonNull(graphql.String)},
+		"parentId":  {Type: graphql.ID},
+		"createdAt": {Type: graphql.NonNull(graphql.String)},
+		"updatedAt": {Type: graphql.NonNull(graphql.String)},
+		"parent": {Type: notebook.Type(), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return g.notebook(ctx, source.(store.Notebook).ParentID)
+		}},
+		"children": {Type: graphql.NonNull(graphql.List(graphql.NonNull(notebook.Type()))), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			all, err := g.allNotebooks(ctx)
+			if err != nil {
+				return nil, err
+			}
+			id := source.(store.Notebook).ID
+			children := []store.Notebook{}
+			for _, nb := range all {
+				if nb.ParentID != nil && *nb.ParentID == id {
+					children = append(children, nb)
+				}
+			}
+			return children, nil
+		}},
+		"notes": {Type: graphql.NonNull(notePage.Type()), Args: withoutArg(listArgs, "notebook"), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			args["notebook"] = source.(store.Notebook).ID.String()
+			return g.listNotes(ctx, args)
+		}},
+	}
+
+	tag.Fields = map[string]*graphql.Field{
+		"name":  {Type: graphql.NonNull(graphql.String)},
+		"count": {Type: graphql.NonNull(graphql.Int)},
+		"notes": {Type: graphql.NonNull(notePage.Type()), Args: withoutArg(listArgs, "tag"), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			args["tag"] = source.(store.TagCount).Name
+			return g.listNotes(ctx, args)
+		}},
+	}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"note": {Type: note.Type(), Args: map[string]*graphql.Type{"id": graphql.NonNull(graphql.ID)}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			id, err := uuid.Parse(args["id"].(string))
+			if err != nil {
+				return nil, errors.New("id must be a uuid")
+			}
+			n, err := g.s.store.GetNote(ctx, id)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, nil
+			}
+			return n, storeError(err)
+		}},
+		"notes": {Type: graphql.NonNull(notePage.Type()), Args: listArgs, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return g.listNotes(ctx, args)
+		}},
+		"search": {Type: notes, Args: map[string]*graphql.Type{"query": graphql.NonNull(graphql.String), "lang": graphql.String, "limit": graphql.Int}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			page, err := g.listNotes(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			return page.Items, nil
+		}},
+		"tags": {Type: graphql.NonNull(graphql.List(graphql.NonNull(tag.Type()))), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			tags, err := g.s.store.ListTags(ctx)
+			return tags, storeError(err)
+		}},
+		"tag": {Type: tag.Type(), Args: map[string]*graphql.Type{"name": graphql.NonNull(graphql.String)}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			tags, err := g.s.store.ListTags(ctx)
+			if err != nil {
+				return nil, storeError(err)
+			}
+			name := normalizeTag(args["name"].(string))
+			if i := slices.IndexFunc(tags, func(t store.TagCount) bool { return t.Name == name }); i >= 0 {
+				return tags[i], nil
+			}
+			return nil, nil
+		}},
+		"notebooks": {Type: graphql.NonNull(graphql.List(graphql.NonNull(notebook.Type()))), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return g.allNotebooks(ctx)
+		}},
+		"notebook": {Type: notebook.Type(), Args: map[string]*graphql.Type{"id": graphql.NonNull(graphql.ID)}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			id, err := uuid.Parse(args["id"].(string))
+			if err != nil {
+				return nil, errors.New("id must be a uuid")
+			}
+			return g.notebook(ctx, &id)
+		}},
+	}}
+
+	return &graphql.Schema{Query: query, MaxDepth: maxGraphQLDepth, MaxResolves: maxGraphQLResolves}
+}
+
+// listNotes applies the filters GET /notes takes, with the same defaults:
+// archived notes left out and at most 100 a page.
+func (g *graphQLResolver) listNotes(ctx context.Context, args map[string]any) (notePage, error) {
+	filter := store.NoteFilter{Limit: 30}
+	if v, ok := args["query"].(string); ok {
+		filter.Query = store.NormalizeText(strings.TrimSpace(v))
+	}
+	if v, ok := args["tag"].(string); ok {
+		filter.Tag = normalizeTag(v)
+	}
+	language, _ := args["lang"].(string)
+	language, ok := parseLanguage(language)
+	if !ok {
+		return notePage{}, errors.New("unsupported language")
+	}
+	filter.Language = store.LanguageOr(language, g.s.cfg.DefaultLanguage)
+	if v, ok := args["favorite"].(bool); ok {
+		filter.Favorite = &v
+	}
+	archived := false
+	if v, ok := args["archived"].(bool); ok {
+		archived = v
+	}
+	filter.Archived = &archived
+	if v, ok := args["notebook"].(string); ok {
+		if filter.Notebook, ok = parseNotebookFilter(strings.TrimSpace(v)); !ok {
+			return notePage{}, errors.New("notebook must be a uuid or none")
+		}
+	}
+	if v, ok := args["sort"].(string); ok {
+		filter.Sort = store.NoteSort(v)
+		if !slices.Contains(store.NoteSorts, filter.Sort) {
+			return notePage{}, errors.New("sort must be manual, updated, created, title or length")
+		}
+	}
+	if v, ok := args["limit"].(int); ok && v > 0 {
+		filter.Limit = min(v, 100)
+	}
+	if v, ok := args["offset"].(int); ok && v > 0 {
+		filter.Offset = v
+	}
+	if err := g.s.applyQuery(&filter, filter.Query); err != nil {
+		return notePage{}, err
+	}
+
+	items, total, err := g.s.store.ListNotes(ctx, filter)
+	if err != nil {
+		return notePage{}, storeError(err)
+	}
+	return notePage{Items: items, Limit: filter.Limit, Total: total}, nil
+}
+
+func (g *graphQLResolver) allNotebooks(ctx context.Context) ([]store.Notebook, error) {
+	g.notebooksOnce.Do(func() {
+		g.notebooks, g.notebooksErr = g.s.store.ListNotebooks(ctx)
+		g.notebooksErr = storeError(g.notebooksErr)
+	})
+	return g.notebooks, g.notebooksErr
+}
+
+func (g *graphQLResolver) notebook(ctx context.Context, id *uuid.UUID) (any, error) {
+	if id == nil {
+		return nil, nil
+	}
+	all, err := g.allNotebooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(all, func(nb store.Notebook) bool { return nb.ID == *id }); i >= 0 {
+		return all[i], nil
+	}
+	return nil, nil
+}
+
+// withoutArg leaves out an argument the parent object already decides.
+func withoutArg(args map[string]*graphql.Type, name string) map[string]*graphql.Type {
+	rest := maps.Clone(args)
+	delete(rest, name)
+	return rest
+}
+
+// storeError logs what went wrong and tells the client no more than the
+// REST endpoints do.
+func storeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	log.Printf("graphql: %v", err)
+	return errors.New("database error")
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"notes-backend/internal/buildinfo"
+	"notes-backend/internal/store"
+)
+
+// readyTimeout bounds the database checks of one readiness probe, so a
+// stuck database fails the probe instead of hanging it.
+const readyTimeout = 2 * time.Second
+
+// poolHealth holds the store of the server made last, a process's only
+// one outside tests, whose pool /debug/vars reports as db_pool.
+var poolHealth atomic.Pointer[store.HealthChecker]
+
+func init() {
+	expvar.Publish("db_pool", expvar.Func(func() any {
+		if health := poolHealth.Load(); health != nil {
+			return (*health).PoolStats()
+		}
+		return nil
+	}))
+}
+
+type migrationStatus struct {
+	Applied int    `json:"applied"`
+	Pending int    `json:"pending"`
+	Drifted int    `json:"drifted"`
+	Latest  string `json:"latest,omitempty"`
+}
+
+// readiness is the readiness probe's body. Migrations is a
+// migrationStatus, or an object with an error when the state cannot be
+// read, and left out when the database is unreachable.
+type readiness struct {
+	Status     string         `json:"status"`
+	Build      buildinfo.Info `json:"build"`
+	Database   databaseStatus `json:"database"`
+	Migrations any            `json:"migrations,omitempty"`
+	// Maintenance is set while writes are refused, which leaves the
+	// instance ready for reads.
+	Maintenance bool `json:"maintenance,omitempty"`
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type databaseStatus struct {
+	Status    string           `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	LatencyMS int64            `json:"latency_ms"`
+	Pool      *store.PoolStats `json:"pool,omitempty"`
+}
+
+// handleLive answers as long as the process serves requests; it checks
+// nothing else, so a database outage does not get the server restarted.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, statusResponse{"ok"})
+}
+
+// handleReady reports whether the server can serve traffic: 200 when the
+// database answers and the schema has every migration this build knows
+// applied, unmodified, and 503 otherwise.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	ready := true
+	db := databaseStatus{Status: "ok"}
+	if s.health != nil {
+		started := time.Now()
+		err := s.health.Ping(ctx)
+		db.LatencyMS = time.Since(started).Milliseconds()
+		if err != nil {
+			log.Printf("readiness: ping database: %v", err)
+			db.Status, db.Error, ready = "unavailable", "database unreachable", false
+		}
+		stats := s.health.PoolStats()
+		db.Pool = &stats
+	}
+	body := readiness{Build: buildinfo.Get(), Database: db, Maintenance: s.maintenance.Load() != nil}
+
+	if s.migrator != nil && ready {
+		migrations, err := s.migrationStatus(ctx)
+		if err != nil {
+			log.Printf("readiness: read migrations: %v", err)
+			body.Migrations = errorResponse{Code: codeDatabaseError, Message: "cannot read migration state", Error: "cannot read migration state"}
+			ready = false
+		} else {
+			body.Migrations = migrations
+			ready = migrations.Pending == 0 && migrations.Drifted == 0
+		}
+	}
+
+	status := http.StatusOK
+	body.Status = "ok"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body.Status = "unavailable"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, body)
+}
+
+// migrationStatus counts versions recorded in the database that this build
+// has no file for as applied: a newer build may have migrated past it.
+func (s *Server) migrationStatus(ctx context.Context) (migrationStatus, error) {
+	statuses, err := s.migrator.Status(ctx)
+	if err != nil {
+		return migrationStatus{}, err
+	}
+	var result migrationStatus
+	for _, st := range statuses {
+		switch {
+		case st.Applied:
+			result.Applied++
+			result.Latest = st.Version
+			if st.Drifted {
+				result.Drifted++
+			}
+		case !st.Missing:
+			result.Pending++
+		}
+	}
+	return result, nil
+}
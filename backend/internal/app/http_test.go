@@ -0,0 +1,534 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/clock"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// httpClient drives a real listener, so cookies, headers and routing go
+// through net/http exactly as they do in production.
+type httpClient struct {
+	t      *testing.T
+	server *httptest.Server
+	client *http.Client
+	// header is added to every request.
+	header http.Header
+}
+
+func newHTTPClient(t *testing.T, s *Server) *httpClient {
+	t.Helper()
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookie jar: %v", err)
+	}
+	return &httpClient{t: t, server: srv, client: &http.Client{Jar: jar}, header: http.Header{}}
+}
+
+func (c *httpClient) send(method, path, body string) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("build request: %v", err)
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (c *httpClient) json(method, path string, body any, wantStatus int, out any) {
+	c.t.Helper()
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			c.t.Fatalf("encode body: %v", err)
+		}
+	}
+	resp := c.send(method, path, string(raw))
+	payload, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantStatus {
+		c.t.Fatalf("%s %s: status = %d, want %d, body = %s", method, path, resp.StatusCode, wantStatus, payload)
+	}
+	if out != nil {
+		if err := json.Unmarshal(payload, out); err != nil {
+			c.t.Fatalf("%s %s: decode %s: %v", method, path, payload, err)
+		}
+	}
+}
+
+func (c *httpClient) login() {
+	c.t.Helper()
+	c.json(http.MethodPost, "/auth/login", map[string]string{"password": testPassword}, http.StatusOK, nil)
+}
+
+type listPage struct {
+	Items []store.Note `json:"items"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+	Total int          `json:"total"`
+}
+
+func TestHTTPAuthFlow(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+
+	c.json(http.MethodPost, "/auth/login", map[string]string{"password": "wrong"}, http.StatusUnauthorized, nil)
+	resp := c.send(http.MethodPost, "/auth/login", `{"password":"`+testPassword+`"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login status = %d", resp.StatusCode)
+	}
+	var session *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "notes_session" {
+			session = cookie
+		}
+	}
+	if session == nil || !session.HttpOnly || session.SameSite != http.SameSiteLaxMode || session.Path != "/" {
+		t.Fatalf("session cookie = %+v", session)
+	}
+	if ttl := time.Until(session.Expires); ttl < 59*time.Minute || ttl > time.Hour+time.Minute {
+		t.Errorf("cookie expires in %s, want about an hour", ttl)
+	}
+
+	var status map[string]bool
+	c.json(http.MethodGet, "/auth/session", nil, http.StatusOK, &status)
+	if !status["authenticated"] {
+		t.Fatal("session not authenticated after login")
+	}
+	c.json(http.MethodGet, "/notes", nil, http.StatusOK, nil)
+
+	c.json(http.MethodPost, "/auth/logout", nil, http.StatusOK, nil)
+	c.json(http.MethodGet, "/auth/session", nil, http.StatusOK, &status)
+	if status["authenticated"] {
+		t.Fatal("session still authenticated after logout")
+	}
+	c.json(http.MethodGet, "/notes", nil, http.StatusUnauthorized, nil)
+}
+
+func TestHTTPForgedSessionRejected(t *testing.T) {
+	s := newTestServer(t)
+	c := newHTTPClient(t, s)
+	req, _ := http.NewRequest(http.MethodGet, c.server.URL+"/notes", nil)
+	req.AddCookie(&http.Cookie{Name: "notes_session", Value: "made-up"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestHTTPNoteCRUD(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+	c.login()
+
+	var created store.Note
+	c.json(http.MethodPost, "/notes", map[string]any{
+		"title":   "  Trip  ",
+		"content": "passport",
+		"tags":    []string{"Travel", " travel ", strings.Repeat("x", 40)},
+	}, http.StatusCreated, &created)
+	if created.Title != "Trip" || len(created.Tags) != 2 || created.Tags[0] != "travel" || len(created.Tags[1]) != 32 {
+		t.Fatalf("created = %+v", created)
+	}
+
+	resp := c.send(http.MethodGet, "/notes/"+created.ID.String(), "")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type = %q", ct)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Errorf("etag = %q", etag)
+	}
+
+	edit := map[string]any{"title": "Trip", "content": "passport, tickets", "tags": []string{}, "is_favorite": true}
+	c.json(http.MethodPut, "/notes/"+created.ID.String(), edit, http.StatusPreconditionRequired, nil)
+
+	var updated store.Note
+	c.header.Set("If-Match", etag)
+	c.json(http.MethodPut, "/notes/"+created.ID.String(), edit, http.StatusOK, &updated)
+	if updated.Content != "passport, tickets" || !updated.IsFavorite || len(updated.Tags) != 0 || updated.Version != 2 {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	// A second writer still holding the first version is turned away with
+	// the note as it is now.
+	var current store.Note
+	c.json(http.MethodPut, "/notes/"+created.ID.String(), map[string]any{"title": "Stale"}, http.StatusPreconditionFailed, &current)
+	if current.Title != "Trip" || current.Version != 2 {
+		t.Fatalf("412 body = %+v", current)
+	}
+	c.header.Del("If-Match")
+	if updated.UpdatedAt.Before(created.UpdatedAt) || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("timestamps after update: %s / %s", updated.CreatedAt, updated.UpdatedAt)
+	}
+
+	var unfavorited store.Note
+	c.json(http.MethodPost, "/notes/"+created.ID.String()+"/favorite", map[string]bool{"value": false}, http.StatusOK, &unfavorited)
+	if unfavorited.IsFavorite {
+		t.Fatal("favorite flag not cleared")
+	}
+
+	c.json(http.MethodDelete, "/notes/"+created.ID.String(), nil, http.StatusNoContent, nil)
+	c.json(http.MethodDelete, "/notes/"+created.ID.String(), nil, http.StatusNotFound, nil)
+}
+
+func TestHTTPPagination(t *testing.T) {
+	s := newTestServer(t)
+	// The cookie jar drops cookies that expired by the wall clock, so the
+	// fake starts from the real time.
+	fake := clock.NewFake(time.Now())
+	s.clock = fake
+	c := newHTTPClient(t, s)
+	c.login()
+
+	for i := range 25 {
+		fake.Advance(time.Minute)
+		c.json(http.MethodPost, "/notes", map[string]string{"title": fmt.Sprintf("note %02d", i)}, http.StatusCreated, nil)
+	}
+
+	seen := map[string]bool{}
+	for page, wantItems := range []int{10, 10, 5, 0} {
+		var got listPage
+		c.json(http.MethodGet, fmt.Sprintf("/notes?limit=10&page=%d", page+1), nil, http.StatusOK, &got)
+		if got.Total != 25 || got.Page != page+1 || got.Limit != 10 || len(got.Items) != wantItems {
+			t.Fatalf("page %d = total %d, page %d, limit %d, %d items", page+1, got.Total, got.Page, got.Limit, len(got.Items))
+		}
+		for i, n := range got.Items {
+			if seen[n.Title] {
+				t.Fatalf("%s appears on two pages", n.Title)
+			}
+			seen[n.Title] = true
+			if i > 0 && n.UpdatedAt.After(got.Items[i-1].UpdatedAt) {
+				t.Fatalf("page %d is not sorted newest first", page+1)
+			}
+		}
+	}
+	if got := len(seen); got != 25 {
+		t.Fatalf("pages covered %d notes, want 25", got)
+	}
+
+	var capped listPage
+	c.json(http.MethodGet, "/notes?limit=1000&page=-3", nil, http.StatusOK, &capped)
+	if capped.Limit != 100 || capped.Page != 1 || len(capped.Items) != 25 {
+		t.Fatalf("capped = limit %d, page %d, %d items", capped.Limit, capped.Page, len(capped.Items))
+	}
+	var first listPage
+	c.json(http.MethodGet, "/notes?limit=1", nil, http.StatusOK, &first)
+	if first.Items[0].Title != "note 24" {
+		t.Fatalf("newest note = %q, want note 24", first.Items[0].Title)
+	}
+}
+
+func TestHTTPErrorPaths(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+	c.login()
+	c.header.Set("If-Match", "*")
+	missing := "/notes/00000000-0000-0000-0000-0000000000ff"
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		code, message      string
+		field              string
+	}{
+		{http.MethodPost, "/auth/login", "not json", http.StatusBadRequest, "invalid_body", "invalid json body", ""},
+		{http.MethodPost, "/notes", "{", http.StatusBadRequest, "invalid_body", "invalid json body", ""},
+		{http.MethodGet, "/notes/123", "", http.StatusBadRequest, "validation_failed", "invalid id", "id"},
+		{http.MethodGet, "/notes?favorite=yes", "", http.StatusBadRequest, "validation_failed", "favorite must be true or false", "favorite"},
+		{http.MethodGet, missing, "", http.StatusNotFound, "note_not_found", "note not found", ""},
+		{http.MethodPut, missing, `{"title":"x"}`, http.StatusNotFound, "note_not_found", "note not found", ""},
+		{http.MethodPost, missing + "/favorite", `{"value":true}`, http.StatusNotFound, "note_not_found", "note not found", ""},
+		{http.MethodPut, "/notes/123", `{}`, http.StatusBadRequest, "validation_failed", "invalid id", "id"},
+		{http.MethodPatch, "/notes", "", http.StatusMethodNotAllowed, "", "", ""},
+		{http.MethodGet, "/nope", "", http.StatusNotFound, "", "", ""},
+	}
+	for _, tc := range cases {
+		resp := c.send(tc.method, tc.path, tc.body)
+		payload, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status = %d, want %d (%s)", tc.method, tc.path, resp.StatusCode, tc.status, payload)
+			continue
+		}
+		if tc.message == "" {
+			continue
+		}
+		var apiErr errorResponse
+		if err := json.Unmarshal(bytes.TrimSpace(payload), &apiErr); err != nil || apiErr.Code != tc.code || apiErr.Message != tc.message || apiErr.Error != tc.message {
+			t.Errorf("%s %s: body = %s, want %s %q", tc.method, tc.path, payload, tc.code, tc.message)
+			continue
+		}
+		if apiErr.RequestID == "" || apiErr.RequestID != resp.Header.Get("X-Request-Id") {
+			t.Errorf("%s %s: request_id %q, header %q", tc.method, tc.path, apiErr.RequestID, resp.Header.Get("X-Request-Id"))
+		}
+		if tc.field != "" && (len(apiErr.Details) != 1 || apiErr.Details[0].Field != tc.field) {
+			t.Errorf("%s %s: details = %+v, want field %s", tc.method, tc.path, apiErr.Details, tc.field)
+		}
+	}
+}
+
+func TestHTTPListETag(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+	c.login()
+	var created store.Note
+	c.json(http.MethodPost, "/notes", map[string]string{"title": "a"}, http.StatusCreated, &created)
+
+	conditional := func(path, etag string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, c.server.URL+path, nil)
+		req.Header.Set("If-None-Match", etag)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	etag := c.send(http.MethodGet, "/notes", "").Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("list response has no ETag")
+	}
+	if resp := conditional("/notes", etag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("unchanged list: status = %d, want 304", resp.StatusCode)
+	}
+	if resp := conditional("/notes?tag=x", etag); resp.StatusCode != http.StatusOK {
+		t.Fatalf("other filter: status = %d, want 200", resp.StatusCode)
+	}
+
+	c.json(http.MethodDelete, "/notes/"+created.ID.String(), nil, http.StatusNoContent, nil)
+	resp := conditional("/notes", etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Fatalf("after delete: status = %d, etag = %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
+
+func TestHTTPLastModified(t *testing.T) {
+	s := newTestServer(t)
+	// Far enough ahead that the cookie jar keeps the session cookie.
+	s.clock = clock.NewFake(time.Date(2040, 1, 1, 12, 0, 0, 0, time.UTC))
+	c := newHTTPClient(t, s)
+	c.login()
+	var created store.Note
+	c.json(http.MethodPost, "/notes", map[string]string{"title": "a"}, http.StatusCreated, &created)
+	notePath := "/notes/" + created.ID.String()
+
+	conditional := func(path string, header map[string]string) int {
+		req, _ := http.NewRequest(http.MethodGet, c.server.URL+path, nil)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	modified := c.send(http.MethodGet, "/notes", "").Header.Get("Last-Modified")
+	if modified != "Sun, 01 Jan 2040 12:00:00 GMT" {
+		t.Fatalf("Last-Modified = %q", modified)
+	}
+	for _, path := range []string{"/notes", notePath} {
+		if status := conditional(path, map[string]string{"If-Modified-Since": modified}); status != http.StatusNotModified {
+			t.Errorf("unchanged %s: status = %d, want 304", path, status)
+		}
+	}
+	if status := conditional(notePath, map[string]string{"If-Modified-Since": modified, "If-None-Match": `"0"`}); status != http.StatusOK {
+		t.Errorf("If-None-Match should win: status = %d", status)
+	}
+
+	// A change within the same second still moves Last-Modified on.
+	c.header.Set("If-Match", noteETag(created))
+	c.json(http.MethodPatch, notePath, map[string]string{"title": "b"}, http.StatusOK, nil)
+	c.header.Del("If-Match")
+	if status := conditional(notePath, map[string]string{"If-Modified-Since": modified}); status != http.StatusOK {
+		t.Errorf("changed note: status = %d, want 200", status)
+	}
+	if got := c.send(http.MethodGet, "/notes", "").Header.Get("Last-Modified"); got != "Sun, 01 Jan 2040 12:00:01 GMT" {
+		t.Errorf("Last-Modified after change = %q", got)
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.CompressionLevel = 5
+	s.mountRoutes()
+	c := newHTTPClient(t, s)
+	c.login()
+	c.json(http.MethodPost, "/notes", map[string]string{"title": "a", "content": strings.Repeat("compressible ", 100)}, http.StatusCreated, nil)
+
+	c.header.Set("Accept-Encoding", "gzip")
+	resp := c.send(http.MethodGet, "/notes", "")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	var page listPage
+	if err := json.NewDecoder(zr).Decode(&page); err != nil || page.Total != 1 {
+		t.Fatalf("decode: %v, %+v", err, page)
+	}
+}
+
+func TestHTTPWebSocket(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+	c.login()
+
+	c.header.Set("Origin", "https://evil.example")
+	c.json(http.MethodGet, "/ws", nil, http.StatusForbidden, nil)
+	c.header.Del("Origin")
+	c.json(http.MethodGet, "/ws", nil, http.StatusBadRequest, nil)
+
+	u, _ := url.Parse(c.server.URL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var cookies []string
+	for _, cookie := range c.client.Jar.Cookies(u) {
+		cookies = append(cookies, cookie.String())
+	}
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nOrigin: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nCookie: %s\r\n\r\n",
+		u.Host, c.server.URL, strings.Join(cookies, "; "))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	var created store.Note
+	c.json(http.MethodPost, "/notes", map[string]any{"title": "Live"}, http.StatusCreated, &created)
+	op, payload := readServerFrame(t, r)
+	var event struct {
+		Type string     `json:"type"`
+		ID   uuid.UUID  `json:"id"`
+		Note store.Note `json:"note"`
+	}
+	if err := json.Unmarshal(payload, &event); op != 0x1 || err != nil {
+		t.Fatalf("frame = %#x %s, %v", op, payload, err)
+	}
+	if event.Type != "note.created" || event.ID != created.ID || event.Note.Title != "Live" {
+		t.Fatalf("event = %+v", event)
+	}
+
+	c.json(http.MethodDelete, "/notes/"+created.ID.String(), nil, http.StatusNoContent, nil)
+	if _, payload = readServerFrame(t, r); !strings.Contains(string(payload), `"type":"note.deleted"`) {
+		t.Fatalf("event = %s", payload)
+	}
+
+	// A masked close frame with code 1000 and mask 0.
+	conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xE8})
+	if op, _ := readServerFrame(t, r); op != 0x8 {
+		t.Fatalf("reply to close = %#x, want a close frame", op)
+	}
+}
+
+// readServerFrame reads one of the short unmasked frames the server sends.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		n = int(ext[0])<<8 | int(ext[1])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestHTTPEventStream(t *testing.T) {
+	c := newHTTPClient(t, newTestServer(t))
+	c.login()
+
+	resp := c.send(http.MethodGet, "/events", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(resp.Body)
+	var created store.Note
+	c.json(http.MethodPost, "/notes", map[string]any{"title": "Streamed"}, http.StatusCreated, &created)
+	id, data := readServerEvent(t, stream)
+	if id == "" || !strings.Contains(data, `"type":"note.created"`) || !strings.Contains(data, created.ID.String()) {
+		t.Fatalf("event %q = %s", id, data)
+	}
+	resp.Body.Close()
+
+	c.json(http.MethodPost, "/notes/"+created.ID.String()+"/pin", map[string]bool{"value": true}, http.StatusOK, nil)
+	c.header.Set("Last-Event-ID", id)
+	resp = c.send(http.MethodGet, "/events", "")
+	if _, data := readServerEvent(t, bufio.NewReader(resp.Body)); !strings.Contains(data, `"type":"note.pinned"`) {
+		t.Fatalf("replayed event = %s", data)
+	}
+	resp.Body.Close()
+
+	c.header.Set("Last-Event-ID", "from-another-process-7")
+	resp = c.send(http.MethodGet, "/events", "")
+	if _, data := readServerEvent(t, bufio.NewReader(resp.Body)); data != `{"type":"notes.changed"}` {
+		t.Fatalf("event for an unknown ID = %s, want a reload", data)
+	}
+	resp.Body.Close()
+}
+
+// readServerEvent reads one Server-Sent Event, skipping comments.
+func readServerEvent(t *testing.T, r *bufio.Reader) (id, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && data != "":
+			return id, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+)
+
+const (
+	maxIdempotencyKey = 255
+	// abandonIdempotentAfter is how long a request may stay in progress
+	// before a retry takes its key over, as after a crash in the middle of
+	// it. Imports are not bound by REQUEST_TIMEOUT_SECONDS, hence the margin.
+	abandonIdempotentAfter = 10 * time.Minute
+)
+
+// replayedHeaders are the response headers retries are given again.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotent gives the retries of a request made with an Idempotency-Key
+// header the response the first one got, instead of doing it again, for
+// IDEMPOTENCY_WINDOW_HOURS. Reusing a key for a different request is
+// refused, and so is a retry while the first is still in progress. Server
+// errors are not kept, so the retry of one runs again.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if key == "" || s.cfg.IdempotencyWindow == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, http.StatusBadRequest, codeInvalidIdempotencyKey, "Idempotency-Key is longer than 255 characters")
+			return
+		}
+		ctx := context.WithoutCancel(r.Context())
+		now := s.clock.Now()
+		held, claimed, err := s.store.ClaimIdempotencyKey(ctx, store.IdempotentRequest{Key: key, CreatedAt: now},
+			now.Add(-s.cfg.IdempotencyWindow), now.Add(-abandonIdempotentAfter))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+		fingerprint := newFingerprint(r)
+		if !claimed {
+			if held.Status == 0 {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusConflict, codeRequestInProgress, "a request with this Idempotency-Key is still in progress")
+				return
+			}
+			if fingerprint.sum(r.Body) != held.Fingerprint {
+				writeError(w, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was used for a different request")
+				return
+			}
+			skipAudit(r.Context())
+			for name, value := range held.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(held.Status)
+			io.WriteString(w, held.Body)
+			return
+		}
+
+		body := r.Body
+		r.Body = io.NopCloser(io.TeeReader(body, fingerprint.hash))
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			if err := s.store.ReleaseIdempotencyKey(ctx, key); err != nil {
+				log.Printf("release idempotency key: %v", err)
+			}
+			return
+		}
+		done := store.IdempotentRequest{
+			Key:         key,
+			Fingerprint: fingerprint.sum(body),
+			Status:      rec.status,
+			Headers:     map[string]string{},
+			Body:        rec.body.String(),
+		}
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				done.Headers[name] = value
+			}
+		}
+		if err := s.store.FinishIdempotentRequest(ctx, done); err != nil {
+			log.Printf("finish idempotent request: %v", err)
+		}
+	})
+}
+
+func (s *Server) purgeIdempotencyKeys(ctx context.Context) {
+	deleted, err := s.store.DeleteIdempotencyKeys(ctx, s.clock.Now().Add(-s.cfg.IdempotencyWindow))
+	if err != nil {
+		log.Printf("purge idempotency keys: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("deleted %d expired idempotency key(s)", deleted)
+	}
+}
+
+// fingerprint hashes a request's method, path and body, which its retries
+// repeat.
+type fingerprint struct {
+	hash hash.Hash
+}
+
+func newFingerprint(r *http.Request) fingerprint {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	return fingerprint{hash: h}
+}
+
+// sum reads what the handler left of body, up to the largest upload any
+// route takes, and returns the hash.
+func (f fingerprint) sum(body io.Reader) string {
+	io.CopyN(f.hash, body, maxImportBytes)
+	return hex.EncodeToString(f.hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response it passes on.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
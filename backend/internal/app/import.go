@@ -0,0 +1,290 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/dump"
+	"notes-backend/internal/encrypt"
+	"notes-backend/internal/store"
+	"notes-backend/internal/validate"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxImportBytes bounds both the upload and what an archive unpacks to.
+	maxImportBytes = 64 << 20
+	maxImportNotes = 10000
+)
+
+type importItem struct {
+	Source string `json:"source"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// ID is the created note's; on a dry run, the one it would have got.
+	ID *uuid.UUID `json:"id,omitempty"`
+	// DuplicateOf is the note an entry repeats: one that exists already or
+	// an earlier entry of the same upload.
+	DuplicateOf *uuid.UUID `json:"duplicate_of,omitempty"`
+}
+
+type importSummary struct {
+	DryRun     bool         `json:"dry_run"`
+	Created    int          `json:"created"`
+	Duplicates int          `json:"duplicates"`
+	Items      []importItem `json:"items"`
+}
+
+// handleImport creates notes from a JSON dump, a ZIP of Markdown files or
+// one Markdown file, all in one transaction. Notes whose title and content
+// match a stored note or an earlier entry are reported as duplicates and
+// left out; dry_run=true reports the same without writing anything.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	entries, ok := s.readImport(w, r)
+	if !ok {
+		return
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidImport, "nothing to import")
+		return
+	}
+	if len(entries) > maxImportNotes {
+		writeError(w, http.StatusBadRequest, codeInvalidImport, fmt.Sprintf("at most %d notes per import", maxImportNotes))
+		return
+	}
+
+	notes, ok := s.importNotes(w, r, entries)
+	if !ok {
+		return
+	}
+	seen, err := s.noteHashes(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	items := make([]importItem, len(notes))
+	var create []store.Note
+	for i, n := range notes {
+		items[i] = importItem{Source: entries[i].Source, Title: n.Title, Status: "created", ID: &n.ID}
+		hash := noteHash(n)
+		if existing, ok := seen[hash]; ok {
+			items[i].Status = "duplicate"
+			items[i].ID = nil
+			items[i].DuplicateOf = &existing
+			continue
+		}
+		seen[hash] = n.ID
+		create = append(create, n)
+	}
+
+	if !dryRun && len(create) > 0 {
+		if err := s.store.InsertNotes(r.Context(), create); err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+		for _, n := range create {
+			if err := s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content)); err != nil {
+				writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+				return
+			}
+		}
+	}
+	if dryRun {
+		skipAudit(r.Context())
+	}
+	setAuditSummary(r.Context(), "%d created, %d duplicate(s)", len(create), len(notes)-len(create))
+	writeJSON(w, http.StatusOK, importSummary{
+		DryRun:     dryRun,
+		Created:    len(create),
+		Duplicates: len(notes) - len(create),
+		Items:      items,
+	})
+}
+
+// parseDryRun reads the dry_run parameter, writing the error response
+// itself.
+func parseDryRun(w http.ResponseWriter, r *http.Request) (dryRun, ok bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("dry_run"))
+	if raw == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(raw)
+	if err != nil {
+		writeFieldError(w, "dry_run", "dry_run must be true or false")
+		return false, false
+	}
+	return dryRun, true
+}
+
+// readImport spools the upload to a temporary file, for the random access
+// ZIP needs, and reads its entries by the Content-Type, or by its first
+// bytes when that says nothing more specific than octet-stream. It writes
+// the error response itself.
+func (s *Server) readImport(w http.ResponseWriter, r *http.Request) ([]dump.Entry, bool) {
+	tmp, err := os.CreateTemp("", "notes-import-*")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "could not store upload")
+		return nil, false
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxImportBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("import is larger than %d MiB", maxImportBytes>>20))
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "could not read upload")
+		return nil, false
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	head = head[:n]
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/zip" || mediaType == "application/x-zip-compressed" ||
+		(!strings.HasPrefix(mediaType, "text/") && mediaType != "application/json" && bytes.HasPrefix(head, []byte("PK\x03\x04"))):
+		entries, err := dump.ReadArchive(tmp, size, maxImportBytes)
+		if errors.Is(err, dump.ErrTooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("archive unpacks to more than %d MiB", maxImportBytes>>20))
+			return nil, false
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidImport, err.Error())
+			return nil, false
+		}
+		return entries, true
+
+	case mediaType == "application/json" || (!strings.HasPrefix(mediaType, "text/") && bytes.HasPrefix(bytes.TrimSpace(head), []byte("{"))):
+		file, err := dump.Read(io.NewSectionReader(tmp, 0, size))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidImport, err.Error())
+			return nil, false
+		}
+		return dump.FileEntries(file), true
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(tmp, 0, size))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "could not read upload")
+		return nil, false
+	}
+	source := strings.TrimSpace(r.URL.Query().Get("filename"))
+	note, err := dump.ParseMarkdown(source, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidImport, err.Error())
+		return nil, false
+	}
+	return []dump.Entry{{Source: source, Note: note}}, true
+}
+
+// importNotes turns entries into new notes with fresh IDs, cleaned up like
+// API writes. Timestamps are kept and missing ones become now; notebooks
+// are kept only when they exist here. It writes the error response itself.
+func (s *Server) importNotes(w http.ResponseWriter, r *http.Request, entries []dump.Entry) ([]store.Note, bool) {
+	notebooks, err := s.store.ListNotebooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return nil, false
+	}
+	known := make(map[uuid.UUID]bool, len(notebooks))
+	for _, nb := range notebooks {
+		known[nb.ID] = true
+	}
+
+	now := s.clock.Now()
+	notes := make([]store.Note, len(entries))
+	var invalid []error
+	for i, e := range entries {
+		language, ok := parseLanguage(e.Note.Language)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidImport, fmt.Sprintf("%s: unsupported language %q", e.Source, e.Note.Language))
+			return nil, false
+		}
+		title := strings.TrimSpace(e.Note.Title)
+		if title == "" {
+			title = "Untitled"
+		}
+		n := store.Note{
+			ID:           uuid.New(),
+			Title:        store.NormalizeText(title),
+			Content:      store.NormalizeText(e.Note.Content),
+			Tags:         sanitizeTags(e.Note.Tags),
+			IsFavorite:   e.Note.IsFavorite,
+			IsPinned:     e.Note.IsPinned,
+			IsArchived:   e.Note.IsArchived,
+			IsEncrypted:  e.Note.IsEncrypted && encrypt.Locked(e.Note.Content),
+			Language:     store.LanguageOr(language, s.cfg.DefaultLanguage),
+			SortPosition: e.Note.SortPosition,
+			CreatedAt:    e.Note.CreatedAt,
+			UpdatedAt:    e.Note.UpdatedAt,
+			Version:      1,
+		}
+		// Locked notes are measured by their ciphertext.
+		if err := s.cfg.NoteLimits.Note(n.Title, n.Content, n.Tags); err != nil {
+			invalid = append(invalid, validate.Prefix(err, e.Source))
+		}
+		if e.Note.NotebookID != nil && known[*e.Note.NotebookID] {
+			n.NotebookID = e.Note.NotebookID
+		}
+		if n.CreatedAt.IsZero() {
+			n.CreatedAt = now
+		}
+		if n.UpdatedAt.IsZero() || n.UpdatedAt.Before(n.CreatedAt) {
+			n.UpdatedAt = n.CreatedAt
+		}
+		// A locked note's content cannot be measured; trust the export.
+		if n.IsEncrypted {
+			n.SetStats(store.TextStats{Words: e.Note.WordCount, Chars: e.Note.CharCount})
+		} else {
+			n.SetStats(store.MeasureText(n.Content))
+		}
+		notes[i] = n
+	}
+	if len(invalid) > 0 {
+		writeLimitError(w, errors.Join(invalid...))
+		return nil, false
+	}
+	return notes, true
+}
+
+// noteHashes maps the title and content hash of every live note to its ID.
+func (s *Server) noteHashes(ctx context.Context) (map[[sha256.Size]byte]uuid.UUID, error) {
+	const pageSize = 500
+	hashes := make(map[[sha256.Size]byte]uuid.UUID)
+	for offset := 0; ; offset += pageSize {
+		items, _, err := s.store.ListNotes(ctx, store.NoteFilter{Limit: pageSize, Offset: offset, SkipCount: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range items {
+			hashes[noteHash(n)] = n.ID
+		}
+		if len(items) < pageSize {
+			return hashes, nil
+		}
+	}
+}
+
+func noteHash(n store.Note) [sha256.Size]byte {
+	return sha256.Sum256([]byte(n.Title + "\x00" + n.Content))
+}
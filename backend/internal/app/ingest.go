@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// emailTag marks the notes made from emails.
+const emailTag = "email"
+
+// emailSignatureMaxAge is how old a Mailgun signature may be, which bounds
+// how long a captured request can be replayed.
+const emailSignatureMaxAge = 15 * time.Minute
+
+// handleIngestEmail turns an email posted by an inbound-parse webhook into
+// a note tagged email: the subject becomes the title, the plain-text body
+// the content, and every file attached to the email an attachment. Both
+// Mailgun's routes (body-plain, attachment-N) and SendGrid's Inbound Parse
+// (text, attachmentN) are understood; see emailAuthorized for how each is
+// authenticated.
+func (s *Server) handleIngestEmail(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.EmailIngestSecret == "" {
+		writeError(w, http.StatusNotFound, codeIngestDisabled, "email ingest is disabled")
+		return
+	}
+	setAuditActor(r.Context(), "ingest:email")
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxAttachmentBytes+multipartMemory)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "email too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid multipart body")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	if !s.emailAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, codeInvalidSignature, "invalid signature")
+		return
+	}
+
+	title := strings.TrimSpace(r.PostFormValue("subject"))
+	if title == "" {
+		title = "Untitled"
+	}
+	body := r.PostFormValue("body-plain")
+	if body == "" {
+		body = r.PostFormValue("text")
+	}
+	input := store.NoteInput{
+		Title:    store.NormalizeText(title),
+		Content:  store.NormalizeText(strings.ReplaceAll(body, "\r\n", "\n")),
+		Tags:     []string{emailTag},
+		Language: s.cfg.DefaultLanguage,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
+	n, err := s.store.CreateNote(r.Context(), input, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), n.ID.String())
+
+	if err := s.saveEmailAttachments(r.Context(), n.ID, r.MultipartForm.File); err != nil {
+		log.Printf("ingest email attachments: %v", err)
+		// Without the note the webhook's retry starts over cleanly.
+		if err := s.store.PurgeNote(context.WithoutCancel(r.Context()), n.ID); err != nil {
+			log.Printf("purge note %s: %v", n.ID, err)
+		}
+		writeError(w, http.StatusInternalServerError, codeStorageError, "storage error")
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusCreated, n)
+}
+
+// emailAuthorized checks a Mailgun signature, the HMAC-SHA256 of timestamp
+// and token under the signing key, made within emailSignatureMaxAge; or,
+// for SendGrid, which signs nothing it parses, the secret query parameter
+// the Inbound Parse URL was set up with.
+func (s *Server) emailAuthorized(r *http.Request) bool {
+	secret := []byte(s.cfg.EmailIngestSecret)
+	if signature := r.PostFormValue("signature"); signature != "" {
+		timestamp, token := r.PostFormValue("timestamp"), r.PostFormValue("token")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || s.clock.Now().Sub(time.Unix(unix, 0)).Abs() > emailSignatureMaxAge {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(timestamp + token))
+		return hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil))))
+	}
+	query := r.URL.Query().Get("secret")
+	return query != "" && hmac.Equal([]byte(query), secret)
+}
+
+// saveEmailAttachments stores the files of an email, in the order of their
+// form fields, as attachments of the note made from it.
+func (s *Server) saveEmailAttachments(ctx context.Context, noteID uuid.UUID, files map[string][]*multipart.FileHeader) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if s.blobs == nil {
+		return errors.New("attachments are not configured")
+	}
+	fields := make([]string, 0, len(files))
+	for field := range files {
+		fields = append(fields, field)
+	}
+	slices.SortFunc(fields, compareFields)
+	for _, field := range fields {
+		for _, header := range files[field] {
+			a := store.Attachment{
+				ID:          uuid.New(),
+				NoteID:      noteID,
+				Filename:    attachmentFilename(header.Filename),
+				ContentType: attachmentType(header.Header.Get("Content-Type")),
+				Size:        header.Size,
+				CreatedAt:   s.clock.Now(),
+			}
+			file, err := header.Open()
+			if err != nil {
+				return err
+			}
+			err = s.saveAttachment(ctx, a, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareFields orders form fields such as attachment-2 and attachment-10
+// by their number, so that attachments keep the order they had in the
+// email.
+func compareFields(a, b string) int {
+	prefixA, numA := splitFieldNumber(a)
+	prefixB, numB := splitFieldNumber(b)
+	if c := strings.Compare(prefixA, prefixB); c != 0 {
+		return c
+	}
+	return numA - numB
+}
+
+func splitFieldNumber(field string) (string, int) {
+	digits := strings.TrimRight(field, "0123456789")
+	n, _ := strconv.Atoi(field[len(digits):])
+	return digits, n
+}
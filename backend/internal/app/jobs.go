@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"notes-backend/internal/cron"
+)
+
+// sessionsPurged counts the expired sessions deleted since start, served
+// with the other expvar counters at /debug/vars.
+var sessionsPurged = expvar.NewInt("sessions_purged")
+
+// startJobs launches the periodic maintenance tasks and the webhook
+// dispatcher. They stop when the server is closed.
+func (s *Server) startJobs() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopJobs = cancel
+	if s.cfg.SessionCleanupInterval > 0 {
+		s.every(ctx, s.cfg.SessionCleanupInterval, s.deleteExpiredSessions)
+	}
+	if s.cfg.TrashRetention > 0 {
+		s.every(ctx, time.Hour, s.purgeTrash)
+	}
+	if s.cfg.AuditRetention > 0 {
+		s.every(ctx, time.Hour, s.purgeAudit)
+	}
+	if s.cfg.AccessRetention > 0 {
+		s.every(ctx, time.Hour, s.purgeNoteAccess)
+	}
+	if s.cfg.IdempotencyWindow > 0 {
+		s.every(ctx, time.Hour, s.purgeIdempotencyKeys)
+	}
+	if s.blobs != nil {
+		s.every(ctx, time.Hour, s.deleteDetachedAttachments)
+	}
+	if s.search != nil {
+		s.every(ctx, 30*time.Second, s.syncSearchIndex)
+	}
+	if s.backups != nil && s.cfg.BackupSchedule != nil {
+		s.onSchedule(ctx, s.cfg.BackupSchedule, s.runBackup)
+	}
+	s.startWebhooks(ctx)
+}
+
+func (s *Server) deleteExpiredSessions(ctx context.Context) {
+	deleted, err := s.store.DeleteExpiredSessions(ctx, s.clock.Now())
+	if err != nil {
+		log.Printf("delete expired sessions: %v", err)
+		return
+	}
+	sessionsPurged.Add(int64(deleted))
+	if deleted > 0 {
+		log.Printf("deleted %d expired session(s)", deleted)
+	}
+}
+
+// every runs job right away and then at each interval until ctx is done.
+func (s *Server) every(ctx context.Context, interval time.Duration, job func(context.Context)) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			job(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// onSchedule runs job each time schedule comes around, in the configured
+// time zone, until ctx is done.
+func (s *Server) onSchedule(ctx context.Context, schedule *cron.Schedule, job func(context.Context)) {
+	loc := s.cfg.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		for {
+			now := s.clock.Now()
+			next := schedule.Next(now.In(loc))
+			if next.IsZero() {
+				log.Printf("schedule %q never comes around", schedule)
+				return
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			job(ctx)
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+func (s *Server) handleListLinks(w http.ResponseWriter, r *http.Request) {
+	s.listLinked(w, r, s.store.Links)
+}
+
+func (s *Server) handleListBacklinks(w http.ResponseWriter, r *http.Request) {
+	s.listLinked(w, r, s.store.Backlinks)
+}
+
+func (s *Server) listLinked(w http.ResponseWriter, r *http.Request, list func(context.Context, uuid.UUID) ([]store.Note, error)) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if _, err := s.store.GetNote(r.Context(), noteID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	items, err := list(r.Context(), noteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"notes-backend/internal/events"
+	"notes-backend/internal/store"
+	"notes-backend/internal/websocket"
+)
+
+// livePingInterval is how often live connections are pinged and their
+// session checked again.
+const livePingInterval = 30 * time.Second
+
+// handleWebSocket pushes every note change made through this server to the
+// client as a JSON text message, until the client leaves, its session ends
+// or the server shuts down. A client that falls too far behind is closed
+// with 1013 and should reconnect and reload.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		writeError(w, http.StatusForbidden, codeOriginNotAllowed, "origin not allowed")
+		return
+	}
+
+	// Subscribing first means nothing written after the handshake is missed.
+	sub := s.bus.Subscribe()
+	defer sub.Close()
+	conn, err := websocket.Accept(w, r)
+	if errors.Is(err, websocket.ErrHandshake) {
+		writeError(w, http.StatusBadRequest, codeWebSocket, "websocket upgrade required")
+		return
+	}
+	if err != nil {
+		log.Printf("websocket: %v", err)
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	readDone := make(chan error, 1)
+	go func() { readDone <- conn.Read() }()
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				conn.Close(websocket.CloseTryAgainLater, "too far behind, reconnect")
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("websocket: encode event: %v", err)
+				continue
+			}
+			if err := conn.WriteText(data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if !s.sessionStillActive(r) {
+				conn.Close(websocket.ClosePolicy, "session ended")
+				return
+			}
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		case <-readDone:
+			return
+		case <-s.closing:
+			conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+// handleEventStream sends the same events as /ws as Server-Sent Events, each
+// with an ID. A client reconnecting with Last-Event-ID first gets what it
+// missed, or a notes.changed event telling it to reload when the server no
+// longer knows what that was.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		writeError(w, http.StatusForbidden, codeOriginNotAllowed, "origin not allowed")
+		return
+	}
+
+	// EventSource cannot set headers on the first connection, and some
+	// polyfills pass the ID as a parameter instead.
+	lastID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if lastID == "" {
+		lastID = strings.TrimSpace(r.URL.Query().Get("last_event_id"))
+	}
+	sub, missed := s.bus.SubscribeSince(lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e events.Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", s.bus.EventID(e), data)
+		return err
+	}
+	for _, e := range missed {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// Too far behind; the client reconnects with its last ID.
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if !s.sessionStillActive(r) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// sessionStillActive checks the session or API token a long-lived request
+// started with, which may have expired, been logged out or been revoked
+// since.
+func (s *Server) sessionStillActive(r *http.Request) bool {
+	if hash, ok := r.Context().Value(apiTokenKey).(string); ok {
+		_, err := s.store.APITokenByHash(r.Context(), hash)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("check api token: %v", err)
+			return true
+		}
+		return err == nil
+	}
+	token, _ := r.Context().Value(sessionTokenKey).(string)
+	active, err := s.store.SessionActive(r.Context(), token, s.clock.Now())
+	if err != nil {
+		log.Printf("check session: %v", err)
+		return true
+	}
+	return active
+}
+
+// originAllowed guards long-lived connections, which CORS does not cover,
+// against other sites riding on the session cookie: browsers send Origin,
+// and it has to be this host or ALLOWED_ORIGIN. Other clients send none.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	allowed := s.settings().AllowedOrigin
+	if origin == "" || (allowed != "" && origin == allowed) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
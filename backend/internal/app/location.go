@@ -0,0 +1,77 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/store"
+)
+
+// defaultRadiusKm is how far from near a listing looks without radius_km.
+const defaultRadiusKm = 5
+
+// parseLocation reads the latitude and longitude of a note write, which
+// come together: both left out keeps the note where it is (set is false),
+// both null takes it off the map.
+func parseLocation(latRaw, lngRaw json.RawMessage) (loc *store.Location, set bool, err error) {
+	if len(latRaw) == 0 && len(lngRaw) == 0 {
+		return nil, false, nil
+	}
+	if len(latRaw) == 0 {
+		return nil, false, &fieldError{Field: "latitude", Message: "latitude and longitude go together"}
+	}
+	if len(lngRaw) == 0 {
+		return nil, false, &fieldError{Field: "longitude", Message: "latitude and longitude go together"}
+	}
+	var lat, lng *float64
+	if json.Unmarshal(latRaw, &lat) != nil {
+		return nil, false, &fieldError{Field: "latitude", Message: "latitude must be a number or null"}
+	}
+	if json.Unmarshal(lngRaw, &lng) != nil {
+		return nil, false, &fieldError{Field: "longitude", Message: "longitude must be a number or null"}
+	}
+	switch {
+	case lat == nil && lng == nil:
+		return nil, true, nil
+	case lat == nil:
+		return nil, false, &fieldError{Field: "latitude", Message: "latitude and longitude are null together"}
+	case lng == nil:
+		return nil, false, &fieldError{Field: "longitude", Message: "latitude and longitude are null together"}
+	}
+	loc = &store.Location{Latitude: *lat, Longitude: *lng}
+	if loc.Latitude < -90 || loc.Latitude > 90 {
+		return nil, false, &fieldError{Field: "latitude", Message: "latitude must be between -90 and 90"}
+	}
+	if loc.Longitude < -180 || loc.Longitude > 180 {
+		return nil, false, &fieldError{Field: "longitude", Message: "longitude must be between -180 and 180"}
+	}
+	return loc, true, nil
+}
+
+// parseNear reads the near=lat,lng and radius_km query parameters of a
+// listing; nil means no place was asked for.
+func parseNear(near, radius string) (*store.Near, error) {
+	if near == "" {
+		if radius != "" {
+			return nil, &fieldError{Field: "radius_km", Message: "radius_km needs near"}
+		}
+		return nil, nil
+	}
+	rawLat, rawLng, ok := strings.Cut(near, ",")
+	lat, latErr := strconv.ParseFloat(strings.TrimSpace(rawLat), 64)
+	lng, lngErr := strconv.ParseFloat(strings.TrimSpace(rawLng), 64)
+	center := store.Location{Latitude: lat, Longitude: lng}
+	if !ok || latErr != nil || lngErr != nil || !center.Valid() {
+		return nil, &fieldError{Field: "near", Message: "near must be latitude,longitude in degrees"}
+	}
+	radiusKm := float64(defaultRadiusKm)
+	if radius != "" {
+		var err error
+		if radiusKm, err = strconv.ParseFloat(radius, 64); err != nil || !(radiusKm > 0) || math.IsInf(radiusKm, 0) {
+			return nil, &fieldError{Field: "radius_km", Message: "radius_km must be a positive number"}
+		}
+	}
+	return &store.Near{Center: center, RadiusKm: radiusKm}, nil
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"notes-backend/internal/encrypt"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// errNoteEncrypted refuses writes that would replace the content of an
+// encrypted note, which only unlocking it for good can change.
+var errNoteEncrypted = errors.New("note is encrypted; unlock it first")
+
+type lockRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type unlockRequest struct {
+	Passphrase string `json:"passphrase"`
+	// Permanent stores the content decrypted again instead of only
+	// returning it.
+	Permanent bool `json:"permanent"`
+}
+
+// handleLockNote encrypts a note's content under a passphrase the server
+// does not keep. The note loses its revisions, links and share, all of
+// which would give the plain text away; its title and tags stay readable.
+func (s *Server) handleLockNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if req.Passphrase == "" {
+		writeFieldError(w, "passphrase", "passphrase is required")
+		return
+	}
+
+	current, ok := s.lockTarget(w, r, noteID)
+	if !ok {
+		return
+	}
+	if current.IsEncrypted {
+		writeError(w, http.StatusConflict, codeNoteEncrypted, "note is already encrypted")
+		return
+	}
+	locked, err := encrypt.Lock(current.Content, req.Passphrase)
+	if err != nil {
+		log.Printf("lock note %s: %v", noteID, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to encrypt note")
+		return
+	}
+
+	n, err := s.store.SetEncrypted(r.Context(), noteID, true, locked, current.Version, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), noteID, nil)
+	}
+	if err == nil {
+		if err = s.store.DeleteShare(r.Context(), noteID); errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+	}
+	s.writeUpdatedNote(w, r, noteID, n, err)
+}
+
+// handleUnlockNote returns an encrypted note with its content decrypted,
+// leaving it encrypted in storage unless the request is permanent. A wrong
+// passphrase is 403 rather than 401, which clients take to mean that the
+// session is gone.
+func (s *Server) handleUnlockNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req unlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+
+	current, ok := s.lockTarget(w, r, noteID)
+	if !ok {
+		return
+	}
+	if !current.IsEncrypted {
+		writeError(w, http.StatusConflict, codeNoteNotEncrypted, "note is not encrypted")
+		return
+	}
+	content, err := encrypt.Unlock(current.Content, req.Passphrase)
+	if errors.Is(err, encrypt.ErrPassphrase) {
+		writeError(w, http.StatusForbidden, codeInvalidPassphrase, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("unlock note %s: %v", noteID, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to decrypt note")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !req.Permanent {
+		current.Content = content
+		w.Header().Set("ETag", noteETag(current))
+		writeJSON(w, http.StatusOK, current)
+		return
+	}
+	n, err := s.store.SetEncrypted(r.Context(), noteID, false, content, current.Version, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), noteID, store.LinkTargets(n.Content))
+	}
+	s.writeUpdatedNote(w, r, noteID, n, err)
+}
+
+// lockTarget loads the note to lock or unlock, answering 412 when If-Match
+// names another version, like toggling a task does.
+func (s *Server) lockTarget(w http.ResponseWriter, r *http.Request, noteID uuid.UUID) (store.Note, bool) {
+	current, err := s.store.GetNote(r.Context(), noteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return store.Note{}, false
+	}
+	if ifMatch := strings.TrimSpace(r.Header.Get("If-Match")); ifMatch != "" {
+		if version := ifMatchVersion(ifMatch); version != 0 && version != current.Version {
+			w.Header().Set("ETag", noteETag(current))
+			writeJSON(w, http.StatusPreconditionFailed, current)
+			return store.Note{}, false
+		}
+	}
+	return current, true
+}
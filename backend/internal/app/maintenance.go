@@ -0,0 +1,102 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultMaintenanceMessage = "the server is in maintenance mode; changes are paused, reads still work"
+
+// maintenanceStatus is what GET and POST /admin/maintenance answer with.
+type maintenanceStatus struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+type maintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+	// Message replaces MAINTENANCE_MESSAGE until maintenance ends.
+	Message string `json:"message"`
+}
+
+// startMaintenance turns maintenance on with message, or the configured
+// one.
+func (s *Server) startMaintenance(message string, now time.Time) {
+	if message == "" {
+		message = s.cfg.MaintenanceMessage
+	}
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	now = now.UTC()
+	s.maintenance.Store(&maintenanceStatus{Enabled: true, Message: message, Since: &now})
+}
+
+func (s *Server) maintenanceStatus() maintenanceStatus {
+	if status := s.maintenance.Load(); status != nil {
+		return *status
+	}
+	return maintenanceStatus{}
+}
+
+// refuseWritesInMaintenance answers 503 to requests that may change
+// something while maintenance is on. Signing in and out stays possible, so
+// that it can be turned off, and so do /admin, for the restores and
+// backups maintenance is for, GraphQL, which only reads, and unlocking
+// shares. GET /daily/{date}, which makes the day's note, checks itself.
+func (s *Server) refuseWritesInMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.maintenance.Load()
+		if status == nil || !mayWrite(r) || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeError(w, http.StatusServiceUnavailable, codeMaintenance, status.Message)
+	})
+}
+
+func mayWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func maintenanceExempt(path string) bool {
+	switch path {
+	case "/auth/login", "/auth/logout", "/auth/2fa/verify", "/graphql":
+		return true
+	}
+	return strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/share/")
+}
+
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.maintenanceStatus())
+}
+
+// handleSetMaintenance turns maintenance on or off for this instance; other
+// replicas keep their own.
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > 500 {
+		writeFieldError(w, "message", "message must be at most 500 bytes")
+		return
+	}
+	if req.Enabled {
+		s.startMaintenance(req.Message, s.clock.Now())
+		setAuditSummary(r.Context(), "on")
+	} else {
+		s.maintenance.Store(nil)
+		setAuditSummary(r.Context(), "off")
+	}
+	writeJSON(w, http.StatusOK, s.maintenanceStatus())
+}
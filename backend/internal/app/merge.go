@@ -0,0 +1,204 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"notes-backend/internal/similarity"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxDuplicateNotes bounds the notes compared for duplicates, most
+	// recently updated first; larger collections are truncated.
+	maxDuplicateNotes = 5000
+	// defaultDuplicateThreshold is how similar two notes must be, by the
+	// trigrams they share, to be reported without a threshold parameter.
+	defaultDuplicateThreshold = 0.8
+)
+
+// duplicateNote is a note in duplicate listings, which carry no content.
+type duplicateNote struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	Tags      []string  `json:"tags"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// duplicatePair suggests a merge: Target is the more recently updated
+// note, which POST /notes/merge would keep.
+type duplicatePair struct {
+	Target     duplicateNote `json:"target"`
+	Source     duplicateNote `json:"source"`
+	Similarity float64       `json:"similarity"`
+}
+
+type duplicatesResponse struct {
+	Items     []duplicatePair `json:"items"`
+	Truncated bool            `json:"truncated"`
+}
+
+// handleListDuplicates finds pairs of live notes whose title and content
+// are nearly the same, most similar first. Locked notes are left out, as
+// their content cannot be compared.
+func (s *Server) handleListDuplicates(w http.ResponseWriter, r *http.Request) {
+	threshold := defaultDuplicateThreshold
+	if raw := strings.TrimSpace(r.URL.Query().Get("threshold")); raw != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(raw, 64)
+		if err != nil || threshold < similarity.MinThreshold || threshold > 1 {
+			writeFieldError(w, "threshold", "threshold must be a number from 0.5 to 1")
+			return
+		}
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 50), 200)
+
+	notes, _, err := s.store.ListNotes(r.Context(), store.NoteFilter{Limit: maxDuplicateNotes + 1, SkipCount: true})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	truncated := len(notes) > maxDuplicateNotes
+	if truncated {
+		notes = notes[:maxDuplicateNotes]
+	}
+
+	docs := make([][]uint64, len(notes))
+	for i, n := range notes {
+		if !n.IsEncrypted {
+			docs[i] = similarity.Shingles(store.FoldText(n.Title + "\n" + n.Content))
+		}
+	}
+	items := []duplicatePair{}
+	for _, p := range similarity.Pairs(docs, threshold) {
+		if len(items) == limit {
+			break
+		}
+		// Notes are listed most recently updated first.
+		items = append(items, duplicatePair{
+			Target:     duplicateSummary(notes[p.A]),
+			Source:     duplicateSummary(notes[p.B]),
+			Similarity: math.Round(p.Similarity*1000) / 1000,
+		})
+	}
+	writeJSON(w, http.StatusOK, duplicatesResponse{items, truncated})
+}
+
+func duplicateSummary(n store.Note) duplicateNote {
+	return duplicateNote{ID: n.ID, Title: n.Title, Tags: n.Tags, UpdatedAt: n.UpdatedAt}
+}
+
+type mergeNotesRequest struct {
+	TargetID uuid.UUID `json:"target_id"`
+	SourceID uuid.UUID `json:"source_id"`
+}
+
+// handleMergeNotes folds the source note into the target in one
+// transaction: the source's content is appended to the target's, under a
+// heading with its title when the titles differ, the tags are joined and
+// the attachments move over. The target's previous version is saved as a
+// revision and the source goes to the trash, keeping its own history, so
+// either can be brought back.
+func (s *Server) handleMergeNotes(w http.ResponseWriter, r *http.Request) {
+	var req mergeNotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if req.TargetID == uuid.Nil || req.SourceID == uuid.Nil {
+		writeFieldError(w, "target_id", "target_id and source_id are required")
+		return
+	}
+	if req.TargetID == req.SourceID {
+		writeFieldError(w, "source_id", "source_id must differ from target_id")
+		return
+	}
+
+	target, err := s.store.GetNote(r.Context(), req.TargetID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	source, err := s.store.GetNote(r.Context(), req.SourceID)
+	if err == nil && (target.IsEncrypted || source.IsEncrypted) {
+		err = errNoteEncrypted
+	}
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	input := store.NoteInput{
+		Title:      target.Title,
+		Content:    store.NormalizeText(mergedContent(target, source)),
+		Tags:       mergedTags(target.Tags, source.Tags),
+		IsFavorite: target.IsFavorite || source.IsFavorite,
+		Language:   target.Language,
+		IfVersion:  target.Version,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+	merge := store.NoteMerge{
+		TargetID:      target.ID,
+		Input:         input,
+		SourceID:      source.ID,
+		SourceVersion: source.Version,
+	}
+	if s.cfg.MaxRevisions > 0 {
+		merge.Revision = &target
+		merge.KeepRevisions = s.cfg.MaxRevisions
+	}
+	n, err := s.store.MergeNotes(r.Context(), merge, s.clock.Now())
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, http.StatusConflict, codeNoteChanged, "a note changed during the merge, try again")
+		return
+	}
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	setAuditEntity(r.Context(), n.ID.String())
+	setAuditSummary(r.Context(), "merged %s", source.ID)
+
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusOK, n)
+}
+
+func mergedContent(target, source store.Note) string {
+	parts := []string{}
+	if content := strings.TrimRight(target.Content, "\n"); content != "" {
+		parts = append(parts, content)
+	}
+	if title := strings.TrimSpace(source.Title); title != "" && !strings.EqualFold(title, strings.TrimSpace(target.Title)) {
+		parts = append(parts, "## "+title)
+	}
+	if content := strings.Trim(source.Content, "\n"); content != "" {
+		parts = append(parts, content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// mergedTags keeps the target's tags in their order, then adds the
+// source's it lacks.
+func mergedTags(target, source []string) []string {
+	tags := append([]string{}, target...)
+	for _, t := range source {
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
@@ -1,84 +0,0 @@
-package app
-
-import (
-	"context"
-	"fmt"
-	"os"
-	"path/filepath"
-	"sort"
-	"strings"
-
-	"github.com/jackc/pgx/v5/pgxpool"
-)
-
-func runMigrations(ctx context.Context, db *pgxpool.Pool, migrationsDir string) error {
-	if err := ensureMigrationsTable(ctx, db); err != nil {
-		return err
-	}
-
-	files, err := os.ReadDir(migrationsDir)
-	if err != nil {
-		return fmt.Errorf("read migrations dir %s: %w", migrationsDir, err)
-	}
-
-	migrationNames := make([]string, 0, len(files))
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		name := file.Name()
-		if strings.HasSuffix(name, ".sql") {
-			migrationNames = append(migrationNames, name)
-		}
-	}
-	sort.Strings(migrationNames)
-
-	for _, name := range migrationNames {
-		var applied bool
-		err := db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE name = $1)`, name).Scan(&applied)
-		if err != nil {
-			return fmt.Errorf("check migration %s: %w", name, err)
-		}
-		if applied {
-			continue
-		}
-
-		content, err := os.ReadFile(filepath.Join(migrationsDir, name))
-		if err != nil {
-			return fmt.Errorf("read migration %s: %w", name, err)
-		}
-
-		tx, err := db.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("start migration tx %s: %w", name, err)
-		}
-
-		if _, err := tx.Exec(ctx, string(content)); err != nil {
-			_ = tx.Rollback(ctx)
-			return fmt.Errorf("run migration %s: %w", name, err)
-		}
-		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (name) VALUES ($1)`, name); err != nil {
-			_ = tx.Rollback(ctx)
-			return fmt.Errorf("persist migration %s: %w", name, err)
-		}
-
-		if err := tx.Commit(ctx); err != nil {
-			return fmt.Errorf("commit migration %s: %w", name, err)
-		}
-	}
-
-	return nil
-}
-
-func ensureMigrationsTable(ctx context.Context, db *pgxpool.Pool) error {
-	_, err := db.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			name text PRIMARY KEY,
-			applied_at timestamptz NOT NULL DEFAULT NOW()
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("ensure schema_migrations table: %w", err)
-	}
-	return nil
-}
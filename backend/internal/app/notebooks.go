@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// maxNotebookName is what the MySQL column holds.
+const maxNotebookName = 255
+
+type notebookRequest struct {
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+func (s *Server) handleListNotebooks(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListNotebooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	nb, err := s.store.GetNotebook(r.Context(), id)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+func (s *Server) handleCreateNotebook(w http.ResponseWriter, r *http.Request) {
+	var req notebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	input, ok := s.notebookInput(w, r, uuid.Nil, req)
+	if !ok {
+		return
+	}
+
+	nb, err := s.store.CreateNotebook(r.Context(), input, s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), nb.ID.String())
+	writeJSON(w, http.StatusCreated, nb)
+}
+
+// handleUpdateNotebook renames and moves a notebook; a null or missing
+// parent_id moves it to the top level.
+func (s *Server) handleUpdateNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req notebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if _, err := s.store.GetNotebook(r.Context(), id); err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	input, ok := s.notebookInput(w, r, id, req)
+	if !ok {
+		return
+	}
+
+	nb, err := s.store.UpdateNotebook(r.Context(), id, input, s.clock.Now())
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+// handleDeleteNotebook deletes a notebook and the notebooks nested in it.
+// With notes=move, the default, their notes go to the default notebook from
+// the settings, or out of any notebook when that is unset or being deleted
+// too; notes=delete moves them to the trash instead.
+func (s *Server) handleDeleteNotebook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var trash bool
+	switch r.URL.Query().Get("notes") {
+	case "", "move":
+	case "delete":
+		trash = true
+	default:
+		writeFieldError(w, "notes", "notes must be move or delete")
+		return
+	}
+
+	var moveTo *uuid.UUID
+	if !trash {
+		moveTo, err = s.defaultNotebook(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+	}
+	if err := s.store.DeleteNotebook(r.Context(), id, moveTo, trash, s.clock.Now()); err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notebookInput validates a create or update of notebook id, uuid.Nil for a
+// new one, writing the error response itself when the request is invalid.
+func (s *Server) notebookInput(w http.ResponseWriter, r *http.Request, id uuid.UUID, req notebookRequest) (store.NotebookInput, bool) {
+	name := store.NormalizeText(strings.TrimSpace(req.Name))
+	if name == "" {
+		writeFieldError(w, "name", "name is required")
+		return store.NotebookInput{}, false
+	}
+	if utf8.RuneCountInString(name) > maxNotebookName {
+		writeFieldError(w, "name", "name is too long")
+		return store.NotebookInput{}, false
+	}
+
+	if req.ParentID != nil {
+		all, err := s.store.ListNotebooks(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return store.NotebookInput{}, false
+		}
+		if !slices.ContainsFunc(all, func(nb store.Notebook) bool { return nb.ID == *req.ParentID }) {
+			writeFieldError(w, "parent_id", "parent notebook not found")
+			return store.NotebookInput{}, false
+		}
+		if id != uuid.Nil && slices.Contains(store.Subtree(all, id), *req.ParentID) {
+			writeFieldError(w, "parent_id", "a notebook cannot be nested inside itself")
+			return store.NotebookInput{}, false
+		}
+	}
+	return store.NotebookInput{Name: name, ParentID: req.ParentID}, true
+}
+
+// defaultNotebook returns the settings' default notebook as the place for
+// the notes of deleting, or nil when there is none outside of it.
+func (s *Server) defaultNotebook(ctx context.Context, deleting uuid.UUID) (*uuid.UUID, error) {
+	data, err := s.store.Settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var prefs settings
+	if err := json.Unmarshal(data, &prefs); err != nil || prefs.DefaultNotebook == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(prefs.DefaultNotebook)
+	if err != nil {
+		return nil, nil
+	}
+
+	all, err := s.store.ListNotebooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := slices.ContainsFunc(all, func(nb store.Notebook) bool { return nb.ID == id })
+	if !exists || slices.Contains(store.Subtree(all, deleting), id) {
+		return nil, nil
+	}
+	return &id, nil
+}
+
+// noteNotebook reads the notebook_id of a note request: missing leaves the
+// note where it is, null takes it out of its notebook, and anything else has
+// to name an existing notebook. It writes the error response itself.
+func (s *Server) noteNotebook(w http.ResponseWriter, r *http.Request, raw json.RawMessage) (*uuid.UUID, bool) {
+	if len(raw) == 0 {
+		return nil, true
+	}
+	var id *uuid.UUID
+	if err := json.Unmarshal(raw, &id); err != nil {
+		writeFieldError(w, "notebook_id", "notebook_id must be a uuid or null")
+		return nil, false
+	}
+	if id == nil {
+		return &uuid.Nil, true
+	}
+	if _, err := s.store.GetNotebook(r.Context(), *id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeFieldError(w, "notebook_id", "notebook not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return nil, false
+	}
+	return id, true
+}
+
+// parseNotebookFilter reads the notebook query parameter of a listing, where
+// "none" selects notes in no notebook.
+func parseNotebookFilter(raw string) (*uuid.UUID, bool) {
+	switch raw {
+	case "":
+		return nil, true
+	case "none":
+		return &uuid.Nil, true
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, false
+	}
+	return &id, true
+}
+
+func writeNotebookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNotebookNotFound, "notebook not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+}
@@ -0,0 +1,325 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"notes-backend/internal/backup"
+	"notes-backend/internal/buildinfo"
+	"notes-backend/internal/graphql"
+	"notes-backend/internal/openapi"
+	"notes-backend/internal/store"
+	"notes-backend/internal/telegram"
+)
+
+// swaggerUI is the swagger-ui-dist release /docs loads, pinned so the CSP
+// names exactly what runs.
+const swaggerUI = "https://unpkg.com/swagger-ui-dist@5.17.14/"
+
+// itemList is the {"items": [...]} envelope of the list endpoints.
+type itemList[T any] struct {
+	Items []T `json:"items"`
+}
+
+// mediaBody is a request or response body that is not JSON, given by its
+// media type.
+type mediaBody string
+
+// apiRoute describes one route for the OpenAPI document. Request and
+// response bodies are the types the handler decodes and encodes, so the
+// schemas follow the code; TestOpenAPICoversRoutes checks the table
+// against the router.
+type apiRoute struct {
+	method, path string
+	id, summary  string
+	tag          string
+	query        []string
+	// request and response are zero values of the body types, or a
+	// mediaBody; a nil response means the status comes without a body.
+	request  any
+	response any
+	status   int
+	// security is "public" for routes that need no credentials and
+	// "cookie" for those that refuse API tokens; empty means either.
+	security string
+}
+
+// queryTypes gives the query parameters that are not strings.
+var queryTypes = map[string]any{
+	"page":      0,
+	"limit":     0,
+	"days":      0,
+	"radius_km": 0.0,
+	"weeks":     0,
+	"favorite":  false,
+	"archived":  false,
+	"dry_run":   false,
+	"done":      false,
+	"todo":      false,
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+var apiRoutes = []apiRoute{
+	{method: "GET", path: "/health", id: "health", summary: "Liveness probe (alias of /health/live)", tag: "health", response: statusResponse{}, security: "public"},
+	{method: "GET", path: "/health/live", id: "healthLive", summary: "Liveness probe", tag: "health", response: statusResponse{}, security: "public"},
+	{method: "GET", path: "/health/ready", id: "healthReady", summary: "Readiness probe; 503 when the database or schema is not ready", tag: "health", response: readiness{}, security: "public"},
+	{method: "GET", path: "/openapi.json", id: "openapi", summary: "This document", tag: "meta", response: mediaBody("application/json"), security: "public"},
+
+	{method: "POST", path: "/auth/login", id: "login", summary: "Log in with the app password and get a session cookie, or a challenge for the second factor", tag: "auth", request: loginRequest{}, response: loginChallenge{}, security: "public"},
+	{method: "POST", path: "/auth/logout", id: "logout", summary: "End the session", tag: "auth", response: okResponse{}, security: "public"},
+	{method: "GET", path: "/auth/session", id: "sessionStatus", summary: "Whether the session cookie is valid", tag: "auth", response: sessionStatus{}, security: "public"},
+	{method: "GET", path: "/auth/sessions", id: "listSessions", summary: "List active sessions", tag: "auth", response: itemList[sessionInfo]{}, security: "cookie"},
+	{method: "DELETE", path: "/auth/sessions/{id}", id: "deleteSession", summary: "Sign a session out", tag: "auth", status: http.StatusNoContent, security: "cookie"},
+	{method: "POST", path: "/auth/sessions/revoke-others", id: "revokeOtherSessions", summary: "Sign out every session but this one", tag: "auth", response: sessionsRevoked{}, security: "cookie"},
+	{method: "POST", path: "/auth/2fa/verify", id: "verifyTwoFactor", summary: "Finish a login with a TOTP or recovery code and get a session cookie", tag: "auth", request: verifyTwoFactorRequest{}, response: okResponse{}, security: "public"},
+	{method: "GET", path: "/auth/2fa", id: "getTwoFactor", summary: "Show whether two-factor authentication is on", tag: "auth", response: twoFactorStatus{}, security: "cookie"},
+	{method: "POST", path: "/auth/2fa/setup", id: "setupTwoFactor", summary: "Create a TOTP secret and its otpauth URI", tag: "auth", request: twoFactorPasswordRequest{}, response: twoFactorSetup{}, security: "cookie"},
+	{method: "POST", path: "/auth/2fa/enable", id: "enableTwoFactor", summary: "Turn on two-factor authentication and get recovery codes", tag: "auth", request: enableTwoFactorRequest{}, response: recoveryCodes{}, security: "cookie"},
+	{method: "POST", path: "/auth/2fa/disable", id: "disableTwoFactor", summary: "Turn off two-factor authentication", tag: "auth", request: twoFactorPasswordRequest{}, status: http.StatusNoContent, security: "cookie"},
+	{method: "GET", path: "/auth/tokens", id: "listTokens", summary: "List API tokens", tag: "auth", response: itemList[store.APIToken]{}, security: "cookie"},
+	{method: "POST", path: "/auth/tokens", id: "createToken", summary: "Create an API token; the secret is only in this response", tag: "auth", request: createTokenRequest{}, response: createdToken{}, status: http.StatusCreated, security: "cookie"},
+	{method: "DELETE", path: "/auth/tokens/{id}", id: "deleteToken", summary: "Revoke an API token", tag: "auth", status: http.StatusNoContent, security: "cookie"},
+
+	{method: "GET", path: "/share/{slug}", id: "getShare", summary: "View a shared note, as JSON or, for browsers and format=html, a page", tag: "shares", query: []string{"format"}, response: sharedNote{}, security: "public"},
+	{method: "POST", path: "/share/{slug}", id: "unlockShare", summary: "View a password-protected shared note", tag: "shares", request: unlockShareRequest{}, response: sharedNote{}, security: "public"},
+
+	{method: "GET", path: "/notes", id: "listNotes", summary: "List and search notes, with tag:, title:, before:, after: and is: operators in query and the matching attachments in matches; with cursor, next_cursor takes the place of page", tag: "notes", query: []string{"query", "tag", "lang", "favorite", "archived", "notebook", "color", "near", "radius_km", "created", "sort", "cursor", "page", "limit", "render"}, response: notePage{}},
+	{method: "POST", path: "/notes", id: "createNote", summary: "Create a note; retries with the same Idempotency-Key get the first response", tag: "notes", request: noteRequest{}, response: store.Note{}, status: http.StatusCreated},
+	{method: "POST", path: "/notes/bulk", id: "bulkNotes", summary: "Apply several operations in one transaction", tag: "notes", request: bulkRequest{}, response: bulkResponse{}},
+	{method: "POST", path: "/notes/reorder", id: "reorderNotes", summary: "Set the manual order", tag: "notes", request: reorderRequest{}, status: http.StatusNoContent},
+	{method: "GET", path: "/notes/duplicates", id: "listDuplicates", summary: "Pairs of nearly identical notes, as merge suggestions", tag: "notes", query: []string{"threshold", "limit"}, response: duplicatesResponse{}},
+	{method: "POST", path: "/notes/merge", id: "mergeNotes", summary: "Fold one note into another, trashing it", tag: "notes", request: mergeNotesRequest{}, response: store.Note{}},
+	{method: "GET", path: "/sync", id: "sync", summary: "Notes changed and deleted after a seq, for offline clients; since=0 lists them all", tag: "notes", query: []string{"since", "limit"}, response: syncResponse{}},
+	{method: "POST", path: "/sync", id: "pushSync", summary: "Apply offline changes, each to the version it was made to; stale ones report a conflict", tag: "notes", request: syncPushRequest{}, response: syncPushResponse{}},
+	{method: "GET", path: "/export", id: "export", summary: "Download every note as a ZIP of Markdown files", tag: "notes", response: mediaBody("application/zip")},
+	{method: "POST", path: "/import", id: "import", summary: "Import a ZIP, a JSON export or one Markdown file; takes an Idempotency-Key like createNote", tag: "notes", query: []string{"dry_run", "filename"}, request: mediaBody("application/octet-stream"), response: importSummary{}},
+	{method: "GET", path: "/notes/{id}", id: "getNote", summary: "Get a note", tag: "notes", query: []string{"render"}, response: store.Note{}},
+	{method: "GET", path: "/notes/{id}/html", id: "getNoteHTML", summary: "A note rendered as an HTML page", tag: "notes", response: mediaBody("text/html")},
+	{method: "PUT", path: "/notes/{id}", id: "updateNote", summary: "Replace a note; requires If-Match", tag: "notes", request: noteRequest{}, response: store.Note{}},
+	{method: "PATCH", path: "/notes/{id}", id: "patchNote", summary: "Change the given fields of a note; requires If-Match", tag: "notes", request: patchNoteRequest{}, response: store.Note{}},
+	{method: "DELETE", path: "/notes/{id}", id: "deleteNote", summary: "Move a note to the trash", tag: "notes", status: http.StatusNoContent},
+	{method: "GET", path: "/notes/trash", id: "listTrash", summary: "List notes in the trash", tag: "notes", query: []string{"page", "limit"}, response: trashPage{}},
+	{method: "GET", path: "/notes/counts", id: "countNotes", summary: "Numbers of notes in all, favorite, archived, trashed, per tag and per notebook", tag: "notes", response: store.NoteCounts{}},
+	{method: "GET", path: "/notes/recent", id: "listRecentNotes", summary: "Notes opened last", tag: "notes", query: []string{"limit"}, response: itemList[store.AccessedNote]{}},
+	{method: "GET", path: "/notes/frequent", id: "listFrequentNotes", summary: "Notes opened most, over the last days or the retention period", tag: "notes", query: []string{"days", "limit"}, response: itemList[store.AccessedNote]{}},
+	{method: "POST", path: "/notes/{id}/restore", id: "restoreNote", summary: "Restore a note from the trash", tag: "notes", response: store.Note{}},
+	{method: "DELETE", path: "/notes/{id}/purge", id: "purgeNote", summary: "Delete a note for good", tag: "notes", status: http.StatusNoContent},
+	{method: "POST", path: "/notes/{id}/favorite", id: "favoriteNote", summary: "Mark or unmark a note as favorite", tag: "notes", request: flagRequest{}, response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/pin", id: "pinNote", summary: "Pin or unpin a note", tag: "notes", request: flagRequest{}, response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/archive", id: "archiveNote", summary: "Archive a note", tag: "notes", response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/unarchive", id: "unarchiveNote", summary: "Unarchive a note", tag: "notes", response: store.Note{}},
+	{method: "PUT", path: "/notes/{id}/schedule", id: "scheduleNote", summary: "Set or clear a note's due date and reminder", tag: "notes", request: scheduleRequest{}, response: store.Note{}},
+	{method: "PUT", path: "/notes/{id}/appearance", id: "setNoteAppearance", summary: "Set or clear a note's color and emoji icon", tag: "notes", request: appearanceRequest{}, response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/lock", id: "lockNote", summary: "Encrypt a note's content under a passphrase", tag: "notes", request: lockRequest{}, response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/unlock", id: "unlockNote", summary: "Decrypt an encrypted note, for good if permanent", tag: "notes", request: unlockRequest{}, response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/duplicate", id: "duplicateNote", summary: "Copy a note with its tags and attachments", tag: "notes", request: duplicateRequest{}, response: store.Note{}, status: http.StatusCreated},
+	{method: "POST", path: "/notes/from-template/{id}", id: "createNoteFromTemplate", summary: "Create a note from a template", tag: "templates", request: fromTemplateRequest{}, response: store.Note{}, status: http.StatusCreated},
+	{method: "POST", path: "/notes/{id}/share", id: "shareNote", summary: "Create a public link, replacing the note's old one", tag: "shares", request: shareRequest{}, response: shareResponse{}, status: http.StatusCreated},
+	{method: "DELETE", path: "/notes/{id}/share", id: "unshareNote", summary: "Revoke a note's public link", tag: "shares", status: http.StatusNoContent},
+	{method: "GET", path: "/notes/{id}/links", id: "listLinks", summary: "Notes this note links to", tag: "links", response: itemList[store.Note]{}},
+	{method: "GET", path: "/notes/{id}/backlinks", id: "listBacklinks", summary: "Notes linking to this note", tag: "links", response: itemList[store.Note]{}},
+	{method: "GET", path: "/notes/{id}/related", id: "listRelated", summary: "Notes ranked by shared tags, links and similar content, for a See also panel", tag: "links", query: []string{"limit"}, response: relatedResponse{}},
+	{method: "GET", path: "/notes/{id}/tasks", id: "listNoteTasks", summary: "Task list items of a note", tag: "tasks", query: []string{"done"}, response: itemList[noteTask]{}},
+	{method: "GET", path: "/notes/{id}/revisions", id: "listRevisions", summary: "Earlier versions of a note", tag: "revisions", response: itemList[revisionSummary]{}},
+	{method: "GET", path: "/notes/{id}/revisions/{rev}", id: "getRevision", summary: "Get an earlier version", tag: "revisions", response: store.Revision{}},
+	{method: "GET", path: "/notes/{id}/revisions/{rev}/diff/{to}", id: "diffRevisions", summary: "What changed from a revision to a later one or the current version", tag: "revisions", query: []string{"format", "context"}, response: revisionDiff{}},
+	{method: "POST", path: "/notes/{id}/revisions/{rev}/revert", id: "revertRevision", summary: "Make an earlier version current", tag: "revisions", response: store.Note{}},
+	{method: "POST", path: "/notes/{id}/attachments", id: "uploadAttachment", summary: "Upload a file as the multipart field file", tag: "attachments", request: mediaBody("multipart/form-data"), response: store.Attachment{}, status: http.StatusCreated},
+	{method: "GET", path: "/notes/{id}/attachments", id: "listAttachments", summary: "List a note's attachments", tag: "attachments", response: itemList[store.Attachment]{}},
+	{method: "GET", path: "/attachments/{id}", id: "getAttachment", summary: "Download an attachment", tag: "attachments", response: mediaBody("application/octet-stream")},
+	{method: "DELETE", path: "/attachments/{id}", id: "deleteAttachment", summary: "Delete an attachment", tag: "attachments", status: http.StatusNoContent},
+
+	{method: "GET", path: "/tags", id: "listTags", summary: "Tags with the number of notes using them", tag: "tags", response: itemList[store.TagCount]{}},
+	{method: "POST", path: "/tags/rename", id: "renameTag", summary: "Rename a tag on every note", tag: "tags", request: renameTagRequest{}, response: tagsUpdated{}},
+	{method: "POST", path: "/tags/merge", id: "mergeTags", summary: "Replace several tags with one", tag: "tags", request: mergeTagsRequest{}, response: tagsUpdated{}},
+	{method: "DELETE", path: "/tags/{name}", id: "deleteTag", summary: "Remove a tag from every note", tag: "tags", response: tagsUpdated{}},
+	{method: "GET", path: "/graph", id: "graph", summary: "Notes as nodes, links and shared tags as edges", tag: "links", query: []string{"tag", "notebook", "archived"}, response: graphResponse{}},
+	{method: "GET", path: "/stats", id: "stats", summary: "Note, word and character totals, per tag, per notebook and notes created per week", tag: "notes", query: []string{"weeks"}, response: noteStats{}},
+	{method: "GET", path: "/daily", id: "dailyCalendar", summary: "Days of a month that have a daily note", tag: "daily", query: []string{"month"}, response: dailyCalendar{}},
+	{method: "GET", path: "/daily/{date}", id: "getDailyNote", summary: "Get a day's journal note, made from the journal template on first access", tag: "daily", query: []string{"render"}, response: store.Note{}},
+	{method: "POST", path: "/daily/{date}", id: "makeDailyNote", summary: "Get a day's journal note, making it if there is none", tag: "daily", query: []string{"render"}, response: store.Note{}},
+	{method: "GET", path: "/feeds", id: "feeds", summary: "Feed URLs, with their tokens; 404 without FEED_SECRET", tag: "feeds", response: feedLinks{}, security: "cookie"},
+	{method: "GET", path: "/calendar.ics", id: "calendarFeed", summary: "Notes with a due date or a reminder as iCalendar events, or to-dos with todo", tag: "feeds", query: []string{"token", "todo"}, response: mediaBody("text/calendar"), security: "public"},
+	{method: "GET", path: "/feed.atom", id: "atomFeed", summary: "Notes updated last as an Atom feed with rendered excerpts", tag: "feeds", query: []string{"token", "limit"}, response: mediaBody("application/atom+xml"), security: "public"},
+	{method: "POST", path: "/ingest/email", id: "ingestEmail", summary: "Make a note from a Mailgun or SendGrid inbound-parse webhook, signed or with secret; 404 without EMAIL_INGEST_SECRET", tag: "ingest", query: []string{"secret"}, request: mediaBody("multipart/form-data"), response: store.Note{}, status: http.StatusCreated, security: "public"},
+	{method: "POST", path: "/ingest/telegram", id: "ingestTelegram", summary: "Telegram bot webhook: save a message as a note, or answer /search and /recent, with the sendMessage reply; 404 without TELEGRAM_BOT_TOKEN", tag: "ingest", request: telegram.Update{}, response: telegram.Reply{}, security: "public"},
+	{method: "POST", path: "/clip", id: "clipPage", summary: "Make a note tagged clip of the article in a web page, its pictures downloaded as attachments", tag: "ingest", request: clipRequest{}, response: store.Note{}, status: http.StatusCreated},
+	{method: "GET", path: "/tasks", id: "listTasks", summary: "Task list items across notes", tag: "tasks", query: []string{"done"}, response: itemList[noteTask]{}},
+	{method: "POST", path: "/tasks/{id}/toggle", id: "toggleTask", summary: "Flip a task, or set it with done", tag: "tasks", request: toggleTaskRequest{}, response: noteTask{}},
+
+	{method: "GET", path: "/notebooks", id: "listNotebooks", summary: "List notebooks", tag: "notebooks", response: itemList[store.Notebook]{}},
+	{method: "POST", path: "/notebooks", id: "createNotebook", summary: "Create a notebook", tag: "notebooks", request: notebookRequest{}, response: store.Notebook{}, status: http.StatusCreated},
+	{method: "GET", path: "/notebooks/{id}", id: "getNotebook", summary: "Get a notebook", tag: "notebooks", response: store.Notebook{}},
+	{method: "PUT", path: "/notebooks/{id}", id: "updateNotebook", summary: "Rename or move a notebook", tag: "notebooks", request: notebookRequest{}, response: store.Notebook{}},
+	{method: "DELETE", path: "/notebooks/{id}", id: "deleteNotebook", summary: "Delete a notebook, moving or trashing its notes", tag: "notebooks", query: []string{"notes"}, status: http.StatusNoContent},
+
+	{method: "GET", path: "/templates", id: "listTemplates", summary: "List templates", tag: "templates", response: itemList[store.Template]{}},
+	{method: "POST", path: "/templates", id: "createTemplate", summary: "Create a template", tag: "templates", request: templateRequest{}, response: store.Template{}, status: http.StatusCreated},
+	{method: "GET", path: "/templates/{id}", id: "getTemplate", summary: "Get a template", tag: "templates", response: store.Template{}},
+	{method: "PUT", path: "/templates/{id}", id: "updateTemplate", summary: "Replace a template", tag: "templates", request: templateRequest{}, response: store.Template{}},
+	{method: "DELETE", path: "/templates/{id}", id: "deleteTemplate", summary: "Delete a template", tag: "templates", status: http.StatusNoContent},
+	{method: "GET", path: "/search/suggest", id: "suggest", summary: "Complete a search as it is typed, with titles and tags", tag: "searches", query: []string{"q", "limit"}, response: suggestions{}},
+	{method: "GET", path: "/searches", id: "listSavedSearches", summary: "List saved searches", tag: "searches", response: itemList[store.SavedSearch]{}},
+	{method: "POST", path: "/searches", id: "createSavedSearch", summary: "Save a search", tag: "searches", request: savedSearchRequest{}, response: store.SavedSearch{}, status: http.StatusCreated},
+	{method: "GET", path: "/searches/{id}", id: "getSavedSearch", summary: "Get a saved search", tag: "searches", response: store.SavedSearch{}},
+	{method: "PUT", path: "/searches/{id}", id: "updateSavedSearch", summary: "Replace a saved search", tag: "searches", request: savedSearchRequest{}, response: store.SavedSearch{}},
+	{method: "DELETE", path: "/searches/{id}", id: "deleteSavedSearch", summary: "Delete a saved search", tag: "searches", status: http.StatusNoContent},
+	{method: "GET", path: "/searches/{id}/results", id: "savedSearchResults", summary: "List the notes a saved search matches, as GET /notes does", tag: "searches", query: []string{"lang", "archived", "created", "sort", "cursor", "page", "limit", "render"}, response: notePage{}},
+
+	{method: "GET", path: "/settings", id: "getSettings", summary: "Client preferences", tag: "settings", response: settings{}},
+	{method: "PUT", path: "/settings", id: "putSettings", summary: "Replace the client preferences", tag: "settings", request: settings{}, response: settings{}},
+	{method: "GET", path: "/webhooks", id: "listWebhooks", summary: "List webhooks", tag: "webhooks", response: itemList[store.Webhook]{}},
+	{method: "POST", path: "/webhooks", id: "createWebhook", summary: "Create a webhook; the secret is only in this response", tag: "webhooks", request: createWebhookRequest{}, response: createdWebhook{}, status: http.StatusCreated},
+	{method: "DELETE", path: "/webhooks/{id}", id: "deleteWebhook", summary: "Delete a webhook", tag: "webhooks", status: http.StatusNoContent},
+	{method: "GET", path: "/audit", id: "listAudit", summary: "List audit log entries, newest first", tag: "audit", query: []string{"from", "to", "entity", "entity_id", "action", "page", "limit"}, response: auditPage{}},
+	{method: "GET", path: "/graphql", id: "graphqlGet", summary: "Run a GraphQL query given as query, variables and operationName", tag: "graphql", query: []string{"query", "variables", "operationName"}, response: graphql.Response{}},
+	{method: "POST", path: "/graphql", id: "graphql", summary: "Run a GraphQL query", tag: "graphql", request: graphql.Request{}, response: graphql.Response{}},
+	{method: "GET", path: "/ws", id: "webSocket", summary: "Note changes over a WebSocket", tag: "live", status: http.StatusSwitchingProtocols},
+	{method: "GET", path: "/events", id: "eventStream", summary: "Note changes as server-sent events", tag: "live", query: []string{"last_event_id"}, response: mediaBody("text/event-stream")},
+	{method: "GET", path: "/debug/vars", id: "debugVars", summary: "Runtime metrics from expvar", tag: "meta", response: map[string]any{}},
+
+	{method: "POST", path: "/admin/backup", id: "createBackup", summary: "Back up the database now and rotate out old backups", tag: "admin", response: backup.Backup{}, status: http.StatusCreated, security: "cookie"},
+	{method: "GET", path: "/admin/backups", id: "listBackups", summary: "List stored backups, newest first", tag: "admin", response: itemList[backup.Backup]{}, security: "cookie"},
+	{method: "GET", path: "/admin/backups/{name}", id: "getBackup", summary: "Download a backup", tag: "admin", response: mediaBody("application/octet-stream"), security: "cookie"},
+	{method: "GET", path: "/admin/maintenance", id: "getMaintenance", summary: "Show whether maintenance mode refuses writes", tag: "admin", response: maintenanceStatus{}, security: "cookie"},
+	{method: "POST", path: "/admin/maintenance", id: "setMaintenance", summary: "Turn maintenance mode on or off for this instance", tag: "admin", request: maintenanceRequest{}, response: maintenanceStatus{}, security: "cookie"},
+	{method: "POST", path: "/admin/reload", id: "reloadConfig", summary: "Read the configuration again and apply the settings that allow it", tag: "admin", response: reloadResult{}, security: "cookie"},
+	{method: "POST", path: "/admin/restore", id: "restore", summary: "Restore the missing notes and notebooks of a JSON dump, an export ZIP or a stored backup, all or none", tag: "admin", query: []string{"backup", "dry_run"}, request: mediaBody("application/octet-stream"), response: restoreSummary{}, security: "cookie"},
+}
+
+// openAPIDocument describes apiRoutes. Routes take a session cookie or a
+// bearer API token unless their entry says otherwise.
+func (s *Server) openAPIDocument() openapi.Document {
+	schemas := openapi.NewSchemas()
+	errorSchema := schemas.Of(errorResponse{})
+	doc := openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Notes API",
+			Description: "Errors answer with a JSON object holding a code to branch on, a message, per-field details for validation_failed, the token at fault for invalid_query and the request_id the X-Request-Id header carries too.",
+			Version:     buildinfo.Get().Version,
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Security: []openapi.SecurityRequirement{
+			{"cookieAuth": {}},
+			{"bearerAuth": {}},
+		},
+	}
+
+	for _, route := range apiRoutes {
+		op := &openapi.Operation{
+			OperationID: route.id,
+			Summary:     route.summary,
+			Tags:        []string{route.tag},
+			Responses: map[string]openapi.Response{
+				"default": {
+					Description: "Error",
+					Content:     map[string]openapi.MediaType{"application/json": {Schema: errorSchema}},
+				},
+			},
+		}
+		switch route.security {
+		case "public":
+			op.Security = &[]openapi.SecurityRequirement{}
+		case "cookie":
+			op.Security = &[]openapi.SecurityRequirement{{"cookieAuth": {}}}
+		}
+
+		for _, m := range pathParamPattern.FindAllStringSubmatch(route.path, -1) {
+			schema := &openapi.Schema{Type: "string"}
+			switch {
+			case m[1] == "rev":
+				schema = &openapi.Schema{Type: "integer"}
+			case m[1] == "id" && !strings.HasPrefix(route.path, "/tasks/"):
+				schema.Format = "uuid"
+			}
+			op.Parameters = append(op.Parameters, openapi.Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+		}
+		for _, name := range route.query {
+			schema := &openapi.Schema{Type: "string"}
+			if v, ok := queryTypes[name]; ok {
+				schema = schemas.Of(v)
+			}
+			op.Parameters = append(op.Parameters, openapi.Parameter{Name: name, In: "query", Schema: schema})
+		}
+
+		if route.request != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: bodyContent(schemas, route.request)}
+		}
+		status := route.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := openapi.Response{Description: http.StatusText(status)}
+		if route.response != nil {
+			response.Content = bodyContent(schemas, route.response)
+		}
+		op.Responses[fmt.Sprint(status)] = response
+
+		item := doc.Paths[route.path]
+		if item == nil {
+			item = make(openapi.PathItem)
+			doc.Paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = op
+	}
+
+	// Built after the routes so it holds every schema they refer to.
+	doc.Components = openapi.Components{
+		Schemas: schemas.Components(),
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"cookieAuth": {Type: "apiKey", In: "cookie", Name: s.cfg.SessionCookieName},
+			"bearerAuth": {Type: "http", Scheme: "bearer"},
+		},
+	}
+	return doc
+}
+
+func bodyContent(schemas *openapi.Schemas, body any) map[string]openapi.MediaType {
+	if media, ok := body.(mediaBody); ok {
+		return map[string]openapi.MediaType{string(media): {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	}
+	return map[string]openapi.MediaType{"application/json": {Schema: schemas.Of(body)}}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.openAPIDocument())
+}
+
+var docsPage = template.Must(template.New("docs").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Notes API</title>
+<link rel="stylesheet" href="{{.Base}}swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Base}}swagger-ui-bundle.js"></script>
+<script nonce="{{.Nonce}}">SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`))
+
+// handleDocs serves Swagger UI for /openapi.json. The UI itself comes from
+// a CDN, so /docs is only mounted when API_DOCS is on.
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(raw)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; script-src %s 'nonce-%s'; style-src %s; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'",
+		swaggerUI, nonce, swaggerUI))
+	_ = docsPage.Execute(w, struct{ Base, Nonce string }{swaggerUI, nonce})
+}
@@ -0,0 +1,91 @@
+package app_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/testutil"
+)
+
+type noteList struct {
+	Items []store.Note `json:"items"`
+	Total int          `json:"total"`
+}
+
+func TestPostgresNoteLifecycle(t *testing.T) {
+	h := testutil.NewPostgres(t)
+	c := h.Login(t)
+
+	created := testutil.Expect[store.Note](c, http.MethodPost, "/notes",
+		map[string]any{"title": "Groceries", "content": "Milk and BREAD", "tags": []string{"home"}}, http.StatusCreated)
+	testutil.Expect[store.Note](c, http.MethodPost, "/notes",
+		map[string]any{"title": "Standup", "content": "yesterday", "tags": []string{"work"}}, http.StatusCreated)
+
+	byQuery := testutil.Expect[noteList](c, http.MethodGet, "/notes?query=bread", nil, http.StatusOK)
+	if byQuery.Total != 1 || byQuery.Items[0].ID != created.ID {
+		t.Fatalf("case-insensitive search = %+v", byQuery)
+	}
+	byTag := testutil.Expect[noteList](c, http.MethodGet, "/notes?tag=work", nil, http.StatusOK)
+	if byTag.Total != 1 || byTag.Items[0].Title != "Standup" {
+		t.Fatalf("tag filter = %+v", byTag)
+	}
+
+	testutil.Expect[store.Note](c, http.MethodPost, "/notes/"+created.ID.String()+"/favorite",
+		map[string]bool{"value": true}, http.StatusOK)
+	favorites := testutil.Expect[noteList](c, http.MethodGet, "/notes?favorite=true", nil, http.StatusOK)
+	if favorites.Total != 1 || !favorites.Items[0].IsFavorite {
+		t.Fatalf("favorite filter = %+v", favorites)
+	}
+
+	resp := c.Do(http.MethodDelete, "/notes/"+created.ID.String(), nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	testutil.Expect[map[string]string](c, http.MethodGet, "/notes/"+created.ID.String(), nil, http.StatusNotFound)
+}
+
+func TestPostgresRequiresSession(t *testing.T) {
+	h := testutil.NewPostgres(t)
+	resp := h.Client(t).Do(http.MethodGet, "/notes", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestPostgresFullTextSearch(t *testing.T) {
+	h := testutil.NewPostgres(t)
+	c := h.Login(t)
+
+	inTitle := testutil.Expect[store.Note](c, http.MethodPost, "/notes",
+		map[string]any{"title": "Running plan", "content": "Five weeks", "language": "english"}, http.StatusCreated)
+	inBody := testutil.Expect[store.Note](c, http.MethodPost, "/notes",
+		map[string]any{"title": "Diary", "content": "I went <b>far</b> and kept running today.", "language": "english"}, http.StatusCreated)
+	testutil.Expect[store.Note](c, http.MethodPost, "/notes",
+		map[string]any{"title": "Groceries", "content": "eggs", "language": "english"}, http.StatusCreated)
+
+	got := testutil.Expect[noteList](c, http.MethodGet, "/notes?lang=english&query=runs", nil, http.StatusOK)
+	if got.Total != 2 || got.Items[0].ID != inTitle.ID || got.Items[1].ID != inBody.ID {
+		t.Fatalf("stemmed search = %+v, want the title match ranked first", got)
+	}
+	if got.Items[0].Score <= 0 {
+		t.Fatalf("score = %v", got.Items[0].Score)
+	}
+	snippet := got.Items[1].Snippet
+	if !strings.Contains(snippet, "<mark>running</mark>") || strings.Contains(snippet, "<b>") {
+		t.Fatalf("snippet = %q, want marked and escaped", snippet)
+	}
+
+	excluded := testutil.Expect[noteList](c, http.MethodGet, `/notes?lang=english&query=`+url.QueryEscape(`run -diary`), nil, http.StatusOK)
+	if excluded.Total != 1 || excluded.Items[0].ID != inTitle.ID {
+		t.Fatalf("websearch negation = %+v", excluded)
+	}
+	byTitle := testutil.Expect[noteList](c, http.MethodGet, `/notes?lang=english&query=`+url.QueryEscape(`title:runs -tag:work`), nil, http.StatusOK)
+	if byTitle.Total != 1 || byTitle.Items[0].ID != inTitle.ID {
+		t.Fatalf("title operator = %+v", byTitle)
+	}
+}
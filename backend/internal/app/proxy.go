@@ -0,0 +1,66 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIP sets RemoteAddr to the client a trusted proxy forwarded the
+// request for. Requests from any other peer keep the address they came
+// from, whatever headers they send, so that clients cannot pick their own
+// rate limit bucket or audit address.
+func (s *Server) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ListenSocket != "" || s.trustedProxy(peerAddr(r.RemoteAddr)) {
+			if client, ok := s.forwardedFor(r.Header); ok {
+				r.RemoteAddr = client.String()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor is the right-most address of X-Forwarded-For that is not
+// one of the trusted proxies, each having appended the peer it got the
+// request from, or X-Real-IP when there is no X-Forwarded-For. What lies
+// left of that address was sent by the client and proves nothing.
+func (s *Server) forwardedFor(header http.Header) (netip.Addr, bool) {
+	hops := strings.Split(strings.Join(header.Values("X-Forwarded-For"), ","), ",")
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if client = addr.Unmap(); !s.trustedProxy(client) {
+			break
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP")))
+	return addr.Unmap(), err == nil
+}
+
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr parses the IP of a host:port RemoteAddr, returning the zero
+// Addr, which no proxy is, when there is none.
+func peerAddr(remoteAddr string) netip.Addr {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"notes-backend/internal/config"
+	"notes-backend/internal/ratelimit"
+	"notes-backend/internal/redis"
+)
+
+// limiters builds the login and API limiters the configuration asks for,
+// in Redis when given a client and in memory otherwise. A nil limiter is
+// no limit.
+func limiters(cfg config.Config, client *redis.Client) (login, api ratelimit.Limiter) {
+	build := func(name string, perMinute, burst int) ratelimit.Limiter {
+		if perMinute == 0 {
+			return nil
+		}
+		limit := ratelimit.PerMinute(perMinute, burst)
+		if client != nil {
+			return ratelimit.NewRedis(client, name, limit)
+		}
+		return ratelimit.NewMemory(limit)
+	}
+	return build("login", cfg.LoginRateLimit, cfg.LoginRateBurst), build("api", cfg.APIRateLimit, cfg.APIRateBurst)
+}
+
+func loginLimit(l *liveSettings) ratelimit.Limiter { return l.loginLimit }
+func apiLimit(l *liveSettings) ratelimit.Limiter   { return l.apiLimit }
+
+// rateLimit answers 429 with Retry-After to clients that have used up their
+// bucket. The limiter is picked from the live settings per request, so New
+// can swap in Redis ones after mounting the routes and reloads can change
+// the limits. When the limiter itself fails the request goes through: an
+// outage of Redis should not lock everyone out.
+func (s *Server) rateLimit(pick func(*liveSettings) ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := pick(s.settings())
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, retryAfter, err := limiter.Allow(r.Context(), clientKey(r), s.clock.Now())
+			if err != nil {
+				log.Printf("rate limit: %v", err)
+			}
+			if err == nil && !ok {
+				seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				writeError(w, http.StatusTooManyRequests, codeRateLimited, fmt.Sprintf("too many requests, retry in %d s", seconds))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey is the bucket a request counts against: its IP as realIP left
+// it, with IPv6 narrowed to the /64 that one host usually has to itself.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
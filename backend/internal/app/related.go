@@ -0,0 +1,143 @@
+package app
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"notes-backend/internal/similarity"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxRelatedNotes bounds the notes weighed against the one asked about,
+	// most recently updated first; larger collections are truncated.
+	maxRelatedNotes = 5000
+	// minRelatedSimilarity is the least share of trigrams that counts as
+	// related content; below it, notes share little more than common words.
+	minRelatedSimilarity = 0.1
+	// contentWeight scales the similarity of content, which related notes
+	// rarely have above 0.5, to count as much as tags and links.
+	contentWeight = 2
+)
+
+// relatedNote is a note in related listings, with what it has in common
+// with the note asked about. Score adds up the shared share of their tags,
+// 1 for a link either way or 0.5 for two hops through another note, and
+// twice the similarity of their content.
+type relatedNote struct {
+	ID         uuid.UUID `json:"id"`
+	Title      string    `json:"title"`
+	Tags       []string  `json:"tags"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Score      float64   `json:"score"`
+	SharedTags []string  `json:"shared_tags"`
+	// LinkDistance is 1 for notes linked with it, 2 for notes linked with
+	// those, and 0 otherwise.
+	LinkDistance int     `json:"link_distance"`
+	Similarity   float64 `json:"similarity"`
+}
+
+type relatedResponse struct {
+	Items     []relatedNote `json:"items"`
+	Truncated bool          `json:"truncated"`
+}
+
+// handleRelatedNotes ranks the live, unarchived notes by what they share
+// with the note: tags, links and content. Locked notes are compared by
+// tags and links alone.
+func (s *Server) handleRelatedNotes(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 10), 50)
+	source, err := s.store.GetNote(r.Context(), noteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	archived := false
+	notes, _, err := s.store.ListNotes(r.Context(), store.NoteFilter{Archived: &archived, Limit: maxRelatedNotes + 1, SkipCount: true})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	truncated := len(notes) > maxRelatedNotes
+	if truncated {
+		notes = notes[:maxRelatedNotes]
+	}
+	links, err := s.store.ListLinks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	distance := linkDistances(source.ID, links)
+	var shingles []uint64
+	if !source.IsEncrypted {
+		shingles = similarity.Shingles(store.FoldText(source.Title + "\n" + source.Content))
+	}
+	items := []relatedNote{}
+	for _, n := range notes {
+		if n.ID == source.ID {
+			continue
+		}
+		item := relatedNote{ID: n.ID, Title: n.Title, Tags: n.Tags, UpdatedAt: n.UpdatedAt, SharedTags: []string{}, LinkDistance: distance[n.ID]}
+		for _, t := range n.Tags {
+			if slices.Contains(source.Tags, t) {
+				item.SharedTags = append(item.SharedTags, t)
+			}
+		}
+		if shared := len(item.SharedTags); shared > 0 {
+			item.Score += float64(shared) / float64(len(source.Tags)+len(n.Tags)-shared)
+		}
+		if item.LinkDistance > 0 {
+			item.Score += 1 / float64(item.LinkDistance)
+		}
+		if shingles != nil && !n.IsEncrypted {
+			if sim := similarity.Jaccard(shingles, similarity.Shingles(store.FoldText(n.Title+"\n"+n.Content))); sim >= minRelatedSimilarity {
+				item.Similarity = math.Round(sim*1000) / 1000
+				item.Score += contentWeight * sim
+			}
+		}
+		if item.Score > 0 {
+			item.Score = math.Round(item.Score*1000) / 1000
+			items = append(items, item)
+		}
+	}
+	// Notes are listed most recently updated first, which breaks ties.
+	slices.SortStableFunc(items, func(a, b relatedNote) int { return cmp.Compare(b.Score, a.Score) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, relatedResponse{items, truncated})
+}
+
+// linkDistances maps the notes within two links of id, whichever way the
+// links go, to how many links away they are.
+func linkDistances(id uuid.UUID, links []store.Link) map[uuid.UUID]int {
+	neighbours := map[uuid.UUID][]uuid.UUID{}
+	for _, l := range links {
+		neighbours[l.Source] = append(neighbours[l.Source], l.Target)
+		neighbours[l.Target] = append(neighbours[l.Target], l.Source)
+	}
+	distance := map[uuid.UUID]int{}
+	for _, near := range neighbours[id] {
+		distance[near] = 1
+	}
+	for _, near := range neighbours[id] {
+		for _, far := range neighbours[near] {
+			if far != id && distance[far] == 0 {
+				distance[far] = 2
+			}
+		}
+	}
+	return distance
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"log"
+	"net/http"
+	"slices"
+
+	"notes-backend/internal/config"
+	"notes-backend/internal/ratelimit"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// reloadable are the settings Reload applies while serving, named as
+// config print shows them. The rest need a restart.
+var reloadable = []string{
+	"log_level",
+	"allowed_origin",
+	"session_ttl",
+	"session_sliding",
+	"session_refresh",
+	"session_max_age",
+	"login_rate_limit",
+	"login_rate_burst",
+	"api_rate_limit",
+	"api_rate_burst",
+}
+
+// liveSettings is the configuration requests read the reloadable settings
+// from. A reload swaps in a new one whole, so that a request never sees
+// half of one; the other settings keep their values from startup.
+type liveSettings struct {
+	config.Config
+	loginLimit, apiLimit ratelimit.Limiter
+}
+
+func (s *Server) settings() *liveSettings {
+	return s.live.Load()
+}
+
+type reloadResult struct {
+	// Applied are the settings that changed and now have their new values.
+	Applied []string `json:"applied"`
+	// RestartRequired are the settings that changed but keep their old
+	// values until the server restarts.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// SetConfigSource sets where Reload reads the configuration from; it is
+// config.Load, the environment alone, unless set.
+func (s *Server) SetConfigSource(load func() (config.Config, error)) {
+	s.loadConfig = load
+}
+
+// Reload reads the configuration again and applies the reloadable
+// settings. Requests in flight finish with the settings they started with.
+// Invalid configuration changes nothing.
+func (s *Server) Reload() (reloadResult, error) {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	load := s.loadConfig
+	if load == nil {
+		load = config.Load
+	}
+	cfg, err := load()
+	if err != nil {
+		return reloadResult{}, err
+	}
+	result := reloadResult{Applied: []string{}, RestartRequired: []string{}}
+	for _, name := range config.Diff(s.settings().Config, cfg) {
+		if slices.Contains(reloadable, name) {
+			result.Applied = append(result.Applied, name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+	s.applySettings(cfg)
+	return result, nil
+}
+
+// applySettings takes the reloadable settings of cfg. Rate limiters are
+// only replaced when their limits change, so that clients keep their
+// buckets across reloads.
+func (s *Server) applySettings(cfg config.Config) {
+	next := &liveSettings{Config: s.cfg}
+	if current := s.settings(); current != nil {
+		*next = *current
+	}
+	next.LogLevel = cfg.LogLevel
+	next.AllowedOrigin = cfg.AllowedOrigin
+	next.SessionTTL = cfg.SessionTTL
+	next.SessionSliding = cfg.SessionSliding
+	next.SessionRefresh = cfg.SessionRefresh
+	next.SessionMaxAge = cfg.SessionMaxAge
+
+	login, api := limiters(cfg, s.redis)
+	if next.loginLimit == nil || next.LoginRateLimit != cfg.LoginRateLimit || next.LoginRateBurst != cfg.LoginRateBurst {
+		next.loginLimit = login
+	}
+	if next.apiLimit == nil || next.APIRateLimit != cfg.APIRateLimit || next.APIRateBurst != cfg.APIRateBurst {
+		next.apiLimit = api
+	}
+	next.LoginRateLimit, next.LoginRateBurst = cfg.LoginRateLimit, cfg.LoginRateBurst
+	next.APIRateLimit, next.APIRateBurst = cfg.APIRateLimit, cfg.APIRateBurst
+	s.live.Store(next)
+}
+
+// logRequests writes the access log unless LOG_LEVEL leaves it out.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	logged := chimw.Logger(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.settings().LogLevel == "warn" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logged.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	result, err := s.Reload()
+	if err != nil {
+		log.Printf("reload: %v", err)
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidConfig, err.Error())
+		return
+	}
+	setAuditSummary(r.Context(), "%d setting(s) applied, %d need a restart", len(result.Applied), len(result.RestartRequired))
+	writeJSON(w, http.StatusOK, result)
+}
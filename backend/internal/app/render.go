@@ -0,0 +1,72 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"notes-backend/internal/config"
+	"notes-backend/internal/markdown"
+	"notes-backend/internal/store"
+)
+
+// newRenderer builds the Markdown renderer that cfg asks for; an unset
+// MarkdownRenderer means GFM.
+func newRenderer(cfg config.Config) *markdown.Renderer {
+	return markdown.New(markdown.Options{
+		GFM:       cfg.MarkdownRenderer != "commonmark",
+		HardWraps: cfg.MarkdownHardWraps,
+	})
+}
+
+// parseRender reads the render query parameter, which can only ask for the
+// html field to be filled in.
+func parseRender(r *http.Request) (bool, bool) {
+	switch strings.TrimSpace(r.URL.Query().Get("render")) {
+	case "":
+		return false, true
+	case "html":
+		return true, true
+	}
+	return false, false
+}
+
+// handleNoteHTML serves a note's content rendered as an HTML fragment. The
+// renderer escapes raw HTML and drops unsafe URLs; the policy headers are a
+// second line of defence for clients that open the response directly.
+func (s *Server) handleNoteHTML(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	n, err := s.store.GetNote(r.Context(), noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if notModified(w, r, noteETag(n), time.Time{}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src http: https:; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = io.WriteString(w, s.noteHTML(n))
+}
+
+// noteHTML renders a note's content, which for an encrypted note is
+// ciphertext and renders as nothing.
+func (s *Server) noteHTML(n store.Note) string {
+	if n.IsEncrypted {
+		return ""
+	}
+	return s.markdown.Render(n.Content)
+}
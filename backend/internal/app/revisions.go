@@ -0,0 +1,274 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"notes-backend/internal/diff"
+	"notes-backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxDiffContext caps the lines of context a diff keeps around changes.
+const maxDiffContext = 100
+
+// updateNote saves the note's current version as a revision before
+// overwriting it, unless history is disabled or the update leaves title,
+// content and tags as they were, and then the links in its new content.
+// The content of an encrypted note cannot change; errNoteEncrypted says so.
+func (s *Server) updateNote(ctx context.Context, id uuid.UUID, input store.NoteInput) (store.Note, error) {
+	current, err := s.store.GetNote(ctx, id)
+	if err != nil {
+		return store.Note{}, err
+	}
+	if input.IfVersion != 0 && input.IfVersion != current.Version {
+		return store.Note{}, store.ErrConflict
+	}
+	if current.IsEncrypted && input.Content != current.Content {
+		return store.Note{}, errNoteEncrypted
+	}
+	setAuditSummary(ctx, "%s", noteChanges(current, input))
+	if s.cfg.MaxRevisions > 0 {
+		if current.Title != input.Title || current.Content != input.Content || !slices.Equal(current.Tags, input.Tags) {
+			if err := s.store.AddRevision(ctx, current, s.cfg.MaxRevisions); err != nil {
+				return store.Note{}, err
+			}
+		}
+	}
+	n, err := s.store.UpdateNote(ctx, id, input, s.clock.Now())
+	if err != nil {
+		return store.Note{}, err
+	}
+	if err := s.store.SetLinks(ctx, id, store.LinkTargets(n.Content)); err != nil {
+		return store.Note{}, err
+	}
+	return n, nil
+}
+
+// revisionSummary is a revision in listings, which carry no content; fetch
+// a single revision to see it.
+type revisionSummary struct {
+	Rev     int       `json:"rev"`
+	Title   string    `json:"title"`
+	Tags    []string  `json:"tags"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+func (s *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if _, err := s.store.GetNote(r.Context(), noteID); err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	revs, err := s.store.ListRevisions(r.Context(), noteID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	items := make([]revisionSummary, 0, len(revs))
+	for _, rev := range revs {
+		items = append(items, revisionSummary{
+			Rev:     rev.Rev,
+			Title:   rev.Title,
+			Tags:    rev.Tags,
+			SavedAt: rev.SavedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := s.revisionParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rev)
+}
+
+// revisionDiff is what changed from one version of a note to another.
+type revisionDiff struct {
+	// From and To are revision numbers; To is 0 for the current version.
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Title is set when the titles differ.
+	Title       *titleChange `json:"title,omitempty"`
+	TagsAdded   []string     `json:"tags_added"`
+	TagsRemoved []string     `json:"tags_removed"`
+	// Removed and Added count the lines of content.
+	Removed int         `json:"removed"`
+	Added   int         `json:"added"`
+	Hunks   []diff.Hunk `json:"hunks"`
+}
+
+// handleRevisionDiff compares the content of a revision with another, or
+// with the current version for "current", line by line. format=unified
+// gives the hunks as diff -u prints them instead; context is how many
+// unchanged lines they keep around a change.
+func (s *Server) handleRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	from, ok := s.revisionParam(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "unified" {
+		writeFieldError(w, "format", "format must be json or unified")
+		return
+	}
+	contextLines := 3
+	if raw := r.URL.Query().Get("context"); raw != "" {
+		var err error
+		if contextLines, err = strconv.Atoi(raw); err != nil || contextLines < 0 || contextLines > maxDiffContext {
+			writeFieldError(w, "context", fmt.Sprintf("context must be between 0 and %d", maxDiffContext))
+			return
+		}
+	}
+
+	var to store.Revision
+	if raw := chi.URLParam(r, "to"); raw == "current" {
+		n, err := s.store.GetNote(r.Context(), from.NoteID)
+		if err == nil && n.IsEncrypted {
+			err = errNoteEncrypted
+		}
+		if err != nil {
+			writeNoteError(w, err)
+			return
+		}
+		to = store.Revision{NoteID: n.ID, Title: n.Title, Content: n.Content, Tags: n.Tags}
+	} else {
+		number, err := strconv.Atoi(raw)
+		if err != nil || number <= 0 {
+			writeFieldError(w, "to", "to must be a revision or current")
+			return
+		}
+		to, err = s.store.GetRevision(r.Context(), from.NoteID, number)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, codeRevisionNotFound, "revision not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+	}
+
+	lines := diff.Lines(from.Content, to.Content)
+	result := revisionDiff{From: from.Rev, To: to.Rev, TagsAdded: []string{}, TagsRemoved: []string{}, Hunks: diff.Hunks(lines, contextLines)}
+	result.Removed, result.Added = diff.Count(lines)
+	if format == "unified" {
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		io.WriteString(w, diff.Unified(revisionName(from), revisionName(to), result.Hunks))
+		return
+	}
+	if from.Title != to.Title {
+		result.Title = &titleChange{From: from.Title, To: to.Title}
+	}
+	for _, tag := range to.Tags {
+		if !slices.Contains(from.Tags, tag) {
+			result.TagsAdded = append(result.TagsAdded, tag)
+		}
+	}
+	for _, tag := range from.Tags {
+		if !slices.Contains(to.Tags, tag) {
+			result.TagsRemoved = append(result.TagsRemoved, tag)
+		}
+	}
+	if result.Hunks == nil {
+		result.Hunks = []diff.Hunk{}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type titleChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func revisionName(rev store.Revision) string {
+	if rev.Rev == 0 {
+		return "current"
+	}
+	return fmt.Sprintf("revision %d", rev.Rev)
+}
+
+// handleRevertRevision makes a revision the note's current version. The
+// version it replaces becomes a revision itself, so reverts can be undone.
+func (s *Server) handleRevertRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := s.revisionParam(w, r)
+	if !ok {
+		return
+	}
+	current, err := s.store.GetNote(r.Context(), rev.NoteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	n, err := s.updateNote(r.Context(), rev.NoteID, store.NoteInput{
+		Title:      rev.Title,
+		Content:    rev.Content,
+		Tags:       rev.Tags,
+		IsFavorite: current.IsFavorite,
+	})
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+// revisionParam loads the revision named by the {id} and {rev} URL
+// parameters of a live note, writing the error response itself on failure.
+func (s *Server) revisionParam(w http.ResponseWriter, r *http.Request) (store.Revision, bool) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return store.Revision{}, false
+	}
+	number, err := strconv.Atoi(chi.URLParam(r, "rev"))
+	if err != nil || number <= 0 {
+		writeFieldError(w, "rev", "invalid revision")
+		return store.Revision{}, false
+	}
+	if _, err := s.store.GetNote(r.Context(), noteID); err != nil {
+		writeNoteError(w, err)
+		return store.Revision{}, false
+	}
+
+	rev, err := s.store.GetRevision(r.Context(), noteID, number)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeRevisionNotFound, "revision not found")
+		return store.Revision{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return store.Revision{}, false
+	}
+	return rev, true
+}
+
+// writeNoteError maps a store error about a note to its response.
+func writeNoteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if errors.Is(err, errNoteEncrypted) {
+		writeError(w, http.StatusConflict, codeNoteEncrypted, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+}
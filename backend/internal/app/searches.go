@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"notes-backend/internal/search"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// maxSearchName is what the MySQL column holds.
+const maxSearchName = 255
+
+// savedSearchParams are the GET /notes parameters a saved search sets.
+var savedSearchParams = []string{"query", "tag", "favorite", "notebook"}
+
+type savedSearchRequest struct {
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+	Tag      string `json:"tag"`
+	Favorite *bool  `json:"favorite"`
+	// Notebook is a notebook ID or "none", as in GET /notes.
+	Notebook string `json:"notebook"`
+}
+
+func (s *Server) handleListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListSavedSearches(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	search, err := s.store.GetSavedSearch(r.Context(), id)
+	if err != nil {
+		writeSavedSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, search)
+}
+
+func (s *Server) handleCreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	var req savedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	input, ok := savedSearchInput(w, req)
+	if !ok {
+		return
+	}
+
+	search, err := s.store.CreateSavedSearch(r.Context(), input, s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), search.ID.String())
+	writeJSON(w, http.StatusCreated, search)
+}
+
+func (s *Server) handleUpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req savedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	input, ok := savedSearchInput(w, req)
+	if !ok {
+		return
+	}
+
+	search, err := s.store.UpdateSavedSearch(r.Context(), id, input, s.clock.Now())
+	if err != nil {
+		writeSavedSearchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, search)
+}
+
+func (s *Server) handleDeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := s.store.DeleteSavedSearch(r.Context(), id); err != nil {
+		writeSavedSearchError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSavedSearchResults lists the notes a saved search matches by
+// handing GET /notes the search's filters in place of the request's own.
+// The other parameters, such as page, sort or archived, pass through.
+func (s *Server) handleSavedSearchResults(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	search, err := s.store.GetSavedSearch(r.Context(), id)
+	if err != nil {
+		writeSavedSearchError(w, err)
+		return
+	}
+
+	list := r.Clone(r.Context())
+	q := list.URL.Query()
+	for _, param := range savedSearchParams {
+		q.Del(param)
+	}
+	for param, value := range map[string]string{"query": search.Query, "tag": search.Tag, "notebook": search.Notebook} {
+		if value != "" {
+			q.Set(param, value)
+		}
+	}
+	if search.Favorite != nil {
+		q.Set("favorite", strconv.FormatBool(*search.Favorite))
+	}
+	list.URL.RawQuery = q.Encode()
+	s.handleListNotes(w, list)
+}
+
+// savedSearchInput validates a saved search and stores its filters the way
+// GET /notes reads them.
+func savedSearchInput(w http.ResponseWriter, req savedSearchRequest) (store.SavedSearchInput, bool) {
+	name := store.NormalizeText(strings.TrimSpace(req.Name))
+	if name == "" {
+		writeFieldError(w, "name", "name is required")
+		return store.SavedSearchInput{}, false
+	}
+	if utf8.RuneCountInString(name) > maxSearchName {
+		writeFieldError(w, "name", "name is too long")
+		return store.SavedSearchInput{}, false
+	}
+	notebook, ok := parseNotebookFilter(strings.TrimSpace(req.Notebook))
+	if !ok {
+		writeFieldError(w, "notebook", "notebook must be a uuid or none")
+		return store.SavedSearchInput{}, false
+	}
+	query := store.NormalizeText(strings.TrimSpace(req.Query))
+	if _, err := search.ParseQuery(query, nil); err != nil {
+		writeQueryError(w, err)
+		return store.SavedSearchInput{}, false
+	}
+	input := store.SavedSearchInput{
+		Name:     name,
+		Query:    query,
+		Tag:      normalizeTag(req.Tag),
+		Favorite: req.Favorite,
+	}
+	switch {
+	case notebook == nil:
+	case *notebook == uuid.Nil:
+		input.Notebook = "none"
+	default:
+		input.Notebook = notebook.String()
+	}
+	return input, true
+}
+
+func writeSavedSearchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeSavedSearchNotFound, "saved search not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"log"
+
+	"notes-backend/internal/config"
+	"notes-backend/internal/search"
+)
+
+// newSearchIndex returns the indexes of SEARCH_BACKEND for notes and for
+// attachments, or nils when the database answers searches itself.
+// Meilisearch keeps attachments in an index named after that of notes.
+func newSearchIndex(cfg config.Config) (notes, attachments search.SearchIndex) {
+	switch cfg.SearchBackend {
+	case "embedded":
+		return search.NewEmbedded(), search.NewEmbedded()
+	case "meilisearch":
+		return search.NewMeilisearch(cfg.MeilisearchURL, cfg.MeilisearchAPIKey, cfg.MeilisearchIndex),
+			search.NewMeilisearch(cfg.MeilisearchURL, cfg.MeilisearchAPIKey, cfg.MeilisearchIndex+"_attachments")
+	}
+	return nil, nil
+}
+
+// syncSearchIndex brings the index up to date between searches, so that
+// they have fewer changes to catch up on. Its first run rebuilds it.
+func (s *Server) syncSearchIndex(ctx context.Context) {
+	if err := s.search.Sync(ctx); err != nil {
+		log.Printf("sync search index: %v", err)
+	}
+}
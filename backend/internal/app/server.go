@@ -7,52 +7,172 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"notes-backend/internal/backup"
+	"notes-backend/internal/cache"
+	"notes-backend/internal/clip"
+	"notes-backend/internal/clock"
 	"notes-backend/internal/config"
+	"notes-backend/internal/events"
+	"notes-backend/internal/markdown"
+	"notes-backend/internal/migrate"
+	"notes-backend/internal/password"
+	"notes-backend/internal/redis"
+	"notes-backend/internal/search"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/replica"
+	"notes-backend/internal/tracing"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Server struct {
 	cfg    config.Config
-	db     *pgxpool.Pool
+	store  store.Store
+	blobs  storage.BlobStore
+	clock  clock.Clock
 	router http.Handler
+	// markdown renders note content for render=html and /html.
+	markdown *markdown.Renderer
+	// clipper fetches the pages POST /clip makes notes of.
+	clipper *clip.Client
+	// backups takes the database backups of /admin; nil disables them.
+	backups *backup.Manager
+	// redis keeps the rate limiters' buckets when set.
+	redis *redis.Client
+	// cache keeps the responses of hot listings for CACHE_TTL_SECONDS; nil
+	// disables it. cacheRedis is its own Redis client, when it does not
+	// share redis.
+	cache      cache.Cache
+	cacheRedis *redis.Client
+	// live holds the settings Reload can change, read per request, and
+	// the rate limiters built from them. Reloads are serialized and read
+	// the configuration with loadConfig.
+	live       atomic.Pointer[liveSettings]
+	reloading  sync.Mutex
+	loadConfig func() (config.Config, error)
+	// bus carries note changes to live connections; closing is closed
+	// when the server shuts down, ending them.
+	bus     *events.Bus
+	closing chan struct{}
+	// health and migrator back the readiness probe; either may be nil,
+	// for stores without a database or servers built around a bare store.
+	health   store.HealthChecker
+	migrator *migrate.Migrator
+	// changes dates note changes for Last-Modified.
+	changes changeClock
+	// daily serializes making daily notes, so that each day gets one.
+	daily sync.Mutex
+	// maintenance is set while writes are refused.
+	maintenance atomic.Pointer[maintenanceStatus]
+	// tracer records spans of requests; nil disables tracing.
+	tracer *tracing.Tracer
+	// search keeps the index of SEARCH_BACKEND; nil leaves searches to
+	// the database.
+	search *search.Indexer
+
+	stopJobs context.CancelFunc
+	jobs     sync.WaitGroup
 }
 
 type sessionContextKey string
 
-const sessionTokenKey sessionContextKey = "sessionToken"
+const (
+	sessionTokenKey sessionContextKey = "sessionToken"
+	sessionIDKey    sessionContextKey = "sessionID"
+)
 
 func New(ctx context.Context, cfg config.Config) (*Server, error) {
-	db, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	tracer := newTracer(cfg)
+	st, migrator, err := openStore(ctx, cfg, tracer)
 	if err != nil {
-		return nil, fmt.Errorf("connect db: %w", err)
+		return nil, err
 	}
-
-	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := db.Ping(pingCtx); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("ping db: %w", err)
+	blobs, err := openBlobs(cfg)
+	if err != nil {
+		st.Close()
+		return nil, err
 	}
-
-	if err := runMigrations(ctx, db, cfg.MigrationsDir); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("migrations: %w", err)
+	s := NewWithStore(cfg, st)
+	s.blobs = blobs
+	s.migrator = migrator
+	s.tracer = tracer
+	if s.backups, err = openBackups(cfg, s.store); err != nil {
+		st.Close()
+		return nil, err
 	}
+	if cfg.RateLimitRedisURL != "" {
+		if s.redis, err = redis.Open(cfg.RateLimitRedisURL); err != nil {
+			st.Close()
+			return nil, fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
+		}
+		live := *s.settings()
+		live.loginLimit, live.apiLimit = limiters(cfg, s.redis)
+		s.live.Store(&live)
+	}
+	if cfg.CacheTTL > 0 && cfg.CacheRedisURL != "" {
+		client := s.redis
+		if cfg.CacheRedisURL != cfg.RateLimitRedisURL {
+			if client, err = redis.Open(cfg.CacheRedisURL); err != nil {
+				st.Close()
+				return nil, fmt.Errorf("CACHE_REDIS_URL: %w", err)
+			}
+			s.cacheRedis = client
+		}
+		s.cache = cache.NewRedis(client)
+	}
+	s.startJobs()
+	return s, nil
+}
 
-	s := &Server{cfg: cfg, db: db}
+func NewWithStore(cfg config.Config, st store.Store) *Server {
+	bus := events.NewBus()
+	health, _ := st.(store.HealthChecker)
+	if health != nil {
+		poolHealth.Store(&health)
+	}
+	var indexer *search.Indexer
+	if index, attachments := newSearchIndex(cfg); index != nil {
+		indexer = search.NewIndexer(index, attachments, st)
+		st = search.NewStore(st, indexer)
+	}
+	s := &Server{
+		cfg:      cfg,
+		store:    events.NewStore(st, bus),
+		clock:    clock.System,
+		markdown: newRenderer(cfg),
+		clipper: clip.New(clip.Options{
+			AllowedHosts: cfg.ClipAllowedHosts,
+			AllowPrivate: cfg.ClipAllowPrivate,
+			MaxPageBytes: cfg.ClipMaxPageBytes,
+		}),
+		bus:     bus,
+		closing: make(chan struct{}),
+		health:  health,
+		search:  indexer,
+	}
+	if cfg.CacheTTL > 0 {
+		s.cache = cache.NewMemory()
+	}
+	s.applySettings(cfg)
+	if cfg.MaintenanceMode {
+		s.startMaintenance("", s.clock.Now())
+	}
 	s.mountRoutes()
-	return s, nil
+	return s
 }
 
 func (s *Server) Handler() http.Handler {
@@ -60,34 +180,183 @@ func (s *Server) Handler() http.Handler {
 }
 
 func (s *Server) Close() {
-	s.db.Close()
+	close(s.closing)
+	if s.stopJobs != nil {
+		s.stopJobs()
+		s.jobs.Wait()
+	}
+	if s.redis != nil {
+		s.redis.Close()
+	}
+	if s.cacheRedis != nil {
+		s.cacheRedis.Close()
+	}
+	s.store.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.tracer.Shutdown(ctx); err != nil {
+		log.Printf("tracing: shutdown: %v", err)
+	}
 }
 
 func (s *Server) mountRoutes() {
 	r := chi.NewRouter()
 	r.Use(chimw.RequestID)
-	r.Use(chimw.RealIP)
-	r.Use(chimw.Logger)
+	r.Use(passRequestID)
+	r.Use(s.realIP)
+	r.Use(s.trace)
+	r.Use(s.logRequests)
 	r.Use(chimw.Recoverer)
-
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
-	})
+	// Event streams and WebSockets are not of a type it compresses, so
+	// they pass through unbuffered.
+	if s.cfg.CompressionLevel > 0 {
+		r.Use(chimw.Compress(s.cfg.CompressionLevel))
+	}
+	r.Use(s.timeout)
+	r.Use(s.refuseWritesInMaintenance)
+
+	r.Get("/health", s.handleLive)
+	r.Get("/health/live", s.handleLive)
+	r.Get("/health/ready", s.handleReady)
+	r.Get("/openapi.json", s.handleOpenAPI)
+	if s.cfg.APIDocs {
+		r.Get("/docs", s.handleDocs)
+	}
 
 	r.Route("/auth", func(r chi.Router) {
-		r.Post("/login", s.handleLogin)
+		r.Use(s.rateLimit(apiLimit), s.audit)
+		r.With(s.rateLimit(loginLimit)).Post("/login", s.handleLogin)
 		r.Post("/logout", s.handleLogout)
 		r.Get("/session", s.handleSessionStatus)
+		r.With(s.rateLimit(loginLimit)).Post("/2fa/verify", s.handleVerifyTwoFactor)
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireSession, s.requireCookieSession)
+			r.Get("/2fa", s.handleTwoFactorStatus)
+			r.With(s.rateLimit(loginLimit)).Post("/2fa/setup", s.handleSetupTwoFactor)
+			r.With(s.rateLimit(loginLimit)).Post("/2fa/enable", s.handleEnableTwoFactor)
+			r.With(s.rateLimit(loginLimit)).Post("/2fa/disable", s.handleDisableTwoFactor)
+			r.Get("/tokens", s.handleListTokens)
+			r.Post("/tokens", s.handleCreateToken)
+			r.Delete("/tokens/{id}", s.handleDeleteToken)
+			r.Get("/sessions", s.handleListSessions)
+			r.Delete("/sessions/{id}", s.handleDeleteSession)
+			r.Post("/sessions/revoke-others", s.handleRevokeOtherSessions)
+		})
 	})
 
+	r.Route("/share/{slug}", func(r chi.Router) {
+		r.Use(s.rateLimit(apiLimit))
+		r.Get("/", s.handleGetShare)
+		r.With(s.rateLimit(loginLimit)).Post("/", s.handleUnlockShare)
+	})
+	r.With(s.rateLimit(apiLimit)).Get("/calendar.ics", s.requireFeedToken(feedCalendar, s.handleCalendarFeed))
+	r.With(s.rateLimit(apiLimit)).Get("/feed.atom", s.requireFeedToken(feedAtom, s.handleAtomFeed))
+	r.With(s.rateLimit(apiLimit), s.audit).Post("/ingest/email", s.handleIngestEmail)
+	r.With(s.rateLimit(apiLimit), s.audit).Post("/ingest/telegram", s.handleTelegram)
+
 	r.Group(func(r chi.Router) {
+		r.Use(s.rateLimit(apiLimit))
+		r.Use(s.audit)
 		r.Use(s.requireSession)
-		r.Get("/notes", s.handleListNotes)
-		r.Post("/notes", s.handleCreateNote)
-		r.Get("/notes/{id}", s.handleGetNote)
+		r.With(preferReplica).Get("/notes", s.handleListNotes)
+		r.With(s.idempotent).Post("/notes", s.handleCreateNote)
+		r.Post("/notes/bulk", s.handleBulkNotes)
+		r.Post("/notes/reorder", s.handleReorderNotes)
+		r.Get("/notes/duplicates", s.handleListDuplicates)
+		r.Post("/notes/merge", s.handleMergeNotes)
+		r.Get("/sync", s.handleSync)
+		r.Post("/sync", s.handlePushSync)
+		r.Get("/export", s.handleExport)
+		r.With(s.idempotent).Post("/import", s.handleImport)
+		r.With(preferReplica).Get("/notes/{id}", s.handleGetNote)
+		r.Get("/notes/{id}/html", s.handleNoteHTML)
 		r.Put("/notes/{id}", s.handleUpdateNote)
+		r.Patch("/notes/{id}", s.handlePatchNote)
 		r.Delete("/notes/{id}", s.handleDeleteNote)
+		r.Get("/notes/trash", s.handleListTrash)
+		r.Get("/notes/counts", s.handleNoteCounts)
+		r.Get("/notes/recent", s.handleRecentNotes)
+		r.Get("/notes/frequent", s.handleFrequentNotes)
+		r.Post("/notes/{id}/restore", s.handleRestoreNote)
+		r.Delete("/notes/{id}/purge", s.handlePurgeNote)
 		r.Post("/notes/{id}/favorite", s.handleFavoriteNote)
+		r.Post("/notes/{id}/pin", s.handlePinNote)
+		r.Post("/notes/{id}/archive", s.handleArchiveNote)
+		r.Post("/notes/{id}/unarchive", s.handleUnarchiveNote)
+		r.Put("/notes/{id}/schedule", s.handleScheduleNote)
+		r.Put("/notes/{id}/appearance", s.handleSetAppearance)
+		r.Post("/notes/{id}/lock", s.handleLockNote)
+		r.Post("/notes/{id}/unlock", s.handleUnlockNote)
+		r.Post("/notes/{id}/duplicate", s.handleDuplicateNote)
+		r.Post("/notes/from-template/{id}", s.handleCreateFromTemplate)
+		r.Post("/clip", s.handleClip)
+		r.Post("/notes/{id}/share", s.handleShareNote)
+		r.Delete("/notes/{id}/share", s.handleUnshareNote)
+		r.Get("/notes/{id}/links", s.handleListLinks)
+		r.Get("/notes/{id}/backlinks", s.handleListBacklinks)
+		r.Get("/notes/{id}/related", s.handleRelatedNotes)
+		r.Get("/notes/{id}/tasks", s.handleNoteTasks)
+		r.Get("/notes/{id}/revisions", s.handleListRevisions)
+		r.Get("/notes/{id}/revisions/{rev}", s.handleGetRevision)
+		r.Get("/notes/{id}/revisions/{rev}/diff/{to}", s.handleRevisionDiff)
+		r.Post("/notes/{id}/revisions/{rev}/revert", s.handleRevertRevision)
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireBlobs)
+			r.Post("/notes/{id}/attachments", s.handleUploadAttachment)
+			r.Get("/notes/{id}/attachments", s.handleListAttachments)
+			r.Get("/attachments/{id}", s.handleGetAttachment)
+			r.Delete("/attachments/{id}", s.handleDeleteAttachment)
+		})
+		r.With(preferReplica).Get("/tags", s.handleListTags)
+		r.Post("/tags/rename", s.handleRenameTag)
+		r.Post("/tags/merge", s.handleMergeTags)
+		r.Delete("/tags/{name}", s.handleDeleteTag)
+		r.Get("/graph", s.handleGraph)
+		r.Get("/stats", s.handleStats)
+		r.Get("/daily", s.handleDailyCalendar)
+		r.Get("/daily/{date}", s.handleGetDaily)
+		r.Post("/daily/{date}", s.handleGetDaily)
+		r.With(s.requireCookieSession).Get("/feeds", s.handleFeeds)
+		r.Get("/tasks", s.handleListTasks)
+		r.Post("/tasks/{id}/toggle", s.handleToggleTask)
+		r.Get("/notebooks", s.handleListNotebooks)
+		r.Post("/notebooks", s.handleCreateNotebook)
+		r.Get("/notebooks/{id}", s.handleGetNotebook)
+		r.Put("/notebooks/{id}", s.handleUpdateNotebook)
+		r.Delete("/notebooks/{id}", s.handleDeleteNotebook)
+		r.Get("/templates", s.handleListTemplates)
+		r.Post("/templates", s.handleCreateTemplate)
+		r.Get("/templates/{id}", s.handleGetTemplate)
+		r.Put("/templates/{id}", s.handleUpdateTemplate)
+		r.Delete("/templates/{id}", s.handleDeleteTemplate)
+		r.With(preferReplica).Get("/search/suggest", s.handleSuggest)
+		r.Get("/searches", s.handleListSavedSearches)
+		r.Post("/searches", s.handleCreateSavedSearch)
+		r.Get("/searches/{id}", s.handleGetSavedSearch)
+		r.Put("/searches/{id}", s.handleUpdateSavedSearch)
+		r.Delete("/searches/{id}", s.handleDeleteSavedSearch)
+		r.With(preferReplica).Get("/searches/{id}/results", s.handleSavedSearchResults)
+		r.Get("/settings", s.handleGetSettings)
+		r.Put("/settings", s.handlePutSettings)
+		r.Get("/webhooks", s.handleListWebhooks)
+		r.Post("/webhooks", s.handleCreateWebhook)
+		r.Delete("/webhooks/{id}", s.handleDeleteWebhook)
+		r.Get("/audit", s.handleListAudit)
+		r.Get("/graphql", s.handleGraphQL)
+		r.Post("/graphql", s.handleGraphQL)
+		r.Get("/ws", s.handleWebSocket)
+		r.Get("/events", s.handleEventStream)
+		r.Method(http.MethodGet, "/debug/vars", expvar.Handler())
+		r.With(s.requireCookieSession).Post("/admin/restore", s.handleRestore)
+		r.With(s.requireCookieSession).Get("/admin/maintenance", s.handleGetMaintenance)
+		r.With(s.requireCookieSession).Post("/admin/maintenance", s.handleSetMaintenance)
+		r.With(s.requireCookieSession).Post("/admin/reload", s.handleReload)
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireCookieSession, s.requireBackups)
+			r.Post("/admin/backup", s.handleCreateBackup)
+			r.Get("/admin/backups", s.handleListBackups)
+			r.Get("/admin/backups/{name}", s.handleGetBackup)
+		})
 	})
 
 	s.router = r
@@ -95,229 +364,423 @@ func (s *Server) mountRoutes() {
 
 func (s *Server) requireSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret, ok := bearerToken(r); ok {
+			s.serveWithToken(w, r, secret, next)
+			return
+		}
+
 		cookie, err := r.Cookie(s.cfg.SessionCookieName)
 		if err != nil || strings.TrimSpace(cookie.Value) == "" {
-			writeError(w, http.StatusUnauthorized, "unauthorized")
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 			return
 		}
 
 		token := strings.TrimSpace(cookie.Value)
-		var exists bool
-		err = s.db.QueryRow(r.Context(), `
-			SELECT EXISTS(
-				SELECT 1
-				FROM sessions
-				WHERE token = $1
-				  AND expires_at > NOW()
-			)
-		`, token).Scan(&exists)
+		session, active, err := s.useSession(r.Context(), w, token)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "database error")
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 			return
 		}
-		if !exists {
-			writeError(w, http.StatusUnauthorized, "unauthorized")
+		if !active {
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 			return
 		}
 
+		setAuditActor(r.Context(), "session:"+session.ID.String())
 		ctx := context.WithValue(r.Context(), sessionTokenKey, token)
+		ctx = context.WithValue(ctx, sessionIDKey, session.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
-	type request struct {
-		Password string `json:"password"`
-	}
+// preferReplica has the reads of read-only routes served by the replica,
+// when DATABASE_URL_READONLY configures one.
+func preferReplica(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(replica.Prefer(r.Context())))
+	})
+}
+
+type okResponse struct {
+	OK bool `json:"ok"`
+}
 
-	var req request
+type sessionStatus struct {
+	Authenticated bool `json:"authenticated"`
+}
+
+type loginRequest struct {
+	Password string `json:"password"`
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
 		return
 	}
 
-	if subtle.ConstantTimeCompare([]byte(req.Password), []byte(s.cfg.AppPassword)) != 1 {
-		writeError(w, http.StatusUnauthorized, "invalid password")
+	if !s.passwordMatches(req.Password) {
+		auditFailure(r.Context(), "auth.login_failed")
+		writeError(w, http.StatusUnauthorized, codeInvalidPassword, "invalid password")
 		return
 	}
 
-	token, err := generateSessionToken()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create session")
+	tf, err := s.store.GetTwoFactor(r.Context())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
-
-	expiresAt := time.Now().Add(s.cfg.SessionTTL)
-	_, err = s.db.Exec(r.Context(), `
-		INSERT INTO sessions (id, token, expires_at)
-		VALUES ($1, $2, $3)
-	`, uuid.New(), token, expiresAt)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+	if err == nil && tf.Enabled {
+		setAuditSummary(r.Context(), "second factor required")
+		writeJSON(w, http.StatusOK, loginChallenge{TwoFactorRequired: true, Challenge: s.loginChallenge(tf.Secret)})
 		return
 	}
+	s.startSession(w, r)
+}
 
-	s.setSessionCookie(w, token, expiresAt)
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+// passwordMatches checks a login against APP_PASSWORD_HASH when it is set
+// and APP_PASSWORD otherwise.
+func (s *Server) passwordMatches(plain string) bool {
+	if s.cfg.AppPasswordHash == "" {
+		return subtle.ConstantTimeCompare([]byte(plain), []byte(s.cfg.AppPassword)) == 1
+	}
+	ok, err := password.Verify(s.cfg.AppPasswordHash, plain)
+	if err != nil {
+		log.Printf("verify password: %v", err)
+	}
+	return ok
 }
 
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(s.cfg.SessionCookieName)
 	if err == nil && strings.TrimSpace(cookie.Value) != "" {
-		_, _ = s.db.Exec(r.Context(), `DELETE FROM sessions WHERE token = $1`, cookie.Value)
+		if session, err := s.store.GetSession(r.Context(), cookie.Value, s.clock.Now()); err == nil {
+			setAuditActor(r.Context(), "session:"+session.ID.String())
+		}
+		_ = s.store.DeleteSession(r.Context(), cookie.Value)
 	}
 	s.clearSessionCookie(w)
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	writeJSON(w, http.StatusOK, okResponse{true})
 }
 
 func (s *Server) handleSessionStatus(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(s.cfg.SessionCookieName)
 	if err != nil || strings.TrimSpace(cookie.Value) == "" {
-		writeJSON(w, http.StatusOK, map[string]any{"authenticated": false})
+		writeJSON(w, http.StatusOK, sessionStatus{false})
 		return
 	}
 
-	var exists bool
-	err = s.db.QueryRow(r.Context(), `
-		SELECT EXISTS(
-			SELECT 1
-			FROM sessions
-			WHERE token = $1
-			  AND expires_at > NOW()
-		)
-	`, cookie.Value).Scan(&exists)
+	active, err := s.store.SessionActive(r.Context(), cookie.Value, s.clock.Now())
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
-	if !exists {
+	if !active {
 		s.clearSessionCookie(w)
-		writeJSON(w, http.StatusOK, map[string]any{"authenticated": false})
+		writeJSON(w, http.StatusOK, sessionStatus{false})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"authenticated": true})
+	writeJSON(w, http.StatusOK, sessionStatus{true})
+}
+
+type notePage struct {
+	Items []store.Note `json:"items"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+	Total int          `json:"total"`
+	// TotalIsEstimate is set when Total is the planner's estimate.
+	TotalIsEstimate bool `json:"total_is_estimate"`
+	// Matches lists the attachments a search matches, on its first page.
+	Matches []attachmentMatch `json:"matches,omitempty"`
 }
 
-type note struct {
-	ID         uuid.UUID `json:"id"`
-	Title      string    `json:"title"`
-	Content    string    `json:"content"`
-	Tags       []string  `json:"tags"`
-	IsFavorite bool      `json:"is_favorite"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+// noteCursorPage answers listings that pass a cursor; NextCursor is null
+// on the last page.
+type noteCursorPage struct {
+	Items           []store.Note      `json:"items"`
+	Limit           int               `json:"limit"`
+	NextCursor      *string           `json:"next_cursor"`
+	Total           int               `json:"total"`
+	TotalIsEstimate bool              `json:"total_is_estimate"`
+	Matches         []attachmentMatch `json:"matches,omitempty"`
 }
 
 func (s *Server) handleListNotes(w http.ResponseWriter, r *http.Request) {
-	query := strings.TrimSpace(r.URL.Query().Get("query"))
-	tag := strings.TrimSpace(r.URL.Query().Get("tag"))
+	query := store.NormalizeText(strings.TrimSpace(r.URL.Query().Get("query")))
+	tag := normalizeTag(r.URL.Query().Get("tag"))
+	language, ok := parseLanguage(r.URL.Query().Get("lang"))
+	if !ok {
+		writeFieldError(w, "lang", "unsupported language")
+		return
+	}
 
 	var favorite *bool
 	favoriteRaw := strings.TrimSpace(r.URL.Query().Get("favorite"))
 	if favoriteRaw != "" {
 		parsed, err := strconv.ParseBool(favoriteRaw)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "favorite must be true or false")
+			writeFieldError(w, "favorite", "favorite must be true or false")
 			return
 		}
 		favorite = &parsed
 	}
 
+	// Archived notes stay out of listings unless asked for.
+	archived := false
+	if raw := strings.TrimSpace(r.URL.Query().Get("archived")); raw != "" {
+		var err error
+		if archived, err = strconv.ParseBool(raw); err != nil {
+			writeFieldError(w, "archived", "archived must be true or false")
+			return
+		}
+	}
+
+	notebook, ok := parseNotebookFilter(strings.TrimSpace(r.URL.Query().Get("notebook")))
+	if !ok {
+		writeFieldError(w, "notebook", "notebook must be a uuid or none")
+		return
+	}
+	color, ok := parseColorFilter(strings.TrimSpace(r.URL.Query().Get("color")))
+	if !ok {
+		writeFieldError(w, "color", "color must be one of "+strings.Join(store.NoteColors, ", ")+" or none")
+		return
+	}
+	near, err := parseNear(strings.TrimSpace(r.URL.Query().Get("near")), strings.TrimSpace(r.URL.Query().Get("radius_km")))
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	renderHTML, ok := parseRender(r)
+	if !ok {
+		writeFieldError(w, "render", "render must be html")
+		return
+	}
+
+	createdFrom, createdTo, ok := s.dayRange(strings.TrimSpace(r.URL.Query().Get("created")))
+	if !ok {
+		writeFieldError(w, "created", "created must be today, yesterday or YYYY-MM-DD")
+		return
+	}
+
+	sortBy := store.NoteSort(strings.TrimSpace(r.URL.Query().Get("sort")))
+	if sortBy != "" && !slices.Contains(store.NoteSorts, sortBy) {
+		writeFieldError(w, "sort", "sort must be manual, updated, created, title or length")
+		return
+	}
+
+	// A cursor, even an empty one for the first page, switches to keyset
+	// pages; page numbers remain for older clients.
+	var after *store.Cursor
+	if r.URL.Query().Has("cursor") {
+		if r.URL.Query().Has("page") {
+			writeFieldError(w, "cursor", "cursor and page cannot be combined")
+			return
+		}
+		if sortBy != "" && sortBy != store.SortUpdated {
+			writeFieldError(w, "cursor", "cursor pages only sort=updated")
+			return
+		}
+		if after, ok = parseCursor(strings.TrimSpace(r.URL.Query().Get("cursor"))); !ok {
+			writeFieldError(w, "cursor", "invalid cursor")
+			return
+		}
+	}
+
 	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
 	limit := parsePositiveInt(r.URL.Query().Get("limit"), 30)
 	if limit > 100 {
 		limit = 100
 	}
 	offset := (page - 1) * limit
+	if after != nil {
+		offset = 0
+	}
+	filter := store.NoteFilter{
+		Query:       query,
+		Tag:         tag,
+		Language:    store.LanguageOr(language, s.cfg.DefaultLanguage),
+		Favorite:    favorite,
+		Archived:    &archived,
+		Notebook:    notebook,
+		Color:       color,
+		Near:        near,
+		CreatedFrom: createdFrom,
+		CreatedTo:   createdTo,
+		Sort:        sortBy,
+		Limit:       limit,
+		Offset:      offset,
+		After:       after,
+	}
+	if err := s.applyQuery(&filter, query); err != nil {
+		writeQueryError(w, err)
+		return
+	}
 
-	countQuery := `
-		SELECT COUNT(*)
-		FROM notes
-		WHERE ($1 = '' OR title ILIKE '%' || $1 || '%' OR content ILIKE '%' || $1 || '%')
-		  AND ($2 = '' OR $2 = ANY(tags))
-		  AND ($3::boolean IS NULL OR is_favorite = $3)
-	`
-
-	var total int
-	if err := s.db.QueryRow(r.Context(), countQuery, query, tag, favorite).Scan(&total); err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+	// The counter is read before the listing: a write landing in between
+	// yields fresh data under an old tag, which only costs the next poll.
+	seq, err := s.store.ChangeSeq(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	etag := listETag(seq, filter)
+	if notModified(w, r, etag, s.changes.modifiedAt(seq, s.clock.Now())) {
 		return
 	}
+	// First pages are what dashboards poll, from every tab open. The tag
+	// holds the counter, so a write leaves the pages cached before it.
+	var cacheKey string
+	if offset == 0 && (after == nil || *after == store.Cursor{}) {
+		cacheKey = fmt.Sprintf("notes:%s:%t:%t", etag, renderHTML, after != nil)
+		if s.cachedResponse(w, r, cacheKey) {
+			return
+		}
+	}
 
-	rows, err := s.db.Query(r.Context(), `
-		SELECT id, title, content, tags, is_favorite, created_at, updated_at
-		FROM notes
-		WHERE ($1 = '' OR title ILIKE '%' || $1 || '%' OR content ILIKE '%' || $1 || '%')
-		  AND ($2 = '' OR $2 = ANY(tags))
-		  AND ($3::boolean IS NULL OR is_favorite = $3)
-		ORDER BY updated_at DESC
-		LIMIT $4 OFFSET $5
-	`, query, tag, favorite, limit, offset)
+	estimate, err := s.estimateTotal(r.Context(), filter)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
-	defer rows.Close()
+	filter.SkipCount = estimate >= 0
 
-	items := make([]note, 0, limit)
-	for rows.Next() {
-		var n note
-		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &n.Tags, &n.IsFavorite, &n.CreatedAt, &n.UpdatedAt); err != nil {
-			writeError(w, http.StatusInternalServerError, "database error")
+	// A cursor page reads one note more to tell whether another page follows.
+	if after != nil {
+		filter.Limit++
+	}
+	items, total, err := s.store.ListNotes(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if filter.SkipCount {
+		total = estimate
+	}
+	var nextCursor *string
+	if after != nil && len(items) > limit {
+		items = items[:limit]
+		next := formatCursor(items[limit-1])
+		nextCursor = &next
+	}
+	if renderHTML {
+		for i := range items {
+			items[i].HTML = s.noteHTML(items[i])
+		}
+	}
+	var matches []attachmentMatch
+	if filter.Query != "" && offset == 0 && (after == nil || *after == store.Cursor{}) {
+		if matches, err = s.attachmentMatches(r.Context(), filter.Query); err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 			return
 		}
-		items = append(items, n)
 	}
-	if rows.Err() != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+
+	if after != nil {
+		s.writeCachedJSON(w, r, cacheKey, noteCursorPage{
+			Items:           items,
+			Limit:           limit,
+			NextCursor:      nextCursor,
+			Total:           total,
+			TotalIsEstimate: filter.SkipCount,
+			Matches:         matches,
+		})
 		return
 	}
-
-	writeJSON(w, http.StatusOK, map[string]any{
-		"items": items,
-		"page":  page,
-		"limit": limit,
-		"total": total,
+	s.writeCachedJSON(w, r, cacheKey, notePage{
+		Items:           items,
+		Page:            page,
+		Limit:           limit,
+		Total:           total,
+		TotalIsEstimate: filter.SkipCount,
+		Matches:         matches,
 	})
 }
 
+// estimateTotal returns the planner's estimate of matching notes when
+// estimates are enabled and large enough to be worth trusting over an exact
+// COUNT(*), and -1 otherwise.
+func (s *Server) estimateTotal(ctx context.Context, filter store.NoteFilter) (int, error) {
+	estimator, ok := s.store.(store.NoteEstimator)
+	if !ok || s.cfg.EstimateTotalsAbove <= 0 {
+		return -1, nil
+	}
+	estimate, err := estimator.EstimateNotes(ctx, filter)
+	if err != nil || estimate < s.cfg.EstimateTotalsAbove {
+		return -1, err
+	}
+	return estimate, nil
+}
+
 func (s *Server) handleGetNote(w http.ResponseWriter, r *http.Request) {
 	noteID, err := parseUUIDParam(r, "id")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeValidationError(w, err)
+		return
+	}
+	renderHTML, ok := parseRender(r)
+	if !ok {
+		writeFieldError(w, "render", "render must be html")
 		return
 	}
 
-	var n note
-	err = s.db.QueryRow(r.Context(), `
-		SELECT id, title, content, tags, is_favorite, created_at, updated_at
-		FROM notes
-		WHERE id = $1
-	`, noteID).Scan(&n.ID, &n.Title, &n.Content, &n.Tags, &n.IsFavorite, &n.CreatedAt, &n.UpdatedAt)
-	if errors.Is(err, pgx.ErrNoRows) {
-		writeError(w, http.StatusNotFound, "note not found")
+	// Read first, as for lists: a write landing in between dates fresh data
+	// too early, which only costs the next poll.
+	seq, err := s.store.ChangeSeq(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	n, err := s.store.GetNote(r.Context(), noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
 		return
 	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	s.recordAccess(r.Context(), n.ID)
+	if notModified(w, r, noteETag(n), s.changes.modifiedAt(seq, s.clock.Now())) {
 		return
 	}
 
+	if renderHTML {
+		n.HTML = s.noteHTML(n)
+	}
 	writeJSON(w, http.StatusOK, n)
 }
 
-func (s *Server) handleCreateNote(w http.ResponseWriter, r *http.Request) {
-	type request struct {
-		Title      string   `json:"title"`
-		Content    string   `json:"content"`
-		Tags       []string `json:"tags"`
-		IsFavorite bool     `json:"is_favorite"`
-	}
+type noteRequest struct {
+	Title      string          `json:"title"`
+	Content    string          `json:"content"`
+	Tags       []string        `json:"tags"`
+	IsFavorite bool            `json:"is_favorite"`
+	Language   string          `json:"language"`
+	NotebookID json.RawMessage `json:"notebook_id"`
+	Latitude   json.RawMessage `json:"latitude"`
+	Longitude  json.RawMessage `json:"longitude"`
+}
 
-	var req request
+func (s *Server) handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	var req noteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	language, ok := parseLanguage(req.Language)
+	if !ok {
+		writeFieldError(w, "language", "unsupported language")
+		return
+	}
+	notebookID, ok := s.noteNotebook(w, r, req.NotebookID)
+	if !ok {
+		return
+	}
+	location, _, err := parseLocation(req.Latitude, req.Longitude)
+	if err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
@@ -325,48 +788,67 @@ func (s *Server) handleCreateNote(w http.ResponseWriter, r *http.Request) {
 	if title == "" {
 		title = "Untitled"
 	}
-	content := req.Content
-	tags := sanitizeTags(req.Tags)
 
-	var n note
-	err := s.db.QueryRow(r.Context(), `
-		INSERT INTO notes (id, title, content, tags, is_favorite)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, title, content, tags, is_favorite, created_at, updated_at
-	`, uuid.New(), title, content, tags, req.IsFavorite).Scan(
-		&n.ID,
-		&n.Title,
-		&n.Content,
-		&n.Tags,
-		&n.IsFavorite,
-		&n.CreatedAt,
-		&n.UpdatedAt,
-	)
+	input := store.NoteInput{
+		Title:      store.NormalizeText(title),
+		Content:    store.NormalizeText(req.Content),
+		Tags:       sanitizeTags(req.Tags),
+		IsFavorite: req.IsFavorite,
+		Language:   store.LanguageOr(language, s.cfg.DefaultLanguage),
+		NotebookID: notebookID,
+		Location:   location,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
+	n, err := s.store.CreateNote(r.Context(), input, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
 
+	setAuditEntity(r.Context(), n.ID.String())
+	w.Header().Set("ETag", noteETag(n))
 	writeJSON(w, http.StatusCreated, n)
 }
 
+// handleUpdateNote requires If-Match with the ETag of the version being
+// edited, so that a client working from a stale copy gets 412 and the
+// current note instead of overwriting someone else's changes. "*" opts out.
 func (s *Server) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
 	noteID, err := parseUUIDParam(r, "id")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeValidationError(w, err)
 		return
 	}
-
-	type request struct {
-		Title      string   `json:"title"`
-		Content    string   `json:"content"`
-		Tags       []string `json:"tags"`
-		IsFavorite bool     `json:"is_favorite"`
+	ifMatch := r.Header.Get("If-Match")
+	if strings.TrimSpace(ifMatch) == "" {
+		writeError(w, http.StatusPreconditionRequired, codePreconditionRequired, "If-Match is required")
+		return
 	}
 
-	var req request
+	var req noteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	language, ok := parseLanguage(req.Language)
+	if !ok {
+		writeFieldError(w, "language", "unsupported language")
+		return
+	}
+	notebookID, ok := s.noteNotebook(w, r, req.NotebookID)
+	if !ok {
+		return
+	}
+	location, setLocation, err := parseLocation(req.Latitude, req.Longitude)
+	if err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
@@ -374,103 +856,343 @@ func (s *Server) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
 	if title == "" {
 		title = "Untitled"
 	}
-	tags := sanitizeTags(req.Tags)
 
-	var n note
-	err = s.db.QueryRow(r.Context(), `
-		UPDATE notes
-		SET title = $2,
-		    content = $3,
-		    tags = $4,
-		    is_favorite = $5,
-		    updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, title, content, tags, is_favorite, created_at, updated_at
-	`, noteID, title, req.Content, tags, req.IsFavorite).Scan(
-		&n.ID,
-		&n.Title,
-		&n.Content,
-		&n.Tags,
-		&n.IsFavorite,
-		&n.CreatedAt,
-		&n.UpdatedAt,
-	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		writeError(w, http.StatusNotFound, "note not found")
+	input := store.NoteInput{
+		Title:       store.NormalizeText(title),
+		Content:     store.NormalizeText(req.Content),
+		Tags:        sanitizeTags(req.Tags),
+		IsFavorite:  req.IsFavorite,
+		Language:    language,
+		NotebookID:  notebookID,
+		Location:    location,
+		SetLocation: setLocation,
+		IfVersion:   ifMatchVersion(ifMatch),
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
+	n, err := s.updateNote(r.Context(), noteID, input)
+	if errors.Is(err, store.ErrConflict) && s.cfg.ConflictStrategy != "reject" {
+		s.writeResolvedConflict(w, r, noteID, input)
+		return
+	}
+	s.writeUpdatedNote(w, r, noteID, n, err)
+}
+
+// writeResolvedConflict answers a PUT to an earlier version of the note as
+// CONFLICT_STRATEGY resolved it, which Conflict-Resolution names: the note
+// written over, or 201 with the conflicted copy the write was saved as.
+func (s *Server) writeResolvedConflict(w http.ResponseWriter, r *http.Request, noteID uuid.UUID, input store.NoteInput) {
+	resolved, err := s.resolveConflict(r.Context(), noteID, input)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	if resolved.Resolution == resolutionRejected {
+		s.writeUpdatedNote(w, r, noteID, store.Note{}, store.ErrConflict)
+		return
+	}
+	w.Header().Set("Conflict-Resolution", resolved.Resolution)
+	if resolved.Copy == nil {
+		s.writeUpdatedNote(w, r, noteID, resolved.Note, nil)
+		return
+	}
+	setAuditSummary(r.Context(), "saved as conflicted copy %s", resolved.Copy.ID)
+	w.Header().Set("Location", "/notes/"+resolved.Copy.ID.String())
+	w.Header().Set("ETag", noteETag(*resolved.Copy))
+	writeJSON(w, http.StatusCreated, resolved.Copy)
+}
+
+type patchNoteRequest struct {
+	Title      *string         `json:"title"`
+	Content    *string         `json:"content"`
+	Tags       *[]string       `json:"tags"`
+	IsFavorite *bool           `json:"is_favorite"`
+	Language   *string         `json:"language"`
+	NotebookID json.RawMessage `json:"notebook_id"`
+	Latitude   json.RawMessage `json:"latitude"`
+	Longitude  json.RawMessage `json:"longitude"`
+}
+
+// handlePatchNote changes only the fields present in the body, leaving the
+// rest as they are. Like PUT it requires If-Match; "*" still guards against
+// writes landing between reading the note and saving the merge.
+func (s *Server) handlePatchNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if strings.TrimSpace(ifMatch) == "" {
+		writeError(w, http.StatusPreconditionRequired, codePreconditionRequired, "If-Match is required")
+		return
+	}
+
+	// Unknown fields are rejected: a misspelled one would otherwise be a
+	// silent no-op.
+	var req patchNoteRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	language := ""
+	if req.Language != nil {
+		var ok bool
+		if language, ok = parseLanguage(*req.Language); !ok || language == "" {
+			writeFieldError(w, "language", "unsupported language")
+			return
+		}
+	}
+	notebookID, ok := s.noteNotebook(w, r, req.NotebookID)
+	if !ok {
+		return
+	}
+	location, setLocation, err := parseLocation(req.Latitude, req.Longitude)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	current, err := s.store.GetNote(r.Context(), noteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	if version := ifMatchVersion(ifMatch); version != 0 && version != current.Version {
+		w.Header().Set("ETag", noteETag(current))
+		writeJSON(w, http.StatusPreconditionFailed, current)
+		return
+	}
+	if req.Title == nil && req.Content == nil && req.Tags == nil && req.IsFavorite == nil && language == "" && notebookID == nil && !setLocation {
+		w.Header().Set("ETag", noteETag(current))
+		writeJSON(w, http.StatusOK, current)
+		return
+	}
+
+	input := store.NoteInput{
+		Title:       current.Title,
+		Content:     current.Content,
+		Tags:        current.Tags,
+		IsFavorite:  current.IsFavorite,
+		Language:    language,
+		NotebookID:  notebookID,
+		Location:    location,
+		SetLocation: setLocation,
+		IfVersion:   current.Version,
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			title = "Untitled"
+		}
+		input.Title = store.NormalizeText(title)
+	}
+	if req.Content != nil {
+		input.Content = store.NormalizeText(*req.Content)
+	}
+	if req.Tags != nil {
+		input.Tags = sanitizeTags(*req.Tags)
+	}
+	if req.IsFavorite != nil {
+		input.IsFavorite = *req.IsFavorite
+	}
+	// Only the fields sent are checked, so that notes stored before the
+	// limits were lowered can still be edited otherwise.
+	var changed store.NoteInput
+	if req.Title != nil {
+		changed.Title = input.Title
+	}
+	if req.Content != nil {
+		changed.Content = input.Content
+	}
+	if req.Tags != nil {
+		changed.Tags = input.Tags
+	}
+	if err := s.cfg.NoteLimits.Note(changed.Title, changed.Content, changed.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
+	n, err := s.updateNote(r.Context(), noteID, input)
+	s.writeUpdatedNote(w, r, noteID, n, err)
+}
+
+// writeUpdatedNote answers a note update: with the note, or on a version
+// conflict with 412 and the note as it now stands.
+func (s *Server) writeUpdatedNote(w http.ResponseWriter, r *http.Request, noteID uuid.UUID, n store.Note, err error) {
+	if errors.Is(err, store.ErrConflict) {
+		current, err := s.store.GetNote(r.Context(), noteID)
+		if err != nil {
+			writeNoteError(w, err)
+			return
+		}
+		w.Header().Set("ETag", noteETag(current))
+		writeJSON(w, http.StatusPreconditionFailed, current)
 		return
 	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeNoteError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", noteETag(n))
 	writeJSON(w, http.StatusOK, n)
 }
 
 func (s *Server) handleDeleteNote(w http.ResponseWriter, r *http.Request) {
 	noteID, err := parseUUIDParam(r, "id")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeValidationError(w, err)
 		return
 	}
 
-	result, err := s.db.Exec(r.Context(), `DELETE FROM notes WHERE id = $1`, noteID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+	err = s.store.DeleteNote(r.Context(), noteID, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
 		return
 	}
-	if result.RowsAffected() == 0 {
-		writeError(w, http.StatusNotFound, "note not found")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type flagRequest struct {
+	Value bool `json:"value"`
+}
+
 func (s *Server) handleFavoriteNote(w http.ResponseWriter, r *http.Request) {
 	noteID, err := parseUUIDParam(r, "id")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeValidationError(w, err)
+		return
+	}
+
+	var req flagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+
+	n, err := s.store.SetFavorite(r.Context(), noteID, req.Value, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
 
-	type request struct {
-		Value bool `json:"value"`
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (s *Server) handlePinNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
 	}
-	var req request
+
+	var req flagRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
 		return
 	}
 
-	var n note
-	err = s.db.QueryRow(r.Context(), `
-		UPDATE notes
-		SET is_favorite = $2,
-		    updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, title, content, tags, is_favorite, created_at, updated_at
-	`, noteID, req.Value).Scan(
-		&n.ID,
-		&n.Title,
-		&n.Content,
-		&n.Tags,
-		&n.IsFavorite,
-		&n.CreatedAt,
-		&n.UpdatedAt,
-	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		writeError(w, http.StatusNotFound, "note not found")
+	n, err := s.store.SetPinned(r.Context(), noteID, req.Value, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
 		return
 	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "database error")
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, n)
 }
 
+func (s *Server) handleArchiveNote(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, true)
+}
+
+func (s *Server) handleUnarchiveNote(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, false)
+}
+
+func (s *Server) setArchived(w http.ResponseWriter, r *http.Request, value bool) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	n, err := s.store.SetArchived(r.Context(), noteID, value, s.clock.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, n)
+}
+
+const maxReorderNotes = 1000
+
+type reorderRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+// handleReorderNotes sets the manual order of sort=manual listings from the
+// notes as the client shows them, first to last. Notes left out keep their
+// positions, so clients send the whole list they reordered.
+func (s *Server) handleReorderNotes(w http.ResponseWriter, r *http.Request) {
+	var req reorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeFieldError(w, "ids", "ids is required")
+		return
+	}
+	if len(req.IDs) > maxReorderNotes {
+		writeFieldError(w, "ids", fmt.Sprintf("at most %d ids", maxReorderNotes))
+		return
+	}
+	seen := make(map[uuid.UUID]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			writeFieldError(w, "ids", "duplicate id "+id.String())
+			return
+		}
+		seen[id] = true
+	}
+
+	err := s.store.ReorderNotes(r.Context(), req.IDs)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func generateSessionToken() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -509,15 +1231,75 @@ func (s *Server) clearSessionCookie(w http.ResponseWriter) {
 func parseUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
 	raw := chi.URLParam(r, name)
 	if raw == "" {
-		return uuid.Nil, fmt.Errorf("%s is required", name)
+		return uuid.Nil, &fieldError{Field: name, Message: name + " is required"}
 	}
 	parsed, err := uuid.Parse(raw)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid %s", name)
+		return uuid.Nil, &fieldError{Field: name, Message: "invalid " + name}
 	}
 	return parsed, nil
 }
 
+// applyQuery parses the query language of GET /notes into filter, over
+// the params it also has: tag: adds to tag, is: overrides favorite and
+// archived, and dates narrow created.
+func (s *Server) applyQuery(filter *store.NoteFilter, raw string) error {
+	q, err := search.ParseQuery(raw, s.cfg.TimeZone)
+	if err != nil {
+		return err
+	}
+	filter.Query, filter.TitleQuery = q.Text, q.Title
+	for _, tag := range q.Tags {
+		filter.Tags = append(filter.Tags, normalizeTag(tag))
+	}
+	for _, tag := range q.ExcludeTags {
+		filter.ExcludeTags = append(filter.ExcludeTags, normalizeTag(tag))
+	}
+	if q.Favorite != nil {
+		filter.Favorite = q.Favorite
+	}
+	if q.Archived != nil {
+		filter.Archived = q.Archived
+	}
+	if q.CreatedFrom.After(filter.CreatedFrom) {
+		filter.CreatedFrom = q.CreatedFrom
+	}
+	if !q.CreatedTo.IsZero() && (filter.CreatedTo.IsZero() || q.CreatedTo.Before(filter.CreatedTo)) {
+		filter.CreatedTo = q.CreatedTo
+	}
+	return nil
+}
+
+// dayRange resolves a calendar day to the instant it starts and the instant
+// the next one starts, in the configured time zone rather than the server's
+// or the database's. An empty value is no restriction.
+func (s *Server) dayRange(raw string) (time.Time, time.Time, bool) {
+	loc := s.cfg.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := s.clock.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	var day time.Time
+	switch raw {
+	case "":
+		return time.Time{}, time.Time{}, true
+	case "today":
+		day = today
+	case "yesterday":
+		day = today.AddDate(0, 0, -1)
+	default:
+		parsed, err := time.ParseInLocation(time.DateOnly, raw, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		day = parsed
+	}
+	// AddDate rather than 24h, so days around DST changes keep their length.
+	return day, day.AddDate(0, 0, 1), true
+}
+
 func parsePositiveInt(raw string, fallback int) int {
 	if raw == "" {
 		return fallback
@@ -529,6 +1311,58 @@ func parsePositiveInt(raw string, fallback int) int {
 	return value
 }
 
+// formatCursor makes the opaque cursor of the page that follows n.
+func formatCursor(n store.Note) string {
+	pinned := "0"
+	if n.IsPinned {
+		pinned = "1"
+	}
+	raw := pinned + " " + n.UpdatedAt.UTC().Format(time.RFC3339Nano) + " " + n.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseCursor reads a cursor from formatCursor; an empty one starts from
+// the top.
+func parseCursor(raw string) (*store.Cursor, bool) {
+	if raw == "" {
+		return &store.Cursor{}, true
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(decoded), " ")
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") {
+		return nil, false
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil || updatedAt.IsZero() {
+		return nil, false
+	}
+	noteID, err := uuid.Parse(parts[2])
+	if err != nil {
+		return nil, false
+	}
+	return &store.Cursor{Pinned: parts[0] == "1", UpdatedAt: updatedAt, ID: noteID}, true
+}
+
+// parseLanguage accepts an empty language, which callers treat as "default"
+// or "unchanged", or one of store.Languages in any case.
+func parseLanguage(raw string) (string, bool) {
+	language := strings.ToLower(strings.TrimSpace(raw))
+	return language, language == "" || slices.Contains(store.Languages, language)
+}
+
+// normalizeTag is applied both to stored tags and to tag filters, so that a
+// tag matches however its accents were composed or its letters cased.
+func normalizeTag(tag string) string {
+	t := []rune(strings.ToLower(store.NormalizeText(strings.TrimSpace(tag))))
+	if len(t) > 32 {
+		t = t[:32]
+	}
+	return string(t)
+}
+
 func sanitizeTags(tags []string) []string {
 	if len(tags) == 0 {
 		return []string{}
@@ -536,13 +1370,10 @@ func sanitizeTags(tags []string) []string {
 	uniq := make(map[string]struct{}, len(tags))
 	clean := make([]string, 0, len(tags))
 	for _, tag := range tags {
-		t := strings.ToLower(strings.TrimSpace(tag))
+		t := normalizeTag(tag)
 		if t == "" {
 			continue
 		}
-		if len(t) > 32 {
-			t = t[:32]
-		}
 		if _, exists := uniq[t]; exists {
 			continue
 		}
@@ -557,7 +1388,3 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
 }
-
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
-}
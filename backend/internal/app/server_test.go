@@ -0,0 +1,4494 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/backup"
+	"notes-backend/internal/clip"
+	"notes-backend/internal/clock"
+	"notes-backend/internal/config"
+	"notes-backend/internal/password"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+	"notes-backend/internal/telegram"
+	"notes-backend/internal/totp"
+	"notes-backend/internal/tracing"
+	"notes-backend/internal/validate"
+	"notes-backend/internal/webhook"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const testPassword = "secret"
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := config.Config{
+		AppPassword:       testPassword,
+		SessionCookieName: "notes_session",
+		SessionTTL:        time.Hour,
+	}
+	s := NewWithStore(cfg, memory.New())
+	t.Cleanup(s.Close)
+	return s
+}
+
+func doRequest(t *testing.T, s *Server, method, path string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// putNote updates a note unconditionally, for tests that are not about
+// concurrent edits.
+func putNote(t *testing.T, s *Server, path string, body any, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatalf("encode body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPut, path, &buf)
+	req.Header.Set("If-Match", "*")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func login(t *testing.T, s *Server) *http.Cookie {
+	t.Helper()
+	rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": testPassword})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body = %s", rec.Code, rec.Body)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "notes_session" {
+			return c
+		}
+	}
+	t.Fatal("login did not set a session cookie")
+	return nil
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	s := newTestServer(t)
+	rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": "nope"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+
+	type minted struct {
+		store.APIToken
+		Token string `json:"token"`
+	}
+	mint := func(name string, scope store.TokenScope) minted {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodPost, "/auth/tokens", map[string]any{"name": name, "scope": scope}, cookie)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("mint %s: status %d: %s", name, rec.Code, rec.Body)
+		}
+		return decode[minted](t, rec)
+	}
+	reader := mint("backup cron", store.ScopeRead)
+	fake.Advance(time.Second)
+	writer := mint("shortcuts", store.ScopeWrite)
+	if !strings.HasPrefix(reader.Token, "nt_") || reader.Token == writer.Token {
+		t.Fatalf("secrets %q and %q", reader.Token, writer.Token)
+	}
+
+	withToken := func(method, path, secret string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	note := map[string]any{"title": "from a script"}
+	for _, tc := range []struct {
+		method, path, secret string
+		body                 any
+		want                 int
+	}{
+		{http.MethodGet, "/notes", reader.Token, nil, http.StatusOK},
+		{http.MethodPost, "/notes", reader.Token, note, http.StatusForbidden},
+		{http.MethodPost, "/notes", writer.Token, note, http.StatusCreated},
+		{http.MethodGet, "/notes", "nt_forged", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/auth/tokens", writer.Token, nil, http.StatusForbidden},
+		{http.MethodPost, "/auth/tokens", writer.Token, map[string]any{"name": "x", "scope": "write"}, http.StatusForbidden},
+	} {
+		if rec := withToken(tc.method, tc.path, tc.secret, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s with %.8s...: status %d, want %d", tc.method, tc.path, tc.secret, rec.Code, tc.want)
+		}
+	}
+
+	// GraphQL only reads, so read-only tokens may POST queries.
+	rec := withToken(http.MethodPost, "/graphql", reader.Token, map[string]any{"query": "{ notes { items { title } } }"})
+	if got := decode[map[string]any](t, rec); rec.Code != http.StatusOK || got["errors"] != nil || got["data"] == nil {
+		t.Errorf("POST /graphql with a read token: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	list := decode[struct {
+		Items []map[string]any `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/auth/tokens", nil, cookie)).Items
+	if len(list) != 2 || list[0]["name"] != "shortcuts" || list[0]["last_used_at"] == nil || list[1]["scope"] != "read" {
+		t.Fatalf("tokens = %v", list)
+	}
+	if _, ok := list[0]["token"]; ok {
+		t.Fatal("listing shows a secret")
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/auth/tokens/"+writer.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", rec.Code)
+	}
+	if rec := withToken(http.MethodGet, "/notes", writer.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: status %d, want 401", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/auth/tokens/"+writer.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("revoke again: status %d, want 404", rec.Code)
+	}
+	for _, body := range []map[string]any{{"name": "", "scope": "read"}, {"name": "x", "scope": "admin"}, {"name": "x"}} {
+		if rec := doRequest(t, s, http.MethodPost, "/auth/tokens", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("mint %v: status %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/auth/tokens", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("list without a session: status %d, want 401", rec.Code)
+	}
+}
+
+func TestLoginWithPasswordHash(t *testing.T) {
+	s := newTestServer(t)
+	hash, err := password.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.AppPassword, s.cfg.AppPasswordHash = "", hash
+
+	login(t, s)
+	if rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": hash}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login with the hash itself: status = %d, want 401", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": ""}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("empty password: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := doRequest(t, s, http.MethodGet, "/auth/session", nil)
+	if got := decode[map[string]bool](t, rec); got["authenticated"] {
+		t.Fatal("expected anonymous session before login")
+	}
+
+	cookie := login(t, s)
+	rec = doRequest(t, s, http.MethodGet, "/auth/session", nil, cookie)
+	if got := decode[map[string]bool](t, rec); !got["authenticated"] {
+		t.Fatal("expected authenticated session after login")
+	}
+
+	doRequest(t, s, http.MethodPost, "/auth/logout", nil, cookie)
+	rec = doRequest(t, s, http.MethodGet, "/notes", nil, cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status after logout = %d, want 401", rec.Code)
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+
+	cookie := login(t, s)
+	fake.Advance(s.cfg.SessionTTL - time.Second)
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("status before expiry = %d, want 200", rec.Code)
+	}
+
+	fake.Advance(time.Second)
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status at expiry = %d, want 401", rec.Code)
+	}
+}
+
+func TestSlidingSession(t *testing.T) {
+	s := newTestServer(t)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	s.clock = fake
+	s.cfg.SessionSliding = true
+	s.cfg.SessionRefresh = 5 * time.Minute
+	s.cfg.SessionMaxAge = 3 * time.Hour
+	s.applySettings(s.cfg)
+
+	cookie := login(t, s)
+	// Each request at offset (from login) should leave the session expiring
+	// at expires, and send a cookie only when that moved.
+	steps := []struct {
+		offset, expires time.Duration
+		cookie          bool
+	}{
+		{2 * time.Minute, time.Hour, false},
+		{50 * time.Minute, 110 * time.Minute, true},
+		{90 * time.Minute, 150 * time.Minute, true},
+		{140 * time.Minute, 3 * time.Hour, true},
+		{178 * time.Minute, 3 * time.Hour, false},
+	}
+	for _, step := range steps {
+		fake.Set(start.Add(step.offset))
+		rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("at %v: status %d", step.offset, rec.Code)
+		}
+		cookies := rec.Result().Cookies()
+		if step.cookie != (len(cookies) == 1) {
+			t.Fatalf("at %v: cookies %v", step.offset, cookies)
+		}
+		if step.cookie && !cookies[0].Expires.Equal(start.Add(step.expires)) {
+			t.Errorf("at %v: cookie expires %v, want %v", step.offset, cookies[0].Expires, start.Add(step.expires))
+		}
+	}
+
+	fake.Set(start.Add(3 * time.Hour))
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status past the maximum age = %d, want 401", rec.Code)
+	}
+}
+
+func TestSessionList(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"password": "`+testPassword+`"}`))
+	req.Header.Set("User-Agent", "Phone/1.0")
+	req.RemoteAddr = "198.51.100.7:4000"
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	phone := rec.Result().Cookies()[0]
+	fake.Advance(30 * time.Minute)
+	laptop := login(t, s)
+	fake.Advance(time.Minute)
+	login(t, s)
+
+	list := func(cookie *http.Cookie) []sessionInfo {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, "/auth/sessions", nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list sessions: status %d", rec.Code)
+		}
+		return decode[struct{ Items []sessionInfo }](t, rec).Items
+	}
+	fake.Advance(2 * time.Minute)
+	items := list(laptop)
+	if len(items) != 3 || !items[0].Current || items[0].LastSeenAt != fake.Now() {
+		t.Fatalf("sessions = %+v", items)
+	}
+	last := items[2]
+	if last.Current || last.UserAgent != "Phone/1.0" || last.IP != "198.51.100.7" || !last.LastSeenAt.Equal(last.CreatedAt) {
+		t.Errorf("phone session = %+v", last)
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/auth/sessions/"+last.ID.String(), nil, laptop); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete session: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, phone); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/auth/sessions/"+last.ID.String(), nil, laptop); rec.Code != http.StatusNotFound {
+		t.Errorf("delete again: status %d", rec.Code)
+	}
+
+	fake.Advance(time.Minute)
+	rec = doRequest(t, s, http.MethodPost, "/auth/sessions/revoke-others", nil, laptop)
+	if got := decode[sessionsRevoked](t, rec); rec.Code != http.StatusOK || got.Revoked != 1 {
+		t.Fatalf("revoke others: status %d, %+v", rec.Code, got)
+	}
+	if items := list(laptop); len(items) != 1 || !items[0].Current {
+		t.Errorf("sessions after revoking = %+v", items)
+	}
+
+	audit := decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit?entity=session", nil, laptop))
+	if audit.Total != 2 || audit.Items[0].Action != "session.revoke_others" || audit.Items[1].EntityID != last.ID.String() {
+		t.Errorf("audit = %+v", audit.Items)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+
+	if rec := doRequest(t, s, http.MethodPost, "/auth/2fa/setup", map[string]string{"password": "wrong"}, cookie); rec.Code != http.StatusForbidden {
+		t.Fatalf("setup with wrong password: status %d", rec.Code)
+	}
+	rec := doRequest(t, s, http.MethodPost, "/auth/2fa/setup", map[string]string{"password": testPassword}, cookie)
+	setup := decode[twoFactorSetup](t, rec)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(setup.URI, "otpauth://totp/") || !strings.Contains(setup.URI, "secret="+setup.Secret) {
+		t.Fatalf("setup: status %d, %+v", rec.Code, setup)
+	}
+	code := func() string {
+		t.Helper()
+		c, err := totp.Code(setup.Secret, totp.Step(fake.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/auth/2fa/enable", map[string]string{"password": testPassword, "code": "000000"}, cookie); rec.Code != http.StatusForbidden {
+		t.Fatalf("enable with wrong code: status %d", rec.Code)
+	}
+	rec = doRequest(t, s, http.MethodPost, "/auth/2fa/enable", map[string]string{"password": testPassword, "code": code()}, cookie)
+	codes := decode[recoveryCodes](t, rec).RecoveryCodes
+	if rec.Code != http.StatusOK || len(codes) != recoveryCodeCount {
+		t.Fatalf("enable: status %d, %v", rec.Code, codes)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": testPassword})
+		got := decode[loginChallenge](t, rec)
+		if rec.Code != http.StatusOK || !got.TwoFactorRequired || len(rec.Result().Cookies()) != 0 {
+			t.Fatalf("login: status %d, %+v", rec.Code, got)
+		}
+		return got.Challenge
+	}
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		t.Helper()
+		return doRequest(t, s, http.MethodPost, "/auth/2fa/verify", map[string]string{"challenge": challenge, "code": code})
+	}
+
+	// The code that enabled 2FA is used up, so wait for the next one.
+	fake.Advance(totp.Period)
+	c := challenge()
+	if rec := verify(c+"x", code()); rec.Code != http.StatusUnauthorized {
+		t.Errorf("forged challenge: status %d", rec.Code)
+	}
+	rec = verify(c, code())
+	if rec.Code != http.StatusOK || len(rec.Result().Cookies()) != 1 {
+		t.Fatalf("verify: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := verify(c, code()); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused code: status %d", rec.Code)
+	}
+
+	recovery := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if rec := verify(challenge(), recovery); rec.Code != http.StatusOK {
+		t.Errorf("recovery code: status %d", rec.Code)
+	}
+	if rec := verify(challenge(), codes[0]); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status %d", rec.Code)
+	}
+	status := decode[twoFactorStatus](t, doRequest(t, s, http.MethodGet, "/auth/2fa", nil, cookie))
+	if !status.Enabled || status.RecoveryCodes != recoveryCodeCount-1 {
+		t.Errorf("status = %+v", status)
+	}
+
+	c = challenge()
+	fake.Advance(loginChallengeTTL)
+	if rec := verify(c, codes[1]); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired challenge: status %d", rec.Code)
+	}
+
+	if rec := doRequest(t, s, http.MethodPost, "/auth/2fa/disable", map[string]string{"password": testPassword}, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("disable: status %d", rec.Code)
+	}
+	login(t, s)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.RequestTimeout = 10 * time.Millisecond
+
+	serve := func(path string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.timeout(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+	}
+
+	rec := serve("/notes", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		failing(w, r)
+	})
+	if rec.Code != http.StatusGatewayTimeout || decode[errorResponse](t, rec).Error != "request timed out" {
+		t.Errorf("deadline: status %d, body %s", rec.Code, rec.Body)
+	}
+	rec = serve("/notes", func(w http.ResponseWriter, r *http.Request) {
+		store.ReportTimeout(r.Context())
+		failing(w, r)
+	})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("statement timeout: status %d", rec.Code)
+	}
+	if rec := serve("/notes", failing); rec.Code != http.StatusInternalServerError || decode[errorResponse](t, rec).Error != "database error" {
+		t.Errorf("other error: status %d, body %s", rec.Code, rec.Body)
+	}
+	serve("/events", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("event stream has a deadline")
+		}
+	})
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+
+	login(t, s)
+	fake.Advance(s.cfg.SessionTTL / 2)
+	fresh := login(t, s)
+	fake.Advance(s.cfg.SessionTTL / 2)
+
+	before := sessionsPurged.Value()
+	s.deleteExpiredSessions(context.Background())
+	if got := sessionsPurged.Value() - before; got != 1 {
+		t.Fatalf("purged %d session(s), want 1", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, fresh); rec.Code != http.StatusOK {
+		t.Fatalf("status with the live session = %d, want 200", rec.Code)
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/debug/vars", nil, fresh)
+	vars := decode[map[string]any](t, rec)
+	if vars["sessions_purged"] != float64(sessionsPurged.Value()) {
+		t.Fatalf("sessions_purged = %v, want %d", vars["sessions_purged"], sessionsPurged.Value())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.LoginRateLimit, s.cfg.LoginRateBurst = 6, 2
+	s.cfg.APIRateLimit, s.cfg.APIRateBurst = 60, 3
+	s.applySettings(s.cfg)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+
+	wrong := map[string]string{"password": "wrong"}
+	for i := 0; i < 2; i++ {
+		if rec := doRequest(t, s, http.MethodPost, "/auth/login", wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("login %d status = %d, want 401", i, rec.Code)
+		}
+		fake.Advance(time.Second)
+	}
+	rec := doRequest(t, s, http.MethodPost, "/auth/login", wrong)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "8" {
+		t.Fatalf("throttled login = %d, Retry-After %q; want 429 after 8s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"password":"wrong"}`))
+	req.RemoteAddr = "198.51.100.7:4000"
+	other := httptest.NewRecorder()
+	s.Handler().ServeHTTP(other, req)
+	if other.Code != http.StatusUnauthorized {
+		t.Fatalf("login from another client = %d, want 401", other.Code)
+	}
+
+	// Forwarding headers only name the client when a trusted proxy sends them.
+	forwarded := func(peer, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"password":"wrong"}`))
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, spoofed := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := forwarded("192.0.2.1:1234", spoofed); code != http.StatusTooManyRequests {
+			t.Fatalf("login spoofing X-Forwarded-For %s = %d, want 429", spoofed, code)
+		}
+	}
+	s.cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	if code := forwarded("10.0.0.2:5000", "192.0.2.1, 203.0.113.1"); code != http.StatusUnauthorized {
+		t.Fatalf("login forwarded by a trusted proxy = %d, want 401", code)
+	}
+	if code := forwarded("10.0.0.2:5000", "203.0.113.3, 192.0.2.1, 10.0.0.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("login forwarded for the throttled client = %d, want 429", code)
+	}
+
+	fake.Advance(8 * time.Second)
+	cookie := login(t, s)
+
+	fake.Advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusOK {
+			t.Fatalf("list %d status = %d, want 200", i, rec.Code)
+		}
+	}
+	rec = doRequest(t, s, http.MethodGet, "/notes", nil, cookie)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("throttled list = %d, Retry-After %q; want 429 after 1s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	fake.Advance(time.Second)
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("list after refill status = %d, want 200", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/health", nil); rec.Code != http.StatusOK {
+		t.Fatalf("health status = %d, want 200", rec.Code)
+	}
+}
+
+func TestNoteTimestampsUseClock(t *testing.T) {
+	s := newTestServer(t)
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(created)
+	s.clock = fake
+	cookie := login(t, s)
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a"}, cookie))
+	fake.Advance(time.Minute)
+	updated := decode[store.Note](t, putNote(t, s, "/notes/"+n.ID.String(), map[string]any{"title": "b"}, cookie))
+
+	if !updated.CreatedAt.Equal(created) || !updated.UpdatedAt.Equal(created.Add(time.Minute)) {
+		t.Fatalf("timestamps = %s / %s", updated.CreatedAt, updated.UpdatedAt)
+	}
+}
+
+func TestNotesRequireSession(t *testing.T) {
+	s := newTestServer(t)
+	rec := doRequest(t, s, http.MethodGet, "/notes", nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestNoteCRUD(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title":   "  ",
+		"content": "hello",
+		"tags":    []string{" Go ", "go", ""},
+	}, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body = %s", rec.Code, rec.Body)
+	}
+	created := decode[store.Note](t, rec)
+	if created.Title != "Untitled" {
+		t.Errorf("title = %q, want Untitled", created.Title)
+	}
+	if len(created.Tags) != 1 || created.Tags[0] != "go" {
+		t.Errorf("tags = %v, want [go]", created.Tags)
+	}
+
+	path := "/notes/" + created.ID.String()
+	rec = putNote(t, s, path, map[string]any{
+		"title":   "Renamed",
+		"content": "updated",
+	}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if updated := decode[store.Note](t, rec); updated.Title != "Renamed" || updated.Content != "updated" {
+		t.Errorf("update returned %+v", updated)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, path+"/favorite", map[string]bool{"value": true}, cookie)
+	if favorited := decode[store.Note](t, rec); !favorited.IsFavorite {
+		t.Error("favorite did not stick")
+	}
+
+	rec = doRequest(t, s, http.MethodGet, path, nil, cookie)
+	if fetched := decode[store.Note](t, rec); fetched.Title != "Renamed" || !fetched.IsFavorite {
+		t.Errorf("get returned %+v", fetched)
+	}
+
+	rec = doRequest(t, s, http.MethodDelete, path, nil, cookie)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	rec = doRequest(t, s, http.MethodGet, path, nil, cookie)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status = %d, want 404", rec.Code)
+	}
+}
+
+func patchNote(t *testing.T, s *Server, id uuid.UUID, ifMatch, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, "/notes/"+id.String(), strings.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPatchNote(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 10
+	cookie := login(t, s)
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Work"}, cookie))
+	created := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "Plan", "content": "body", "tags": []string{"a"}, "is_favorite": true, "language": "english", "notebook_id": nb.ID,
+	}, cookie))
+
+	rec := patchNote(t, s, created.ID, noteETag(created), `{"title": "  New plan "}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch title: status %d: %s", rec.Code, rec.Body)
+	}
+	n := decode[store.Note](t, rec)
+	if n.Title != "New plan" || n.Content != "body" || strings.Join(n.Tags, ",") != "a" || !n.IsFavorite ||
+		n.Language != "english" || n.NotebookID == nil || *n.NotebookID != nb.ID || n.Version != created.Version+1 {
+		t.Fatalf("patched note = %+v", n)
+	}
+	if rec.Header().Get("ETag") != noteETag(n) {
+		t.Fatalf("ETag = %q", rec.Header().Get("ETag"))
+	}
+
+	n = decode[store.Note](t, patchNote(t, s, n.ID, "*", `{"tags": ["B", "c"], "is_favorite": false, "notebook_id": null}`, cookie))
+	if n.Title != "New plan" || strings.Join(n.Tags, ",") != "b,c" || n.IsFavorite || n.NotebookID != nil {
+		t.Fatalf("patched note = %+v", n)
+	}
+	revs := decode[struct{ Items []struct{ Title string } }](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/revisions", nil, cookie))
+	if len(revs.Items) != 2 {
+		t.Fatalf("revisions = %+v, want one per change", revs.Items)
+	}
+
+	if rec := patchNote(t, s, n.ID, "*", `{}`, cookie); rec.Code != http.StatusOK || decode[store.Note](t, rec).Version != n.Version {
+		t.Fatalf("empty patch: status %d, body %s", rec.Code, rec.Body)
+	}
+	stale := patchNote(t, s, n.ID, noteETag(created), `{"title": "lost"}`, cookie)
+	if stale.Code != http.StatusPreconditionFailed || decode[store.Note](t, stale).Title != "New plan" {
+		t.Fatalf("stale patch: status %d, body %s", stale.Code, stale.Body)
+	}
+
+	for _, tc := range []struct {
+		ifMatch, body string
+		want          int
+	}{
+		{"", `{"title": "x"}`, http.StatusPreconditionRequired},
+		{"*", `{"titel": "x"}`, http.StatusBadRequest},
+		{"*", `{"language": "klingon"}`, http.StatusBadRequest},
+		{"*", `{"notebook_id": "` + uuid.NewString() + `"}`, http.StatusBadRequest},
+		{"*", `{"tags": "a"}`, http.StatusBadRequest},
+	} {
+		if rec := patchNote(t, s, n.ID, tc.ifMatch, tc.body, cookie); rec.Code != tc.want {
+			t.Errorf("patch %s with If-Match %q: status %d, want %d", tc.body, tc.ifMatch, rec.Code, tc.want)
+		}
+	}
+	if rec := patchNote(t, s, uuid.New(), "*", `{"title": "x"}`, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("patch of a missing note: status %d, want 404", rec.Code)
+	}
+}
+
+func TestListNotesFilters(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	for _, n := range []map[string]any{
+		{"title": "Groceries", "content": "milk", "tags": []string{"home"}},
+		{"title": "Standup", "content": "Milk the metrics", "tags": []string{"work"}, "is_favorite": true},
+		{"title": "Ideas", "content": "none", "tags": []string{"work"}},
+	} {
+		if rec := doRequest(t, s, http.MethodPost, "/notes", n, cookie); rec.Code != http.StatusCreated {
+			t.Fatalf("create status = %d", rec.Code)
+		}
+	}
+
+	type listResponse struct {
+		Items []store.Note `json:"items"`
+		Total int          `json:"total"`
+	}
+	cases := map[string]int{
+		"/notes":                         3,
+		"/notes?query=MILK":              2,
+		"/notes?tag=work":                2,
+		"/notes?favorite=true":           1,
+		"/notes?tag=work&favorite=false": 1,
+		"/notes?query=milk&tag=home":     1,
+		"/notes?query=nothing-like-this": 0,
+		"/notes?limit=2&page=2":          3,
+	}
+	for path, want := range cases {
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d", path, rec.Code)
+		}
+		if got := decode[listResponse](t, rec); got.Total != want {
+			t.Errorf("%s total = %d, want %d", path, got.Total, want)
+		}
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/notes?limit=2&page=2", nil, cookie)
+	if got := decode[listResponse](t, rec); len(got.Items) != 1 {
+		t.Errorf("second page has %d items, want 1", len(got.Items))
+	}
+}
+
+func TestListNotesCursor(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	// Three notes share an updated_at, so only the id keeps pages apart.
+	for i := range 5 {
+		if i >= 3 {
+			fake.Advance(time.Minute)
+		}
+		doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": fmt.Sprintf("note %d", i)}, cookie)
+	}
+
+	type cursorPage struct {
+		Items      []store.Note `json:"items"`
+		NextCursor *string      `json:"next_cursor"`
+		Total      int          `json:"total"`
+	}
+	var seen []store.Note
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages == 1 {
+			// A note added mid-way lands before the cursor and shifts nothing.
+			fake.Advance(time.Minute)
+			doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "late"}, cookie)
+		}
+		rec := doRequest(t, s, http.MethodGet, "/notes?limit=2&cursor="+cursor, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d: %s", pages, rec.Code, rec.Body)
+		}
+		page := decode[cursorPage](t, rec)
+		seen = append(seen, page.Items...)
+		if page.NextCursor == nil {
+			if len(page.Items) == 0 || pages != 2 {
+				t.Fatalf("last page %d has %d notes", pages, len(page.Items))
+			}
+			break
+		}
+		cursor = *page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("paged through %d notes, want 5", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		prev, n := seen[i-1], seen[i]
+		if n.UpdatedAt.After(prev.UpdatedAt) || (n.UpdatedAt.Equal(prev.UpdatedAt) && n.ID.String() >= prev.ID.String()) {
+			t.Fatalf("notes out of order: %+v then %+v", prev, n)
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/notes?cursor=bogus":       http.StatusBadRequest,
+		"/notes?cursor=&page=2":     http.StatusBadRequest,
+		"/notes?cursor=&tag=absent": http.StatusOK,
+	} {
+		if rec := doRequest(t, s, http.MethodGet, path, nil, cookie); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestPinAndSortNotes(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	ids := make(map[string]uuid.UUID)
+	for _, title := range []string{"beta", "Alpha", "gamma", "delta"} {
+		fake.Advance(time.Minute)
+		n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title}, cookie))
+		ids[title] = n.ID
+	}
+
+	titles := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		var got []string
+		for _, n := range decode[struct{ Items []store.Note }](t, rec).Items {
+			got = append(got, n.Title)
+		}
+		return strings.Join(got, ",")
+	}
+
+	fake.Advance(time.Minute)
+	rec := doRequest(t, s, http.MethodPost, "/notes/"+ids["beta"].String()+"/pin", map[string]bool{"value": true}, cookie)
+	if pinned := decode[store.Note](t, rec); rec.Code != http.StatusOK || !pinned.IsPinned {
+		t.Fatalf("pin: status %d, note %+v", rec.Code, pinned)
+	}
+	rec = doRequest(t, s, http.MethodPost, "/notes/reorder", map[string]any{"ids": []uuid.UUID{ids["gamma"], ids["Alpha"], ids["delta"]}}, cookie)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("reorder: status %d: %s", rec.Code, rec.Body)
+	}
+	if n := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+ids["Alpha"].String(), nil, cookie)); n.SortPosition != 2 {
+		t.Fatalf("Alpha sort_position = %d, want 2", n.SortPosition)
+	}
+
+	for path, want := range map[string]string{
+		"/notes":              "beta,delta,gamma,Alpha",
+		"/notes?sort=updated": "beta,delta,gamma,Alpha",
+		"/notes?sort=created": "beta,delta,gamma,Alpha",
+		"/notes?sort=title":   "beta,Alpha,delta,gamma",
+		"/notes?sort=manual":  "beta,gamma,Alpha,delta",
+		"/notes?cursor=":      "beta,delta,gamma,Alpha",
+	} {
+		if got := titles(path); got != want {
+			t.Errorf("%s = %s, want %s", path, got, want)
+		}
+	}
+
+	// Keyset pages cross from pinned notes to the rest.
+	page := decode[struct {
+		Items      []store.Note
+		NextCursor *string `json:"next_cursor"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes?cursor=&limit=1", nil, cookie))
+	if len(page.Items) != 1 || page.NextCursor == nil {
+		t.Fatalf("first cursor page = %+v", page)
+	}
+	if got := titles("/notes?limit=2&cursor=" + *page.NextCursor); got != "delta,gamma" {
+		t.Fatalf("second cursor page = %s, want delta,gamma", got)
+	}
+
+	doRequest(t, s, http.MethodPost, "/notes/"+ids["beta"].String()+"/pin", map[string]bool{"value": false}, cookie)
+	if got := titles("/notes?sort=manual"); got != "beta,gamma,Alpha,delta" {
+		t.Errorf("manual order after unpinning = %s, want beta (never reordered) first", got)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{http.MethodGet, "/notes?sort=random", nil, http.StatusBadRequest},
+		{http.MethodGet, "/notes?sort=title&cursor=", nil, http.StatusBadRequest},
+		{http.MethodPost, "/notes/reorder", map[string]any{"ids": []uuid.UUID{}}, http.StatusBadRequest},
+		{http.MethodPost, "/notes/reorder", map[string]any{"ids": []uuid.UUID{ids["beta"], ids["beta"]}}, http.StatusBadRequest},
+		{http.MethodPost, "/notes/reorder", map[string]any{"ids": []uuid.UUID{ids["beta"], uuid.New()}}, http.StatusNotFound},
+		{http.MethodPost, "/notes/" + uuid.NewString() + "/pin", map[string]bool{"value": true}, http.StatusNotFound},
+	} {
+		if rec := doRequest(t, s, tc.method, tc.path, tc.body, cookie); rec.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+	}
+	// A failed reorder changes nothing.
+	if n := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+ids["beta"].String(), nil, cookie)); n.SortPosition != 0 {
+		t.Errorf("beta sort_position = %d after a failed reorder, want 0", n.SortPosition)
+	}
+}
+
+func TestArchiveNotes(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	done := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "done", "tags": []string{"q1"}}, cookie))
+	decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "open", "tags": []string{"q1"}}, cookie))
+
+	rec := doRequest(t, s, http.MethodPost, "/notes/"+done.ID.String()+"/archive", nil, cookie)
+	if archived := decode[store.Note](t, rec); rec.Code != http.StatusOK || !archived.IsArchived || archived.Version != done.Version+1 {
+		t.Fatalf("archive: status %d, note %+v", rec.Code, archived)
+	}
+
+	titles := func(path string) string {
+		t.Helper()
+		var got []string
+		for _, n := range decode[struct{ Items []store.Note }](t, doRequest(t, s, http.MethodGet, path, nil, cookie)).Items {
+			got = append(got, n.Title)
+		}
+		return strings.Join(got, ",")
+	}
+	for path, want := range map[string]string{
+		"/notes":                       "open",
+		"/notes?archived=false":        "open",
+		"/notes?archived=true":         "done",
+		"/notes?archived=true&tag=q1":  "done",
+		"/notes?archived=true&tag=q2":  "",
+		"/notes?archived=true&cursor=": "done",
+	} {
+		if got := titles(path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+done.ID.String(), nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("get archived note: status %d", rec.Code)
+	}
+
+	// Trashing and restoring keeps the note archived.
+	doRequest(t, s, http.MethodDelete, "/notes/"+done.ID.String(), nil, cookie)
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+done.ID.String()+"/unarchive", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("unarchive trashed note: status %d, want 404", rec.Code)
+	}
+	doRequest(t, s, http.MethodPost, "/notes/"+done.ID.String()+"/restore", nil, cookie)
+	if got := titles("/notes?archived=true"); got != "done" {
+		t.Fatalf("archived after restore = %q", got)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/notes/"+done.ID.String()+"/unarchive", nil, cookie)
+	if n := decode[store.Note](t, rec); rec.Code != http.StatusOK || n.IsArchived {
+		t.Fatalf("unarchive: status %d, note %+v", rec.Code, n)
+	}
+	if got := titles("/notes"); got != "done,open" {
+		t.Errorf("/notes after unarchive = %q", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes?archived=maybe", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("archived=maybe: status %d, want 400", rec.Code)
+	}
+}
+
+func TestNoteLinks(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	create := func(title, content string) store.Note {
+		t.Helper()
+		return decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content}, cookie))
+	}
+	titles := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, rec.Code)
+		}
+		var got []string
+		for _, n := range decode[struct{ Items []store.Note }](t, rec).Items {
+			got = append(got, n.Title)
+		}
+		return strings.Join(got, ",")
+	}
+
+	rust := create("Rust", "systems language")
+	hub := create("Index", "See [[Rust|the language]], [[Go]] twice [[Go]] and [["+strings.ToUpper(rust.ID.String())+"]].\n"+
+		"Not `[[Code]]`, nor\n```\n[[Fenced]]\n```")
+	// Title links resolve when read, so notes created later are found.
+	golang := create("Go", "links back to [[Index]]")
+	create("Code", "")
+
+	if got := titles("/notes/" + hub.ID.String() + "/links"); got != "Go,Rust" {
+		t.Errorf("links = %q", got)
+	}
+	if got := titles("/notes/" + rust.ID.String() + "/backlinks"); got != "Index" {
+		t.Errorf("backlinks of Rust = %q", got)
+	}
+	if got := titles("/notes/" + hub.ID.String() + "/backlinks"); got != "Go" {
+		t.Errorf("backlinks of Index = %q", got)
+	}
+
+	rec := putNote(t, s, "/notes/"+golang.ID.String(), map[string]any{"title": "Go", "content": "no links"}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := titles("/notes/" + hub.ID.String() + "/backlinks"); got != "" {
+		t.Errorf("backlinks after unlinking = %q", got)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+hub.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("trash: status %d", rec.Code)
+	}
+	if got := titles("/notes/" + rust.ID.String() + "/backlinks"); got != "" {
+		t.Errorf("backlinks from a trashed note = %q", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+hub.ID.String()+"/links", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("links of a trashed note: status %d", rec.Code)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	create := func(title, content string, tags ...string) {
+		t.Helper()
+		fake.Advance(time.Minute)
+		rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content, "tags": tags}, cookie)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d", title, rec.Code)
+		}
+	}
+	create("a", "[[b]] [[c]] [[a]]", "x", "y")
+	create("b", "[[a]]", "x", "y")
+	create("c", "", "x")
+	create("d", "[[gone]]")
+
+	type graph struct {
+		Nodes []struct {
+			Title string   `json:"title"`
+			Tags  []string `json:"tags"`
+		} `json:"nodes"`
+		Edges []struct {
+			Source int      `json:"source"`
+			Target int      `json:"target"`
+			Kind   string   `json:"kind"`
+			Tags   []string `json:"tags"`
+		} `json:"edges"`
+		Truncated bool `json:"truncated"`
+	}
+	summary := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, rec.Code)
+		}
+		g := decode[graph](t, rec)
+		var parts []string
+		for _, n := range g.Nodes {
+			parts = append(parts, n.Title)
+		}
+		for _, e := range g.Edges {
+			parts = append(parts, fmt.Sprintf("%s>%s:%s%v", g.Nodes[e.Source].Title, g.Nodes[e.Target].Title, e.Kind, e.Tags))
+		}
+		if g.Truncated {
+			parts = append(parts, "truncated")
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// Nodes come most recently updated first.
+	want := "d c b a b>a:link[] a>c:link[] a>b:link[] c>b:tag[x] c>a:tag[x] b>a:tag[x y]"
+	if got := summary("/graph"); got != want {
+		t.Errorf("graph =\n%s\nwant\n%s", got, want)
+	}
+	if got, want := summary("/graph?tag=y"), "b a b>a:link[] a>b:link[] b>a:tag[x]"; got != want {
+		t.Errorf("graph?tag=y = %q, want %q", got, want)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/graph?notebook=nope", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad notebook: status %d", rec.Code)
+	}
+}
+
+func TestRelatedNotes(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	create := func(title, content string, tags ...string) store.Note {
+		t.Helper()
+		return decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content, "tags": tags}, cookie))
+	}
+	budget := create("Budget review", "Quarterly budget review with the finance team, see [[Forecast]]", "finance", "planning")
+	create("Forecast", "Revenue forecast for next year", "finance")
+	create("Sales", "Numbers from [[Forecast]]")
+	create("Budget review draft", "Quarterly budget review with the finance team")
+	create("Groceries", "Milk and eggs")
+	old := create("Old budget", "", "finance", "planning")
+	doRequest(t, s, http.MethodPost, "/notes/"+old.ID.String()+"/archive", nil, cookie)
+
+	related := func(path string) []relatedNote {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		return decode[relatedResponse](t, rec).Items
+	}
+	items := related("/notes/" + budget.ID.String() + "/related")
+	var got []string
+	for _, n := range items {
+		got = append(got, fmt.Sprintf("%s %v %d %v %v", n.Title, n.Score, n.LinkDistance, n.SharedTags, n.Similarity > 0))
+	}
+	want := []string{
+		"Forecast 1.797 1 [finance] true",
+		"Budget review draft 1.375 0 [] true",
+		"Sales 0.5 2 [] false",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("related =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if items := related("/notes/" + budget.ID.String() + "/related?limit=1"); len(items) != 1 || items[0].Title != "Forecast" {
+		t.Errorf("related?limit=1 = %+v", items)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+uuid.NewString()+"/related", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("related of a missing note: status %d", rec.Code)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	create := func(title, content string) store.Note {
+		t.Helper()
+		return decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content}, cookie))
+	}
+	type task struct {
+		ID      string `json:"id"`
+		NoteID  string `json:"note_id"`
+		Version int64  `json:"version"`
+		Line    int    `json:"line"`
+		Text    string `json:"text"`
+		Done    bool   `json:"done"`
+	}
+	list := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, rec.Code)
+		}
+		var got []string
+		for _, tk := range decode[struct{ Items []task }](t, rec).Items {
+			got = append(got, fmt.Sprintf("%s:%v", tk.Text, tk.Done))
+		}
+		return strings.Join(got, ",")
+	}
+
+	groceries := create("Groceries", "- [ ] milk\n- [x] eggs\n```\n- [ ] fenced\n```\n1. [ ] bread")
+	create("Chores", "* [X] dishes")
+	old := create("Old", "- [ ] archived")
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+old.ID.String()+"/archive", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("archive: status %d", rec.Code)
+	}
+
+	if got := list("/notes/" + groceries.ID.String() + "/tasks"); got != "milk:false,eggs:true,bread:false" {
+		t.Errorf("note tasks = %q", got)
+	}
+	if got := list("/notes/" + groceries.ID.String() + "/tasks?done=true"); got != "eggs:true" {
+		t.Errorf("done note tasks = %q", got)
+	}
+	if got := list("/tasks?done=false"); got != "milk:false,bread:false" {
+		t.Errorf("open tasks = %q", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/tasks?done=maybe", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad done filter: status %d", rec.Code)
+	}
+
+	toggle := func(id string, body any, ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/tasks/"+id+"/toggle", &buf)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	rec := toggle(groceries.ID.String()+"-2", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("toggle: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := decode[task](t, rec); got.Text != "bread" || !got.Done || got.Line != 6 || got.Version != groceries.Version+1 {
+		t.Errorf("toggled = %+v", got)
+	}
+	if rec := toggle(groceries.ID.String()+"-0", map[string]bool{"done": false}, ""); rec.Code != http.StatusOK || decode[task](t, rec).Done {
+		t.Errorf("set done=false: status %d", rec.Code)
+	}
+	n := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+groceries.ID.String(), nil, cookie))
+	if want := "- [ ] milk\n- [x] eggs\n```\n- [ ] fenced\n```\n1. [x] bread"; n.Content != want {
+		t.Errorf("content = %q", n.Content)
+	}
+
+	if rec := toggle(groceries.ID.String()+"-0", nil, fmt.Sprintf(`"%d"`, groceries.Version)); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: status %d", rec.Code)
+	}
+	if rec := toggle(groceries.ID.String()+"-3", nil, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing task: status %d", rec.Code)
+	}
+	if rec := toggle("nope-1", nil, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad task id: status %d", rec.Code)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	deliveries := make(chan *http.Request, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		deliveries <- r
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t)
+	s.startJobs()
+	cookie := login(t, s)
+
+	for _, body := range []map[string]any{
+		{"url": "ftp://example.com/"},
+		{"url": receiver.URL, "events": []string{"note.exploded"}},
+		{"url": receiver.URL, "secret": "short"},
+	} {
+		if rec := doRequest(t, s, http.MethodPost, "/webhooks", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %v: status %d", body, rec.Code)
+		}
+	}
+	type created struct {
+		ID     uuid.UUID `json:"id"`
+		Events []string  `json:"events"`
+		Secret string    `json:"secret"`
+	}
+	rec := doRequest(t, s, http.MethodPost, "/webhooks", map[string]any{"url": receiver.URL + "/hook", "events": []string{"note.created"}}, cookie)
+	hook := decode[created](t, rec)
+	if rec.Code != http.StatusCreated || len(hook.Secret) < 32 || len(hook.Events) != 1 {
+		t.Fatalf("create: status %d, %+v", rec.Code, hook)
+	}
+	list := doRequest(t, s, http.MethodGet, "/webhooks", nil, cookie)
+	if strings.Contains(list.Body.String(), hook.Secret) || !strings.Contains(list.Body.String(), hook.ID.String()) {
+		t.Errorf("list = %s", list.Body)
+	}
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "hooked"}, cookie))
+	select {
+	case r := <-deliveries:
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.EventHeader) != "note.created" || r.Header.Get(webhook.SignatureHeader) != webhook.Sign(hook.Secret, body) {
+			t.Errorf("delivery headers = %v", r.Header)
+		}
+		var p webhook.Payload
+		if err := json.Unmarshal(body, &p); err != nil || p.NoteID != n.ID || p.Note == nil || p.Note.Title != "hooked" {
+			t.Errorf("payload = %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/webhooks/"+hook.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/webhooks/"+hook.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("delete twice: status %d", rec.Code)
+	}
+}
+
+func TestShareNotes(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Trip", "content": "**pack** <script>x</script>"}, cookie))
+
+	type share struct {
+		Slug        string     `json:"slug"`
+		URL         string     `json:"url"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		HasPassword bool       `json:"has_password"`
+	}
+	rec := doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", nil, cookie)
+	open := decode[share](t, rec)
+	if rec.Code != http.StatusCreated || open.URL != "/share/"+open.Slug || len(open.Slug) < 20 || open.HasPassword {
+		t.Fatalf("share: status %d, %+v", rec.Code, open)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, open.URL, nil)
+	if got := decode[map[string]any](t, rec); rec.Code != http.StatusOK || got["title"] != "Trip" || !strings.Contains(got["html"].(string), "<strong>pack</strong>") {
+		t.Fatalf("get share: status %d, %v", rec.Code, got)
+	}
+	if rec.Header().Get("X-Robots-Tag") == "" || rec.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("share headers = %v", rec.Header())
+	}
+	rec = doRequest(t, s, http.MethodGet, open.URL+"?format=html", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "<title>Trip</title>") || strings.Contains(body, "<script>") {
+		t.Fatalf("share page: status %d, %s", rec.Code, body)
+	}
+
+	// Sharing again replaces the link.
+	expires := fake.Now().Add(time.Hour)
+	rec = doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", map[string]any{"password": "s3cret", "expires_at": expires}, cookie)
+	locked := decode[share](t, rec)
+	if rec.Code != http.StatusCreated || !locked.HasPassword || locked.ExpiresAt == nil || !locked.ExpiresAt.Equal(expires) {
+		t.Fatalf("reshare: status %d, %+v", rec.Code, locked)
+	}
+	if rec := doRequest(t, s, http.MethodGet, open.URL, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("replaced share: status %d", rec.Code)
+	}
+	for _, tc := range []struct {
+		method string
+		body   any
+		want   int
+	}{
+		{http.MethodGet, nil, http.StatusUnauthorized},
+		{http.MethodPost, map[string]string{"password": "guess"}, http.StatusUnauthorized},
+		{http.MethodPost, map[string]string{"password": "s3cret"}, http.StatusOK},
+	} {
+		if rec := doRequest(t, s, tc.method, locked.URL, tc.body); rec.Code != tc.want {
+			t.Errorf("%s locked share with %v: status %d, want %d", tc.method, tc.body, rec.Code, tc.want)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, locked.URL, nil)
+	req.Header.Set("Accept", "text/html")
+	page := httptest.NewRecorder()
+	s.Handler().ServeHTTP(page, req)
+	if page.Code != http.StatusUnauthorized || !strings.Contains(page.Body.String(), `type="password"`) {
+		t.Errorf("locked share page: status %d, %s", page.Code, page.Body)
+	}
+
+	fake.Advance(time.Hour)
+	if rec := doRequest(t, s, http.MethodPost, locked.URL, map[string]string{"password": "s3cret"}); rec.Code != http.StatusNotFound {
+		t.Errorf("expired share: status %d", rec.Code)
+	}
+	cookie = login(t, s)
+
+	rec = doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", map[string]any{"expires_at": fake.Now()}, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("share expiring now: status %d", rec.Code)
+	}
+	again := decode[share](t, doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", nil, cookie))
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("trash: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, again.URL, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("share of trashed note: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("share trashed note: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String()+"/share", nil, cookie); rec.Code != http.StatusNoContent {
+		t.Errorf("unshare: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String()+"/share", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("unshare twice: status %d", rec.Code)
+	}
+}
+
+func TestNoteErrors(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	cases := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/notes/not-a-uuid", http.StatusBadRequest},
+		{http.MethodGet, "/notes/00000000-0000-0000-0000-000000000001", http.StatusNotFound},
+		{http.MethodDelete, "/notes/00000000-0000-0000-0000-000000000001", http.StatusNotFound},
+		{http.MethodGet, "/notes?favorite=maybe", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		rec := doRequest(t, s, tc.method, tc.path, nil, cookie)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s status = %d, want %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/notes", bytes.NewBufferString("{"))
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid json status = %d, want 400", rec.Code)
+	}
+}
+
+type estimatingStore struct {
+	*memory.Store
+	estimate int
+}
+
+func (s estimatingStore) EstimateNotes(context.Context, store.NoteFilter) (int, error) {
+	return s.estimate, nil
+}
+
+func TestListNotesEstimatedTotal(t *testing.T) {
+	cfg := config.Config{
+		AppPassword:         testPassword,
+		SessionCookieName:   "notes_session",
+		SessionTTL:          time.Hour,
+		EstimateTotalsAbove: 1000,
+	}
+	type listResponse struct {
+		Total           int  `json:"total"`
+		TotalIsEstimate bool `json:"total_is_estimate"`
+	}
+
+	for _, tc := range []struct {
+		estimate  int
+		wantTotal int
+		estimated bool
+	}{
+		{estimate: 250000, wantTotal: 250000, estimated: true},
+		{estimate: 999, wantTotal: 1, estimated: false},
+		{estimate: -1, wantTotal: 1, estimated: false},
+	} {
+		s := NewWithStore(cfg, estimatingStore{Store: memory.New(), estimate: tc.estimate})
+		cookie := login(t, s)
+		doRequest(t, s, http.MethodPost, "/notes", map[string]string{"title": "a"}, cookie)
+
+		got := decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes", nil, cookie))
+		if got.Total != tc.wantTotal || got.TotalIsEstimate != tc.estimated {
+			t.Errorf("estimate %d: got %+v", tc.estimate, got)
+		}
+	}
+}
+
+// countingStore counts the reads the response cache saves.
+type countingStore struct {
+	*memory.Store
+	reads *int
+}
+
+func (s countingStore) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	*s.reads++
+	return s.Store.ListNotes(ctx, filter)
+}
+
+func (s countingStore) ListTags(ctx context.Context) ([]store.TagCount, error) {
+	*s.reads++
+	return s.Store.ListTags(ctx)
+}
+
+func TestResponseCache(t *testing.T) {
+	cfg := config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour, CacheTTL: time.Minute}
+	var reads int
+	s := NewWithStore(cfg, countingStore{Store: memory.New(), reads: &reads})
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a", "tags": []string{"x"}}, cookie)
+
+	get := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("GET %s: status %d, %s", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		return rec.Body.String()
+	}
+	for _, path := range []string{"/notes", "/notes?cursor=", "/tags", "/notes?render=html"} {
+		reads = 0
+		first := get(path)
+		if second := get(path); second != first || reads != 1 {
+			t.Errorf("%s: read %d times, second answer %s, first %s", path, reads, second, first)
+		}
+	}
+
+	reads = 0
+	get("/notes?page=2")
+	get("/notes?page=2")
+	if reads != 2 {
+		t.Errorf("later pages read %d times, want uncached", reads)
+	}
+
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "b", "tags": []string{"y"}}, cookie)
+	if body := get("/notes"); !strings.Contains(body, `"title":"b"`) {
+		t.Errorf("listing after a write = %s", body)
+	}
+	if body := get("/tags"); !strings.Contains(body, `"name":"y"`) {
+		t.Errorf("tags after a write = %s", body)
+	}
+
+	reads = 0
+	fake.Advance(time.Minute)
+	get("/tags")
+	if reads != 1 {
+		t.Errorf("tags read %d times after the time to live, want 1", reads)
+	}
+}
+
+func TestUnicodeSearchAndTags(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	// Decomposed "Café" (e + combining acute) and composed "Été".
+	rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "Café notes", "tags": []string{"Été"},
+	}, cookie)
+	created := decode[store.Note](t, rec)
+	if created.Title != "Café notes" || created.Tags[0] != "été" {
+		t.Fatalf("stored %q %q, want NFC", created.Title, created.Tags)
+	}
+
+	type listResponse struct {
+		Total int `json:"total"`
+	}
+	for _, path := range []string{
+		"/notes?query=cafe",
+		"/notes?query=CAF%C3%89",
+		"/notes?query=cafe%CC%81",
+		"/notes?tag=e%CC%81te%CC%81",
+		"/notes?tag=%C3%89T%C3%89",
+	} {
+		if got := decode[listResponse](t, doRequest(t, s, http.MethodGet, path, nil, cookie)); got.Total != 1 {
+			t.Errorf("%s matched %d notes, want 1", path, got.Total)
+		}
+	}
+}
+
+func TestSearchBackend(t *testing.T) {
+	cfg := config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour, SearchBackend: "embedded"}
+	s := NewWithStore(cfg, memory.New())
+	t.Cleanup(s.Close)
+	cookie := login(t, s)
+
+	ids := map[string]uuid.UUID{}
+	for _, n := range []struct{ title, content string }{
+		{"Monday", "Pick up the plans for the garden"},
+		{"Garden plans", "Tomatoes and beans"},
+		{"Groceries", "Beans, rice"},
+		{"Secret garden", "Where the key is"},
+	} {
+		created := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": n.title, "content": n.content}, cookie))
+		ids[n.title] = created.ID
+	}
+	titles := func(path string) []string {
+		t.Helper()
+		var out []string
+		for _, n := range decode[struct{ Items []store.Note }](t, doRequest(t, s, http.MethodGet, path, nil, cookie)).Items {
+			out = append(out, n.Title)
+		}
+		return out
+	}
+	if got := titles("/notes?query=garden+plans"); !slices.Equal(got, []string{"Garden plans", "Monday"}) {
+		t.Fatalf("search = %q, want the title match first", got)
+	}
+	doRequest(t, s, http.MethodPost, "/notes/"+ids["Monday"].String()+"/pin", map[string]bool{"value": true}, cookie)
+	if got := titles("/notes?query=garden+plans"); !slices.Equal(got, []string{"Monday", "Garden plans"}) {
+		t.Fatalf("search = %q, want the pinned note first", got)
+	}
+	if got := titles("/notes?query=garden+plans&limit=1&page=2"); !slices.Equal(got, []string{"Garden plans"}) {
+		t.Fatalf("second page = %q", got)
+	}
+	if got := titles("/notes?query=garden&sort=title"); !slices.Equal(got, []string{"Monday", "Garden plans", "Secret garden"}) {
+		t.Fatalf("sorted search = %q", got)
+	}
+
+	// Locked notes are found by their titles only, and deleted notes not at
+	// all but in the trash.
+	doRequest(t, s, http.MethodPost, "/notes/"+ids["Secret garden"].String()+"/lock", map[string]string{"passphrase": "open sesame"}, cookie)
+	if got := titles("/notes?query=key"); len(got) != 0 {
+		t.Fatalf("search for locked content = %q", got)
+	}
+	if got := titles("/notes?query=secret"); !slices.Equal(got, []string{"Secret garden"}) {
+		t.Fatalf("search for a locked title = %q", got)
+	}
+	doRequest(t, s, http.MethodDelete, "/notes/"+ids["Groceries"].String(), nil, cookie)
+	if got := titles("/notes?query=beans"); !slices.Equal(got, []string{"Garden plans"}) {
+		t.Fatalf("search after a delete = %q", got)
+	}
+	if got := titles("/notes/trash?query=beans"); !slices.Equal(got, []string{"Groceries"}) {
+		t.Fatalf("trash search = %q", got)
+	}
+	doRequest(t, s, http.MethodDelete, "/notes/"+ids["Garden plans"].String()+"/purge", nil, cookie)
+	if got := titles("/notes?query=beans"); len(got) != 0 {
+		t.Fatalf("search after a purge = %q", got)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	for _, backend := range []string{"", "embedded"} {
+		cfg := config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour, SearchBackend: backend}
+		s := NewWithStore(cfg, memory.New())
+		t.Cleanup(s.Close)
+		cookie := login(t, s)
+		for _, n := range []map[string]any{
+			{"title": "Garden plans", "tags": []string{"garden", "home"}},
+			{"title": "Gardening books", "tags": []string{"garden", "reading"}},
+			{"title": "Monday", "content": "Water the garden", "tags": []string{"gardening"}},
+		} {
+			doRequest(t, s, http.MethodPost, "/notes", n, cookie)
+		}
+		titles := func(path string) []string {
+			t.Helper()
+			var out []string
+			for _, n := range decode[struct{ Items []store.Note }](t, doRequest(t, s, http.MethodGet, path, nil, cookie)).Items {
+				out = append(out, n.Title)
+			}
+			slices.Sort(out)
+			return out
+		}
+		// One letter added, removed or replaced is forgiven; a short word
+		// must be spelled right.
+		for _, typo := range []string{"gardan", "gaarden", "gardn"} {
+			if got := titles("/notes?query=" + typo); !slices.Equal(got, []string{"Garden plans", "Gardening books", "Monday"}) {
+				t.Errorf("%s: search for %q = %q", backend, typo, got)
+			}
+		}
+		for _, miss := range []string{"gurdan", "mpn"} {
+			if got := titles("/notes?query=" + miss); len(got) != 0 {
+				t.Errorf("%s: search for %q = %q", backend, miss, got)
+			}
+		}
+
+		got := decode[suggestions](t, doRequest(t, s, http.MethodGet, "/search/suggest?q=Gard&limit=5", nil, cookie))
+		var suggested []string
+		for _, title := range got.Titles {
+			suggested = append(suggested, title.Title)
+		}
+		slices.Sort(suggested)
+		if !slices.Equal(suggested, []string{"Garden plans", "Gardening books"}) {
+			t.Errorf("%s: suggested titles = %q", backend, suggested)
+		}
+		if len(got.Tags) != 2 || got.Tags[0] != (store.TagCount{Name: "garden", Count: 2}) || got.Tags[1].Name != "gardening" {
+			t.Errorf("%s: suggested tags = %+v", backend, got.Tags)
+		}
+		if got := decode[suggestions](t, doRequest(t, s, http.MethodGet, "/search/suggest?q=gardening+bokks", nil, cookie)); len(got.Titles) != 1 || got.Titles[0].Title != "Gardening books" {
+			t.Errorf("%s: suggestions with a typo = %+v", backend, got.Titles)
+		}
+		if got := decode[suggestions](t, doRequest(t, s, http.MethodGet, "/search/suggest?q=+", nil, cookie)); got.Titles == nil || len(got.Titles) != 0 || len(got.Tags) != 0 {
+			t.Errorf("%s: suggestions for nothing = %+v", backend, got)
+		}
+	}
+}
+
+func TestQuerySyntax(t *testing.T) {
+	for _, backend := range []string{"memory", "embedded", "sqlite"} {
+		cfg := config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour}
+		var st store.Store = memory.New()
+		switch backend {
+		case "embedded":
+			cfg.SearchBackend = backend
+		case "sqlite":
+			cfg.DatabaseDriver, cfg.DatabaseURL = "sqlite", filepath.Join(t.TempDir(), "notes.db")
+			var err error
+			if st, _, err = openStore(context.Background(), cfg, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := NewWithStore(cfg, st)
+		t.Cleanup(s.Close)
+		cookie := login(t, s)
+		for _, n := range []map[string]any{
+			{"title": "Weekly meeting", "content": "Agenda for the exact phrase review", "tags": []string{"work"}},
+			{"title": "Meeting notes", "content": "Phrase exact, in the other order", "tags": []string{"work", "done"}},
+			{"title": "Groceries", "content": "Milk for the meeting", "tags": []string{"home", "to read"}},
+		} {
+			doRequest(t, s, http.MethodPost, "/notes", n, cookie)
+		}
+		titles := func(query string) []string {
+			t.Helper()
+			rec := doRequest(t, s, http.MethodGet, "/notes?query="+url.QueryEscape(query), nil, cookie)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: %s: status %d: %s", backend, query, rec.Code, rec.Body)
+			}
+			var out []string
+			for _, n := range decode[struct{ Items []store.Note }](t, rec).Items {
+				out = append(out, n.Title)
+			}
+			slices.Sort(out)
+			return out
+		}
+		for query, want := range map[string][]string{
+			`tag:work -tag:done`:           {"Weekly meeting"},
+			`"exact phrase"`:               {"Weekly meeting"},
+			`meeting -milk`:                {"Meeting notes", "Weekly meeting"},
+			`title:meeting`:                {"Meeting notes", "Weekly meeting"},
+			`title:meeting -title:weekly`:  {"Meeting notes"},
+			`tag:"to read" meeting`:        {"Groceries"},
+			`TAG:Work title:"meeting"`:     {"Meeting notes", "Weekly meeting"},
+			`after:2000-01-01 tag:home`:    {"Groceries"},
+			`before:2000-01-01`:            nil,
+			`is:favorite`:                  nil,
+			`-is:favorite tag:home`:        {"Groceries"},
+			`is:archived`:                  nil,
+			`https://example.com tag:work`: nil,
+		} {
+			if got := titles(query); !slices.Equal(got, want) {
+				t.Errorf("%s: %s = %q, want %q", backend, query, got, want)
+			}
+		}
+	}
+
+	s := newTestServer(t)
+	cookie := login(t, s)
+	for query, token := range map[string]queryToken{
+		`work nope:x`:        {Text: "nope:x", Offset: 5},
+		`tag:`:               {Text: "tag:", Offset: 0},
+		`é before:yesterday`: {Text: "before:yesterday", Offset: 2},
+		`-after:2024-01-01`:  {Text: "-after:2024-01-01", Offset: 0},
+		`is:pinned`:          {Text: "is:pinned", Offset: 0},
+		`title:"open ended`:  {Text: `title:"open ended`, Offset: 0},
+	} {
+		rec := doRequest(t, s, http.MethodGet, "/notes?query="+url.QueryEscape(query), nil, cookie)
+		got := decode[errorResponse](t, rec)
+		if rec.Code != http.StatusBadRequest || got.Code != codeInvalidQuery || got.Token == nil || *got.Token != token || len(got.Details) != 1 || got.Details[0].Field != "query" {
+			t.Errorf("%s: %d %+v, want the token %+v", query, rec.Code, got, token)
+		}
+	}
+	rec := doRequest(t, s, http.MethodPost, "/searches", map[string]any{"name": "Bad", "query": "tag:"}, cookie)
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusBadRequest || got.Code != codeInvalidQuery {
+		t.Errorf("saving a bad query: %d %+v", rec.Code, got)
+	}
+}
+
+func TestNoteLanguage(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.DefaultLanguage = "english"
+	cookie := login(t, s)
+
+	plain := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a"}, cookie))
+	if plain.Language != "english" {
+		t.Fatalf("default language = %q, want english", plain.Language)
+	}
+
+	russian := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "b", "language": " Russian ",
+	}, cookie))
+	if russian.Language != "russian" {
+		t.Fatalf("language = %q, want russian", russian.Language)
+	}
+
+	updated := decode[store.Note](t, putNote(t, s, "/notes/"+russian.ID.String(), map[string]any{"title": "b2"}, cookie))
+	if updated.Language != "russian" {
+		t.Fatalf("update without language changed it to %q", updated.Language)
+	}
+
+	rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "c", "language": "klingon"}, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCreatedDayUsesConfiguredZone(t *testing.T) {
+	s := newTestServer(t)
+	zone, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.TimeZone = zone
+	// 02:00 UTC on the 10th is still the evening of the 9th in Los Angeles.
+	fake := clock.NewFake(time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "evening"}, cookie)
+
+	type listResponse struct {
+		Total int `json:"total"`
+	}
+	for path, want := range map[string]int{
+		"/notes?created=today":      1,
+		"/notes?created=2026-03-09": 1,
+		"/notes?created=2026-03-10": 0,
+		"/notes?created=yesterday":  0,
+	} {
+		if got := decode[listResponse](t, doRequest(t, s, http.MethodGet, path, nil, cookie)); got.Total != want {
+			t.Errorf("%s matched %d notes, want %d", path, got.Total, want)
+		}
+	}
+
+	fake.Advance(24 * time.Hour)
+	cookie = login(t, s)
+	if got := decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes?created=yesterday", nil, cookie)); got.Total != 1 {
+		t.Errorf("yesterday matched %d notes a day later, want 1", got.Total)
+	}
+
+	if rec := doRequest(t, s, http.MethodGet, "/notes?created=last-week", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodGet, "/settings", nil, cookie)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "{}" {
+		t.Fatalf("initial settings = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = doRequest(t, s, http.MethodPut, "/settings", map[string]any{
+		"theme": "dark", "editor": map[string]any{"font_size": 14, "line_wrap": false},
+	}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save status = %d, body = %s", rec.Code, rec.Body)
+	}
+	rec = doRequest(t, s, http.MethodGet, "/settings", nil, cookie)
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"theme":"dark","editor":{"font_size":14,"line_wrap":false}}` {
+		t.Fatalf("stored settings = %s", got)
+	}
+
+	for _, body := range []any{
+		map[string]any{"theme": "neon"},
+		map[string]any{"colour": "red"},
+		map[string]any{"editor": map[string]any{"font_size": 200}},
+		map[string]any{"default_notebook": "inbox"},
+		map[string]any{"theme": strings.Repeat("x", maxSettingsBytes)},
+	} {
+		if rec := doRequest(t, s, http.MethodPut, "/settings", body, cookie); rec.Code < 400 || rec.Code >= 500 {
+			t.Errorf("PUT %v: status = %d, want 4xx", body, rec.Code)
+		}
+	}
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.TrashRetention = 7 * 24 * time.Hour
+	fake := clock.NewFake(time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "oops"}, cookie))
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("trashed note status = %d, want 404", rec.Code)
+	}
+
+	type listResponse struct {
+		Items []store.Note `json:"items"`
+		Total int          `json:"total"`
+	}
+	trash := decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes/trash", nil, cookie))
+	if trash.Total != 1 || trash.Items[0].DeletedAt == nil {
+		t.Fatalf("trash = %+v", trash)
+	}
+
+	restored := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/restore", nil, cookie))
+	if restored.DeletedAt != nil || restored.Title != "oops" {
+		t.Fatalf("restored = %+v", restored)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/restore", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("restoring a live note: status = %d, want 404", rec.Code)
+	}
+
+	doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String(), nil, cookie)
+	fake.Advance(6 * 24 * time.Hour)
+	s.purgeTrash(context.Background())
+	cookie = login(t, s)
+	if got := decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes/trash", nil, cookie)); got.Total != 1 {
+		t.Fatalf("purged before retention ran out")
+	}
+	fake.Advance(2 * 24 * time.Hour)
+	s.purgeTrash(context.Background())
+	cookie = login(t, s)
+	if got := decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes/trash", nil, cookie)); got.Total != 0 {
+		t.Fatalf("trash still holds %d notes after retention", got.Total)
+	}
+
+	live := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "gone"}, cookie))
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+live.ID.String()+"/purge", nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("purge status = %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+live.ID.String()+"/purge", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("second purge status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 2
+	cookie := login(t, s)
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "v1", "content": "one"}, cookie))
+	path := "/notes/" + n.ID.String()
+	for _, title := range []string{"v2", "v3", "v4"} {
+		putNote(t, s, path, map[string]any{"title": title, "content": title}, cookie)
+	}
+	// Favoriting and saving unchanged content add nothing.
+	doRequest(t, s, http.MethodPost, path+"/favorite", map[string]any{"value": true}, cookie)
+	putNote(t, s, path, map[string]any{"title": "v4", "content": "v4", "is_favorite": true}, cookie)
+
+	type revisionList struct {
+		Items []struct {
+			Rev   int    `json:"rev"`
+			Title string `json:"title"`
+		} `json:"items"`
+	}
+	list := decode[revisionList](t, doRequest(t, s, http.MethodGet, path+"/revisions", nil, cookie))
+	if len(list.Items) != 2 || list.Items[0].Rev != 3 || list.Items[0].Title != "v3" || list.Items[1].Rev != 2 {
+		t.Fatalf("revisions = %+v, want revs 3 and 2", list.Items)
+	}
+	if rec := doRequest(t, s, http.MethodGet, path+"/revisions/1", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("pruned revision status = %d, want 404", rec.Code)
+	}
+	rev := decode[store.Revision](t, doRequest(t, s, http.MethodGet, path+"/revisions/2", nil, cookie))
+	if rev.Content != "v2" {
+		t.Fatalf("revision 2 content = %q", rev.Content)
+	}
+
+	reverted := decode[store.Note](t, doRequest(t, s, http.MethodPost, path+"/revisions/2/revert", nil, cookie))
+	if reverted.Title != "v2" || reverted.Content != "v2" || !reverted.IsFavorite {
+		t.Fatalf("reverted = %+v", reverted)
+	}
+	list = decode[revisionList](t, doRequest(t, s, http.MethodGet, path+"/revisions", nil, cookie))
+	if list.Items[0].Title != "v4" {
+		t.Fatalf("revert did not save the replaced version: %+v", list.Items)
+	}
+
+	if rec := doRequest(t, s, http.MethodGet, path+"/revisions/abc", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad rev status = %d, want 400", rec.Code)
+	}
+}
+
+func TestRevisionDiff(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 10
+	cookie := login(t, s)
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "Plan", "content": "# Plan\n\n- eggs\n- milk\n", "tags": []string{"home"},
+	}, cookie))
+	path := "/notes/" + n.ID.String()
+	putNote(t, s, path, map[string]any{"title": "Plan", "content": "# Plan\n\n- eggs\n- oat milk\n", "tags": []string{"home"}}, cookie)
+	putNote(t, s, path, map[string]any{"title": "Shopping", "content": "# Plan\n\n- eggs\n- oat milk\n- bread\n", "tags": []string{"errands"}}, cookie)
+
+	got := decode[revisionDiff](t, doRequest(t, s, http.MethodGet, path+"/revisions/1/diff/current?context=1", nil, cookie))
+	if got.From != 1 || got.To != 0 || got.Title == nil || got.Title.To != "Shopping" || got.Removed != 1 || got.Added != 2 {
+		t.Fatalf("diff = %+v", got)
+	}
+	if !slices.Equal(got.TagsAdded, []string{"errands"}) || !slices.Equal(got.TagsRemoved, []string{"home"}) {
+		t.Fatalf("tags added %v, removed %v", got.TagsAdded, got.TagsRemoved)
+	}
+	if len(got.Hunks) != 1 || got.Hunks[0].OldStart != 3 || len(got.Hunks[0].Lines) != 4 {
+		t.Fatalf("hunks = %+v", got.Hunks)
+	}
+
+	rec := doRequest(t, s, http.MethodGet, path+"/revisions/1/diff/2?format=unified", nil, cookie)
+	want := "--- revision 1\n+++ revision 2\n@@ -1,4 +1,4 @@\n # Plan\n \n - eggs\n-- milk\n+- oat milk\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/x-diff") {
+		t.Fatalf("unified diff: status %d\n%s", rec.Code, rec.Body)
+	}
+	if same := decode[revisionDiff](t, doRequest(t, s, http.MethodGet, path+"/revisions/2/diff/2", nil, cookie)); len(same.Hunks) != 0 || same.Title != nil {
+		t.Fatalf("diff with itself = %+v", same)
+	}
+
+	for query, want := range map[string]int{
+		"/revisions/1/diff/9":              http.StatusNotFound,
+		"/revisions/1/diff/latest":         http.StatusBadRequest,
+		"/revisions/1/diff/2?format=html":  http.StatusBadRequest,
+		"/revisions/1/diff/2?context=1000": http.StatusBadRequest,
+	} {
+		if rec := doRequest(t, s, http.MethodGet, path+query, nil, cookie); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, want)
+		}
+	}
+}
+
+func TestNotebooks(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	create := func(body map[string]any) store.Notebook {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodPost, "/notebooks", body, cookie)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create notebook %v: status = %d, body = %s", body, rec.Code, rec.Body)
+		}
+		return decode[store.Notebook](t, rec)
+	}
+	work := create(map[string]any{"name": "Work"})
+	projects := create(map[string]any{"name": "Projects", "parent_id": work.ID})
+	inbox := create(map[string]any{"name": "Inbox"})
+
+	if rec := doRequest(t, s, http.MethodPut, "/notebooks/"+work.ID.String(), map[string]any{"name": "Work", "parent_id": projects.ID}, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("nesting a notebook in its child: status = %d, want 400", rec.Code)
+	}
+	for _, body := range []map[string]any{{"name": " "}, {"name": "x", "parent_id": uuid.New()}} {
+		if rec := doRequest(t, s, http.MethodPost, "/notebooks", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %v: status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	filed := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "plan", "notebook_id": projects.ID}, cookie))
+	loose := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "loose"}, cookie))
+	if filed.NotebookID == nil || *filed.NotebookID != projects.ID || loose.NotebookID != nil {
+		t.Fatalf("notebooks of created notes = %v, %v", filed.NotebookID, loose.NotebookID)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "x", "notebook_id": uuid.New()}, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("note in a missing notebook: status = %d, want 400", rec.Code)
+	}
+
+	// An update without notebook_id leaves the note where it is.
+	kept := decode[store.Note](t, putNote(t, s, "/notes/"+filed.ID.String(), map[string]any{"title": "plan v2"}, cookie))
+	if kept.NotebookID == nil || *kept.NotebookID != projects.ID {
+		t.Fatalf("notebook after update = %v, want %s", kept.NotebookID, projects.ID)
+	}
+
+	type listResponse struct {
+		Items []store.Note `json:"items"`
+		Total int          `json:"total"`
+	}
+	list := func(notebook string) listResponse {
+		t.Helper()
+		return decode[listResponse](t, doRequest(t, s, http.MethodGet, "/notes?notebook="+notebook, nil, cookie))
+	}
+	if got := list(projects.ID.String()); got.Total != 1 || got.Items[0].ID != filed.ID {
+		t.Fatalf("notes in projects = %+v", got)
+	}
+	if got := list(work.ID.String()); got.Total != 0 {
+		t.Fatalf("work lists %d notes of its nested notebook", got.Total)
+	}
+	if got := list("none"); got.Total != 1 || got.Items[0].ID != loose.ID {
+		t.Fatalf("notes in no notebook = %+v", got)
+	}
+
+	// Deleting work takes projects with it and moves the note to the
+	// default notebook.
+	doRequest(t, s, http.MethodPut, "/settings", map[string]any{"default_notebook": inbox.ID.String()}, cookie)
+	if rec := doRequest(t, s, http.MethodDelete, "/notebooks/"+work.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notebooks/"+projects.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("nested notebook status = %d, want 404", rec.Code)
+	}
+	if got := list(inbox.ID.String()); got.Total != 1 || got.Items[0].ID != filed.ID {
+		t.Fatalf("notes in inbox = %+v", got)
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/notebooks/"+inbox.ID.String()+"?notes=delete", nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete with notes status = %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+filed.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("note of a deleted notebook status = %d, want 404", rec.Code)
+	}
+	restored := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes/"+filed.ID.String()+"/restore", nil, cookie))
+	if restored.NotebookID != nil {
+		t.Fatalf("restored note is in notebook %s", restored.NotebookID)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	a := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a", "tags": []string{"work", "todo", "a/b"}}, cookie))
+	b := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "b", "tags": []string{"todo", "job"}}, cookie))
+	c := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "c", "tags": []string{"work"}}, cookie))
+	doRequest(t, s, http.MethodDelete, "/notes/"+c.ID.String(), nil, cookie)
+
+	type tagList struct {
+		Items []store.TagCount `json:"items"`
+	}
+	tags := decode[tagList](t, doRequest(t, s, http.MethodGet, "/tags", nil, cookie)).Items
+	want := []store.TagCount{{Name: "todo", Count: 2}, {Name: "a/b", Count: 1}, {Name: "job", Count: 1}, {Name: "work", Count: 1}}
+	if fmt.Sprint(tags) != fmt.Sprint(want) {
+		t.Fatalf("tags = %v, want %v", tags, want)
+	}
+
+	rec := doRequest(t, s, http.MethodPost, "/tags/rename", map[string]string{"from": "Work", "to": "Office"}, cookie)
+	if rec.Code != http.StatusOK || decode[map[string]int](t, rec)["updated"] != 2 {
+		t.Fatalf("rename = %d %s, want 2 notes, the trashed one included", rec.Code, rec.Body)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/tags/rename", map[string]string{"from": "nope", "to": "x"}, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("rename of an unused tag = %d, want 404", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/tags/merge", map[string]any{"from": []string{"job", "office"}, "to": "todo"}, cookie)
+	if rec.Code != http.StatusOK || decode[map[string]int](t, rec)["updated"] != 3 {
+		t.Fatalf("merge = %d %s", rec.Code, rec.Body)
+	}
+	got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+a.ID.String(), nil, cookie))
+	if fmt.Sprint(got.Tags) != "[todo a/b]" || got.Version != a.Version+2 {
+		t.Fatalf("a after merge = %v version %d", got.Tags, got.Version)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/tags/merge", map[string]any{"from": []string{"todo"}, "to": "todo"}, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("merge into itself = %d, want 400", rec.Code)
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/tags/a%2Fb", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("delete a/b = %d %s", rec.Code, rec.Body)
+	}
+	got = decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+b.ID.String(), nil, cookie))
+	if fmt.Sprint(got.Tags) != "[todo]" {
+		t.Fatalf("b tags = %v", got.Tags)
+	}
+	tags = decode[tagList](t, doRequest(t, s, http.MethodGet, "/tags", nil, cookie)).Items
+	if fmt.Sprint(tags) != "[{todo 2}]" {
+		t.Fatalf("tags after delete = %v", tags)
+	}
+}
+
+func TestBulkNotes(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Archive"}, cookie))
+	a := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a", "tags": []string{"old", "keep"}}, cookie))
+	b := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "b"}, cookie))
+	missing := uuid.New()
+
+	rec := doRequest(t, s, http.MethodPost, "/notes/bulk", map[string]any{"operations": []map[string]any{
+		{"action": "tag", "id": a.ID, "tags": []string{"New", "keep"}},
+		{"action": "untag", "id": a.ID, "tags": []string{"old"}},
+		{"action": "favorite", "id": a.ID, "value": true},
+		{"action": "move", "id": a.ID, "notebook_id": nb.ID},
+		{"action": "delete", "id": b.ID},
+		{"action": "favorite", "id": b.ID, "value": true},
+		{"action": "delete", "id": missing},
+	}}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk status = %d, body = %s", rec.Code, rec.Body)
+	}
+	type result struct {
+		ID     uuid.UUID `json:"id"`
+		Status string    `json:"status"`
+	}
+	results := decode[struct {
+		Results []result `json:"results"`
+	}](t, rec).Results
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "ok,ok,ok,ok,ok,not_found,not_found" {
+		t.Fatalf("statuses = %s", got)
+	}
+
+	got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+a.ID.String(), nil, cookie))
+	if strings.Join(got.Tags, ",") != "keep,new" || !got.IsFavorite || got.NotebookID == nil || *got.NotebookID != nb.ID || got.Version != a.Version+4 {
+		t.Fatalf("note after bulk = %+v", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+b.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted note status = %d, want 404", rec.Code)
+	}
+
+	for _, op := range []map[string]any{
+		{"action": "archive", "id": a.ID},
+		{"action": "delete"},
+		{"action": "tag", "id": a.ID, "tags": []string{" "}},
+		{"action": "move", "id": a.ID, "notebook_id": uuid.New()},
+	} {
+		body := map[string]any{"operations": []map[string]any{{"action": "favorite", "id": a.ID, "value": false}, op}}
+		if rec := doRequest(t, s, http.MethodPost, "/notes/bulk", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("bulk %v: status = %d, want 400", op, rec.Code)
+		}
+	}
+	if got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+a.ID.String(), nil, cookie)); !got.IsFavorite {
+		t.Fatalf("a rejected request applied its valid operations")
+	}
+}
+
+func TestSync(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	sync := func(query string) syncResponse {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, "/sync"+query, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("sync%s status = %d, body = %s", query, rec.Code, rec.Body)
+		}
+		return decode[syncResponse](t, rec)
+	}
+	titles := func(notes []store.Note) string {
+		var got []string
+		for _, n := range notes {
+			got = append(got, n.Title)
+		}
+		slices.Sort(got)
+		return strings.Join(got, ",")
+	}
+
+	a := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "a"}, cookie))
+	b := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "b"}, cookie))
+	first := sync("")
+	if titles(first.Changed) != "a,b" || len(first.Deleted) != 0 || first.HasMore {
+		t.Fatalf("first sync = %+v", first)
+	}
+	if again := sync(fmt.Sprintf("?since=%d", first.Seq)); len(again.Changed)+len(again.Deleted) != 0 || again.Seq != first.Seq {
+		t.Fatalf("sync with nothing new = %+v", again)
+	}
+
+	// One bulk write counts both notes at once, so a page holds both even
+	// past its limit.
+	doRequest(t, s, http.MethodPost, "/notes/bulk", map[string]any{"operations": []map[string]any{
+		{"action": "favorite", "id": a.ID, "value": true},
+		{"action": "favorite", "id": b.ID, "value": true},
+	}}, cookie)
+	decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "c"}, cookie))
+	page := sync(fmt.Sprintf("?since=%d&limit=1", first.Seq))
+	if titles(page.Changed) != "a,b" || !page.HasMore || !page.Changed[0].IsFavorite {
+		t.Fatalf("first page = %+v", page)
+	}
+	page = sync(fmt.Sprintf("?since=%d&limit=1", page.Seq))
+	if titles(page.Changed) != "c" || page.HasMore {
+		t.Fatalf("second page = %+v", page)
+	}
+	c := page.Changed[0]
+
+	doRequest(t, s, http.MethodDelete, "/notes/"+a.ID.String(), nil, cookie)
+	doRequest(t, s, http.MethodDelete, "/notes/"+b.ID.String()+"/purge", nil, cookie)
+	deleted := sync(fmt.Sprintf("?since=%d", page.Seq))
+	if len(deleted.Changed) != 0 || len(deleted.Deleted) != 2 || !slices.Contains(deleted.Deleted, a.ID) || !slices.Contains(deleted.Deleted, b.ID) {
+		t.Fatalf("sync after deletes = %+v", deleted)
+	}
+
+	offline := uuid.New()
+	rec := doRequest(t, s, http.MethodPost, "/sync", map[string]any{"changes": []map[string]any{
+		{"id": offline, "title": "made offline", "content": "see [[c]]"},
+		{"id": c.ID, "base_version": c.Version, "title": "c", "content": "edited offline"},
+		{"id": c.ID, "base_version": c.Version, "title": "c", "content": "edited elsewhere"},
+		{"id": a.ID, "base_version": a.Version, "deleted": true},
+	}}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push status = %d, body = %s", rec.Code, rec.Body)
+	}
+	results := decode[syncPushResponse](t, rec).Results
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "applied,applied,conflict,not_found" {
+		t.Fatalf("statuses = %s", got)
+	}
+	if results[0].Note.ID != offline || results[0].Note.Version != 1 {
+		t.Fatalf("created = %+v", results[0].Note)
+	}
+	if conflict := results[2].Note; conflict.Content != "edited offline" || conflict.Version != c.Version+1 {
+		t.Fatalf("conflict note = %+v", conflict)
+	}
+	if backlinks := decode[itemList[store.Note]](t, doRequest(t, s, http.MethodGet, "/notes/"+c.ID.String()+"/backlinks", nil, cookie)); len(backlinks.Items) != 1 {
+		t.Fatalf("backlinks of c = %+v", backlinks)
+	}
+	if pushed := sync(fmt.Sprintf("?since=%d", deleted.Seq)); titles(pushed.Changed) != "c,made offline" {
+		t.Fatalf("sync after push = %+v", pushed)
+	}
+
+	// Creating a note under a trashed note's ID conflicts rather than
+	// replacing it.
+	rec = doRequest(t, s, http.MethodPost, "/sync", map[string]any{"changes": []map[string]any{
+		{"id": a.ID, "title": "made offline too"},
+	}}, cookie)
+	if got := decode[syncPushResponse](t, rec).Results; rec.Code != http.StatusOK || got[0].Status != "conflict" || got[0].Note.Title != "a" || got[0].Note.DeletedAt == nil {
+		t.Fatalf("create over a trashed note: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if trash := decode[itemList[store.Note]](t, doRequest(t, s, http.MethodGet, "/notes/trash", nil, cookie)); len(trash.Items) != 1 || trash.Items[0].Title != "a" {
+		t.Fatalf("trash after the create = %+v", trash)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/sync", map[string]any{"changes": []map[string]any{
+		{"id": c.ID, "deleted": true},
+	}}, cookie)
+	if body := decode[errorResponse](t, rec); rec.Code != http.StatusUnprocessableEntity || body.Details[0].Field != "changes[0].base_version" {
+		t.Fatalf("delete without base_version: status = %d, body = %+v", rec.Code, body)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/sync?since=-1", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative since status = %d", rec.Code)
+	}
+}
+
+func TestConflictStrategy(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 10
+	cookie := login(t, s)
+	// stale writes a note once, then again to the version it was created
+	// at, as a second client would.
+	stale := func(title string) (store.Note, *httptest.ResponseRecorder) {
+		t.Helper()
+		n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": "v1"}, cookie))
+		putNote(t, s, "/notes/"+n.ID.String(), map[string]any{"title": title, "content": "theirs"}, cookie)
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(map[string]any{"title": title, "content": "mine"})
+		req := httptest.NewRequest(http.MethodPut, "/notes/"+n.ID.String(), &buf)
+		req.Header.Set("If-Match", noteETag(n))
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return n, rec
+	}
+
+	s.cfg.ConflictStrategy = "reject"
+	if _, rec := stale("rejected"); rec.Code != http.StatusPreconditionFailed || decode[store.Note](t, rec).Content != "theirs" {
+		t.Fatalf("reject: status %d", rec.Code)
+	}
+
+	s.cfg.ConflictStrategy = "last-write-wins"
+	n, rec := stale("overwritten")
+	if rec.Code != http.StatusOK || rec.Header().Get("Conflict-Resolution") != "overwritten" {
+		t.Fatalf("last write wins: status %d, resolution %q", rec.Code, rec.Header().Get("Conflict-Resolution"))
+	}
+	if got := decode[store.Note](t, rec); got.Content != "mine" || got.Version != 3 {
+		t.Fatalf("last write wins saved %+v", got)
+	}
+	revs := decode[map[string][]revisionSummary](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/revisions", nil, cookie))
+	if len(revs["items"]) != 2 {
+		t.Fatalf("overwritten version not kept: %+v", revs)
+	}
+
+	s.cfg.ConflictStrategy = "fork"
+	n, rec = stale("forked")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Conflict-Resolution") != "forked" {
+		t.Fatalf("fork: status %d, resolution %q", rec.Code, rec.Header().Get("Conflict-Resolution"))
+	}
+	fork := decode[store.Note](t, rec)
+	if fork.ID == n.ID || fork.Title != "forked (conflicted copy)" || fork.Content != "mine" || rec.Header().Get("Location") != "/notes/"+fork.ID.String() {
+		t.Fatalf("fork = %+v", fork)
+	}
+	if got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String(), nil, cookie)); got.Content != "theirs" {
+		t.Fatalf("fork changed the note: %+v", got)
+	}
+
+	// Sync resolves alike, and deletes go ahead only when the last write
+	// wins.
+	results := func(changes ...map[string]any) []syncResult {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodPost, "/sync", map[string]any{"changes": changes}, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("push status = %d, body = %s", rec.Code, rec.Body)
+		}
+		return decode[syncPushResponse](t, rec).Results
+	}
+	got := results(
+		map[string]any{"id": n.ID, "base_version": 1, "title": "offline", "content": "edit"},
+		map[string]any{"id": n.ID, "base_version": 1, "deleted": true},
+	)
+	if got[0].Status != "forked" || got[0].Copy == nil || got[0].Copy.Title != "offline (conflicted copy)" || got[0].Note.Content != "theirs" {
+		t.Fatalf("fork on sync = %+v", got[0])
+	}
+	if got[1].Status != "conflict" {
+		t.Fatalf("stale delete with fork = %+v", got[1])
+	}
+	s.cfg.ConflictStrategy = "last-write-wins"
+	got = results(
+		map[string]any{"id": n.ID, "base_version": 1, "title": "offline", "content": "edit"},
+		map[string]any{"id": fork.ID, "base_version": 7, "deleted": true},
+	)
+	if got[0].Status != "overwritten" || got[0].Note.Content != "edit" || got[1].Status != "overwritten" {
+		t.Fatalf("last write wins on sync = %+v", got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+fork.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("stale delete with last write wins: get status %d", rec.Code)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	content := "# Plan\n\n- [x] **ship**\n\n<script>alert(1)</script> [x](javascript:alert(1))"
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "md", "content": content}, cookie))
+	want := "<h1>Plan</h1>\n<ul>\n<li><input type=\"checkbox\" checked disabled> <strong>ship</strong></li>\n</ul>\n<p>&lt;script&gt;alert(1)&lt;/script&gt; x</p>\n"
+
+	rec := doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/html", nil, cookie)
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("html status = %d, body = %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("content type = %q", ct)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "sandbox") {
+		t.Fatalf("content security policy = %q", csp)
+	}
+
+	if got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String(), nil, cookie)); got.HTML != "" {
+		t.Fatalf("html rendered without render=html: %q", got.HTML)
+	}
+	if got := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"?render=html", nil, cookie)); got.HTML != want {
+		t.Fatalf("get html = %q", got.HTML)
+	}
+	list := decode[struct {
+		Items []store.Note `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes?render=html", nil, cookie))
+	if len(list.Items) != 1 || list.Items[0].HTML != want {
+		t.Fatalf("list items = %+v", list.Items)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes?render=pdf", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("render=pdf status = %d, want 400", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+uuid.NewString()+"/html", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing note html status = %d, want 404", rec.Code)
+	}
+
+	hard := NewWithStore(config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour,
+		MarkdownRenderer: "commonmark", MarkdownHardWraps: true}, memory.New())
+	t.Cleanup(hard.Close)
+	if got := hard.markdown.Render("a\nb ~~c~~"); got != "<p>a<br>\nb ~~c~~</p>\n" {
+		t.Fatalf("commonmark with hard wraps = %q", got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Shopping", "content": "- milk"}, cookie)
+
+	rec := doRequest(t, s, http.MethodGet, "/export", nil, cookie)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export status = %d, content type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="notes-`) {
+		t.Fatalf("content disposition = %q", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "notes.json,Shopping.md" {
+		t.Fatalf("archive files = %s", got)
+	}
+
+	if rec := doRequest(t, s, http.MethodGet, "/export", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous export status = %d, want 401", rec.Code)
+	}
+}
+
+func postImport(t *testing.T, s *Server, query, contentType string, body []byte, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/import"+query, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImport(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	existing := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Groceries", "content": "- milk"}, cookie))
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	// In order: the copy has to come after the note it duplicates.
+	for _, entry := range [][2]string{
+		{"Groceries.md", "- milk"},
+		{"Work/Plan.md", "---\ntitle: \"Q3 plan\"\ntags: [Work, okr]\nfavorite: true\ncreated: 2024-03-01\n---\n\n# Goals\n"},
+		{"Work/Plan copy.md", "---\ntitle: Q3 plan\n---\n# Goals\n"},
+		{"__MACOSX/._Plan.md", "junk"},
+		{"Work/diagram.png", "not a note"},
+	} {
+		f, _ := zw.Create(entry[0])
+		f.Write([]byte(entry[1]))
+	}
+	zw.Close()
+
+	type result struct {
+		DryRun     bool `json:"dry_run"`
+		Created    int  `json:"created"`
+		Duplicates int  `json:"duplicates"`
+		Items      []struct {
+			Source      string     `json:"source"`
+			Status      string     `json:"status"`
+			ID          *uuid.UUID `json:"id"`
+			DuplicateOf *uuid.UUID `json:"duplicate_of"`
+		} `json:"items"`
+	}
+	rec := postImport(t, s, "?dry_run=true", "application/zip", archive.Bytes(), cookie)
+	if got := decode[result](t, rec); rec.Code != http.StatusOK || !got.DryRun || got.Created != 1 || got.Duplicates != 2 {
+		t.Fatalf("dry run status = %d, result = %+v", rec.Code, got)
+	}
+	if total := decode[struct{ Total int }](t, doRequest(t, s, http.MethodGet, "/notes", nil, cookie)).Total; total != 1 {
+		t.Fatalf("dry run wrote notes: total = %d", total)
+	}
+
+	rec = postImport(t, s, "", "", archive.Bytes(), cookie)
+	got := decode[result](t, rec)
+	if rec.Code != http.StatusOK || got.DryRun || got.Created != 1 || got.Duplicates != 2 {
+		t.Fatalf("import status = %d, result = %+v", rec.Code, got)
+	}
+	byStatus := make(map[string]int)
+	for _, item := range got.Items {
+		byStatus[item.Status]++
+		if item.Source == "Groceries.md" && (item.DuplicateOf == nil || *item.DuplicateOf != existing.ID) {
+			t.Fatalf("Groceries.md = %+v, want a duplicate of %s", item, existing.ID)
+		}
+	}
+	if byStatus["created"] != 1 || byStatus["duplicate"] != 2 {
+		t.Fatalf("items = %+v", got.Items)
+	}
+	list := decode[struct {
+		Items []store.Note `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes?tag=okr", nil, cookie))
+	if len(list.Items) != 1 {
+		t.Fatalf("imported notes tagged okr = %+v", list.Items)
+	}
+	if n := list.Items[0]; n.Title != "Q3 plan" || !n.IsFavorite || strings.Join(n.Tags, ",") != "work,okr" ||
+		n.Content != "# Goals\n" || !n.CreatedAt.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("imported note = %+v", n)
+	}
+
+	var dumped bytes.Buffer
+	dumpRec := doRequest(t, s, http.MethodGet, "/export", nil, cookie)
+	zr, _ := zip.NewReader(bytes.NewReader(dumpRec.Body.Bytes()), int64(dumpRec.Body.Len()))
+	manifest, _ := zr.Open("notes.json")
+	io.Copy(&dumped, manifest)
+	rec = postImport(t, s, "", "application/json", dumped.Bytes(), cookie)
+	if got := decode[result](t, rec); rec.Code != http.StatusOK || got.Created != 0 || got.Duplicates != 2 {
+		t.Fatalf("re-import of the export: status = %d, result = %+v", rec.Code, got)
+	}
+
+	rec = postImport(t, s, "?filename=Ideas.md", "text/markdown", []byte("just text"), cookie)
+	if got := decode[result](t, rec); rec.Code != http.StatusOK || got.Created != 1 {
+		t.Fatalf("markdown import: status = %d, result = %+v", rec.Code, got)
+	}
+
+	for _, bad := range []struct{ contentType, body string }{
+		{"application/json", `{"version": 99, "notes": []}`},
+		{"application/zip", "PK\x03\x04 not really"},
+		{"text/markdown", "---\nfavorite: maybe\n---\n"},
+		{"text/markdown", "\xff\xfe"},
+	} {
+		if rec := postImport(t, s, "", bad.contentType, []byte(bad.body), cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("import %q: status = %d, want 400", bad.body, rec.Code)
+		}
+	}
+}
+
+func uploadAttachment(t *testing.T, s *Server, noteID uuid.UUID, filename, content string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", "text/plain")
+	if strings.HasSuffix(filename, ".pdf") {
+		header.Set("Content-Type", "application/pdf")
+	}
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/notes/"+noteID.String()+"/attachments", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAttachments(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	blobs, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	s.cfg.MaxAttachmentBytes = 1 << 10
+	cookie := login(t, s)
+
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "trip"}, cookie))
+	rec := uploadAttachment(t, s, n.ID, `C:\tickets\рейс.txt`, "SU 1234", cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d, body = %s", rec.Code, rec.Body)
+	}
+	a := decode[store.Attachment](t, rec)
+	if a.NoteID != n.ID || a.Filename != "рейс.txt" || a.Size != 7 || a.ContentType != "text/plain" {
+		t.Fatalf("attachment = %+v", a)
+	}
+
+	list := decode[struct {
+		Items []store.Attachment `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/attachments", nil, cookie))
+	if len(list.Items) != 1 || list.Items[0].ID != a.ID {
+		t.Fatalf("attachments = %+v", list.Items)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/attachments/"+a.ID.String(), nil, cookie)
+	if rec.Code != http.StatusOK || rec.Body.String() != "SU 1234" {
+		t.Fatalf("download = %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+
+	if rec := uploadAttachment(t, s, n.ID, "big.bin", strings.Repeat("x", 2<<10), cookie); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload status = %d, want 413", rec.Code)
+	}
+	if rec := uploadAttachment(t, s, uuid.New(), "a.txt", "x", cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("upload to missing note status = %d, want 404", rec.Code)
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/attachments/"+a.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/attachments/"+a.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted attachment status = %d, want 404", rec.Code)
+	}
+
+	kept := decode[store.Attachment](t, uploadAttachment(t, s, n.ID, "kept.txt", "until purge", cookie))
+	doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String()+"/purge", nil, cookie)
+	if rec := doRequest(t, s, http.MethodGet, "/attachments/"+kept.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("attachment of purged note status = %d, want 404", rec.Code)
+	}
+	s.deleteDetachedAttachments(context.Background())
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("blobs left after purge: %v", entries)
+	}
+}
+
+func TestAttachmentSearch(t *testing.T) {
+	const report = "%PDF-1.4\n1 0 obj\n<< /Length 39 >>\nstream\nBT (Quarterly revenue) Tj ( grew) Tj ET\nendstream\nendobj\n%%EOF\n"
+	for _, backend := range []string{"memory", "embedded", "sqlite"} {
+		cfg := config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour, MaxAttachmentBytes: 1 << 20}
+		var st store.Store = memory.New()
+		switch backend {
+		case "embedded":
+			cfg.SearchBackend = backend
+		case "sqlite":
+			cfg.DatabaseDriver, cfg.DatabaseURL = "sqlite", filepath.Join(t.TempDir(), "notes.db")
+			var err error
+			if st, _, err = openStore(context.Background(), cfg, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := NewWithStore(cfg, st)
+		t.Cleanup(s.Close)
+		blobs, err := storage.NewLocal(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.blobs = blobs
+		cookie := login(t, s)
+
+		trip := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Trip"}, cookie))
+		budget := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Budget", "content": "Revenue forecast"}, cookie))
+		tickets := decode[store.Attachment](t, uploadAttachment(t, s, trip.ID, "tickets.txt", "Flight SU 1234 to Oslo,\n  departing at dawn", cookie))
+		pdf := decode[store.Attachment](t, uploadAttachment(t, s, budget.ID, "report.pdf", report, cookie))
+
+		type page struct {
+			Items   []store.Note
+			Matches []attachmentMatch
+		}
+		search := func(query string) page {
+			t.Helper()
+			rec := doRequest(t, s, http.MethodGet, "/notes?"+query, nil, cookie)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: %s: status %d: %s", backend, query, rec.Code, rec.Body)
+			}
+			return decode[page](t, rec)
+		}
+		got := search("query=oslo")
+		if len(got.Items) != 0 || len(got.Matches) != 1 || got.Matches[0].ID != tickets.ID || got.Matches[0].NoteID != trip.ID ||
+			got.Matches[0].Snippet != "Flight SU 1234 to <mark>Oslo</mark>, departing at dawn" {
+			t.Errorf("%s: search oslo = %+v", backend, got)
+		}
+		got = search("query=revenue")
+		if len(got.Items) != 1 || got.Items[0].ID != budget.ID || len(got.Matches) != 1 || got.Matches[0].ID != pdf.ID ||
+			got.Matches[0].Snippet != "Quarterly <mark>revenue</mark> grew" {
+			t.Errorf("%s: search revenue = %+v", backend, got)
+		}
+		if got := search("query=tickets"); len(got.Matches) != 1 || got.Matches[0].Snippet != "Flight SU 1234 to Oslo, departing at dawn" {
+			t.Errorf("%s: search by filename = %+v", backend, got.Matches)
+		}
+		for _, query := range []string{"query=revenue&page=2", "query=title:revenue", "query=oslo+-dawn", "tag=oslo"} {
+			if got := search(query); len(got.Matches) != 0 {
+				t.Errorf("%s: %s matches = %+v", backend, query, got.Matches)
+			}
+		}
+
+		doRequest(t, s, http.MethodDelete, "/notes/"+budget.ID.String(), nil, cookie)
+		doRequest(t, s, http.MethodDelete, "/attachments/"+tickets.ID.String(), nil, cookie)
+		for _, query := range []string{"revenue", "oslo"} {
+			if got := search("query=" + query); len(got.Matches) != 0 {
+				t.Errorf("%s: %s matches after deletes = %+v", backend, query, got.Matches)
+			}
+		}
+	}
+}
+
+func TestDuplicateNote(t *testing.T) {
+	s := newTestServer(t)
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	s.cfg.MaxAttachmentBytes = 1 << 10
+	cookie := login(t, s)
+
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]string{"name": "work"}, cookie))
+	other := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]string{"name": "home"}, cookie))
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "plan", "tags": []string{"q3"}, "is_favorite": true, "notebook_id": nb.ID,
+	}, cookie))
+	a := decode[store.Attachment](t, uploadAttachment(t, s, n.ID, "a.txt", "attached", cookie))
+	rec := putNote(t, s, "/notes/"+n.ID.String(), map[string]any{
+		"title": "plan", "content": "see [a](/attachments/" + a.ID.String() + ")", "tags": []string{"q3"}, "is_favorite": true,
+	}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/duplicate", nil, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("duplicate: status %d: %s", rec.Code, rec.Body)
+	}
+	dup := decode[store.Note](t, rec)
+	if dup.ID == n.ID || dup.Title != "plan (copy)" || dup.IsFavorite || dup.Version != 1 ||
+		strings.Join(dup.Tags, ",") != "q3" || dup.NotebookID == nil || *dup.NotebookID != nb.ID {
+		t.Fatalf("duplicate = %+v", dup)
+	}
+	copies := decode[struct {
+		Items []store.Attachment `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes/"+dup.ID.String()+"/attachments", nil, cookie)).Items
+	if len(copies) != 1 || copies[0].ID == a.ID || copies[0].Filename != "a.txt" {
+		t.Fatalf("copied attachments = %+v", copies)
+	}
+	if want := "see [a](/attachments/" + copies[0].ID.String() + ")"; dup.Content != want {
+		t.Errorf("content = %q, want %q", dup.Content, want)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/attachments/"+copies[0].ID.String(), nil, cookie); rec.Body.String() != "attached" {
+		t.Errorf("copied attachment = %d %q", rec.Code, rec.Body)
+	}
+	revisions := decode[struct{ Items []store.Revision }](t, doRequest(t, s, http.MethodGet, "/notes/"+dup.ID.String()+"/revisions", nil, cookie))
+	if len(revisions.Items) != 0 {
+		t.Errorf("copied revisions = %+v", revisions.Items)
+	}
+
+	for body, want := range map[string]*uuid.UUID{`{"notebook_id":"` + other.ID.String() + `"}`: &other.ID, `{"notebook_id":null}`: nil} {
+		req := httptest.NewRequest(http.MethodPost, "/notes/"+n.ID.String()+"/duplicate", strings.NewReader(body))
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if got := decode[store.Note](t, rec).NotebookID; (got == nil) != (want == nil) || got != nil && *got != *want {
+			t.Errorf("duplicate with %s: notebook %v", body, got)
+		}
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/duplicate", map[string]any{"notebook_id": uuid.New()}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing notebook: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+uuid.New().String()+"/duplicate", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("missing note: status %d", rec.Code)
+	}
+}
+
+func TestMergeNotes(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 10
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	s.cfg.MaxAttachmentBytes = 1 << 10
+	cookie := login(t, s)
+
+	create := func(title, content string, tags ...string) store.Note {
+		t.Helper()
+		return decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content, "tags": tags}, cookie))
+	}
+	old := create("Groceries", "Eggs, milk, flour, butter and a bag of apples for the pie.", "home")
+	create("Standup", "The release moves to next week.")
+	recent := create("groceries", "eggs milk flour butter and a bag of apples for the pie", "home", "shop")
+	a := decode[store.Attachment](t, uploadAttachment(t, s, old.ID, "a.txt", "attached", cookie))
+
+	rec := doRequest(t, s, http.MethodGet, "/notes/duplicates", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("duplicates: status %d: %s", rec.Code, rec.Body)
+	}
+	dups := decode[duplicatesResponse](t, rec)
+	if len(dups.Items) != 1 || dups.Items[0].Target.ID != recent.ID || dups.Items[0].Source.ID != old.ID || dups.Items[0].Similarity < 0.8 {
+		t.Fatalf("duplicates = %+v", dups)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/duplicates?threshold=0.2", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("low threshold: status %d", rec.Code)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/notes/merge", map[string]any{"target_id": recent.ID, "source_id": old.ID}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge: status %d: %s", rec.Code, rec.Body)
+	}
+	merged := decode[store.Note](t, rec)
+	if want := recent.Content + "\n\n" + old.Content; merged.Content != want {
+		t.Errorf("content = %q, want %q", merged.Content, want)
+	}
+	if merged.Title != "groceries" || strings.Join(merged.Tags, ",") != "home,shop" {
+		t.Errorf("merged = %+v", merged)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+old.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("source after merge: status %d", rec.Code)
+	}
+	attachments := decode[struct {
+		Items []store.Attachment `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes/"+recent.ID.String()+"/attachments", nil, cookie)).Items
+	if len(attachments) != 1 || attachments[0].ID != a.ID {
+		t.Errorf("attachments = %+v", attachments)
+	}
+	revisions := decode[struct{ Items []store.Revision }](t, doRequest(t, s, http.MethodGet, "/notes/"+recent.ID.String()+"/revisions", nil, cookie))
+	if len(revisions.Items) != 1 || revisions.Items[0].Title != "groceries" {
+		t.Errorf("revisions = %+v", revisions.Items)
+	}
+	if dups := decode[duplicatesResponse](t, doRequest(t, s, http.MethodGet, "/notes/duplicates", nil, cookie)); len(dups.Items) != 0 {
+		t.Errorf("duplicates after merge = %+v", dups.Items)
+	}
+
+	if rec := doRequest(t, s, http.MethodPost, "/notes/merge", map[string]any{"target_id": recent.ID, "source_id": old.ID}, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("trashed source: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes/merge", map[string]any{"target_id": recent.ID, "source_id": recent.ID}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("self merge: status %d", rec.Code)
+	}
+}
+
+func TestBackups(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	if rec := doRequest(t, s, http.MethodPost, "/admin/backup", nil, cookie); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("backup without a target status = %d", rec.Code)
+	}
+
+	target, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.backups = backup.New(s.store, target, backup.Options{Keep: 1})
+	fake := clock.NewFake(time.Date(2026, 10, 14, 3, 0, 0, 0, time.UTC))
+	s.clock = fake
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Kept", "content": "safe"}, cookie)
+
+	rec := doRequest(t, s, http.MethodPost, "/admin/backup", nil, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("backup status = %d, body = %s", rec.Code, rec.Body)
+	}
+	first := decode[backup.Backup](t, rec)
+	if first.Name != "notes-backup-20261014-030000.json" || first.Notes == nil || *first.Notes != 1 || first.Size == 0 {
+		t.Fatalf("backup = %+v", first)
+	}
+	fake.Advance(time.Hour)
+	second := decode[backup.Backup](t, doRequest(t, s, http.MethodPost, "/admin/backup", nil, cookie))
+
+	list := decode[itemList[backup.Backup]](t, doRequest(t, s, http.MethodGet, "/admin/backups", nil, cookie))
+	if len(list.Items) != 1 || list.Items[0].Name != second.Name {
+		t.Fatalf("backups after rotation = %+v", list.Items)
+	}
+	rec = doRequest(t, s, http.MethodGet, "/admin/backups/"+second.Name, nil, cookie)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" || !strings.Contains(rec.Body.String(), `"title":"Kept"`) {
+		t.Fatalf("download status = %d, type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, name := range []string{first.Name, "..%2Fsecret.json"} {
+		if rec := doRequest(t, s, http.MethodGet, "/admin/backups/"+name, nil, cookie); rec.Code != http.StatusNotFound {
+			t.Errorf("download %s status = %d", name, rec.Code)
+		}
+	}
+
+	if entries := decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit?action=backup.create", nil, cookie)); len(entries.Items) != 2 {
+		t.Errorf("%d backup.create audit entries", len(entries.Items))
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	note := map[string]any{"title": "t", "content": "c"}
+
+	rec := doRequest(t, s, http.MethodPost, "/admin/maintenance", map[string]any{"enabled": true, "message": "moving storage"}, cookie)
+	if got := decode[maintenanceStatus](t, rec); rec.Code != http.StatusOK || !got.Enabled || got.Message != "moving storage" || got.Since == nil {
+		t.Fatalf("enable status = %d, body = %+v", rec.Code, got)
+	}
+	rec = doRequest(t, s, http.MethodPost, "/notes", note, cookie)
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusServiceUnavailable || got.Code != codeMaintenance || got.Message != "moving storage" {
+		t.Fatalf("write in maintenance status = %d, body = %+v", rec.Code, got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("read in maintenance status = %d", rec.Code)
+	}
+	rec = doRequest(t, s, http.MethodGet, "/daily/2025-01-01", nil, cookie)
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusServiceUnavailable || got.Code != codeMaintenance {
+		t.Fatalf("daily note in maintenance status = %d, body = %+v", rec.Code, got)
+	}
+	if list := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes", nil, cookie)); len(list.Items) != 0 {
+		t.Fatalf("notes after the refused daily note = %+v", list.Items)
+	}
+	if ready := decode[readiness](t, doRequest(t, s, http.MethodGet, "/health/ready", nil)); !ready.Maintenance {
+		t.Error("readiness does not report maintenance")
+	}
+	cookie = login(t, s)
+	rec = doRequest(t, s, http.MethodPost, "/admin/maintenance", map[string]any{"enabled": false}, cookie)
+	if got := decode[maintenanceStatus](t, rec); rec.Code != http.StatusOK || got.Enabled {
+		t.Fatalf("disable status = %d, body = %+v", rec.Code, got)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/notes", note, cookie); rec.Code != http.StatusCreated {
+		t.Fatalf("write after maintenance status = %d", rec.Code)
+	}
+
+	cfg := s.cfg
+	cfg.MaintenanceMode = true
+	started := NewWithStore(cfg, memory.New())
+	t.Cleanup(started.Close)
+	rec = doRequest(t, started, http.MethodPost, "/notes", note, login(t, started))
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusServiceUnavailable || got.Message != defaultMaintenanceMessage {
+		t.Fatalf("write with MAINTENANCE_MODE status = %d, body = %+v", rec.Code, got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	next := s.cfg
+	next.APIRateLimit, next.APIRateBurst = 60, 1
+	next.SessionTTL = s.cfg.SessionTTL + time.Hour
+	next.Port = "9999"
+	var loadErr error
+	s.SetConfigSource(func() (config.Config, error) { return next, loadErr })
+
+	rec := doRequest(t, s, http.MethodPost, "/admin/reload", nil, cookie)
+	got := decode[reloadResult](t, rec)
+	if rec.Code != http.StatusOK || !slices.Equal(got.Applied, []string{"session_ttl", "api_rate_limit", "api_rate_burst"}) || !slices.Equal(got.RestartRequired, []string{"port"}) {
+		t.Fatalf("reload status = %d, body = %+v", rec.Code, got)
+	}
+	if s.settings().Port == "9999" {
+		t.Error("reload applied the port")
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("first list status = %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes", nil, cookie); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second list status = %d, want 429 with the reloaded limit", rec.Code)
+	}
+
+	fake.Advance(time.Second)
+	limiter := s.settings().apiLimit
+	loadErr = errors.New("invalid LOG_LEVEL")
+	rec = doRequest(t, s, http.MethodPost, "/admin/reload", nil, cookie)
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusUnprocessableEntity || got.Code != codeInvalidConfig {
+		t.Fatalf("failed reload status = %d, body = %+v", rec.Code, got)
+	}
+	loadErr = nil
+	if result, err := s.Reload(); err != nil || len(result.Applied) != 0 || s.settings().apiLimit != limiter {
+		t.Fatalf("unchanged reload = %+v, %v; limiter replaced: %v", result, err, s.settings().apiLimit != limiter)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.IdempotencyWindow = 24 * time.Hour
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+	post := func(key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/notes", bytes.NewReader(raw))
+		req.Header.Set("Idempotency-Key", key)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	note := map[string]any{"title": "groceries", "content": "milk"}
+
+	first := post("retry-1", note)
+	firstBody := first.Body.String()
+	created := decode[store.Note](t, first)
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first status = %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+	}
+	retry := post("retry-1", note)
+	if retry.Code != http.StatusCreated || retry.Body.String() != firstBody ||
+		retry.Header().Get("ETag") != first.Header().Get("ETag") || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry status = %d, headers %v, body %s", retry.Code, retry.Header(), retry.Body)
+	}
+	if page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes", nil, cookie)); page.Total != 1 {
+		t.Fatalf("notes after retry = %d, want 1", page.Total)
+	}
+	if rec := post("retry-1", map[string]any{"title": "other"}); rec.Code != http.StatusUnprocessableEntity || decode[errorResponse](t, rec).Code != codeIdempotencyKeyReused {
+		t.Fatalf("reused key status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := post(strings.Repeat("k", maxIdempotencyKey+1), note); rec.Code != http.StatusBadRequest {
+		t.Fatalf("long key status = %d", rec.Code)
+	}
+
+	if _, _, err := s.store.ClaimIdempotencyKey(context.Background(), store.IdempotentRequest{Key: "busy", CreatedAt: fake.Now()}, fake.Now(), fake.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if rec := post("busy", note); rec.Code != http.StatusConflict || decode[errorResponse](t, rec).Code != codeRequestInProgress {
+		t.Fatalf("in progress status = %d, body %s", rec.Code, rec.Body)
+	}
+	fake.Advance(abandonIdempotentAfter + time.Second)
+	if rec := post("busy", note); rec.Code != http.StatusCreated {
+		t.Fatalf("abandoned key status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	fake.Advance(s.cfg.IdempotencyWindow)
+	cookie = login(t, s)
+	if again := decode[store.Note](t, post("retry-1", note)); again.ID == created.ID {
+		t.Fatal("key still replayed after the window")
+	}
+	s.purgeIdempotencyKeys(context.Background())
+
+	md := []byte("# Imported\n\nonce")
+	importOnce := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/import?filename=a.md", bytes.NewReader(md))
+		req.Header.Set("Idempotency-Key", "import-1")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	firstImport := importOnce()
+	importBody := firstImport.Body.String()
+	if got := decode[importSummary](t, firstImport); firstImport.Code != http.StatusOK || got.Created != 1 {
+		t.Fatalf("import status = %d, body %s", firstImport.Code, importBody)
+	}
+	if retry := importOnce(); retry.Body.String() != importBody {
+		t.Fatalf("import retry = %s, want %s", retry.Body, importBody)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	type span struct {
+		TraceID      string `json:"traceId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Status       *struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	spans := make(chan span, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, sp := range ss.Spans {
+					spans <- sp
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	s := newTestServer(t)
+	s.tracer = tracing.New(tracing.Options{Endpoint: collector.URL, SampleRatio: 1})
+	cookie := login(t, s)
+	note := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "t", "content": "c"}, cookie))
+	req := httptest.NewRequest(http.MethodGet, "/notes/"+note.ID.String(), nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.AddCookie(cookie)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if err := s.tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(spans)
+
+	var names []string
+	for sp := range spans {
+		names = append(names, sp.Name)
+		if sp.Name == "GET /notes/{id}" && (sp.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || sp.ParentSpanID != "00f067aa0ba902b7" || sp.Status != nil) {
+			t.Errorf("request span = %+v", sp)
+		}
+	}
+	if !slices.Contains(names, "GET /notes/{id}") || !slices.Contains(names, "POST /notes") {
+		t.Errorf("span names = %q", names)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := newTestServer(t)
+	target, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.backups = backup.New(s.store, target, backup.Options{})
+	cookie := login(t, s)
+	restore := func(s *Server, query string, body []byte, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/restore"+query, bytes.NewReader(body))
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Work"}, cookie))
+	lost := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Plan", "content": "see [[Kept]]", "notebook_id": nb.ID}, cookie))
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Kept", "content": "body"}, cookie)
+	taken := decode[backup.Backup](t, doRequest(t, s, http.MethodPost, "/admin/backup", nil, cookie))
+	archive := doRequest(t, s, http.MethodGet, "/export", nil, cookie).Body.Bytes()
+	doRequest(t, s, http.MethodDelete, "/notes/"+lost.ID.String(), nil, cookie)
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+lost.ID.String()+"/purge", nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("purge status = %d", rec.Code)
+	}
+
+	rec := restore(s, "?dry_run=true&backup="+taken.Name, nil, cookie)
+	if got := decode[restoreSummary](t, rec); rec.Code != http.StatusOK || !got.DryRun || got.Version != 1 || got.Notes != 1 || got.Skipped != 1 || got.Notebooks != 0 {
+		t.Fatalf("dry run status = %d, summary = %+v", rec.Code, got)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes/"+lost.ID.String(), nil, cookie); rec.Code != http.StatusNotFound {
+		t.Fatalf("dry run restored the note: status = %d", rec.Code)
+	}
+	rec = restore(s, "?backup="+taken.Name, nil, cookie)
+	if got := decode[restoreSummary](t, rec); rec.Code != http.StatusOK || got.DryRun || got.Notes != 1 {
+		t.Fatalf("restore status = %d, summary = %+v", rec.Code, got)
+	}
+	back := decode[store.Note](t, doRequest(t, s, http.MethodGet, "/notes/"+lost.ID.String(), nil, cookie))
+	if back.Title != "Plan" || back.NotebookID == nil || *back.NotebookID != nb.ID || !back.CreatedAt.Equal(lost.CreatedAt) {
+		t.Errorf("restored note = %+v", back)
+	}
+	if links := decode[itemList[store.Note]](t, doRequest(t, s, http.MethodGet, "/notes/"+lost.ID.String()+"/links", nil, cookie)); len(links.Items) != 1 {
+		t.Errorf("restored note links = %+v", links.Items)
+	}
+
+	fresh := newTestServer(t)
+	freshCookie := login(t, fresh)
+	rec = restore(fresh, "", archive, freshCookie)
+	if got := decode[restoreSummary](t, rec); rec.Code != http.StatusOK || got.Notes != 2 || got.Notebooks != 1 {
+		t.Fatalf("restore of an export status = %d, summary = %+v", rec.Code, got)
+	}
+	if _, err := fresh.store.GetNotebook(context.Background(), nb.ID); err != nil {
+		t.Errorf("notebook not restored: %v", err)
+	}
+
+	for _, tc := range []struct {
+		query, body string
+		status      int
+		code        string
+	}{
+		{"", `{"version": 99, "notes": []}`, http.StatusUnprocessableEntity, codeUnsupportedDump},
+		{"", `not json`, http.StatusBadRequest, codeInvalidImport},
+		{"", `{"version": 1, "notebooks": [{"id": "` + uuid.NewString() + `", "parent_id": "` + uuid.NewString() + `", "name": "orphan"}], "notes": []}`, http.StatusBadRequest, codeInvalidImport},
+		{"?backup=notes-backup-20260101-000000.dump", "", http.StatusBadRequest, codeValidationFailed},
+		{"?backup=notes-backup-20260101-000000.json", "", http.StatusNotFound, codeBackupNotFound},
+	} {
+		rec := restore(s, tc.query, []byte(tc.body), cookie)
+		if got := decode[errorResponse](t, rec); rec.Code != tc.status || got.Code != tc.code {
+			t.Errorf("restore %s %s: status = %d, code = %q", tc.query, tc.body, rec.Code, got.Code)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	s := newTestServer(t)
+	zone, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.TimeZone = zone
+	s.clock = clock.NewFake(time.Date(2025, 6, 1, 22, 30, 0, 0, time.UTC))
+	cookie := login(t, s)
+
+	if rec := doRequest(t, s, http.MethodPost, "/templates", map[string]any{"name": " "}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("nameless template: status %d", rec.Code)
+	}
+	rec := doRequest(t, s, http.MethodPost, "/templates", map[string]any{
+		"name": "Standup", "title": "Standup {{date}}", "content": "# {{ title }}\n{{weekday}} {{time}}, {{unknown}}", "tags": []string{"Work"},
+	}, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	tmpl := decode[store.Template](t, rec)
+	if tmpl.Title != "Standup {{date}}" || strings.Join(tmpl.Tags, ",") != "work" {
+		t.Fatalf("template = %+v", tmpl)
+	}
+	doRequest(t, s, http.MethodPost, "/templates", map[string]any{"name": "Meeting"}, cookie)
+	list := decode[struct{ Items []store.Template }](t, doRequest(t, s, http.MethodGet, "/templates", nil, cookie))
+	if len(list.Items) != 2 || list.Items[0].Name != "Meeting" {
+		t.Errorf("templates = %+v", list.Items)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, "/notes/from-template/"+tmpl.ID.String(), nil, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("from template: status %d: %s", rec.Code, rec.Body)
+	}
+	// 22:30 UTC is the next morning in Tokyo.
+	n := decode[store.Note](t, rec)
+	if n.Title != "Standup 2025-06-02" || n.Content != "# Standup 2025-06-02\nMonday 07:30, {{unknown}}" || strings.Join(n.Tags, ",") != "work" {
+		t.Errorf("note = %+v", n)
+	}
+
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]string{"name": "work"}, cookie))
+	n = decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes/from-template/"+tmpl.ID.String(), map[string]any{
+		"title": "Retro", "tags": []string{"team", "work"}, "notebook_id": nb.ID,
+	}, cookie))
+	if n.Title != "Retro" || !strings.HasPrefix(n.Content, "# Retro\n") || strings.Join(n.Tags, ",") != "work,team" || n.NotebookID == nil || *n.NotebookID != nb.ID {
+		t.Errorf("note with overrides = %+v", n)
+	}
+
+	rec = doRequest(t, s, http.MethodPut, "/templates/"+tmpl.ID.String(), map[string]any{"name": "Daily", "content": "{{title}}"}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d", rec.Code)
+	}
+	n = decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes/from-template/"+tmpl.ID.String(), nil, cookie))
+	if n.Title != "Daily" || n.Content != "Daily" {
+		t.Errorf("note from untitled template = %+v", n)
+	}
+
+	if rec := doRequest(t, s, http.MethodDelete, "/templates/"+tmpl.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+	for _, path := range []string{"/templates/" + tmpl.ID.String(), "/notes/from-template/" + tmpl.ID.String()} {
+		method := http.MethodGet
+		if strings.HasPrefix(path, "/notes") {
+			method = http.MethodPost
+		}
+		if rec := doRequest(t, s, method, path, nil, cookie); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s after delete: status %d", method, path, rec.Code)
+		}
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	for _, note := range []map[string]any{
+		{"title": "Plan", "tags": []string{"work"}, "is_favorite": true},
+		{"title": "Plan B", "tags": []string{"work"}},
+		{"title": "Plan C", "tags": []string{"home"}, "is_favorite": true},
+	} {
+		if rec := doRequest(t, s, http.MethodPost, "/notes", note, cookie); rec.Code != http.StatusCreated {
+			t.Fatalf("create note: status %d", rec.Code)
+		}
+	}
+
+	for _, body := range []map[string]any{{"name": " "}, {"name": "x", "notebook": "inbox"}} {
+		if rec := doRequest(t, s, http.MethodPost, "/searches", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %v: status %d", body, rec.Code)
+		}
+	}
+	rec := doRequest(t, s, http.MethodPost, "/searches", map[string]any{"name": "Starred work", "query": "plan", "tag": " Work", "favorite": true}, cookie)
+	search := decode[store.SavedSearch](t, rec)
+	if rec.Code != http.StatusCreated || search.Tag != "work" || search.Favorite == nil || !*search.Favorite {
+		t.Fatalf("create: status %d, %+v", rec.Code, search)
+	}
+	results := func(query string) notePage {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, "/searches/"+search.ID.String()+"/results"+query, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("results: status %d: %s", rec.Code, rec.Body)
+		}
+		return decode[notePage](t, rec)
+	}
+	if page := results(""); page.Total != 1 || page.Items[0].Title != "Plan" {
+		t.Errorf("results = %+v", page)
+	}
+
+	rec = doRequest(t, s, http.MethodPut, "/searches/"+search.ID.String(), map[string]any{"name": "Work", "tag": "work"}, cookie)
+	if rec.Code != http.StatusOK || decode[store.SavedSearch](t, rec).Favorite != nil {
+		t.Fatalf("update: status %d", rec.Code)
+	}
+	// The search's own filters win; paging and sorting pass through.
+	if page := results("?tag=home&favorite=true&sort=title&limit=1"); page.Total != 2 || len(page.Items) != 1 || page.Items[0].Title != "Plan" {
+		t.Errorf("results after update = %+v", page)
+	}
+
+	list := decode[struct{ Items []store.SavedSearch }](t, doRequest(t, s, http.MethodGet, "/searches", nil, cookie))
+	if len(list.Items) != 1 || list.Items[0].Name != "Work" {
+		t.Errorf("list = %+v", list.Items)
+	}
+	if rec := doRequest(t, s, http.MethodDelete, "/searches/"+search.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/searches/"+search.ID.String()+"/results", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("results of deleted search: status %d", rec.Code)
+	}
+}
+
+func TestRecentAndFrequentNotes(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+
+	ids := map[string]string{}
+	for _, title := range []string{"A", "B", "C"} {
+		rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title}, cookie)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create note: status %d", rec.Code)
+		}
+		ids[title] = decode[store.Note](t, rec).ID.String()
+	}
+	open := func(title string, times int) {
+		t.Helper()
+		for range times {
+			if rec := doRequest(t, s, http.MethodGet, "/notes/"+ids[title], nil, cookie); rec.Code != http.StatusOK {
+				t.Fatalf("get note: status %d", rec.Code)
+			}
+		}
+		fake.Advance(time.Minute)
+	}
+	list := func(path string) []store.AccessedNote {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		return decode[struct{ Items []store.AccessedNote }](t, rec).Items
+	}
+	titles := func(items []store.AccessedNote) string {
+		var out []string
+		for _, item := range items {
+			out = append(out, fmt.Sprintf("%s:%d", item.Title, item.Opens))
+		}
+		return strings.Join(out, " ")
+	}
+
+	open("A", 3)
+	open("B", 1)
+	open("C", 1)
+	// Trashed notes drop out of both lists.
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+ids["C"], nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete note: status %d", rec.Code)
+	}
+	recent := list("/notes/recent")
+	if got := titles(recent); got != "B:1 A:3" {
+		t.Errorf("recent = %s", got)
+	}
+	if want := time.Date(2025, 6, 1, 8, 1, 0, 0, time.UTC); !recent[0].LastOpenedAt.Equal(want) {
+		t.Errorf("B last opened at %v, want %v", recent[0].LastOpenedAt, want)
+	}
+	if got := titles(list("/notes/frequent")); got != "A:3 B:1" {
+		t.Errorf("frequent = %s", got)
+	}
+
+	fake.Advance(48 * time.Hour)
+	cookie = login(t, s)
+	open("B", 2)
+	if got := titles(list("/notes/frequent?days=1")); got != "B:2" {
+		t.Errorf("frequent over a day = %s", got)
+	}
+	if got := titles(list("/notes/recent?limit=1")); got != "B:3" {
+		t.Errorf("recent with limit = %s", got)
+	}
+
+	s.cfg.AccessRetention = 24 * time.Hour
+	s.purgeNoteAccess(context.Background())
+	if got := titles(list("/notes/frequent")); got != "B:2" {
+		t.Errorf("frequent after purge = %s", got)
+	}
+}
+
+func TestNoteStats(t *testing.T) {
+	s := newTestServer(t)
+	// A Wednesday, so this week started two days ago.
+	fake := clock.NewFake(time.Date(2025, 6, 4, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Work"}, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create notebook: status %d", rec.Code)
+	}
+	book := decode[store.Notebook](t, rec)
+
+	rec = doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Short", "content": "# Hi - there", "tags": []string{"a"}}, cookie)
+	short := decode[store.Note](t, rec)
+	if rec.Code != http.StatusCreated || short.WordCount != 2 || short.CharCount != 12 || short.ReadingTimeSeconds != 1 {
+		t.Fatalf("create: status %d, counts %d/%d/%d", rec.Code, short.WordCount, short.CharCount, short.ReadingTimeSeconds)
+	}
+	fake.Advance(-7 * 24 * time.Hour)
+	long := strings.Repeat("word ", 250)
+	rec = doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Long", "content": long, "tags": []string{"a", "b"}, "notebook_id": book.ID}, cookie)
+	if n := decode[store.Note](t, rec); rec.Code != http.StatusCreated || n.WordCount != 250 || n.ReadingTimeSeconds != 75 {
+		t.Fatalf("create long: status %d, %d words in %ds", rec.Code, n.WordCount, n.ReadingTimeSeconds)
+	}
+	fake.Advance(7 * 24 * time.Hour)
+
+	var titles []string
+	for _, n := range decode[struct{ Items []store.Note }](t, doRequest(t, s, http.MethodGet, "/notes?sort=length", nil, cookie)).Items {
+		titles = append(titles, n.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Long,Short" {
+		t.Errorf("sort=length = %s", got)
+	}
+
+	rec = patchNote(t, s, short.ID, noteETag(short), `{"content": "one two three"}`, cookie)
+	if n := decode[store.Note](t, rec); rec.Code != http.StatusOK || n.WordCount != 3 || n.CharCount != 13 {
+		t.Fatalf("patch: status %d, counts %d/%d", rec.Code, n.WordCount, n.CharCount)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/stats?weeks=3", nil, cookie)
+	stats := decode[noteStats](t, rec)
+	if rec.Code != http.StatusOK || stats.Notes != 2 || stats.Words != 253 || stats.Chars != 1263 || stats.ReadingTimeSeconds != 76 {
+		t.Fatalf("stats: status %d, %+v", rec.Code, stats)
+	}
+	if want := []tagStats{{"a", 2, 253}, {"b", 1, 250}}; !slices.Equal(stats.Tags, want) {
+		t.Errorf("tags = %+v, want %+v", stats.Tags, want)
+	}
+	if len(stats.Notebooks) != 2 || stats.Notebooks[0].NotebookID != nil || stats.Notebooks[0].Words != 3 ||
+		stats.Notebooks[1].Name != "Work" || stats.Notebooks[1].Notes != 1 {
+		t.Errorf("notebooks = %+v", stats.Notebooks)
+	}
+	if want := []weekStats{{"2025-05-19", 0}, {"2025-05-26", 1}, {"2025-06-02", 1}}; !slices.Equal(stats.Weeks, want) {
+		t.Errorf("weeks = %+v, want %+v", stats.Weeks, want)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	type ready struct {
+		Status   string `json:"status"`
+		Database struct {
+			Status string           `json:"status"`
+			Pool   *store.PoolStats `json:"pool"`
+		} `json:"database"`
+		Migrations struct {
+			Applied int    `json:"applied"`
+			Pending int    `json:"pending"`
+			Latest  string `json:"latest"`
+		} `json:"migrations"`
+		Build struct {
+			Version string `json:"version"`
+		} `json:"build"`
+	}
+
+	s := newTestServer(t)
+	if rec := doRequest(t, s, http.MethodGet, "/health/live", nil); rec.Code != http.StatusOK {
+		t.Errorf("live: status %d", rec.Code)
+	}
+	rec := doRequest(t, s, http.MethodGet, "/health/ready", nil)
+	if got := decode[ready](t, rec); rec.Code != http.StatusOK || got.Status != "ok" || got.Database.Pool != nil || got.Build.Version == "" {
+		t.Errorf("ready without a database = %d %+v", rec.Code, got)
+	}
+
+	ctx := context.Background()
+	cfg := config.Config{
+		AppPassword:       testPassword,
+		SessionCookieName: "notes_session",
+		SessionTTL:        time.Hour,
+		DatabaseDriver:    "sqlite",
+		DatabaseURL:       filepath.Join(t.TempDir(), "notes.db"),
+	}
+	st, migrator, err := openStore(ctx, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewWithStore(cfg, st)
+	s.migrator = migrator
+	t.Cleanup(s.Close)
+
+	rec = doRequest(t, s, http.MethodGet, "/health/ready", nil)
+	got := decode[ready](t, rec)
+	if rec.Code != http.StatusOK || got.Database.Status != "ok" || got.Database.Pool == nil || got.Database.Pool.MaxOpen != 1 ||
+		got.Migrations.Applied == 0 || got.Migrations.Pending != 0 {
+		t.Fatalf("ready = %d %+v", rec.Code, got)
+	}
+	vars := decode[map[string]any](t, doRequest(t, s, http.MethodGet, "/debug/vars", nil, login(t, s)))
+	if pool, _ := vars["db_pool"].(map[string]any); pool["max_open"] != float64(1) || pool["wait_ms"] == nil {
+		t.Errorf("db_pool = %v", vars["db_pool"])
+	}
+	if err := migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	rec = doRequest(t, s, http.MethodGet, "/health/ready", nil)
+	if got := decode[ready](t, rec); rec.Code != http.StatusServiceUnavailable || got.Status != "unavailable" || got.Migrations.Pending != 1 {
+		t.Errorf("ready with a pending migration = %d %+v", rec.Code, got)
+	}
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := newTestServer(t)
+	rec := doRequest(t, s, http.MethodGet, "/openapi.json", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("openapi.json: status %d", rec.Code)
+	}
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	routed := make(map[string]bool)
+	err := chi.Walk(s.router.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routed[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("%s is not in the document", route)
+		}
+	}
+	for route := range documented {
+		if !routed[route] {
+			t.Errorf("%s is documented but not routed", route)
+		}
+	}
+
+	// Every $ref has to resolve.
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([A-Za-z]+)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("dangling $ref to %s", ref[1])
+		}
+	}
+	for _, name := range []string{"Note", "NoteRequest", "CreatedToken", "ErrorResponse"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	s := newTestServer(t)
+	if rec := doRequest(t, s, http.MethodGet, "/docs", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("docs while off: status %d", rec.Code)
+	}
+
+	s.cfg.APIDocs = true
+	s.mountRoutes()
+	rec := doRequest(t, s, http.MethodGet, "/docs", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Fatalf("docs: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	csp := rec.Header().Get("Content-Security-Policy")
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(csp)
+	if nonce == nil || !strings.Contains(rec.Body.String(), `nonce="`+nonce[1]+`"`) {
+		t.Errorf("CSP %q does not allow the inline script", csp)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Work"}, cookie))
+	rust := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{
+		"title": "Rust", "content": "- [ ] learn ownership", "tags": []string{"lang"}, "notebook_id": nb.ID,
+	}, cookie))
+	doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Index", "content": "See [[Rust]]", "tags": []string{"lang"}}, cookie)
+
+	query := func(rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("graphql: status %d, body %s", rec.Code, rec.Body)
+		}
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	got := query(doRequest(t, s, http.MethodPost, "/graphql", map[string]any{
+		"query": `{ notes(sort: "title") { total items { title notebook { name } backlinks { title } } } }`,
+	}, cookie))
+	want := `{"data":{"notes":{"total":2,"items":[{"title":"Index","notebook":null,"backlinks":[]},` +
+		`{"title":"Rust","notebook":{"name":"Work"},"backlinks":[{"title":"Index"}]}]}}}`
+	if got != want {
+		t.Errorf("notes:\n got %s\nwant %s", got, want)
+	}
+
+	vars := url.QueryEscape(`{"id":"` + rust.ID.String() + `"}`)
+	q := url.QueryEscape(`query ($id: ID!) { note(id: $id) { tasks { text done } backlinks { links { title } } } tag(name: "lang") { count } }`)
+	got = query(doRequest(t, s, http.MethodGet, "/graphql?query="+q+"&variables="+vars, nil, cookie))
+	want = `{"data":{"note":{"tasks":[{"text":"learn ownership","done":false}],"backlinks":[{"links":[{"title":"Rust"}]}]},"tag":{"count":2}}}`
+	if got != want {
+		t.Errorf("note:\n got %s\nwant %s", got, want)
+	}
+
+	got = query(doRequest(t, s, http.MethodPost, "/graphql", map[string]any{"query": `{ notes { items { secret } } }`}, cookie))
+	if !strings.HasPrefix(got, `{"errors":[`) {
+		t.Errorf("unknown field: %s", got)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/graphql", map[string]any{"query": " "}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty query: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/graphql", map[string]any{"query": "{ tags { name } }"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a session: status %d", rec.Code)
+	}
+}
+
+func TestLockNote(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.MaxRevisions = 10
+	cookie := login(t, s)
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Bank", "content": "draft"}, cookie))
+	n = decode[store.Note](t, patchNote(t, s, n.ID, "*", `{"content": "PIN 4711, see [[Cards]]"}`, cookie))
+	share := decode[shareResponse](t, doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/share", nil, cookie))
+	path := "/notes/" + n.ID.String()
+
+	if rec := doRequest(t, s, http.MethodPost, path+"/lock", map[string]string{"passphrase": ""}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("lock without a passphrase: status %d", rec.Code)
+	}
+	rec := doRequest(t, s, http.MethodPost, path+"/lock", map[string]string{"passphrase": "open sesame"}, cookie)
+	locked := decode[store.Note](t, rec)
+	if rec.Code != http.StatusOK || !locked.IsEncrypted || strings.Contains(locked.Content, "4711") || locked.Version != n.Version+1 {
+		t.Fatalf("lock: status %d, note %+v", rec.Code, locked)
+	}
+	if rec := doRequest(t, s, http.MethodPost, path+"/lock", map[string]string{"passphrase": "again"}, cookie); rec.Code != http.StatusConflict {
+		t.Errorf("lock twice: status %d", rec.Code)
+	}
+
+	// Nothing that held the plain text is left.
+	if revs := decode[struct{ Items []revisionSummary }](t, doRequest(t, s, http.MethodGet, path+"/revisions", nil, cookie)); len(revs.Items) != 0 {
+		t.Errorf("revisions after locking: %+v", revs.Items)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/share/"+share.Slug, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("share after locking: status %d", rec.Code)
+	}
+	if page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes?query=4711", nil, cookie)); page.Total != 0 {
+		t.Errorf("content search found the encrypted note")
+	}
+	if page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes?query=bank&render=html", nil, cookie)); page.Total != 1 || page.Items[0].HTML != "" {
+		t.Errorf("title search: %+v", page)
+	}
+
+	// The title may change, the content may not.
+	if rec := patchNote(t, s, n.ID, "*", `{"content": "plain again"}`, cookie); rec.Code != http.StatusConflict {
+		t.Errorf("content edit: status %d", rec.Code)
+	}
+	if rec := patchNote(t, s, n.ID, "*", `{"title": "Bank details"}`, cookie); rec.Code != http.StatusOK {
+		t.Errorf("title edit: status %d", rec.Code)
+	}
+	for _, action := range []string{"/duplicate", "/share"} {
+		if rec := doRequest(t, s, http.MethodPost, path+action, nil, cookie); rec.Code != http.StatusConflict {
+			t.Errorf("%s: status %d", action, rec.Code)
+		}
+	}
+
+	if rec := doRequest(t, s, http.MethodPost, path+"/unlock", map[string]string{"passphrase": "sesame"}, cookie); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong passphrase: status %d", rec.Code)
+	}
+	rec = doRequest(t, s, http.MethodPost, path+"/unlock", map[string]string{"passphrase": "open sesame"}, cookie)
+	if got := decode[store.Note](t, rec); rec.Code != http.StatusOK || got.Content != "PIN 4711, see [[Cards]]" || !got.IsEncrypted || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("unlock: status %d, note %+v", rec.Code, got)
+	}
+	if got := decode[store.Note](t, doRequest(t, s, http.MethodGet, path, nil, cookie)); !got.IsEncrypted || strings.Contains(got.Content, "4711") {
+		t.Errorf("unlocking for a read decrypted the stored note: %+v", got)
+	}
+
+	rec = doRequest(t, s, http.MethodPost, path+"/unlock", map[string]any{"passphrase": "open sesame", "permanent": true}, cookie)
+	if got := decode[store.Note](t, rec); rec.Code != http.StatusOK || got.IsEncrypted || got.Content != "PIN 4711, see [[Cards]]" || got.Title != "Bank details" {
+		t.Errorf("permanent unlock: status %d, note %+v", rec.Code, got)
+	}
+	cards := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Cards"}, cookie))
+	if links := decode[struct{ Items []store.Note }](t, doRequest(t, s, http.MethodGet, "/notes/"+cards.ID.String()+"/backlinks", nil, cookie)); len(links.Items) != 1 {
+		t.Errorf("backlinks after unlocking: %+v", links.Items)
+	}
+	if rec := doRequest(t, s, http.MethodPost, path+"/unlock", map[string]string{"passphrase": "open sesame"}, cookie); rec.Code != http.StatusConflict {
+		t.Errorf("unlock a plain note: status %d", rec.Code)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	step := func() { fake.Advance(time.Minute) }
+
+	if rec := doRequest(t, s, http.MethodPost, "/auth/login", map[string]string{"password": "wrong"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("bad login: status %d", rec.Code)
+	}
+	step()
+	cookie := login(t, s)
+	step()
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "Plan"}, cookie))
+	step()
+	patchNote(t, s, n.ID, "*", `{"title": "Plan B", "tags": ["work"]}`, cookie)
+	step()
+	doRequest(t, s, http.MethodPost, "/notes/"+n.ID.String()+"/favorite", map[string]bool{"value": true}, cookie)
+	step()
+	// Failed writes and reads are not recorded.
+	doRequest(t, s, http.MethodDelete, "/notes/"+uuid.NewString(), nil, cookie)
+	doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String(), nil, cookie)
+	doRequest(t, s, http.MethodDelete, "/notes/"+n.ID.String(), nil, cookie)
+	fake.Set(time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC))
+	doRequest(t, s, http.MethodPost, "/auth/logout", nil, cookie)
+	step()
+	cookie = login(t, s)
+	page := decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit?to=2025-06-01", nil, cookie))
+	var actions []string
+	for _, e := range page.Items {
+		actions = append(actions, e.Action)
+	}
+	want := []string{"note.delete", "note.favorite", "note.update", "note.create", "auth.login", "auth.login_failed"}
+	if page.Total != len(want) || !slices.Equal(actions, want) {
+		t.Fatalf("audit actions = %v (total %d), want %v", actions, page.Total, want)
+	}
+	update := page.Items[2]
+	if update.Entity != "note" || update.EntityID != n.ID.String() || update.Summary != "title, tags" ||
+		!strings.HasPrefix(update.Actor, "session:") || update.IP != "192.0.2.1" || update.RequestID == "" {
+		t.Errorf("update entry = %+v", update)
+	}
+	if page.Items[3].EntityID != n.ID.String() {
+		t.Errorf("create entry names %q", page.Items[3].EntityID)
+	}
+	if failed := page.Items[5]; failed.Actor != "anonymous" {
+		t.Errorf("failed login entry = %+v", failed)
+	}
+
+	page = decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit?from=2025-06-02", nil, cookie))
+	if len(page.Items) != 2 || page.Items[0].Action != "auth.login" || page.Items[1].Action != "auth.logout" {
+		t.Errorf("audit from June 2 = %+v", page.Items)
+	}
+	page = decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit?entity=note&entity_id="+n.ID.String()+"&limit=2", nil, cookie))
+	if page.Total != 4 || len(page.Items) != 2 || page.Items[0].Action != "note.delete" {
+		t.Errorf("audit for the note = %+v", page)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/audit?from=soon", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad from: status %d", rec.Code)
+	}
+
+	s.cfg.AuditRetention = 24 * time.Hour
+	s.purgeAudit(context.Background())
+	if page := decode[auditPage](t, doRequest(t, s, http.MethodGet, "/audit", nil, cookie)); page.Total != 2 {
+		t.Errorf("after purge: %d entries", page.Total)
+	}
+}
+
+func TestDailyNotes(t *testing.T) {
+	s := newTestServer(t)
+	s.clock = clock.NewFake(time.Date(2025, 6, 10, 23, 30, 0, 0, time.UTC))
+	s.cfg.TimeZone = time.FixedZone("UTC+2", 2*60*60)
+	s.cfg.JournalNotebook = "Journal"
+	s.cfg.JournalTemplate = "Daily note"
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodPost, "/templates", map[string]any{
+		"name":    "daily note",
+		"title":   "Journal {{date}}",
+		"content": "# {{weekday}} {{date}}\n",
+		"tags":    []string{"journal"},
+	}, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create template: status %d", rec.Code)
+	}
+
+	// Today is already June 11 in TIME_ZONE.
+	rec = doRequest(t, s, http.MethodGet, "/daily/today", nil, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first visit: status %d: %s", rec.Code, rec.Body)
+	}
+	today := decode[store.Note](t, rec)
+	if today.Title != "Journal 2025-06-11" || today.Content != "# Wednesday 2025-06-11\n" || !slices.Equal(today.Tags, []string{"journal"}) {
+		t.Errorf("daily note = %q %q %v", today.Title, today.Content, today.Tags)
+	}
+	notebooks, err := s.store.ListNotebooks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notebooks) != 1 || notebooks[0].Name != "Journal" || today.NotebookID == nil || *today.NotebookID != notebooks[0].ID {
+		t.Errorf("notebooks = %+v, note in %v", notebooks, today.NotebookID)
+	}
+
+	rec = doRequest(t, s, http.MethodGet, "/daily/2025-06-11", nil, cookie)
+	if rec.Code != http.StatusOK || decode[store.Note](t, rec).ID != today.ID {
+		t.Fatalf("second visit: status %d, want the same note", rec.Code)
+	}
+	for _, day := range []string{"2025-06-02", "2025-05-31"} {
+		if rec := doRequest(t, s, http.MethodGet, "/daily/"+day, nil, cookie); rec.Code != http.StatusCreated {
+			t.Fatalf("%s: status %d", day, rec.Code)
+		}
+	}
+	// The journal notebook is made once.
+	if notebooks, _ := s.store.ListNotebooks(context.Background()); len(notebooks) != 1 {
+		t.Errorf("%d notebooks, want 1", len(notebooks))
+	}
+
+	days := func(path string) string {
+		t.Helper()
+		rec := doRequest(t, s, http.MethodGet, path, nil, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		var out []string
+		for _, item := range decode[dailyCalendar](t, rec).Items {
+			out = append(out, item.Date)
+		}
+		return strings.Join(out, " ")
+	}
+	if got := days("/daily"); got != "2025-06-02 2025-06-11" {
+		t.Errorf("this month = %s", got)
+	}
+	if got := days("/daily?month=2025-05"); got != "2025-05-31" {
+		t.Errorf("May = %s", got)
+	}
+
+	// A trashed daily note leaves the calendar and the day gets a new one.
+	if rec := doRequest(t, s, http.MethodDelete, "/notes/"+today.ID.String(), nil, cookie); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete note: status %d", rec.Code)
+	}
+	if got := days("/daily?month=2025-06"); got != "2025-06-02" {
+		t.Errorf("after trashing = %s", got)
+	}
+	rec = doRequest(t, s, http.MethodGet, "/daily/2025-06-11", nil, cookie)
+	if rec.Code != http.StatusCreated || decode[store.Note](t, rec).ID == today.ID {
+		t.Errorf("after trashing: status %d, want a new note", rec.Code)
+	}
+
+	// Read-only tokens may read daily notes but not make them; POST makes
+	// them too.
+	secret := decode[struct {
+		Token string `json:"token"`
+	}](t, doRequest(t, s, http.MethodPost, "/auth/tokens", map[string]any{"name": "reader", "scope": store.ScopeRead}, cookie)).Token
+	withToken := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := withToken(http.MethodGet, "/daily/2025-06-02"); rec.Code != http.StatusOK {
+		t.Errorf("existing note with a read token: status %d", rec.Code)
+	}
+	rec = withToken(http.MethodGet, "/daily/2025-06-03")
+	if got := decode[errorResponse](t, rec); rec.Code != http.StatusForbidden || got.Code != codeReadOnlyToken {
+		t.Errorf("new note with a read token: status %d, body %+v", rec.Code, got)
+	}
+	if rec := withToken(http.MethodPost, "/daily/2025-06-03"); rec.Code != http.StatusForbidden {
+		t.Errorf("POST with a read token: status %d", rec.Code)
+	}
+	if got := days("/daily"); got != "2025-06-02 2025-06-11" {
+		t.Errorf("after the read token = %s", got)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/daily/2025-06-03", nil, cookie); rec.Code != http.StatusCreated {
+		t.Errorf("POST: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/daily/2025-06-03", nil, cookie); rec.Code != http.StatusOK {
+		t.Errorf("second POST: status %d", rec.Code)
+	}
+
+	for _, path := range []string{"/daily/2025-13-01", "/daily/tomorrow", "/daily?month=June"} {
+		if rec := doRequest(t, s, http.MethodGet, path, nil, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", path, rec.Code)
+		}
+	}
+}
+
+// rivalStore makes the day's note, as another server would, right after
+// the first miss of GetDailyNote.
+type rivalStore struct {
+	*memory.Store
+	rival *store.Note
+}
+
+func (s *rivalStore) GetDailyNote(ctx context.Context, day string) (store.Note, error) {
+	n, err := s.Store.GetDailyNote(ctx, day)
+	if errors.Is(err, store.ErrNotFound) && s.rival.ID == uuid.Nil {
+		if *s.rival, err = s.Store.CreateNote(ctx, store.NoteInput{Title: "Made elsewhere"}, time.Now()); err != nil {
+			return store.Note{}, err
+		}
+		if _, err := s.Store.SetDailyNote(ctx, day, s.rival.ID); err != nil {
+			return store.Note{}, err
+		}
+		return store.Note{}, store.ErrNotFound
+	}
+	return n, err
+}
+
+func TestDailyNoteMadeElsewhere(t *testing.T) {
+	var rival store.Note
+	st := &rivalStore{Store: memory.New(), rival: &rival}
+	s := NewWithStore(config.Config{AppPassword: testPassword, SessionCookieName: "notes_session", SessionTTL: time.Hour}, st)
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodGet, "/daily/2025-06-11", nil, cookie)
+	if rec.Code != http.StatusOK || decode[store.Note](t, rec).ID != rival.ID {
+		t.Fatalf("status %d: %s; want the note made elsewhere", rec.Code, rec.Body)
+	}
+	// The note made here is deleted for good, not left in the trash.
+	live, _, err := st.ListNotes(context.Background(), store.NoteFilter{})
+	if err != nil || len(live) != 1 {
+		t.Errorf("notes = %+v, %v; want only the note made elsewhere", live, err)
+	}
+	trashed, _, err := st.ListNotes(context.Background(), store.NoteFilter{Trashed: true})
+	if err != nil || len(trashed) != 0 {
+		t.Errorf("trashed notes = %+v, %v", trashed, err)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.FeedSecret = strings.Repeat("s", 32)
+	cookie := login(t, s)
+
+	schedule := func(title string, body map[string]any) store.Note {
+		t.Helper()
+		n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": "Bring milk, eggs; bread", "tags": []string{"home"}}, cookie))
+		rec := doRequest(t, s, http.MethodPut, "/notes/"+n.ID.String()+"/schedule", body, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("schedule: status %d: %s", rec.Code, rec.Body)
+		}
+		return decode[store.Note](t, rec)
+	}
+	shop := schedule("Shopping", map[string]any{"due_at": "2025-06-10T18:00:00+02:00", "reminder_at": "2025-06-10T15:30:00Z"})
+	if shop.DueAt == nil || !shop.DueAt.Equal(time.Date(2025, 6, 10, 16, 0, 0, 0, time.UTC)) || shop.ReminderAt == nil {
+		t.Fatalf("scheduled note = %v %v", shop.DueAt, shop.ReminderAt)
+	}
+	schedule("Call", map[string]any{"reminder_at": "2025-06-11T09:00:00Z"})
+	cleared := schedule("Cleared", map[string]any{"due_at": "2025-06-12T09:00:00Z"})
+	if rec := doRequest(t, s, http.MethodPut, "/notes/"+cleared.ID.String()+"/schedule", map[string]any{}, cookie); rec.Code != http.StatusOK || decode[store.Note](t, rec).DueAt != nil {
+		t.Fatalf("clear schedule: status %d", rec.Code)
+	}
+	if rec := doRequest(t, s, http.MethodPut, "/notes/"+shop.ID.String()+"/schedule", map[string]any{"due_at": "tomorrow"}, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad due_at: status %d", rec.Code)
+	}
+
+	rec := doRequest(t, s, http.MethodGet, "/feeds", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("feeds: status %d", rec.Code)
+	}
+	feed := decode[feedLinks](t, rec).Calendar
+	for _, path := range []string{"/calendar.ics", "/calendar.ics?token=forged"} {
+		if rec := doRequest(t, s, http.MethodGet, path, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", path, rec.Code)
+		}
+	}
+
+	rec = doRequest(t, s, http.MethodGet, feed, nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("calendar: status %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"BEGIN:VEVENT\r\nUID:" + shop.ID.String() + "@notes\r\n",
+		"DTSTART:20250610T160000Z\r\nSUMMARY:Shopping\r\nDESCRIPTION:Bring milk\\, eggs\\; bread\r\nCATEGORIES:home\r\n",
+		"TRIGGER;VALUE=DATE-TIME:20250610T153000Z\r\n",
+		"DTSTART:20250611T090000Z\r\nSUMMARY:Call\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Cleared") || strings.Count(body, "BEGIN:VEVENT") != 2 {
+		t.Errorf("calendar has the wrong events:\n%s", body)
+	}
+
+	body = doRequest(t, s, http.MethodGet, feed+"&todo=true", nil).Body.String()
+	if !strings.Contains(body, "BEGIN:VTODO\r\n") || !strings.Contains(body, "DUE:20250610T160000Z\r\n") || strings.Count(body, "BEGIN:VEVENT") != 1 {
+		t.Errorf("to-do calendar:\n%s", body)
+	}
+
+	s.cfg.FeedSecret = strings.Repeat("t", 32)
+	if rec := doRequest(t, s, http.MethodGet, feed, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("after changing the secret: status %d, want 401", rec.Code)
+	}
+}
+
+func TestICSLineFolding(t *testing.T) {
+	var cal icsWriter
+	cal.line("SUMMARY:" + strings.Repeat("é", 60))
+	for i, line := range strings.Split(strings.TrimSuffix(cal.String(), "\r\n"), "\r\n") {
+		if len(line) > icsLineOctets || !utf8.ValidString(strings.TrimPrefix(line, " ")) {
+			t.Errorf("line %d is %d octets: %q", i, len(line), line)
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	if unfolded := strings.ReplaceAll(cal.String(), "\r\n ", ""); unfolded != "SUMMARY:"+strings.Repeat("é", 60)+"\r\n" {
+		t.Errorf("unfolded = %q", unfolded)
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	s := newTestServer(t)
+	fake := clock.NewFake(time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC))
+	s.clock = fake
+	s.cfg.FeedSecret = strings.Repeat("s", 32)
+	cookie := login(t, s)
+
+	create := func(title, content string) store.Note {
+		t.Helper()
+		fake.Advance(time.Minute)
+		rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": title, "content": content, "tags": []string{"read"}}, cookie)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", title, rec.Code, rec.Body)
+		}
+		return decode[store.Note](t, rec)
+	}
+	pinned := create("Pinned", "old")
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+pinned.ID.String()+"/pin", map[string]any{"value": true}, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("pin: status %d", rec.Code)
+	}
+	older := create("Older", "# Heading\n\nSome *text*")
+	archived := create("Archived", "gone")
+	if rec := doRequest(t, s, http.MethodPost, "/notes/"+archived.ID.String()+"/archive", map[string]any{"value": true}, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("archive: status %d", rec.Code)
+	}
+	long := create("Long", strings.Repeat("line of words\n", 100))
+
+	token := decode[feedLinks](t, doRequest(t, s, http.MethodGet, "/feeds", nil, cookie)).Atom
+	if rec := doRequest(t, s, http.MethodGet, "/feed.atom?token=forged", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("forged token: status %d, want 401", rec.Code)
+	}
+	rec := doRequest(t, s, http.MethodGet, token+"&limit=2", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("atom: status %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("atom: %v\n%s", err, rec.Body)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].ID != "urn:uuid:"+long.ID.String() || feed.Entries[1].ID != "urn:uuid:"+older.ID.String() {
+		t.Fatalf("entries = %+v", feed.Entries)
+	}
+	if feed.Updated != long.UpdatedAt.UTC().Format(time.RFC3339) || feed.ID != atomFeedID {
+		t.Errorf("feed updated %s, id %s", feed.Updated, feed.ID)
+	}
+	if summary := feed.Entries[1].Summary; summary == nil || !strings.Contains(summary.Body, "<em>text</em>") {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary := feed.Entries[0].Summary; summary == nil || len(summary.Body) > 1000 || !strings.Contains(summary.Body, "…") {
+		t.Errorf("long summary = %+v", summary)
+	}
+	if len(feed.Entries[0].Categories) != 1 || feed.Entries[0].Categories[0].Term != "read" {
+		t.Errorf("categories = %+v", feed.Entries[0].Categories)
+	}
+
+	feed = atomFeed{}
+	if err := xml.Unmarshal(doRequest(t, s, http.MethodGet, token, nil).Body.Bytes(), &feed); err != nil || len(feed.Entries) != 3 || feed.Entries[2].Title != "Pinned" {
+		t.Errorf("full feed = %+v, %v", feed.Entries, err)
+	}
+}
+
+func TestNoteCounts(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	nb := decode[store.Notebook](t, doRequest(t, s, http.MethodPost, "/notebooks", map[string]any{"name": "Work"}, cookie))
+	create := func(body map[string]any) store.Note {
+		t.Helper()
+		return decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", body, cookie))
+	}
+	fav := create(map[string]any{"title": "a", "tags": []string{"x", "y"}, "notebook_id": nb.ID})
+	create(map[string]any{"title": "b", "tags": []string{"x"}})
+	archived := create(map[string]any{"title": "c", "tags": []string{"x"}})
+	trashed := create(map[string]any{"title": "d", "tags": []string{"x"}, "notebook_id": nb.ID})
+	doRequest(t, s, http.MethodPost, "/notes/"+fav.ID.String()+"/favorite", map[string]any{"value": true}, cookie)
+	doRequest(t, s, http.MethodPost, "/notes/"+archived.ID.String()+"/archive", map[string]any{"value": true}, cookie)
+	doRequest(t, s, http.MethodDelete, "/notes/"+trashed.ID.String(), nil, cookie)
+
+	rec := doRequest(t, s, http.MethodGet, "/notes/counts", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	counts := decode[store.NoteCounts](t, rec)
+	if counts.All != 2 || counts.Favorites != 1 || counts.Archived != 1 || counts.Trashed != 1 {
+		t.Errorf("counts = %+v", counts)
+	}
+	if want := []store.TagCount{{Name: "x", Count: 2}, {Name: "y", Count: 1}}; !slices.Equal(counts.Tags, want) {
+		t.Errorf("tags = %+v, want %+v", counts.Tags, want)
+	}
+	if len(counts.Notebooks) != 2 || counts.Notebooks[0].NotebookID != nil || counts.Notebooks[0].Count != 1 ||
+		*counts.Notebooks[1].NotebookID != nb.ID || counts.Notebooks[1].Count != 1 {
+		t.Errorf("notebooks = %+v", counts.Notebooks)
+	}
+}
+
+func TestNoteLimits(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.NoteLimits = validate.Limits{TitleChars: 10, Tags: 2, ContentBytes: 100}
+	cookie := login(t, s)
+
+	rec := doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": strings.Repeat("t", 11), "content": strings.Repeat("c", 101), "tags": []string{"a", "b", "c"}}, cookie)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("create over the limits: status %d: %s", rec.Code, rec.Body)
+	}
+	apiErr := decode[errorResponse](t, rec)
+	var fields []string
+	for _, d := range apiErr.Details {
+		fields = append(fields, d.Field)
+	}
+	if apiErr.Code != codeValidationFailed || !slices.Equal(fields, []string{"title", "content", "tags"}) {
+		t.Errorf("error = %+v", apiErr)
+	}
+	// Tags count once cleaned up.
+	n := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "  short  ", "tags": []string{"a", "A", " a"}}, cookie))
+
+	if n.Title != "short" || len(n.Tags) != 1 {
+		t.Fatalf("note = %q %v", n.Title, n.Tags)
+	}
+
+	if rec := putNote(t, s, "/notes/"+n.ID.String(), map[string]any{"title": "short", "tags": []string{"a", "b", "c"}}, cookie); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("update over the limits: status %d", rec.Code)
+	}
+	if rec := patchNote(t, s, n.ID, "*", `{"content":"`+strings.Repeat("c", 101)+`"}`, cookie); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch over the limits: status %d", rec.Code)
+	}
+
+	// A note stored before the limits were lowered keeps its other fields
+	// editable.
+	s.cfg.NoteLimits.TitleChars = 3
+	if rec := patchNote(t, s, n.ID, "*", `{"content":"fits"}`, cookie); rec.Code != http.StatusOK {
+		t.Errorf("patch of another field: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = postImport(t, s, "", "application/json", []byte(`{"version":1,"notes":[{"title":"ok"},{"title":"far too long"}]}`), cookie)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("import over the limits: status %d: %s", rec.Code, rec.Body)
+	}
+	if details := decode[errorResponse](t, rec).Details; len(details) != 1 || !strings.HasSuffix(details[0].Field, "[1].title") {
+		t.Errorf("import details = %+v", details)
+	}
+}
+
+func TestNoteAppearance(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	red := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "red"}, cookie))
+	decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "plain"}, cookie))
+
+	rec := doRequest(t, s, http.MethodPut, "/notes/"+red.ID.String()+"/appearance", map[string]any{"color": "Red", "icon": "👩🏽‍💻"}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if n := decode[store.Note](t, rec); n.Color != "red" || n.Icon != "👩🏽‍💻" || n.Version != red.Version+1 {
+		t.Errorf("note = %q %q v%d", n.Color, n.Icon, n.Version)
+	}
+
+	rec = doRequest(t, s, http.MethodPut, "/notes/"+red.ID.String()+"/appearance", map[string]any{"color": "mauve", "icon": "ab"}, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid appearance: status %d", rec.Code)
+	}
+	if apiErr := decode[errorResponse](t, rec); len(apiErr.Details) != 2 || apiErr.Details[0].Field != "color" || apiErr.Details[1].Field != "icon" {
+		t.Errorf("error = %+v", apiErr)
+	}
+
+	for _, icon := range []string{"📌", "❤️", "🇺🇦", "#️⃣", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", "👨‍👩‍👧"} {
+		if !validIcon(icon) {
+			t.Errorf("validIcon(%q) = false", icon)
+		}
+	}
+	for _, icon := range []string{"a", "📌📌", "🇺", "‍📌", "📌‍", "1"} {
+		if validIcon(icon) {
+			t.Errorf("validIcon(%q) = true", icon)
+		}
+	}
+
+	for query, want := range map[string]string{"red": "red", "none": "plain"} {
+		page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes?color="+query, nil, cookie))
+		if len(page.Items) != 1 || page.Items[0].Title != want {
+			t.Errorf("color=%s: %+v", query, page.Items)
+		}
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/notes?color=mauve", nil, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown color: status %d", rec.Code)
+	}
+}
+
+func TestNoteLocation(t *testing.T) {
+	s := newTestServer(t)
+	cookie := login(t, s)
+
+	paris := decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "paris", "latitude": 48.8566, "longitude": 2.3522}, cookie))
+	if paris.Latitude == nil || *paris.Latitude != 48.8566 || paris.Longitude == nil || *paris.Longitude != 2.3522 {
+		t.Fatalf("location = %v, %v", paris.Latitude, paris.Longitude)
+	}
+	decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "versailles", "latitude": 48.8049, "longitude": 2.1204}, cookie))
+	decode[store.Note](t, doRequest(t, s, http.MethodPost, "/notes", map[string]any{"title": "nowhere"}, cookie))
+
+	// Versailles is about 17 km from the centre of Paris.
+	for query, want := range map[string][]string{
+		"near=48.8566,2.3522":              {"paris"},
+		"near=48.8566,2.3522&radius_km=20": {"paris", "versailles"},
+	} {
+		page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes?sort=title&"+query, nil, cookie))
+		var titles []string
+		for _, n := range page.Items {
+			titles = append(titles, n.Title)
+		}
+		if !slices.Equal(titles, want) {
+			t.Errorf("%s: %v, want %v", query, titles, want)
+		}
+	}
+
+	// A PUT without the fields keeps the note where it is; null clears.
+	if n := decode[store.Note](t, putNote(t, s, "/notes/"+paris.ID.String(), map[string]any{"title": "paris"}, cookie)); n.Location() == nil {
+		t.Error("PUT without a location cleared it")
+	}
+	if n := decode[store.Note](t, patchNote(t, s, paris.ID, "*", `{"latitude":null,"longitude":null}`, cookie)); n.Location() != nil {
+		t.Errorf("location = %+v after clearing", n.Location())
+	}
+
+	for name, body := range map[string]map[string]any{
+		"latitude":  {"title": "x", "latitude": 91, "longitude": 0},
+		"longitude": {"title": "x", "latitude": 0},
+	} {
+		rec := doRequest(t, s, http.MethodPost, "/notes", body, cookie)
+		if apiErr := decode[errorResponse](t, rec); rec.Code != http.StatusBadRequest || len(apiErr.Details) != 1 || apiErr.Details[0].Field != name {
+			t.Errorf("%v: status %d, %+v", body, rec.Code, apiErr)
+		}
+	}
+	for _, query := range []string{"near=91,0", "near=48.8", "near=0,0&radius_km=-1", "radius_km=5"} {
+		if rec := doRequest(t, s, http.MethodGet, "/notes?"+query, nil, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", query, rec.Code)
+		}
+	}
+}
+
+func postEmail(t *testing.T, s *Server, query string, fields map[string]string, files map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	for name, content := range files {
+		part, err := form.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/email"+query, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngestEmail(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	s.clock = clock.NewFake(now)
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	s.cfg.MaxAttachmentBytes = 1 << 10
+	cookie := login(t, s)
+
+	if rec := postEmail(t, s, "", map[string]string{"subject": "x"}, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("disabled: status %d", rec.Code)
+	}
+	secret := strings.Repeat("k", 32)
+	s.cfg.EmailIngestSecret = secret
+
+	sign := func(timestamp time.Time) map[string]string {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts + "tok"))
+		return map[string]string{"timestamp": ts, "token": "tok", "signature": hex.EncodeToString(mac.Sum(nil))}
+	}
+	fields := sign(now)
+	fields["subject"] = "Flight booking"
+	fields["body-plain"] = "SU 1234\r\nSeat 12A"
+	rec := postEmail(t, s, "", fields, map[string]string{"attachment-1": "ticket", "attachment-2": "invoice"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("mailgun: status %d: %s", rec.Code, rec.Body)
+	}
+	n := decode[store.Note](t, rec)
+	if n.Title != "Flight booking" || n.Content != "SU 1234\nSeat 12A" || !slices.Equal(n.Tags, []string{"email"}) {
+		t.Errorf("note = %q %q %v", n.Title, n.Content, n.Tags)
+	}
+	list := decode[struct {
+		Items []store.Attachment `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/attachments", nil, cookie))
+	var names []string
+	for _, a := range list.Items {
+		names = append(names, a.Filename)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"attachment-1.txt", "attachment-2.txt"}) {
+		t.Errorf("attachments = %v", names)
+	}
+
+	rec = postEmail(t, s, "?secret="+secret, map[string]string{"subject": "From SendGrid", "text": "hello"}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("sendgrid: status %d: %s", rec.Code, rec.Body)
+	}
+	if n := decode[store.Note](t, rec); n.Content != "hello" {
+		t.Errorf("sendgrid content = %q", n.Content)
+	}
+
+	forged := sign(now)
+	forged["signature"] = strings.Repeat("0", 64)
+	for name, fields := range map[string]map[string]string{
+		"forged":   forged,
+		"stale":    sign(now.Add(-time.Hour)),
+		"unsigned": {"subject": "x"},
+	} {
+		if rec := postEmail(t, s, "", fields, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d", name, rec.Code)
+		}
+	}
+	if rec := postEmail(t, s, "?secret=wrong", map[string]string{"subject": "x"}, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d", rec.Code)
+	}
+}
+
+func TestCompareFields(t *testing.T) {
+	fields := []string{"attachment10", "attachment-2", "attachment2", "attachment-10", "attachment-1"}
+	slices.SortFunc(fields, compareFields)
+	if want := []string{"attachment2", "attachment10", "attachment-1", "attachment-2", "attachment-10"}; !slices.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
+
+func TestClipPage(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/missing.png":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Field notes</title></head><body><nav><a href="/">Home</a></nav><article>
+<p>The heron stood in the shallows for an hour, perfectly still, before it struck.</p>
+<img src="/photo.png" alt="Heron"><img src="/missing.png">
+</article></body></html>`))
+		}
+	}))
+	defer page.Close()
+
+	s := newTestServer(t)
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	s.cfg.MaxAttachmentBytes = 1 << 10
+	cookie := login(t, s)
+
+	// Out of the box the server refuses to fetch from its own network.
+	if rec := doRequest(t, s, http.MethodPost, "/clip", map[string]any{"url": page.URL + "/heron"}, cookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("loopback: status %d", rec.Code)
+	}
+	s.clipper = clip.New(clip.Options{AllowPrivate: true, MaxPageBytes: 1 << 20})
+	s.cfg.ClipTimeout = 10 * time.Second
+
+	rec := doRequest(t, s, http.MethodPost, "/clip", map[string]any{"url": page.URL + "/heron"}, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("clip: status %d: %s", rec.Code, rec.Body)
+	}
+	n := decode[store.Note](t, rec)
+	list := decode[struct {
+		Items []store.Attachment `json:"items"`
+	}](t, doRequest(t, s, http.MethodGet, "/notes/"+n.ID.String()+"/attachments", nil, cookie))
+	if len(list.Items) != 1 || list.Items[0].Filename != "photo.png" {
+		t.Fatalf("attachments = %+v", list.Items)
+	}
+	want := "Source: <" + page.URL + "/heron>\n\n" +
+		"The heron stood in the shallows for an hour, perfectly still, before it struck.\n\n" +
+		"![Heron](/attachments/" + list.Items[0].ID.String() + ")![](" + page.URL + "/missing.png)"
+	if n.Title != "Field notes" || n.Content != want || !slices.Equal(n.Tags, []string{"clip"}) {
+		t.Errorf("note = %q %q %v", n.Title, n.Content, n.Tags)
+	}
+	if rec := doRequest(t, s, http.MethodGet, "/attachments/"+list.Items[0].ID.String(), nil, cookie); rec.Body.String() != "png" {
+		t.Errorf("attachment = %q", rec.Body)
+	}
+
+	for _, body := range []map[string]any{{"url": "ftp://example.com/x"}, {"url": ""}, {"url": page.URL + "/photo.png"}} {
+		if rec := doRequest(t, s, http.MethodPost, "/clip", body, cookie); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status %d", body, rec.Code)
+		}
+	}
+	if rec := doRequest(t, s, http.MethodPost, "/clip", map[string]any{"url": page.URL + "/missing.png"}, cookie); rec.Code != http.StatusBadGateway {
+		t.Errorf("not found: status %d", rec.Code)
+	}
+}
+
+func postTelegram(t *testing.T, s *Server, secret string, from int64, text string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(telegram.Update{UpdateID: 1, Message: &telegram.Message{
+		MessageID: 7,
+		From:      &telegram.User{ID: from},
+		Chat:      telegram.Chat{ID: from},
+		Text:      text,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/ingest/telegram", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(telegram.SecretHeader, secret)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTelegramBot(t *testing.T) {
+	s := newTestServer(t)
+	if rec := postTelegram(t, s, "", 42, "hello"); rec.Code != http.StatusNotFound {
+		t.Fatalf("disabled: status %d", rec.Code)
+	}
+	s.cfg.TelegramBotToken = "123:abc"
+	s.cfg.TelegramAllowedUsers = []int64{42}
+	s.cfg.AllowedOrigin = "https://notes.example"
+	s.applySettings(s.cfg)
+	secret := telegram.WebhookSecret(s.cfg.TelegramBotToken)
+
+	if rec := postTelegram(t, s, "wrong", 42, "hello"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d", rec.Code)
+	}
+
+	rec := postTelegram(t, s, secret, 42, "Groceries\nmilk\neggs")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("capture: status %d: %s", rec.Code, rec.Body)
+	}
+	reply := decode[telegram.Reply](t, rec)
+	page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes?tag=telegram", nil, login(t, s)))
+	if len(page.Items) != 1 {
+		t.Fatalf("notes = %+v", page.Items)
+	}
+	n := page.Items[0]
+	if n.Title != "Groceries" || n.Content != "milk\neggs" {
+		t.Errorf("note = %q %q", n.Title, n.Content)
+	}
+	if reply.Method != "sendMessage" || reply.ChatID != 42 || reply.ReplyParameters.MessageID != 7 ||
+		!strings.Contains(reply.Text, "https://notes.example/notes?note="+n.ID.String()) {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	for text, want := range map[string]string{
+		"/search milk":           "Groceries",
+		"/search@notes_bot milk": "Groceries",
+		"/search nothing":        "No notes match",
+		"/recent":                "Groceries",
+		"/start":                 "/search",
+	} {
+		reply := decode[telegram.Reply](t, postTelegram(t, s, secret, 42, text))
+		if !strings.Contains(reply.Text, want) {
+			t.Errorf("%s: reply %q", text, reply.Text)
+		}
+	}
+
+	reply = decode[telegram.Reply](t, postTelegram(t, s, secret, 99, "not mine"))
+	if !strings.Contains(reply.Text, "99") {
+		t.Errorf("stranger: reply %q", reply.Text)
+	}
+	if page := decode[notePage](t, doRequest(t, s, http.MethodGet, "/notes", nil, login(t, s))); len(page.Items) != 1 {
+		t.Errorf("%d notes after the stranger and the commands", len(page.Items))
+	}
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sessionTouchInterval is how stale a session's last_seen_at may get
+	// before a request through it writes a new one.
+	sessionTouchInterval = time.Minute
+	maxUserAgent         = 512
+)
+
+// sessionExpiry is when a session created at createdAt expires if it is
+// last used at now: SessionTTL later, but with sliding expiration no later
+// than SessionMaxAge after login.
+func (s *Server) sessionExpiry(createdAt, now time.Time) time.Time {
+	settings := s.settings()
+	expiresAt := now.Add(settings.SessionTTL)
+	if settings.SessionSliding && settings.SessionMaxAge > 0 {
+		if limit := createdAt.Add(settings.SessionMaxAge); expiresAt.After(limit) {
+			return limit
+		}
+	}
+	return expiresAt
+}
+
+// useSession returns the session for token if it is active, recording that
+// it was seen. With sliding expiration it also pushes the expiry out and
+// sends the cookie again, but only once the expiry would move by
+// SessionRefresh, so that busy clients do not write the session on every
+// request.
+func (s *Server) useSession(ctx context.Context, w http.ResponseWriter, token string) (store.Session, bool, error) {
+	now := s.clock.Now()
+	session, err := s.store.GetSession(ctx, token, now)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.Session{}, false, nil
+	}
+	if err != nil {
+		return store.Session{}, false, err
+	}
+
+	expiresAt := session.ExpiresAt
+	if settings := s.settings(); settings.SessionSliding {
+		next := s.sessionExpiry(session.CreatedAt, now)
+		if moved := next.Sub(expiresAt); moved > 0 && moved >= settings.SessionRefresh {
+			expiresAt = next
+		}
+	}
+	if expiresAt.Equal(session.ExpiresAt) && now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return session, true, nil
+	}
+	if err := s.store.TouchSession(ctx, token, now, expiresAt); err != nil {
+		// The session stays as it was.
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("touch session: %v", err)
+		}
+		return session, true, nil
+	}
+	if !expiresAt.Equal(session.ExpiresAt) {
+		s.setSessionCookie(w, token, expiresAt)
+	}
+	session.LastSeenAt, session.ExpiresAt = now, expiresAt
+	return session, true, nil
+}
+
+// startSession signs the client in, answering the login request.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request) {
+	token, err := generateSessionToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to create session")
+		return
+	}
+
+	session := s.newSession(r, s.clock.Now())
+	if err := s.store.CreateSession(r.Context(), token, session); err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	setAuditActor(r.Context(), "session:"+session.ID.String())
+	s.setSessionCookie(w, token, session.ExpiresAt)
+	writeJSON(w, http.StatusOK, okResponse{true})
+}
+
+// newSession describes the session a login from r starts at now.
+func (s *Server) newSession(r *http.Request, now time.Time) store.Session {
+	agent := r.UserAgent()
+	if len(agent) > maxUserAgent {
+		agent = agent[:maxUserAgent]
+		for !utf8.ValidString(agent) {
+			agent = agent[:len(agent)-1]
+		}
+	}
+	return store.Session{
+		ID:         uuid.New(),
+		CreatedAt:  now,
+		ExpiresAt:  s.sessionExpiry(now, now),
+		LastSeenAt: now,
+		UserAgent:  agent,
+		IP:         remoteHost(r),
+	}
+}
+
+type sessionInfo struct {
+	store.Session
+	// Current marks the session the request came with.
+	Current bool `json:"current"`
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	current, _ := r.Context().Value(sessionIDKey).(uuid.UUID)
+	sessions, err := s.store.ListSessions(r.Context(), s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	items := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionInfo{session, session.ID == current})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleDeleteSession signs a session out, which may be the current one.
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	err = s.store.DeleteSessionByID(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeSessionNotFound, "session not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if current, _ := r.Context().Value(sessionIDKey).(uuid.UUID); current == id {
+		s.clearSessionCookie(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type sessionsRevoked struct {
+	Revoked int `json:"revoked"`
+}
+
+// handleRevokeOtherSessions signs out every session but the current one,
+// as after a password change.
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	token, _ := r.Context().Value(sessionTokenKey).(string)
+	revoked, err := s.store.DeleteOtherSessions(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditSummary(r.Context(), "%d session(s)", revoked)
+	writeJSON(w, http.StatusOK, sessionsRevoked{revoked})
+}
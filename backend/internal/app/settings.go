@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxSettingsBytes bounds the stored preferences document.
+const maxSettingsBytes = 16 << 10
+
+// settings is the schema of the preferences document shared by all clients.
+// Every key is optional; a client that does not know a key keeps the value
+// it read, since PUT replaces the whole document.
+type settings struct {
+	DefaultSort     string          `json:"default_sort,omitempty"`
+	DefaultNotebook string          `json:"default_notebook,omitempty"`
+	Theme           string          `json:"theme,omitempty"`
+	Editor          *editorSettings `json:"editor,omitempty"`
+}
+
+type editorSettings struct {
+	FontSize    int    `json:"font_size,omitempty"`
+	LineWrap    *bool  `json:"line_wrap,omitempty"`
+	Spellcheck  *bool  `json:"spellcheck,omitempty"`
+	KeyBindings string `json:"key_bindings,omitempty"`
+}
+
+var (
+	settingsSorts       = []string{"updated", "created", "title", "manual", "length"}
+	settingsThemes      = []string{"system", "light", "dark"}
+	settingsKeyBindings = []string{"default", "vim", "emacs"}
+)
+
+func (v settings) validate() error {
+	if v.DefaultSort != "" && !slices.Contains(settingsSorts, v.DefaultSort) {
+		return &fieldError{Field: "default_sort", Message: fmt.Sprintf("default_sort must be one of %s", strings.Join(settingsSorts, ", "))}
+	}
+	if v.DefaultNotebook != "" {
+		if _, err := uuid.Parse(v.DefaultNotebook); err != nil {
+			return &fieldError{Field: "default_notebook", Message: "default_notebook must be a uuid"}
+		}
+	}
+	if v.Theme != "" && !slices.Contains(settingsThemes, v.Theme) {
+		return &fieldError{Field: "theme", Message: fmt.Sprintf("theme must be one of %s", strings.Join(settingsThemes, ", "))}
+	}
+	if e := v.Editor; e != nil {
+		if e.FontSize != 0 && (e.FontSize < 8 || e.FontSize > 48) {
+			return &fieldError{Field: "editor.font_size", Message: "editor.font_size must be between 8 and 48"}
+		}
+		if e.KeyBindings != "" && !slices.Contains(settingsKeyBindings, e.KeyBindings) {
+			return &fieldError{Field: "editor.key_bindings", Message: fmt.Sprintf("editor.key_bindings must be one of %s", strings.Join(settingsKeyBindings, ", "))}
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	data, err := s.store.Settings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (s *Server) handlePutSettings(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "settings are too large")
+		return
+	}
+
+	var req settings
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid settings: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Re-encoding drops whitespace and normalizes what gets stored.
+	data, err := json.Marshal(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+		return
+	}
+	if err := s.store.SaveSettings(r.Context(), data); err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,279 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"notes-backend/internal/password"
+	"notes-backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// shareSlugBytes makes slugs as hard to guess as session tokens are.
+const shareSlugBytes = 16
+
+type shareResponse struct {
+	store.NoteShare
+	URL         string `json:"url"`
+	HasPassword bool   `json:"has_password"`
+}
+
+func newShareResponse(share store.NoteShare) shareResponse {
+	return shareResponse{share, "/share/" + share.Slug, share.PasswordHash != ""}
+}
+
+type shareRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password"`
+}
+
+// handleShareNote creates a public link to a note, replacing any it had so
+// that sharing again revokes the old link.
+func (s *Server) handleShareNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req shareRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+			return
+		}
+	}
+	now := s.clock.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		writeFieldError(w, "expires_at", "expires_at must be in the future")
+		return
+	}
+	// Encrypted notes cannot be shared, and locking a note deletes the share
+	// it had.
+	n, err := s.store.GetNote(r.Context(), noteID)
+	if err == nil && n.IsEncrypted {
+		err = errNoteEncrypted
+	}
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+
+	raw := make([]byte, shareSlugBytes)
+	if _, err := rand.Read(raw); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to create share")
+		return
+	}
+	share := store.NoteShare{
+		NoteID:    noteID,
+		Slug:      base64.RawURLEncoding.EncodeToString(raw),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+	}
+	if req.Password != "" {
+		if share.PasswordHash, err = password.Hash(req.Password); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to create share")
+			return
+		}
+	}
+	err = s.store.ShareNote(r.Context(), share)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, newShareResponse(share))
+}
+
+func (s *Server) handleUnshareNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	err = s.store.DeleteShare(r.Context(), noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeShareNotFound, "share not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedNote is what viewers of a share see of the note.
+type sharedNote struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	UpdatedAt time.Time `json:"updated_at"`
+	HTML      string    `json:"html"`
+}
+
+// handleGetShare serves a shared note to anyone with the link, as JSON or,
+// for browsers and ?format=html, as a page. Password-protected shares
+// answer with a form and take the password through handleUnlockShare.
+func (s *Server) handleGetShare(w http.ResponseWriter, r *http.Request) {
+	share, ok := s.lookupShare(w, r)
+	if !ok {
+		return
+	}
+	if share.PasswordHash != "" {
+		s.refuseShare(w, r, codePasswordRequired, "password required")
+		return
+	}
+	s.serveShare(w, r, share)
+}
+
+type unlockShareRequest struct {
+	Password string `json:"password"`
+}
+
+func (s *Server) handleUnlockShare(w http.ResponseWriter, r *http.Request) {
+	share, ok := s.lookupShare(w, r)
+	if !ok {
+		return
+	}
+
+	// The page's form posts urlencoded; API clients send JSON, whatever
+	// Content-Type curl -d puts on it.
+	var plain string
+	if wantsHTML(r) {
+		plain = r.PostFormValue("password")
+	} else {
+		var req unlockShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+			return
+		}
+		plain = req.Password
+	}
+	if share.PasswordHash != "" {
+		matches, err := password.Verify(share.PasswordHash, plain)
+		if err != nil {
+			log.Printf("verify share password: %v", err)
+		}
+		if !matches {
+			s.refuseShare(w, r, codeInvalidPassword, "invalid password")
+			return
+		}
+	}
+	s.serveShare(w, r, share)
+}
+
+// lookupShare answers 404 alike for unknown, expired and trashed shares.
+func (s *Server) lookupShare(w http.ResponseWriter, r *http.Request) (store.NoteShare, bool) {
+	setShareHeaders(w)
+	share, err := s.store.ShareBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err == nil && share.ExpiresAt != nil && !share.ExpiresAt.After(s.clock.Now()) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeShareNotFound, "share not found")
+		return store.NoteShare{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return store.NoteShare{}, false
+	}
+	return share, true
+}
+
+func (s *Server) serveShare(w http.ResponseWriter, r *http.Request, share store.NoteShare) {
+	n, err := s.store.GetNote(r.Context(), share.NoteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeShareNotFound, "share not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	rendered := s.markdown.Render(n.Content)
+	if !wantsHTML(r) {
+		writeJSON(w, http.StatusOK, sharedNote{n.Title, n.Content, n.Tags, n.UpdatedAt, rendered})
+		return
+	}
+	// The renderer escapes raw HTML, so its output is safe to inline.
+	writeSharePage(w, http.StatusOK, sharePage{Title: n.Title, Body: template.HTML(rendered)})
+}
+
+func (s *Server) refuseShare(w http.ResponseWriter, r *http.Request, code, message string) {
+	if !wantsHTML(r) {
+		writeError(w, http.StatusUnauthorized, code, message)
+		return
+	}
+	writeSharePage(w, http.StatusUnauthorized, sharePage{Title: "Shared note", Locked: true, Error: message})
+}
+
+// setShareHeaders keeps shared pages out of search engines and frames and
+// keeps their URLs out of the Referer of links in them.
+func setShareHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src http: https:; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private, no-store")
+}
+
+// wantsHTML prefers ?format= and falls back to whether the client asks for
+// HTML at all, which browsers do and API clients rarely do.
+func wantsHTML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		return true
+	case "json":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+type sharePage struct {
+	Title  string
+	Body   template.HTML
+	Locked bool
+	Error  string
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{if .Title}}{{.Title}}{{else}}Untitled{{end}}</title>
+<style>body{max-width:46rem;margin:2rem auto;padding:0 1rem;font:16px/1.6 system-ui,sans-serif}img{max-width:100%}pre{overflow-x:auto}</style>
+</head>
+<body>
+{{if .Locked}}<form method="post">
+<p>This note is protected by a password.</p>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+{{else}}<h1>{{if .Title}}{{.Title}}{{else}}Untitled{{end}}</h1>
+{{.Body}}
+{{end}}</body>
+</html>
+`))
+
+func writeSharePage(w http.ResponseWriter, status int, page sharePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := shareTemplate.Execute(w, page); err != nil {
+		log.Printf("render share page: %v", err)
+	}
+}
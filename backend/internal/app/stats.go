@@ -0,0 +1,149 @@
+package app
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type noteStats struct {
+	Notes              int             `json:"notes"`
+	Words              int             `json:"words"`
+	Chars              int             `json:"chars"`
+	ReadingTimeSeconds int             `json:"reading_time_seconds"`
+	Tags               []tagStats      `json:"tags"`
+	Notebooks          []notebookStats `json:"notebooks"`
+	// Weeks counts the notes created in each of the last weeks, oldest
+	// first.
+	Weeks []weekStats `json:"weeks"`
+}
+
+type tagStats struct {
+	Tag   string `json:"tag"`
+	Notes int    `json:"notes"`
+	Words int    `json:"words"`
+}
+
+// notebookStats has a nil NotebookID for the notes in no notebook.
+type notebookStats struct {
+	NotebookID *uuid.UUID `json:"notebook_id"`
+	Name       string     `json:"name"`
+	Notes      int        `json:"notes"`
+	Words      int        `json:"words"`
+}
+
+type weekStats struct {
+	// Start is the Monday the week starts on, in TIME_ZONE.
+	Start string `json:"start"`
+	Notes int    `json:"notes"`
+}
+
+// handleStats adds up the live notes: in all, per tag, per notebook and,
+// for the last weeks given (12 by default), per week of creation.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	weeks := min(parsePositiveInt(r.URL.Query().Get("weeks"), 12), 104)
+	sizes, err := s.store.ListNoteSizes(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	notebooks, err := s.store.ListNotebooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	stats := noteStats{Tags: []tagStats{}, Notebooks: []notebookStats{}}
+	tags := make(map[string]*tagStats)
+	books := make(map[uuid.UUID]*notebookStats)
+	for _, nb := range notebooks {
+		books[nb.ID] = &notebookStats{NotebookID: &nb.ID, Name: nb.Name}
+	}
+	books[uuid.Nil] = &notebookStats{}
+
+	loc := s.cfg.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	first := weekStart(s.clock.Now().In(loc)).AddDate(0, 0, -7*(weeks-1))
+	created := make([]int, weeks)
+
+	for _, size := range sizes {
+		stats.Notes++
+		stats.Words += size.Words
+		stats.Chars += size.Chars
+		for _, tag := range size.Tags {
+			t, ok := tags[tag]
+			if !ok {
+				t = &tagStats{Tag: tag}
+				tags[tag] = t
+			}
+			t.Notes++
+			t.Words += size.Words
+		}
+		book := uuid.Nil
+		if size.NotebookID != nil {
+			book = *size.NotebookID
+		}
+		if b, ok := books[book]; ok {
+			b.Notes++
+			b.Words += size.Words
+		}
+		// Days rather than a division of durations, so weeks around DST
+		// changes keep their notes.
+		if at := size.CreatedAt.In(loc); !at.Before(first) {
+			if week := daysBetween(first, at) / 7; week < weeks {
+				created[week]++
+			}
+		}
+	}
+	stats.ReadingTimeSeconds = store.ReadingTime(stats.Words)
+
+	for _, t := range tags {
+		stats.Tags = append(stats.Tags, *t)
+	}
+	slices.SortFunc(stats.Tags, func(a, b tagStats) int {
+		return cmp.Or(b.Notes-a.Notes, cmp.Compare(a.Tag, b.Tag))
+	})
+	for _, b := range books {
+		if b.Notes > 0 {
+			stats.Notebooks = append(stats.Notebooks, *b)
+		}
+	}
+	slices.SortFunc(stats.Notebooks, func(a, b notebookStats) int {
+		return cmp.Or(b.Notes-a.Notes, cmp.Compare(a.Name, b.Name))
+	})
+	for i, count := range created {
+		stats.Weeks = append(stats.Weeks, weekStats{Start: first.AddDate(0, 0, 7*i).Format(time.DateOnly), Notes: count})
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// weekStart is midnight of the Monday starting t's week, in t's location.
+func weekStart(t time.Time) time.Time {
+	days := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts the calendar days from from to to, both in the same
+// location.
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a) / (24 * time.Hour))
+}
+
+// handleNoteCounts returns every number a sidebar badges at once.
+func (s *Server) handleNoteCounts(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.store.CountNotes(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, counts)
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"notes-backend/internal/backup"
+	"notes-backend/internal/config"
+	"notes-backend/internal/dump"
+	"notes-backend/internal/encrypt"
+	"notes-backend/internal/migrate"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/postgres"
+	"notes-backend/internal/store/replica"
+	"notes-backend/internal/store/sqldb"
+	"notes-backend/internal/tracing"
+	"notes-backend/migrations"
+)
+
+type migratingStore interface {
+	store.Store
+	Migrator(fsys fs.FS) *migrate.Migrator
+}
+
+// openStore also returns the migrator it applied the migrations with, for
+// the readiness probe to check the schema with later. Queries are traced
+// with tracer, which may be nil.
+func openStore(ctx context.Context, cfg config.Config, tracer *tracing.Tracer) (store.Store, *migrate.Migrator, error) {
+	st, migrator, err := connectStore(ctx, cfg, tracer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		st.Close()
+		return nil, nil, fmt.Errorf("migrations: %w", err)
+	}
+	if cfg.ReplicaURL != "" {
+		st = replica.New(st, func(ctx context.Context) (store.Store, error) {
+			return openReplica(ctx, cfg, tracer)
+		})
+	}
+	if len(cfg.EncryptionKeys) > 0 {
+		keys, err := keyring(cfg)
+		if err != nil {
+			st.Close()
+			return nil, nil, err
+		}
+		return encrypt.NewStore(st, keys), migrator, nil
+	}
+	return st, migrator, nil
+}
+
+// openBlobs returns the configured attachment store, or nil when none is
+// configured.
+func openBlobs(cfg config.Config) (storage.BlobStore, error) {
+	var (
+		blobs storage.BlobStore
+		err   error
+	)
+	switch cfg.AttachmentsBackend {
+	case "":
+		return nil, nil
+	case "s3":
+		blobs, err = storage.NewS3(cfg.S3)
+	default:
+		blobs, err = storage.NewLocal(cfg.AttachmentsDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.EncryptionKeys) > 0 {
+		keys, err := keyring(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewBlobStore(blobs, keys), nil
+	}
+	return blobs, nil
+}
+
+// openBackups returns the backup manager for the configured backend.
+// Backups hold notes as the store returns them, decrypted.
+func openBackups(cfg config.Config, st dump.Store) (*backup.Manager, error) {
+	opts := backup.Options{Format: cfg.BackupFormat, Keep: cfg.BackupKeep, DatabaseURL: cfg.DatabaseURL}
+	var (
+		target backup.Target
+		err    error
+	)
+	switch cfg.BackupBackend {
+	case "s3":
+		target, err = storage.NewS3(cfg.S3)
+		opts.Prefix = cfg.BackupS3Prefix
+	default:
+		target, err = storage.NewLocal(cfg.BackupDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backups: %w", err)
+	}
+	return backup.New(st, target, opts), nil
+}
+
+// OpenBlobStore returns the configured attachment store for commands that
+// run without the HTTP server.
+func OpenBlobStore(cfg config.Config) (storage.BlobStore, error) {
+	return openBlobs(cfg)
+}
+
+func keyring(cfg config.Config) (*encrypt.Keyring, error) {
+	return encrypt.NewKeyring(cfg.EncryptionKeys[0], cfg.EncryptionKeys[1:]...)
+}
+
+// OpenStore connects to the configured database and applies pending
+// migrations, for commands that need the store without the HTTP server.
+func OpenStore(ctx context.Context, cfg config.Config) (store.Store, error) {
+	st, _, err := openStore(ctx, cfg, nil)
+	return st, err
+}
+
+// OpenMigrator connects to the configured database without starting the
+// HTTP server, for out-of-band migration commands. The returned func closes
+// the connection.
+func OpenMigrator(ctx context.Context, cfg config.Config) (*migrate.Migrator, func(), error) {
+	st, migrator, err := connectStore(ctx, cfg, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrator, st.Close, nil
+}
+
+// connectStore traces queries only on the pgx store; the database/sql
+// drivers of SQLite and MySQL are not instrumented.
+func connectStore(ctx context.Context, cfg config.Config, tracer *tracing.Tracer) (store.Store, *migrate.Migrator, error) {
+	var (
+		st  migratingStore
+		err error
+	)
+	switch cfg.DatabaseDriver {
+	case "sqlite":
+		st, err = sqldb.OpenSQLite(ctx, cfg.DatabaseURL)
+	case "mysql":
+		st, err = sqldb.OpenMySQL(ctx, cfg.DatabaseURL)
+	default:
+		// CockroachDB speaks the Postgres wire protocol and uses the pgx
+		// store; only its migrations differ.
+		st, err = postgres.Open(ctx, cfg.DatabaseURL, poolOptions(cfg, tracer))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrationsFS, err := migrationsFor(cfg)
+	if err != nil {
+		st.Close()
+		return nil, nil, err
+	}
+	return st, st.Migrator(migrationsFS), nil
+}
+
+// openReplica connects to DATABASE_URL_READONLY with the driver and
+// options of the primary. Its schema is the primary's, so no migrations are
+// run against it. SQLite has no replicas; the config refuses one.
+func openReplica(ctx context.Context, cfg config.Config, tracer *tracing.Tracer) (store.Store, error) {
+	switch cfg.DatabaseDriver {
+	case "mysql":
+		return sqldb.OpenMySQL(ctx, cfg.ReplicaURL)
+	case "postgres", "cockroach":
+		return postgres.Open(ctx, cfg.ReplicaURL, poolOptions(cfg, tracer))
+	}
+	return nil, fmt.Errorf("DATABASE_URL_READONLY cannot be used with %s", cfg.DatabaseDriver)
+}
+
+func poolOptions(cfg config.Config, tracer *tracing.Tracer) postgres.Options {
+	return postgres.Options{
+		StatementTimeout: cfg.StatementTimeout,
+		Tracer:           tracer,
+		MaxConns:         int32(cfg.DBMaxConns),
+		MinConns:         int32(cfg.DBMinConns),
+		MaxConnLifetime:  cfg.DBMaxConnLifetime,
+		ConnectTimeout:   cfg.DBConnectTimeout,
+	}
+}
+
+// migrationsFor returns the embedded migrations for the configured driver,
+// or the on-disk copy when MIGRATIONS_DIR points at a checkout during
+// development.
+func migrationsFor(cfg config.Config) (fs.FS, error) {
+	if cfg.MigrationsDir != "" {
+		return os.DirFS(filepath.Join(cfg.MigrationsDir, cfg.DatabaseDriver)), nil
+	}
+	sub, err := fs.Sub(migrations.FS, cfg.DatabaseDriver)
+	if err != nil {
+		return nil, fmt.Errorf("embedded migrations for %s: %w", cfg.DatabaseDriver, err)
+	}
+	return sub, nil
+}
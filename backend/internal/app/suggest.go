@@ -0,0 +1,56 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const maxSuggestions = 50
+
+type suggestions struct {
+	Titles []titleSuggestion `json:"titles"`
+	Tags   []store.TagCount  `json:"tags"`
+}
+
+type titleSuggestion struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+}
+
+// handleSuggest completes what is being typed into a search: the titles
+// that contain q, or it with a typo, starting with it first, and the tags
+// that start with it, most used first.
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	q := store.NormalizeText(strings.TrimSpace(r.URL.Query().Get("q")))
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 10), maxSuggestions)
+	found := suggestions{Titles: []titleSuggestion{}, Tags: []store.TagCount{}}
+	if q == "" {
+		writeJSON(w, http.StatusOK, found)
+		return
+	}
+
+	notes, err := s.store.SuggestTitles(r.Context(), q, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	for _, n := range notes {
+		found.Titles = append(found.Titles, titleSuggestion{ID: n.ID, Title: n.Title})
+	}
+	counts, err := s.store.ListTags(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	prefix := store.FoldText(strings.TrimPrefix(q, "#"))
+	for _, tag := range counts {
+		if len(found.Tags) < limit && strings.HasPrefix(store.FoldText(tag.Name), prefix) {
+			found.Tags = append(found.Tags, tag)
+		}
+	}
+	writeJSON(w, http.StatusOK, found)
+}
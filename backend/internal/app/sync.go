@@ -0,0 +1,313 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/validate"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxSyncPage    = 500
+	maxSyncChanges = 500
+)
+
+type syncResponse struct {
+	// Seq is what the next request passes as since: the next page while
+	// HasMore, otherwise the next sync.
+	Seq     int64 `json:"seq"`
+	HasMore bool  `json:"has_more"`
+	// Changed are the live notes written since, and Deleted the notes
+	// trashed or purged since. Each note is listed once, as it now stands.
+	Changed []store.Note `json:"changed"`
+	Deleted []uuid.UUID  `json:"deleted"`
+}
+
+// handleSync lists what changed after the seq a client last synced to, for
+// clients that keep a copy of the notes and work offline. since=0 lists
+// every note there is. A note may be listed again by the next sync, so
+// clients apply changes by version.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	since := int64(0)
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = strconv.ParseInt(raw, 10, 64); err != nil || since < 0 {
+			writeFieldError(w, "since", "since must be a seq returned by an earlier sync")
+			return
+		}
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 100), maxSyncPage)
+
+	page, err := s.store.ListNoteChanges(r.Context(), since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	last := make(map[uuid.UUID]store.NoteChange, len(page.Changes))
+	var order []uuid.UUID
+	for _, change := range page.Changes {
+		if _, ok := last[change.ID]; !ok {
+			order = append(order, change.ID)
+		}
+		last[change.ID] = change
+	}
+	resp := syncResponse{Seq: page.Seq, HasMore: page.More, Changed: []store.Note{}, Deleted: []uuid.UUID{}}
+	for _, id := range order {
+		if n := last[id].Note; n != nil && n.DeletedAt == nil {
+			resp.Changed = append(resp.Changed, *n)
+		} else {
+			resp.Deleted = append(resp.Deleted, id)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// syncChange is a write a client made while offline, to the version of
+// the note it last synced. It carries the whole note, which replaces the
+// server's.
+type syncChange struct {
+	ID uuid.UUID `json:"id"`
+	// BaseVersion is 0 for a note the client created, under an ID of its
+	// choosing.
+	BaseVersion int64      `json:"base_version"`
+	Deleted     bool       `json:"deleted"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	Tags        []string   `json:"tags"`
+	IsFavorite  bool       `json:"is_favorite"`
+	Language    string     `json:"language"`
+	NotebookID  *uuid.UUID `json:"notebook_id"`
+}
+
+type syncPushRequest struct {
+	Changes []syncChange `json:"changes"`
+}
+
+type syncResult struct {
+	ID uuid.UUID `json:"id"`
+	// Status is applied, or not_found when the note has been deleted. A
+	// note written since BaseVersion is a conflict, unless CONFLICT_STRATEGY
+	// resolves it: overwritten, where the change was applied over that,
+	// or forked, where it was saved as Copy instead.
+	Status string `json:"status"`
+	// Note is the note as it now stands: the change applied, or the
+	// server's copy, which it was not applied to.
+	Note *store.Note `json:"note,omitempty"`
+	Copy *store.Note `json:"copy,omitempty"`
+}
+
+type syncPushResponse struct {
+	Results []syncResult `json:"results"`
+}
+
+// handlePushSync applies a client's offline changes in order. Each applies
+// only to the version it was made to; a change to a note written since
+// reports a conflict and the server's copy for the client to merge and
+// send again. An invalid change rejects the whole request.
+func (s *Server) handlePushSync(w http.ResponseWriter, r *http.Request) {
+	var req syncPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if len(req.Changes) == 0 {
+		writeFieldError(w, "changes", "changes are required")
+		return
+	}
+	if len(req.Changes) > maxSyncChanges {
+		writeFieldError(w, "changes", fmt.Sprintf("at most %d changes per request", maxSyncChanges))
+		return
+	}
+
+	notebooks, err := s.store.ListNotebooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	var invalid []error
+	for i, c := range req.Changes {
+		field := fmt.Sprintf("changes[%d]", i)
+		switch {
+		case c.ID == uuid.Nil:
+			invalid = append(invalid, &validate.FieldError{Field: field + ".id", Message: field + ": id is required"})
+		case c.Deleted && c.BaseVersion == 0:
+			invalid = append(invalid, &validate.FieldError{Field: field + ".base_version", Message: field + ": base_version is required to delete"})
+		case c.BaseVersion < 0:
+			invalid = append(invalid, &validate.FieldError{Field: field + ".base_version", Message: field + ": base_version must not be negative"})
+		}
+		if c.Deleted {
+			continue
+		}
+		if language, ok := parseLanguage(c.Language); !ok {
+			invalid = append(invalid, &validate.FieldError{Field: field + ".language", Message: field + ": unsupported language"})
+		} else {
+			req.Changes[i].Language = language
+		}
+		if c.NotebookID != nil && *c.NotebookID != uuid.Nil &&
+			!slices.ContainsFunc(notebooks, func(nb store.Notebook) bool { return nb.ID == *c.NotebookID }) {
+			invalid = append(invalid, &validate.FieldError{Field: field + ".notebook_id", Message: field + ": notebook not found"})
+		}
+		title, content, tags := syncTitle(c.Title), store.NormalizeText(c.Content), sanitizeTags(c.Tags)
+		if err := s.cfg.NoteLimits.Note(title, content, tags); err != nil {
+			invalid = append(invalid, validate.Prefix(err, field))
+		}
+	}
+	if len(invalid) > 0 {
+		writeLimitError(w, errors.Join(invalid...))
+		return
+	}
+
+	results := make([]syncResult, len(req.Changes))
+	applied := 0
+	for i, c := range req.Changes {
+		result, err := s.applySyncChange(r.Context(), c)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+		if result.Status == "applied" || result.Status == resolutionOverwritten {
+			applied++
+		}
+		results[i] = result
+	}
+	setAuditSummary(r.Context(), "%d of %d change(s) applied", applied, len(req.Changes))
+	writeJSON(w, http.StatusOK, syncPushResponse{results})
+}
+
+func (s *Server) applySyncChange(ctx context.Context, c syncChange) (syncResult, error) {
+	result := syncResult{ID: c.ID, Status: "applied"}
+	current, err := s.store.GetNote(ctx, c.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return syncResult{}, err
+	}
+	found := err == nil
+
+	notebookID := c.NotebookID
+	if notebookID == nil {
+		notebookID = &uuid.Nil
+	}
+	input := store.NoteInput{
+		Title:      syncTitle(c.Title),
+		Content:    store.NormalizeText(c.Content),
+		Tags:       sanitizeTags(c.Tags),
+		IsFavorite: c.IsFavorite,
+		Language:   c.Language,
+		NotebookID: notebookID,
+		IfVersion:  c.BaseVersion,
+	}
+	switch {
+	case c.BaseVersion == 0 && !found:
+		// The ID may be a trashed note's, which GetNote does not see; the
+		// client is told of it rather than the trash overwritten.
+		trashed, _, err := s.store.ListNotes(ctx, store.NoteFilter{IDs: []uuid.UUID{c.ID}, Trashed: true, Limit: 1, SkipCount: true})
+		if err != nil {
+			return syncResult{}, err
+		}
+		if len(trashed) > 0 {
+			result.Status, result.Note = "conflict", &trashed[0]
+			return result, nil
+		}
+		n := s.syncNote(c)
+		if err := s.store.InsertNote(ctx, n); err != nil {
+			return syncResult{}, err
+		}
+		if err := s.store.SetLinks(ctx, n.ID, store.LinkTargets(n.Content)); err != nil {
+			return syncResult{}, err
+		}
+		if n, err = s.store.GetNote(ctx, n.ID); err != nil {
+			return syncResult{}, err
+		}
+		result.Note = &n
+		return result, nil
+	case !found:
+		result.Status = "not_found"
+		return result, nil
+	case c.Deleted:
+		// Deleting a note written since only goes ahead when the last write
+		// wins; the trash keeps it then. There is nothing to fork.
+		if c.BaseVersion != current.Version && s.cfg.ConflictStrategy != "last-write-wins" {
+			result.Status, result.Note = "conflict", &current
+			return result, nil
+		}
+		if err := s.store.DeleteNote(ctx, c.ID, s.clock.Now()); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				result.Status = "not_found"
+				return result, nil
+			}
+			return syncResult{}, err
+		}
+		if c.BaseVersion != current.Version {
+			result.Status = resolutionOverwritten
+		}
+		return result, nil
+	case c.BaseVersion != current.Version:
+		return s.resolveSyncConflict(ctx, c.ID, input)
+	}
+
+	n, err := s.updateNote(ctx, c.ID, input)
+	// A locked note keeps its content, so a change to that conflicts too.
+	if errors.Is(err, store.ErrConflict) || errors.Is(err, errNoteEncrypted) {
+		return s.resolveSyncConflict(ctx, c.ID, input)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return syncResult{ID: c.ID, Status: "not_found"}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	result.Note = &n
+	return result, nil
+}
+
+func (s *Server) resolveSyncConflict(ctx context.Context, id uuid.UUID, input store.NoteInput) (syncResult, error) {
+	resolved, err := s.resolveConflict(ctx, id, input)
+	if errors.Is(err, store.ErrNotFound) {
+		return syncResult{ID: id, Status: "not_found"}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	result := syncResult{ID: id, Status: resolved.Resolution, Note: &resolved.Note, Copy: resolved.Copy}
+	if resolved.Resolution == resolutionRejected {
+		result.Status = "conflict"
+	}
+	return result, nil
+}
+
+// syncNote is the note a client created offline, as it is stored.
+func (s *Server) syncNote(c syncChange) store.Note {
+	now := s.clock.Now()
+	n := store.Note{
+		ID:         c.ID,
+		Title:      syncTitle(c.Title),
+		Content:    store.NormalizeText(c.Content),
+		Tags:       sanitizeTags(c.Tags),
+		IsFavorite: c.IsFavorite,
+		Language:   store.LanguageOr(c.Language, s.cfg.DefaultLanguage),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Version:    1,
+	}
+	if c.NotebookID != nil && *c.NotebookID != uuid.Nil {
+		n.NotebookID = c.NotebookID
+	}
+	n.SetStats(store.MeasureText(n.Content))
+	return n
+}
+
+func syncTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Untitled"
+	}
+	return store.NormalizeText(title)
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxMergeTags = 100
+
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	var cacheKey string
+	if s.cache != nil {
+		seq, err := s.store.ChangeSeq(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+			return
+		}
+		cacheKey = "tags:" + strconv.FormatInt(seq, 10)
+		if s.cachedResponse(w, r, cacheKey) {
+			return
+		}
+	}
+	items, err := s.store.ListTags(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	s.writeCachedJSON(w, r, cacheKey, map[string]any{"items": items})
+}
+
+type renameTagRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// handleRenameTag renames a tag on every note; renaming it to a tag in use
+// merges the two.
+func (s *Server) handleRenameTag(w http.ResponseWriter, r *http.Request) {
+	var req renameTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	from, to := normalizeTag(req.From), normalizeTag(req.To)
+	if from == "" || to == "" {
+		writeError(w, http.StatusBadRequest, codeValidationFailed, "from and to are required")
+		return
+	}
+	if from == to {
+		writeError(w, http.StatusBadRequest, codeValidationFailed, "from and to are the same tag")
+		return
+	}
+	s.replaceTags(w, r, []string{from}, to)
+}
+
+type mergeTagsRequest struct {
+	From []string `json:"from"`
+	To   string   `json:"to"`
+}
+
+// handleMergeTags replaces several tags with one, which may be one of them.
+func (s *Server) handleMergeTags(w http.ResponseWriter, r *http.Request) {
+	var req mergeTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if len(req.From) > maxMergeTags {
+		writeFieldError(w, "from", fmt.Sprintf("at most %d tags per merge", maxMergeTags))
+		return
+	}
+	to := normalizeTag(req.To)
+	if to == "" {
+		writeFieldError(w, "to", "to is required")
+		return
+	}
+	from := slices.DeleteFunc(sanitizeTags(req.From), func(t string) bool { return t == to })
+	if len(from) == 0 {
+		writeFieldError(w, "from", "from needs a tag other than to")
+		return
+	}
+	s.replaceTags(w, r, from, to)
+}
+
+// handleDeleteTag strips a tag from every note.
+func (s *Server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	// chi matches the escaped path when it differs from the decoded one,
+	// as it does for tags with a slash.
+	if r.URL.RawPath != "" {
+		var err error
+		if name, err = url.PathUnescape(name); err != nil {
+			writeFieldError(w, "name", "invalid tag")
+			return
+		}
+	}
+	tag := normalizeTag(name)
+	if tag == "" {
+		writeFieldError(w, "name", "invalid tag")
+		return
+	}
+	s.replaceTags(w, r, []string{tag}, "")
+}
+
+// tagsUpdated counts the notes a tag change rewrote.
+type tagsUpdated struct {
+	Updated int `json:"updated"`
+}
+
+// replaceTags answers 404 when no note, trashed ones included, had any of
+// from, so that typos do not pass for success.
+func (s *Server) replaceTags(w http.ResponseWriter, r *http.Request, from []string, to string) {
+	updated, err := s.store.ReplaceTags(r.Context(), from, to, s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if updated == 0 {
+		writeError(w, http.StatusNotFound, codeTagNotFound, "tag not found")
+		return
+	}
+	if to == "" {
+		setAuditEntity(r.Context(), from[0])
+		setAuditSummary(r.Context(), "removed from %d note(s)", updated)
+	} else {
+		setAuditEntity(r.Context(), to)
+		setAuditSummary(r.Context(), "%s into %s on %d note(s)", strings.Join(from, ", "), to, updated)
+	}
+	writeJSON(w, http.StatusOK, tagsUpdated{updated})
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/markdown"
+	"notes-backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// noteTask is a task list item of a note. Its ID is the note's followed by
+// the task's index in it, so it shifts when tasks are added above it;
+// Version lets a toggle fail instead of hitting the wrong one.
+type noteTask struct {
+	ID        string    `json:"id"`
+	NoteID    uuid.UUID `json:"note_id"`
+	NoteTitle string    `json:"note_title"`
+	Version   int64     `json:"version"`
+	markdown.Task
+}
+
+func noteTasks(n store.Note, done *bool) []noteTask {
+	tasks := []noteTask{}
+	for i, t := range markdown.Tasks(n.Content) {
+		if done == nil || *done == t.Done {
+			tasks = append(tasks, noteTask{ID: fmt.Sprintf("%s-%d", n.ID, i), NoteID: n.ID, NoteTitle: n.Title, Version: n.Version, Task: t})
+		}
+	}
+	return tasks
+}
+
+// parseTaskID splits a task ID into its note's ID and its index.
+func parseTaskID(raw string) (uuid.UUID, int, bool) {
+	if len(raw) < 38 || raw[36] != '-' {
+		return uuid.Nil, 0, false
+	}
+	noteID, err := uuid.Parse(raw[:36])
+	if err != nil {
+		return uuid.Nil, 0, false
+	}
+	index, err := strconv.Atoi(raw[37:])
+	if err != nil || index < 0 {
+		return uuid.Nil, 0, false
+	}
+	return noteID, index, true
+}
+
+func parseDoneFilter(r *http.Request) (*bool, bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("done"))
+	if raw == "" {
+		return nil, true
+	}
+	done, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, false
+	}
+	return &done, true
+}
+
+func (s *Server) handleNoteTasks(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	done, ok := parseDoneFilter(r)
+	if !ok {
+		writeFieldError(w, "done", "done must be true or false")
+		return
+	}
+	n, err := s.store.GetNote(r.Context(), noteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": noteTasks(n, done)})
+}
+
+// handleListTasks gathers the tasks of every live note that is not
+// archived, most recently updated notes first.
+func (s *Server) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	done, ok := parseDoneFilter(r)
+	if !ok {
+		writeFieldError(w, "done", "done must be true or false")
+		return
+	}
+	tasks, err := s.allTasks(r.Context(), done)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": tasks})
+}
+
+func (s *Server) allTasks(ctx context.Context, done *bool) ([]noteTask, error) {
+	const pageSize = 500
+	archived := false
+	tasks := []noteTask{}
+	for offset := 0; ; offset += pageSize {
+		items, _, err := s.store.ListNotes(ctx, store.NoteFilter{Archived: &archived, Limit: pageSize, Offset: offset, SkipCount: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range items {
+			tasks = append(tasks, noteTasks(n, done)...)
+		}
+		if len(items) < pageSize {
+			return tasks, nil
+		}
+	}
+}
+
+type toggleTaskRequest struct {
+	Done *bool `json:"done"`
+}
+
+// handleToggleTask flips a task, or sets it to done when the body gives
+// it, by rewriting its checkbox in the note. An If-Match with the task's
+// version makes it fail with 412 when the note changed since.
+func (s *Server) handleToggleTask(w http.ResponseWriter, r *http.Request) {
+	noteID, index, ok := parseTaskID(chi.URLParam(r, "id"))
+	if !ok {
+		writeFieldError(w, "id", "invalid task id")
+		return
+	}
+	var req toggleTaskRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+			return
+		}
+	}
+
+	current, err := s.store.GetNote(r.Context(), noteID)
+	if err != nil {
+		writeNoteError(w, err)
+		return
+	}
+	if ifMatch := strings.TrimSpace(r.Header.Get("If-Match")); ifMatch != "" {
+		if version := ifMatchVersion(ifMatch); version != 0 && version != current.Version {
+			w.Header().Set("ETag", noteETag(current))
+			writeJSON(w, http.StatusPreconditionFailed, current)
+			return
+		}
+	}
+	tasks := markdown.Tasks(current.Content)
+	if index >= len(tasks) {
+		writeError(w, http.StatusNotFound, codeTaskNotFound, "task not found")
+		return
+	}
+	value := !tasks[index].Done
+	if req.Done != nil {
+		value = *req.Done
+	}
+	content, _ := markdown.SetTask(current.Content, index, value)
+
+	n, err := s.updateNote(r.Context(), noteID, store.NoteInput{
+		Title:      current.Title,
+		Content:    content,
+		Tags:       current.Tags,
+		IsFavorite: current.IsFavorite,
+		Language:   current.Language,
+		IfVersion:  current.Version,
+	})
+	if err != nil {
+		s.writeUpdatedNote(w, r, noteID, n, err)
+		return
+	}
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusOK, noteTasks(n, nil)[index])
+}
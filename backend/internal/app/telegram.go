@@ -0,0 +1,153 @@
+package app
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/telegram"
+)
+
+// telegramTag marks the notes made from Telegram messages.
+const telegramTag = "telegram"
+
+// telegramListLimit is how many notes /search and /recent answer with.
+const telegramListLimit = 5
+
+const telegramHelp = `Send me a message and I'll save it as a note: the first line becomes the title.
+
+/search <words> finds notes
+/recent lists the notes updated last`
+
+// handleTelegram is the webhook of the bot: a message becomes a note
+// tagged telegram and is answered with its link, while /search and
+// /recent answer with notes. Replies go back in the response, as Telegram
+// allows webhooks to, so the bot never calls the API itself.
+func (s *Server) handleTelegram(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.TelegramBotToken == "" {
+		writeError(w, http.StatusNotFound, codeIngestDisabled, "telegram bot is disabled")
+		return
+	}
+	secret := r.Header.Get(telegram.SecretHeader)
+	if secret == "" || !hmac.Equal([]byte(secret), []byte(telegram.WebhookSecret(s.cfg.TelegramBotToken))) {
+		writeError(w, http.StatusUnauthorized, codeInvalidToken, "invalid secret token")
+		return
+	}
+
+	var update telegram.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	msg := update.Message
+	// Photos, stickers and the like carry no text; telling Telegram they
+	// were handled keeps it from sending them again.
+	if msg == nil || msg.From == nil || strings.TrimSpace(msg.Text) == "" {
+		skipAudit(r.Context())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	setAuditActor(r.Context(), "telegram:"+strconv.FormatInt(msg.From.ID, 10))
+	if !slices.Contains(s.cfg.TelegramAllowedUsers, msg.From.ID) {
+		skipAudit(r.Context())
+		writeJSON(w, http.StatusOK, telegram.ReplyTo(msg, fmt.Sprintf("Sorry, this bot only takes notes for its owner. Your user ID is %d.", msg.From.ID)))
+		return
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if command, args, ok := telegramCommand(text); ok {
+		skipAudit(r.Context())
+		var reply string
+		switch command {
+		case "search":
+			if args == "" {
+				reply = "Usage: /search <words>"
+				break
+			}
+			reply = s.telegramNotes(r, store.NoteFilter{Query: args, Language: s.cfg.DefaultLanguage}, "No notes match "+args+".")
+		case "recent":
+			archived := false
+			reply = s.telegramNotes(r, store.NoteFilter{Archived: &archived, Sort: store.SortUpdated}, "No notes yet.")
+		default:
+			reply = telegramHelp
+		}
+		writeJSON(w, http.StatusOK, telegram.ReplyTo(msg, reply))
+		return
+	}
+
+	title, content, _ := strings.Cut(text, "\n")
+	input := store.NoteInput{
+		Title:    store.NormalizeText(strings.TrimSpace(title)),
+		Content:  store.NormalizeText(strings.TrimSpace(content)),
+		Tags:     []string{telegramTag},
+		Language: s.cfg.DefaultLanguage,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		skipAudit(r.Context())
+		writeJSON(w, http.StatusOK, telegram.ReplyTo(msg, "Not saved: "+err.Error()))
+		return
+	}
+	n, err := s.store.CreateNote(r.Context(), input, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		// Failing the request has Telegram retry the message.
+		log.Printf("telegram note: %v", err)
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), n.ID.String())
+	writeJSON(w, http.StatusOK, telegram.ReplyTo(msg, "Saved: "+s.telegramLine(n)))
+}
+
+// telegramCommand splits a bot command such as /search@notes_bot words
+// into its name, without the bot's username, and its arguments.
+func telegramCommand(text string) (command, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	command, args, _ = strings.Cut(text[1:], " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(args), true
+}
+
+// telegramNotes lists the first notes of filter, one per line, or says
+// none when there are none.
+func (s *Server) telegramNotes(r *http.Request, filter store.NoteFilter, none string) string {
+	filter.Limit = telegramListLimit
+	filter.SkipCount = true
+	notes, _, err := s.store.ListNotes(r.Context(), filter)
+	if err != nil {
+		log.Printf("telegram list notes: %v", err)
+		return "Something went wrong; try again later."
+	}
+	if len(notes) == 0 {
+		return none
+	}
+	lines := make([]string, len(notes))
+	for i, n := range notes {
+		lines[i] = "• " + s.telegramLine(n)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// telegramLine names a note with its link into the frontend, or with its
+// ID when ALLOWED_ORIGIN does not say where that is.
+func (s *Server) telegramLine(n store.Note) string {
+	title := n.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	origin := s.settings().AllowedOrigin
+	if origin == "" {
+		return title + " (" + n.ID.String() + ")"
+	}
+	return title + "\n" + strings.TrimRight(origin, "/") + "/notes?note=" + n.ID.String()
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+)
+
+// maxTemplateName is what the MySQL column holds.
+const maxTemplateName = 255
+
+// placeholderPattern matches {{name}}, spaces inside the braces allowed.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z]+)\s*\}\}`)
+
+type templateRequest struct {
+	Name    string   `json:"name"`
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+}
+
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListTemplates(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	t, err := s.store.GetTemplate(r.Context(), id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	input, ok := templateInput(w, req)
+	if !ok {
+		return
+	}
+
+	t, err := s.store.CreateTemplate(r.Context(), input, s.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	setAuditEntity(r.Context(), t.ID.String())
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	input, ok := templateInput(w, req)
+	if !ok {
+		return
+	}
+
+	t, err := s.store.UpdateTemplate(r.Context(), id, input, s.clock.Now())
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := s.store.DeleteTemplate(r.Context(), id); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type fromTemplateRequest struct {
+	Title      string          `json:"title"`
+	Tags       []string        `json:"tags"`
+	NotebookID json.RawMessage `json:"notebook_id"`
+}
+
+// handleCreateFromTemplate makes a note from a template, filling in its
+// placeholders. The body may give the note's title, which then replaces the
+// template's, tags to add to the template's, and a notebook_id.
+func (s *Server) handleCreateFromTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	var req fromTemplateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+			return
+		}
+	}
+	t, err := s.store.GetTemplate(r.Context(), id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	notebookID, ok := s.noteNotebook(w, r, req.NotebookID)
+	if !ok {
+		return
+	}
+
+	now := s.clock.Now()
+	if s.cfg.TimeZone != nil {
+		now = now.In(s.cfg.TimeZone)
+	}
+	title := store.NormalizeText(strings.TrimSpace(req.Title))
+	if title == "" {
+		title = strings.TrimSpace(expandPlaceholders(t.Title, now, t.Name))
+	}
+	if title == "" {
+		title = t.Name
+	}
+
+	input := store.NoteInput{
+		Title:      title,
+		Content:    expandPlaceholders(t.Content, now, title),
+		Tags:       sanitizeTags(append(t.Tags, req.Tags...)),
+		Language:   s.cfg.DefaultLanguage,
+		NotebookID: notebookID,
+	}
+	if err := s.cfg.NoteLimits.Note(input.Title, input.Content, input.Tags); err != nil {
+		writeLimitError(w, err)
+		return
+	}
+
+	n, err := s.store.CreateNote(r.Context(), input, s.clock.Now())
+	if err == nil {
+		err = s.store.SetLinks(r.Context(), n.ID, store.LinkTargets(n.Content))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	setAuditEntity(r.Context(), n.ID.String())
+	setAuditSummary(r.Context(), "from template %s", id)
+	w.Header().Set("ETag", noteETag(n))
+	writeJSON(w, http.StatusCreated, n)
+}
+
+// expandPlaceholders fills in {{date}}, {{time}}, {{datetime}},
+// {{weekday}} and {{title}}; unknown placeholders are left as they are.
+func expandPlaceholders(text string, now time.Time, title string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		switch placeholderPattern.FindStringSubmatch(m)[1] {
+		case "date":
+			return now.Format(time.DateOnly)
+		case "time":
+			return now.Format("15:04")
+		case "datetime":
+			return now.Format("2006-01-02 15:04")
+		case "weekday":
+			return now.Weekday().String()
+		case "title":
+			return title
+		}
+		return m
+	})
+}
+
+func templateInput(w http.ResponseWriter, req templateRequest) (store.TemplateInput, bool) {
+	name := store.NormalizeText(strings.TrimSpace(req.Name))
+	if name == "" {
+		writeFieldError(w, "name", "name is required")
+		return store.TemplateInput{}, false
+	}
+	if utf8.RuneCountInString(name) > maxTemplateName {
+		writeFieldError(w, "name", "name is too long")
+		return store.TemplateInput{}, false
+	}
+	return store.TemplateInput{
+		Name:    name,
+		Title:   store.NormalizeText(strings.TrimSpace(req.Title)),
+		Content: store.NormalizeText(req.Content),
+		Tags:    sanitizeTags(req.Tags),
+	}, true
+}
+
+func writeTemplateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeTemplateNotFound, "template not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"notes-backend/internal/store"
+)
+
+// timeout cancels requests that run past RequestTimeout, and answers the
+// errors that their handlers then write with 504, or with 503 when the
+// database cancelled a statement for running too long. Streams and file
+// transfers are left alone: they may rightly take longer.
+func (s *Server) timeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untimed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if s.cfg.RequestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.cfg.RequestTimeout)
+			defer cancel()
+		}
+		ctx, timedOut := store.WatchTimeouts(ctx)
+		next.ServeHTTP(&timeoutWriter{ResponseWriter: w, ctx: ctx, timedOut: timedOut}, r.WithContext(ctx))
+	})
+}
+
+func untimed(r *http.Request) bool {
+	switch path := r.URL.Path; {
+	case path == "/events", path == "/ws", path == "/export", path == "/import", path == "/ingest/email", path == "/clip", path == "/admin/backup", path == "/admin/restore":
+		return true
+	case strings.HasPrefix(path, "/attachments/"), strings.HasPrefix(path, "/admin/backups/"):
+		return true
+	default:
+		return strings.HasPrefix(path, "/notes/") && strings.HasSuffix(path, "/attachments")
+	}
+}
+
+// timeoutWriter replaces a server error written after a timeout with one
+// saying so.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	timedOut    func() bool
+	wroteHeader bool
+	// discard drops the body of the response it replaced.
+	discard bool
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status >= http.StatusInternalServerError {
+		switch {
+		case errors.Is(w.ctx.Err(), context.DeadlineExceeded):
+			w.discard = true
+			writeError(w.ResponseWriter, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+			return
+		case w.timedOut():
+			w.discard = true
+			writeError(w.ResponseWriter, http.StatusServiceUnavailable, codeDatabaseTimeout, "database statement timed out")
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/validate"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// tokenPrefix marks secrets as ours for people and secret scanners.
+	tokenPrefix  = "nt_"
+	maxTokenName = 100
+	// tokenTouchInterval is how stale a token's last_used_at may get
+	// before a request through it writes a new one.
+	tokenTouchInterval = time.Minute
+)
+
+const (
+	apiTokenKey      sessionContextKey = "apiToken"
+	apiTokenScopeKey sessionContextKey = "apiTokenScope"
+)
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the secret of an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, secret, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	secret = strings.TrimSpace(secret)
+	if !found || !strings.EqualFold(scheme, "Bearer") || secret == "" {
+		return "", false
+	}
+	return secret, true
+}
+
+// serveWithToken is requireSession for requests carrying an API token.
+// Read-only tokens are refused anything but GET and HEAD, and POST
+// /graphql, which only reads.
+func (s *Server) serveWithToken(w http.ResponseWriter, r *http.Request, secret string, next http.Handler) {
+	hash := hashToken(secret)
+	token, err := s.store.APITokenByHash(r.Context(), hash)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusUnauthorized, codeInvalidToken, "invalid token")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if token.Scope != store.ScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/graphql" {
+		writeError(w, http.StatusForbidden, codeReadOnlyToken, "token is read-only")
+		return
+	}
+
+	now := s.clock.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenTouchInterval {
+		if err := s.store.TouchAPIToken(r.Context(), token.ID, now); err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("touch api token: %v", err)
+		}
+	}
+
+	setAuditActor(r.Context(), "token:"+token.ID.String())
+	ctx := context.WithValue(r.Context(), apiTokenKey, hash)
+	ctx = context.WithValue(ctx, apiTokenScopeKey, token.Scope)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// readOnlyToken reports whether ctx is a request made with a read-only
+// token, for the GET handlers that may write.
+func readOnlyToken(ctx context.Context) bool {
+	scope, ok := ctx.Value(apiTokenScopeKey).(store.TokenScope)
+	return ok && scope != store.ScopeWrite
+}
+
+// requireCookieSession keeps tokens from managing tokens, so that a leaked
+// one cannot mint others that outlive its revocation.
+func (s *Server) requireCookieSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiTokenKey).(string); ok {
+			writeError(w, http.StatusForbidden, codeSessionRequired, "tokens are managed from a signed-in session")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type createTokenRequest struct {
+	Name  string           `json:"name"`
+	Scope store.TokenScope `json:"scope"`
+}
+
+type createdToken struct {
+	store.APIToken
+	Token string `json:"token"`
+}
+
+func (s *Server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	token, secret, err := CreateAPIToken(r.Context(), s.store, req.Name, req.Scope, s.clock.Now())
+	var fieldErr *validate.FieldError
+	if errors.As(err, &fieldErr) {
+		writeValidationError(w, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	setAuditEntity(r.Context(), token.ID.String())
+	// The secret is in this response only.
+	writeJSON(w, http.StatusCreated, createdToken{token, secret})
+}
+
+// CreateAPIToken stores a new token called name and returns it with its
+// secret, which is kept nowhere else. Invalid names and scopes are
+// *validate.FieldError.
+func CreateAPIToken(ctx context.Context, st store.Store, name string, scope store.TokenScope, now time.Time) (store.APIToken, string, error) {
+	name = store.NormalizeText(strings.TrimSpace(name))
+	switch {
+	case name == "":
+		return store.APIToken{}, "", &validate.FieldError{Field: "name", Message: "name is required"}
+	case utf8.RuneCountInString(name) > maxTokenName:
+		return store.APIToken{}, "", &validate.FieldError{Field: "name", Message: fmt.Sprintf("name is longer than %d characters", maxTokenName)}
+	case scope != store.ScopeRead && scope != store.ScopeWrite:
+		return store.APIToken{}, "", &validate.FieldError{Field: "scope", Message: "scope must be read or write"}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return store.APIToken{}, "", fmt.Errorf("create token: %w", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	token := store.APIToken{
+		ID:        uuid.New(),
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: now,
+	}
+	if err := st.CreateAPIToken(ctx, token, hashToken(secret)); err != nil {
+		return store.APIToken{}, "", err
+	}
+	return token, secret, nil
+}
+
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListAPITokens(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	err = s.store.DeleteAPIToken(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeTokenNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
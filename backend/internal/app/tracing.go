@@ -0,0 +1,62 @@
+package app
+
+import (
+	"net/http"
+
+	"notes-backend/internal/buildinfo"
+	"notes-backend/internal/config"
+	"notes-backend/internal/tracing"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// newTracer returns the tracer for the configured collector, or nil when
+// tracing is off.
+func newTracer(cfg config.Config) *tracing.Tracer {
+	if cfg.OTLPEndpoint == "" {
+		return nil
+	}
+	return tracing.New(tracing.Options{
+		Endpoint:       cfg.OTLPEndpoint,
+		Headers:        cfg.OTLPHeaders,
+		ServiceName:    cfg.ServiceName,
+		ServiceVersion: buildinfo.Get().Version,
+		SampleRatio:    cfg.TraceSampleRatio,
+	})
+}
+
+// trace records a server span for each request, continuing the trace of
+// its traceparent header. The span is named after the route once chi has
+// matched it, so that requests for different notes group together.
+func (s *Server) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := s.tracer.Start(tracing.Extract(r.Context(), r.Header), r.Method, tracing.KindServer)
+		defer span.End()
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttribute("http.route", rctx.RoutePattern())
+		}
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("http.response.status_code", status)
+		span.SetAttribute("client.address", r.RemoteAddr)
+		if agent := r.UserAgent(); agent != "" {
+			span.SetAttribute("user_agent.original", agent)
+		}
+		if status >= http.StatusInternalServerError {
+			span.Fail(http.StatusText(status))
+		}
+	})
+}
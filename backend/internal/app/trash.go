@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"notes-backend/internal/store"
+)
+
+type trashPage struct {
+	Items []store.Note `json:"items"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+	Total int          `json:"total"`
+}
+
+func (s *Server) handleListTrash(w http.ResponseWriter, r *http.Request) {
+	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 30), 100)
+
+	items, total, err := s.store.ListNotes(r.Context(), store.NoteFilter{
+		Trashed: true,
+		Limit:   limit,
+		Offset:  (page - 1) * limit,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, trashPage{items, page, limit, total})
+}
+
+func (s *Server) handleRestoreNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	n, err := s.store.RestoreNote(r.Context(), noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found in trash")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (s *Server) handlePurgeNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	err = s.store.PurgeNote(r.Context(), noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeNoteNotFound, "note not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeTrash permanently removes notes that have been in the trash longer
+// than the retention period.
+func (s *Server) purgeTrash(ctx context.Context) {
+	purged, err := s.store.PurgeDeleted(ctx, s.clock.Now().Add(-s.cfg.TrashRetention))
+	if err != nil {
+		log.Printf("purge trash: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d note(s) from the trash", purged)
+	}
+}
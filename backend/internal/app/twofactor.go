@@ -0,0 +1,295 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/totp"
+)
+
+const (
+	totpIssuer = "Notes"
+	// loginChallengeTTL is how long a login that passed the password has
+	// to give its second factor.
+	loginChallengeTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// loginChallenge answers a right password when a second factor is needed;
+// Challenge goes to POST /auth/2fa/verify with the code.
+type loginChallenge struct {
+	OK                bool   `json:"ok"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+}
+
+type verifyTwoFactorRequest struct {
+	Challenge string `json:"challenge"`
+	// Code is a TOTP code or a recovery code.
+	Code string `json:"code"`
+}
+
+type twoFactorPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type enableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type twoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Pending is set up but not yet confirmed with a code.
+	Pending       bool `json:"pending"`
+	RecoveryCodes int  `json:"recovery_codes"`
+}
+
+type twoFactorSetup struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// loginChallenge proves, until it expires, that its bearer gave the right
+// password. It is signed with the TOTP secret, which every replica reads
+// from the database and which a new setup replaces, so nothing has to be
+// stored for it.
+func (s *Server) loginChallenge(secret string) string {
+	expires := s.clock.Now().Add(loginChallengeTTL).Unix()
+	return fmt.Sprintf("%d.%s", expires, challengeMAC(secret, expires))
+}
+
+func (s *Server) challengeValid(secret, challenge string) bool {
+	rawExpires, mac, ok := strings.Cut(challenge, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil || s.clock.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(challengeMAC(secret, expires)))
+}
+
+func challengeMAC(secret string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "login challenge %d", expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// handleVerifyTwoFactor finishes a login with a TOTP code or a recovery
+// code, each of which works once.
+func (s *Server) handleVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req verifyTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	tf, err := s.store.GetTwoFactor(r.Context())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if err != nil || !tf.Enabled {
+		writeError(w, http.StatusBadRequest, codeTwoFactorDisabled, "two-factor authentication is not enabled")
+		return
+	}
+	if !s.challengeValid(tf.Secret, req.Challenge) {
+		writeError(w, http.StatusUnauthorized, codeSessionExpired, "login expired, sign in again")
+		return
+	}
+
+	ok, err := s.useSecondFactor(r.Context(), tf, req.Code)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if !ok {
+		auditFailure(r.Context(), "auth.login_failed")
+		setAuditSummary(r.Context(), "wrong second factor")
+		writeError(w, http.StatusUnauthorized, codeInvalidCode, "invalid code")
+		return
+	}
+	s.startSession(w, r)
+}
+
+// useSecondFactor checks code as a TOTP code and then as a recovery code,
+// using it up if it is right.
+func (s *Server) useSecondFactor(ctx context.Context, tf store.TwoFactor, code string) (bool, error) {
+	if step, ok := totp.Validate(tf.Secret, code, s.clock.Now()); ok {
+		return s.store.UseTwoFactorStep(ctx, step)
+	}
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+	used, err := s.store.UseRecoveryCode(ctx, hashToken(normalized))
+	if used {
+		setAuditSummary(ctx, "recovery code, %d left", tf.RecoveryCodes-1)
+	}
+	return used, err
+}
+
+func (s *Server) handleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	tf, err := s.store.GetTwoFactor(r.Context())
+	if errors.Is(err, store.ErrNotFound) {
+		writeJSON(w, http.StatusOK, twoFactorStatus{})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, twoFactorStatus{Enabled: tf.Enabled, Pending: !tf.Enabled, RecoveryCodes: tf.RecoveryCodes})
+}
+
+// handleSetupTwoFactor generates a TOTP secret for the user to add to an
+// app. Logins keep needing only the password until enabling confirms that
+// the app produces codes for it.
+func (s *Server) handleSetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if !s.passwordMatches(req.Password) {
+		writeError(w, http.StatusForbidden, codeInvalidPassword, "invalid password")
+		return
+	}
+	tf, err := s.store.GetTwoFactor(r.Context())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if err == nil && tf.Enabled {
+		writeError(w, http.StatusConflict, codeTwoFactorEnabled, "two-factor authentication is already enabled; disable it first")
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to create secret")
+		return
+	}
+	if err := s.store.SetupTwoFactor(r.Context(), secret); err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, twoFactorSetup{secret, totp.URI(secret, totpIssuer, r.Host)})
+}
+
+// handleEnableTwoFactor turns on the second factor set up last, once a code
+// from it checks out, and returns the recovery codes. They are only in this
+// response; the store keeps their hashes.
+func (s *Server) handleEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req enableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if !s.passwordMatches(req.Password) {
+		writeError(w, http.StatusForbidden, codeInvalidPassword, "invalid password")
+		return
+	}
+	tf, err := s.store.GetTwoFactor(r.Context())
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusConflict, codeTwoFactorRequired, "set up two-factor authentication first")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	if tf.Enabled {
+		writeError(w, http.StatusConflict, codeTwoFactorEnabled, "two-factor authentication is already enabled")
+		return
+	}
+	step, ok := totp.Validate(tf.Secret, req.Code, s.clock.Now())
+	if !ok {
+		writeError(w, http.StatusForbidden, codeInvalidCode, "invalid code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to create recovery codes")
+		return
+	}
+	err = s.store.EnableTwoFactor(r.Context(), step, hashes)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusConflict, codeTwoFactorRequired, "set up two-factor authentication first")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, recoveryCodes{codes})
+}
+
+// handleDisableTwoFactor removes the second factor, or a setup that was
+// never enabled.
+func (s *Server) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	if !s.passwordMatches(req.Password) {
+		writeError(w, http.StatusForbidden, codeInvalidPassword, "invalid password")
+		return
+	}
+	if err := s.store.DeleteTwoFactor(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newRecoveryCodes returns fresh recovery codes, formatted as
+// "xxxxx-xxxxx", and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts a recovery code with or without its dash,
+// in either case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 10 {
+		return ""
+	}
+	return code
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/webhook"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhookURL = 2048
+	// minWebhookSecret keeps chosen secrets from being guessable; generated
+	// ones are 32 random bytes.
+	minWebhookSecret = 16
+)
+
+// startWebhooks runs the dispatcher posting note events to the registered
+// webhooks until ctx is done.
+func (s *Server) startWebhooks(ctx context.Context) {
+	d := webhook.NewDispatcher(s.store, s.bus, s.clock)
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		d.Run(ctx)
+	}()
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+type createdWebhook struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+		return
+	}
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" || len(req.URL) > maxWebhookURL {
+		writeFieldError(w, "url", "url must be an http or https URL")
+		return
+	}
+	kinds := webhook.Events
+	if len(req.Events) > 0 {
+		kinds = nil
+		for _, kind := range req.Events {
+			if !slices.Contains(webhook.Events, kind) {
+				writeFieldError(w, "events", fmt.Sprintf("events must be among %s", strings.Join(webhook.Events, ", ")))
+				return
+			}
+			if !slices.Contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	secret := req.Secret
+	if secret == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to create webhook")
+			return
+		}
+		secret = base64.RawURLEncoding.EncodeToString(raw)
+	} else if len(secret) < minWebhookSecret {
+		writeFieldError(w, "secret", fmt.Sprintf("secret must be at least %d characters", minWebhookSecret))
+		return
+	}
+
+	hook := store.Webhook{
+		ID:        uuid.New(),
+		URL:       target.String(),
+		Events:    kinds,
+		Secret:    secret,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.store.CreateWebhook(r.Context(), hook); err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+
+	setAuditEntity(r.Context(), hook.ID.String())
+	// The secret is in this response only.
+	writeJSON(w, http.StatusCreated, createdWebhook{hook, secret})
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListWebhooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	err = s.store.DeleteWebhook(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, codeWebhookNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeDatabaseError, "database error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
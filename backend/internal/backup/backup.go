@@ -0,0 +1,214 @@
+// Package backup takes snapshots of the database, on demand or on a
+// schedule, keeps them in blob storage and rotates out the old ones.
+// Snapshots are either the JSON dump the export command writes, which
+// every driver supports, or a pg_dump archive of a Postgres database.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"notes-backend/internal/dump"
+	"notes-backend/internal/storage"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatPgDump = "pg_dump"
+)
+
+// Formats lists the accepted BACKUP_FORMAT values.
+var Formats = []string{FormatJSON, FormatPgDump}
+
+// namePrefix and nameTime make up the names of backups, which sort by
+// when they were taken and are all rotation touches.
+const (
+	namePrefix = "notes-backup-"
+	nameTime   = "20060102-150405"
+)
+
+var (
+	// ErrRunning is returned by Run while another backup is being taken.
+	ErrRunning  = errors.New("a backup is already running")
+	ErrNotFound = errors.New("backup not found")
+)
+
+// Target is where backups are kept.
+type Target interface {
+	storage.BlobStore
+	storage.Lister
+}
+
+type Options struct {
+	Format string
+	// Prefix goes before the names of backups to make their keys, such as
+	// a folder in a bucket shared with attachments.
+	Prefix string
+	// Keep is how many backups rotation leaves, the newest; 0 keeps all.
+	Keep int
+	// DatabaseURL is what pg_dump connects to.
+	DatabaseURL string
+}
+
+type Backup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// Notes is how many notes a JSON backup holds, known only when it has
+	// just been taken.
+	Notes *int `json:"notes,omitempty"`
+}
+
+type Manager struct {
+	st     dump.Store
+	target Target
+	opts   Options
+	// running keeps backups from overlapping, which would only take two
+	// snapshots of the same data.
+	running sync.Mutex
+}
+
+func New(st dump.Store, target Target, opts Options) *Manager {
+	if opts.Format == "" {
+		opts.Format = FormatJSON
+	}
+	return &Manager{st: st, target: target, opts: opts}
+}
+
+// Format returns the kind of snapshot Run takes.
+func (m *Manager) Format() string {
+	return m.opts.Format
+}
+
+// Run takes a backup, stores it and then drops the ones beyond Keep. A
+// failed rotation is logged rather than returned, as the backup itself
+// went through.
+func (m *Manager) Run(ctx context.Context, now time.Time) (Backup, error) {
+	if !m.running.TryLock() {
+		return Backup{}, ErrRunning
+	}
+	defer m.running.Unlock()
+
+	// The whole snapshot goes to a temporary file first, as uploads need
+	// their size up front.
+	tmp, err := os.CreateTemp("", ".notes-backup-*")
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	b := Backup{Name: namePrefix + now.UTC().Format(nameTime), CreatedAt: now.UTC().Truncate(time.Second)}
+	switch m.opts.Format {
+	case FormatPgDump:
+		b.Name += ".dump"
+		err = m.pgDump(ctx, tmp)
+	default:
+		b.Name += ".json"
+		var count int
+		if count, err = dump.Write(ctx, m.st, tmp, now); err == nil {
+			b.Notes = &count
+		}
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup: %w", err)
+	}
+	if b.Size, err = tmp.Seek(0, io.SeekCurrent); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup: %w", err)
+	}
+	if err := m.target.Put(ctx, m.opts.Prefix+b.Name, tmp, b.Size); err != nil {
+		return Backup{}, fmt.Errorf("backup: %w", err)
+	}
+	if err := m.rotate(ctx); err != nil {
+		log.Printf("rotate backups: %v", err)
+	}
+	return b, nil
+}
+
+func (m *Manager) pgDump(ctx context.Context, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "pg_dump", "--format=custom", "--no-owner", "--no-privileges", "--dbname", m.opts.DatabaseURL)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_dump: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// rotate deletes the oldest backups beyond Keep.
+func (m *Manager) rotate(ctx context.Context) error {
+	if m.opts.Keep <= 0 {
+		return nil
+	}
+	backups, err := m.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(len(backups), m.opts.Keep):] {
+		if err := m.target.Delete(ctx, m.opts.Prefix+b.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the stored backups, newest first.
+func (m *Manager) List(ctx context.Context) ([]Backup, error) {
+	objects, err := m.target.List(ctx, m.opts.Prefix+namePrefix)
+	if err != nil {
+		return nil, err
+	}
+	backups := []Backup{}
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, m.opts.Prefix)
+		created, ok := nameCreated(name)
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{Name: name, Size: o.Size, CreatedAt: created})
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return strings.Compare(b.Name, a.Name) })
+	return backups, nil
+}
+
+// Open returns the backup called name; the caller closes it.
+func (m *Manager) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if _, ok := nameCreated(name); !ok {
+		return nil, ErrNotFound
+	}
+	r, err := m.target.Get(ctx, m.opts.Prefix+name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// nameCreated reads when a backup was taken from its name, and whether
+// name is one at all.
+func nameCreated(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, namePrefix)
+	if !ok || len(stamp) < len(nameTime) {
+		return time.Time{}, false
+	}
+	switch stamp[len(nameTime):] {
+	case ".json", ".dump":
+	default:
+		return time.Time{}, false
+	}
+	created, err := time.Parse(nameTime, stamp[:len(nameTime)])
+	return created, err == nil
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/dump"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+)
+
+func TestRunRotates(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	if _, err := st.CreateNote(ctx, store.NoteInput{Title: "kept", Content: "safe"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Put(ctx, "backups/unrelated.json", strings.NewReader(""), 0); err != nil {
+		t.Fatal(err)
+	}
+	m := New(st, local, Options{Prefix: "backups/", Keep: 2})
+
+	start := time.Date(2026, 10, 14, 3, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		b, err := m.Run(ctx, start.AddDate(0, 0, day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Notes == nil || *b.Notes != 1 || b.Size == 0 {
+			t.Fatalf("backup = %+v", b)
+		}
+	}
+
+	backups, err := m.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != "notes-backup-20261016-030000.json" || !backups[1].CreatedAt.Equal(start.AddDate(0, 0, 1)) {
+		t.Fatalf("backups = %+v", backups)
+	}
+	if _, err := local.Get(ctx, "backups/unrelated.json"); err != nil {
+		t.Errorf("rotation removed another file: %v", err)
+	}
+
+	r, err := m.Open(ctx, backups[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := dump.Read(r)
+	if err != nil || len(f.Notes) != 1 || f.Notes[0].Title != "kept" {
+		t.Fatalf("restored %+v, %v", f, err)
+	}
+	for _, name := range []string{"notes-backup-20261014-030000.json", "../notes-backup-20261016-030000.json", "unrelated.json"} {
+		if _, err := m.Open(ctx, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q): %v", name, err)
+		}
+	}
+}
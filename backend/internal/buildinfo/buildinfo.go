@@ -0,0 +1,43 @@
+// Package buildinfo reports which build of the server is running. Release
+// builds set Version and Commit with
+//
+//	-ldflags "-X notes-backend/internal/buildinfo.Version=v1.2.0 -X notes-backend/internal/buildinfo.Commit=abc123"
+//
+// and builds from a git checkout fall back to the revision Go records.
+package buildinfo
+
+import "runtime/debug"
+
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	// Modified is set when the commit had uncommitted changes on top.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	if info.Commit != "" {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
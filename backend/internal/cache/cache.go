@@ -0,0 +1,90 @@
+// Package cache keeps responses for a while, in memory or, for deployments
+// with several replicas, in Redis. Callers put what the response depends on
+// in its key, the change counter included, so that writes leave the entries
+// from before them behind rather than having to delete them.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"notes-backend/internal/redis"
+)
+
+// Cache keeps values under keys until their time to live runs out.
+type Cache interface {
+	// Get returns the value kept under key, if any is still alive at now.
+	Get(ctx context.Context, key string, now time.Time) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, now time.Time) error
+}
+
+// maxEntries bounds the values a Memory keeps; past it the expired ones
+// are dropped, and then any.
+const maxEntries = 1000
+
+// Memory keeps values in the process, which is all a single replica needs.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]entry)}
+}
+
+func (m *Memory) Get(_ context.Context, key string, now time.Time) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok || !now.Before(e.expires) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= maxEntries {
+		for k, e := range m.entries {
+			if !now.Before(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		// Without any expired, the map's order picks one at random.
+		for k := range m.entries {
+			if len(m.entries) < maxEntries {
+				break
+			}
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = entry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// Redis keeps values in a Redis server, shared by all replicas, under a
+// prefix of their own. Redis expires them itself.
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+const redisPrefix = "notes:cache:"
+
+func (r *Redis) Get(ctx context.Context, key string, _ time.Time) ([]byte, bool, error) {
+	return r.client.Get(ctx, redisPrefix+key)
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, _ time.Time) error {
+	return r.client.Set(ctx, redisPrefix+key, value, ttl)
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	if _, ok, _ := m.Get(ctx, "a", now); ok {
+		t.Fatal("Get of a missing key found it")
+	}
+	m.Set(ctx, "a", []byte("1"), time.Minute, now)
+	if value, ok, err := m.Get(ctx, "a", now.Add(59*time.Second)); string(value) != "1" || !ok || err != nil {
+		t.Fatalf("Get = %q, %t, %v", value, ok, err)
+	}
+	if _, ok, _ := m.Get(ctx, "a", now.Add(time.Minute)); ok {
+		t.Fatal("Get after the time to live found the value")
+	}
+
+	for i := range maxEntries + 10 {
+		m.Set(ctx, strconv.Itoa(i), []byte("x"), time.Minute, now.Add(time.Minute))
+	}
+	if len(m.entries) != maxEntries {
+		t.Fatalf("%d entries kept, want %d", len(m.entries), maxEntries)
+	}
+	if _, ok := m.entries["a"]; ok {
+		t.Fatal("expired entry kept over live ones")
+	}
+}
@@ -0,0 +1,261 @@
+// Package clip turns web pages into notes: it fetches a page, finds the
+// article in it the way reader modes do, and writes that out as Markdown.
+// Everything it fetches goes through the checks in Options, as the URLs
+// come from outside.
+package clip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// maxRedirects is how many redirects a fetch follows.
+const maxRedirects = 5
+
+var (
+	// ErrHostNotAllowed is returned for URLs outside AllowedHosts, and for
+	// hosts that resolve to private addresses without AllowPrivate.
+	ErrHostNotAllowed = errors.New("host not allowed")
+	// ErrTooLarge is returned for responses over their size limit.
+	ErrTooLarge = errors.New("response too large")
+	// ErrNotHTML is returned by Fetch for anything but an HTML page.
+	ErrNotHTML = errors.New("not an HTML page")
+	// ErrNotImage is returned by FetchImage for anything but a picture.
+	ErrNotImage = errors.New("not an image")
+)
+
+type Options struct {
+	// AllowedHosts, when set, are the only hosts pages and images are
+	// fetched from; "*.example.com" matches its subdomains too.
+	AllowedHosts []string
+	// AllowPrivate lets hosts on loopback, private and link-local addresses
+	// be fetched, which is otherwise refused so that clipping cannot reach
+	// into the network the server runs in.
+	AllowPrivate bool
+	// MaxPageBytes bounds the HTML read of a page.
+	MaxPageBytes int64
+}
+
+// Client fetches pages and their pictures. Deadlines come from the
+// contexts it is given.
+type Client struct {
+	opts Options
+	http *http.Client
+}
+
+func New(opts Options) *Client {
+	c := &Client{opts: opts}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: c.checkAddress}
+	c.http = &http.Client{
+		// No proxy: the address check has to see where requests really go.
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return c.checkURL(req.URL)
+		},
+	}
+	return c
+}
+
+// Page is an article found in a web page.
+type Page struct {
+	// URL is where the page was found, after redirects.
+	URL   *url.URL
+	Title string
+	// Images are the absolute URLs of the pictures in the article, in
+	// order and each once.
+	Images []string
+
+	content []*html.Node
+}
+
+// Markdown writes out the article, pointing the pictures that images has
+// a URL for there instead.
+func (p *Page) Markdown(images map[string]string) string {
+	w := &writer{base: p.URL, images: images, title: p.Title}
+	return w.document(p.content)
+}
+
+// Fetch gets the page at rawURL and finds its article.
+func (c *Client) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	resp, err := c.get(ctx, rawURL, "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+	body, err := readAll(resp.Body, c.opts.MaxPageBytes)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{URL: baseURL(doc, resp.Request.URL), Title: pageTitle(doc)}
+	page.content = extract(doc)
+	seen := map[string]bool{}
+	for _, n := range page.content {
+		for _, img := range elements(n, "img") {
+			if src := imageSource(img, page.URL); src != "" && !seen[src] {
+				seen[src] = true
+				page.Images = append(page.Images, src)
+			}
+		}
+	}
+	return page, nil
+}
+
+// Image is a picture fetched for a page.
+type Image struct {
+	Data        []byte
+	ContentType string
+	// Filename is the last segment of the URL's path.
+	Filename string
+}
+
+// FetchImage gets the picture at rawURL, of at most maxBytes.
+func (c *Client) FetchImage(ctx context.Context, rawURL string, maxBytes int64) (Image, error) {
+	resp, err := c.get(ctx, rawURL, "image/*")
+	if err != nil {
+		return Image{}, err
+	}
+	defer resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !strings.HasPrefix(mediaType, "image/") {
+		return Image{}, ErrNotImage
+	}
+	if resp.ContentLength > maxBytes {
+		return Image{}, ErrTooLarge
+	}
+	data, err := readAll(resp.Body, maxBytes)
+	if err != nil {
+		return Image{}, err
+	}
+	name := resp.Request.URL.Path
+	name = name[strings.LastIndex(name, "/")+1:]
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return Image{Data: data, ContentType: contentType, Filename: name}, nil
+}
+
+func (c *Client) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkURL(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; notes-clipper)")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", u.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+// checkURL lets through http and https URLs to the allowed hosts.
+func (c *Client) checkURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: only http and https URLs can be clipped", ErrHostNotAllowed)
+	}
+	if !c.hostAllowed(strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+func (c *Client) hostAllowed(host string) bool {
+	if len(c.opts.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range c.opts.AllowedHosts {
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress runs for every connection, once the host is resolved, so it
+// also catches names that point inside and redirects that lead there.
+func (c *Client) checkAddress(_, address string, _ syscall.RawConn) error {
+	if c.opts.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(ip.Unmap()) {
+		return fmt.Errorf("%w: %s is not a public address", ErrHostNotAllowed, ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is carrier-grade NAT, which IsPrivate leaves out.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddress(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,112 @@
+package clip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const articlePage = `<!doctype html>
+<html><head>
+<title>Baking bread | The Kitchen</title>
+<meta property="og:title" content="Baking bread">
+<script>track()</script>
+</head><body>
+<nav><a href="/">Home</a> <a href="/recipes">Recipes</a></nav>
+<div class="sidebar"><p>Subscribe to our newsletter, it is full of great offers, deals and more.</p></div>
+<article class="post">
+  <h1>Baking bread</h1>
+  <p>Bread needs <strong>flour</strong>, water, salt and <em>time</em>, which is the ingredient most recipes forget.</p>
+  <img src="/img/loaf.jpg" alt="A loaf">
+  <p>Knead the dough for ten minutes, then let it rise somewhere warm, covered, for an hour or two.<br>Not longer.</p>
+  <ul><li>Flour, 500 g</li><li>Water, 350 ml<ul><li>lukewarm</li></ul></li></ul>
+  <pre><code class="language-sh">bake --minutes 40</code></pre>
+  <p>Read more in <a href="/guides/flour">the flour guide</a>; 1 loaf serves four.</p>
+</article>
+<div id="comments"><p>Great recipe, thanks, I made it twice, and it came out perfect both times!</p></div>
+<footer>Copyright</footer>
+</body></html>`
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/recipes/bread", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(articlePage))
+	}))
+	defer srv.Close()
+
+	c := New(Options{AllowPrivate: true, MaxPageBytes: 1 << 20})
+	page, err := c.Fetch(context.Background(), srv.URL+"/moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Baking bread" || page.URL.Path != "/recipes/bread" {
+		t.Errorf("title %q, url %s", page.Title, page.URL)
+	}
+	if len(page.Images) != 1 || page.Images[0] != srv.URL+"/img/loaf.jpg" {
+		t.Errorf("images = %v", page.Images)
+	}
+
+	want := strings.Join([]string{
+		"Bread needs **flour**, water, salt and *time*, which is the ingredient most recipes forget.",
+		"![A loaf](/attachments/1)",
+		"Knead the dough for ten minutes, then let it rise somewhere warm, covered, for an hour or two.\\\nNot longer.",
+		"- Flour, 500 g\n- Water, 350 ml\n  - lukewarm",
+		"```sh\nbake --minutes 40\n```",
+		"Read more in [the flour guide](" + srv.URL + "/guides/flour); 1 loaf serves four.",
+	}, "\n\n")
+	if got := page.Markdown(map[string]string{page.Images[0]: "/attachments/1"}); got != want {
+		t.Errorf("markdown:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := c.Fetch(context.Background(), "file:///etc/passwd"); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("file URL: %v", err)
+	}
+	small := New(Options{AllowPrivate: true, MaxPageBytes: 100})
+	if _, err := small.Fetch(context.Background(), srv.URL); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("large page: %v", err)
+	}
+}
+
+func TestAddressChecks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>hi</p>"))
+	}))
+	defer srv.Close()
+
+	if _, err := New(Options{MaxPageBytes: 1 << 20}).Fetch(context.Background(), srv.URL); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("loopback: %v", err)
+	}
+	allowed := New(Options{AllowedHosts: []string{"*.example.com", "example.org"}})
+	for host, want := range map[string]bool{
+		"example.com":     true,
+		"www.example.com": true,
+		"example.org":     true,
+		"www.example.org": false,
+		"badexample.com":  false,
+	} {
+		if got := allowed.hostAllowed(host); got != want {
+			t.Errorf("hostAllowed(%q) = %v", host, got)
+		}
+	}
+}
+
+func TestParagraphEscapes(t *testing.T) {
+	for in, want := range map[string]string{
+		"# not a heading": `\# not a heading`,
+		"2024. A year":    `2024\. A year`,
+		`ends in \\`:      `ends in \\`,
+		"a\\\n\\\nb\\\n":  "a\\\nb",
+	} {
+		if got := tidyParagraph(in); got != want {
+			t.Errorf("tidyParagraph(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
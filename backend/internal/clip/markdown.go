@@ -0,0 +1,376 @@
+package clip
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockElements break the inline flow; everything else is written out as
+// part of the paragraph around it.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true, atom.Details: true,
+	atom.Dialog: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true, atom.Header: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hgroup: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true, atom.Ol: true,
+	atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true, atom.Table: true, atom.Ul: true,
+}
+
+// markdownEscaper escapes what would otherwise read as Markdown in text.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+// writer turns the article's HTML into Markdown, block by block.
+type writer struct {
+	base   *url.URL
+	images map[string]string
+	// title is left out when the article opens with it, as it becomes the
+	// note's title.
+	title string
+}
+
+func (w *writer) document(nodes []*html.Node) string {
+	var blocks []string
+	for _, n := range nodes {
+		blocks = append(blocks, w.blocks(n)...)
+	}
+	if len(blocks) > 0 && strings.HasPrefix(blocks[0], "#") && strings.TrimLeft(blocks[0], "# ") == markdownEscaper.Replace(w.title) {
+		blocks = blocks[1:]
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// blocks writes n, gathering runs of inline content between its block
+// children into paragraphs.
+func (w *writer) blocks(n *html.Node) []string {
+	if n.Type == html.TextNode || (n.Type == html.ElementNode && !blockElements[n.DataAtom]) {
+		if text := tidyParagraph(w.inline(n)); text != "" {
+			return []string{text}
+		}
+		return nil
+	}
+	if n.Type != html.ElementNode && n.Type != html.DocumentNode {
+		return nil
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := tidyParagraph(breaksToSpaces(w.inlineChildren(n)))
+		if text == "" {
+			return nil
+		}
+		level := int(n.Data[1] - '0')
+		return []string{strings.Repeat("#", level) + " " + text}
+	case atom.P, atom.Dt, atom.Summary:
+		if text := tidyParagraph(w.inlineChildren(n)); text != "" {
+			return []string{text}
+		}
+		return nil
+	case atom.Figcaption:
+		if text := tidyParagraph(w.inlineChildren(n)); text != "" {
+			return []string{"*" + text + "*"}
+		}
+		return nil
+	case atom.Pre:
+		return []string{codeBlock(n)}
+	case atom.Hr:
+		return []string{"---"}
+	case atom.Blockquote:
+		inner := strings.Join(w.childBlocks(n), "\n\n")
+		if inner == "" {
+			return nil
+		}
+		return []string{prefixLines(inner, "> ", ">")}
+	case atom.Ul, atom.Ol:
+		if list := w.list(n); list != "" {
+			return []string{list}
+		}
+		return nil
+	case atom.Table:
+		if table := w.table(n); table != "" {
+			return []string{table}
+		}
+		return nil
+	}
+	return w.childBlocks(n)
+}
+
+func (w *writer) childBlocks(n *html.Node) []string {
+	var blocks []string
+	var run strings.Builder
+	flush := func() {
+		if text := tidyParagraph(run.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		run.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+			flush()
+			blocks = append(blocks, w.blocks(c)...)
+			continue
+		}
+		run.WriteString(w.inline(c))
+	}
+	flush()
+	return blocks
+}
+
+func (w *writer) list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(attrOr(n, "start")); err == nil && start >= 0 {
+		number = start
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		body := strings.Join(w.childBlocks(li), "\n")
+		if body == "" {
+			continue
+		}
+		item, rest, nested := strings.Cut(body, "\n")
+		item = marker + item
+		if nested {
+			item += "\n" + prefixLines(rest, strings.Repeat(" ", len(marker)), "")
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, "\n")
+}
+
+// table writes a GFM table, its first row the header; cells lose their
+// line breaks, which tables cannot hold.
+func (w *writer) table(n *html.Node) string {
+	var rows [][]string
+	for _, tr := range elements(n, "tr") {
+		var cells []string
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+				cell := breaksToSpaces(strings.Join(w.childBlocks(c), " "))
+				cells = append(cells, strings.ReplaceAll(strings.ReplaceAll(cell, "\n", " "), "|", `\|`))
+			}
+		}
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *writer) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(w.inline(c))
+	}
+	return b.String()
+}
+
+func (w *writer) inline(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return markdownEscaper.Replace(spaceRuns(n.Data))
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return "\\\n"
+	case atom.Strong, atom.B:
+		return wrap(w.inlineChildren(n), "**")
+	case atom.Em, atom.I, atom.Cite:
+		return wrap(w.inlineChildren(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(w.inlineChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		return codeSpan(spaceRuns(textContent(n)))
+	case atom.Img:
+		return w.image(n)
+	case atom.A:
+		text := w.inlineChildren(n)
+		href := absoluteURL(strings.TrimSpace(attrOr(n, "href")), w.base)
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return "[" + strings.TrimSpace(text) + "](" + destination(href) + ")"
+	}
+	if blockElements[n.DataAtom] {
+		// A block inside inline content, such as a div in a link, only
+		// separates words.
+		return " " + w.inlineChildren(n) + " "
+	}
+	return w.inlineChildren(n)
+}
+
+func (w *writer) image(n *html.Node) string {
+	src := imageSource(n, w.base)
+	if src == "" {
+		return ""
+	}
+	if local, ok := w.images[src]; ok {
+		src = local
+	}
+	alt := markdownEscaper.Replace(collapseSpace(attrOr(n, "alt")))
+	return "![" + alt + "](" + destination(src) + ")"
+}
+
+// destination escapes the characters that would end a link destination.
+func destination(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E").Replace(u)
+}
+
+// wrap puts marker around text, outside the spaces at its ends, which
+// would keep it from being read as emphasis.
+func wrap(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+	return start + marker + trimmed + marker + end
+}
+
+// codeSpan fences code with more backticks than it holds in a row.
+func codeSpan(code string) string {
+	if strings.TrimSpace(code) == "" {
+		return code
+	}
+	fence := strings.Repeat("`", longestRun(code, '`')+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// codeBlock writes a <pre> as a fenced block, keeping its language when
+// a language-x or lang-x class names one.
+func codeBlock(pre *html.Node) string {
+	code := strings.Trim(textContent(pre), "\n")
+	language := ""
+	for _, n := range append([]*html.Node{pre}, elements(pre, "code")...) {
+		for _, class := range strings.Fields(attrOr(n, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				language = lang
+			} else if lang, ok := strings.CutPrefix(class, "lang-"); ok {
+				language = lang
+			}
+		}
+	}
+	fence := strings.Repeat("`", max(3, longestRun(code, '`')+1))
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// prefixLines starts every line of text with prefix, or with blank for
+// empty lines.
+func prefixLines(text, prefix, blank string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// spaceRuns collapses the whitespace in text to single spaces, as browsers
+// show it.
+func spaceRuns(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// tidyParagraph drops the spaces that the inline pieces of a paragraph
+// leave around its line breaks, the empty lines and the break at its end,
+// and escapes what would start a list or a heading.
+func tidyParagraph(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = collapseSpace(line); line != "" && line != `\` {
+			lines = append(lines, escapeLineStart(line))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	// An odd run of backslashes ends in a break rather than an escape.
+	last := lines[len(lines)-1]
+	if run := len(last) - len(strings.TrimRight(last, `\`)); run%2 == 1 {
+		lines[len(lines)-1] = strings.TrimSpace(last[:len(last)-1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func escapeLineStart(line string) string {
+	switch line[0] {
+	case '#', '>', '-', '+', '=', '|':
+		return `\` + line
+	}
+	digits := strings.TrimLeft(line, "0123456789")
+	if len(digits) < len(line) && (strings.HasPrefix(digits, ".") || strings.HasPrefix(digits, ")")) {
+		return line[:len(line)-len(digits)] + `\` + digits
+	}
+	return line
+}
+
+// breaksToSpaces turns the line breaks of inline content that cannot hold
+// them, such as headings and table cells, into spaces.
+func breaksToSpaces(text string) string {
+	return strings.ReplaceAll(text, "\\\n", " ")
+}
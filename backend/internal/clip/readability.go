@@ -0,0 +1,316 @@
+package clip
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Scoring follows Readability, the reader mode Firefox ships: paragraphs
+// vote for the element around them by how much prose they hold, the
+// element with the most votes, discounted by how much of it is links, is
+// the article, and siblings that score nearly as well come along.
+
+// minParagraphChars is how short a paragraph may be and still vote.
+const minParagraphChars = 25
+
+var (
+	// unlikelyElements are left out before scoring.
+	unlikelyElements = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+		atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Canvas: true, atom.Svg: true,
+		atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+		atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Dialog: true,
+	}
+	unlikelyClasses = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|newsletter|pager|pagination|popup|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tool|widget|\bad-|advert`)
+	likelyClasses   = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|post|entry|text|story`)
+	positiveClasses = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeClasses = regexp.MustCompile(`(?i)hidden|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|byline|author`)
+)
+
+// extract returns the nodes that make up the article of doc, or its whole
+// body when nothing reads like one.
+func extract(doc *html.Node) []*html.Node {
+	body := first(doc, atom.Body)
+	if body == nil {
+		return []*html.Node{doc}
+	}
+	prune(body)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	vote := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	for _, p := range elements(body, "p", "pre", "td", "blockquote") {
+		text := textContent(p)
+		chars := utf8.RuneCountInString(strings.TrimSpace(text))
+		if chars < minParagraphChars {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(chars)/100, 3)
+		vote(p.Parent, score)
+		if p.Parent != nil {
+			vote(p.Parent.Parent, score/2)
+		}
+	}
+
+	var top *html.Node
+	for _, n := range candidates {
+		scores[n] *= 1 - linkDensity(n)
+		if top == nil || scores[n] > scores[top] {
+			top = n
+		}
+	}
+	if top == nil {
+		return []*html.Node{body}
+	}
+
+	// Articles split over several blocks, say with a picture between
+	// paragraphs, are gathered back from the siblings around the best one.
+	threshold := max(10, scores[top]*0.2)
+	var nodes []*html.Node
+	for _, sibling := range siblings(top) {
+		if sibling == top {
+			nodes = append(nodes, sibling)
+			continue
+		}
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if score, ok := scores[sibling]; ok && score+classWeight(sibling) >= threshold {
+			nodes = append(nodes, sibling)
+			continue
+		}
+		if sibling.DataAtom == atom.P {
+			text := strings.TrimSpace(textContent(sibling))
+			density := linkDensity(sibling)
+			chars := utf8.RuneCountInString(text)
+			if (chars > 80 && density < 0.25) || (chars > 0 && density == 0 && strings.ContainsAny(text, ".!?")) {
+				nodes = append(nodes, sibling)
+			}
+		}
+	}
+	return nodes
+}
+
+// prune removes what is never part of an article: scripts, forms and
+// navigation, as well as anything hidden or classed like a sidebar.
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && unlikely(c):
+			n.RemoveChild(c)
+		default:
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func unlikely(n *html.Node) bool {
+	if unlikelyElements[n.DataAtom] {
+		return true
+	}
+	if _, hidden := attr(n, "hidden"); hidden || strings.Contains(strings.ReplaceAll(attrOr(n, "style"), " ", ""), "display:none") || attrOr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	match := attrOr(n, "class") + " " + attrOr(n, "id")
+	return unlikelyClasses.MatchString(match) && !likelyClasses.MatchString(match)
+}
+
+func initialScore(n *html.Node) float64 {
+	score := classWeight(n)
+	switch n.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Main, atom.Section:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	return score
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, value := range []string{attrOr(n, "class"), attrOr(n, "id")} {
+		if value == "" {
+			continue
+		}
+		if negativeClasses.MatchString(value) {
+			weight -= 25
+		}
+		if positiveClasses.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of n's text that is in links.
+func linkDensity(n *html.Node) float64 {
+	chars := utf8.RuneCountInString(strings.TrimSpace(textContent(n)))
+	if chars == 0 {
+		return 0
+	}
+	linked := 0
+	for _, a := range elements(n, "a") {
+		linked += utf8.RuneCountInString(strings.TrimSpace(textContent(a)))
+	}
+	return float64(linked) / float64(chars)
+}
+
+// pageTitle prefers the title the page gives for sharing, which leaves out
+// the site name, over its <title>, and that over its first heading.
+func pageTitle(doc *html.Node) string {
+	for _, meta := range elements(doc, "meta") {
+		if property := attrOr(meta, "property"); property == "og:title" || attrOr(meta, "name") == "twitter:title" {
+			if title := collapseSpace(attrOr(meta, "content")); title != "" {
+				return title
+			}
+		}
+	}
+	if title := first(doc, atom.Title); title != nil {
+		if text := collapseSpace(textContent(title)); text != "" {
+			return text
+		}
+	}
+	if h1 := first(doc, atom.H1); h1 != nil {
+		return collapseSpace(textContent(h1))
+	}
+	return ""
+}
+
+// baseURL is what relative links in doc resolve against: its <base>, or
+// the URL it was fetched from.
+func baseURL(doc *html.Node, fetched *url.URL) *url.URL {
+	if base := first(doc, atom.Base); base != nil {
+		if href, ok := attr(base, "href"); ok {
+			if u, err := fetched.Parse(strings.TrimSpace(href)); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				return u
+			}
+		}
+	}
+	return fetched
+}
+
+// imageSource is the absolute URL of img's picture, taking the sources
+// lazy loaders keep in data attributes, or "" when it has none that can
+// be fetched.
+func imageSource(img *html.Node, base *url.URL) string {
+	for _, key := range []string{"data-src", "data-original", "src"} {
+		raw := strings.TrimSpace(attrOr(img, key))
+		if raw == "" || strings.HasPrefix(raw, "data:") {
+			continue
+		}
+		return absoluteURL(raw, base)
+	}
+	return ""
+}
+
+// absoluteURL resolves raw against base, or returns "" for anything but
+// http and https.
+func absoluteURL(raw string, base *url.URL) string {
+	u, err := base.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+// elements returns the elements under n, n included, with one of tags, in
+// document order.
+func elements(n *html.Node, tags ...string) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, tag := range tags {
+				if n.Data == tag {
+					found = append(found, n)
+					break
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+func first(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := first(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// siblings returns n's parent's children, n among them.
+func siblings(n *html.Node) []*html.Node {
+	if n.Parent == nil {
+		return []*html.Node{n}
+	}
+	var nodes []*html.Node
+	for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attrOr(n *html.Node, key string) string {
+	value, _ := attr(n, key)
+	return value
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -1,56 +1,810 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	// The runtime image has no zoneinfo database.
+	_ "time/tzdata"
+
+	"notes-backend/internal/backup"
+	"notes-backend/internal/cron"
+	"notes-backend/internal/password"
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/validate"
 )
 
 type Config struct {
 	Port              string
+	DatabaseDriver    string
 	DatabaseURL       string
 	AppPassword       string
+	AppPasswordHash   string
 	SessionCookieName string
 	SessionTTL        time.Duration
 	CookieSecure      bool
 	CookieDomain      string
 	AllowedOrigin     string
 	MigrationsDir     string
+	// ReplicaURL, from DATABASE_URL_READONLY, is a replica of the database
+	// that read-only requests read from while it answers.
+	ReplicaURL string
+	// SessionSliding makes SessionTTL an idle timeout: requests push the
+	// expiry out again, at most every SessionRefresh, but never past
+	// SessionMaxAge after login (0 for no limit).
+	SessionSliding bool
+	SessionRefresh time.Duration
+	SessionMaxAge  time.Duration
+	// RequestTimeout bounds how long a request may take, streams and file
+	// transfers aside; 0 disables it. StatementTimeout has Postgres and
+	// CockroachDB cancel statements that run longer; 0 leaves theirs.
+	RequestTimeout   time.Duration
+	StatementTimeout time.Duration
+	// DBMaxConns and DBMinConns size the Postgres and CockroachDB pool,
+	// whose connections are replaced after DBMaxConnLifetime and have
+	// DBConnectTimeout to connect in; 0 leaves each to pgx's default.
+	DBMaxConns        int
+	DBMinConns        int
+	DBMaxConnLifetime time.Duration
+	DBConnectTimeout  time.Duration
+	// EstimateTotalsAbove enables estimated list totals once the planner
+	// expects at least this many matches; 0 always counts exactly.
+	EstimateTotalsAbove int
+	// DefaultLanguage is given to notes created without a language.
+	DefaultLanguage string
+	// TimeZone decides where calendar days begin for date filters.
+	TimeZone *time.Location
+	// JournalNotebook names the notebook daily notes are made in, created
+	// when missing. JournalTemplate names the template they are made from,
+	// if there is one by that name.
+	JournalNotebook string
+	JournalTemplate string
+	// EncryptionKeys holds the master key notes are encrypted under,
+	// followed by retired keys that are still accepted for reading. Empty
+	// means note content is stored in plain text.
+	EncryptionKeys [][]byte
+	// SessionCleanupInterval is how often expired sessions are deleted; 0
+	// leaves them in place.
+	SessionCleanupInterval time.Duration
+	// TrashRetention is how long deleted notes stay restorable; 0 keeps
+	// them until purged by hand.
+	TrashRetention time.Duration
+	// AuditRetention is how long audit log entries are kept; 0 keeps them
+	// forever.
+	AuditRetention time.Duration
+	// AccessRetention is how long note opens are logged for the recent and
+	// frequent lists; 0 keeps them forever.
+	AccessRetention time.Duration
+	// IdempotencyWindow is how long the responses of requests made with an
+	// Idempotency-Key are kept for their retries; 0 ignores the header.
+	IdempotencyWindow time.Duration
+	// MaxRevisions is how many earlier versions are kept per note; 0
+	// disables history.
+	MaxRevisions int
+	// ConflictStrategy is what becomes of a write made to an earlier
+	// version of a note: "reject", the default, answers with the current
+	// note; "last-write-wins" saves it over that; "fork" saves it as a new
+	// note beside it.
+	ConflictStrategy string
+	// SearchBackend answers note searches: "database", the default, with
+	// the database's own full-text search; "embedded" with an index in the
+	// memory of each process; "meilisearch" with the index MeilisearchIndex
+	// on the Meilisearch server at MeilisearchURL.
+	SearchBackend     string
+	MeilisearchURL    string
+	MeilisearchAPIKey string
+	MeilisearchIndex  string
+	// AttachmentsBackend picks where uploaded files are kept: "local" for
+	// AttachmentsDir or "s3" for the bucket in S3.
+	AttachmentsBackend string
+	AttachmentsDir     string
+	S3                 storage.S3Config
+	MaxAttachmentBytes int64
+	// NoteLimits cap the title, tags and content notes are written with.
+	NoteLimits validate.Limits
+	// MarkdownRenderer is the dialect note content is rendered as HTML in:
+	// "gfm", the default, or "commonmark".
+	MarkdownRenderer string
+	// MarkdownHardWraps renders single line breaks as <br>.
+	MarkdownHardWraps bool
+	// LoginRateLimit is how many login attempts a client IP gets a minute,
+	// up to LoginRateBurst at once; 0 disables the limit.
+	LoginRateLimit int
+	LoginRateBurst int
+	// APIRateLimit does the same for every other request but /health; 0,
+	// the default, disables it. A zero APIRateBurst means APIRateLimit.
+	APIRateLimit int
+	APIRateBurst int
+	// RateLimitRedisURL keeps the buckets in Redis, shared by all replicas,
+	// instead of in each process.
+	RateLimitRedisURL string
+	// CacheTTL keeps the first pages of GET /notes and the tag list for
+	// that long, until the next write; 0, the default, disables the cache.
+	// CacheRedisURL keeps them in Redis, shared by all replicas, instead of
+	// in each process.
+	CacheTTL      time.Duration
+	CacheRedisURL string
+	// APIDocs serves Swagger UI at /docs.
+	APIDocs bool
+	// LogLevel is "info", which logs every request, or "warn", which
+	// leaves requests out and logs only the rest.
+	LogLevel string
+	// MaintenanceMode starts the server refusing writes, as POST
+	// /admin/maintenance can later; MaintenanceMessage is what it tells
+	// clients then.
+	MaintenanceMode    bool
+	MaintenanceMessage string
+	// FeedSecret signs the tokens that authenticate feed URLs such as the
+	// calendar's; empty disables the feeds. Changing it revokes every URL
+	// handed out.
+	FeedSecret string
+	// EmailIngestSecret authenticates the inbound-parse webhooks of POST
+	// /ingest/email: the Mailgun signing key, or the secret query parameter
+	// of a SendGrid Inbound Parse URL. Empty disables the endpoint.
+	EmailIngestSecret string
+	// TelegramBotToken is the token of the bot whose webhook, POST
+	// /ingest/telegram, takes notes from its messages; empty disables it.
+	TelegramBotToken string
+	// TelegramAllowedUsers are the Telegram user IDs the bot answers, as
+	// anyone can message a bot.
+	TelegramAllowedUsers []int64
+	// ClipAllowedHosts, when set, are the only hosts POST /clip fetches
+	// pages and pictures from; "*.example.com" covers subdomains.
+	// ClipAllowPrivate lets it reach private addresses, such as an intranet
+	// wiki. ClipTimeout bounds a whole clip, pictures included, and
+	// ClipMaxPageBytes the page itself.
+	ClipAllowedHosts []string
+	ClipAllowPrivate bool
+	ClipTimeout      time.Duration
+	ClipMaxPageBytes int64
+	// BackupBackend picks where database backups are kept, like
+	// AttachmentsBackend: BackupDir, or BackupS3Prefix in the S3 bucket.
+	BackupBackend  string
+	BackupDir      string
+	BackupS3Prefix string
+	// BackupSchedule is when backups are taken, in TimeZone; nil takes
+	// them only through POST /admin/backup.
+	BackupSchedule *cron.Schedule
+	// BackupKeep is how many backups are kept, the newest; 0 keeps all.
+	BackupKeep int
+	// BackupFormat is "json", the export format, or "pg_dump", a custom
+	// format archive of a Postgres database.
+	BackupFormat string
+	// CompressionLevel is the gzip and deflate level responses are
+	// compressed with, from 1 (fastest) to 9 (smallest); 0 sends them as is.
+	CompressionLevel int
+	// OTLPEndpoint is the OTLP/HTTP URL spans of requests and queries are
+	// exported to, with OTLPHeaders; empty disables tracing.
+	// TraceSampleRatio is the share of new traces recorded; those continued
+	// from a traceparent header follow its sampled flag.
+	OTLPEndpoint     string
+	OTLPHeaders      map[string]string
+	ServiceName      string
+	TraceSampleRatio float64
+	// TLSCertFile and TLSKeyFile have the server speak HTTPS, and HTTP/2,
+	// itself; the files are read again when they change. TLSAutocertDomains
+	// instead gets certificates from Let's Encrypt, for those hosts only,
+	// kept in TLSAutocertCacheDir; TLSAutocertEmail is told of problems
+	// with them. HTTPRedirectPort, set with either, is a plain HTTP port
+	// that redirects to HTTPS and answers ACME challenges.
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocertDomains  []string
+	TLSAutocertCacheDir string
+	TLSAutocertEmail    string
+	HTTPRedirectPort    string
+	// ListenSocket is the Unix socket the server listens on instead of
+	// PORT, when set, given SocketMode permissions.
+	ListenSocket string
+	SocketMode   os.FileMode
+	// TrustedProxies are the peers, as addresses or CIDR ranges, whose
+	// X-Forwarded-For and X-Real-IP headers name the client. Anyone else
+	// is known by the address it connects from, except on ListenSocket,
+	// where only local processes can connect.
+	TrustedProxies []netip.Prefix
 }
 
+// minSecret keeps feed tokens and webhook signatures from being forged by
+// guessing the key.
+const minSecret = 32
+
+// AttachmentBackends lists the accepted ATTACHMENTS_BACKEND values.
+var AttachmentBackends = []string{"local", "s3"}
+
+// LogLevels lists the accepted LOG_LEVEL values.
+var LogLevels = []string{"info", "warn"}
+
+// ConflictStrategies lists the accepted CONFLICT_STRATEGY values.
+var ConflictStrategies = []string{"reject", "last-write-wins", "fork"}
+
+// SearchBackends lists the accepted SEARCH_BACKEND values.
+var SearchBackends = []string{"database", "embedded", "meilisearch"}
+
+// MarkdownRenderers lists the accepted MARKDOWN_RENDERER values.
+var MarkdownRenderers = []string{"gfm", "commonmark"}
+
+// DatabaseDrivers lists the accepted DATABASE_DRIVER values; each has a
+// matching migrations directory.
+var DatabaseDrivers = []string{"postgres", "cockroach", "sqlite", "mysql"}
+
+// Load reads the configuration from environment variables.
 func Load() (Config, error) {
-	sessionHours := getEnv("SESSION_TTL_HOURS", "168")
+	return LoadFrom("", nil)
+}
+
+// LoadFrom reads the configuration from the YAML or TOML file at path, if
+// path is not empty, with environment variables overriding its settings
+// and overrides, such as command-line flags, overriding both. Overrides
+// are keyed like the file. Every problem found is reported, as Errors.
+func LoadFrom(path string, overrides map[string]string) (Config, error) {
+	env, err := newEnvironment(path, overrides)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, problems := load(env)
+	problems = append(problems, env.unknown()...)
+	if len(problems) > 0 {
+		return Config{}, problems
+	}
+	return cfg, nil
+}
+
+func load(env *environment) (Config, Errors) {
+	var problems Errors
+	sessionHours := env.getOr("SESSION_TTL_HOURS", "168")
 	hours, err := strconv.Atoi(sessionHours)
 	if err != nil || hours <= 0 {
-		return Config{}, fmt.Errorf("invalid SESSION_TTL_HOURS: %q", sessionHours)
+		problems = append(problems, fmt.Errorf("invalid SESSION_TTL_HOURS: %q", sessionHours))
 	}
 
 	cfg := Config{
-		Port:              getEnv("PORT", "8080"),
-		DatabaseURL:       strings.TrimSpace(os.Getenv("DATABASE_URL")),
-		AppPassword:       strings.TrimSpace(os.Getenv("APP_PASSWORD")),
-		SessionCookieName: getEnv("SESSION_COOKIE_NAME", "notes_session"),
+		Port:              env.getOr("PORT", "8080"),
+		DatabaseDriver:    strings.ToLower(strings.TrimSpace(env.get("DATABASE_DRIVER"))),
+		DatabaseURL:       strings.TrimSpace(env.get("DATABASE_URL")),
+		AppPassword:       strings.TrimSpace(env.get("APP_PASSWORD")),
+		AppPasswordHash:   strings.TrimSpace(env.get("APP_PASSWORD_HASH")),
+		SessionCookieName: env.getOr("SESSION_COOKIE_NAME", "notes_session"),
 		SessionTTL:        time.Duration(hours) * time.Hour,
-		CookieSecure:      strings.EqualFold(getEnv("SESSION_COOKIE_SECURE", "false"), "true"),
-		CookieDomain:      strings.TrimSpace(os.Getenv("SESSION_COOKIE_DOMAIN")),
-		AllowedOrigin:     strings.TrimSpace(os.Getenv("ALLOWED_ORIGIN")),
-		MigrationsDir:     getEnv("MIGRATIONS_DIR", "../db/migrations"),
+		CookieSecure:      strings.EqualFold(env.getOr("SESSION_COOKIE_SECURE", "false"), "true"),
+		CookieDomain:      strings.TrimSpace(env.get("SESSION_COOKIE_DOMAIN")),
+		AllowedOrigin:     strings.TrimSpace(env.get("ALLOWED_ORIGIN")),
+		MigrationsDir:     strings.TrimSpace(env.get("MIGRATIONS_DIR")),
+	}
+
+	cfg.DefaultLanguage = strings.ToLower(env.getOr("DEFAULT_NOTE_LANGUAGE", store.DefaultLanguage))
+	if !slices.Contains(store.Languages, cfg.DefaultLanguage) {
+		problems = append(problems, fmt.Errorf("invalid DEFAULT_NOTE_LANGUAGE: %q (expected one of %s)", cfg.DefaultLanguage, strings.Join(store.Languages, ", ")))
+	}
+
+	cfg.JournalNotebook = store.NormalizeText(env.getOr("JOURNAL_NOTEBOOK", "Journal"))
+	cfg.JournalTemplate = store.NormalizeText(env.getOr("JOURNAL_TEMPLATE", "Daily note"))
+
+	zone := env.getOr("TIME_ZONE", "UTC")
+	cfg.TimeZone, err = time.LoadLocation(zone)
+	if err != nil || zone == "Local" {
+		problems = append(problems, fmt.Errorf("invalid TIME_ZONE: %q (expected an IANA name such as Europe/Berlin)", zone))
+	}
+
+	cfg.SessionSliding = strings.EqualFold(env.getOr("SESSION_SLIDING", "false"), "true")
+	refreshRaw := env.getOr("SESSION_REFRESH_MINUTES", "5")
+	refreshMinutes, err := strconv.Atoi(refreshRaw)
+	if err != nil || refreshMinutes < 0 {
+		problems = append(problems, fmt.Errorf("invalid SESSION_REFRESH_MINUTES: %q", refreshRaw))
+	}
+	cfg.SessionRefresh = time.Duration(refreshMinutes) * time.Minute
+	maxAgeRaw := env.getOr("SESSION_MAX_AGE_HOURS", "720")
+	maxAgeHours, err := strconv.Atoi(maxAgeRaw)
+	if err != nil || maxAgeHours < 0 {
+		problems = append(problems, fmt.Errorf("invalid SESSION_MAX_AGE_HOURS: %q", maxAgeRaw))
+	}
+	cfg.SessionMaxAge = time.Duration(maxAgeHours) * time.Hour
+
+	requestRaw := env.getOr("REQUEST_TIMEOUT_SECONDS", "30")
+	requestSeconds, err := strconv.Atoi(requestRaw)
+	if err != nil || requestSeconds < 0 {
+		problems = append(problems, fmt.Errorf("invalid REQUEST_TIMEOUT_SECONDS: %q", requestRaw))
+	}
+	cfg.RequestTimeout = time.Duration(requestSeconds) * time.Second
+	statementRaw := env.getOr("STATEMENT_TIMEOUT_SECONDS", "0")
+	statementSeconds, err := strconv.Atoi(statementRaw)
+	if err != nil || statementSeconds < 0 {
+		problems = append(problems, fmt.Errorf("invalid STATEMENT_TIMEOUT_SECONDS: %q", statementRaw))
+	}
+	cfg.StatementTimeout = time.Duration(statementSeconds) * time.Second
+	maxConnsRaw := env.getOr("DB_MAX_CONNS", "0")
+	cfg.DBMaxConns, err = strconv.Atoi(maxConnsRaw)
+	if err != nil || cfg.DBMaxConns < 0 {
+		problems = append(problems, fmt.Errorf("invalid DB_MAX_CONNS: %q", maxConnsRaw))
+	}
+	minConnsRaw := env.getOr("DB_MIN_CONNS", "0")
+	cfg.DBMinConns, err = strconv.Atoi(minConnsRaw)
+	if err != nil || cfg.DBMinConns < 0 {
+		problems = append(problems, fmt.Errorf("invalid DB_MIN_CONNS: %q", minConnsRaw))
+	}
+	if cfg.DBMaxConns > 0 && cfg.DBMinConns > cfg.DBMaxConns {
+		problems = append(problems, fmt.Errorf("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", cfg.DBMinConns, cfg.DBMaxConns))
+	}
+	lifetimeRaw := env.getOr("DB_MAX_CONN_LIFETIME_SECONDS", "0")
+	lifetimeSeconds, err := strconv.Atoi(lifetimeRaw)
+	if err != nil || lifetimeSeconds < 0 {
+		problems = append(problems, fmt.Errorf("invalid DB_MAX_CONN_LIFETIME_SECONDS: %q", lifetimeRaw))
+	}
+	cfg.DBMaxConnLifetime = time.Duration(lifetimeSeconds) * time.Second
+	connectRaw := env.getOr("DB_CONNECT_TIMEOUT_SECONDS", "0")
+	connectSeconds, err := strconv.Atoi(connectRaw)
+	if err != nil || connectSeconds < 0 {
+		problems = append(problems, fmt.Errorf("invalid DB_CONNECT_TIMEOUT_SECONDS: %q", connectRaw))
+	}
+	cfg.DBConnectTimeout = time.Duration(connectSeconds) * time.Second
+
+	cleanupRaw := env.getOr("SESSION_CLEANUP_MINUTES", "60")
+	cleanupMinutes, err := strconv.Atoi(cleanupRaw)
+	if err != nil || cleanupMinutes < 0 {
+		problems = append(problems, fmt.Errorf("invalid SESSION_CLEANUP_MINUTES: %q", cleanupRaw))
+	}
+	cfg.SessionCleanupInterval = time.Duration(cleanupMinutes) * time.Minute
+
+	retentionRaw := env.getOr("TRASH_RETENTION_DAYS", "30")
+	retentionDays, err := strconv.Atoi(retentionRaw)
+	if err != nil || retentionDays < 0 {
+		problems = append(problems, fmt.Errorf("invalid TRASH_RETENTION_DAYS: %q", retentionRaw))
+	}
+	cfg.TrashRetention = time.Duration(retentionDays) * 24 * time.Hour
+
+	auditRaw := env.getOr("AUDIT_RETENTION_DAYS", "90")
+	auditDays, err := strconv.Atoi(auditRaw)
+	if err != nil || auditDays < 0 {
+		problems = append(problems, fmt.Errorf("invalid AUDIT_RETENTION_DAYS: %q", auditRaw))
+	}
+	cfg.AuditRetention = time.Duration(auditDays) * 24 * time.Hour
+
+	accessRaw := env.getOr("ACCESS_RETENTION_DAYS", "90")
+	accessDays, err := strconv.Atoi(accessRaw)
+	if err != nil || accessDays < 0 {
+		problems = append(problems, fmt.Errorf("invalid ACCESS_RETENTION_DAYS: %q", accessRaw))
+	}
+	cfg.AccessRetention = time.Duration(accessDays) * 24 * time.Hour
+
+	idempotencyRaw := env.getOr("IDEMPOTENCY_WINDOW_HOURS", "24")
+	idempotencyHours, err := strconv.Atoi(idempotencyRaw)
+	if err != nil || idempotencyHours < 0 {
+		problems = append(problems, fmt.Errorf("invalid IDEMPOTENCY_WINDOW_HOURS: %q", idempotencyRaw))
+	}
+	cfg.IdempotencyWindow = time.Duration(idempotencyHours) * time.Hour
+
+	revisionsRaw := env.getOr("MAX_NOTE_REVISIONS", "50")
+	cfg.MaxRevisions, err = strconv.Atoi(revisionsRaw)
+	if err != nil || cfg.MaxRevisions < 0 {
+		problems = append(problems, fmt.Errorf("invalid MAX_NOTE_REVISIONS: %q", revisionsRaw))
+	}
+	cfg.ConflictStrategy = strings.ToLower(env.getOr("CONFLICT_STRATEGY", "reject"))
+	if !slices.Contains(ConflictStrategies, cfg.ConflictStrategy) {
+		problems = append(problems, fmt.Errorf("invalid CONFLICT_STRATEGY: %q (expected one of %s)", cfg.ConflictStrategy, strings.Join(ConflictStrategies, ", ")))
+	}
+	cfg.SearchBackend = strings.ToLower(env.getOr("SEARCH_BACKEND", "database"))
+	if !slices.Contains(SearchBackends, cfg.SearchBackend) {
+		problems = append(problems, fmt.Errorf("invalid SEARCH_BACKEND: %q (expected one of %s)", cfg.SearchBackend, strings.Join(SearchBackends, ", ")))
+	}
+	cfg.MeilisearchURL = strings.TrimSpace(env.get("MEILISEARCH_URL"))
+	cfg.MeilisearchAPIKey = env.get("MEILISEARCH_API_KEY")
+	cfg.MeilisearchIndex = env.getOr("MEILISEARCH_INDEX", "notes")
+	if cfg.SearchBackend == "meilisearch" {
+		if u, err := url.Parse(cfg.MeilisearchURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("SEARCH_BACKEND=meilisearch requires MEILISEARCH_URL to be an http or https URL"))
+		}
+	}
+
+	estimateRaw := env.getOr("ESTIMATE_TOTALS_ABOVE", "0")
+	cfg.EstimateTotalsAbove, err = strconv.Atoi(estimateRaw)
+	if err != nil || cfg.EstimateTotalsAbove < 0 {
+		problems = append(problems, fmt.Errorf("invalid ESTIMATE_TOTALS_ABOVE: %q", estimateRaw))
+	}
+
+	cfg.AttachmentsBackend = strings.ToLower(env.getOr("ATTACHMENTS_BACKEND", "local"))
+	if !slices.Contains(AttachmentBackends, cfg.AttachmentsBackend) {
+		problems = append(problems, fmt.Errorf("invalid ATTACHMENTS_BACKEND: %q (expected one of %s)", cfg.AttachmentsBackend, strings.Join(AttachmentBackends, ", ")))
+	}
+	cfg.AttachmentsDir = env.getOr("ATTACHMENTS_DIR", "data/attachments")
+	cfg.S3 = storage.S3Config{
+		Endpoint:        strings.TrimSpace(env.get("S3_ENDPOINT")),
+		Region:          env.getOr("S3_REGION", "us-east-1"),
+		Bucket:          strings.TrimSpace(env.get("S3_BUCKET")),
+		AccessKeyID:     strings.TrimSpace(env.get("S3_ACCESS_KEY_ID")),
+		SecretAccessKey: strings.TrimSpace(env.get("S3_SECRET_ACCESS_KEY")),
+		PathStyle:       strings.EqualFold(env.getOr("S3_PATH_STYLE", "false"), "true"),
+	}
+	if cfg.AttachmentsBackend == "s3" && (cfg.S3.Bucket == "" || cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "") {
+		problems = append(problems, fmt.Errorf("ATTACHMENTS_BACKEND=s3 requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY"))
+	}
+
+	attachmentRaw := env.getOr("MAX_ATTACHMENT_MB", "25")
+	attachmentMB, err := strconv.Atoi(attachmentRaw)
+	if err != nil || attachmentMB <= 0 {
+		problems = append(problems, fmt.Errorf("invalid MAX_ATTACHMENT_MB: %q", attachmentRaw))
+	}
+	cfg.MaxAttachmentBytes = int64(attachmentMB) << 20
+
+	cfg.NoteLimits = validate.DefaultLimits
+	titleRaw := env.getOr("MAX_NOTE_TITLE_CHARS", strconv.Itoa(cfg.NoteLimits.TitleChars))
+	cfg.NoteLimits.TitleChars, err = strconv.Atoi(titleRaw)
+	if err != nil || cfg.NoteLimits.TitleChars < 0 {
+		problems = append(problems, fmt.Errorf("invalid MAX_NOTE_TITLE_CHARS: %q", titleRaw))
+	}
+	tagsRaw := env.getOr("MAX_NOTE_TAGS", strconv.Itoa(cfg.NoteLimits.Tags))
+	cfg.NoteLimits.Tags, err = strconv.Atoi(tagsRaw)
+	if err != nil || cfg.NoteLimits.Tags < 0 {
+		problems = append(problems, fmt.Errorf("invalid MAX_NOTE_TAGS: %q", tagsRaw))
+	}
+	contentRaw := env.getOr("MAX_NOTE_MB", strconv.Itoa(cfg.NoteLimits.ContentBytes>>20))
+	contentMB, err := strconv.Atoi(contentRaw)
+	if err != nil || contentMB < 0 {
+		problems = append(problems, fmt.Errorf("invalid MAX_NOTE_MB: %q", contentRaw))
+	}
+	cfg.NoteLimits.ContentBytes = contentMB << 20
+
+	cfg.MarkdownRenderer = strings.ToLower(env.getOr("MARKDOWN_RENDERER", "gfm"))
+	if !slices.Contains(MarkdownRenderers, cfg.MarkdownRenderer) {
+		problems = append(problems, fmt.Errorf("invalid MARKDOWN_RENDERER: %q (expected one of %s)", cfg.MarkdownRenderer, strings.Join(MarkdownRenderers, ", ")))
+	}
+	cfg.MarkdownHardWraps = strings.EqualFold(env.getOr("MARKDOWN_HARD_WRAPS", "false"), "true")
+
+	for _, limit := range []struct {
+		key, fallback string
+		value         *int
+	}{
+		{"LOGIN_RATE_LIMIT", "10", &cfg.LoginRateLimit},
+		{"LOGIN_RATE_BURST", "5", &cfg.LoginRateBurst},
+		{"API_RATE_LIMIT", "0", &cfg.APIRateLimit},
+		{"API_RATE_BURST", "0", &cfg.APIRateBurst},
+	} {
+		raw := env.getOr(limit.key, limit.fallback)
+		*limit.value, err = strconv.Atoi(raw)
+		if err != nil || *limit.value < 0 {
+			problems = append(problems, fmt.Errorf("invalid %s: %q", limit.key, raw))
+		}
+	}
+	cfg.RateLimitRedisURL = strings.TrimSpace(env.get("RATE_LIMIT_REDIS_URL"))
+	cacheRaw := env.getOr("CACHE_TTL_SECONDS", "0")
+	cacheSeconds, err := strconv.Atoi(cacheRaw)
+	if err != nil || cacheSeconds < 0 {
+		problems = append(problems, fmt.Errorf("invalid CACHE_TTL_SECONDS: %q", cacheRaw))
+	}
+	cfg.CacheTTL = time.Duration(cacheSeconds) * time.Second
+	cfg.CacheRedisURL = strings.TrimSpace(env.get("CACHE_REDIS_URL"))
+	cfg.APIDocs = strings.EqualFold(env.getOr("API_DOCS", "false"), "true")
+	cfg.LogLevel = strings.ToLower(env.getOr("LOG_LEVEL", "info"))
+	if !slices.Contains(LogLevels, cfg.LogLevel) {
+		problems = append(problems, fmt.Errorf("invalid LOG_LEVEL: %q (expected one of %s)", cfg.LogLevel, strings.Join(LogLevels, ", ")))
+	}
+	cfg.MaintenanceMode = strings.EqualFold(env.getOr("MAINTENANCE_MODE", "false"), "true")
+	cfg.MaintenanceMessage = strings.TrimSpace(env.get("MAINTENANCE_MESSAGE"))
+
+	compressionRaw := env.getOr("COMPRESSION_LEVEL", "5")
+	cfg.CompressionLevel, err = strconv.Atoi(compressionRaw)
+	if err != nil || cfg.CompressionLevel < 0 || cfg.CompressionLevel > 9 {
+		problems = append(problems, fmt.Errorf("invalid COMPRESSION_LEVEL: %q (expected 0 to 9)", compressionRaw))
+	}
+
+	cfg.FeedSecret = strings.TrimSpace(env.get("FEED_SECRET"))
+	if cfg.FeedSecret != "" && len(cfg.FeedSecret) < minSecret {
+		problems = append(problems, fmt.Errorf("invalid FEED_SECRET: expected at least %d characters (openssl rand -base64 32)", minSecret))
+	}
+	cfg.EmailIngestSecret = strings.TrimSpace(env.get("EMAIL_INGEST_SECRET"))
+	if cfg.EmailIngestSecret != "" && len(cfg.EmailIngestSecret) < minSecret {
+		problems = append(problems, fmt.Errorf("invalid EMAIL_INGEST_SECRET: expected at least %d characters", minSecret))
+	}
+	cfg.TelegramBotToken = strings.TrimSpace(env.get("TELEGRAM_BOT_TOKEN"))
+	for _, field := range strings.Split(env.get("TELEGRAM_ALLOWED_USERS"), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id <= 0 {
+			problems = append(problems, fmt.Errorf("invalid TELEGRAM_ALLOWED_USERS: %q is not a user ID", field))
+		}
+		cfg.TelegramAllowedUsers = append(cfg.TelegramAllowedUsers, id)
+	}
+	if cfg.TelegramBotToken != "" && len(cfg.TelegramAllowedUsers) == 0 {
+		problems = append(problems, fmt.Errorf("TELEGRAM_ALLOWED_USERS is required with TELEGRAM_BOT_TOKEN"))
+	}
+
+	for _, host := range strings.Split(env.get("CLIP_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cfg.ClipAllowedHosts = append(cfg.ClipAllowedHosts, host)
+		}
+	}
+	cfg.ClipAllowPrivate = strings.EqualFold(env.getOr("CLIP_ALLOW_PRIVATE", "false"), "true")
+	clipTimeoutRaw := env.getOr("CLIP_TIMEOUT_SECONDS", "30")
+	clipSeconds, err := strconv.Atoi(clipTimeoutRaw)
+	if err != nil || clipSeconds <= 0 {
+		problems = append(problems, fmt.Errorf("invalid CLIP_TIMEOUT_SECONDS: %q", clipTimeoutRaw))
+	}
+	cfg.ClipTimeout = time.Duration(clipSeconds) * time.Second
+	clipPageRaw := env.getOr("CLIP_MAX_PAGE_MB", "5")
+	clipPageMB, err := strconv.Atoi(clipPageRaw)
+	if err != nil || clipPageMB <= 0 {
+		problems = append(problems, fmt.Errorf("invalid CLIP_MAX_PAGE_MB: %q", clipPageRaw))
+	}
+	cfg.ClipMaxPageBytes = int64(clipPageMB) << 20
+
+	cfg.BackupBackend = strings.ToLower(env.getOr("BACKUP_BACKEND", "local"))
+	if !slices.Contains(AttachmentBackends, cfg.BackupBackend) {
+		problems = append(problems, fmt.Errorf("invalid BACKUP_BACKEND: %q (expected one of %s)", cfg.BackupBackend, strings.Join(AttachmentBackends, ", ")))
+	}
+	if cfg.BackupBackend == "s3" && (cfg.S3.Bucket == "" || cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "") {
+		problems = append(problems, fmt.Errorf("BACKUP_BACKEND=s3 requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY"))
+	}
+	cfg.BackupDir = env.getOr("BACKUP_DIR", "data/backups")
+	cfg.BackupS3Prefix = env.getOr("BACKUP_S3_PREFIX", "backups/")
+	if spec := strings.TrimSpace(env.get("BACKUP_SCHEDULE")); spec != "" {
+		cfg.BackupSchedule, err = cron.Parse(spec)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid BACKUP_SCHEDULE: %w", err))
+		}
+	}
+	backupKeepRaw := env.getOr("BACKUP_KEEP", "7")
+	cfg.BackupKeep, err = strconv.Atoi(backupKeepRaw)
+	if err != nil || cfg.BackupKeep < 0 {
+		problems = append(problems, fmt.Errorf("invalid BACKUP_KEEP: %q", backupKeepRaw))
+	}
+	cfg.BackupFormat = strings.ToLower(env.getOr("BACKUP_FORMAT", backup.FormatJSON))
+	if !slices.Contains(backup.Formats, cfg.BackupFormat) {
+		problems = append(problems, fmt.Errorf("invalid BACKUP_FORMAT: %q (expected one of %s)", cfg.BackupFormat, strings.Join(backup.Formats, ", ")))
+	}
+
+	if err := loadTracing(env, &cfg); err != nil {
+		problems = append(problems, err)
+	}
+	problems = append(problems, loadTLS(env, &cfg)...)
+
+	if listen := strings.TrimSpace(env.get("LISTEN")); listen != "" {
+		path, ok := strings.CutPrefix(listen, "unix:")
+		if !ok || path == "" {
+			problems = append(problems, fmt.Errorf("invalid LISTEN: %q (expected unix:/path/to.sock; set PORT for TCP)", listen))
+		}
+		cfg.ListenSocket = path
+		if cfg.HTTPRedirectPort != "" {
+			problems = append(problems, fmt.Errorf("HTTP_REDIRECT_PORT cannot be used with a LISTEN socket"))
+		}
+	}
+	modeRaw := env.getOr("LISTEN_SOCKET_MODE", "0660")
+	mode, err := strconv.ParseUint(modeRaw, 8, 32)
+	if err != nil || mode > 0o777 {
+		problems = append(problems, fmt.Errorf("invalid LISTEN_SOCKET_MODE: %q (expected octal permissions such as 0660)", modeRaw))
+	}
+	cfg.SocketMode = os.FileMode(mode)
+	for _, raw := range strings.Split(env.get("TRUSTED_PROXIES"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(raw)
+		if addr, addrErr := netip.ParseAddr(raw); addrErr == nil {
+			addr = addr.Unmap()
+			prefix, err = addr.Prefix(addr.BitLen())
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid TRUSTED_PROXIES: %q (expected addresses or CIDR ranges)", raw))
+			continue
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix.Masked())
+	}
+
+	cfg.EncryptionKeys, err = loadEncryptionKeys(env)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	// Meilisearch would be sent the notes that are encrypted at rest.
+	if len(cfg.EncryptionKeys) > 0 && cfg.SearchBackend == "meilisearch" {
+		problems = append(problems, fmt.Errorf("SEARCH_BACKEND=meilisearch cannot be used with ENCRYPTION_KEY"))
 	}
 
 	if cfg.DatabaseURL == "" {
-		return Config{}, fmt.Errorf("DATABASE_URL is required")
+		problems = append(problems, fmt.Errorf("DATABASE_URL is required"))
 	}
-	if cfg.AppPassword == "" {
-		return Config{}, fmt.Errorf("APP_PASSWORD is required")
+	if driver, dsn, ok := databaseFromURL(cfg.DatabaseURL); ok {
+		if cfg.DatabaseDriver != "" && cfg.DatabaseDriver != driver {
+			problems = append(problems, fmt.Errorf("DATABASE_DRIVER %q does not match the %s DATABASE_URL", cfg.DatabaseDriver, driver))
+		}
+		cfg.DatabaseDriver, cfg.DatabaseURL = driver, dsn
 	}
-	return cfg, nil
+	if cfg.DatabaseDriver == "" {
+		cfg.DatabaseDriver = "postgres"
+	}
+	if !slices.Contains(DatabaseDrivers, cfg.DatabaseDriver) {
+		problems = append(problems, fmt.Errorf("invalid DATABASE_DRIVER: %q (expected one of %s)", cfg.DatabaseDriver, strings.Join(DatabaseDrivers, ", ")))
+	}
+	cfg.ReplicaURL = strings.TrimSpace(env.get("DATABASE_URL_READONLY"))
+	if cfg.ReplicaURL != "" {
+		if driver, dsn, ok := databaseFromURL(cfg.ReplicaURL); ok {
+			if driver != cfg.DatabaseDriver {
+				problems = append(problems, fmt.Errorf("DATABASE_URL_READONLY names a %s database, not %s", driver, cfg.DatabaseDriver))
+			}
+			cfg.ReplicaURL = dsn
+		}
+		if cfg.DatabaseDriver == "sqlite" {
+			problems = append(problems, fmt.Errorf("DATABASE_URL_READONLY cannot be used with sqlite"))
+		}
+	}
+	if cfg.BackupFormat == backup.FormatPgDump && cfg.DatabaseDriver != "postgres" {
+		problems = append(problems, fmt.Errorf("BACKUP_FORMAT=pg_dump requires DATABASE_DRIVER=postgres"))
+	}
+	switch {
+	case cfg.AppPassword != "" && cfg.AppPasswordHash != "":
+		problems = append(problems, fmt.Errorf("set APP_PASSWORD or APP_PASSWORD_HASH, not both"))
+	case cfg.AppPasswordHash != "":
+		if err := password.Check(cfg.AppPasswordHash); err != nil {
+			problems = append(problems, fmt.Errorf("invalid APP_PASSWORD_HASH: %w", err))
+		}
+	case cfg.AppPassword == "":
+		problems = append(problems, fmt.Errorf("APP_PASSWORD or APP_PASSWORD_HASH is required"))
+	}
+	return cfg, problems
 }
 
-func getEnv(key, fallback string) string {
-	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
-		return value
+// loadEncryptionKeys decodes ENCRYPTION_KEY and the comma-separated
+// ENCRYPTION_OLD_KEYS. Errors never echo key material.
+func loadEncryptionKeys(env *environment) ([][]byte, error) {
+	current := strings.TrimSpace(env.get("ENCRYPTION_KEY"))
+	old := strings.TrimSpace(env.get("ENCRYPTION_OLD_KEYS"))
+	if current == "" {
+		if old != "" {
+			return nil, fmt.Errorf("ENCRYPTION_OLD_KEYS requires ENCRYPTION_KEY")
+		}
+		return nil, nil
+	}
+
+	encoded := []string{current}
+	if old != "" {
+		encoded = append(encoded, strings.Split(old, ",")...)
+	}
+	keys := make([][]byte, 0, len(encoded))
+	for i, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(key) != 32 {
+			if i == 0 {
+				return nil, fmt.Errorf("invalid ENCRYPTION_KEY: expected 32 bytes in base64 (openssl rand -base64 32)")
+			}
+			return nil, fmt.Errorf("invalid ENCRYPTION_OLD_KEYS: entry %d is not 32 bytes in base64", i)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// loadTracing reads the standard OTEL_ variables the server supports. The
+// exporter speaks OTLP/HTTP in JSON only, so other protocols are refused
+// rather than silently sending a collector what it cannot read.
+func loadTracing(env *environment, cfg *Config) error {
+	cfg.OTLPEndpoint = strings.TrimSpace(env.get("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"))
+	if cfg.OTLPEndpoint == "" {
+		if base := strings.TrimSpace(env.get("OTEL_EXPORTER_OTLP_ENDPOINT")); base != "" {
+			cfg.OTLPEndpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	cfg.ServiceName = env.getOr("OTEL_SERVICE_NAME", "notes-backend")
+	if cfg.OTLPEndpoint != "" {
+		if u, err := url.Parse(cfg.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT: %q is not an http or https URL", cfg.OTLPEndpoint)
+		}
+	}
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		if protocol := strings.TrimSpace(env.get(key)); protocol != "" && protocol != "http/json" {
+			return fmt.Errorf("invalid %s: %q (only http/json is supported)", key, protocol)
+		}
+	}
+	for _, pair := range strings.Split(env.get("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+		if !ok || strings.TrimSpace(key) == "" || err != nil {
+			return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: expected key=value pairs")
+		}
+		if cfg.OTLPHeaders == nil {
+			cfg.OTLPHeaders = map[string]string{}
+		}
+		cfg.OTLPHeaders[strings.TrimSpace(key)] = decoded
+	}
+	ratioRaw := env.getOr("OTEL_TRACES_SAMPLER_ARG", "1")
+	ratio, err := strconv.ParseFloat(ratioRaw, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG: %q (expected 0 to 1)", ratioRaw)
+	}
+	cfg.TraceSampleRatio = ratio
+	return nil
+}
+
+func loadTLS(env *environment, cfg *Config) Errors {
+	var problems Errors
+	cfg.TLSCertFile = strings.TrimSpace(env.get("TLS_CERT_FILE"))
+	cfg.TLSKeyFile = strings.TrimSpace(env.get("TLS_KEY_FILE"))
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	for _, domain := range strings.Split(env.get("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain == "" {
+			continue
+		}
+		if strings.ContainsAny(domain, "/:*") || !strings.Contains(domain, ".") {
+			problems = append(problems, fmt.Errorf("invalid TLS_AUTOCERT_DOMAINS: %q is not a host name (wildcards are not supported)", domain))
+		}
+		cfg.TLSAutocertDomains = append(cfg.TLSAutocertDomains, domain)
+	}
+	cfg.TLSAutocertCacheDir = env.getOr("TLS_AUTOCERT_CACHE_DIR", "data/autocert")
+	cfg.TLSAutocertEmail = strings.TrimSpace(env.get("TLS_AUTOCERT_EMAIL"))
+	if cfg.TLSCertFile != "" && len(cfg.TLSAutocertDomains) > 0 {
+		problems = append(problems, fmt.Errorf("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS cannot both be set"))
+	}
+	cfg.HTTPRedirectPort = strings.TrimSpace(env.get("HTTP_REDIRECT_PORT"))
+	if cfg.HTTPRedirectPort != "" {
+		if port, err := strconv.Atoi(cfg.HTTPRedirectPort); err != nil || port <= 0 || port > 65535 {
+			problems = append(problems, fmt.Errorf("invalid HTTP_REDIRECT_PORT: %q", cfg.HTTPRedirectPort))
+		}
+		if cfg.TLSCertFile == "" && len(cfg.TLSAutocertDomains) == 0 {
+			problems = append(problems, fmt.Errorf("HTTP_REDIRECT_PORT requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS"))
+		}
+		if cfg.HTTPRedirectPort == cfg.Port {
+			problems = append(problems, fmt.Errorf("HTTP_REDIRECT_PORT cannot be PORT"))
+		}
+	}
+	return problems
+}
+
+// databaseFromURL picks the driver a DATABASE_URL names by its scheme and
+// rewrites it into what that driver opens: postgres:// and postgresql://
+// as they are, cockroach:// as postgresql://, sqlite:// (or file:) as a
+// file path and mysql:// as a go-sql-driver DSN. Anything else, plain
+// paths and DSNs included, is left to DATABASE_DRIVER.
+func databaseFromURL(raw string) (driver, dsn string, ok bool) {
+	scheme, rest, found := strings.Cut(raw, ":")
+	if !found {
+		return "", "", false
+	}
+	scheme = strings.ToLower(scheme)
+	// Without the slashes it may be a MySQL DSN whose user is "postgres".
+	if !strings.HasPrefix(rest, "//") && scheme != "sqlite" && scheme != "sqlite3" && scheme != "file" {
+		return "", "", false
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		return "postgres", raw, true
+	case "cockroach", "cockroachdb":
+		return "cockroach", "postgresql:" + rest, true
+	case "sqlite", "sqlite3":
+		return "sqlite", strings.TrimPrefix(rest, "//"), true
+	case "file":
+		return "sqlite", raw, true
+	case "mysql", "mariadb":
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return "", "", false
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "3306")
+		}
+		var user string
+		if u.User != nil {
+			user = u.User.Username()
+			if password, set := u.User.Password(); set {
+				user += ":" + password
+			}
+			user += "@"
+		}
+		dsn = fmt.Sprintf("%stcp(%s)/%s", user, host, strings.TrimPrefix(u.Path, "/"))
+		if u.RawQuery != "" {
+			dsn += "?" + u.RawQuery
+		}
+		return "mysql", dsn, true
 	}
-	return fallback
+	return "", "", false
 }
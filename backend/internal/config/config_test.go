@@ -0,0 +1,375 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/storage"
+)
+
+func TestDatabaseFromURL(t *testing.T) {
+	tests := []struct {
+		url, driver, dsn string
+	}{
+		{"postgres://u:p@db:5432/notes?sslmode=disable", "postgres", "postgres://u:p@db:5432/notes?sslmode=disable"},
+		{"cockroach://root@crdb:26257/notes", "cockroach", "postgresql://root@crdb:26257/notes"},
+		{"sqlite:///var/lib/notes.db", "sqlite", "/var/lib/notes.db"},
+		{"sqlite:notes.db", "sqlite", "notes.db"},
+		{"file:notes.db?mode=rwc", "sqlite", "file:notes.db?mode=rwc"},
+		{"mysql://app:s3cret@db/notes?tls=true", "mysql", "app:s3cret@tcp(db:3306)/notes?tls=true"},
+		{"mysql://db:3307/notes", "mysql", "tcp(db:3307)/notes"},
+		{"./notes.db", "", ""},
+		{"user:pass@tcp(db:3306)/notes", "", ""},
+		{"postgres:pass@tcp(db:3306)/notes", "", ""},
+	}
+	for _, tt := range tests {
+		driver, dsn, ok := databaseFromURL(tt.url)
+		if ok != (tt.driver != "") || driver != tt.driver || dsn != tt.dsn {
+			t.Errorf("databaseFromURL(%q) = %q, %q, %t; want %q, %q", tt.url, driver, dsn, ok, tt.driver, tt.dsn)
+		}
+	}
+}
+
+func TestLoadPassword(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite:notes.db")
+	const hash = "$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		password, hash string
+		ok             bool
+	}{
+		{"secret", "", true},
+		{"", hash, true},
+		{"secret", hash, false},
+		{"", "", false},
+		{"", "secret", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("APP_PASSWORD", tt.password)
+		t.Setenv("APP_PASSWORD_HASH", tt.hash)
+		cfg, err := Load()
+		if (err == nil) != tt.ok {
+			t.Errorf("Load with APP_PASSWORD=%q APP_PASSWORD_HASH=%q: err = %v", tt.password, tt.hash, err)
+		}
+		if err == nil && cfg.AppPasswordHash != tt.hash {
+			t.Errorf("AppPasswordHash = %q, want %q", cfg.AppPasswordHash, tt.hash)
+		}
+	}
+}
+
+func TestLoadTracing(t *testing.T) {
+	tests := []struct {
+		endpoint, traces, protocol, headers string
+		want                                string
+		ok                                  bool
+	}{
+		{"", "", "", "", "", true},
+		{"http://collector:4318/", "", "", "", "http://collector:4318/v1/traces", true},
+		{"http://collector:4318", "https://tempo/otlp/v1/traces", "http/json", "", "https://tempo/otlp/v1/traces", true},
+		{"http://collector:4318", "", "grpc", "", "", false},
+		{"collector:4317", "", "", "", "", false},
+		{"http://collector:4318", "", "", "api-key=a%20b,x-team=notes", "http://collector:4318/v1/traces", true},
+		{"http://collector:4318", "", "", "api-key", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.traces)
+		t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+		t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", tt.headers)
+		var cfg Config
+		err := loadTracing(&environment{read: map[string]bool{}}, &cfg)
+		if (err == nil) != tt.ok || (err == nil && cfg.OTLPEndpoint != tt.want) {
+			t.Errorf("loadTracing(%q, %q, %q, %q) = %q, %v", tt.endpoint, tt.traces, tt.protocol, tt.headers, cfg.OTLPEndpoint, err)
+		}
+		if tt.headers != "" && err == nil && cfg.OTLPHeaders["api-key"] != "a b" {
+			t.Errorf("OTLPHeaders = %v", cfg.OTLPHeaders)
+		}
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	tests := []struct {
+		cert, key, domains, redirect string
+		ok                           bool
+	}{
+		{"", "", "", "", true},
+		{"cert.pem", "key.pem", "", "80", true},
+		{"cert.pem", "", "", "", false},
+		{"", "", "notes.example.com, www.notes.example.com", "80", true},
+		{"", "", "*.example.com", "", false},
+		{"", "", "https://notes.example.com", "", false},
+		{"cert.pem", "key.pem", "notes.example.com", "", false},
+		{"", "", "", "80", false},
+		{"cert.pem", "key.pem", "", "8080", false},
+		{"cert.pem", "key.pem", "", "http", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("TLS_CERT_FILE", tt.cert)
+		t.Setenv("TLS_KEY_FILE", tt.key)
+		t.Setenv("TLS_AUTOCERT_DOMAINS", tt.domains)
+		t.Setenv("HTTP_REDIRECT_PORT", tt.redirect)
+		cfg := Config{Port: "8080"}
+		problems := loadTLS(&environment{read: map[string]bool{}}, &cfg)
+		if (len(problems) == 0) != tt.ok {
+			t.Errorf("loadTLS(%q, %q, %q, %q) = %v", tt.cert, tt.key, tt.domains, tt.redirect, problems)
+		}
+	}
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "Notes.Example.com, www.notes.example.com")
+	var cfg Config
+	loadTLS(&environment{read: map[string]bool{}}, &cfg)
+	if strings.Join(cfg.TLSAutocertDomains, ",") != "notes.example.com,www.notes.example.com" {
+		t.Errorf("TLSAutocertDomains = %v", cfg.TLSAutocertDomains)
+	}
+}
+
+func TestLoadListen(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite:notes.db")
+	t.Setenv("APP_PASSWORD", "secret")
+	tests := []struct {
+		listen, mode string
+		socket       string
+		perm         os.FileMode
+		ok           bool
+	}{
+		{"", "", "", 0o660, true},
+		{"unix:/run/notes.sock", "", "/run/notes.sock", 0o660, true},
+		{"unix:/run/notes.sock", "0666", "/run/notes.sock", 0o666, true},
+		{"unix:", "", "", 0, false},
+		{"127.0.0.1:8080", "", "", 0, false},
+		{"unix:/run/notes.sock", "0999", "", 0, false},
+		{"unix:/run/notes.sock", "1777", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTEN", tt.listen)
+		t.Setenv("LISTEN_SOCKET_MODE", tt.mode)
+		cfg, err := Load()
+		if (err == nil) != tt.ok || (err == nil && (cfg.ListenSocket != tt.socket || cfg.SocketMode != tt.perm)) {
+			t.Errorf("Load with LISTEN=%q LISTEN_SOCKET_MODE=%q = %q, %v, %v", tt.listen, tt.mode, cfg.ListenSocket, cfg.SocketMode, err)
+		}
+	}
+}
+
+func TestLoadSearch(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite:notes.db")
+	t.Setenv("APP_PASSWORD", "secret")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	tests := []struct {
+		backend, url, encryptionKey string
+		ok                          bool
+	}{
+		{"", "", "", true},
+		{"Embedded", "", key, true},
+		{"meilisearch", "http://meilisearch:7700", "", true},
+		{"meilisearch", "", "", false},
+		{"meilisearch", "meilisearch:7700", "", false},
+		{"meilisearch", "http://meilisearch:7700", key, false},
+		{"bleve", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("SEARCH_BACKEND", tt.backend)
+		t.Setenv("MEILISEARCH_URL", tt.url)
+		t.Setenv("ENCRYPTION_KEY", tt.encryptionKey)
+		cfg, err := Load()
+		if (err == nil) != tt.ok {
+			t.Errorf("Load with SEARCH_BACKEND=%q MEILISEARCH_URL=%q = %v", tt.backend, tt.url, err)
+		}
+		if err == nil && (cfg.SearchBackend == "" || cfg.MeilisearchIndex != "notes") {
+			t.Errorf("SearchBackend, MeilisearchIndex = %q, %q", cfg.SearchBackend, cfg.MeilisearchIndex)
+		}
+	}
+}
+
+func TestLoadReplica(t *testing.T) {
+	t.Setenv("APP_PASSWORD", "secret")
+	tests := []struct {
+		primary, replica, want string
+		ok                     bool
+	}{
+		{"postgres://primary/notes", "", "", true},
+		{"postgres://primary/notes", "postgresql://replica/notes", "postgresql://replica/notes", true},
+		{"mysql://u:p@primary/notes", "mysql://u:p@replica/notes", "u:p@tcp(replica:3306)/notes", true},
+		{"postgres://primary/notes", "mysql://u:p@replica/notes", "", false},
+		{"sqlite:notes.db", "sqlite:copy.db", "", false},
+		{"sqlite:notes.db", "copy.db", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DATABASE_URL", tt.primary)
+		t.Setenv("DATABASE_URL_READONLY", tt.replica)
+		cfg, err := Load()
+		if (err == nil) != tt.ok || (err == nil && cfg.ReplicaURL != tt.want) {
+			t.Errorf("Load with DATABASE_URL_READONLY=%q = %q, %v", tt.replica, cfg.ReplicaURL, err)
+		}
+	}
+}
+
+func TestLoadPool(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://db/notes")
+	t.Setenv("APP_PASSWORD", "secret")
+	tests := []struct {
+		maxConns, minConns, lifetime string
+		ok                           bool
+	}{
+		{"", "", "", true},
+		{"20", "2", "1800", true},
+		{"", "8", "", true},
+		{"4", "8", "", false},
+		{"-1", "", "", false},
+		{"", "", "1h", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DB_MAX_CONNS", tt.maxConns)
+		t.Setenv("DB_MIN_CONNS", tt.minConns)
+		t.Setenv("DB_MAX_CONN_LIFETIME_SECONDS", tt.lifetime)
+		t.Setenv("DB_CONNECT_TIMEOUT_SECONDS", "5")
+		cfg, err := Load()
+		if (err == nil) != tt.ok {
+			t.Errorf("Load with DB_MAX_CONNS=%q DB_MIN_CONNS=%q DB_MAX_CONN_LIFETIME_SECONDS=%q = %v", tt.maxConns, tt.minConns, tt.lifetime, err)
+		}
+		if err == nil && cfg.DBConnectTimeout != 5*time.Second {
+			t.Errorf("DBConnectTimeout = %v", cfg.DBConnectTimeout)
+		}
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite:notes.db")
+	t.Setenv("APP_PASSWORD", "secret")
+	tests := []struct {
+		proxies string
+		want    string
+		ok      bool
+	}{
+		{"", "", true},
+		{"10.0.0.1", "10.0.0.1/32", true},
+		{"172.16.5.0/12, fd00::/8,::ffff:127.0.0.1", "172.16.0.0/12,fd00::/8,127.0.0.1/32", true},
+		{"10.0.0.0/33", "", false},
+		{"proxy.internal", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("TRUSTED_PROXIES", tt.proxies)
+		cfg, err := Load()
+		var got []string
+		for _, prefix := range cfg.TrustedProxies {
+			got = append(got, prefix.String())
+		}
+		if (err == nil) != tt.ok || (err == nil && strings.Join(got, ",") != tt.want) {
+			t.Errorf("Load with TRUSTED_PROXIES=%q = %v, %v", tt.proxies, got, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	for _, key := range []string{"DATABASE_URL", "APP_PASSWORD", "APP_PASSWORD_HASH", "PORT", "TELEGRAM_ALLOWED_USERS", "SESSION_TTL_HOURS", "S3_BUCKET"} {
+		t.Setenv(key, "")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+database:
+  url: sqlite:notes.db
+app_password: secret
+port: 9090
+session_ttl_hours: 24
+telegram_allowed_users: [1, 2]
+s3:
+  bucket: notes
+`,
+		"config.toml": `
+app_password = "secret" # a comment
+port = 9090
+session_ttl_hours = 24
+telegram_allowed_users = [1, 2]
+
+[database]
+url = 'sqlite:notes.db'
+
+[s3]
+bucket = "notes"
+`,
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFrom(path, nil)
+		if err != nil {
+			t.Fatalf("LoadFile(%s): %v", name, err)
+		}
+		if cfg.DatabaseDriver != "sqlite" || cfg.DatabaseURL != "notes.db" || cfg.Port != "9090" || cfg.SessionTTL != 24*time.Hour ||
+			len(cfg.TelegramAllowedUsers) != 2 || cfg.S3.Bucket != "notes" || cfg.AppPassword != "secret" {
+			t.Errorf("LoadFile(%s) = %+v", name, cfg)
+		}
+	}
+
+	t.Setenv("PORT", "7070")
+	cfg, err := LoadFrom(filepath.Join(dir, "config.yaml"), nil)
+	if err != nil || cfg.Port != "7070" {
+		t.Errorf("PORT did not override the file: %q, %v", cfg.Port, err)
+	}
+	cfg, err = LoadFrom(filepath.Join(dir, "config.yaml"), map[string]string{"port": "6060"})
+	if err != nil || cfg.Port != "6060" {
+		t.Errorf("the override did not win over PORT: %q, %v", cfg.Port, err)
+	}
+	if _, err := LoadFrom(filepath.Join(dir, "config.yaml"), map[string]string{"prot": "6060"}); err == nil || !strings.Contains(err.Error(), "did you mean port?") {
+		t.Errorf("misspelt override: err = %v", err)
+	}
+
+	path := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(path, []byte("database_url: sqlite:notes.db\nsesion_ttl_hours: 2\nmax_note_tags: -1\ncompression_level: 11\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadFrom(path, nil)
+	var problems Errors
+	if !errors.As(err, &problems) || len(problems) != 4 {
+		t.Fatalf("LoadFile(bad.yaml) = %v, want 4 problems", err)
+	}
+	for _, want := range []string{"APP_PASSWORD", "MAX_NOTE_TAGS", "COMPRESSION_LEVEL", "unknown setting sesion_ttl_hours (did you mean session_ttl_hours?)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var out bytes.Buffer
+	err := Print(&out, Config{
+		Port:              "8080",
+		AppPassword:       "hunter2",
+		DatabaseURL:       "postgres://notes:hunter2@db/notes",
+		RateLimitRedisURL: "redis://:hunter2@redis:6379",
+		MeilisearchAPIKey: "hunter2",
+		OTLPHeaders:       map[string]string{"api-key": "hunter2"},
+		S3:                storage.S3Config{SecretAccessKey: "hunter2"},
+		SessionTTL:        time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("Print leaked a secret:\n%s", out.String())
+	}
+	for _, want := range []string{"port ", "database_url ", "notes:xxxxx@db", "s3.secret_access_key ", "session_ttl ", "1h0m0s", "otlp_headers "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Print output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"postgres://u:pw@db/notes":            "postgres://u:xxxxx@db/notes",
+		"u:pw@tcp(db:3306)/notes":             "u:xxxxx@tcp(db:3306)/notes",
+		"host=db user=u password=pw dbname=n": "host=db user=u password=xxxxx dbname=n",
+		"notes.db":                            "notes.db",
+	} {
+		if got := redactURL(raw); got != want {
+			t.Errorf("redactURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors are all the problems Load found, reported together so that one
+// attempt shows everything there is to fix.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems:", len(e))
+	for _, err := range e {
+		b.WriteString("\n  - " + err.Error())
+	}
+	return b.String()
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// environment looks settings up in the overrides, the environment, then
+// the config file. It remembers the names it was asked for, which are all
+// the settings there are, to catch misspelt ones.
+type environment struct {
+	path      string
+	file      map[string]string
+	overrides map[string]string
+	read      map[string]bool
+}
+
+func newEnvironment(path string, overrides map[string]string) (*environment, error) {
+	env := &environment{path: path, overrides: map[string]string{}, read: map[string]bool{}}
+	for key, value := range overrides {
+		env.overrides[settingName(key)] = value
+	}
+	if path == "" {
+		return env, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &doc)
+	case ".toml":
+		doc, err = parseTOML(string(raw))
+	default:
+		return nil, fmt.Errorf("config file %s: expected a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	env.file = map[string]string{}
+	if err := flatten(env.file, "", doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return env, nil
+}
+
+// flatten names the settings of a file as the environment variables they
+// stand for: keys are upper-cased and nested ones joined with _, so that
+// database.url and database_url are both DATABASE_URL. Lists become the
+// comma-separated values the variables take.
+func flatten(into map[string]string, prefix string, doc map[string]any) error {
+	for key, value := range doc {
+		name := settingName(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := flatten(into, name, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		text, err := settingValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.ToLower(name), err)
+		}
+		if _, dup := into[name]; dup {
+			return fmt.Errorf("%s is set twice", strings.ToLower(name))
+		}
+		into[name] = text
+	}
+	return nil
+}
+
+// settingName turns a key of the file, or of overrides, into the name of
+// its environment variable.
+func settingName(key string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(strings.TrimSpace(key)))
+}
+
+func settingValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]any); ok {
+				return "", fmt.Errorf("lists cannot be nested")
+			}
+			if _, ok := item.(map[string]any); ok {
+				return "", fmt.Errorf("lists may only hold values")
+			}
+			part, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// get returns the setting called key: the override, the environment
+// variable if it is set, otherwise the file's value.
+func (e *environment) get(key string) string {
+	e.read[key] = true
+	if value, ok := e.overrides[key]; ok {
+		return value
+	}
+	if value := os.Getenv(key); strings.TrimSpace(value) != "" {
+		return value
+	}
+	return e.file[key]
+}
+
+// getOr is get with a default for unset settings.
+func (e *environment) getOr(key, fallback string) string {
+	if value := strings.TrimSpace(e.get(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// unknown reports the settings of the file and overrides that nothing
+// reads, suggesting the setting that was probably meant.
+func (e *environment) unknown() Errors {
+	known := make([]string, 0, len(e.read))
+	for key := range e.read {
+		known = append(known, key)
+	}
+	slices.Sort(known)
+	var problems Errors
+	for _, source := range []struct {
+		name     string
+		settings map[string]string
+	}{{"flags", e.overrides}, {e.path, e.file}} {
+		names := make([]string, 0, len(source.settings))
+		for key := range source.settings {
+			names = append(names, key)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if e.read[name] {
+				continue
+			}
+			err := fmt.Errorf("%s: unknown setting %s", source.name, strings.ToLower(name))
+			if guess := closest(name, known); guess != "" {
+				err = fmt.Errorf("%w (did you mean %s?)", err, strings.ToLower(guess))
+			}
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
+
+// closest returns the name in names nearest to name by edit distance, if
+// it is near enough to be a typo.
+func closest(name string, names []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range names {
+		if d := distance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+const redacted = "[redacted]"
+
+// secrets are the settings Print hides, by their printed names. Database
+// and Redis URLs are shown with only their passwords hidden.
+var secrets = []string{
+	"app_password",
+	"app_password_hash",
+	"feed_secret",
+	"email_ingest_secret",
+	"telegram_bot_token",
+	"encryption_keys",
+	"s3.secret_access_key",
+	"meilisearch_api_key",
+}
+
+// Print writes the settings of cfg, one per line, with secrets redacted.
+func Print(w io.Writer, cfg Config) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	printStruct(tw, "", reflect.ValueOf(cfg))
+	return tw.Flush()
+}
+
+func printStruct(w io.Writer, prefix string, v reflect.Value) {
+	for i := range v.NumField() {
+		name := prefix + snakeCase(v.Type().Field(i).Name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Time{}) {
+			printStruct(w, name+".", field)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, formatSetting(name, field))
+	}
+}
+
+func formatSetting(name string, v reflect.Value) string {
+	if slices.Contains(secrets, name) {
+		if v.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case fmt.Stringer:
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return ""
+		}
+		return value.String()
+	case string:
+		if strings.HasSuffix(name, "_url") {
+			return redactURL(value)
+		}
+		return value
+	case map[string]string:
+		// Headers carry API keys.
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key+"="+redacted)
+		}
+		slices.Sort(keys)
+		return strings.Join(keys, ",")
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+var dsnPassword = regexp.MustCompile(`(?i)(password=)(\S+)`)
+
+// redactURL hides the password of a database or Redis URL, be it a URL, a
+// user:password@tcp(host) MySQL DSN or a key=value Postgres one.
+func redactURL(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	if at := strings.LastIndex(raw, "@"); at >= 0 {
+		if user, _, ok := strings.Cut(raw[:at], ":"); ok && !strings.Contains(user, "/") {
+			return user + ":xxxxx" + raw[at:]
+		}
+	}
+	return dsnPassword.ReplaceAllString(raw, "${1}xxxxx")
+}
+
+// Diff returns the names, as Print shows them, of the settings that differ
+// between a and b.
+func Diff(a, b Config) []string {
+	var names []string
+	diffStruct(&names, "", reflect.ValueOf(a), reflect.ValueOf(b))
+	return names
+}
+
+func diffStruct(names *[]string, prefix string, a, b reflect.Value) {
+	for i := range a.NumField() {
+		name := prefix + snakeCase(a.Type().Field(i).Name)
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Struct && fa.Type() != reflect.TypeOf(time.Time{}) {
+			diffStruct(names, name+".", fa, fb)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			*names = append(*names, name)
+		}
+	}
+}
+
+// snakeCase turns a field name such as OTLPEndpoint into otlp_endpoint.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML reads the part of TOML a config file needs: [table] and
+// [dotted.table] headers, key = value pairs with bare, quoted or dotted
+// keys, and values that are strings, integers, floats, booleans or arrays
+// of them on one line. Comments start with #.
+func parseTOML(text string) (map[string]any, error) {
+	doc := map[string]any{}
+	table := doc
+	for n, line := range strings.Split(text, "\n") {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", n+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fail("arrays of tables are not supported")
+			}
+			name, ok := strings.CutSuffix(line[1:], "]")
+			if !ok {
+				return nil, fail("unterminated table header")
+			}
+			keys, err := splitKey(name)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			if table, err = subTable(doc, keys); err != nil {
+				return nil, fail("%v", err)
+			}
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fail("expected key = value")
+		}
+		keys, err := splitKey(key)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		value, rest, err := parseTOMLValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fail("unexpected %q after the value", rest)
+		}
+		parent, err := subTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		last := keys[len(keys)-1]
+		if _, dup := parent[last]; dup {
+			return nil, fail("%s is set twice", last)
+		}
+		parent[last] = value
+	}
+	return doc, nil
+}
+
+// stripComment drops a # comment, minding # inside strings.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func splitKey(key string) ([]string, error) {
+	var keys []string
+	for _, part := range strings.Split(key, ".") {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') && part[len(part)-1] == part[0] {
+			part = part[1 : len(part)-1]
+		}
+		if part == "" {
+			return nil, fmt.Errorf("empty key in %q", strings.TrimSpace(key))
+		}
+		keys = append(keys, part)
+	}
+	return keys, nil
+}
+
+func subTable(table map[string]any, keys []string) (map[string]any, error) {
+	for _, key := range keys {
+		switch next := table[key].(type) {
+		case nil:
+			child := map[string]any{}
+			table[key] = child
+			table = child
+		case map[string]any:
+			table = next
+		default:
+			return nil, fmt.Errorf("%s is a value, not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// parseTOMLValue reads the value at the start of s and returns what
+// follows it.
+func parseTOMLValue(s string) (any, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				value, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+				return value, s[i+1:], nil
+			}
+		}
+		return nil, "", fmt.Errorf("unterminated string")
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case s[0] == '[':
+		var items []any
+		rest := strings.TrimSpace(s[1:])
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return items, rest[1:], nil
+			}
+			item, after, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			rest = strings.TrimSpace(after)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+	}
+	end := strings.IndexAny(s, ",]")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := strings.TrimSpace(s[:end]), s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	clean := strings.ReplaceAll(word, "_", "")
+	if n, err := strconv.ParseInt(clean, 0, 64); err == nil {
+		return n, rest, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value %q (strings need quotes)", word)
+}
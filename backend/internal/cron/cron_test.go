@@ -0,0 +1,48 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2026, 10, 14, 13, 37, 20, 0, time.UTC) // a Wednesday
+	for spec, want := range map[string]string{
+		"@hourly":          "2026-10-14 14:00",
+		"@daily":           "2026-10-15 00:00",
+		"*/15 * * * *":     "2026-10-14 13:45",
+		"30 2 * * *":       "2026-10-15 02:30",
+		"0 9-17/4 * * 1-5": "2026-10-14 17:00",
+		"0 0 * * 0":        "2026-10-18 00:00",
+		"0 0 * * 7":        "2026-10-18 00:00",
+		"0 0 1,15 * *":     "2026-10-15 00:00",
+		"0 0 13 * 5":       "2026-10-16 00:00",
+		"0 0 29 2 *":       "2028-02-29 00:00",
+		"38 13 14 10 *":    "2026-10-14 13:38",
+		"37 13 14 10 *":    "2027-10-14 13:37",
+		"0 12 * jan,feb *": "",
+	} {
+		s, err := Parse(spec)
+		if want == "" {
+			if err == nil {
+				t.Errorf("Parse(%q) accepted", spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", spec, err)
+			continue
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != want {
+			t.Errorf("%q: next = %s, want %s", spec, got, want)
+		}
+	}
+	if s, _ := Parse("0 0 30 2 *"); !s.Next(from).IsZero() {
+		t.Error("February 30th came")
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted", spec)
+		}
+	}
+}
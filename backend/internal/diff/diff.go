@@ -0,0 +1,302 @@
+// Package diff compares texts line by line, as for showing what an edit to
+// a note changed. Lines are matched with Myers' algorithm in linear space,
+// so that as few lines as possible are marked removed and added.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of Line.
+const (
+	Equal  = "equal"
+	Delete = "delete"
+	Insert = "insert"
+)
+
+// maxCost bounds how many edits the search for a split looks through.
+// Past it, the lines left are taken as all removed and added, which is
+// still a correct edit if a longer one, so that texts with little in
+// common do not take time of the square of their length.
+const maxCost = 1000
+
+// Line is a line of either text, or of both when Kind is Equal.
+type Line struct {
+	Kind string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Hunk is a run of changes with the lines of context around them. Starts
+// count from 1; a range of no lines starts at the line it comes after.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Split returns the lines of text without their line breaks. A final line
+// break does not start another line.
+func Split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Lines returns the edit that turns a into b: every line of both, in
+// order, with those of only one marked Delete or Insert. Within a change,
+// removed lines come before added ones.
+func Lines(a, b string) []Line {
+	linesA, linesB := Split(a), Split(b)
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{a: intern(linesA), b: intern(linesB)}
+	d.removed = make([]bool, len(d.a))
+	d.added = make([]bool, len(d.b))
+	d.compare(0, len(d.a), 0, len(d.b))
+
+	out := make([]Line, 0, max(len(linesA), len(linesB)))
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && d.removed[i]:
+			out = append(out, Line{Delete, linesA[i]})
+			i++
+		case j < len(linesB) && d.added[j]:
+			out = append(out, Line{Insert, linesB[j]})
+			j++
+		default:
+			out = append(out, Line{Equal, linesA[i]})
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Count returns how many lines of an edit were removed and added.
+func Count(lines []Line) (removed, added int) {
+	for _, line := range lines {
+		switch line.Kind {
+		case Delete:
+			removed++
+		case Insert:
+			added++
+		}
+	}
+	return removed, added
+}
+
+// Hunks groups the changes of an edit, keeping up to context unchanged
+// lines around each. Changes with no more than twice that between them
+// share a hunk.
+func Hunks(lines []Line, context int) []Hunk {
+	// oldPos and newPos count the lines of either text before each line.
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	var changes []int
+	for i, line := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if line.Kind != Insert {
+			oldPos[i+1]++
+		}
+		if line.Kind != Delete {
+			newPos[i+1]++
+		}
+		if line.Kind != Equal {
+			changes = append(changes, i)
+		}
+	}
+
+	var hunks []Hunk
+	for first := 0; first < len(changes); {
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context+1 {
+			last++
+		}
+		from := max(changes[first]-context, 0)
+		to := min(changes[last]+context+1, len(lines))
+		h := Hunk{
+			OldStart: oldPos[from],
+			OldLines: oldPos[to] - oldPos[from],
+			NewStart: newPos[from],
+			NewLines: newPos[to] - newPos[from],
+			Lines:    lines[from:to],
+		}
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		hunks = append(hunks, h)
+		first = last + 1
+	}
+	return hunks
+}
+
+// Unified writes hunks in the unified format of diff -u, the texts named
+// from and to in its header. It is empty when the texts are the same.
+func Unified(from, to string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", unifiedRange(h.OldStart, h.OldLines), unifiedRange(h.NewStart, h.NewLines))
+		for _, line := range h.Lines {
+			switch line.Kind {
+			case Equal:
+				b.WriteByte(' ')
+			case Delete:
+				b.WriteByte('-')
+			case Insert:
+				b.WriteByte('+')
+			}
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func unifiedRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// differ marks the lines of a and b, interned to numbers, that are not
+// part of their longest common subsequence.
+type differ struct {
+	a, b           []int
+	removed, added []bool
+}
+
+// compare marks the changed lines of a[aLo:aHi] and b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.removed[i] = true
+		}
+	default:
+		x, y, ok := d.split(aLo, aHi, bLo, bHi)
+		if !ok {
+			for i := aLo; i < aHi; i++ {
+				d.removed[i] = true
+			}
+			for j := bLo; j < bHi; j++ {
+				d.added[j] = true
+			}
+			return
+		}
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// split finds where an edit of a[aLo:aHi] into b[bLo:bHi] with as few
+// changes as there can be crosses the middle, searching for it from both
+// ends at once. It gives up past maxCost.
+func (d *differ) split(aLo, aHi, bLo, bHi int) (x, y int, ok bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	// forward[offset+k] is how far along a the furthest path from the
+	// start on diagonal k, where x-y = k, gets; backward is the same from
+	// the end. -1 marks the diagonals not reached yet.
+	forward, backward := make([]int, size), make([]int, size)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// With an odd delta the paths meet going forward, otherwise backward.
+	odd := delta%2 != 0
+	// Diagonals that ran off the grid are skipped from then on.
+	var forwardStart, forwardEnd, backwardStart, backwardEnd int
+	for depth := range min(maxD, maxCost) {
+		for k := -depth + forwardStart; k <= depth-forwardEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -depth || k != depth && forward[i-1] < forward[i+1] {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[i] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				if j := offset + delta - k; j >= 0 && j < size && backward[j] != -1 && x >= n-backward[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+		for k := -depth + backwardStart; k <= depth-backwardEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -depth || k != depth && backward[i-1] < backward[i+1] {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[i] = x
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !odd:
+				if j := offset + delta - k; j >= 0 && j < size && forward[j] != -1 && forward[j] >= n-x {
+					fx := forward[j]
+					return aLo + fx, bLo + fx - (j - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
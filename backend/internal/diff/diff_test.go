@@ -0,0 +1,88 @@
+package diff
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 2000; i++ {
+		a, b := randomText(rng), randomText(rng)
+		lines := Lines(a, b)
+		var gotA, gotB []string
+		common := 0
+		for _, line := range lines {
+			if line.Kind != Insert {
+				gotA = append(gotA, line.Text)
+			}
+			if line.Kind != Delete {
+				gotB = append(gotB, line.Text)
+			}
+			if line.Kind == Equal {
+				common++
+			}
+		}
+		if strings.Join(gotA, "\n") != strings.Join(Split(a), "\n") || strings.Join(gotB, "\n") != strings.Join(Split(b), "\n") {
+			t.Fatalf("Lines(%q, %q) = %v does not turn one into the other", a, b, lines)
+		}
+		if want := lcs(Split(a), Split(b)); common != want {
+			t.Fatalf("Lines(%q, %q) keeps %d lines, want %d", a, b, common, want)
+		}
+	}
+}
+
+func randomText(rng *rand.Rand) string {
+	lines := make([]string, rng.IntN(12))
+	for i := range lines {
+		lines[i] = string(rune('a' + rng.IntN(4)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lcs(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	return table[0][0]
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven\n"
+	want := `--- a
++++ b
+@@ -2,3 +2,3 @@
+ 2
+-3
++three
+ 4
+@@ -10 +10,2 @@
+ 10
++eleven
+`
+	if got := Unified("a", "b", Hunks(Lines(a, b), 1)); got != want {
+		t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+	}
+	// With more context the changes share a hunk.
+	if hunks := Hunks(Lines(a, b), 4); len(hunks) != 1 || hunks[0].OldStart != 1 || hunks[0].OldLines != 10 || hunks[0].NewLines != 11 {
+		t.Errorf("Hunks with context 4 = %+v", hunks)
+	}
+	if got := Unified("a", "b", Hunks(Lines("", "new\n"), 3)); got != "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n" {
+		t.Errorf("Unified from empty = %q", got)
+	}
+	if got := Unified("a", "b", Hunks(Lines(a, a), 3)); got != "" {
+		t.Errorf("Unified of the same text = %q", got)
+	}
+}
@@ -0,0 +1,203 @@
+// Package dump reads and writes a JSON snapshot of every note and notebook.
+// The format is shared by the export, import and backup commands.
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Version is bumped whenever the snapshot layout changes incompatibly.
+const Version = 1
+
+const pageSize = 500
+
+// Store is what a snapshot is taken from and restored into.
+type Store interface {
+	store.NoteStore
+	store.NotebookStore
+	store.LinkStore
+}
+
+// File is a snapshot. Dumps taken before notebooks existed have none, which
+// is why the field is only an addition and not a new Version.
+type File struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Notebooks  []store.Notebook `json:"notebooks,omitempty"`
+	Notes      []store.Note     `json:"notes"`
+}
+
+// Write streams every note in st to w, one page at a time, after the
+// notebooks, and returns how many notes it wrote.
+func Write(ctx context.Context, st Store, w io.Writer, now time.Time) (int, error) {
+	header, err := json.Marshal(now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	notebooks, err := st.ListNotebooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	encodedNotebooks, err := json.Marshal(notebooks)
+	if err != nil {
+		return 0, fmt.Errorf("encode notebooks: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "{\"version\":%d,\"exported_at\":%s,\"notebooks\":%s,\"notes\":[", Version, header, encodedNotebooks); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for offset := 0; ; offset += pageSize {
+		items, _, err := st.ListNotes(ctx, store.NoteFilter{Limit: pageSize, Offset: offset})
+		if err != nil {
+			return written, err
+		}
+		for _, n := range items {
+			encoded, err := json.Marshal(n)
+			if err != nil {
+				return written, fmt.Errorf("encode note %s: %w", n.ID, err)
+			}
+			if written > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return written, err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "\n%s", encoded); err != nil {
+				return written, err
+			}
+			written++
+		}
+		if len(items) < pageSize {
+			break
+		}
+	}
+
+	_, err = io.WriteString(w, "\n]}\n")
+	return written, err
+}
+
+var (
+	// ErrVersion is returned by Read for snapshots of another Version.
+	ErrVersion = errors.New("unsupported dump version")
+	// ErrInvalid is returned by Prepare for snapshots that cannot be
+	// restored as they are.
+	ErrInvalid = errors.New("invalid dump")
+)
+
+func Read(r io.Reader) (File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return File{}, fmt.Errorf("decode dump: %w", err)
+	}
+	if f.Version != Version {
+		return File{}, fmt.Errorf("%w %d (expected %d)", ErrVersion, f.Version, Version)
+	}
+	return f, nil
+}
+
+// Plan is what restoring a snapshot would insert: the notebooks and notes
+// st does not have yet, notebooks parents first.
+type Plan struct {
+	Notebooks []store.Notebook
+	Notes     []store.Note
+	// Skipped counts the notes st already has, trashed or not.
+	Skipped int
+}
+
+// Prepare works out the Plan of restoring f into st without writing
+// anything. Notes keep their IDs and timestamps; those in a notebook that
+// neither st nor f has are restored outside any.
+func Prepare(ctx context.Context, st Store, f File) (Plan, error) {
+	var p Plan
+	known := make(map[uuid.UUID]bool)
+	existing, err := st.ListNotebooks(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+	for _, nb := range existing {
+		known[nb.ID] = true
+	}
+	pending := f.Notebooks
+	for len(pending) > 0 {
+		var later []store.Notebook
+		for _, nb := range pending {
+			switch {
+			case known[nb.ID]:
+			case nb.ParentID != nil && !known[*nb.ParentID]:
+				later = append(later, nb)
+			default:
+				p.Notebooks = append(p.Notebooks, nb)
+				known[nb.ID] = true
+			}
+		}
+		if len(later) == len(pending) {
+			return Plan{}, fmt.Errorf("%w: notebook %s has a parent that is not in it", ErrInvalid, later[0].ID)
+		}
+		pending = later
+	}
+
+	seen := make(map[uuid.UUID]bool, len(f.Notes))
+	for _, n := range f.Notes {
+		if seen[n.ID] {
+			return Plan{}, fmt.Errorf("%w: note %s is in it twice", ErrInvalid, n.ID)
+		}
+		seen[n.ID] = true
+		_, err := st.GetNote(ctx, n.ID)
+		if err == nil {
+			p.Skipped++
+			continue
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return Plan{}, err
+		}
+		if n.Tags == nil {
+			n.Tags = []string{}
+		}
+		if n.NotebookID != nil && !known[*n.NotebookID] {
+			n.NotebookID = nil
+		}
+		// Dumps from before notes were measured have no counts; those of
+		// locked notes are kept as they cannot be redone.
+		if !n.IsEncrypted {
+			n.SetStats(store.MeasureText(n.Content))
+		}
+		p.Notes = append(p.Notes, n)
+	}
+	return p, nil
+}
+
+// Apply inserts the plan in one transaction, then records the links of
+// the notes.
+func (p Plan) Apply(ctx context.Context, st Store) error {
+	if err := st.InsertSnapshot(ctx, p.Notebooks, p.Notes); err != nil {
+		return err
+	}
+	for _, n := range p.Notes {
+		if err := st.SetLinks(ctx, n.ID, store.LinkTargets(n.Content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore inserts every notebook and note of f that st does not already
+// have, all or none, and reports how many notes were created and skipped.
+func Restore(ctx context.Context, st Store, f File) (created, skipped int, err error) {
+	p, err := Prepare(ctx, st, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := p.Apply(ctx, st); err != nil {
+		return 0, p.Skipped, err
+	}
+	return len(p.Notes), p.Skipped, nil
+}
@@ -0,0 +1,190 @@
+package dump
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	src := memory.New()
+	// The child sorts first, so restoring has to reorder them.
+	parent, err := src.CreateNotebook(ctx, store.NotebookInput{Name: "b"}, now)
+	if err != nil {
+		t.Fatalf("create notebook: %v", err)
+	}
+	child, err := src.CreateNotebook(ctx, store.NotebookInput{Name: "a", ParentID: &parent.ID}, now)
+	if err != nil {
+		t.Fatalf("create notebook: %v", err)
+	}
+	for i := range pageSize + 3 {
+		input := store.NoteInput{Title: "n", Tags: []string{"t"}, NotebookID: &child.ID}
+		if _, err := src.CreateNote(ctx, input, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	written, err := Write(ctx, src, &buf, now)
+	if err != nil || written != pageSize+3 {
+		t.Fatalf("write: %d notes, err = %v", written, err)
+	}
+
+	file, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	dst := memory.New()
+	created, skipped, err := Restore(ctx, dst, file)
+	if err != nil || created != written || skipped != 0 {
+		t.Fatalf("restore: created %d, skipped %d, err = %v", created, skipped, err)
+	}
+	if _, skipped, _ := Restore(ctx, dst, file); skipped != written {
+		t.Fatalf("second restore skipped %d, want %d", skipped, written)
+	}
+
+	original := file.Notes[0]
+	restored, err := dst.GetNote(ctx, original.ID)
+	if err != nil || !restored.UpdatedAt.Equal(original.UpdatedAt) ||
+		restored.NotebookID == nil || *restored.NotebookID != child.ID {
+		t.Fatalf("restored note = %+v, err = %v", restored, err)
+	}
+	if nb, err := dst.GetNotebook(ctx, child.ID); err != nil || nb.ParentID == nil || *nb.ParentID != parent.ID {
+		t.Fatalf("restored notebook = %+v, err = %v", nb, err)
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	src := memory.New()
+	work, _ := src.CreateNotebook(ctx, store.NotebookInput{Name: "Work"}, now)
+	plans, _ := src.CreateNotebook(ctx, store.NotebookInput{Name: "Plans: 2025", ParentID: &work.ID}, now)
+	// Listings are newest first, so the first note keeps the plain name.
+	for i, input := range []store.NoteInput{
+		{Title: "Q3 / Q4", Content: "# Goals\n", Tags: []string{"okr"}, IsFavorite: true, NotebookID: &plans.ID},
+		{Title: "q3 - q4", Content: "second", NotebookID: &plans.ID},
+		{Title: " ", Content: "no title"},
+	} {
+		if _, err := src.CreateNote(ctx, input, now.Add(-time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	written, err := WriteZip(ctx, src, &buf, now)
+	if err != nil || written != 3 {
+		t.Fatalf("write zip: %d notes, err = %v", written, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{ManifestName, "Work/Plans- 2025/Q3 - Q4.md", "Work/Plans- 2025/q3 - q4 (2).md", "Untitled.md"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("archive has no %s, files = %v", name, slices.Collect(maps.Keys(files)))
+		}
+	}
+	md := files["Work/Plans- 2025/Q3 - Q4.md"]
+	for _, line := range []string{"---\n", `title: "Q3 / Q4"`, `tags: ["okr"]`, "favorite: true", `created: "2025-05-01T10:00:00Z"`, "---\n\n# Goals\n"} {
+		if !strings.Contains(md, line) {
+			t.Fatalf("markdown lacks %q:\n%s", line, md)
+		}
+	}
+	if file, err := Read(strings.NewReader(files[ManifestName])); err != nil || len(file.Notes) != 3 || len(file.Notebooks) != 2 {
+		t.Fatalf("manifest = %+v, err = %v", file, err)
+	}
+
+	if entries, err := ReadArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 1<<20); err != nil || len(entries) != 3 || entries[0].Source != "notes.json[0]" {
+		t.Fatalf("read archive = %+v, err = %v", entries, err)
+	}
+	if _, err := ReadArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 100); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("read archive past the limit: err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, source, data string
+		want               store.Note
+	}{
+		{
+			name:   "front matter as WriteZip writes it",
+			source: "Work/x.md",
+			data:   "---\nid: \"ignored\"\ntitle: \"Q3 \\\"plan\\\"\"\ntags: [\"okr\", \"work\"]\nfavorite: true\narchived: true\nlanguage: \"ru\"\ncreated: \"2024-03-01T00:00:00Z\"\nupdated: \"2024-03-02T10:00:00Z\"\n---\n\n# Goals\n",
+			want:   store.Note{Title: `Q3 "plan"`, Content: "# Goals\n", Tags: []string{"okr", "work"}, IsFavorite: true, IsArchived: true, Language: "ru", CreatedAt: day, UpdatedAt: day.Add(34 * time.Hour)},
+		},
+		{
+			name:   "other apps' front matter",
+			source: "a.md",
+			data:   "\ufeff---\r\ntitle: 'It''s here' # comment\r\ntags:\r\n  - one\r\n  - two\r\nfavorite: yes\r\ndate: 2024-03-01\r\nauthor: me\r\n---\r\nbody\r\n",
+			want:   store.Note{Title: "It's here", Content: "body\n", Tags: []string{"one", "two"}, IsFavorite: true, CreatedAt: day},
+		},
+		{
+			name:   "encrypted notes",
+			source: "Bank.md",
+			data:   "---\nencrypted: true\n---\n\nlock:v1:x\n",
+			want:   store.Note{Title: "Bank", Content: "lock:v1:x\n", IsEncrypted: true},
+		},
+		{
+			name:   "comma-separated tags",
+			source: "Notes/Ideas.markdown",
+			data:   "---\ntags: a, b\n---\n",
+			want:   store.Note{Title: "Ideas", Tags: []string{"a", "b"}},
+		},
+		{
+			name: "title from the first heading",
+			data: "\n# Heading \ntext\n",
+			want: store.Note{Title: "Heading", Content: "\n# Heading \ntext\n"},
+		},
+		{
+			name:   "unterminated front matter is content",
+			source: "b.txt",
+			data:   "---\ntitle: x\n",
+			want:   store.Note{Title: "b", Content: "---\ntitle: x\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMarkdown(tt.source, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got.Title != tt.want.Title || got.Content != tt.want.Content || !slices.Equal(got.Tags, tt.want.Tags) ||
+				got.IsFavorite != tt.want.IsFavorite || got.IsArchived != tt.want.IsArchived || got.IsEncrypted != tt.want.IsEncrypted || got.Language != tt.want.Language ||
+				!got.CreatedAt.Equal(tt.want.CreatedAt) || !got.UpdatedAt.Equal(tt.want.UpdatedAt) {
+				t.Fatalf("parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, data := range []string{"\xff", "---\nfavorite: maybe\n---\n", "---\ncreated: tomorrow\n---\n", "---\ntags: [a\n---\n", "---\njust text\n---\n"} {
+		if _, err := ParseMarkdown("x.md", []byte(data)); err == nil {
+			t.Errorf("parse %q: no error", data)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package dump
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"notes-backend/internal/store"
+)
+
+// Entry is a note read for an import, with Source naming where in the
+// upload it came from.
+type Entry struct {
+	Source string
+	Note   store.Note
+}
+
+// frontMatterTimes are the layouts accepted for created and updated, from
+// what WriteZip writes to what other note apps do.
+var frontMatterTimes = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseMarkdown reads a Markdown note with optional YAML front matter. Only
+// the keys WriteZip writes are read, and only the simple YAML forms of
+// them; id is ignored. Without a title the note takes the file name of
+// source, or else its first heading.
+func ParseMarkdown(source string, data []byte) (store.Note, error) {
+	if !utf8.Valid(data) {
+		return store.Note{}, errors.New("not valid UTF-8")
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var n store.Note
+	if meta, body, ok := cutFrontMatter(text); ok {
+		if err := parseFrontMatter(meta, &n); err != nil {
+			return store.Note{}, err
+		}
+		text = strings.TrimPrefix(body, "\n")
+	}
+	n.Content = text
+
+	if strings.TrimSpace(n.Title) == "" && source != "" {
+		base := path.Base(source)
+		n.Title = strings.TrimSuffix(base, path.Ext(base))
+	}
+	if strings.TrimSpace(n.Title) == "" {
+		for _, line := range strings.Split(text, "\n") {
+			if heading, ok := strings.CutPrefix(line, "# "); ok {
+				n.Title = strings.TrimSpace(heading)
+				break
+			}
+			if strings.TrimSpace(line) != "" {
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// cutFrontMatter splits text into the front matter between --- lines and
+// the rest, if it starts with any.
+func cutFrontMatter(text string) (meta, body string, ok bool) {
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return "", text, false
+	}
+	for offset := 0; offset <= len(rest); {
+		end := strings.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end]
+		}
+		if line == "---" || line == "..." {
+			if end < 0 {
+				return rest[:offset], "", true
+			}
+			return rest[:offset], rest[offset+end+1:], true
+		}
+		if end < 0 {
+			break
+		}
+		offset += end + 1
+	}
+	return "", text, false
+}
+
+func parseFrontMatter(meta string, n *store.Note) error {
+	lines := strings.Split(meta, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") || line[0] == ' ' || line[0] == '-' {
+			continue
+		}
+		key, raw, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("front matter line %q is not key: value", line)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+
+		// A list in block style follows on the lines starting with "- ".
+		var items []string
+		if raw == "" {
+			for i+1 < len(lines) {
+				item, ok := strings.CutPrefix(strings.TrimLeft(lines[i+1], " "), "- ")
+				if !ok {
+					break
+				}
+				items = append(items, item)
+				i++
+			}
+		}
+
+		var err error
+		switch key {
+		case "title":
+			n.Title, err = scalar(raw)
+		case "tags":
+			n.Tags, err = list(raw, items)
+		case "favorite":
+			n.IsFavorite, err = boolean(raw)
+		case "archived":
+			n.IsArchived, err = boolean(raw)
+		case "encrypted":
+			n.IsEncrypted, err = boolean(raw)
+		case "language":
+			n.Language, err = scalar(raw)
+		case "created", "date":
+			n.CreatedAt, err = timestamp(raw)
+		case "updated", "modified":
+			n.UpdatedAt, err = timestamp(raw)
+		}
+		if err != nil {
+			return fmt.Errorf("front matter %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// scalar reads a plain, single-quoted or double-quoted YAML string.
+func scalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		var s string
+		dec := json.NewDecoder(strings.NewReader(raw))
+		if err := dec.Decode(&s); err != nil || !comment(raw[dec.InputOffset():]) {
+			return "", fmt.Errorf("bad quoted string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "'"):
+		for i := 1; i < len(raw); i++ {
+			if raw[i] != '\'' {
+				continue
+			}
+			if i+1 < len(raw) && raw[i+1] == '\'' {
+				i++
+				continue
+			}
+			if !comment(raw[i+1:]) {
+				break
+			}
+			return strings.ReplaceAll(raw[1:i], "''", "'"), nil
+		}
+		return "", fmt.Errorf("bad quoted string %s", raw)
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+// comment reports whether rest, what follows a quoted scalar, is nothing
+// but a comment.
+func comment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// list reads a flow list like [a, "b"], block list items or a single
+// comma-separated string.
+func list(raw string, items []string) ([]string, error) {
+	if flow, ok := strings.CutPrefix(raw, "["); ok {
+		flow, ok = strings.CutSuffix(flow, "]")
+		if !ok {
+			return nil, fmt.Errorf("unterminated list %s", raw)
+		}
+		var quoted []string
+		if json.Unmarshal([]byte(raw), &quoted) == nil {
+			return quoted, nil
+		}
+		items = strings.Split(flow, ",")
+	} else if raw != "" {
+		items = strings.Split(raw, ",")
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		value, err := scalar(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}
+
+func boolean(raw string) (bool, error) {
+	value, err := scalar(raw)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off", "":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%q is not true or false", value)
+	}
+	return b, nil
+}
+
+func timestamp(raw string) (time.Time, error) {
+	value, err := scalar(raw)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	for _, layout := range frontMatterTimes {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date", value)
+}
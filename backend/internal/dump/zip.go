@@ -0,0 +1,306 @@
+package dump
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// ManifestName is the snapshot inside an archive, in the format Write
+// produces.
+const ManifestName = "notes.json"
+
+// maxFileName bounds the runes of a title or notebook name used in a path.
+const maxFileName = 100
+
+// WriteZip streams an archive to w: the snapshot as ManifestName, then every
+// note as a Markdown file with YAML front matter, in folders named after its
+// notebooks. It returns how many notes the Markdown files hold.
+func WriteZip(ctx context.Context, st Store, w io.Writer, now time.Time) (int, error) {
+	zw := zip.NewWriter(w)
+	modified := now.UTC()
+
+	manifest, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestName, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := Write(ctx, st, manifest, now); err != nil {
+		return 0, err
+	}
+
+	notebooks, err := st.ListNotebooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	folders := notebookFolders(notebooks)
+	used := make(map[string]bool)
+
+	written := 0
+	for offset := 0; ; offset += pageSize {
+		items, _, err := st.ListNotes(ctx, store.NoteFilter{Limit: pageSize, Offset: offset})
+		if err != nil {
+			return written, err
+		}
+		for _, n := range items {
+			dir := ""
+			if n.NotebookID != nil {
+				dir = folders[*n.NotebookID]
+			}
+			f, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     uniqueName(used, dir, fileName(n.Title, "Untitled")),
+				Method:   zip.Deflate,
+				Modified: n.UpdatedAt.UTC(),
+			})
+			if err != nil {
+				return written, err
+			}
+			if err := writeMarkdown(f, n); err != nil {
+				return written, fmt.Errorf("write note %s: %w", n.ID, err)
+			}
+			written++
+		}
+		if len(items) < pageSize {
+			break
+		}
+	}
+	return written, zw.Close()
+}
+
+// writeMarkdown writes a note as front matter followed by its content.
+// Strings are written JSON-quoted, which YAML reads as double-quoted
+// scalars.
+func writeMarkdown(w io.Writer, n store.Note) error {
+	tags := n.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	type field struct {
+		key   string
+		value any
+	}
+	fields := []field{
+		{"id", n.ID},
+		{"title", n.Title},
+		{"tags", tags},
+		{"favorite", n.IsFavorite},
+		{"archived", n.IsArchived},
+		{"language", n.Language},
+		{"created", n.CreatedAt.UTC()},
+		{"updated", n.UpdatedAt.UTC()},
+	}
+	// Only encrypted notes say so, which keeps other files as they were.
+	if n.IsEncrypted {
+		fields = append(fields, field{"encrypted", true})
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range fields {
+		encoded, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s: %s\n", field.key, encoded)
+	}
+	b.WriteString("---\n\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, n.Content); err != nil {
+		return err
+	}
+	if n.Content != "" && !strings.HasSuffix(n.Content, "\n") {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return nil
+}
+
+// notebookFolders maps each notebook to its path of folder names from the
+// top level down.
+func notebookFolders(notebooks []store.Notebook) map[uuid.UUID]string {
+	byID := make(map[uuid.UUID]store.Notebook, len(notebooks))
+	for _, nb := range notebooks {
+		byID[nb.ID] = nb
+	}
+	folders := make(map[uuid.UUID]string, len(notebooks))
+	var folder func(id uuid.UUID, depth int) string
+	folder = func(id uuid.UUID, depth int) string {
+		if dir, ok := folders[id]; ok {
+			return dir
+		}
+		nb := byID[id]
+		dir := fileName(nb.Name, "Notebook")
+		if nb.ParentID != nil && depth < len(notebooks) {
+			if _, ok := byID[*nb.ParentID]; ok {
+				dir = path.Join(folder(*nb.ParentID, depth+1), dir)
+			}
+		}
+		folders[id] = dir
+		return dir
+	}
+	for _, nb := range notebooks {
+		folder(nb.ID, 0)
+	}
+	return folders
+}
+
+// uniqueName returns dir/base.md, numbering it when an earlier note already
+// took that name. Names are compared ignoring case, for case-insensitive
+// file systems.
+func uniqueName(used map[string]bool, dir, base string) string {
+	name := path.Join(dir, base+".md")
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = path.Join(dir, fmt.Sprintf("%s (%d).md", base, i))
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// fileName makes s safe as a file or folder name on common file systems,
+// or returns fallback when nothing is left of it.
+func fileName(s, fallback string) string {
+	var b strings.Builder
+	runes := 0
+	for _, r := range s {
+		if runes == maxFileName {
+			break
+		}
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			r = '-'
+		}
+		b.WriteRune(r)
+		runes++
+	}
+	name := strings.Trim(b.String(), " .")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// ErrTooLarge is returned by ReadArchive when the files would unpack to
+// more than the limit.
+var ErrTooLarge = errors.New("archive is too large")
+
+// ReadArchive reads the notes of a ZIP: those of its ManifestName when it
+// has one, as archives from WriteZip do, and otherwise one per Markdown or
+// text file. Unpacking stops with ErrTooLarge past limit bytes.
+func ReadArchive(r io.ReaderAt, size, limit int64) ([]Entry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("read zip: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name == ManifestName {
+			file, err := readManifest(f, &limit)
+			if err != nil {
+				return nil, err
+			}
+			return FileEntries(file), nil
+		}
+	}
+
+	var entries []Entry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || hidden(f.Name) {
+			continue
+		}
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".md", ".markdown", ".txt":
+		default:
+			continue
+		}
+		data, err := unpack(f, &limit)
+		if err != nil {
+			return nil, err
+		}
+		n, err := ParseMarkdown(f.Name, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if n.UpdatedAt.IsZero() {
+			n.UpdatedAt = f.Modified.UTC()
+		}
+		entries = append(entries, Entry{Source: f.Name, Note: n})
+	}
+	return entries, nil
+}
+
+// ReadManifest reads the snapshot of an archive from WriteZip, which
+// unlike its Markdown files keeps IDs and notebooks. Unpacking stops with
+// ErrTooLarge past limit bytes.
+func ReadManifest(r io.ReaderAt, size, limit int64) (File, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return File{}, fmt.Errorf("read zip: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name == ManifestName {
+			return readManifest(f, &limit)
+		}
+	}
+	return File{}, fmt.Errorf("archive has no %s", ManifestName)
+}
+
+func readManifest(f *zip.File, limit *int64) (File, error) {
+	data, err := unpack(f, limit)
+	if err != nil {
+		return File{}, err
+	}
+	file, err := Read(bytes.NewReader(data))
+	if err != nil {
+		return File{}, fmt.Errorf("%s: %w", ManifestName, err)
+	}
+	return file, nil
+}
+
+// FileEntries lists the notes of a snapshot as import entries, naming each
+// by its place in the file.
+func FileEntries(file File) []Entry {
+	entries := make([]Entry, len(file.Notes))
+	for i, n := range file.Notes {
+		entries[i] = Entry{Source: fmt.Sprintf("%s[%d]", ManifestName, i), Note: n}
+	}
+	return entries
+}
+
+// unpack reads f, taking its size off the remaining limit.
+func unpack(f *zip.File, limit *int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, *limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if *limit -= int64(len(data)); *limit < 0 {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// hidden reports whether name is in or is a dot file or folder, such as the
+// __MACOSX and .DS_Store litter of archives made on a Mac.
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"notes-backend/internal/storage"
+)
+
+// BlobStore seals attachment bytes the same way Store seals note content.
+// Sealing needs the whole blob in memory, which the upload size limit keeps
+// bounded.
+type BlobStore struct {
+	storage.BlobStore
+	keys *Keyring
+}
+
+var _ storage.BlobStore = (*BlobStore)(nil)
+
+func NewBlobStore(inner storage.BlobStore, keys *Keyring) *BlobStore {
+	return &BlobStore{BlobStore: inner, keys: keys}
+}
+
+func (b *BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	plaintext, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return fmt.Errorf("put blob: %w", err)
+	}
+	sealed, err := b.keys.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	return b.BlobStore.Put(ctx, key, bytes.NewBufferString(sealed), int64(len(sealed)))
+}
+
+// Get opens a sealed blob; blobs uploaded before encryption was enabled are
+// returned as they are.
+func (b *BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	raw, err := b.read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !Sealed(string(raw)) {
+		return io.NopCloser(bytes.NewReader(raw)), nil
+	}
+	plaintext, err := b.keys.open(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", key, err)
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+// rewrap re-wraps the blob under key for the current master key and
+// reports whether it had to be rewritten.
+func (b *BlobStore) rewrap(ctx context.Context, key string) (bool, error) {
+	raw, err := b.read(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	rewrapped, changed, err := b.keys.Rewrap(string(raw))
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, b.BlobStore.Put(ctx, key, bytes.NewBufferString(rewrapped), int64(len(rewrapped)))
+}
+
+func (b *BlobStore) read(ctx context.Context, key string) ([]byte, error) {
+	r, err := b.BlobStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("get blob: %w", err)
+	}
+	return raw, nil
+}
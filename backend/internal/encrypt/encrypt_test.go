@@ -0,0 +1,174 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+
+	"github.com/google/uuid"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func TestSealOpen(t *testing.T) {
+	keys, err := NewKeyring(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := keys.Seal("буря мглою")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(sealed) || strings.Contains(sealed, "буря") {
+		t.Fatalf("sealed value %q", sealed)
+	}
+	if got, err := keys.Open(sealed); err != nil || got != "буря мглою" {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+	if got, _ := keys.Open("legacy"); got != "legacy" {
+		t.Fatalf("plain value opened as %q", got)
+	}
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := keys.Open(tampered); err == nil {
+		t.Fatal("tampered value opened")
+	}
+
+	other, _ := NewKeyring(testKey(2))
+	if _, err := other.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Open with other key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	locked, err := Lock("pin 1234", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Locked(locked) || Sealed(locked) || strings.Contains(locked, "1234") {
+		t.Fatalf("locked value %q", locked)
+	}
+	if got, err := Unlock(locked+"\n", "correct horse"); err != nil || got != "pin 1234" {
+		t.Fatalf("Unlock = %q, %v", got, err)
+	}
+	if _, err := Unlock(locked, "wrong horse"); !errors.Is(err, ErrPassphrase) {
+		t.Fatalf("Unlock with the wrong passphrase: %v", err)
+	}
+	if _, err := Unlock(strings.Replace(locked, "t=3", "t=99", 1), "correct horse"); err == nil || errors.Is(err, ErrPassphrase) {
+		t.Fatalf("Unlock with unbounded parameters: %v", err)
+	}
+}
+
+func TestStoreRotate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	inner := memory.New()
+
+	legacy, err := inner.CreateNote(ctx, store.NoteInput{Title: "legacy", Content: "written before encryption"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeys, _ := NewKeyring(testKey(1))
+	st := NewStore(inner, oldKeys)
+	n, err := st.CreateNote(ctx, store.NoteInput{Title: "groceries", Content: "milk and eggs"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddRevision(ctx, n, 10); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := inner.GetNote(ctx, n.ID)
+	if !Sealed(raw.Content) {
+		t.Fatalf("content stored as %q", raw.Content)
+	}
+	if items, _, _ := st.ListNotes(ctx, store.NoteFilter{Query: "grocer", Limit: 10}); len(items) != 1 || items[0].Content != "milk and eggs" {
+		t.Fatalf("title search = %+v", items)
+	}
+
+	newKeys, _ := NewKeyring(testKey(2), testKey(1))
+	st = NewStore(inner, newKeys)
+	rotated, err := st.Rotate(ctx)
+	if err != nil || rotated != 2 {
+		t.Fatalf("Rotate = %d, %v; want 2", rotated, err)
+	}
+	if rotated, _ := st.Rotate(ctx); rotated != 0 {
+		t.Fatalf("second Rotate rewrote %d notes", rotated)
+	}
+
+	onlyNew, _ := NewKeyring(testKey(2))
+	st = NewStore(inner, onlyNew)
+	if rev, err := st.GetRevision(ctx, n.ID, 1); err != nil || rev.Content != "milk and eggs" {
+		t.Fatalf("revision after rotation = %q, %v", rev.Content, err)
+	}
+	for id, want := range map[uuid.UUID]string{n.ID: "milk and eggs", legacy.ID: "written before encryption"} {
+		got, err := st.GetNote(ctx, id)
+		if err != nil || got.Content != want {
+			t.Fatalf("note %s after rotation = %q, %v", id, got.Content, err)
+		}
+		if !got.UpdatedAt.Equal(now) {
+			t.Fatalf("rotation moved updated_at to %s", got.UpdatedAt)
+		}
+		// Counts are of the plain text, sealed or not.
+		if got.WordCount != 3 || got.CharCount != len(want) {
+			t.Fatalf("note %s counted %d words, %d chars", id, got.WordCount, got.CharCount)
+		}
+	}
+}
+
+func TestBlobStoreRotate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	local, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := memory.New()
+	n, _ := inner.CreateNote(ctx, store.NoteInput{Title: "scans"}, now)
+	a := store.Attachment{ID: uuid.New(), NoteID: n.ID, Filename: "passport.jpg", Size: 8, CreatedAt: now}
+	if err := inner.CreateAttachment(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeys, _ := NewKeyring(testKey(1))
+	if err := NewBlobStore(local, oldKeys).Put(ctx, a.ID.String(), strings.NewReader("JPEGDATA"), 8); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, a.ID.String()))
+	if !Sealed(string(raw)) {
+		t.Fatalf("blob stored as %q", raw)
+	}
+
+	newKeys, _ := NewKeyring(testKey(2), testKey(1))
+	if err := inner.DeleteNote(ctx, n.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewStore(inner, newKeys).RotateAttachments(ctx, NewBlobStore(local, newKeys))
+	if err != nil || rotated != 1 {
+		t.Fatalf("RotateAttachments = %d, %v; want 1", rotated, err)
+	}
+
+	onlyNew, _ := NewKeyring(testKey(2))
+	r, err := NewBlobStore(local, onlyNew).Get(ctx, a.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _ := io.ReadAll(r); string(got) != "JPEGDATA" {
+		t.Fatalf("blob after rotation = %q", got)
+	}
+}
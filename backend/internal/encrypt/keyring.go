@@ -0,0 +1,183 @@
+// Package encrypt implements application-level encryption of note content
+// with envelope keys: every value gets its own random data key, which is
+// stored next to the ciphertext wrapped under a master key. Rotating the
+// master key only re-wraps data keys. Lock and Unlock instead seal a single
+// note under a passphrase the server does not keep.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks sealed values: "enc:v1:<key id>:<base64 payload>". The
+// payload is the wrapping nonce, the wrapped data key, the content nonce and
+// the content ciphertext, in that order.
+const prefix = "enc:v1:"
+
+const (
+	keySize        = 32
+	nonceSize      = 12
+	wrappedKeySize = keySize + 16
+	headerSize     = nonceSize + wrappedKeySize + nonceSize
+)
+
+// ErrUnknownKey is returned for values sealed under a master key that the
+// keyring does not hold.
+var ErrUnknownKey = errors.New("value is encrypted under an unknown key")
+
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring that seals under current and opens values
+// sealed under current or any of old.
+func NewKeyring(current []byte, old ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD, 1+len(old))}
+	for i, key := range append([][]byte{current}, old...) {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		id := KeyID(key)
+		if i == 0 {
+			k.current = id
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// KeyID names a master key by the start of its SHA-256, so sealed values
+// record which key they need without revealing it.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Sealed reports whether value was produced by Seal.
+func Sealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	return k.seal([]byte(plaintext))
+}
+
+func (k *Keyring) seal(plaintext []byte) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("generate data key: %w", err)
+	}
+	content, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	payload := make([]byte, nonceSize, headerSize+len(plaintext)+content.Overhead())
+	if _, err := rand.Read(payload); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	payload = k.keys[k.current].Seal(payload, payload[:nonceSize], dataKey, nil)
+
+	contentNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(contentNonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	payload = append(payload, contentNonce...)
+	payload = content.Seal(payload, contentNonce, plaintext, nil)
+
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(payload), nil
+}
+
+// Open decrypts a sealed value. Values that were never sealed, such as
+// notes written before encryption was enabled, are returned unchanged.
+func (k *Keyring) Open(value string) (string, error) {
+	if !Sealed(value) {
+		return value, nil
+	}
+	plaintext, err := k.open(value)
+	return string(plaintext), err
+}
+
+func (k *Keyring) open(value string) ([]byte, error) {
+	_, payload, dataKey, err := k.unwrap(value)
+	if err != nil {
+		return nil, err
+	}
+	content, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := content.Open(nil, payload[headerSize-nonceSize:headerSize], payload[headerSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt content: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap returns value with its data key wrapped under the current master
+// key, sealing plain values outright. The content ciphertext is reused, so
+// rotation costs the same for every note regardless of size. changed is
+// false when value already uses the current key.
+func (k *Keyring) Rewrap(value string) (rewrapped string, changed bool, err error) {
+	if !Sealed(value) {
+		sealed, err := k.Seal(value)
+		return sealed, true, err
+	}
+	id, payload, dataKey, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if id == k.current {
+		return value, false, nil
+	}
+
+	out := make([]byte, nonceSize, len(payload))
+	if _, err := rand.Read(out); err != nil {
+		return "", false, fmt.Errorf("generate nonce: %w", err)
+	}
+	out = k.keys[k.current].Seal(out, out[:nonceSize], dataKey, nil)
+	out = append(out, payload[nonceSize+wrappedKeySize:]...)
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(out), true, nil
+}
+
+// unwrap parses a sealed value and recovers its data key.
+func (k *Keyring) unwrap(value string) (id string, payload, dataKey []byte, err error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	master, ok := k.keys[id]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+	payload, err = base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(payload) < headerSize {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	dataKey, err = master.Open(nil, payload[:nonceSize], payload[nonceSize:nonceSize+wrappedKeySize], nil)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return id, payload, dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption keys must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
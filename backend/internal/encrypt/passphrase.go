@@ -0,0 +1,93 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// lockPrefix marks content locked with a passphrase:
+// "lock:v1:argon2id:m=<KiB>,t=<passes>,p=<threads>:<base64 salt>:<base64 payload>",
+// where the payload is the nonce followed by the ciphertext. The KDF
+// parameters travel with the value so they can be raised later without
+// breaking notes locked before.
+const lockPrefix = "lock:v1:"
+
+// The argon2id parameters are those of login password hashes, the second
+// recommendation of RFC 9106.
+const (
+	lockTime    = 3
+	lockMemory  = 64 << 10 // KiB
+	lockThreads = 4
+	lockSaltLen = 16
+)
+
+// ErrPassphrase is returned by Unlock when the passphrase is not the one
+// the value was locked with.
+var ErrPassphrase = errors.New("wrong passphrase")
+
+// Locked reports whether value was produced by Lock.
+func Locked(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), lockPrefix)
+}
+
+// Lock encrypts plaintext with AES-256-GCM under a key derived from
+// passphrase, so that only someone who knows the passphrase can read it,
+// whether or not the server holds a master key.
+func Lock(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, lockSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), salt, lockTime, lockMemory, lockThreads, keySize))
+	if err != nil {
+		return "", err
+	}
+	payload := make([]byte, nonceSize, nonceSize+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(payload); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	payload = aead.Seal(payload, payload, []byte(plaintext), nil)
+	return fmt.Sprintf("%sargon2id:m=%d,t=%d,p=%d:%s:%s", lockPrefix, lockMemory, lockTime, lockThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(payload)), nil
+}
+
+// Unlock decrypts a value made by Lock.
+func Unlock(value, passphrase string) (string, error) {
+	fields := strings.Split(strings.TrimPrefix(strings.TrimSpace(value), lockPrefix), ":")
+	if len(fields) != 4 || fields[0] != "argon2id" {
+		return "", errors.New("malformed locked value")
+	}
+	var memory, passes uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(fields[1], "m=%d,t=%d,p=%d", &memory, &passes, &threads); err != nil {
+		return "", errors.New("malformed locked value")
+	}
+	// Values can arrive in imports, so the parameters are bounded rather
+	// than trusted.
+	if memory > 1<<20 || passes == 0 || passes > 16 || threads == 0 {
+		return "", errors.New("unsupported key derivation parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return "", errors.New("malformed locked value")
+	}
+	payload, err := base64.RawStdEncoding.DecodeString(fields[3])
+	if err != nil || len(payload) < nonceSize {
+		return "", errors.New("malformed locked value")
+	}
+
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), salt, passes, memory, threads, keySize))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := aead.Open(nil, payload[:nonceSize], payload[nonceSize:], nil)
+	if err != nil {
+		return "", ErrPassphrase
+	}
+	return string(plaintext), nil
+}
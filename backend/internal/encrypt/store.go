@@ -0,0 +1,471 @@
+package encrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"notes-backend/internal/storage"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Store encrypts note content on its way into the wrapped store and
+// decrypts it on the way out, so neither the API nor the database layer
+// needs to know about it. Titles and tags stay readable; content is opaque
+// to the database, so text queries only match titles, and attachments
+// match by filename, keeping none of the text read from them.
+type Store struct {
+	store.Store
+	keys *Keyring
+}
+
+var (
+	_ store.Store         = (*Store)(nil)
+	_ store.NoteEstimator = (*Store)(nil)
+	_ store.HealthChecker = (*Store)(nil)
+)
+
+func NewStore(inner store.Store, keys *Keyring) *Store {
+	return &Store{Store: inner, keys: keys}
+}
+
+func (s *Store) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	filter.TitleOnly = true
+	items, total, err := s.Store.ListNotes(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range items {
+		if items[i], err = s.open(items[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return items, total, nil
+}
+
+func (s *Store) EstimateNotes(ctx context.Context, filter store.NoteFilter) (int, error) {
+	estimator, ok := s.Store.(store.NoteEstimator)
+	if !ok {
+		return -1, nil
+	}
+	filter.TitleOnly = true
+	return estimator.EstimateNotes(ctx, filter)
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	checker, ok := s.Store.(store.HealthChecker)
+	if !ok {
+		return nil
+	}
+	return checker.Ping(ctx)
+}
+
+func (s *Store) PoolStats() store.PoolStats {
+	checker, ok := s.Store.(store.HealthChecker)
+	if !ok {
+		return store.PoolStats{}
+	}
+	return checker.PoolStats()
+}
+
+func (s *Store) GetNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	return s.opened(s.Store.GetNote(ctx, id))
+}
+
+// CreateNote and UpdateNote have the content measured before it is sealed.
+func (s *Store) CreateNote(ctx context.Context, input store.NoteInput, now time.Time) (store.Note, error) {
+	stats := input.ContentStats()
+	input.Stats = &stats
+	var err error
+	if input.Content, err = s.keys.Seal(input.Content); err != nil {
+		return store.Note{}, err
+	}
+	return s.opened(s.Store.CreateNote(ctx, input, now))
+}
+
+func (s *Store) UpdateNote(ctx context.Context, id uuid.UUID, input store.NoteInput, now time.Time) (store.Note, error) {
+	stats := input.ContentStats()
+	input.Stats = &stats
+	var err error
+	if input.Content, err = s.keys.Seal(input.Content); err != nil {
+		return store.Note{}, err
+	}
+	return s.opened(s.Store.UpdateNote(ctx, id, input, now))
+}
+
+// MergeNotes seals the merged content like UpdateNote and the revision
+// like AddRevision.
+func (s *Store) MergeNotes(ctx context.Context, merge store.NoteMerge, now time.Time) (store.Note, error) {
+	stats := merge.Input.ContentStats()
+	merge.Input.Stats = &stats
+	var err error
+	if merge.Input.Content, err = s.keys.Seal(merge.Input.Content); err != nil {
+		return store.Note{}, err
+	}
+	if merge.Revision != nil {
+		rev := *merge.Revision
+		if rev.Content, err = s.keys.Seal(rev.Content); err != nil {
+			return store.Note{}, err
+		}
+		merge.Revision = &rev
+	}
+	return s.opened(s.Store.MergeNotes(ctx, merge, now))
+}
+
+func (s *Store) SetFavorite(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.opened(s.Store.SetFavorite(ctx, id, value, now))
+}
+
+func (s *Store) SetPinned(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.opened(s.Store.SetPinned(ctx, id, value, now))
+}
+
+func (s *Store) SetArchived(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.opened(s.Store.SetArchived(ctx, id, value, now))
+}
+
+func (s *Store) SetAppearance(ctx context.Context, id uuid.UUID, color, icon string, now time.Time) (store.Note, error) {
+	return s.opened(s.Store.SetAppearance(ctx, id, color, icon, now))
+}
+
+func (s *Store) SetSchedule(ctx context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (store.Note, error) {
+	return s.opened(s.Store.SetSchedule(ctx, id, dueAt, reminderAt, now))
+}
+
+func (s *Store) ListScheduledNotes(ctx context.Context) ([]store.Note, error) {
+	return s.openedAll(s.Store.ListScheduledNotes(ctx))
+}
+
+func (s *Store) SetEncrypted(ctx context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (store.Note, error) {
+	var err error
+	if content, err = s.keys.Seal(content); err != nil {
+		return store.Note{}, err
+	}
+	return s.opened(s.Store.SetEncrypted(ctx, id, value, content, ifVersion, now))
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	return s.opened(s.Store.RestoreNote(ctx, id))
+}
+
+func (s *Store) Links(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.openedAll(s.Store.Links(ctx, noteID))
+}
+
+func (s *Store) Backlinks(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.openedAll(s.Store.Backlinks(ctx, noteID))
+}
+
+func (s *Store) SuggestTitles(ctx context.Context, prefix string, limit int) ([]store.Note, error) {
+	return s.openedAll(s.Store.SuggestTitles(ctx, prefix, limit))
+}
+
+func (s *Store) InsertNote(ctx context.Context, note store.Note) error {
+	var err error
+	if note.Content, err = s.keys.Seal(note.Content); err != nil {
+		return err
+	}
+	return s.Store.InsertNote(ctx, note)
+}
+
+func (s *Store) InsertNotes(ctx context.Context, notes []store.Note) error {
+	sealed, err := s.sealNotes(notes)
+	if err != nil {
+		return err
+	}
+	return s.Store.InsertNotes(ctx, sealed)
+}
+
+func (s *Store) InsertSnapshot(ctx context.Context, notebooks []store.Notebook, notes []store.Note) error {
+	sealed, err := s.sealNotes(notes)
+	if err != nil {
+		return err
+	}
+	return s.Store.InsertSnapshot(ctx, notebooks, sealed)
+}
+
+func (s *Store) CreateAttachment(ctx context.Context, a store.Attachment) error {
+	a.Text = ""
+	return s.Store.CreateAttachment(ctx, a)
+}
+
+// sealNotes returns copies of notes with their content sealed.
+func (s *Store) sealNotes(notes []store.Note) ([]store.Note, error) {
+	sealed := make([]store.Note, len(notes))
+	for i, note := range notes {
+		var err error
+		if note.Content, err = s.keys.Seal(note.Content); err != nil {
+			return nil, err
+		}
+		sealed[i] = note
+	}
+	return sealed, nil
+}
+
+// GetTwoFactor and SetupTwoFactor keep the TOTP secret of two-factor
+// logins sealed like note content.
+func (s *Store) GetTwoFactor(ctx context.Context) (store.TwoFactor, error) {
+	tf, err := s.Store.GetTwoFactor(ctx)
+	if err != nil {
+		return store.TwoFactor{}, err
+	}
+	if tf.Secret, err = s.keys.Open(tf.Secret); err != nil {
+		return store.TwoFactor{}, fmt.Errorf("two-factor secret: %w", err)
+	}
+	return tf, nil
+}
+
+func (s *Store) SetupTwoFactor(ctx context.Context, secret string) error {
+	sealed, err := s.keys.Seal(secret)
+	if err != nil {
+		return err
+	}
+	return s.Store.SetupTwoFactor(ctx, sealed)
+}
+
+func (s *Store) AddRevision(ctx context.Context, note store.Note, keep int) error {
+	var err error
+	if note.Content, err = s.keys.Seal(note.Content); err != nil {
+		return err
+	}
+	return s.Store.AddRevision(ctx, note, keep)
+}
+
+func (s *Store) ListRevisions(ctx context.Context, noteID uuid.UUID) ([]store.Revision, error) {
+	revs, err := s.Store.ListRevisions(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revs {
+		if revs[i], err = s.openRevision(revs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, noteID uuid.UUID, rev int) (store.Revision, error) {
+	r, err := s.Store.GetRevision(ctx, noteID, rev)
+	if err != nil {
+		return store.Revision{}, err
+	}
+	return s.openRevision(r)
+}
+
+func (s *Store) ListAccessedNotes(ctx context.Context, filter store.AccessFilter) ([]store.AccessedNote, error) {
+	items, err := s.Store.ListAccessedNotes(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].Note, err = s.open(items[i].Note); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (s *Store) GetDailyNote(ctx context.Context, day string) (store.Note, error) {
+	return s.opened(s.Store.GetDailyNote(ctx, day))
+}
+
+func (s *Store) ListNoteChanges(ctx context.Context, since int64, limit int) (store.ChangePage, error) {
+	page, err := s.Store.ListNoteChanges(ctx, since, limit)
+	if err != nil {
+		return store.ChangePage{}, err
+	}
+	for _, change := range page.Changes {
+		if change.Note != nil {
+			if *change.Note, err = s.open(*change.Note); err != nil {
+				return store.ChangePage{}, err
+			}
+		}
+	}
+	return page, nil
+}
+
+// ClaimIdempotencyKey and FinishIdempotentRequest seal the stored
+// responses, which carry note content.
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, req store.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (store.IdempotentRequest, bool, error) {
+	held, claimed, err := s.Store.ClaimIdempotencyKey(ctx, req, expiredBefore, abandonedBefore)
+	if err != nil {
+		return store.IdempotentRequest{}, false, err
+	}
+	if held.Body, err = s.keys.Open(held.Body); err != nil {
+		return store.IdempotentRequest{}, false, fmt.Errorf("idempotent response: %w", err)
+	}
+	return held, claimed, nil
+}
+
+func (s *Store) FinishIdempotentRequest(ctx context.Context, req store.IdempotentRequest) error {
+	var err error
+	if req.Body, err = s.keys.Seal(req.Body); err != nil {
+		return err
+	}
+	return s.Store.FinishIdempotentRequest(ctx, req)
+}
+
+// Rotate re-wraps the data keys of every note and revision under the
+// current master key and encrypts ones still stored in plain text.
+// Timestamps are kept. It returns how many notes were rewritten; afterwards
+// retired keys can be dropped from the configuration.
+func (s *Store) Rotate(ctx context.Context) (int, error) {
+	ids, err := s.noteIDs(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, id := range ids {
+		n, err := s.Store.GetNote(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			// Deleted while rotating.
+			continue
+		}
+		if err != nil {
+			return rotated, err
+		}
+		if err := s.rotateRevisions(ctx, id); err != nil {
+			return rotated, fmt.Errorf("note %s: %w", id, err)
+		}
+		content, changed, err := s.keys.Rewrap(n.Content)
+		if err != nil {
+			return rotated, fmt.Errorf("note %s: %w", id, err)
+		}
+		if !changed {
+			continue
+		}
+		_, err = s.Store.UpdateNote(ctx, id, store.NoteInput{
+			Title:      n.Title,
+			Content:    content,
+			Tags:       n.Tags,
+			IsFavorite: n.IsFavorite,
+			Language:   n.Language,
+			IfVersion:  n.Version,
+			Stats:      &store.TextStats{Words: n.WordCount, Chars: n.CharCount},
+		}, n.UpdatedAt)
+		if errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound) {
+			// Rewritten or deleted while rotating; a new write is
+			// sealed under the current key anyway.
+			continue
+		}
+		if err != nil {
+			return rotated, fmt.Errorf("note %s: %w", id, err)
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// RotateAttachments does for attachment blobs what Rotate does for notes,
+// including those of notes in the trash, and returns how many blobs were
+// rewritten.
+func (s *Store) RotateAttachments(ctx context.Context, blobs *BlobStore) (int, error) {
+	var ids []uuid.UUID
+	for _, trashed := range []bool{false, true} {
+		page, err := s.noteIDs(ctx, trashed)
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, page...)
+	}
+
+	rotated := 0
+	for _, id := range ids {
+		attachments, err := s.Store.ListAttachments(ctx, id)
+		if err != nil {
+			return rotated, fmt.Errorf("note %s: %w", id, err)
+		}
+		for _, a := range attachments {
+			changed, err := blobs.rewrap(ctx, a.ID.String())
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return rotated, fmt.Errorf("attachment %s: %w", a.ID, err)
+			}
+			if changed {
+				rotated++
+			}
+		}
+	}
+	return rotated, nil
+}
+
+// noteIDs lists every live or trashed note. IDs are collected up front so
+// that rewriting does not shift the pages being read.
+func (s *Store) noteIDs(ctx context.Context, trashed bool) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for offset := 0; ; offset += 500 {
+		page, _, err := s.Store.ListNotes(ctx, store.NoteFilter{Trashed: trashed, Limit: 500, Offset: offset, SkipCount: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range page {
+			ids = append(ids, n.ID)
+		}
+		if len(page) < 500 {
+			return ids, nil
+		}
+	}
+}
+
+func (s *Store) rotateRevisions(ctx context.Context, noteID uuid.UUID) error {
+	revs, err := s.Store.ListRevisions(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	for _, r := range revs {
+		content, changed, err := s.keys.Rewrap(r.Content)
+		if err != nil {
+			return fmt.Errorf("revision %d: %w", r.Rev, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := s.Store.SetRevisionContent(ctx, noteID, r.Rev, content); err != nil {
+			return fmt.Errorf("revision %d: %w", r.Rev, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) openRevision(r store.Revision) (store.Revision, error) {
+	content, err := s.keys.Open(r.Content)
+	if err != nil {
+		return store.Revision{}, fmt.Errorf("note %s revision %d: %w", r.NoteID, r.Rev, err)
+	}
+	r.Content = content
+	return r, nil
+}
+
+func (s *Store) opened(n store.Note, err error) (store.Note, error) {
+	if err != nil {
+		return store.Note{}, err
+	}
+	return s.open(n)
+}
+
+func (s *Store) openedAll(items []store.Note, err error) ([]store.Note, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i], err = s.open(items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (s *Store) open(n store.Note) (store.Note, error) {
+	content, err := s.keys.Open(n.Content)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("note %s: %w", n.ID, err)
+	}
+	n.Content = content
+	return n, nil
+}
@@ -0,0 +1,158 @@
+// Package events fans note changes out to the clients watching them. Events
+// stay in the process: each replica tells the clients connected to it about
+// the writes it made.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	NoteCreated   = "note.created"
+	NoteUpdated   = "note.updated"
+	NoteDeleted   = "note.deleted"
+	NoteRestored  = "note.restored"
+	NotePurged    = "note.purged"
+	NoteFavorited = "note.favorited"
+	NotePinned    = "note.pinned"
+	NoteArchived  = "note.archived"
+	// NotesReordered carries the IDs given to ReorderNotes, in order.
+	NotesReordered = "notes.reordered"
+	// NotesChanged says many notes may have changed, as when a notebook
+	// is deleted or the trash emptied, without saying which.
+	NotesChanged = "notes.changed"
+)
+
+// Event is one change. Note is set when the write returned the note, so
+// clients need not fetch it; otherwise only its ID is.
+type Event struct {
+	// Seq is given by Publish; EventID formats it for clients.
+	Seq  uint64      `json:"-"`
+	Type string      `json:"type"`
+	ID   *uuid.UUID  `json:"id,omitempty"`
+	IDs  []uuid.UUID `json:"ids,omitempty"`
+	Note *store.Note `json:"note,omitempty"`
+}
+
+const (
+	// subscriptionBuffer is how many events a subscriber may fall behind
+	// before it is dropped.
+	subscriptionBuffer = 64
+	// historySize is how many recent events SubscribeSince can replay.
+	historySize = 256
+)
+
+// Bus delivers every published event to every subscriber. Publishing never
+// blocks: a subscriber whose buffer is full is dropped, its channel closed,
+// and has to resubscribe and reload.
+type Bus struct {
+	// epoch tells this bus's event IDs from those of an earlier process,
+	// whose sequence numbers mean nothing here.
+	epoch string
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	seq     uint64
+	history []Event
+}
+
+type Subscription struct {
+	// C receives the events until the subscription is closed or dropped.
+	C   <-chan Event
+	c   chan Event
+	bus *Bus
+}
+
+func NewBus() *Bus {
+	return &Bus{epoch: uuid.NewString()[:8], subs: make(map[*Subscription]struct{})}
+}
+
+func (b *Bus) Subscribe() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribe()
+}
+
+// SubscribeSince subscribes a client that last saw the event with ID
+// lastID and returns the events it missed since. When some of them are no
+// longer known, because lastID is too old or from another process, missed
+// is instead a single NotesChanged event telling the client to reload,
+// with the ID of the latest event to resume from. An empty lastID is a
+// client starting afresh, which missed nothing.
+func (b *Bus) SubscribeSince(lastID string) (sub *Subscription, missed []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub = b.subscribe()
+	if lastID == "" {
+		return sub, nil
+	}
+	reload := []Event{{Seq: b.seq, Type: NotesChanged}}
+	epoch, rawSeq, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil || epoch != b.epoch || seq > b.seq {
+		return sub, reload
+	}
+	if seq == b.seq {
+		return sub, nil
+	}
+	if len(b.history) == 0 || b.history[0].Seq > seq+1 {
+		return sub, reload
+	}
+	for _, e := range b.history {
+		if e.Seq > seq {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed
+}
+
+// EventID is what clients send back to SubscribeSince to resume after e.
+func (b *Bus) EventID(e Event) string {
+	return fmt.Sprintf("%s-%d", b.epoch, e.Seq)
+}
+
+func (b *Bus) subscribe() *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, bus: b}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// Close unsubscribes; it is safe to call after the subscription was dropped.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+func (b *Bus) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import "testing"
+
+func TestBusDropsSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	fast, slow := bus.Subscribe(), bus.Subscribe()
+	defer fast.Close()
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		bus.Publish(Event{Type: NoteCreated})
+		if i < subscriptionBuffer {
+			<-fast.C
+		}
+	}
+	if e := <-fast.C; e.Type != NoteCreated {
+		t.Fatalf("fast subscriber got %+v", e)
+	}
+	for range slow.C {
+	}
+	slow.Close()
+	bus.Publish(Event{Type: NotesChanged})
+	if e := <-fast.C; e.Type != NotesChanged {
+		t.Fatalf("fast subscriber got %+v after the slow one was dropped", e)
+	}
+}
+
+func TestSubscribeSince(t *testing.T) {
+	bus := NewBus()
+	sub, missed := bus.SubscribeSince("")
+	sub.Close()
+	if missed != nil {
+		t.Fatalf("fresh client missed %+v", missed)
+	}
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(Event{Type: NoteUpdated})
+	}
+	first := bus.EventID(Event{Seq: 1})
+	sub, missed = bus.SubscribeSince(first)
+	sub.Close()
+	if len(missed) != 2 || missed[0].Seq != 2 || missed[1].Seq != 3 {
+		t.Fatalf("missed since %s = %+v, want events 2 and 3", first, missed)
+	}
+
+	for i := 0; i < historySize; i++ {
+		bus.Publish(Event{Type: NoteUpdated})
+	}
+	for _, lastID := range []string{first, "gone-3", "junk"} {
+		sub, missed = bus.SubscribeSince(lastID)
+		sub.Close()
+		if len(missed) != 1 || missed[0].Type != NotesChanged || missed[0].Seq != 3+historySize {
+			t.Fatalf("missed since %q = %+v, want a reload at the latest event", lastID, missed)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Store publishes an event on the bus after every successful note write
+// made through it.
+type Store struct {
+	store.Store
+	bus *Bus
+}
+
+var (
+	_ store.Store         = (*Store)(nil)
+	_ store.NoteEstimator = (*Store)(nil)
+)
+
+func NewStore(inner store.Store, bus *Bus) *Store {
+	return &Store{Store: inner, bus: bus}
+}
+
+func (s *Store) EstimateNotes(ctx context.Context, filter store.NoteFilter) (int, error) {
+	estimator, ok := s.Store.(store.NoteEstimator)
+	if !ok {
+		return -1, nil
+	}
+	return estimator.EstimateNotes(ctx, filter)
+}
+
+func (s *Store) CreateNote(ctx context.Context, input store.NoteInput, now time.Time) (store.Note, error) {
+	return s.published(NoteCreated)(s.Store.CreateNote(ctx, input, now))
+}
+
+func (s *Store) UpdateNote(ctx context.Context, id uuid.UUID, input store.NoteInput, now time.Time) (store.Note, error) {
+	return s.published(NoteUpdated)(s.Store.UpdateNote(ctx, id, input, now))
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id uuid.UUID, now time.Time) error {
+	if err := s.Store.DeleteNote(ctx, id, now); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NoteDeleted, ID: &id})
+	return nil
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	return s.published(NoteRestored)(s.Store.RestoreNote(ctx, id))
+}
+
+func (s *Store) PurgeNote(ctx context.Context, id uuid.UUID) error {
+	if err := s.Store.PurgeNote(ctx, id); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NotePurged, ID: &id})
+	return nil
+}
+
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	purged, err := s.Store.PurgeDeleted(ctx, before)
+	if err == nil && purged > 0 {
+		s.bus.Publish(Event{Type: NotesChanged})
+	}
+	return purged, err
+}
+
+func (s *Store) SetFavorite(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.published(NoteFavorited)(s.Store.SetFavorite(ctx, id, value, now))
+}
+
+func (s *Store) SetPinned(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.published(NotePinned)(s.Store.SetPinned(ctx, id, value, now))
+}
+
+func (s *Store) SetArchived(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	return s.published(NoteArchived)(s.Store.SetArchived(ctx, id, value, now))
+}
+
+func (s *Store) SetAppearance(ctx context.Context, id uuid.UUID, color, icon string, now time.Time) (store.Note, error) {
+	return s.published(NoteUpdated)(s.Store.SetAppearance(ctx, id, color, icon, now))
+}
+
+func (s *Store) SetSchedule(ctx context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (store.Note, error) {
+	return s.published(NoteUpdated)(s.Store.SetSchedule(ctx, id, dueAt, reminderAt, now))
+}
+
+func (s *Store) SetEncrypted(ctx context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (store.Note, error) {
+	return s.published(NoteUpdated)(s.Store.SetEncrypted(ctx, id, value, content, ifVersion, now))
+}
+
+func (s *Store) ReorderNotes(ctx context.Context, ids []uuid.UUID) error {
+	if err := s.Store.ReorderNotes(ctx, ids); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NotesReordered, IDs: ids})
+	return nil
+}
+
+// ApplyBulk publishes an event per op that found its note, without the
+// note itself.
+func (s *Store) ApplyBulk(ctx context.Context, ops []store.BulkOp, now time.Time) ([]bool, error) {
+	applied, err := s.Store.ApplyBulk(ctx, ops, now)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if !applied[i] {
+			continue
+		}
+		kind := NoteUpdated
+		switch op.Action {
+		case store.BulkDelete:
+			kind = NoteDeleted
+		case store.BulkFavorite:
+			kind = NoteFavorited
+		}
+		s.bus.Publish(Event{Type: kind, ID: &op.NoteID})
+	}
+	return applied, nil
+}
+
+func (s *Store) MergeNotes(ctx context.Context, merge store.NoteMerge, now time.Time) (store.Note, error) {
+	n, err := s.published(NoteUpdated)(s.Store.MergeNotes(ctx, merge, now))
+	if err == nil {
+		s.bus.Publish(Event{Type: NoteDeleted, ID: &merge.SourceID})
+	}
+	return n, err
+}
+
+func (s *Store) ReplaceTags(ctx context.Context, from []string, to string, now time.Time) (int, error) {
+	changed, err := s.Store.ReplaceTags(ctx, from, to, now)
+	if err == nil && changed > 0 {
+		s.bus.Publish(Event{Type: NotesChanged})
+	}
+	return changed, err
+}
+
+func (s *Store) InsertNote(ctx context.Context, note store.Note) error {
+	if err := s.Store.InsertNote(ctx, note); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NoteCreated, ID: &note.ID, Note: &note})
+	return nil
+}
+
+func (s *Store) InsertNotes(ctx context.Context, notes []store.Note) error {
+	if err := s.Store.InsertNotes(ctx, notes); err != nil {
+		return err
+	}
+	for i := range notes {
+		s.bus.Publish(Event{Type: NoteCreated, ID: &notes[i].ID, Note: &notes[i]})
+	}
+	return nil
+}
+
+// InsertSnapshot publishes one NotesChanged, as a restore may bring back
+// any number of notes.
+func (s *Store) InsertSnapshot(ctx context.Context, notebooks []store.Notebook, notes []store.Note) error {
+	if err := s.Store.InsertSnapshot(ctx, notebooks, notes); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NotesChanged})
+	return nil
+}
+
+func (s *Store) DeleteNotebook(ctx context.Context, id uuid.UUID, moveTo *uuid.UUID, trashNotes bool, now time.Time) error {
+	if err := s.Store.DeleteNotebook(ctx, id, moveTo, trashNotes, now); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{Type: NotesChanged})
+	return nil
+}
+
+// published returns a func passing a store result through, publishing it
+// as an event of kind when the write succeeded.
+func (s *Store) published(kind string) func(store.Note, error) (store.Note, error) {
+	return func(n store.Note, err error) (store.Note, error) {
+		if err == nil {
+			s.bus.Publish(Event{Type: kind, ID: &n.ID, Note: &n})
+		}
+		return n, err
+	}
+}
@@ -0,0 +1,71 @@
+// Package extract reads the text of uploaded files, so that attachments
+// can be searched: plain text as it is and PDFs by the text their pages
+// draw.
+package extract
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxInput is the largest file read for text; larger ones are kept
+// without.
+const MaxInput = 32 << 20
+
+// MaxText is how many bytes of text are kept of a file; the rest is cut.
+const MaxText = 1 << 20
+
+// textExtensions stand in for a text media type when the upload was sent
+// as application/octet-stream, as browsers do for Markdown.
+var textExtensions = map[string]bool{".txt": true, ".md": true, ".markdown": true, ".csv": true, ".log": true}
+
+// Supports reports whether Text reads files of contentType, or named
+// filename when the type says nothing.
+func Supports(contentType, filename string) bool {
+	return kind(contentType, filename) != ""
+}
+
+// Text returns the text of data, a file of contentType named filename, cut
+// to MaxText, or "" when it has none that can be read.
+func Text(contentType, filename string, data []byte) string {
+	var text string
+	switch kind(contentType, filename) {
+	case "text":
+		text = strings.ToValidUTF8(string(data), "")
+	case "pdf":
+		text = pdfText(data)
+	}
+	return truncate(strings.TrimSpace(text), MaxText)
+}
+
+func kind(contentType, filename string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(mediaType, "text/") && mediaType != "text/html":
+		return "text"
+	case mediaType != "" && mediaType != "application/octet-stream":
+		return ""
+	}
+	switch ext := strings.ToLower(path.Ext(filename)); {
+	case ext == ".pdf":
+		return "pdf"
+	case textExtensions[ext]:
+		return "text"
+	}
+	return ""
+}
+
+// truncate cuts s to at most n bytes, at the start of a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
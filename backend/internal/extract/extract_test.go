@@ -0,0 +1,76 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF lays out a PDF with a page for each content stream, the first
+// compressed as writers usually do.
+func testPDF(contents ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	for i, content := range contents {
+		stream, filter := []byte(content), ""
+		if i == 0 {
+			var z bytes.Buffer
+			w := zlib.NewWriter(&z)
+			w.Write(stream)
+			w.Close()
+			stream, filter = z.Bytes(), " /Filter /FlateDecode"
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Length %d%s >>\nstream\r\n", 10+i, len(stream), filter)
+		b.Write(stream)
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	// An image, whose bytes are no text.
+	b.WriteString("20 0 obj\n<< /Type /XObject /Subtype /Image /Length 12 >>\nstream\nBT (no) Tj ET\nendstream\nendobj\n")
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestPDFText(t *testing.T) {
+	data := testPDF(
+		"BT /F1 12 Tf 72 720 Td (Quarterly report) Tj 0 -14 Td [(Reve) 20 (nue gr) -20 (ew) -400 (by 12%)] TJ ET",
+		"q 1 0 0 1 0 0 cm Q BT (Caf\\351 \\(open\\) late) Tj T* <feff00e9007400e9> Tj (Line two) ' ET",
+	)
+	want := "Quarterly report\nRevenue grew by 12%\nCafé (open) late\nété\nLine two"
+	if got := Text("application/pdf", "report.pdf", data); got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+	if got := Text("application/octet-stream", "REPORT.PDF", data); got != want {
+		t.Errorf("Text by extension = %q", got)
+	}
+	if got := Text("application/pdf", "broken.pdf", []byte("%PDF-1.4\n1 0 obj\n<< /Filter /FlateDecode >>\nstream\nnot zlib\nendstream\n")); got != "" {
+		t.Errorf("Text of a broken stream = %q", got)
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, tc := range []struct {
+		contentType, filename, data, want string
+	}{
+		{"text/plain; charset=utf-8", "a.txt", "  hello\nworld \n", "hello\nworld"},
+		{"application/octet-stream", "notes.md", "# Title", "# Title"},
+		{"text/csv", "", "a,b\xff", "a,b"},
+		{"text/html", "page.html", "<p>hi</p>", ""},
+		{"image/png", "a.txt", "text", ""},
+		{"application/octet-stream", "a.bin", "text", ""},
+	} {
+		if got := Text(tc.contentType, tc.filename, []byte(tc.data)); got != tc.want {
+			t.Errorf("Text(%s, %s) = %q, want %q", tc.contentType, tc.filename, got, tc.want)
+		}
+		if Supports(tc.contentType, tc.filename) != (tc.want != "") {
+			t.Errorf("Supports(%s, %s) = %t", tc.contentType, tc.filename, !(tc.want != ""))
+		}
+	}
+
+	long := strings.Repeat("é", MaxText)
+	if got := Text("text/plain", "", []byte(long)); len(got) != MaxText || !strings.HasSuffix(got, "é") {
+		t.Errorf("Text of a long file has %d bytes", len(got))
+	}
+}
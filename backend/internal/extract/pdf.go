@@ -0,0 +1,376 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxStream bounds what one PDF stream inflates to, against streams that
+// decompress to far more than the file.
+const maxStream = 16 << 20
+
+// pdfText returns the text a PDF's content streams show, a line for each
+// line they move to. It reads streams as they come in the file, without
+// following its cross-references, and decodes strings as Latin-1 with the
+// Windows punctuation or, with a byte order mark, as UTF-16. That covers
+// the simple fonts most writers use for Latin text; fonts with their own
+// encodings, such as two-byte CID fonts, are not recovered.
+func pdfText(data []byte) string {
+	var out strings.Builder
+	for rest := data; out.Len() < MaxText; {
+		at := bytes.Index(rest, []byte("stream"))
+		if at < 0 {
+			break
+		}
+		dict, body := rest[:at], rest[at+len("stream"):]
+		rest = body
+		// The keyword ends "endstream" too, and must be followed by an end
+		// of line to start one.
+		if at >= 3 && string(dict[at-3:]) == "end" {
+			continue
+		}
+		switch {
+		case bytes.HasPrefix(body, []byte("\r\n")):
+			body = body[2:]
+		case bytes.HasPrefix(body, []byte("\n")), bytes.HasPrefix(body, []byte("\r")):
+			body = body[1:]
+		default:
+			continue
+		}
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		body, rest = body[:end], body[end:]
+		if obj := bytes.LastIndex(dict, []byte(" obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+		content, ok := streamContent(dict, body)
+		if ok {
+			showText(&out, content)
+		}
+	}
+	return out.String()
+}
+
+// streamContent decodes a stream with dictionary dict, unless it holds an
+// image, font or index rather than page content.
+func streamContent(dict, body []byte) ([]byte, bool) {
+	for _, skip := range []string{"/Image", "/XRef", "/ObjStm", "/Length1", "/Length2", "/Length3"} {
+		if bytes.Contains(dict, []byte(skip)) {
+			return nil, false
+		}
+	}
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return body, true
+	}
+	if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Contains(dict, []byte("/DecodeParms")) {
+		return nil, false
+	}
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	// A stream cut short still gives the text before the cut.
+	content, _ := io.ReadAll(io.LimitReader(r, maxStream))
+	return content, len(content) > 0
+}
+
+// showText writes the text that the operators of content show.
+func showText(out *strings.Builder, content []byte) {
+	lex := &pdfLexer{data: content}
+	var operands []pdfToken
+	inText := false
+	for out.Len() < MaxText {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		if tok.kind != pdfOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op := tok.text; {
+		case op == "BT":
+			inText = true
+		case op == "ET":
+			inText = false
+			newline(out)
+		case op == "ID":
+			lex.skipInlineImage()
+		case !inText:
+		case op == "Tj" || op == "'" || op == `"`:
+			if op != "Tj" {
+				newline(out)
+			}
+			if n := len(operands); n > 0 && operands[n-1].kind == pdfString {
+				out.WriteString(decodePDFString(operands[n-1].text))
+			}
+		case op == "TJ":
+			for _, part := range lex.array {
+				switch part.kind {
+				case pdfString:
+					out.WriteString(decodePDFString(part.text))
+				case pdfNumber:
+					// Kerning past a third of the font size is a gap
+					// between words.
+					if n, err := strconv.ParseFloat(part.text, 64); err == nil && n < -300 {
+						space(out)
+					}
+				}
+			}
+		case op == "T*":
+			newline(out)
+		case op == "Td" || op == "TD":
+			if n := len(operands); n >= 2 && isNonZero(operands[n-1].text) {
+				newline(out)
+			} else {
+				space(out)
+			}
+		case op == "Tm":
+			space(out)
+		}
+		operands = operands[:0]
+	}
+}
+
+func isNonZero(number string) bool {
+	n, err := strconv.ParseFloat(number, 64)
+	return err == nil && n != 0
+}
+
+func newline(out *strings.Builder) {
+	s := out.String()
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		out.WriteString("\n")
+	}
+}
+
+func space(out *strings.Builder) {
+	s := out.String()
+	if s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+		out.WriteString(" ")
+	}
+}
+
+// winAnsi maps the bytes in 0x80-0x9f that Windows-1252 gives punctuation
+// and Latin-1 leaves to control characters.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x84: '„', 0x85: '…', 0x8b: '‹', 0x8c: 'Œ', 0x91: '‘', 0x92: '’',
+	0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™', 0x9b: '›', 0x9c: 'œ',
+}
+
+func decodePDFString(raw string) string {
+	if strings.HasPrefix(raw, "\xfe\xff") {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch r, ok := winAnsi[c]; {
+		case ok:
+			b.WriteRune(r)
+		case c == '\t' || c >= 0x20 && c < 0x7f || c >= 0xa0:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+const (
+	pdfOperator = iota
+	pdfString
+	pdfNumber
+	// pdfOther is a name, dictionary or array, none of which the text
+	// operators take but TJ, whose array the lexer keeps aside.
+	pdfOther
+)
+
+type pdfToken struct {
+	kind int
+	text string
+}
+
+// pdfLexer splits a content stream into operands and operators.
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// array holds the strings and numbers of the last array read.
+	array []pdfToken
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return pdfToken{}, false
+	}
+	switch c := l.data[l.pos]; {
+	case c == '(':
+		return pdfToken{kind: pdfString, text: l.literal()}, true
+	case c == '<' && l.peek(1) == '<', c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfToken{kind: pdfOther}, true
+	case c == '<':
+		return pdfToken{kind: pdfString, text: l.hex()}, true
+	case c == '[':
+		l.pos++
+		l.array = l.array[:0]
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return pdfToken{kind: pdfOther}, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return pdfToken{kind: pdfOther}, true
+			}
+			tok, _ := l.next()
+			if tok.kind == pdfString || tok.kind == pdfNumber {
+				l.array = append(l.array, tok)
+			}
+		}
+	case c == '/':
+		l.pos++
+		l.word()
+		return pdfToken{kind: pdfOther}, true
+	case c == ']' || c == ')' || c == '>' || c == '{' || c == '}':
+		l.pos++
+		return pdfToken{kind: pdfOther}, true
+	}
+	word := l.word()
+	if _, err := strconv.ParseFloat(word, 64); err == nil {
+		return pdfToken{kind: pdfNumber, text: word}, true
+	}
+	return pdfToken{kind: pdfOperator, text: word}, true
+}
+
+func (l *pdfLexer) peek(n int) byte {
+	if l.pos+n < len(l.data) {
+		return l.data[l.pos+n]
+	}
+	return 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\r', '\n', '\f', 0:
+			l.pos++
+		case '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word reads up to the next delimiter, always moving on by at least one
+// byte.
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !strings.ContainsRune(" \t\r\n\f\x00()<>[]{}/%", rune(l.data[l.pos])) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literal reads a (string), whose parentheses nest unless escaped.
+func (l *pdfLexer) literal() string {
+	var b []byte
+	depth := 0
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth == 0:
+			l.pos++
+			return string(b)
+		case c == ')':
+			depth--
+		case c == '\\' && l.pos+1 < len(l.data):
+			l.pos++
+			switch e := l.data[l.pos]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string.
+				if e == '\r' && l.peek(1) == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e < '0' || e > '7' {
+					c = e
+					break
+				}
+				n := 0
+				for i := 0; i < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					n = n*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				l.pos--
+				c = byte(n)
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// hex reads a <hex string>, an odd last digit counting as followed by 0.
+func (l *pdfLexer) hex() string {
+	var digits []byte
+	for l.pos++; l.pos < len(l.data) && l.data[l.pos] != '>'; l.pos++ {
+		if c := l.data[l.pos]; strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+			digits = append(digits, c)
+		}
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		b[i] = byte(n)
+	}
+	return string(b)
+}
+
+// skipInlineImage skips the data of an inline image, which runs from ID to
+// an EI on its own.
+func (l *pdfLexer) skipInlineImage() {
+	for i := l.pos + 1; i+2 < len(l.data); i++ {
+		if isPDFSpace(l.data[i-1]) && l.data[i] == 'E' && l.data[i+1] == 'I' && (i+2 == len(l.data) || isPDFSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
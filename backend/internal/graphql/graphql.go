@@ -0,0 +1,743 @@
+// Package graphql executes GraphQL queries against a schema of resolver
+// functions: the query language with variables, aliases, fragments and
+// the @skip and @include directives. It has no mutations, subscriptions,
+// interfaces, unions, input objects or enums, and answers introspection
+// only with __typename.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Type is a GraphQL type: one of the scalars, an Object's type, or a
+// List or NonNull of another.
+type Type struct {
+	name   string
+	object *Object
+	list   *Type
+	// nonNull wraps the type it is set on.
+	nonNull *Type
+}
+
+var (
+	String  = &Type{name: "String"}
+	Int     = &Type{name: "Int"}
+	Float   = &Type{name: "Float"}
+	Boolean = &Type{name: "Boolean"}
+	ID      = &Type{name: "ID"}
+)
+
+func List(of *Type) *Type { return &Type{list: of} }
+
+func NonNull(of *Type) *Type { return &Type{nonNull: of} }
+
+func (t *Type) String() string {
+	switch {
+	case t.nonNull != nil:
+		return t.nonNull.String() + "!"
+	case t.list != nil:
+		return "[" + t.list.String() + "]"
+	}
+	return t.name
+}
+
+// named is t without its List and NonNull wrappers.
+func (t *Type) named() *Type {
+	for {
+		switch {
+		case t.nonNull != nil:
+			t = t.nonNull
+		case t.list != nil:
+			t = t.list
+		default:
+			return t
+		}
+	}
+}
+
+// Object is an object type. Fields may refer to objects not filled in yet,
+// so types can refer to each other.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+func (o *Object) Type() *Type { return &Type{name: o.Name, object: o} }
+
+// ResolveFunc returns a field's value from its parent's. Values of object
+// fields are passed on as the source of their own fields; values of
+// scalars are encoded as JSON.
+type ResolveFunc func(ctx context.Context, source any, args map[string]any) (any, error)
+
+type Field struct {
+	Type *Type
+	// Args declares the arguments the field takes; they are coerced to
+	// their types before Resolve sees them: String and ID to string, Int to
+	// int, Float to float64, Boolean to bool and lists to []any. Arguments
+	// left out are missing from the map.
+	Args map[string]*Type
+	// Resolve may be nil for fields of structs, which then take the value
+	// of the struct field whose name matches, ignoring case.
+	Resolve ResolveFunc
+}
+
+type Schema struct {
+	Query *Object
+	// MaxDepth bounds how deeply selections may nest; 0 means no limit.
+	MaxDepth int
+	// MaxResolves bounds how many times one query may call resolvers, the
+	// fields that cost something; 0 means no limit.
+	MaxResolves int
+}
+
+// Request is a query as clients post it.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type Response struct {
+	Data   any     `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	// Path leads from the root of data to the field that failed, by
+	// response keys and list indexes.
+	Path []any `json:"path,omitempty"`
+}
+
+func (e Error) Error() string { return e.Message }
+
+// Execute runs req against the schema. A query that does not parse or
+// validate gets only errors; one that does gets data, with fields that
+// failed set to null and their errors alongside.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	if errs := s.validate(doc, op); len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	vars, err := coerceVariables(op, req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{schema: s, doc: doc, vars: vars}
+	data, _ := e.object(ctx, s.Query, op.selection, nil, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	var found *operation
+	for _, op := range d.operations {
+		if name == "" && len(d.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for a document with several operations")
+		}
+		if name == "" || op.name == name {
+			found = op
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no operation named %q", name)
+	}
+	if found.kind != "query" {
+		return nil, fmt.Errorf("%s operations are not supported", found.kind)
+	}
+	return found, nil
+}
+
+// validate checks the selections against the schema before anything
+// runs, so a mistyped field fails the query instead of returning partial
+// data.
+func (s *Schema) validate(doc *document, op *operation) []Error {
+	v := &validator{schema: s, doc: doc, defined: make(map[string]bool)}
+	for _, def := range op.variables {
+		v.defined[def.name] = true
+	}
+	v.selection(s.Query, op.selection, 1)
+	return v.errors
+}
+
+type validator struct {
+	schema  *Schema
+	doc     *document
+	defined map[string]bool
+	errors  []Error
+	// spreading holds the fragments being expanded, to catch cycles.
+	spreading []string
+	// fields counts the fields checked, fragments expanded, so that
+	// fragments spreading each other many times cannot make the query
+	// exponentially large.
+	fields int
+}
+
+const maxQueryFields = 5000
+
+func (v *validator) errorf(format string, args ...any) {
+	v.errors = append(v.errors, Error{Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) selection(obj *Object, set []selection, depth int) {
+	if v.schema.MaxDepth > 0 && depth > v.schema.MaxDepth {
+		v.errorf("query is nested deeper than %d levels", v.schema.MaxDepth)
+		return
+	}
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *field:
+			if v.fields++; v.fields > maxQueryFields {
+				if v.fields == maxQueryFields+1 {
+					v.errorf("query selects more than %d fields", maxQueryFields)
+				}
+				return
+			}
+			v.directives(sel.directives)
+			if sel.name == "__typename" {
+				if sel.selection != nil {
+					v.errorf("line %d: __typename has no fields", sel.line)
+				}
+				continue
+			}
+			f, ok := obj.Fields[sel.name]
+			if !ok {
+				v.errorf("line %d: %s has no field %q", sel.line, obj.Name, sel.name)
+				continue
+			}
+			for _, arg := range sel.args {
+				if _, ok := f.Args[arg.name]; !ok {
+					v.errorf("line %d: field %q has no argument %q", sel.line, sel.name, arg.name)
+				}
+				v.variables(arg.val)
+			}
+			for name, t := range f.Args {
+				if t.nonNull != nil && !hasArg(sel.args, name) {
+					v.errorf("line %d: field %q needs argument %q", sel.line, sel.name, name)
+				}
+			}
+			named := f.Type.named()
+			switch {
+			case named.object != nil && sel.selection == nil:
+				v.errorf("line %d: field %q of type %s needs a selection of its fields", sel.line, sel.name, f.Type)
+			case named.object == nil && sel.selection != nil:
+				v.errorf("line %d: field %q of type %s has no fields", sel.line, sel.name, f.Type)
+			case named.object != nil:
+				v.selection(named.object, sel.selection, depth+1)
+			}
+		case *inlineFragment:
+			v.directives(sel.directives)
+			if sel.typeName != "" && sel.typeName != obj.Name {
+				v.errorf("fragment on %s cannot apply to %s", sel.typeName, obj.Name)
+				continue
+			}
+			v.selection(obj, sel.selection, depth)
+		case *fragmentSpread:
+			v.directives(sel.directives)
+			frag, ok := v.doc.fragments[sel.name]
+			if !ok {
+				v.errorf("unknown fragment %q", sel.name)
+				continue
+			}
+			for _, name := range v.spreading {
+				if name == sel.name {
+					v.errorf("fragment %q spreads itself", sel.name)
+					return
+				}
+			}
+			if frag.typeName != obj.Name {
+				v.errorf("fragment %q on %s cannot apply to %s", sel.name, frag.typeName, obj.Name)
+				continue
+			}
+			v.spreading = append(v.spreading, sel.name)
+			v.selection(obj, frag.selection, depth)
+			v.spreading = v.spreading[:len(v.spreading)-1]
+		}
+	}
+}
+
+func (v *validator) directives(list []directive) {
+	for _, d := range list {
+		if d.name != "skip" && d.name != "include" {
+			v.errorf("unknown directive @%s", d.name)
+			continue
+		}
+		if len(d.args) != 1 || d.args[0].name != "if" {
+			v.errorf("@%s takes one argument, if", d.name)
+			continue
+		}
+		v.variables(d.args[0].val)
+	}
+}
+
+func (v *validator) variables(val value) {
+	switch val := val.(type) {
+	case variableRef:
+		if !v.defined[string(val)] {
+			v.errorf("variable $%s is not defined", val)
+		}
+	case []value:
+		for _, item := range val {
+			v.variables(item)
+		}
+	case []argument:
+		for _, arg := range val {
+			v.variables(arg.val)
+		}
+	}
+}
+
+func hasArg(args []argument, name string) bool {
+	for _, arg := range args {
+		if arg.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// coerceVariables checks the given variables against their definitions and
+// fills in defaults.
+func coerceVariables(op *operation, given map[string]any) (map[string]any, error) {
+	vars := make(map[string]any)
+	for _, def := range op.variables {
+		t, err := def.typ.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+		}
+		raw, ok := given[def.name]
+		if !ok && def.defaultVal != nil {
+			if raw, err = literal(def.defaultVal, nil); err != nil {
+				return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+			}
+			ok = true
+		}
+		if !ok {
+			if t.nonNull != nil {
+				return nil, fmt.Errorf("variable $%s of type %s is required", def.name, t)
+			}
+			continue
+		}
+		if vars[def.name], err = coerce(t, raw); err != nil {
+			return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+		}
+	}
+	return vars, nil
+}
+
+func (r *typeRef) resolve() (*Type, error) {
+	var t *Type
+	if r.list != nil {
+		inner, err := r.list.resolve()
+		if err != nil {
+			return nil, err
+		}
+		t = List(inner)
+	} else {
+		for _, scalar := range []*Type{String, Int, Float, Boolean, ID} {
+			if scalar.name == r.name {
+				t = scalar
+			}
+		}
+		if t == nil {
+			return nil, fmt.Errorf("unknown input type %s", r.name)
+		}
+	}
+	if r.nonNull {
+		t = NonNull(t)
+	}
+	return t, nil
+}
+
+// literal turns a value from the query into the form variables arrive in
+// from JSON, so both are coerced the same way.
+func literal(val value, vars map[string]any) (any, error) {
+	switch val := val.(type) {
+	case variableRef:
+		return vars[string(val)], nil
+	case intValue:
+		return json.Number(val), nil
+	case floatValue:
+		return json.Number(val), nil
+	case enumValue:
+		return nil, fmt.Errorf("enum value %s is not supported", val)
+	case []value:
+		list := make([]any, len(val))
+		for i, item := range val {
+			var err error
+			if list[i], err = literal(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case []argument:
+		return nil, fmt.Errorf("input objects are not supported")
+	}
+	return val, nil
+}
+
+// coerce converts an input value to t's Go form.
+func coerce(t *Type, v any) (any, error) {
+	if t.nonNull != nil {
+		if v == nil {
+			return nil, fmt.Errorf("expected a non-null %s", t.nonNull)
+		}
+		return coerce(t.nonNull, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if t.list != nil {
+		items, ok := v.([]any)
+		if !ok {
+			// A single value stands for a list of one.
+			items = []any{v}
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if list[i], err = coerce(t.list, item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	switch t {
+	case String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case ID:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				return v.String(), nil
+			}
+		case float64:
+			if v == float64(int64(v)) {
+				return strconv.FormatInt(int64(v), 10), nil
+			}
+		}
+	case Int:
+		switch v := v.(type) {
+		case int:
+			return v, nil
+		case json.Number:
+			if n, err := strconv.ParseInt(v.String(), 10, 32); err == nil {
+				return int(n), nil
+			}
+		case float64:
+			if v == float64(int32(v)) {
+				return int(v), nil
+			}
+		}
+	case Float:
+		switch v := v.(type) {
+		case int:
+			return float64(v), nil
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		case float64:
+			return v, nil
+		}
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, got %v", t, v)
+}
+
+type executor struct {
+	schema   *Schema
+	doc      *document
+	vars     map[string]any
+	errors   []Error
+	resolves int
+}
+
+func (e *executor) fail(path []any, err error) {
+	e.errors = append(e.errors, Error{Message: err.Error(), Path: append([]any(nil), path...)})
+}
+
+// collected is a response key and the fields that share it.
+type collected struct {
+	key    string
+	fields []*field
+}
+
+// collect flattens fragments and drops skipped fields, merging fields that
+// share a response key.
+func (e *executor) collect(set []selection, into []collected) ([]collected, error) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *field:
+			if ok, err := e.included(sel.directives); !ok || err != nil {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			key := sel.name
+			if sel.alias != "" {
+				key = sel.alias
+			}
+			merged := false
+			for i := range into {
+				if into[i].key == key {
+					into[i].fields = append(into[i].fields, sel)
+					merged = true
+				}
+			}
+			if !merged {
+				into = append(into, collected{key: key, fields: []*field{sel}})
+			}
+		case *inlineFragment:
+			ok, err := e.included(sel.directives)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if into, err = e.collect(sel.selection, into); err != nil {
+					return nil, err
+				}
+			}
+		case *fragmentSpread:
+			ok, err := e.included(sel.directives)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if into, err = e.collect(e.doc.fragments[sel.name].selection, into); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return into, nil
+}
+
+func (e *executor) included(list []directive) (bool, error) {
+	for _, d := range list {
+		raw, err := literal(d.args[0].val, e.vars)
+		if err != nil {
+			return false, err
+		}
+		cond, ok := raw.(bool)
+		if !ok {
+			return false, fmt.Errorf("@%s(if:) takes a Boolean", d.name)
+		}
+		if cond == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// object resolves the selected fields of obj on source. It returns false
+// when a non-null field came out null, which makes the object null too.
+func (e *executor) object(ctx context.Context, obj *Object, set []selection, source any, path []any) (*orderedMap, bool) {
+	fields, err := e.collect(set, nil)
+	if err != nil {
+		e.fail(path, err)
+		return nil, false
+	}
+	result := &orderedMap{}
+	for _, c := range fields {
+		f := c.fields[0]
+		if f.name == "__typename" {
+			result.set(c.key, obj.Name)
+			continue
+		}
+		def := obj.Fields[f.name]
+		fieldPath := append(path[:len(path):len(path)], c.key)
+		var sub []selection
+		for _, f := range c.fields {
+			sub = append(sub, f.selection...)
+		}
+		value, ok := e.field(ctx, def, f, source, sub, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		result.set(c.key, value)
+	}
+	return result, true
+}
+
+func (e *executor) field(ctx context.Context, def *Field, f *field, source any, sub []selection, path []any) (any, bool) {
+	var value any
+	var err error
+	if def.Resolve == nil {
+		value, err = structField(source, f.name)
+	} else {
+		e.resolves++
+		if e.schema.MaxResolves > 0 && e.resolves > e.schema.MaxResolves {
+			err = fmt.Errorf("query resolves more than %d fields", e.schema.MaxResolves)
+		} else {
+			var args map[string]any
+			if args, err = e.arguments(def, f); err == nil {
+				value, err = def.Resolve(ctx, source, args)
+			}
+		}
+	}
+	if err != nil {
+		e.fail(path, err)
+		return nil, def.Type.nonNull == nil
+	}
+	return e.complete(ctx, def.Type, sub, value, path)
+}
+
+func (e *executor) arguments(def *Field, f *field) (map[string]any, error) {
+	args := make(map[string]any, len(f.args))
+	for _, arg := range f.args {
+		if v, ok := arg.val.(variableRef); ok {
+			if _, given := e.vars[string(v)]; !given {
+				continue
+			}
+		}
+		raw, err := literal(arg.val, e.vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", arg.name, err)
+		}
+		if args[arg.name], err = coerce(def.Args[arg.name], raw); err != nil {
+			return nil, fmt.Errorf("argument %s: %w", arg.name, err)
+		}
+	}
+	for name, t := range def.Args {
+		if _, ok := args[name]; !ok && t.nonNull != nil {
+			return nil, fmt.Errorf("argument %s of type %s is required", name, t)
+		}
+	}
+	return args, nil
+}
+
+// complete shapes a resolved value by its type. Like object, it returns
+// false when the value has to be null but may not be.
+func (e *executor) complete(ctx context.Context, t *Type, sub []selection, value any, path []any) (any, bool) {
+	if t.nonNull != nil {
+		result, ok := e.completeNullable(ctx, t.nonNull, sub, value, path)
+		if ok && result == nil {
+			e.fail(path, fmt.Errorf("%s cannot be null", t))
+			return nil, false
+		}
+		return result, ok
+	}
+	// A nullable value is where a null from further down stops.
+	result, _ := e.completeNullable(ctx, t, sub, value, path)
+	return result, true
+}
+
+func (e *executor) completeNullable(ctx context.Context, t *Type, sub []selection, value any, path []any) (any, bool) {
+	if isNull(value) {
+		return nil, true
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	switch {
+	case t.list != nil:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.fail(path, fmt.Errorf("resolver returned %T for a list", value))
+			return nil, false
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			item, ok := e.complete(ctx, t.list, sub, rv.Index(i).Interface(), append(path[:len(path):len(path)], i))
+			if !ok {
+				return nil, false
+			}
+			items[i] = item
+		}
+		return items, true
+	case t.object != nil:
+		result, ok := e.object(ctx, t.object, sub, value, path)
+		if !ok {
+			return nil, false
+		}
+		return result, true
+	}
+	return rv.Interface(), true
+}
+
+func isNull(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// structField is the default resolver: the field of the source struct
+// named like the GraphQL field, ignoring case.
+func structField(source any, name string) (any, error) {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("no resolver for field %q", name)
+	}
+	f := rv.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, name) })
+	if !f.IsValid() {
+		return nil, fmt.Errorf("no resolver for field %q", name)
+	}
+	return f.Interface(), nil
+}
+
+// orderedMap keeps response keys in the order the query selected them,
+// as GraphQL requires.
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m *orderedMap) set(key string, value any) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, key := range m.keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, k...), ':'), v...)
+	}
+	return append(buf, '}'), nil
+}
@@ -0,0 +1,166 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	ID    string
+	Name  string
+	Tags  []string
+	Score *float64
+}
+
+func testSchema() *Schema {
+	score := 1.5
+	items := []testItem{{ID: "1", Name: "one", Tags: []string{"a"}, Score: &score}, {ID: "2", Name: "two"}}
+	item := &Object{Name: "Item"}
+	item.Fields = map[string]*Field{
+		"id":    {Type: NonNull(ID)},
+		"name":  {Type: NonNull(String)},
+		"tags":  {Type: NonNull(List(NonNull(String)))},
+		"score": {Type: Float},
+		"next": {Type: item.Type(), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			if source.(testItem).ID == "1" {
+				return items[1], nil
+			}
+			return nil, nil
+		}},
+		"broken": {Type: String, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return nil, errors.New("broken")
+		}},
+		"required": {Type: NonNull(String), Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return nil, nil
+		}},
+	}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"items": {
+			Type: NonNull(List(NonNull(item.Type()))),
+			Args: map[string]*Type{"limit": Int},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				if limit, ok := args["limit"].(int); ok && limit < len(items) {
+					return items[:limit], nil
+				}
+				return items, nil
+			},
+		},
+		"item": {
+			Type: item.Type(),
+			Args: map[string]*Type{"id": NonNull(ID)},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				for _, it := range items {
+					if it.ID == args["id"] {
+						return it, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+	}}
+	return &Schema{Query: query, MaxDepth: 4}
+}
+
+func run(t *testing.T, query string, vars map[string]any) (string, []Error) {
+	t.Helper()
+	resp := testSchema().Execute(context.Background(), Request{Query: query, Variables: vars})
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data), resp.Errors
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name, query string
+		vars        map[string]any
+		want        string
+	}{
+		{"fields in query order", `{ items { name id } }`, nil, `{"items":[{"name":"one","id":"1"},{"name":"two","id":"2"}]}`},
+		{"aliases and arguments", `query { first: items(limit: 1) { id } all: items { id } }`, nil,
+			`{"first":[{"id":"1"}],"all":[{"id":"1"},{"id":"2"}]}`},
+		{"variables", `query Get($id: ID!) { item(id: $id) { name tags score } }`, map[string]any{"id": "1"},
+			`{"item":{"name":"one","tags":["a"],"score":1.5}}`},
+		{"variable defaults", `query ($n: Int = 1) { items(limit: $n) { id } }`, nil, `{"items":[{"id":"1"}]}`},
+		{"nil slices are empty lists", `{ item(id: "2") { tags score } }`, nil, `{"item":{"tags":[],"score":null}}`},
+		{"nested", `{ item(id: 1) { next { name next { name } } } }`, nil, `{"item":{"next":{"name":"two","next":null}}}`},
+		{"fragments", `{ items(limit: 1) { ...names ... on Item { id } } } fragment names on Item { name __typename }`, nil,
+			`{"items":[{"name":"one","__typename":"Item","id":"1"}]}`},
+		{"directives", `query ($yes: Boolean!) { items(limit: 1) { id @skip(if: $yes) name @include(if: $yes) } }`, map[string]any{"yes": true},
+			`{"items":[{"name":"one"}]}`},
+		{"block strings and comments", "# list\n{ item(id: \"\"\"\n    1\n  \"\"\") { id } }", nil, `{"item":{"id":"1"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := run(t, tt.query, tt.vars)
+			if len(errs) > 0 || got != tt.want {
+				t.Errorf("got %s %v, want %s", got, errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteFieldErrors(t *testing.T) {
+	got, errs := run(t, `{ items(limit: 1) { id broken } }`, nil)
+	if got != `{"items":[{"id":"1","broken":null}]}` || len(errs) != 1 || errs[0].Message != "broken" {
+		t.Errorf("resolver error: %s %v", got, errs)
+	}
+	if path, _ := json.Marshal(errs[0].Path); string(path) != `["items",0,"broken"]` {
+		t.Errorf("path = %s", path)
+	}
+
+	// A null in a non-null field nulls the nearest nullable parent; this
+	// one's parent list is non-null all the way up to data.
+	got, errs = run(t, `{ items { required } }`, nil)
+	if got != "null" || len(errs) != 1 {
+		t.Errorf("non-null violation: %s %v", got, errs)
+	}
+	got, errs = run(t, `{ item(id: "1") { id required } }`, nil)
+	if got != `{"item":null}` || len(errs) != 1 {
+		t.Errorf("non-null violation under a nullable field: %s %v", got, errs)
+	}
+}
+
+func TestExecuteRejects(t *testing.T) {
+	tests := []struct {
+		name, query string
+		vars        map[string]any
+		want        string
+	}{
+		{"syntax", `{ items { id }`, nil, "syntax error"},
+		{"unknown field", `{ items { title } }`, nil, `no field "title"`},
+		{"unknown argument", `{ items(first: 1) { id } }`, nil, `no argument "first"`},
+		{"missing argument", `{ item { id } }`, nil, `needs argument "id"`},
+		{"leaf without selection", `{ items }`, nil, "needs a selection"},
+		{"selection on a scalar", `{ items { id { x } } }`, nil, "has no fields"},
+		{"undefined variable", `{ items(limit: $n) { id } }`, nil, "$n is not defined"},
+		{"missing variable", `query ($id: ID!) { item(id: $id) { id } }`, nil, "is required"},
+		{"wrong variable type", `query ($n: Int) { items(limit: $n) { id } }`, map[string]any{"n": "x"}, "expected Int"},
+		{"mutation", `mutation { items { id } }`, nil, "not supported"},
+		{"unknown fragment", `{ items { ...nope } }`, nil, `unknown fragment "nope"`},
+		{"fragment cycle", `{ items { ...a } } fragment a on Item { ...b } fragment b on Item { ...a }`, nil, "spreads itself"},
+		{"too deep", `{ item(id: 1) { next { next { next { id } } } } }`, nil, "deeper than 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testSchema().Execute(context.Background(), Request{Query: tt.query, Variables: tt.vars})
+			if resp.Data != nil || len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, tt.want) {
+				t.Errorf("got %v %+v, want an error containing %q", resp.Data, resp.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteMaxResolves(t *testing.T) {
+	s := testSchema()
+	s.MaxResolves = 2
+	resp := s.Execute(context.Background(), Request{Query: `{ a: item(id: 1) { id } b: item(id: 1) { id } c: item(id: 1) { id } }`})
+	data, _ := json.Marshal(resp.Data)
+	if string(data) != `{"a":{"id":"1"},"b":{"id":"1"},"c":null}` || len(resp.Errors) != 1 {
+		t.Errorf("got %s %+v", data, resp.Errors)
+	}
+}
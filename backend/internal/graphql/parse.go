@@ -0,0 +1,545 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind      string
+	name      string
+	variables []*variableDefinition
+	selection []selection
+}
+
+type variableDefinition struct {
+	name       string
+	typ        *typeRef
+	defaultVal value
+}
+
+// typeRef is a type as written in a variable definition.
+type typeRef struct {
+	name    string
+	list    *typeRef
+	nonNull bool
+}
+
+type fragment struct {
+	name      string
+	typeName  string
+	selection []selection
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment.
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	args       []argument
+	directives []directive
+	selection  []selection
+	line       int
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []directive
+}
+
+type inlineFragment struct {
+	typeName   string
+	directives []directive
+	selection  []selection
+}
+
+type argument struct {
+	name string
+	val  value
+}
+
+type directive struct {
+	name string
+	args []argument
+}
+
+// value is a literal as written: nil for null, bool, string, a number
+// kept as its text, variableRef, enumValue, []value or []argument for an
+// object.
+type value interface{}
+
+type (
+	variableRef string
+	intValue    string
+	floatValue  string
+	enumValue   string
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+	tok  token
+}
+
+// SyntaxError reports where a document stops being GraphQL.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error on line %d: %s", e.Line, e.Msg)
+}
+
+func parse(src string) (doc *document, err error) {
+	p := &parser{src: src, line: 1}
+	// The parser panics with a *SyntaxError to unwind from deep inside a
+	// selection set; nothing else is recovered.
+	defer func() {
+		if r := recover(); r != nil {
+			syntax, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntax
+		}
+	}()
+	p.next()
+	doc = &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.is(tokPunct, "{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", selection: p.selectionSet()})
+		case p.is(tokName, "query"), p.is(tokName, "mutation"), p.is(tokName, "subscription"):
+			doc.operations = append(doc.operations, p.operation())
+		case p.is(tokName, "fragment"):
+			f := p.fragment()
+			if _, dup := doc.fragments[f.name]; dup {
+				p.fail("fragment %q is defined twice", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			p.fail("unexpected %q", p.tok.text)
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail("no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(&SyntaxError{Line: p.tok.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *parser) expect(text string) {
+	if !p.is(tokPunct, text) {
+		p.fail("expected %q, got %q", text, p.tok.text)
+	}
+	p.next()
+}
+
+func (p *parser) skip(text string) bool {
+	if p.is(tokPunct, text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.fail("expected a name, got %q", p.tok.text)
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+func (p *parser) operation() *operation {
+	op := &operation{kind: p.name()}
+	if p.tok.kind == tokName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			def := &variableDefinition{name: p.name()}
+			p.expect(":")
+			def.typ = p.typeRef()
+			if p.skip("=") {
+				def.defaultVal = p.value(true)
+			}
+			op.variables = append(op.variables, def)
+		}
+	}
+	p.directives()
+	op.selection = p.selectionSet()
+	return op
+}
+
+func (p *parser) fragment() *fragment {
+	p.next()
+	f := &fragment{name: p.name()}
+	if f.name == "on" {
+		p.fail("a fragment cannot be named on")
+	}
+	if p.name() != "on" {
+		p.fail("expected on")
+	}
+	f.typeName = p.name()
+	p.directives()
+	f.selection = p.selectionSet()
+	return f
+}
+
+func (p *parser) typeRef() *typeRef {
+	var t *typeRef
+	if p.skip("[") {
+		t = &typeRef{list: p.typeRef()}
+		p.expect("]")
+	} else {
+		t = &typeRef{name: p.name()}
+	}
+	t.nonNull = p.skip("!")
+	return t
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect("{")
+	var set []selection
+	for !p.skip("}") {
+		if p.tok.kind == tokEOF {
+			p.fail("unterminated selection set")
+		}
+		if p.skip("...") {
+			if p.tok.kind == tokName && p.tok.text != "on" {
+				set = append(set, &fragmentSpread{name: p.name(), directives: p.directives()})
+				continue
+			}
+			frag := &inlineFragment{}
+			if p.is(tokName, "on") {
+				p.next()
+				frag.typeName = p.name()
+			}
+			frag.directives = p.directives()
+			frag.selection = p.selectionSet()
+			set = append(set, frag)
+			continue
+		}
+		f := &field{line: p.tok.line, name: p.name()}
+		if p.skip(":") {
+			f.alias, f.name = f.name, p.name()
+		}
+		f.args = p.arguments(false)
+		f.directives = p.directives()
+		if p.is(tokPunct, "{") {
+			f.selection = p.selectionSet()
+		}
+		set = append(set, f)
+	}
+	if len(set) == 0 {
+		p.fail("empty selection set")
+	}
+	return set
+}
+
+func (p *parser) arguments(constant bool) []argument {
+	if !p.skip("(") {
+		return nil
+	}
+	var args []argument
+	for !p.skip(")") {
+		arg := argument{name: p.name()}
+		p.expect(":")
+		arg.val = p.value(constant)
+		args = append(args, arg)
+	}
+	return args
+}
+
+func (p *parser) directives() []directive {
+	var list []directive
+	for p.skip("@") {
+		list = append(list, directive{name: p.name(), args: p.arguments(false)})
+	}
+	return list
+}
+
+// value parses a literal; constant ones, such as variable defaults, may not
+// refer to variables.
+func (p *parser) value(constant bool) value {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		p.next()
+		return intValue(tok.text)
+	case tokFloat:
+		p.next()
+		return floatValue(tok.text)
+	case tokString:
+		p.next()
+		return tok.text
+	case tokName:
+		p.next()
+		switch tok.text {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return enumValue(tok.text)
+	case tokPunct:
+		switch tok.text {
+		case "$":
+			if constant {
+				p.fail("variables are not allowed here")
+			}
+			p.next()
+			return variableRef(p.name())
+		case "[":
+			p.next()
+			list := []value{}
+			for !p.skip("]") {
+				list = append(list, p.value(constant))
+			}
+			return list
+		case "{":
+			p.next()
+			obj := []argument{}
+			for !p.skip("}") {
+				arg := argument{name: p.name()}
+				p.expect(":")
+				arg.val = p.value(constant)
+				obj = append(obj, arg)
+			}
+			return obj
+		}
+	}
+	p.fail("expected a value, got %q", tok.text)
+	return nil
+}
+
+// next reads the next token, skipping whitespace, commas and comments.
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\ufeff"):
+			p.pos += len("\ufeff")
+		default:
+			p.tok = p.lex()
+			return
+		}
+	}
+	p.tok = token{kind: tokEOF, text: "<end>", line: p.line}
+}
+
+func (p *parser) lex() token {
+	start := p.pos
+	c := p.src[p.pos]
+	tok := token{line: p.line}
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		tok.kind, tok.text = tokPunct, "..."
+	case strings.ContainsRune("!$&()[]{}:=@|", rune(c)):
+		p.pos++
+		tok.kind, tok.text = tokPunct, string(c)
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		tok.kind, tok.text = tokName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		tok.kind, tok.text = p.number()
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		tok.kind, tok.text = tokString, p.blockString()
+	case c == '"':
+		tok.kind, tok.text = tokString, p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.tok = tok
+		p.fail("unexpected character %q", r)
+	}
+	return tok
+}
+
+func (p *parser) number() (tokenKind, string) {
+	start := p.pos
+	kind := tokInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		from := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == from {
+			p.tok = token{line: p.line, text: p.src[start:p.pos]}
+			p.fail("malformed number")
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokFloat
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	return kind, p.src[start:p.pos]
+}
+
+func (p *parser) string() string {
+	var b strings.Builder
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.tok = token{line: p.line}
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String()
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				p.tok = token{line: p.line}
+				p.fail("unterminated string")
+			}
+			esc := p.src[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.tok = token{line: p.line}
+					p.fail("bad unicode escape")
+				}
+				code, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.tok = token{line: p.line}
+					p.fail("bad unicode escape")
+				}
+				b.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				p.tok = token{line: p.line}
+				p.fail("bad escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// blockString reads a """ string, stripping the indentation its lines
+// share and the blank lines around it, as the spec does.
+func (p *parser) blockString() string {
+	p.pos += 3
+	end := strings.Index(p.src[p.pos:], `"""`)
+	for end > 0 && p.src[p.pos+end-1] == '\\' {
+		next := strings.Index(p.src[p.pos+end+3:], `"""`)
+		if next < 0 {
+			end = -1
+			break
+		}
+		end += 3 + next
+	}
+	if end < 0 {
+		p.tok = token{line: p.line}
+		p.fail("unterminated block string")
+	}
+	raw := strings.ReplaceAll(p.src[p.pos:p.pos+end], `\"""`, `"""`)
+	p.line += strings.Count(raw, "\n")
+	p.pos += end + 3
+
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed != "" && (indent < 0 || len(l)-len(trimmed) < indent) {
+			indent = len(l) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,576 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// piece is a stretch of inline output: either finished HTML or a run of
+// emphasis delimiters that may still turn into tags.
+type piece struct {
+	text string
+
+	delim               byte
+	count, orig         int
+	canOpen, canClose   bool
+	active              bool
+	openTags, closeTags string
+}
+
+// bracket is an opening [ or ![ that a later ] may turn into a link.
+type bracket struct {
+	piece  int // index of the piece holding the bracket
+	pos    int // offset in the source just after it
+	image  bool
+	active bool
+}
+
+type inlineParser struct {
+	d        *doc
+	src      string
+	pieces   []*piece
+	brackets []bracket
+	buf      strings.Builder
+
+	// noCloser remembers, per backtick run length or title quote, from
+	// where on a search for the closing one has already failed, which keeps
+	// hostile input from taking quadratic time.
+	noCloser map[int]int
+}
+
+func (d *doc) inline(src string) string {
+	p := &inlineParser{d: d, src: src, noCloser: make(map[int]int)}
+	p.parse()
+	p.emphasis(0)
+	return render(p.pieces)
+}
+
+func (p *inlineParser) parse() {
+	s := p.src
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '\\':
+			switch {
+			case i+1 < len(s) && s[i+1] == '\n':
+				p.trimTrailingSpaces()
+				p.buf.WriteString("<br>\n")
+				i = skipSpaces(s, i+2)
+			case i+1 < len(s) && isASCIIPunct(s[i+1]):
+				p.buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+			default:
+				p.buf.WriteByte('\\')
+				i++
+			}
+		case '`':
+			i = p.codeSpan(i)
+		case '*', '_', '~':
+			n := runLength(s, i)
+			if c == '~' && (!p.d.opts.GFM || n > 2) {
+				p.buf.WriteString(s[i : i+n])
+			} else {
+				p.delimiter(i, n)
+			}
+			i += n
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				p.openBracket("![", i+2, true)
+				i += 2
+			} else {
+				p.buf.WriteByte('!')
+				i++
+			}
+		case '[':
+			p.openBracket("[", i+1, false)
+			i++
+		case ']':
+			i = p.closeBracket(i)
+		case '<':
+			i = p.autolink(i)
+		case '&':
+			if m := entityRe.FindString(s[i:]); m != "" && (m[1] == '#' || html.UnescapeString(m) != m) {
+				p.buf.WriteString(m)
+				i += len(m)
+			} else {
+				p.buf.WriteString("&amp;")
+				i++
+			}
+		case '\n':
+			hard := p.trimTrailingSpaces() >= 2 || p.d.opts.HardWraps
+			if hard {
+				p.buf.WriteString("<br>\n")
+			} else {
+				p.buf.WriteByte('\n')
+			}
+			i = skipSpaces(s, i+1)
+		default:
+			if n := p.bareURL(i); n > 0 {
+				i += n
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			p.buf.WriteString(html.EscapeString(s[i : i+size]))
+			i += size
+		}
+	}
+	p.flush()
+}
+
+func (p *inlineParser) flush() {
+	if p.buf.Len() > 0 {
+		p.pieces = append(p.pieces, &piece{text: p.buf.String()})
+		p.buf.Reset()
+	}
+}
+
+func (p *inlineParser) push(pc *piece) {
+	p.flush()
+	p.pieces = append(p.pieces, pc)
+}
+
+// trimTrailingSpaces drops the spaces before a line break and returns how
+// many there were.
+func (p *inlineParser) trimTrailingSpaces() int {
+	text := p.buf.String()
+	trimmed := strings.TrimRight(text, " ")
+	if len(trimmed) != len(text) {
+		p.buf.Reset()
+		p.buf.WriteString(trimmed)
+	}
+	return len(text) - len(trimmed)
+}
+
+func (p *inlineParser) codeSpan(i int) int {
+	s := p.src
+	n := runLength(s, i)
+	for j := i + n; j < len(s) && !p.failedBefore(n, j); {
+		k := strings.IndexByte(s[j:], '`')
+		if k < 0 {
+			break
+		}
+		j += k
+		if m := runLength(s, j); m != n {
+			j += m
+			continue
+		}
+		code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+		if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		p.buf.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return j + n
+	}
+	p.failed(n, i+n)
+	p.buf.WriteString(s[i : i+n])
+	return i + n
+}
+
+// delimiter records a run of *, _ or ~ with whether it can open or close
+// emphasis, going by the characters on either side of it.
+func (p *inlineParser) delimiter(i, n int) {
+	s := p.src
+	c := s[i]
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if i+n < len(s) {
+		after, _ = utf8.DecodeRuneInString(s[i+n:])
+	}
+	left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+
+	pc := &piece{delim: c, count: n, orig: n, active: true, canOpen: left, canClose: right}
+	if c == '_' {
+		pc.canOpen = left && (!right || isPunct(before))
+		pc.canClose = right && (!left || isPunct(after))
+	}
+	p.push(pc)
+}
+
+// emphasis pairs up the delimiter runs from piece from onwards, following
+// the CommonMark rules, and leaves them all inactive.
+func (p *inlineParser) emphasis(from int) {
+	type key struct {
+		delim byte
+		open  bool
+		mod   int
+	}
+	bottom := make(map[key]int)
+
+	for c := from; c < len(p.pieces); c++ {
+		closer := p.pieces[c]
+		if closer.delim == 0 || !closer.active || !closer.canClose {
+			continue
+		}
+		for closer.count > 0 {
+			k := key{closer.delim, closer.canOpen, closer.orig % 3}
+			lo := max(from, bottom[k])
+			o := -1
+			for j := c - 1; j >= lo; j-- {
+				opener := p.pieces[j]
+				if opener.delim != closer.delim || !opener.active || !opener.canOpen || opener.count == 0 {
+					continue
+				}
+				if closer.delim == '~' && opener.count != closer.count {
+					continue
+				}
+				if closer.delim != '~' && (opener.canClose || closer.canOpen) &&
+					(opener.orig+closer.orig)%3 == 0 && (opener.orig%3 != 0 || closer.orig%3 != 0) {
+					continue
+				}
+				o = j
+				break
+			}
+			if o < 0 {
+				bottom[k] = c
+				break
+			}
+
+			opener := p.pieces[o]
+			use, tag := 1, "em"
+			switch {
+			case closer.delim == '~':
+				use, tag = closer.count, "del"
+			case opener.count >= 2 && closer.count >= 2:
+				use, tag = 2, "strong"
+			}
+			opener.openTags = "<" + tag + ">" + opener.openTags
+			closer.closeTags += "</" + tag + ">"
+			opener.count -= use
+			closer.count -= use
+			for j := o + 1; j < c; j++ {
+				p.pieces[j].active = false
+			}
+		}
+	}
+	for _, pc := range p.pieces[from:] {
+		pc.active = false
+	}
+}
+
+func render(pieces []*piece) string {
+	var b strings.Builder
+	for _, pc := range pieces {
+		if pc.delim == 0 {
+			b.WriteString(pc.text)
+			continue
+		}
+		b.WriteString(pc.closeTags)
+		b.WriteString(strings.Repeat(string(pc.delim), pc.count))
+		b.WriteString(pc.openTags)
+	}
+	return b.String()
+}
+
+func (p *inlineParser) openBracket(text string, pos int, image bool) {
+	p.push(&piece{text: text})
+	p.brackets = append(p.brackets, bracket{piece: len(p.pieces) - 1, pos: pos, image: image, active: true})
+}
+
+// closeBracket handles the ] at i, turning it and the last open bracket
+// into a link or image when a destination follows, and returns where to
+// carry on.
+func (p *inlineParser) closeBracket(i int) int {
+	if len(p.brackets) == 0 {
+		p.buf.WriteByte(']')
+		return i + 1
+	}
+	open := p.brackets[len(p.brackets)-1]
+	p.brackets = p.brackets[:len(p.brackets)-1]
+	if !open.active {
+		p.buf.WriteByte(']')
+		return i + 1
+	}
+	dest, title, end, ok := p.linkTail(i+1, p.src[open.pos:i])
+	if !ok {
+		p.buf.WriteByte(']')
+		return i + 1
+	}
+
+	p.flush()
+	p.emphasis(open.piece + 1)
+	if open.image {
+		alt := stripTags(render(p.pieces[open.piece+1:]))
+		p.pieces = p.pieces[:open.piece]
+		if u, ok := safeURL(dest, true); ok {
+			p.push(&piece{text: `<img src="` + html.EscapeString(u) + `" alt="` + alt + `"` + titleAttr(title) + ">"})
+		} else {
+			p.push(&piece{text: alt})
+		}
+		return end
+	}
+
+	// Links cannot contain other links.
+	for j := range p.brackets {
+		if !p.brackets[j].image {
+			p.brackets[j].active = false
+		}
+	}
+	if u, ok := safeURL(dest, false); ok {
+		p.pieces[open.piece].text = `<a href="` + html.EscapeString(u) + `"` + titleAttr(title) + ">"
+		p.push(&piece{text: "</a>"})
+	} else {
+		p.pieces[open.piece].text = ""
+	}
+	return end
+}
+
+// linkTail parses what follows the ] of a link at i: an inline destination
+// and title, a [reference], or nothing for a shortcut to a definition
+// labelled by label.
+func (p *inlineParser) linkTail(i int, label string) (dest, title string, end int, ok bool) {
+	s := p.src
+	if i < len(s) && s[i] == '(' {
+		if dest, title, end, ok := p.inlineDest(i + 1); ok {
+			return dest, title, end, true
+		}
+	}
+	end = i
+	if i < len(s) && s[i] == '[' {
+		if k := strings.IndexAny(s[i+1:], "[]"); k >= 0 && s[i+1+k] == ']' {
+			if k > 0 {
+				label = s[i+1 : i+1+k]
+			}
+			end = i + 1 + k + 1
+		}
+	}
+	r, ok := p.d.refs[normalizeLabel(label)]
+	if !ok || strings.TrimSpace(label) == "" {
+		return "", "", 0, false
+	}
+	return r.url, r.title, end, true
+}
+
+// maxParens is how deeply parentheses may nest in a link destination.
+const maxParens = 32
+
+// inlineDest parses `dest "title")` starting just after the (.
+func (p *inlineParser) inlineDest(i int) (dest, title string, end int, ok bool) {
+	s := p.src
+	i = skipSpace(s, i)
+	if i < len(s) && s[i] == '<' {
+		k := strings.IndexAny(s[i+1:], "<>\n")
+		if k < 0 || s[i+1+k] != '>' {
+			return "", "", 0, false
+		}
+		dest = s[i+1 : i+1+k]
+		i += k + 2
+	} else {
+		start, depth := i, 0
+	scan:
+		for ; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+				i++
+			case c <= ' ':
+				break scan
+			case c == '(':
+				if depth++; depth > maxParens {
+					return "", "", 0, false
+				}
+			case c == ')':
+				if depth == 0 {
+					break scan
+				}
+				depth--
+			}
+		}
+		if depth != 0 {
+			return "", "", 0, false
+		}
+		dest = s[start:i]
+	}
+
+	j := skipSpace(s, i)
+	if j > i && j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closing := s[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		k := j + 1
+		for ; k < len(s) && s[k] != closing && !p.failedBefore(-int(closing), k); k++ {
+			if s[k] == '\\' {
+				k++
+			}
+		}
+		if k >= len(s) || s[k] != closing {
+			p.failed(-int(closing), j+1)
+			return "", "", 0, false
+		}
+		title = s[j+1 : k]
+		j = skipSpace(s, k+1)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return "", "", 0, false
+	}
+	return dest, title, j + 1, true
+}
+
+func (p *inlineParser) failed(closer, from int) {
+	if prev, ok := p.noCloser[closer]; !ok || from < prev {
+		p.noCloser[closer] = from
+	}
+}
+
+// failedBefore reports whether a search for closer that got to i has been
+// seen to fail from an earlier start.
+func (p *inlineParser) failedBefore(closer, i int) bool {
+	from, ok := p.noCloser[closer]
+	return ok && from <= i
+}
+
+func (p *inlineParser) autolink(i int) int {
+	s := p.src
+	if m := autolinkRe.FindStringSubmatch(s[i:]); m != nil {
+		if u, ok := safeURL(m[1], false); ok {
+			p.buf.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(m[1]) + "</a>")
+			return i + len(m[0])
+		}
+	}
+	if m := emailLinkRe.FindStringSubmatch(s[i:]); m != nil {
+		p.buf.WriteString(`<a href="mailto:` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+		return i + len(m[0])
+	}
+	p.buf.WriteString("&lt;")
+	return i + 1
+}
+
+// bareURL links a URL or www. address at i that is not part of a word, as
+// GFM does, and returns its length or 0.
+func (p *inlineParser) bareURL(i int) int {
+	s := p.src
+	if !p.d.opts.GFM || (s[i] != 'h' && s[i] != 'w') {
+		return 0
+	}
+	if i > 0 && !strings.ContainsRune(" \t\n*_~(", rune(s[i-1])) {
+		return 0
+	}
+	for _, open := range p.brackets {
+		if open.active && !open.image {
+			return 0
+		}
+	}
+	m := bareURLRe.FindString(s[i:])
+	for m != "" {
+		last := m[len(m)-1]
+		if strings.IndexByte("?!.,:*_~'\"", last) >= 0 ||
+			(last == ')' && strings.Count(m, ")") > strings.Count(m, "(")) {
+			m = m[:len(m)-1]
+			continue
+		}
+		break
+	}
+	if m == "" || m == "www." || strings.HasSuffix(m, "://") {
+		return 0
+	}
+	href := m
+	if strings.HasPrefix(m, "www.") {
+		href = "http://" + m
+	}
+	p.buf.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(m) + "</a>")
+	return len(m)
+}
+
+var (
+	linkSchemes  = []string{"http", "https", "mailto", "tel"}
+	imageSchemes = []string{"http", "https"}
+)
+
+// safeURL decodes a link destination and reports whether it is relative or
+// uses one of the allowed schemes. Anything else, javascript: and data:
+// among them, is refused rather than cleaned up.
+func safeURL(raw string, image bool) (string, bool) {
+	u := strings.TrimSpace(html.UnescapeString(unescapePunct(raw)))
+	if i := strings.IndexAny(u, ":/?#"); i >= 0 && u[i] == ':' {
+		schemes := linkSchemes
+		if image {
+			schemes = imageSchemes
+		}
+		scheme := strings.ToLower(u[:i])
+		allowed := false
+		for _, s := range schemes {
+			allowed = allowed || s == scheme
+		}
+		if !allowed {
+			return "", false
+		}
+	}
+	return strings.ReplaceAll(u, " ", "%20"), true
+}
+
+func titleAttr(title string) string {
+	if title == "" {
+		return ""
+	}
+	return ` title="` + html.EscapeString(html.UnescapeString(unescapePunct(title))) + `"`
+}
+
+// stripTags reduces rendered inline HTML to its text, for alt attributes.
+// The text is still escaped.
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '<':
+			inTag = true
+		case s[i] == '>':
+			inTag = false
+		case !inTag && s[i] == '\n':
+			b.WriteByte(' ')
+		case !inTag:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func unescapePunct(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// skipSpace skips spaces, tabs and at most one line break.
+func skipSpace(s string, i int) int {
+	newline := false
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || (s[i] == '\n' && !newline)) {
+		newline = newline || s[i] == '\n'
+		i++
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
@@ -0,0 +1,509 @@
+// Package markdown renders note content to HTML that is safe to embed. Raw
+// HTML in the source is always escaped rather than passed through, and link
+// and image URLs are limited to a few schemes, so the output needs no
+// separate sanitizing pass.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options picks the dialect.
+type Options struct {
+	// GFM enables the GitHub extensions: tables, strikethrough, task list
+	// items and bare URLs as links. Without it the renderer sticks to
+	// CommonMark.
+	GFM bool
+	// HardWraps renders every line break inside a paragraph as <br>, the
+	// way most note apps show them.
+	HardWraps bool
+}
+
+type Renderer struct {
+	opts Options
+}
+
+func New(opts Options) *Renderer {
+	return &Renderer{opts: opts}
+}
+
+// Render converts src to an HTML fragment.
+func (r *Renderer) Render(src string) string {
+	src = strings.ReplaceAll(strings.ReplaceAll(src, "\r\n", "\n"), "\r", "\n")
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	d := &doc{opts: r.opts, refs: collectRefs(lines)}
+	var b strings.Builder
+	d.blocks(&b, lines, false)
+	return b.String()
+}
+
+// maxNesting bounds how deep quotes and lists nest, so that hostile input
+// cannot recurse without limit; deeper markers are left as text.
+const maxNesting = 32
+
+type doc struct {
+	opts  Options
+	refs  map[string]ref
+	depth int
+}
+
+type ref struct {
+	url, title string
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*))?$`)
+	hrRe        = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceRe     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	quoteRe     = regexp.MustCompile(`^ {0,3}> ?`)
+	itemRe      = regexp.MustCompile(`^( {0,3})([-+*]|\d{1,9}[.)])( +|$)`)
+	setextRe    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	refDefRe    = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:[ \t]*(<[^>]*>|\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	tableSepRe  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	entityRe    = regexp.MustCompile(`^&(?:[a-zA-Z][a-zA-Z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6});`)
+	autolinkRe  = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailLinkRe = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	bareURLRe   = regexp.MustCompile(`^(?:https?://|www\.)[^\s<]+`)
+)
+
+// collectRefs finds the link reference definitions outside code fences, so
+// that links can use them before they appear.
+func collectRefs(lines []string) map[string]ref {
+	refs := make(map[string]ref)
+	fence := ""
+	inParagraph := false
+	for _, line := range lines {
+		if fence != "" {
+			if closesFence(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(line); m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`")) {
+			fence = m[2]
+			continue
+		}
+		if m := refDefRe.FindStringSubmatch(line); m != nil && !inParagraph {
+			label := normalizeLabel(m[1])
+			if _, ok := refs[label]; !ok {
+				title := ""
+				if len(m[3]) >= 2 {
+					title = m[3][1 : len(m[3])-1]
+				}
+				refs[label] = ref{url: strings.Trim(m[2], "<>"), title: title}
+			}
+			continue
+		}
+		inParagraph = !isBlank(line) && !headingRe.MatchString(line) && !hrRe.MatchString(line)
+	}
+	return refs
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// blocks renders a run of lines. In a tight list item, paragraphs are
+// written without <p>.
+func (d *doc) blocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRe.MatchString(line) && d.fence(b, lines, &i):
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + d.inline(headingText(m[2])) + "</h" + level + ">\n")
+			i++
+		case hrRe.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case d.depth < maxNesting && quoteRe.MatchString(line):
+			d.depth++
+			d.quote(b, lines, &i)
+			d.depth--
+		case d.depth < maxNesting && itemRe.MatchString(line):
+			d.depth++
+			d.list(b, lines, &i)
+			d.depth--
+		case indent(line) >= 4:
+			d.indentedCode(b, lines, &i)
+		case refDefRe.MatchString(line):
+			i++
+		case d.opts.GFM && i+1 < len(lines) && d.table(b, lines, &i):
+		default:
+			d.paragraph(b, lines, &i, tight)
+		}
+	}
+}
+
+func (d *doc) fence(b *strings.Builder, lines []string, i *int) bool {
+	m := fenceRe.FindStringSubmatch(lines[*i])
+	marker, info := m[2], strings.TrimSpace(m[3])
+	if marker[0] == '`' && strings.Contains(info, "`") {
+		return false
+	}
+	pad := len(m[1])
+	*i++
+	var code []string
+	for ; *i < len(lines); *i++ {
+		if closesFence(lines[*i], marker) {
+			*i++
+			break
+		}
+		code = append(code, trimIndent(lines[*i], pad))
+	}
+
+	b.WriteString("<pre><code")
+	if lang, _, _ := strings.Cut(info, " "); lang != "" {
+		b.WriteString(` class="language-` + html.EscapeString(unescapePunct(lang)) + `"`)
+	}
+	b.WriteString(">")
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return true
+}
+
+func closesFence(line, marker string) bool {
+	trimmed := strings.TrimRight(line, " \t")
+	if indent(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimLeft(trimmed, " ")
+	return len(trimmed) >= len(marker) && strings.Trim(trimmed, marker[:1]) == ""
+}
+
+// headingText drops an ATX heading's closing run of #s.
+func headingText(text string) string {
+	text = strings.TrimSpace(text)
+	stripped := strings.TrimRight(text, "#")
+	if stripped == "" || strings.HasSuffix(stripped, " ") || strings.HasSuffix(stripped, "\t") {
+		return strings.TrimSpace(stripped)
+	}
+	return text
+}
+
+func (d *doc) quote(b *strings.Builder, lines []string, i *int) {
+	var inner []string
+	for *i < len(lines) {
+		line := lines[*i]
+		if loc := quoteRe.FindStringIndex(line); loc != nil {
+			inner = append(inner, line[loc[1]:])
+		} else if !isBlank(line) && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !d.startsBlock(line) {
+			// A lazy continuation of the quoted paragraph.
+			inner = append(inner, line)
+		} else {
+			break
+		}
+		*i++
+	}
+	b.WriteString("<blockquote>\n")
+	d.blocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+}
+
+type listItem struct {
+	lines []string
+}
+
+func (d *doc) list(b *strings.Builder, lines []string, i *int) {
+	first := itemRe.FindStringSubmatch(lines[*i])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+	kind := first[2][len(first[2])-1:]
+
+	var (
+		items []listItem
+		loose bool
+	)
+	for *i < len(lines) {
+		m := itemRe.FindStringSubmatch(lines[*i])
+		if m == nil || m[2][len(m[2])-1:] != kind || hrRe.MatchString(lines[*i]) {
+			break
+		}
+		width := len(m[1]) + len(m[2]) + len(m[3])
+		if len(m[3]) > 4 {
+			width = len(m[1]) + len(m[2]) + 1
+		} else if m[3] == "" {
+			width++
+		}
+		item := listItem{lines: []string{lines[*i][min(width, len(lines[*i])):]}}
+		*i++
+
+		blank := false
+	body:
+		for ; *i < len(lines); *i++ {
+			line := lines[*i]
+			switch {
+			case isBlank(line):
+				blank = true
+				item.lines = append(item.lines, "")
+			case indent(line) >= width:
+				if blank && len(item.lines) > 1 {
+					loose = true
+				}
+				blank = false
+				item.lines = append(item.lines, trimIndent(line, width))
+			case itemRe.MatchString(line) || hrRe.MatchString(line):
+				break body
+			case !blank && !d.startsBlock(line):
+				item.lines = append(item.lines, strings.TrimLeft(line, " "))
+			default:
+				break body
+			}
+		}
+		for len(item.lines) > 0 && isBlank(item.lines[len(item.lines)-1]) {
+			item.lines = item.lines[:len(item.lines)-1]
+		}
+		items = append(items, item)
+		if blank && *i < len(lines) {
+			if m := itemRe.FindStringSubmatch(lines[*i]); m != nil && m[2][len(m[2])-1:] == kind {
+				loose = true
+			}
+		}
+	}
+
+	start, _ := strconv.Atoi(first[2][:len(first[2])-1])
+	switch {
+	case !ordered:
+		b.WriteString("<ul>\n")
+	case start != 1:
+		b.WriteString(`<ol start="` + strconv.Itoa(start) + `">` + "\n")
+	default:
+		b.WriteString("<ol>\n")
+	}
+	for _, item := range items {
+		b.WriteString("<li>")
+		if d.opts.GFM && len(item.lines) > 0 {
+			if rest, ok := strings.CutPrefix(item.lines[0], "[ ] "); ok {
+				b.WriteString(`<input type="checkbox" disabled> `)
+				item.lines[0] = rest
+			} else if rest, ok := cutCheckedBox(item.lines[0]); ok {
+				b.WriteString(`<input type="checkbox" checked disabled> `)
+				item.lines[0] = rest
+			}
+		}
+		var inner strings.Builder
+		d.blocks(&inner, item.lines, !loose)
+		content := inner.String()
+		if !loose {
+			content = strings.TrimSuffix(content, "\n")
+		}
+		if startsWithBlock(content) {
+			b.WriteString("\n")
+		}
+		b.WriteString(content)
+		b.WriteString("</li>\n")
+	}
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+}
+
+var blockTags = []string{"<p>", "<h1>", "<h2>", "<h3>", "<h4>", "<h5>", "<h6>", "<hr>", "<pre>", "<blockquote>", "<ul>", "<ol", "<table>"}
+
+func startsWithBlock(content string) bool {
+	for _, tag := range blockTags {
+		if strings.HasPrefix(content, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func cutCheckedBox(line string) (string, bool) {
+	if rest, ok := strings.CutPrefix(line, "[x] "); ok {
+		return rest, true
+	}
+	return strings.CutPrefix(line, "[X] ")
+}
+
+func (d *doc) indentedCode(b *strings.Builder, lines []string, i *int) {
+	var code []string
+	for ; *i < len(lines) && (isBlank(lines[*i]) || indent(lines[*i]) >= 4); *i++ {
+		code = append(code, trimIndent(lines[*i], 4))
+	}
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	b.WriteString("<pre><code>")
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+}
+
+// table renders a GFM table if lines[*i] is a header row followed by a
+// delimiter row with as many cells.
+func (d *doc) table(b *strings.Builder, lines []string, i *int) bool {
+	if !strings.Contains(lines[*i], "|") || !tableSepRe.MatchString(lines[*i+1]) {
+		return false
+	}
+	header := splitRow(lines[*i])
+	seps := splitRow(lines[*i+1])
+	if len(header) != len(seps) {
+		return false
+	}
+	aligns := make([]string, len(seps))
+	for j, sep := range seps {
+		sep = strings.TrimSpace(sep)
+		switch left, right := strings.HasPrefix(sep, ":"), strings.HasSuffix(sep, ":"); {
+		case left && right:
+			aligns[j] = ` style="text-align: center"`
+		case left:
+			aligns[j] = ` style="text-align: left"`
+		case right:
+			aligns[j] = ` style="text-align: right"`
+		}
+	}
+	*i += 2
+
+	b.WriteString("<table>\n<thead>\n<tr>\n")
+	for j, cell := range header {
+		b.WriteString("<th" + aligns[j] + ">" + d.inline(strings.TrimSpace(cell)) + "</th>\n")
+	}
+	b.WriteString("</tr>\n</thead>\n")
+	body := false
+	for ; *i < len(lines) && !isBlank(lines[*i]) && !d.startsBlock(lines[*i]); *i++ {
+		if !body {
+			b.WriteString("<tbody>\n")
+			body = true
+		}
+		cells := splitRow(lines[*i])
+		b.WriteString("<tr>\n")
+		for j := range header {
+			cell := ""
+			if j < len(cells) {
+				cell = strings.TrimSpace(cells[j])
+			}
+			b.WriteString("<td" + aligns[j] + ">" + d.inline(cell) + "</td>\n")
+		}
+		b.WriteString("</tr>\n")
+	}
+	if body {
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return true
+}
+
+// splitRow splits a table row on the pipes that are not escaped.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+	for j := 0; j < len(line); j++ {
+		switch {
+		case line[j] == '\\' && j+1 < len(line) && line[j+1] == '|':
+			cell.WriteByte('|')
+			j++
+		case line[j] == '|':
+			cells = append(cells, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteByte(line[j])
+		}
+	}
+	return append(cells, cell.String())
+}
+
+func (d *doc) paragraph(b *strings.Builder, lines []string, i *int, tight bool) {
+	text := []string{strings.TrimLeft(lines[*i], " ")}
+	*i++
+	for ; *i < len(lines); *i++ {
+		line := lines[*i]
+		if m := setextRe.FindStringSubmatch(line); m != nil {
+			level := "2"
+			if m[1][0] == '=' {
+				level = "1"
+			}
+			*i++
+			b.WriteString("<h" + level + ">" + d.inline(strings.Join(text, "\n")) + "</h" + level + ">\n")
+			return
+		}
+		if isBlank(line) || d.startsBlock(line) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	content := d.inline(strings.TrimRight(strings.Join(text, "\n"), " \t"))
+	if tight {
+		b.WriteString(content + "\n")
+		return
+	}
+	b.WriteString("<p>" + content + "</p>\n")
+}
+
+// startsBlock reports whether line interrupts a paragraph. Only lists that
+// start at 1 and have content do, so that numbers and dashes in running
+// text stay text.
+func (d *doc) startsBlock(line string) bool {
+	if headingRe.MatchString(line) || hrRe.MatchString(line) || quoteRe.MatchString(line) {
+		return true
+	}
+	if m := fenceRe.FindStringSubmatch(line); m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`")) {
+		return true
+	}
+	m := itemRe.FindStringSubmatch(line)
+	if m == nil || isBlank(line[len(m[0]):]) {
+		return false
+	}
+	marker := m[2]
+	return !(marker[0] >= '0' && marker[0] <= '9') || marker[:len(marker)-1] == "1"
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimIndent removes up to n leading spaces.
+func trimIndent(line string, n int) string {
+	return line[min(n, indent(line)):]
+}
+
+// expandTabs turns the tabs in a line's indentation into spaces up to the
+// next multiple of four, which is what block structure is measured in.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for j, c := range line {
+		switch c {
+		case ' ':
+			b.WriteByte(' ')
+			col++
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		default:
+			b.WriteString(line[j:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
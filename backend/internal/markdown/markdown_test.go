@@ -0,0 +1,173 @@
+package markdown
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	gfm := New(Options{GFM: true})
+	tests := []struct {
+		name, src, want string
+	}{
+		{"heading", "## Plan *now* ##", "<h2>Plan <em>now</em></h2>\n"},
+		{"setext", "Title\n===\n", "<h1>Title</h1>\n"},
+		{"hashtag is text", "#todo later", "<p>#todo later</p>\n"},
+		{"emphasis", "**bold** _em_ ***both***", "<p><strong>bold</strong> <em>em</em> <em><strong>both</strong></em></p>\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"code span", "run `a <b>` now", "<p>run <code>a &lt;b&gt;</code> now</p>\n"},
+		{"fenced code", "```go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}\n</code></pre>\n"},
+		{"indented code", "    x := 1\n", "<pre><code>x := 1\n</code></pre>\n"},
+		{"quote", "> cited\nlazy", "<blockquote>\n<p>cited\nlazy</p>\n</blockquote>\n"},
+		{"tight list", "- a\n- b\n  - c", "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>c</li>\n</ul></li>\n</ul>\n"},
+		{"ordered start", "3. c\n4. d", "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ul>\n"},
+		{"number in text", "in\n2024. it rained", "<p>in\n2024. it rained</p>\n"},
+		{"task list", "- [x] done\n- [ ] open", "<ul>\n<li><input type=\"checkbox\" checked disabled> done</li>\n<li><input type=\"checkbox\" disabled> open</li>\n</ul>\n"},
+		{"hr", "a\n\n***", "<p>a</p>\n<hr>\n"},
+		{"table", "| a | b |\n|--:|:-:|\n| 1 | 2 \\| 3 |", "<table>\n<thead>\n<tr>\n<th style=\"text-align: right\">a</th>\n<th style=\"text-align: center\">b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td style=\"text-align: right\">1</td>\n<td style=\"text-align: center\">2 | 3</td>\n</tr>\n</tbody>\n</table>\n"},
+		{"strikethrough", "~~gone~~", "<p><del>gone</del></p>\n"},
+		{"link", `[docs](https://go.dev/doc "Go")`, "<p><a href=\"https://go.dev/doc\" title=\"Go\">docs</a></p>\n"},
+		{"reference link", "[Docs] and [x][docs]\n\n[docs]: /help", "<p><a href=\"/help\">Docs</a> and <a href=\"/help\">x</a></p>\n"},
+		{"image", "![a *cat*](cat.png)", "<p><img src=\"cat.png\" alt=\"a cat\"></p>\n"},
+		{"autolink", "<https://example.com/a?b=1&c=2>", "<p><a href=\"https://example.com/a?b=1&amp;c=2\">https://example.com/a?b=1&amp;c=2</a></p>\n"},
+		{"email autolink", "<me@example.com>", "<p><a href=\"mailto:me@example.com\">me@example.com</a></p>\n"},
+		{"bare url", "see https://go.dev/x. or www.example.com", "<p>see <a href=\"https://go.dev/x\">https://go.dev/x</a>. or <a href=\"http://www.example.com\">www.example.com</a></p>\n"},
+		{"entities", "&copy; & &nope; &#35;", "<p>&copy; &amp; &amp;nope; &#35;</p>\n"},
+		{"escapes", `\*not em\* \<b>`, "<p>*not em* &lt;b&gt;</p>\n"},
+		{"hard break", "one  \ntwo\\\nthree\nfour", "<p>one<br>\ntwo<br>\nthree\nfour</p>\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gfm.Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	commonmark := New(Options{})
+	for src, want := range map[string]string{
+		"~~kept~~":            "<p>~~kept~~</p>\n",
+		"https://go.dev":      "<p>https://go.dev</p>\n",
+		"| a |\n|---|\n| 1 |": "<p>| a |\n|---|\n| 1 |</p>\n",
+		"- [ ] box":           "<ul>\n<li>[ ] box</li>\n</ul>\n",
+	} {
+		if got := commonmark.Render(src); got != want {
+			t.Errorf("CommonMark Render(%q) = %q, want %q", src, got, want)
+		}
+	}
+
+	wraps := New(Options{HardWraps: true})
+	if got, want := wraps.Render("one\ntwo"), "<p>one<br>\ntwo</p>\n"; got != want {
+		t.Errorf("HardWraps Render = %q, want %q", got, want)
+	}
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	for _, unsafe := range []string{`<a href="javascript:x">x</a>`, `<img src=x onerror=y>`, `<p onclick="x">`, `<b>`} {
+		if checkSafe(unsafe) == "" {
+			t.Fatalf("checkSafe passed %q", unsafe)
+		}
+	}
+
+	r := New(Options{GFM: true})
+	for _, src := range []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[x](javascript:alert(1))",
+		"[x](JaVaScRiPt:alert(1))",
+		"[x](javascript&colon;alert(1))",
+		"[x](java\\\nscript:alert(1))",
+		"[x](<javascript:alert(1)>)",
+		"[x]\n\n[x]: javascript:alert(1)",
+		"![x](data:text/html;base64,PHNjcmlwdD4=)",
+		"![x](javascript:alert(1))",
+		"<javascript:alert(1)>",
+		"[x](vbscript:msgbox)",
+		"[a](https://x \"\" onmouseover=\"alert(1))",
+		"```\"><script>\n<script>\n```",
+		"| <script> |\n|---|\n| <b onclick=x> |",
+		"`<script>`",
+		"> <iframe src=x>",
+		"- <svg onload=alert(1)>",
+		"**<style>**",
+	} {
+		if err := checkSafe(r.Render(src)); err != "" {
+			t.Errorf("Render(%q): %s", src, err)
+		}
+	}
+}
+
+var (
+	tagRe  = regexp.MustCompile(`<(/?)([a-z0-9]+)((?:\s[a-z-]+(?:="[^"<>]*")?)*)>`)
+	attrRe = regexp.MustCompile(`\s([a-z-]+)(?:="([^"]*)")?`)
+
+	safeTags  = "p h1 h2 h3 h4 h5 h6 em strong del code pre blockquote ul ol li hr br a img table thead tbody tr th td input"
+	safeAttrs = "href src alt title class style type checked disabled start"
+)
+
+// checkSafe describes the first tag, attribute or URL in out that the
+// renderer should never produce, or any < or > outside of a tag.
+func checkSafe(out string) string {
+	problem := ""
+	rest := tagRe.ReplaceAllStringFunc(out, func(tag string) string {
+		m := tagRe.FindStringSubmatch(tag)
+		if !slices.Contains(strings.Fields(safeTags), m[2]) {
+			problem = cmp.Or(problem, "tag "+tag)
+		}
+		for _, attr := range attrRe.FindAllStringSubmatch(m[3], -1) {
+			if !slices.Contains(strings.Fields(safeAttrs), attr[1]) {
+				problem = cmp.Or(problem, "attribute "+attr[1])
+			}
+			url := strings.ToLower(html.UnescapeString(attr[2]))
+			scheme, _, found := strings.Cut(url, ":")
+			if (attr[1] == "href" || attr[1] == "src") && found && !strings.ContainsAny(scheme, "/?#") &&
+				!slices.Contains([]string{"http", "https", "mailto"}, scheme) {
+				problem = cmp.Or(problem, "url "+url)
+			}
+		}
+		return ""
+	})
+	if problem == "" && strings.ContainsAny(rest, "<>") {
+		problem = "markup outside of tags in " + out
+	}
+	return problem
+}
+
+func TestRenderNestingLimit(t *testing.T) {
+	src := strings.Repeat("> ", 10000) + "deep\n" + strings.Repeat("- ", 10000) + "deep"
+	if got := New(Options{GFM: true}).Render(src); !strings.Contains(got, "deep") {
+		t.Fatalf("deeply nested input lost its text: %.80q", got)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	src := "# Trip\n- [ ] pack\n  * [x] passport\n1. [X] book  \n- [] not a task\n```\n- [ ] in code\n```\n- [ ]\n+ [ ] last"
+	var got []string
+	for _, task := range Tasks(src) {
+		got = append(got, fmt.Sprintf("%d:%s:%t", task.Line, task.Text, task.Done))
+	}
+	if want := "2:pack:false 3:passport:true 4:book:true 10:last:false"; strings.Join(got, " ") != want {
+		t.Errorf("Tasks = %v, want %s", got, want)
+	}
+
+	toggled, ok := SetTask(src, 1, false)
+	if !ok || !strings.Contains(toggled, "\n  * [ ] passport\n") {
+		t.Errorf("SetTask(1, false) = %q, %v", toggled, ok)
+	}
+	toggled, ok = SetTask(src, 3, true)
+	if !ok || !strings.HasSuffix(toggled, "\n+ [x] last") || strings.Count(toggled, "[x]") != 2 {
+		t.Errorf("SetTask(3, true) = %q, %v", toggled, ok)
+	}
+	if _, ok := SetTask(src, 4, true); ok {
+		t.Error("SetTask past the last task succeeded")
+	}
+}
@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Task is a GFM task list item, "- [ ] text" or "- [x] text". Line is
+// 1-based within the source.
+type Task struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// taskPattern matches the items the renderer draws a checkbox for.
+var taskPattern = regexp.MustCompile(`^(\s*(?:[-*+]|\d{1,9}[.)])\s+\[)([ xX])\] +(\S.*)$`)
+
+// Tasks returns the task list items of src in order, leaving out those in
+// fenced code blocks.
+func Tasks(src string) []Task {
+	var tasks []Task
+	eachTaskLine(src, func(i int, m []string) {
+		tasks = append(tasks, Task{Line: i + 1, Text: strings.TrimSpace(m[3]), Done: m[2] != " "})
+	})
+	return tasks
+}
+
+// SetTask checks or unchecks the n-th task of src, counting from 0 as
+// Tasks does, and reports whether there is one.
+func SetTask(src string, n int, done bool) (string, bool) {
+	lines := strings.Split(src, "\n")
+	found := false
+	seen := 0
+	eachTaskLine(src, func(i int, m []string) {
+		if seen == n {
+			mark := " "
+			if done {
+				mark = "x"
+			}
+			lines[i] = m[1] + mark + lines[i][len(m[1])+1:]
+			found = true
+		}
+		seen++
+	})
+	return strings.Join(lines, "\n"), found
+}
+
+func eachTaskLine(src string, fn func(i int, m []string)) {
+	fence := ""
+	for i, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) <= 3 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			switch {
+			case fence == "":
+				fence = trimmed[:3]
+			case strings.HasPrefix(trimmed, fence):
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if m := taskPattern.FindStringSubmatch(strings.TrimRight(line, "\r")); m != nil {
+			fn(i, m)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// lockKey identifies the migration lock among other advisory locks that may
+// share the database. It spells "notesmig" in ASCII.
+const lockKey int64 = 0x6e6f7465736d6967
+
+const mysqlLockName = "notes_schema_migrations"
+
+// lock serializes migration runs across instances that share a database, so
+// replicas starting at the same time apply each migration once while the
+// others wait. The lock is bound to one connection and released with it.
+// SQLite is a local file with a single writer and CockroachDB has no
+// advisory locks, so both run unlocked.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if m.dialect != Postgres && m.dialect != MySQL {
+		return func() {}, nil
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	release := func(query string, arg any) func() {
+		return func() {
+			_, _ = conn.ExecContext(context.Background(), query, arg)
+			conn.Close()
+		}
+	}
+
+	if m.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+		return release(`SELECT pg_advisory_unlock($1)`, lockKey), nil
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 3600)`, mysqlLockName).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("acquire migration lock: timed out waiting for another instance")
+	}
+	return release(`SELECT RELEASE_LOCK(?)`, mysqlLockName), nil
+}
@@ -0,0 +1,530 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Dialect string
+
+const (
+	Postgres  Dialect = "postgres"
+	Cockroach Dialect = "cockroach"
+	SQLite    Dialect = "sqlite"
+	MySQL     Dialect = "mysql"
+)
+
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+func (d Dialect) placeholder(n int) string {
+	if d == Postgres || d == Cockroach {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// Migration is one schema change. Files are named <version>.up.sql and
+// <version>.down.sql; a bare <version>.sql is treated as an up migration
+// that cannot be rolled back. Checksum is the SHA-256 of the up file.
+type Migration struct {
+	Version  string
+	UpFile   string
+	DownFile string
+	Checksum string
+}
+
+type Migrator struct {
+	db      *sql.DB
+	dialect Dialect
+	fsys    fs.FS
+}
+
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) *Migrator {
+	return &Migrator{db: db, dialect: dialect, fsys: fsys}
+}
+
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[string]*Migration)
+	get := func(version string) *Migration {
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		return m
+	}
+	setUp := func(version, name string) error {
+		m := get(version)
+		if m.UpFile != "" {
+			return fmt.Errorf("migration %s has both %s and %s", version, m.UpFile, name)
+		}
+		m.UpFile = name
+		return nil
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		switch {
+		case strings.HasSuffix(name, ".down.sql"):
+			get(strings.TrimSuffix(name, ".down.sql")).DownFile = name
+		case strings.HasSuffix(name, ".up.sql"):
+			if err := setUp(strings.TrimSuffix(name, ".up.sql"), name); err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(name, ".sql"):
+			if err := setUp(strings.TrimSuffix(name, ".sql"), name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpFile == "" {
+			return nil, fmt.Errorf("migration %s has a down file but no up file", m.Version)
+		}
+		content, err := fs.ReadFile(fsys, m.UpFile)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", m.UpFile, err)
+		}
+		m.Checksum = checksum(content)
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// record is the schema_migrations row of one version.
+type record struct {
+	applied   bool
+	checksum  string
+	appliedAt time.Time
+}
+
+// DriftError reports applied migrations whose up file changed afterwards.
+type DriftError struct {
+	Versions []string
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("applied migrations were modified on disk: %s (run `migrate repair` if the edits are intentional)",
+		strings.Join(e.Versions, ", "))
+}
+
+// Up applies every migration that is not currently applied, in version
+// order, each inside its own transaction. It refuses to run when an
+// already-applied migration has changed.
+func (m *Migrator) Up(ctx context.Context) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, records, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		if records[mig.Version].applied {
+			continue
+		}
+		if err := m.apply(ctx, mig, DirectionUp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down rolls back the last steps applied migrations, newest first. It
+// refuses to start if any of them has no down file.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive")
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, records, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets := make([]Migration, 0, steps)
+	for i := len(migrations) - 1; i >= 0 && len(targets) < steps; i-- {
+		if records[migrations[i].Version].applied {
+			targets = append(targets, migrations[i])
+		}
+	}
+	for _, mig := range targets {
+		if mig.DownFile == "" {
+			return fmt.Errorf("migration %s cannot be rolled back: no down file", mig.Version)
+		}
+	}
+
+	for _, mig := range targets {
+		if err := m.apply(ctx, mig, DirectionDown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// To migrates up or down to target, given as a full version or its numeric
+// prefix: pending migrations up to and including it are applied in order,
+// then applied ones after it are rolled back, newest first. A target of "0"
+// rolls everything back. Like Down it refuses to start when a migration it
+// would roll back has no down file.
+func (m *Migrator) To(ctx context.Context, target string) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, records, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+
+	last := -1
+	if target != "0" {
+		for i, mig := range migrations {
+			if mig.Version == target || strings.SplitN(mig.Version, "_", 2)[0] == target {
+				last = i
+				break
+			}
+		}
+		if last < 0 {
+			return fmt.Errorf("unknown migration %q", target)
+		}
+	}
+
+	var down []Migration
+	for i := len(migrations) - 1; i > last; i-- {
+		if records[migrations[i].Version].applied {
+			if migrations[i].DownFile == "" {
+				return fmt.Errorf("migration %s cannot be rolled back: no down file", migrations[i].Version)
+			}
+			down = append(down, migrations[i])
+		}
+	}
+
+	for _, mig := range migrations[:last+1] {
+		if records[mig.Version].applied {
+			continue
+		}
+		if err := m.apply(ctx, mig, DirectionUp); err != nil {
+			return err
+		}
+	}
+	for _, mig := range down {
+		if err := m.apply(ctx, mig, DirectionDown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Repair re-baselines the recorded checksum of every applied migration whose
+// file was intentionally edited, and returns the versions it updated.
+func (m *Migrator) Repair(ctx context.Context) ([]string, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := Load(m.fsys)
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var repaired []string
+	for _, mig := range migrations {
+		rec, ok := records[mig.Version]
+		if !ok || rec.checksum == mig.Checksum {
+			continue
+		}
+		if err := m.setChecksum(ctx, mig); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, mig.Version)
+	}
+	return repaired, nil
+}
+
+type Status struct {
+	Version    string
+	Applied    bool
+	AppliedAt  time.Time
+	Reversible bool
+	// Drifted is set when the up file no longer matches the checksum
+	// recorded when it was applied.
+	Drifted bool
+	// Missing is set for versions recorded in the database without a file.
+	Missing bool
+}
+
+// Status reports every known migration with its current state, plus any
+// version recorded in the database that no longer has a file.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := Load(m.fsys)
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(migrations))
+	for _, mig := range migrations {
+		rec, ok := records[mig.Version]
+		result = append(result, Status{
+			Version:    mig.Version,
+			Applied:    rec.applied,
+			AppliedAt:  rec.appliedAt,
+			Reversible: mig.DownFile != "",
+			Drifted:    ok && rec.checksum != "" && rec.checksum != mig.Checksum,
+		})
+		delete(records, mig.Version)
+	}
+	for version, rec := range records {
+		result = append(result, Status{
+			Version:   version,
+			Applied:   rec.applied,
+			AppliedAt: rec.appliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// prepare loads migrations and their recorded state and checks for drift.
+// Rows written before checksums were tracked are baselined against the
+// current files.
+func (m *Migrator) prepare(ctx context.Context) ([]Migration, map[string]record, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, nil, err
+	}
+	migrations, err := Load(m.fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var drifted []string
+	for _, mig := range migrations {
+		rec, ok := records[mig.Version]
+		switch {
+		case !ok || rec.checksum == mig.Checksum:
+		case rec.checksum == "":
+			if err := m.setChecksum(ctx, mig); err != nil {
+				return nil, nil, err
+			}
+		default:
+			drifted = append(drifted, mig.Version)
+		}
+	}
+	if len(drifted) > 0 {
+		return nil, nil, &DriftError{Versions: drifted}
+	}
+	return migrations, records, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, mig Migration, direction string) error {
+	file := mig.UpFile
+	if direction == DirectionDown {
+		file = mig.DownFile
+	}
+	content, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return fmt.Errorf("read migration %s: %w", file, err)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("start migration tx %s: %w", file, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("run migration %s: %w", file, err)
+	}
+
+	p := m.dialect.placeholder
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE name = `+p(1), mig.Version); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("persist migration %s: %w", file, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (name, direction, checksum) VALUES (`+p(1)+`, `+p(2)+`, `+p(3)+`)`,
+		mig.Version, direction, mig.Checksum); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("persist migration %s: %w", file, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", file, err)
+	}
+	return nil
+}
+
+func (m *Migrator) setChecksum(ctx context.Context, mig Migration) error {
+	p := m.dialect.placeholder
+	_, err := m.db.ExecContext(ctx,
+		`UPDATE schema_migrations SET checksum = `+p(1)+` WHERE name = `+p(2),
+		mig.Checksum, mig.Version)
+	if err != nil {
+		return fmt.Errorf("record checksum of %s: %w", mig.Version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) records(ctx context.Context) (map[string]record, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT name, direction, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	records := make(map[string]record)
+	for rows.Next() {
+		var (
+			name, direction string
+			rec             record
+		)
+		if err := rows.Scan(&name, &direction, &rec.checksum, &rec.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		rec.applied = direction == DirectionUp
+		records[name] = rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return records, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	name, appliedAt := `text`, `timestamptz NOT NULL DEFAULT NOW()`
+	switch m.dialect {
+	case SQLite:
+		appliedAt = `DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP`
+	case MySQL:
+		name, appliedAt = `varchar(255)`, `DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)`
+	}
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			name `+name+` PRIMARY KEY,
+			direction varchar(8) NOT NULL DEFAULT 'up',
+			checksum varchar(64) NOT NULL DEFAULT '',
+			applied_at `+appliedAt+`
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("ensure schema_migrations table: %w", err)
+	}
+	return m.upgradeLegacyTable(ctx)
+}
+
+// upgradeLegacyTable brings a schema_migrations table written by earlier
+// releases up to date: it adds the direction and checksum columns and
+// strips the .sql suffix those releases recorded as part of the name.
+func (m *Migrator) upgradeLegacyTable(ctx context.Context) error {
+	for _, column := range []string{
+		`direction varchar(8) NOT NULL DEFAULT 'up'`,
+		`checksum varchar(64) NOT NULL DEFAULT ''`,
+	} {
+		if err := m.ensureColumn(ctx, column); err != nil {
+			return err
+		}
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT name FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("list applied migrations: %w", err)
+	}
+	var legacy []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan applied migration: %w", err)
+		}
+		if strings.HasSuffix(name, ".sql") {
+			legacy = append(legacy, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list applied migrations: %w", err)
+	}
+
+	p := m.dialect.placeholder
+	for _, name := range legacy {
+		if _, err := m.db.ExecContext(ctx,
+			`UPDATE schema_migrations SET name = `+p(1)+` WHERE name = `+p(2),
+			strings.TrimSuffix(name, ".sql"), name); err != nil {
+			return fmt.Errorf("rename legacy migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds a schema_migrations column given as "<name> <type...>"
+// unless it already exists. Not every dialect supports ADD COLUMN IF NOT
+// EXISTS, so existence is probed with a query instead.
+func (m *Migrator) ensureColumn(ctx context.Context, definition string) error {
+	column, _, _ := strings.Cut(definition, " ")
+	if rows, err := m.db.QueryContext(ctx, `SELECT `+column+` FROM schema_migrations WHERE 1 = 0`); err == nil {
+		rows.Close()
+		return nil
+	}
+	if _, err := m.db.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN `+definition); err != nil {
+		return fmt.Errorf("add schema_migrations.%s: %w", column, err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+	if err != nil {
+		t.Fatalf("check table %s: %v", name, err)
+	}
+	return count > 0
+}
+
+var testMigrations = fstest.MapFS{
+	"001_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER);`)},
+	"001_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+	"002_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER);`)},
+	"002_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+	"003_c.sql":      {Data: []byte(`CREATE TABLE c (id INTEGER);`)},
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := New(db, SQLite, testMigrations)
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	for _, table := range []string{"a", "b", "c"} {
+		if !tableExists(t, db, table) {
+			t.Fatalf("table %s missing after up", table)
+		}
+	}
+
+	err := m.Down(ctx, 1)
+	if err == nil || !strings.Contains(err.Error(), "003_c") {
+		t.Fatalf("down over irreversible migration: err = %v", err)
+	}
+
+	withoutC := fstest.MapFS{}
+	for name, file := range testMigrations {
+		if !strings.HasPrefix(name, "003") {
+			withoutC[name] = file
+		}
+	}
+	if _, err := db.Exec(`DROP TABLE c; DELETE FROM schema_migrations WHERE name = '003_c'`); err != nil {
+		t.Fatalf("drop c: %v", err)
+	}
+	m = New(db, SQLite, withoutC)
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if tableExists(t, db, "b") || !tableExists(t, db, "a") {
+		t.Fatal("down 1 should drop only b")
+	}
+
+	var direction string
+	if err := db.QueryRow(`SELECT direction FROM schema_migrations WHERE name = '002_b'`).Scan(&direction); err != nil {
+		t.Fatalf("read direction: %v", err)
+	}
+	if direction != DirectionDown {
+		t.Fatalf("direction = %q, want down", direction)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("re-apply: %v", err)
+	}
+	if !tableExists(t, db, "b") {
+		t.Fatal("up should re-apply a rolled back migration")
+	}
+}
+
+func TestTo(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := New(db, SQLite, testMigrations)
+
+	if err := m.To(ctx, "002"); err != nil {
+		t.Fatalf("to 002: %v", err)
+	}
+	if !tableExists(t, db, "b") || tableExists(t, db, "c") {
+		t.Fatal("to 002 should apply 001 and 002 only")
+	}
+	if err := m.To(ctx, "001_a"); err != nil {
+		t.Fatalf("to 001_a: %v", err)
+	}
+	if tableExists(t, db, "b") || !tableExists(t, db, "a") {
+		t.Fatal("to 001_a should roll back only 002")
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if err := m.To(ctx, "0"); err == nil || !strings.Contains(err.Error(), "003_c") {
+		t.Fatalf("to 0 over irreversible migration: err = %v", err)
+	}
+	if !tableExists(t, db, "a") {
+		t.Fatal("a refused rollback should change nothing")
+	}
+	if err := m.To(ctx, "004"); err == nil {
+		t.Fatal("to an unknown version succeeded")
+	}
+}
+
+func TestUpgradesLegacyTable(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if _, err := db.Exec(`
+		CREATE TABLE schema_migrations (name text PRIMARY KEY, applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+		CREATE TABLE a (id INTEGER);
+		INSERT INTO schema_migrations (name) VALUES ('001_a.sql');
+	`); err != nil {
+		t.Fatalf("seed legacy table: %v", err)
+	}
+
+	if err := New(db, SQLite, testMigrations).Up(ctx); err != nil {
+		t.Fatalf("up over legacy table: %v", err)
+	}
+	if !tableExists(t, db, "b") {
+		t.Fatal("pending migrations were not applied")
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE name = '001_a' AND direction = 'up'`).Scan(&count); err != nil {
+		t.Fatalf("read legacy row: %v", err)
+	}
+	if count != 1 {
+		t.Fatal("legacy migration name was not normalized")
+	}
+}
+
+func TestLoadRejectsDuplicateUp(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"001_a.sql":    {Data: []byte(`SELECT 1;`)},
+		"001_a.up.sql": {Data: []byte(`SELECT 1;`)},
+	})
+	if err == nil {
+		t.Fatal("expected an error for two up files with the same version")
+	}
+}
+
+func TestDetectsDriftAndRepairs(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := New(db, SQLite, testMigrations).Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	edited := fstest.MapFS{}
+	for name, file := range testMigrations {
+		edited[name] = file
+	}
+	edited["002_b.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE b (id INTEGER, name TEXT);`)}
+	m := New(db, SQLite, edited)
+
+	var drift *DriftError
+	if err := m.Up(ctx); !errors.As(err, &drift) || len(drift.Versions) != 1 || drift.Versions[0] != "002_b" {
+		t.Fatalf("up after edit: err = %v, want drift on 002_b", err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !statuses[1].Drifted || statuses[0].Drifted {
+		t.Fatalf("status drift flags = %+v", statuses)
+	}
+
+	repaired, err := m.Repair(ctx)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if len(repaired) != 1 || repaired[0] != "002_b" {
+		t.Fatalf("repaired = %v, want [002_b]", repaired)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up after repair: %v", err)
+	}
+}
+
+func TestBaselinesLegacyChecksums(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := New(db, SQLite, testMigrations)
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = ''`); err != nil {
+		t.Fatalf("clear checksums: %v", err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up with unrecorded checksums: %v", err)
+	}
+	var empty int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE checksum = ''`).Scan(&empty); err != nil {
+		t.Fatalf("count checksums: %v", err)
+	}
+	if empty != 0 {
+		t.Fatalf("%d migrations left without a checksum", empty)
+	}
+}
@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scaffold creates an empty up/down pair named <timestamp>_<name> in the
+// directory of every driver under root and returns the created paths.
+func Scaffold(root string, drivers []string, name string, now time.Time) ([]string, error) {
+	slug := slugify(name)
+	if slug == "" {
+		return nil, fmt.Errorf("migration name %q has no usable characters", name)
+	}
+	version := now.UTC().Format("20060102150405") + "_" + slug
+
+	var created []string
+	for _, driver := range drivers {
+		dir := filepath.Join(root, driver)
+		if _, err := os.Stat(dir); err != nil {
+			return created, fmt.Errorf("migrations dir for %s: %w", driver, err)
+		}
+		for _, direction := range []string{DirectionUp, DirectionDown} {
+			path := filepath.Join(dir, version+"."+direction+".sql")
+			header := fmt.Sprintf("-- %s (%s, %s)\n", version, driver, direction)
+			if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+				return created, fmt.Errorf("write %s: %w", path, err)
+			}
+			created = append(created, path)
+		}
+	}
+	return created, nil
+}
+
+func slugify(name string) string {
+	var b strings.Builder
+	lastUnderscore := true
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			lastUnderscore = false
+		case !lastUnderscore:
+			b.WriteByte('_')
+			lastUnderscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
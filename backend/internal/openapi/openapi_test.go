@@ -0,0 +1,76 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type base struct {
+	ID      uuid.UUID `json:"id"`
+	Comment string    `json:"comment"`
+}
+
+type node struct {
+	base
+	Comment  string          `json:"comment"`
+	Parent   *node           `json:"parent"`
+	Children []node          `json:"children,omitempty"`
+	Seen     *time.Time      `json:"seen"`
+	Extra    json.RawMessage `json:"extra"`
+	Secret   string          `json:"-"`
+	Untagged int
+	hidden   bool
+}
+
+func TestSchemas(t *testing.T) {
+	s := NewSchemas()
+	ref := s.Of(node{})
+	if ref.Ref != "#/components/schemas/Node" {
+		t.Fatalf("Of(node) = %+v, want a $ref to Node", ref)
+	}
+	got := s.Components()["Node"]
+	if got == nil || got.Type != "object" {
+		t.Fatalf("Node component = %+v", got)
+	}
+
+	var names []string
+	for name := range got.Properties {
+		names = append(names, name)
+	}
+	want := map[string]func(*Schema) bool{
+		"id":       func(p *Schema) bool { return p.Type == "string" && p.Format == "uuid" },
+		"comment":  func(p *Schema) bool { return p.Type == "string" },
+		"parent":   func(p *Schema) bool { return p.Nullable && len(p.AllOf) == 1 && p.AllOf[0].Ref == ref.Ref },
+		"children": func(p *Schema) bool { return p.Type == "array" && p.Items.Ref == ref.Ref },
+		"seen":     func(p *Schema) bool { return p.Nullable && p.Format == "date-time" },
+		"extra":    func(p *Schema) bool { return p.Type == "" && p.Ref == "" },
+		"Untagged": func(p *Schema) bool { return p.Type == "integer" },
+	}
+	if len(names) != len(want) {
+		t.Errorf("properties = %v, want %d", names, len(want))
+	}
+	for name, ok := range want {
+		if p := got.Properties[name]; p == nil || !ok(p) {
+			t.Errorf("property %s = %+v", name, p)
+		}
+	}
+	if _, ok := s.Components()["Base"]; ok {
+		t.Error("embedded struct became a component")
+	}
+}
+
+func TestSchemasInlineAnonymous(t *testing.T) {
+	s := NewSchemas()
+	got := s.Of(map[string][]struct {
+		N int64 `json:"n"`
+	}{})
+	if got.Type != "object" || got.AdditionalProperties.Type != "array" || got.AdditionalProperties.Items.Properties["n"].Format != "int64" {
+		t.Errorf("schema = %+v", got)
+	}
+	if len(s.Components()) != 0 {
+		t.Errorf("components = %v, want none", s.Components())
+	}
+}
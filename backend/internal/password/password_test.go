@@ -0,0 +1,60 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Fatalf("Hash = %q", hash)
+	}
+	if other, _ := Hash("correct horse"); other == hash {
+		t.Fatal("two hashes share a salt")
+	}
+	if err := Check(hash); err != nil {
+		t.Fatalf("Check(Hash) = %v", err)
+	}
+	if ok, err := Verify(hash, "correct horse"); !ok || err != nil {
+		t.Fatalf("Verify right password = %v, %v", ok, err)
+	}
+	if ok, err := Verify(hash, "correct horse "); ok || err != nil {
+		t.Fatalf("Verify wrong password = %v, %v", ok, err)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(string(legacy)); err != nil {
+		t.Fatalf("Check(bcrypt) = %v", err)
+	}
+	if ok, err := Verify(string(legacy), "battery staple"); !ok || err != nil {
+		t.Fatalf("Verify bcrypt = %v, %v", ok, err)
+	}
+	if ok, err := Verify(string(legacy), "battery"); ok || err != nil {
+		t.Fatalf("Verify bcrypt wrong password = %v, %v", ok, err)
+	}
+}
+
+func TestCheckRejects(t *testing.T) {
+	for _, bad := range []string{
+		"",
+		"hunter2",
+		"$argon2i$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=16$m=65536,t=3,p=4$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=0,t=3,p=4$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=4$not base64!$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$2b$10$tooshort",
+	} {
+		if err := Check(bad); err == nil {
+			t.Errorf("Check(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Memory forgets buckets that have refilled.
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in the process, which is all a single replica needs.
+type Memory struct {
+	limit Limit
+
+	mu      sync.Mutex
+	buckets map[string]bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewMemory(limit Limit) *Memory {
+	return &Memory{limit: limit, buckets: make(map[string]bucket)}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) >= sweepInterval {
+		m.sweep(now)
+	}
+	b := m.buckets[key]
+	tokens, ok, retryAfter := m.limit.take(b.tokens, b.last, now)
+	m.buckets[key] = bucket{tokens: tokens, last: now}
+	return ok, retryAfter, nil
+}
+
+// sweep drops the buckets that are full again, so that clients seen once do
+// not stay in memory.
+func (m *Memory) sweep(now time.Time) {
+	refill := m.limit.refill()
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
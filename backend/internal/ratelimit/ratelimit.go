@@ -0,0 +1,53 @@
+// Package ratelimit throttles requests per client with token buckets, kept
+// in memory or, for deployments with several replicas, in Redis.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute is a bucket refilled with n tokens a minute that holds burst,
+// or n when burst is 0.
+func PerMinute(n, burst int) Limit {
+	if burst <= 0 {
+		burst = n
+	}
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Limiter takes a token from the bucket of key. When the bucket is empty it
+// reports how long until the next token.
+type Limiter interface {
+	Allow(ctx context.Context, key string, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// take refills a bucket that held tokens at last and takes one from it at
+// now. A zero last is a bucket never used, which starts full.
+func (l Limit) take(tokens float64, last, now time.Time) (left float64, ok bool, retryAfter time.Duration) {
+	burst := float64(l.Burst)
+	if last.IsZero() {
+		tokens = burst
+	} else if elapsed := now.Sub(last); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed.Seconds()*l.Rate)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	wait := time.Duration(math.Ceil((1 - tokens) / l.Rate * float64(time.Second)))
+	return tokens, false, wait
+}
+
+// refill is how long an empty bucket takes to fill up, after which it is no
+// different from one never used.
+func (l Limit) refill() time.Duration {
+	return time.Duration(math.Ceil(float64(l.Burst) / l.Rate * float64(time.Second)))
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"notes-backend/internal/redis"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory(PerMinute(6, 2))
+
+	for i := 0; i < 2; i++ {
+		if ok, _, err := m.Allow(ctx, "a", now); !ok || err != nil {
+			t.Fatalf("request %d = %v, %v; want allowed", i, ok, err)
+		}
+	}
+	ok, retryAfter, _ := m.Allow(ctx, "a", now)
+	if ok || retryAfter != 10*time.Second {
+		t.Fatalf("third request = %v, retry after %v; want refused for 10s", ok, retryAfter)
+	}
+	if ok, _, _ := m.Allow(ctx, "b", now); !ok {
+		t.Fatal("another key shares the bucket")
+	}
+
+	if ok, _, _ := m.Allow(ctx, "a", now.Add(5*time.Second)); ok {
+		t.Fatal("allowed before a token refilled")
+	}
+	if ok, _, _ := m.Allow(ctx, "a", now.Add(10*time.Second)); !ok {
+		t.Fatal("refused after a token refilled")
+	}
+
+	m.Allow(ctx, "c", now.Add(time.Minute))
+	if _, ok := m.buckets["b"]; ok {
+		t.Fatal("sweep kept a full bucket")
+	}
+	if _, ok := m.buckets["c"]; !ok {
+		t.Fatal("sweep dropped a bucket in use")
+	}
+}
+
+func TestRedis(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// The server refuses the first request for 1.5s and lets the next
+	// through, after checking the script gets the bucket's key and limit.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for reply := "*2\r\n:0\r\n:1500\r\n"; ; reply = "*2\r\n:1\r\n:0\r\n" {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, n)
+			for i := range args {
+				header, _ := r.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+				arg := make([]byte, size+2)
+				io.ReadFull(r, arg)
+				args[i] = string(arg[:size])
+			}
+			if n != 7 || args[0] != "EVAL" || args[3] != "notes:ratelimit:login:1.2.3.4" || args[4] != "0.0001" || args[5] != "2" {
+				reply = "-ERR unexpected " + strings.Join(args[min(n, 2):], " ") + "\r\n"
+			}
+			conn.Write([]byte(reply))
+		}
+	}()
+
+	client, err := redis.Open("redis://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	l := NewRedis(client, "login", PerMinute(6, 2))
+	ctx, now := context.Background(), time.Now()
+	if ok, wait, err := l.Allow(ctx, "1.2.3.4", now); ok || wait != 1500*time.Millisecond || err != nil {
+		t.Fatalf("first request = %t, %v, %v; want refused for 1.5s", ok, wait, err)
+	}
+	if ok, _, err := l.Allow(ctx, "1.2.3.4", now); !ok || err != nil {
+		t.Fatalf("second request = %t, %v", ok, err)
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"notes-backend/internal/redis"
+)
+
+// tokenBucket is Limit.take run atomically on the server, with times in
+// milliseconds and the rate in tokens per millisecond. The bucket expires
+// once it would be full again.
+const tokenBucket = `
+local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = burst
+if state[1] then
+  tokens = math.min(burst, tonumber(state[1]) + math.max(0, now - tonumber(state[2])) * rate)
+end
+local ok, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  ok = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate))
+return {ok, wait}
+`
+
+// NewRedis returns a Limiter sharing its buckets between replicas through
+// client, keeping them under the name, so that limiters sharing the server
+// do not share buckets.
+func NewRedis(client *redis.Client, name string, limit Limit) Limiter {
+	return &redisLimiter{client: client, prefix: "notes:ratelimit:" + name + ":", limit: limit}
+}
+
+type redisLimiter struct {
+	client *redis.Client
+	prefix string
+	limit  Limit
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	reply, err := l.client.Do(ctx, "EVAL", tokenBucket, "1", l.prefix+key,
+		strconv.FormatFloat(l.limit.Rate/1000, 'g', -1, 64), strconv.Itoa(l.limit.Burst), strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		return false, 0, err
+	}
+	result, ok := reply.([]any)
+	if !ok || len(result) != 2 {
+		return false, 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	allowed, _ := result[0].(int64)
+	wait, _ := result[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,231 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Weights of the words of each field in an Embedded index: a word of the
+// title counts as three of the content.
+const (
+	titleWeight   = 3
+	tagWeight     = 2
+	contentWeight = 1
+)
+
+// inexactWeight scales down the score of words matched by others a typo
+// away from them, or by the start of them in suggestions.
+const inexactWeight = 0.5
+
+// BM25 parameters, at their usual values.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Embedded is an index kept in the memory of the process, ranked with
+// BM25. It starts empty each run, for the Indexer to fill. Words are
+// matched whole, or with a typo as store.ForgivesTypo allows, ignoring case
+// and accents, and a document matches when it has every word of the query
+// and none of those it excludes. Terms of several words, such as phrases,
+// are matched as their words, and left out when excluded, for Store to
+// match as typed.
+type Embedded struct {
+	mu sync.RWMutex
+	// postings holds the weighted count of each word in each document.
+	postings map[string]map[uuid.UUID]int
+	// docs holds each document's words, to remove them by, and length.
+	docs        map[uuid.UUID]embeddedDoc
+	totalLength int
+}
+
+type embeddedDoc struct {
+	words  map[string]int
+	length int
+	// title holds the words of the title, which suggestions are limited to.
+	title []string
+}
+
+var _ SearchIndex = (*Embedded)(nil)
+
+func NewEmbedded() *Embedded {
+	return &Embedded{postings: map[string]map[uuid.UUID]int{}, docs: map[uuid.UUID]embeddedDoc{}}
+}
+
+func (e *Embedded) Index(_ context.Context, docs []Document) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, doc := range docs {
+		e.remove(doc.ID)
+		entry := embeddedDoc{words: map[string]int{}}
+		count := func(text string, weight int) {
+			for _, word := range tokenize(text) {
+				entry.words[word] += weight
+				entry.length += weight
+			}
+		}
+		count(doc.Title, titleWeight)
+		entry.title = tokenize(doc.Title)
+		count(strings.Join(doc.Tags, " "), tagWeight)
+		count(doc.Content, contentWeight)
+		for word, n := range entry.words {
+			if e.postings[word] == nil {
+				e.postings[word] = map[uuid.UUID]int{}
+			}
+			e.postings[word][doc.ID] = n
+		}
+		e.docs[doc.ID] = entry
+		e.totalLength += entry.length
+	}
+	return nil
+}
+
+func (e *Embedded) Remove(_ context.Context, ids []uuid.UUID) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range ids {
+		e.remove(id)
+	}
+	return nil
+}
+
+func (e *Embedded) remove(id uuid.UUID) {
+	entry, ok := e.docs[id]
+	if !ok {
+		return
+	}
+	for word := range entry.words {
+		delete(e.postings[word], id)
+		if len(e.postings[word]) == 0 {
+			delete(e.postings, word)
+		}
+	}
+	delete(e.docs, id)
+	e.totalLength -= entry.length
+}
+
+func (e *Embedded) Search(_ context.Context, query string, limit int) ([]uuid.UUID, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.search(query, limit, false), nil
+}
+
+// Suggest finds the documents with every word of prefix in their titles,
+// the last word perhaps only begun.
+func (e *Embedded) Suggest(_ context.Context, prefix string, limit int) ([]uuid.UUID, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.search(prefix, limit, true), nil
+}
+
+// search returns the best limit documents with every word of query and
+// none of those it excludes. For suggestions, only titles count and the
+// last word may be begun.
+func (e *Embedded) search(query string, limit int, suggest bool) []uuid.UUID {
+	var words []string
+	var excluded []string
+	for _, term := range store.ParseTerms(query) {
+		tokens := tokenize(term.Text)
+		switch {
+		case !term.Exclude:
+			words = append(words, tokens...)
+		case len(tokens) == 1:
+			excluded = append(excluded, tokens[0])
+		}
+	}
+	if len(words) == 0 || len(e.docs) == 0 {
+		return []uuid.UUID{}
+	}
+	last := words[len(words)-1]
+	slices.Sort(words)
+	words = slices.Compact(words)
+
+	n := float64(len(e.docs))
+	avgLength := float64(e.totalLength) / n
+	// scores holds the documents with every word so far, nil before the
+	// first.
+	var scores map[uuid.UUID]float64
+	for _, word := range words {
+		matched := map[uuid.UUID]float64{}
+		for term, weight := range e.variants(word, suggest && word == last) {
+			postings := e.postings[term]
+			df := float64(len(postings))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for id, tf := range postings {
+				if _, ok := scores[id]; scores != nil && !ok {
+					continue
+				}
+				if suggest && !slices.Contains(e.docs[id].title, term) {
+					continue
+				}
+				length := float64(e.docs[id].length)
+				score := weight * idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*(1-bm25B+bm25B*length/avgLength))
+				// A word counts once, by its best match.
+				matched[id] = max(matched[id], score)
+			}
+		}
+		for id := range matched {
+			matched[id] += scores[id]
+		}
+		scores = matched
+	}
+
+	ids := make([]uuid.UUID, 0, len(scores))
+	for id := range scores {
+		if !e.excludes(id, excluded) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		if c := cmp.Compare(scores[b], scores[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.String(), b.String())
+	})
+	return ids[:min(len(ids), limit)]
+}
+
+// excludes reports whether the document has any word of excluded, which
+// are matched whole.
+func (e *Embedded) excludes(id uuid.UUID, excluded []string) bool {
+	words := e.docs[id].words
+	return slices.ContainsFunc(excluded, func(word string) bool { return words[word] > 0 })
+}
+
+// variants returns the indexed words that stand for word, by weight: word
+// itself, those a typo away when it forgives one and, when it is begun,
+// those it starts.
+func (e *Embedded) variants(word string, begun bool) map[string]float64 {
+	found := map[string]float64{}
+	if _, ok := e.postings[word]; ok {
+		found[word] = 1
+	}
+	typos := store.ForgivesTypo(word)
+	if !typos && !begun {
+		return found
+	}
+	for term := range e.postings {
+		if term != word && (begun && strings.HasPrefix(term, word) || typos && store.WithinOneEdit(term, word)) {
+			found[term] = inexactWeight
+		}
+	}
+	return found
+}
+
+// tokenize splits text into the words an Embedded index matches, folded
+// to lower case without accents. Anything but letters and digits
+// separates them.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(store.FoldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,203 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Meilisearch is an index on a Meilisearch server, which replicas share.
+// It ranks and matches as the server is set up to, with typo tolerance and
+// prefix search by default. Writes are Meilisearch tasks the server
+// applies shortly after they are accepted; Index and Remove wait for theirs
+// to succeed, so that what they wrote is searched once they return.
+type Meilisearch struct {
+	baseURL string
+	apiKey  string
+	index   string
+	client  *http.Client
+
+	// mu guards configured, which is set once titles are made to count for
+	// more than tags and content, before the first documents are added.
+	mu         sync.Mutex
+	configured bool
+}
+
+var _ SearchIndex = (*Meilisearch)(nil)
+
+// NewMeilisearch returns the index named index on the server at baseURL,
+// which is created with the first documents. apiKey may be empty for a
+// server without a master key.
+func NewMeilisearch(baseURL, apiKey, index string) *Meilisearch {
+	return &Meilisearch{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		index:   index,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (m *Meilisearch) Index(ctx context.Context, docs []Document) error {
+	m.mu.Lock()
+	if !m.configured {
+		err := m.write(ctx, http.MethodPatch, "/settings", map[string]any{
+			"searchableAttributes": []string{"title", "tags", "content"},
+		})
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		m.configured = true
+	}
+	m.mu.Unlock()
+	return m.write(ctx, http.MethodPost, "/documents?primaryKey=id", docs)
+}
+
+func (m *Meilisearch) Remove(ctx context.Context, ids []uuid.UUID) error {
+	return m.write(ctx, http.MethodPost, "/documents/delete-batch", ids)
+}
+
+// taskTimeout bounds how long a write waits for its task, which a server
+// busy with a large batch may leave enqueued for a while.
+const taskTimeout = 30 * time.Second
+
+// task is a Meilisearch task as /tasks reports it.
+type task struct {
+	UID    int64  `json:"taskUid"`
+	Status string `json:"status"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// write sends a write to path under the index and waits for its task to
+// succeed, polling at growing intervals.
+func (m *Meilisearch) write(ctx context.Context, method, path string, body any) error {
+	var enqueued task
+	if err := m.call(ctx, method, path, body, &enqueued); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, taskTimeout)
+	defer cancel()
+	for wait := 5 * time.Millisecond; ; wait = min(2*wait, 250*time.Millisecond) {
+		var t task
+		if err := m.do(ctx, http.MethodGet, fmt.Sprintf("/tasks/%d", enqueued.UID), nil, &t); err != nil {
+			return err
+		}
+		switch t.Status {
+		case "succeeded":
+			return nil
+		case "failed", "canceled":
+			if t.Error != nil {
+				return &meilisearchError{Status: "task " + t.Status, Code: t.Error.Code, Message: t.Error.Message}
+			}
+			return &meilisearchError{Status: "task " + t.Status}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("meilisearch: task %d still %s: %w", enqueued.UID, t.Status, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (m *Meilisearch) Search(ctx context.Context, query string, limit int) ([]uuid.UUID, error) {
+	return m.search(ctx, map[string]any{"q": query, "limit": limit})
+}
+
+// Suggest searches titles alone, which Meilisearch matches as typed: the
+// last word by its start.
+func (m *Meilisearch) Suggest(ctx context.Context, prefix string, limit int) ([]uuid.UUID, error) {
+	return m.search(ctx, map[string]any{"q": prefix, "limit": limit, "attributesToSearchOn": []string{"title"}})
+}
+
+func (m *Meilisearch) search(ctx context.Context, body map[string]any) ([]uuid.UUID, error) {
+	var result struct {
+		Hits []struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"hits"`
+	}
+	body["attributesToRetrieve"] = []string{"id"}
+	err := m.call(ctx, http.MethodPost, "/search", body, &result)
+	// The index is created with the first note.
+	var apiErr *meilisearchError
+	if errors.As(err, &apiErr) && apiErr.Code == "index_not_found" {
+		return []uuid.UUID{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.ID
+	}
+	return ids, nil
+}
+
+// call sends body as JSON to path under the index and decodes the response
+// into result, unless that is nil.
+func (m *Meilisearch) call(ctx context.Context, method, path string, body, result any) error {
+	return m.do(ctx, method, "/indexes/"+url.PathEscape(m.index)+path, body, result)
+}
+
+// do is call for any path on the server, sending no body for a nil one.
+func (m *Meilisearch) do(ctx context.Context, method, path string, body, result any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("meilisearch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		failure := &meilisearchError{Status: resp.Status}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(raw, failure)
+		return failure
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("meilisearch: decode response: %w", err)
+	}
+	return nil
+}
+
+// meilisearchError is an error response of the server.
+type meilisearchError struct {
+	Status  string `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *meilisearchError) Error() string {
+	if e.Message == "" {
+		return "meilisearch: " + e.Status
+	}
+	return "meilisearch: " + e.Status + ": " + e.Message
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a search in the query language of GET /notes, split into the
+// filters its operators stand for:
+//
+//	tag:work -tag:done      notes tagged work and not done
+//	title:meeting           meeting in the title
+//	before:2024-01-01       created before that day
+//	after:2024-01-01        created on that day or later
+//	is:favorite -is:archived
+//
+// Values may be quoted, as in tag:"to read". Everything else is text in web
+// search syntax: words, "quoted phrases" and -words.
+type Query struct {
+	Text string
+	// Title is matched against titles alone, in the same syntax as Text.
+	Title       string
+	Tags        []string
+	ExcludeTags []string
+	Favorite    *bool
+	Archived    *bool
+	// CreatedFrom and CreatedTo bound the creation time to [CreatedFrom,
+	// CreatedTo); a zero time leaves that side open.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// SyntaxError is a query that does not parse, pinned to the token at fault.
+type SyntaxError struct {
+	// Offset is where Token starts, in characters from the start of the
+	// query.
+	Offset  int
+	Token   string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at character %d", e.Message, e.Offset+1)
+}
+
+// ParseQuery parses raw, reading dates as days in loc, UTC when nil. A
+// word that looks like an operator but is not one is an error unless it is
+// quoted, except for links such as https://example.com.
+func ParseQuery(raw string, loc *time.Location) (Query, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var q Query
+	var text, title []string
+	r := []rune(raw)
+	for i := 0; i < len(r); {
+		if unicode.IsSpace(r[i]) {
+			i++
+			continue
+		}
+		start := i
+		negated := r[i] == '-'
+		if negated {
+			i++
+		}
+		from, name := i, i
+		for name < len(r) && unicode.IsLetter(r[name]) {
+			name++
+		}
+		operator := name > from && name < len(r) && r[name] == ':' && !strings.HasPrefix(string(r[name+1:]), "//")
+		valueStart := from
+		if operator {
+			valueStart = name + 1
+		}
+		value, quoted, end, err := scanValue(r, start, valueStart)
+		if err != nil {
+			return Query{}, err
+		}
+		token := string(r[start:end])
+		i = end
+		fail := func(message string) (Query, error) {
+			return Query{}, &SyntaxError{Offset: start, Token: token, Message: message}
+		}
+
+		if !operator {
+			if value != "" {
+				text = append(text, term(value, quoted, negated))
+			}
+			continue
+		}
+		op := strings.ToLower(string(r[from:name]))
+		switch op {
+		case "tag", "title", "before", "after", "is":
+		default:
+			return fail("unknown operator " + op + ":")
+		}
+		if value == "" {
+			return fail(op + ": needs a value")
+		}
+		switch op {
+		case "tag":
+			if negated {
+				q.ExcludeTags = append(q.ExcludeTags, value)
+			} else {
+				q.Tags = append(q.Tags, value)
+			}
+		case "title":
+			title = append(title, term(value, quoted, negated))
+		case "before", "after":
+			if negated {
+				return fail(op + ": cannot be negated")
+			}
+			day, err := time.ParseInLocation(time.DateOnly, value, loc)
+			if err != nil {
+				return fail(op + ": takes a date as YYYY-MM-DD")
+			}
+			// Repeated bounds keep the tighter one.
+			if op == "before" && (q.CreatedTo.IsZero() || day.Before(q.CreatedTo)) {
+				q.CreatedTo = day
+			}
+			if op == "after" && day.After(q.CreatedFrom) {
+				q.CreatedFrom = day
+			}
+		case "is":
+			set := !negated
+			switch strings.ToLower(value) {
+			case "favorite":
+				q.Favorite = &set
+			case "archived":
+				q.Archived = &set
+			default:
+				return fail("is: takes favorite or archived")
+			}
+		}
+	}
+	q.Text, q.Title = strings.Join(text, " "), strings.Join(title, " ")
+	return q, nil
+}
+
+// scanValue reads the value at r[i:], quoted or up to the next space, for
+// the token that starts at start. It returns the value without its quotes
+// and where the token ends.
+func scanValue(r []rune, start, i int) (string, bool, int, error) {
+	if i < len(r) && r[i] == '"' {
+		for end := i + 1; end < len(r); end++ {
+			if r[end] == '"' {
+				return strings.TrimSpace(string(r[i+1 : end])), true, end + 1, nil
+			}
+		}
+		return "", false, 0, &SyntaxError{Offset: start, Token: string(r[start:]), Message: "unterminated quote"}
+	}
+	end := i
+	for end < len(r) && !unicode.IsSpace(r[end]) {
+		end++
+	}
+	return string(r[i:end]), false, end, nil
+}
+
+// term writes a value back in web search syntax.
+func term(value string, quoted, negated bool) string {
+	if quoted {
+		value = `"` + value + `"`
+	}
+	if negated {
+		value = "-" + value
+	}
+	return value
+}
@@ -0,0 +1,181 @@
+// Package search answers the text searches of note listings from a search
+// index outside the database, for SEARCH_BACKEND other than the database's
+// own search. An Indexer follows the database's change journal into the
+// index, so that it sees every write, whichever replica made it.
+package search
+
+import (
+	"context"
+	"sync"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// SearchIndex keeps documents and finds those matching a query. Writes
+// may take effect after they return, as Meilisearch's do.
+type SearchIndex interface {
+	// Index adds docs, replacing the documents with the same IDs.
+	Index(ctx context.Context, docs []Document) error
+	// Remove deletes the documents with ids; unknown ones are skipped.
+	Remove(ctx context.Context, ids []uuid.UUID) error
+	// Search returns the IDs of up to limit documents that match query,
+	// best first.
+	Search(ctx context.Context, query string, limit int) ([]uuid.UUID, error)
+	// Suggest returns the IDs of up to limit documents whose titles
+	// complete prefix, best first.
+	Suggest(ctx context.Context, prefix string, limit int) ([]uuid.UUID, error)
+}
+
+// Document is what the index keeps of a note, or of an attachment: its
+// filename as the title and its text as the content.
+type Document struct {
+	ID      uuid.UUID `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Tags    []string  `json:"tags"`
+}
+
+// NewDocument returns the document of n. The content of a locked note is
+// ciphertext and left out, so that only its title and tags are found, as
+// in the database's search.
+func NewDocument(n store.Note) Document {
+	doc := Document{ID: n.ID, Title: n.Title, Content: n.Content, Tags: n.Tags}
+	if n.IsEncrypted {
+		doc.Content = ""
+	}
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	return doc
+}
+
+// NewAttachmentDocument returns the document of a.
+func NewAttachmentDocument(a store.Attachment) Document {
+	return Document{ID: a.ID, Title: a.Filename, Content: a.Text, Tags: []string{}}
+}
+
+// syncPage is how many changes Sync reads from the journal at a time.
+const syncPage = 500
+
+// Sources are what an Indexer reads: the change journal and the text of
+// attachments.
+type Sources interface {
+	store.SyncStore
+	ListAttachmentTexts(ctx context.Context, seq int64, id uuid.UUID, limit int) ([]store.Attachment, error)
+}
+
+// Indexer keeps an index up to date with the live notes of a store, and
+// another with the text of its attachments. Attachments are added as they
+// are uploaded and never updated; those deleted or of notes in the trash
+// are left in their index, for the store to filter out.
+type Indexer struct {
+	index       SearchIndex
+	attachments SearchIndex
+	sources     Sources
+
+	mu sync.Mutex
+	// seq is how far into the journal the index is, and attachmentSeq and
+	// attachmentID how far into the attachments.
+	seq           int64
+	attachmentSeq int64
+	attachmentID  uuid.UUID
+}
+
+func NewIndexer(index, attachments SearchIndex, sources Sources) *Indexer {
+	return &Indexer{index: index, attachments: attachments, sources: sources}
+}
+
+// Sync writes the changes made since the last call to the index. The
+// first call indexes every note there is, which rebuilds an index kept
+// from an earlier run.
+func (x *Indexer) Sync(ctx context.Context) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for {
+		page, err := x.sources.ListNoteChanges(ctx, x.seq, syncPage)
+		if err != nil {
+			return err
+		}
+		// Only the last change to a note counts; trashed and purged notes
+		// leave the index.
+		last := make(map[uuid.UUID]*store.Note, len(page.Changes))
+		for _, change := range page.Changes {
+			last[change.ID] = change.Note
+		}
+		var docs []Document
+		var removed []uuid.UUID
+		for id, n := range last {
+			if n != nil && n.DeletedAt == nil {
+				docs = append(docs, NewDocument(*n))
+			} else {
+				removed = append(removed, id)
+			}
+		}
+		if len(docs) > 0 {
+			if err := x.index.Index(ctx, docs); err != nil {
+				return err
+			}
+		}
+		if len(removed) > 0 {
+			if err := x.index.Remove(ctx, removed); err != nil {
+				return err
+			}
+		}
+		x.seq = page.Seq
+		if !page.More {
+			break
+		}
+	}
+	for {
+		page, err := x.sources.ListAttachmentTexts(ctx, x.attachmentSeq, x.attachmentID, syncPage)
+		if err != nil || len(page) == 0 {
+			return err
+		}
+		docs := make([]Document, len(page))
+		for i, a := range page {
+			docs[i] = NewAttachmentDocument(a)
+		}
+		if err := x.attachments.Index(ctx, docs); err != nil {
+			return err
+		}
+		last := page[len(page)-1]
+		x.attachmentSeq, x.attachmentID = last.Seq, last.ID
+		if len(page) < syncPage {
+			return nil
+		}
+	}
+}
+
+// Search syncs the index and then searches it, so that a search finds the
+// writes made before it.
+func (x *Indexer) Search(ctx context.Context, query string, limit int) ([]uuid.UUID, error) {
+	if err := x.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return x.index.Search(ctx, query, limit)
+}
+
+// Suggest syncs the index and then asks it for suggestions, as Search does.
+func (x *Indexer) Suggest(ctx context.Context, prefix string, limit int) ([]uuid.UUID, error) {
+	if err := x.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return x.index.Suggest(ctx, prefix, limit)
+}
+
+// SearchAttachments syncs the indexes and then searches that of
+// attachments, as Search does notes.
+func (x *Indexer) SearchAttachments(ctx context.Context, query string, limit int) ([]uuid.UUID, error) {
+	if err := x.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return x.attachments.Search(ctx, query, limit)
+}
+
+// ForgetAttachments removes deleted attachments from their index. Searches
+// skip them anyway, so this only keeps the index small.
+func (x *Indexer) ForgetAttachments(ctx context.Context, ids []uuid.UUID) error {
+	return x.attachments.Remove(ctx, ids)
+}
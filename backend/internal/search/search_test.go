@@ -0,0 +1,219 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmbedded(t *testing.T) {
+	ctx := context.Background()
+	index := NewEmbedded()
+	inTitle, inContent, inTags, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	index.Index(ctx, []Document{
+		{ID: inTitle, Title: "Café plans", Content: "Opening hours"},
+		{ID: inContent, Title: "Monday", Content: "Meet at the cafe, then plans for lunch"},
+		{ID: inTags, Title: "Receipts", Tags: []string{"cafe"}},
+		{ID: other, Title: "Groceries", Content: "milk, eggs"},
+	})
+
+	search := func(query string) []uuid.UUID {
+		t.Helper()
+		ids, err := index.Search(ctx, query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	if got := search("CAFE"); !slices.Equal(got, []uuid.UUID{inTitle, inTags, inContent}) {
+		t.Errorf("Search(CAFE) = %v, want title, tag, content matches in that order", got)
+	}
+	if got := search("cafe plans"); !slices.Equal(got, []uuid.UUID{inTitle, inContent}) {
+		t.Errorf("Search(cafe plans) = %v, want the notes with both words", got)
+	}
+	if got := search("caf"); len(got) != 0 {
+		t.Errorf("Search(caf) = %v, want whole words only", got)
+	}
+	if got, _ := index.Search(ctx, "cafe", 1); !slices.Equal(got, []uuid.UUID{inTitle}) {
+		t.Errorf("Search(cafe, 1) = %v", got)
+	}
+	if got := search("cafe plabs"); !slices.Equal(got, []uuid.UUID{inTitle, inContent}) {
+		t.Errorf("Search(cafe plabs) = %v, want the notes a typo away", got)
+	}
+	if got := search(`cafe -lunch -"opening soon"`); !slices.Equal(got, []uuid.UUID{inTitle, inTags}) {
+		t.Errorf("Search(cafe -lunch) = %v, want the notes without lunch, phrases left to the store", got)
+	}
+	if got, _ := index.Suggest(ctx, "caf", 10); !slices.Equal(got, []uuid.UUID{inTitle}) {
+		t.Errorf("Suggest(caf) = %v, want the title that starts the word", got)
+	}
+	if got, _ := index.Suggest(ctx, "plans c", 10); !slices.Equal(got, []uuid.UUID{inTitle}) {
+		t.Errorf("Suggest(plans c) = %v", got)
+	}
+
+	index.Index(ctx, []Document{{ID: inTitle, Title: "Tea plans"}})
+	index.Remove(ctx, []uuid.UUID{inTags, uuid.New()})
+	if got := search("cafe"); !slices.Equal(got, []uuid.UUID{inContent}) {
+		t.Errorf("Search(cafe) after the update = %v", got)
+	}
+	if got := search("tea"); !slices.Equal(got, []uuid.UUID{inTitle}) {
+		t.Errorf("Search(tea) = %v", got)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(time.DateOnly, s, loc)
+		return d
+	}
+	yes, no := true, false
+	q, err := ParseQuery(`tag:work -tag:"to do" "exact phrase" title:meeting -title:"weekly sync" before:2024-02-01 `+
+		`before:2024-03-01 after:2023-12-01 is:favorite -is:archived -draft https://example.com/a:b 10:30`, loc)
+	want := Query{
+		Text:        `"exact phrase" -draft https://example.com/a:b 10:30`,
+		Title:       `meeting -"weekly sync"`,
+		Tags:        []string{"work"},
+		ExcludeTags: []string{"to do"},
+		Favorite:    &yes,
+		Archived:    &no,
+		CreatedFrom: day("2023-12-01"),
+		CreatedTo:   day("2024-02-01"),
+	}
+	if err != nil || !reflect.DeepEqual(q, want) {
+		t.Errorf("ParseQuery = %+v, %v, want %+v", q, err, want)
+	}
+	if q, err := ParseQuery("  ", nil); err != nil || !reflect.DeepEqual(q, Query{}) {
+		t.Errorf("ParseQuery of nothing = %+v, %v", q, err)
+	}
+
+	for raw, want := range map[string]SyntaxError{
+		"plans due:friday":       {Offset: 6, Token: "due:friday", Message: "unknown operator due:"},
+		"tag: work":              {Offset: 0, Token: "tag:", Message: "tag: needs a value"},
+		`tag:""`:                 {Offset: 0, Token: `tag:""`, Message: "tag: needs a value"},
+		"café before:2024-13-01": {Offset: 5, Token: "before:2024-13-01", Message: "before: takes a date as YYYY-MM-DD"},
+		"-after:2024-01-01":      {Offset: 0, Token: "-after:2024-01-01", Message: "after: cannot be negated"},
+		"is:pinned":              {Offset: 0, Token: "is:pinned", Message: "is: takes favorite or archived"},
+		`a "open phrase`:         {Offset: 2, Token: `"open phrase`, Message: "unterminated quote"},
+	} {
+		_, err := ParseQuery(raw, nil)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || *syntax != want {
+			t.Errorf("ParseQuery(%q) = %v, want %+v", raw, err, want)
+		}
+	}
+}
+
+func TestMeilisearch(t *testing.T) {
+	ctx := context.Background()
+	hit := uuid.New()
+	var calls []string
+	var searched map[string]any
+	// Tasks stay enqueued for two polls and then succeed, unless they add
+	// a document titled "fail".
+	var tasks []string
+	polls := map[int]int{}
+	enqueue := func(w http.ResponseWriter, outcome string) {
+		tasks = append(tasks, outcome)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"taskUid": len(tasks) - 1, "status": "enqueued"})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var uid int
+		if _, err := fmt.Sscanf(r.URL.Path, "/tasks/%d", &uid); err == nil && uid < len(tasks) {
+			polls[uid]++
+			task := map[string]any{"taskUid": uid, "status": "enqueued"}
+			switch {
+			case polls[uid] <= 2:
+			case tasks[uid] == "failed":
+				task["status"], task["error"] = "failed", map[string]string{"code": "invalid_document_fields", "message": "bad fields"}
+			default:
+				task["status"] = "succeeded"
+			}
+			json.NewEncoder(w).Encode(task)
+			return
+		}
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/indexes/notes/search":
+			searched = nil
+			json.NewDecoder(r.Body).Decode(&searched)
+			if searched["q"] == "missing" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"code": "index_not_found", "message": "Index `notes` not found."})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"hits": []map[string]any{{"id": hit}}})
+		case "/indexes/notes/documents":
+			var docs []Document
+			if err := json.NewDecoder(r.Body).Decode(&docs); err != nil || len(docs) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"code": "bad_request", "message": "bad documents"})
+				return
+			}
+			if docs[0].Title == "fail" {
+				enqueue(w, "failed")
+				return
+			}
+			enqueue(w, "succeeded")
+		default:
+			enqueue(w, "succeeded")
+		}
+	}))
+	defer server.Close()
+
+	index := NewMeilisearch(server.URL+"/", "key", "notes")
+	for range 2 {
+		if err := index.Index(ctx, []Document{{ID: hit, Title: "Plans"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.Remove(ctx, []uuid.UUID{hit}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PATCH /indexes/notes/settings",
+		"POST /indexes/notes/documents?primaryKey=id",
+		"POST /indexes/notes/documents?primaryKey=id",
+		"POST /indexes/notes/documents/delete-batch",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	// Each write returned once its task had succeeded, not when enqueued.
+	for uid := range tasks {
+		if polls[uid] != 3 {
+			t.Errorf("task %d polled %d time(s), want 3", uid, polls[uid])
+		}
+	}
+	if err := index.Index(ctx, []Document{{ID: hit, Title: "fail"}}); err == nil || err.Error() != "meilisearch: task failed: bad fields" {
+		t.Errorf("Index of a failing task = %v", err)
+	}
+	if ids, err := index.Search(ctx, "plans", 10); err != nil || !slices.Equal(ids, []uuid.UUID{hit}) {
+		t.Errorf("Search = %v, %v", ids, err)
+	}
+	if ids, err := index.Suggest(ctx, "pla", 5); err != nil || !slices.Equal(ids, []uuid.UUID{hit}) || fmt.Sprint(searched["attributesToSearchOn"]) != "[title]" {
+		t.Errorf("Suggest = %v, %v, searching %v", ids, err, searched)
+	}
+	if ids, err := index.Search(ctx, "missing", 10); err != nil || len(ids) != 0 {
+		t.Errorf("Search before the index exists = %v, %v", ids, err)
+	}
+	if err := index.Index(ctx, []Document{}); err == nil || err.Error() != "meilisearch: 400 Bad Request: bad documents" {
+		t.Errorf("Index of a bad batch = %v", err)
+	}
+	if _, err := NewMeilisearch(server.URL, "", "notes").Search(ctx, "plans", 10); err == nil {
+		t.Error("Search without the key succeeded")
+	}
+}
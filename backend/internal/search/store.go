@@ -0,0 +1,142 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// MaxHits is how many of the best matches of a search are listed; the
+// rest are left out, and out of totals.
+const MaxHits = 1000
+
+// Store answers the text searches of ListNotes from the index. Searches of
+// the trash, which the index leaves out, still go to the database, as do
+// the terms of several words in a search, phrases and the like, which not
+// every index matches as typed.
+type Store struct {
+	store.Store
+	indexer *Indexer
+}
+
+var (
+	_ store.Store         = (*Store)(nil)
+	_ store.NoteEstimator = (*Store)(nil)
+)
+
+func NewStore(inner store.Store, indexer *Indexer) *Store {
+	return &Store{Store: inner, indexer: indexer}
+}
+
+// ListNotes lists the notes the index matches that pass the rest of the
+// filter. Without a sort of their own they come by relevance, after
+// pinned notes as always.
+func (s *Store) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	if filter.Query == "" || filter.Trashed {
+		return s.Store.ListNotes(ctx, filter)
+	}
+	ids, err := s.indexer.Search(ctx, filter.Query, MaxHits)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.Query, filter.IDs = phrases(filter.Query), ids
+	if filter.Sort != "" || filter.After != nil {
+		return s.Store.ListNotes(ctx, filter)
+	}
+
+	all := filter
+	all.Limit, all.Offset, all.SkipCount = max(len(ids), 1), 0, true
+	items, _, err := s.Store.ListNotes(ctx, all)
+	if err != nil {
+		return nil, 0, err
+	}
+	rank := ranks(ids)
+	slices.SortFunc(items, func(a, b store.Note) int {
+		if a.IsPinned != b.IsPinned {
+			if a.IsPinned {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(rank[a.ID], rank[b.ID])
+	})
+	total := len(items)
+	start := min(filter.Offset, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return items[start:end], total, nil
+}
+
+// SuggestTitles suggests the notes the index does, in its order.
+func (s *Store) SuggestTitles(ctx context.Context, prefix string, limit int) ([]store.Note, error) {
+	ids, err := s.indexer.Suggest(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	items, _, err := s.Store.ListNotes(ctx, store.NoteFilter{IDs: ids, Limit: max(len(ids), 1), SkipCount: true})
+	if err != nil {
+		return nil, err
+	}
+	rank := ranks(ids)
+	slices.SortFunc(items, func(a, b store.Note) int { return cmp.Compare(rank[a.ID], rank[b.ID]) })
+	return items, nil
+}
+
+// SearchAttachments searches attachments by the index, in its order,
+// leaving the phrases of the query to the database as ListNotes does.
+func (s *Store) SearchAttachments(ctx context.Context, filter store.AttachmentFilter) ([]store.Attachment, error) {
+	if filter.Query == "" {
+		return s.Store.SearchAttachments(ctx, filter)
+	}
+	ids, err := s.indexer.SearchAttachments(ctx, filter.Query, MaxHits)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.Store.SearchAttachments(ctx, store.AttachmentFilter{Query: phrases(filter.Query), IDs: ids, Limit: max(len(ids), 1)})
+	if err != nil {
+		return nil, err
+	}
+	rank := ranks(ids)
+	slices.SortFunc(items, func(a, b store.Attachment) int { return cmp.Compare(rank[a.ID], rank[b.ID]) })
+	if filter.Limit > 0 && len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	return items, nil
+}
+
+// EstimateNotes leaves searches to be counted, which the database cannot
+// estimate.
+func (s *Store) EstimateNotes(ctx context.Context, filter store.NoteFilter) (int, error) {
+	estimator, ok := s.Store.(store.NoteEstimator)
+	if !ok || filter.Query != "" {
+		return -1, nil
+	}
+	return estimator.EstimateNotes(ctx, filter)
+}
+
+// phrases returns the terms of query of several words, quoted again.
+func phrases(query string) string {
+	var kept []string
+	for _, t := range store.ParseTerms(query) {
+		if len(tokenize(t.Text)) > 1 {
+			kept = append(kept, term(t.Text, true, t.Exclude))
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// ranks maps each of ids to its place in them.
+func ranks(ids []uuid.UUID) map[uuid.UUID]int {
+	rank := make(map[uuid.UUID]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	return rank
+}
@@ -0,0 +1,147 @@
+// Package seed generates fake but plausible notes for local development and
+// for benchmarking search and pagination against a realistically sized
+// database.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+var tagPool = []string{
+	"work", "personal", "ideas", "todo", "reading", "meeting", "project",
+	"recipe", "travel", "health", "finance", "journal", "code", "design",
+	"research", "books", "movies", "shopping", "family", "learning",
+}
+
+var titleSubjects = []string{
+	"Quarterly planning", "Grocery list", "Book notes", "Weekend trip",
+	"Standup", "Release checklist", "Workout plan", "Budget review",
+	"Reading list", "Interview prep", "Garden", "Birthday ideas",
+	"Database migration", "Onboarding", "Retrospective", "Podcast ideas",
+	"Apartment search", "Conference talk", "Bug triage", "Recipe",
+}
+
+var titleSuffixes = []string{
+	"", "", "", " draft", " v2", " follow-up", " notes", " (old)", " summary", " — open questions",
+}
+
+var words = strings.Fields(`
+	the a to and of in for on with that this is it as we be at by from or
+	meeting plan next week follow up review draft idea budget release team
+	call notes list book chapter trip ticket bug fix design sketch outline
+	question answer deadline priority task shopping milk bread coffee run
+	gym read write ship deploy test migrate server database search page
+	remember check schedule friday monday morning evening project customer
+	quickly later maybe important tiny huge simple careful again everyone
+`)
+
+// Generate returns count notes with varied titles, body sizes, tags and
+// favorites, created and updated at random moments during the year before
+// now. It does not touch any store.
+func Generate(rng *rand.Rand, count int, now time.Time) []store.Note {
+	notes := make([]store.Note, 0, count)
+	for range count {
+		created := now.Add(-time.Duration(rng.Int64N(int64(365 * 24 * time.Hour))))
+		updated := created
+		if rng.IntN(3) > 0 {
+			updated = created.Add(time.Duration(rng.Int64N(int64(now.Sub(created)) + 1)))
+		}
+
+		n := store.Note{
+			ID:         uuid.New(),
+			Title:      titleSubjects[rng.IntN(len(titleSubjects))] + titleSuffixes[rng.IntN(len(titleSuffixes))],
+			Content:    content(rng),
+			Tags:       tags(rng),
+			IsFavorite: rng.IntN(100) < 15,
+			CreatedAt:  created.UTC().Truncate(time.Microsecond),
+			UpdatedAt:  updated.UTC().Truncate(time.Microsecond),
+		}
+		n.SetStats(store.MeasureText(n.Content))
+		notes = append(notes, n)
+	}
+	return notes
+}
+
+// Insert writes notes to st, calling progress after every batch of writes.
+func Insert(ctx context.Context, st store.NoteStore, notes []store.Note, progress func(done int)) error {
+	for i, n := range notes {
+		if err := st.InsertNote(ctx, n); err != nil {
+			return fmt.Errorf("seed note %d: %w", i+1, err)
+		}
+		if progress != nil && ((i+1)%500 == 0 || i+1 == len(notes)) {
+			progress(i + 1)
+		}
+	}
+	return nil
+}
+
+// content mixes one-liners, a few paragraphs, checklists and long
+// documents, so that list payloads and search scans see realistic sizes.
+func content(rng *rand.Rand) string {
+	switch kind := rng.IntN(10); {
+	case kind < 3:
+		return sentence(rng)
+	case kind < 5:
+		var b strings.Builder
+		for i := range 3 + rng.IntN(8) {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			done := " "
+			if rng.IntN(3) == 0 {
+				done = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] %s", done, sentence(rng))
+		}
+		return b.String()
+	case kind < 9:
+		return paragraphs(rng, 1+rng.IntN(4))
+	default:
+		return "# " + sentence(rng) + "\n\n" + paragraphs(rng, 10+rng.IntN(30))
+	}
+}
+
+func paragraphs(rng *rand.Rand, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		sentences := make([]string, 2+rng.IntN(6))
+		for j := range sentences {
+			sentences[j] = sentence(rng)
+		}
+		parts[i] = strings.Join(sentences, " ")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func sentence(rng *rand.Rand) string {
+	n := 4 + rng.IntN(12)
+	picked := make([]string, n)
+	for i := range picked {
+		picked[i] = words[rng.IntN(len(words))]
+	}
+	s := strings.Join(picked, " ")
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+// tags favours the first entries of tagPool, so a handful of tags are
+// common and the rest are rare, like a real collection.
+func tags(rng *rand.Rand) []string {
+	n := rng.IntN(5)
+	result := make([]string, 0, n)
+	for len(result) < n {
+		tag := tagPool[int(float64(len(tagPool))*rng.Float64()*rng.Float64())]
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,320 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Runner struct {
+	baseURL  string
+	password string
+	client   *http.Client
+	out      io.Writer
+
+	marker      string
+	noteID      string
+	noteVersion int64
+}
+
+type step struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type note struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags"`
+	IsFavorite bool     `json:"is_favorite"`
+	Version    int64    `json:"version"`
+}
+
+type noteList struct {
+	Items []note `json:"items"`
+	Total int    `json:"total"`
+}
+
+func New(baseURL, password string, client *http.Client, out io.Writer) (*Runner, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create cookie jar: %w", err)
+	}
+	withJar := *client
+	withJar.Jar = jar
+	if withJar.Timeout == 0 {
+		withJar.Timeout = 15 * time.Second
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("generate marker: %w", err)
+	}
+
+	return &Runner{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		password: password,
+		client:   &withJar,
+		out:      out,
+		marker:   "selftest-" + hex.EncodeToString(suffix),
+	}, nil
+}
+
+// Run executes every step in order and stops at the first failure, since
+// later steps depend on state created by earlier ones. The note created by
+// the run is removed even when a step fails.
+func (r *Runner) Run(ctx context.Context) error {
+	steps := []step{
+		{"health", r.checkHealth},
+		{"login rejects wrong password", r.checkWrongPassword},
+		{"login", r.checkLogin},
+		{"create note", r.checkCreate},
+		{"get note", r.checkGet},
+		{"update note", r.checkUpdate},
+		{"search by query", r.checkSearch},
+		{"filter by tag", r.checkTagFilter},
+		{"favorite note", r.checkFavorite},
+		{"delete note", r.checkDelete},
+		{"logout", r.checkLogout},
+	}
+
+	passed := 0
+	var failure error
+	for _, st := range steps {
+		started := time.Now()
+		if err := st.run(ctx); err != nil {
+			fmt.Fprintf(r.out, "FAIL %s: %v\n", st.name, err)
+			failure = fmt.Errorf("%s: %w", st.name, err)
+			break
+		}
+		passed++
+		fmt.Fprintf(r.out, "PASS %s (%s)\n", st.name, time.Since(started).Round(time.Millisecond))
+	}
+
+	r.cleanup(ctx)
+
+	if failure != nil {
+		fmt.Fprintf(r.out, "selftest failed: %d/%d steps passed\n", passed, len(steps))
+		return failure
+	}
+	fmt.Fprintf(r.out, "selftest passed: %d/%d steps\n", passed, len(steps))
+	return nil
+}
+
+func (r *Runner) checkHealth(ctx context.Context) error {
+	var payload map[string]string
+	if err := r.do(ctx, http.MethodGet, "/health", nil, http.StatusOK, &payload); err != nil {
+		return err
+	}
+	if payload["status"] != "ok" {
+		return fmt.Errorf("unexpected status %q", payload["status"])
+	}
+	return nil
+}
+
+func (r *Runner) checkWrongPassword(ctx context.Context) error {
+	body := map[string]string{"password": r.password + "-wrong"}
+	return r.do(ctx, http.MethodPost, "/auth/login", body, http.StatusUnauthorized, nil)
+}
+
+func (r *Runner) checkLogin(ctx context.Context) error {
+	body := map[string]string{"password": r.password}
+	if err := r.do(ctx, http.MethodPost, "/auth/login", body, http.StatusOK, nil); err != nil {
+		return err
+	}
+	return r.expectAuthenticated(ctx, true)
+}
+
+func (r *Runner) checkCreate(ctx context.Context) error {
+	body := map[string]any{
+		"title":   r.marker,
+		"content": "# Selftest\n\nCreated by the selftest command: " + r.marker,
+		"tags":    []string{r.marker},
+	}
+	var created note
+	if err := r.do(ctx, http.MethodPost, "/notes", body, http.StatusCreated, &created); err != nil {
+		return err
+	}
+	if created.ID == "" {
+		return fmt.Errorf("created note has no id")
+	}
+	r.noteID = created.ID
+	r.noteVersion = created.Version
+	if created.Title != r.marker {
+		return fmt.Errorf("title = %q, want %q", created.Title, r.marker)
+	}
+	return nil
+}
+
+func (r *Runner) checkGet(ctx context.Context) error {
+	var fetched note
+	if err := r.do(ctx, http.MethodGet, "/notes/"+r.noteID, nil, http.StatusOK, &fetched); err != nil {
+		return err
+	}
+	if fetched.ID != r.noteID || fetched.Title != r.marker {
+		return fmt.Errorf("fetched note does not match created note")
+	}
+	return nil
+}
+
+func (r *Runner) checkUpdate(ctx context.Context) error {
+	title := r.marker + " updated"
+	body := map[string]any{
+		"title":   title,
+		"content": "Updated by the selftest command: " + r.marker,
+		"tags":    []string{r.marker, "selftest"},
+	}
+	ifMatch := http.Header{"If-Match": {fmt.Sprintf(`"%d"`, r.noteVersion)}}
+	var updated note
+	if err := r.doWith(ctx, http.MethodPut, "/notes/"+r.noteID, ifMatch, body, http.StatusOK, &updated); err != nil {
+		return err
+	}
+	if updated.Title != title {
+		return fmt.Errorf("title = %q, want %q", updated.Title, title)
+	}
+	if len(updated.Tags) != 2 {
+		return fmt.Errorf("tags = %v, want 2 tags", updated.Tags)
+	}
+	if updated.Version != r.noteVersion+1 {
+		return fmt.Errorf("version = %d, want %d", updated.Version, r.noteVersion+1)
+	}
+
+	// The version the first update was made against is stale now.
+	return r.doWith(ctx, http.MethodPut, "/notes/"+r.noteID, ifMatch, body, http.StatusPreconditionFailed, nil)
+}
+
+func (r *Runner) checkSearch(ctx context.Context) error {
+	return r.expectListed(ctx, url.Values{"query": {r.marker}})
+}
+
+func (r *Runner) checkTagFilter(ctx context.Context) error {
+	return r.expectListed(ctx, url.Values{"tag": {r.marker}})
+}
+
+func (r *Runner) checkFavorite(ctx context.Context) error {
+	var favorited note
+	body := map[string]bool{"value": true}
+	if err := r.do(ctx, http.MethodPost, "/notes/"+r.noteID+"/favorite", body, http.StatusOK, &favorited); err != nil {
+		return err
+	}
+	if !favorited.IsFavorite {
+		return fmt.Errorf("note is not marked as favorite")
+	}
+	return r.expectListed(ctx, url.Values{"favorite": {"true"}, "tag": {r.marker}})
+}
+
+func (r *Runner) checkDelete(ctx context.Context) error {
+	if err := r.do(ctx, http.MethodDelete, "/notes/"+r.noteID, nil, http.StatusNoContent, nil); err != nil {
+		return err
+	}
+	if err := r.do(ctx, http.MethodGet, "/notes/"+r.noteID, nil, http.StatusNotFound, nil); err != nil {
+		return fmt.Errorf("deleted note still reachable: %w", err)
+	}
+	// Deleting only trashes the note; purge it so runs leave nothing behind.
+	if err := r.do(ctx, http.MethodDelete, "/notes/"+r.noteID+"/purge", nil, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("purge trashed note: %w", err)
+	}
+	r.noteID = ""
+	return nil
+}
+
+func (r *Runner) checkLogout(ctx context.Context) error {
+	if err := r.do(ctx, http.MethodPost, "/auth/logout", nil, http.StatusOK, nil); err != nil {
+		return err
+	}
+	return r.expectAuthenticated(ctx, false)
+}
+
+func (r *Runner) cleanup(ctx context.Context) {
+	if r.noteID == "" {
+		return
+	}
+	if err := r.do(ctx, http.MethodDelete, "/notes/"+r.noteID+"/purge", nil, http.StatusNoContent, nil); err != nil {
+		fmt.Fprintf(r.out, "WARN cleanup of note %s failed: %v\n", r.noteID, err)
+	}
+}
+
+func (r *Runner) expectAuthenticated(ctx context.Context, want bool) error {
+	var status struct {
+		Authenticated bool `json:"authenticated"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/auth/session", nil, http.StatusOK, &status); err != nil {
+		return err
+	}
+	if status.Authenticated != want {
+		return fmt.Errorf("authenticated = %t, want %t", status.Authenticated, want)
+	}
+	return nil
+}
+
+func (r *Runner) expectListed(ctx context.Context, params url.Values) error {
+	var list noteList
+	if err := r.do(ctx, http.MethodGet, "/notes?"+params.Encode(), nil, http.StatusOK, &list); err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		if item.ID == r.noteID {
+			return nil
+		}
+	}
+	return fmt.Errorf("note %s missing from /notes?%s (%d results)", r.noteID, params.Encode(), list.Total)
+}
+
+func (r *Runner) do(ctx context.Context, method, path string, body any, wantStatus int, out any) error {
+	return r.doWith(ctx, method, path, nil, body, wantStatus, out)
+}
+
+func (r *Runner) doWith(ctx context.Context, method, path string, header http.Header, body any, wantStatus int, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, wantStatus, strings.TrimSpace(string(payload)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(payload, out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
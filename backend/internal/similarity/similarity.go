@@ -0,0 +1,175 @@
+// Package similarity finds texts that say nearly the same thing. Texts are
+// compared by their character trigrams, which survive small edits, typos
+// and reflowed lines; MinHash signatures and locality-sensitive hashing
+// pick the pairs worth comparing, so a collection is not compared with
+// itself pair by pair.
+package similarity
+
+import (
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// bands of rows each make up a signature. A pair is compared when all
+	// the rows of one band agree, which pairs at 0.5 similarity do about
+	// two times in three and pairs at 0.8 almost always.
+	bands = 16
+	rows  = 4
+)
+
+// MinThreshold is the lowest similarity Pairs finds reliably; below it,
+// similar pairs are more and more often never compared.
+const MinThreshold = 0.5
+
+// Shingles returns the distinct trigrams of text, hashed and sorted. Case
+// is kept, so callers fold text first if it should not count; anything
+// but letters and digits only separates words.
+func Shingles(text string) []uint64 {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	runes := []rune(strings.Join(words, " "))
+	if len(runes) == 0 {
+		return nil
+	}
+	if len(runes) < 3 {
+		return []uint64{hash(runes)}
+	}
+	shingles := make([]uint64, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		shingles = append(shingles, hash(runes[i:i+3]))
+	}
+	slices.Sort(shingles)
+	return slices.Compact(shingles)
+}
+
+func hash(runes []rune) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(string(runes)))
+	return h.Sum64()
+}
+
+// Jaccard is the share of the shingles of a and b that both have.
+func Jaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			shared++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Pair is two texts of Pairs, by index, A before B.
+type Pair struct {
+	A, B       int
+	Similarity float64
+}
+
+// Pairs returns the pairs of docs, each from Shingles, at least threshold
+// similar, most similar first. Identical documents are paired only with
+// the first of them, so a text saved many times costs one pair per copy.
+func Pairs(docs [][]uint64, threshold float64) []Pair {
+	var pairs []Pair
+	first := map[string]int{}
+	var unique []int
+	for i, doc := range docs {
+		if len(doc) == 0 {
+			continue
+		}
+		key := setKey(doc)
+		if j, ok := first[key]; ok {
+			pairs = append(pairs, Pair{A: j, B: i, Similarity: 1})
+			continue
+		}
+		first[key] = i
+		unique = append(unique, i)
+	}
+
+	seen := map[[2]int]bool{}
+	for band := 0; band < bands; band++ {
+		buckets := map[[rows]uint64][]int{}
+		for _, i := range unique {
+			var key [rows]uint64
+			for r := range key {
+				key[r] = minHash(docs[i], uint64(band*rows+r))
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, members := range buckets {
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					pair := [2]int{members[x], members[y]}
+					if seen[pair] {
+						continue
+					}
+					seen[pair] = true
+					if sim := Jaccard(docs[pair[0]], docs[pair[1]]); sim >= threshold {
+						pairs = append(pairs, Pair{A: pair[0], B: pair[1], Similarity: sim})
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(pairs, func(p, q Pair) int {
+		if p.Similarity != q.Similarity {
+			if p.Similarity > q.Similarity {
+				return -1
+			}
+			return 1
+		}
+		if p.A != q.A {
+			return p.A - q.A
+		}
+		return p.B - q.B
+	})
+	return pairs
+}
+
+// setKey identifies a set of shingles exactly.
+func setKey(doc []uint64) string {
+	var b strings.Builder
+	b.Grow(len(doc) * 8)
+	for _, s := range doc {
+		for shift := 0; shift < 64; shift += 8 {
+			b.WriteByte(byte(s >> shift))
+		}
+	}
+	return b.String()
+}
+
+// minHash is the smallest of doc's shingles under the seed'th hash
+// function.
+func minHash(doc []uint64, seed uint64) uint64 {
+	lowest := uint64(math.MaxUint64)
+	for _, s := range doc {
+		lowest = min(lowest, mix(s^(seed*0x9e3779b97f4a7c15)))
+	}
+	return lowest
+}
+
+// mix is the finalizer of SplitMix64, which spreads every input bit over
+// the whole output.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,57 @@
+package similarity
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestPairs(t *testing.T) {
+	texts := []string{
+		"Shopping list: eggs, milk, flour, butter and a bag of apples for the pie.",
+		"Meeting notes from Monday: the release moves to next week.",
+		"Shopping list - eggs, milk, flour, butter and a bag of apples for pie",
+		"Shopping list: eggs, milk, flour, butter and a bag of apples for the pie.",
+		"",
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 50; i++ {
+		text := make([]byte, 60)
+		for j := range text {
+			text[j] = "abcdefghijklmnopqrstuvwxyz   "[rng.IntN(29)]
+		}
+		texts = append(texts, string(text))
+	}
+	docs := make([][]uint64, len(texts))
+	for i, text := range texts {
+		docs[i] = Shingles(text)
+	}
+
+	pairs := Pairs(docs, 0.8)
+	want := map[[2]int]bool{{0, 3}: true, {0, 2}: true}
+	if len(pairs) != len(want) {
+		t.Fatalf("pairs = %v", pairs)
+	}
+	for _, p := range pairs {
+		if !want[[2]int{p.A, p.B}] {
+			t.Errorf("unexpected pair %v", p)
+		}
+	}
+	if pairs[0] != (Pair{A: 0, B: 3, Similarity: 1}) {
+		t.Errorf("first pair = %v", pairs[0])
+	}
+	if pairs[1].Similarity >= 1 || pairs[1].Similarity < 0.8 {
+		t.Errorf("near duplicate similarity = %v", pairs[1].Similarity)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	if got := Jaccard(Shingles("abcd"), Shingles("abcd")); got != 1 {
+		t.Errorf("identical = %v", got)
+	}
+	if got := Jaccard(Shingles("abcd"), Shingles("wxyz")); got != 0 {
+		t.Errorf("disjoint = %v", got)
+	}
+	if got := Jaccard(nil, Shingles("ab")); got != 0 {
+		t.Errorf("empty = %v", got)
+	}
+}
@@ -0,0 +1,38 @@
+// Package storage keeps attachment bytes outside the database, on local
+// disk or in an S3-compatible bucket. The database only records metadata
+// and the key the bytes are stored under.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any blob
+	// already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the blob under key; the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key. Deleting a missing blob is not an
+	// error, so interrupted cleanups can be retried.
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is a blob as List finds it.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Lister is implemented by stores that can enumerate their blobs, which
+// attachments never need but backups do, to find the old ones.
+type Lister interface {
+	// List returns the blobs whose keys start with prefix, by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText puts s in NFC so that composed and decomposed spellings of
+// the same text are stored and compared identically.
+func NormalizeText(s string) string {
+	return norm.NFC.String(s)
+}
+
+// FoldText is the search key for s: lower case with diacritics removed, so
+// that "Café", "cafe" and "CAFÉ" all compare equal. Stores without a
+// database-side unaccent use it for both the query and the searched text.
+func FoldText(s string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxLinksPerNote bounds the link rows one note can write.
+	maxLinksPerNote = 500
+	// maxLinkTarget keeps targets within the key length of MySQL indexes;
+	// longer ones are not links.
+	maxLinkTarget = 500
+)
+
+var (
+	wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|[^\[\]\n]*)?\]\]`)
+	codeSpanPattern = regexp.MustCompile("`[^`\n]*`")
+)
+
+// LinkTargets returns what the [[target]] and [[target|label]] links in
+// content point at, in order of first appearance: a note ID in canonical
+// form when target parses as one, else a title, NFC-normalized. Links in
+// code spans and fenced blocks are not links.
+func LinkTargets(content string) []string {
+	var (
+		targets []string
+		seen    = make(map[string]bool)
+		fenced  bool
+	)
+	for _, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		line = codeSpanPattern.ReplaceAllString(line, "")
+		for _, m := range wikiLinkPattern.FindAllStringSubmatch(line, -1) {
+			target := NormalizeText(strings.TrimSpace(m[1]))
+			if id, err := uuid.Parse(target); err == nil {
+				target = id.String()
+			}
+			if target == "" || utf8.RuneCountInString(target) > maxLinkTarget || seen[target] {
+				continue
+			}
+			seen[target] = true
+			targets = append(targets, target)
+			if len(targets) == maxLinksPerNote {
+				return targets
+			}
+		}
+	}
+	return targets
+}
@@ -0,0 +1,1894 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	mu        sync.RWMutex
+	notes     map[uuid.UUID]store.Note
+	notebooks map[uuid.UUID]store.Notebook
+	sessions  map[string]store.Session
+	// tokens maps the hash of each API token's secret to the token.
+	tokens    map[string]store.APIToken
+	shares    map[uuid.UUID]store.NoteShare
+	links     map[uuid.UUID][]string
+	webhooks  map[uuid.UUID]store.Webhook
+	templates map[uuid.UUID]store.Template
+	searches  map[uuid.UUID]store.SavedSearch
+	changeSeq int64
+	settings  []byte
+	// revisions holds each note's revisions, oldest first.
+	revisions   map[uuid.UUID][]store.Revision
+	attachments map[uuid.UUID]store.Attachment
+	// audit holds the audit log in the order it was written.
+	audit []store.AuditEntry
+	// access holds when each note was opened, in the order logged.
+	access map[uuid.UUID][]time.Time
+	// daily maps each day to its journal note.
+	daily map[string]uuid.UUID
+	// twoFactor is nil while no second factor is set up; recoveryCodes
+	// holds the hashes of its unused recovery codes.
+	twoFactor     *store.TwoFactor
+	recoveryCodes map[string]bool
+	idempotency   map[string]store.IdempotentRequest
+	// noteSeqs holds the changeSeq that counted each note's last write and
+	// tombstones that of each purge.
+	noteSeqs   map[uuid.UUID]int64
+	tombstones map[uuid.UUID]int64
+}
+
+var _ store.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		notes:       make(map[uuid.UUID]store.Note),
+		notebooks:   make(map[uuid.UUID]store.Notebook),
+		sessions:    make(map[string]store.Session),
+		tokens:      make(map[string]store.APIToken),
+		shares:      make(map[uuid.UUID]store.NoteShare),
+		links:       make(map[uuid.UUID][]string),
+		webhooks:    make(map[uuid.UUID]store.Webhook),
+		templates:   make(map[uuid.UUID]store.Template),
+		searches:    make(map[uuid.UUID]store.SavedSearch),
+		revisions:   make(map[uuid.UUID][]store.Revision),
+		attachments: make(map[uuid.UUID]store.Attachment),
+		access:      make(map[uuid.UUID][]time.Time),
+		daily:       make(map[string]uuid.UUID),
+		idempotency: make(map[string]store.IdempotentRequest),
+		noteSeqs:    make(map[uuid.UUID]int64),
+		tombstones:  make(map[uuid.UUID]int64),
+	}
+}
+
+func (s *Store) Close() {}
+
+func (s *Store) ChangeSeq(_ context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changeSeq, nil
+}
+
+// put stores a note written by the change about to be counted.
+func (s *Store) put(n store.Note) {
+	s.notes[n.ID] = n
+	s.noteSeqs[n.ID] = s.changeSeq + 1
+}
+
+func (s *Store) ListNoteChanges(ctx context.Context, since int64, limit int) (store.ChangePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seq := func(context.Context) (int64, error) { return s.changeSeq, nil }
+	return store.PageChanges(ctx, since, limit, seq, s.noteChanges)
+}
+
+// noteChanges answers q; every write is counted as it is made, so none is
+// ever pending.
+func (s *Store) noteChanges(_ context.Context, q store.ChangeQuery) ([]store.NoteChange, error) {
+	if q.Pending {
+		return nil, nil
+	}
+	match := func(seq int64) bool {
+		if q.At > 0 {
+			return seq == q.At
+		}
+		return seq > q.After
+	}
+	var changes []store.NoteChange
+	for id, seq := range s.noteSeqs {
+		if match(seq) {
+			n := cloneNote(s.notes[id])
+			changes = append(changes, store.NoteChange{Seq: seq, ID: id, Note: &n})
+		}
+	}
+	for id, seq := range s.tombstones {
+		if match(seq) {
+			changes = append(changes, store.NoteChange{Seq: seq, ID: id})
+		}
+	}
+	return store.SortChanges(changes, q.Limit), nil
+}
+
+func (s *Store) Settings(_ context.Context) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.settings == nil {
+		return []byte("{}"), nil
+	}
+	return slices.Clone(s.settings), nil
+}
+
+func (s *Store) SaveSettings(_ context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = slices.Clone(data)
+	return nil
+}
+
+func (s *Store) ListNotes(_ context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids map[uuid.UUID]bool
+	if filter.IDs != nil {
+		ids = make(map[uuid.UUID]bool, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids[id] = true
+		}
+	}
+	matched := make([]store.Note, 0, len(s.notes))
+	for _, n := range s.notes {
+		if (n.DeletedAt != nil) != filter.Trashed {
+			continue
+		}
+		if ids != nil && !ids[n.ID] {
+			continue
+		}
+		content := n.Content
+		if filter.TitleOnly || n.IsEncrypted {
+			content = ""
+		}
+		if !matchesTerms(filter.Query, n.Title, content) || !matchesTerms(filter.TitleQuery, n.Title, "") {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(n.Tags, filter.Tag) {
+			continue
+		}
+		if slices.ContainsFunc(filter.Tags, func(t string) bool { return !slices.Contains(n.Tags, t) }) ||
+			slices.ContainsFunc(filter.ExcludeTags, func(t string) bool { return slices.Contains(n.Tags, t) }) {
+			continue
+		}
+		if filter.Favorite != nil && n.IsFavorite != *filter.Favorite {
+			continue
+		}
+		if filter.Archived != nil && n.IsArchived != *filter.Archived {
+			continue
+		}
+		if filter.Notebook != nil && notebookOf(n) != *filter.Notebook {
+			continue
+		}
+		if filter.Color != nil && n.Color != *filter.Color {
+			continue
+		}
+		if filter.Near != nil && !within(n, *filter.Near) {
+			continue
+		}
+		if !filter.CreatedFrom.IsZero() && n.CreatedAt.Before(filter.CreatedFrom) {
+			continue
+		}
+		if !filter.CreatedTo.IsZero() && !n.CreatedAt.Before(filter.CreatedTo) {
+			continue
+		}
+		matched = append(matched, cloneNote(n))
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return listsBefore(filter, matched[i], matched[j])
+	})
+
+	total := len(matched)
+	if after := filter.After; after != nil && !after.UpdatedAt.IsZero() {
+		matched = slices.DeleteFunc(matched, func(n store.Note) bool {
+			return !comesAfter(n, *after)
+		})
+	}
+	start := min(filter.Offset, len(matched))
+	end := len(matched)
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, len(matched))
+	}
+	return matched[start:end], total, nil
+}
+
+// matchesTerms reports whether title or content has each term of query,
+// or it with a typo, and neither has its excluded terms, as the SQL stores'
+// LIKE patterns find them.
+func matchesTerms(query, title, content string) bool {
+	title, content = store.FoldText(title), store.FoldText(content)
+	for _, term := range store.ParseTerms(query) {
+		text := store.FoldText(term.Text)
+		if term.Exclude {
+			if strings.Contains(title, text) || strings.Contains(content, text) {
+				return false
+			}
+		} else if !store.ContainsTypo(title, text) && !store.ContainsTypo(content, text) {
+			return false
+		}
+	}
+	return true
+}
+
+// listsBefore reports whether a comes before b in the filter's order, the
+// same as the SQL stores' ORDER BY. Ties end on the ID, compared as the
+// text the SQL stores compare.
+func listsBefore(filter store.NoteFilter, a, b store.Note) bool {
+	if filter.Trashed && filter.After == nil {
+		return a.DeletedAt.After(*b.DeletedAt)
+	}
+	if a.IsPinned != b.IsPinned {
+		return a.IsPinned
+	}
+	sortBy := filter.Sort
+	if filter.After != nil {
+		sortBy = store.SortUpdated
+	}
+	switch sortBy {
+	case store.SortCreated:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	case store.SortTitle:
+		if ta, tb := store.FoldText(a.Title), store.FoldText(b.Title); ta != tb {
+			return ta < tb
+		}
+	case store.SortManual:
+		if a.SortPosition != b.SortPosition {
+			return a.SortPosition < b.SortPosition
+		}
+	case store.SortLength:
+		if a.WordCount != b.WordCount {
+			return a.WordCount > b.WordCount
+		}
+	}
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	return a.ID.String() > b.ID.String()
+}
+
+// comesAfter reports whether n lists after the cursor position.
+func comesAfter(n store.Note, c store.Cursor) bool {
+	if n.IsPinned != c.Pinned {
+		return c.Pinned
+	}
+	if !n.UpdatedAt.Equal(c.UpdatedAt) {
+		return n.UpdatedAt.Before(c.UpdatedAt)
+	}
+	return n.ID.String() < c.ID.String()
+}
+
+func (s *Store) GetNote(_ context.Context, id uuid.UUID) (store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	return cloneNote(n), nil
+}
+
+// live returns the note with id unless it is missing or in the trash.
+func (s *Store) live(id uuid.UUID) (store.Note, bool) {
+	n, ok := s.notes[id]
+	return n, ok && n.DeletedAt == nil
+}
+
+func (s *Store) CreateNote(_ context.Context, input store.NoteInput, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := store.Note{
+		ID:         uuid.New(),
+		Title:      input.Title,
+		Content:    input.Content,
+		Tags:       slices.Clone(input.Tags),
+		IsFavorite: input.IsFavorite,
+		Language:   store.LanguageOr(input.Language, store.DefaultLanguage),
+		NotebookID: notebookRef(input.NotebookID),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Version:    1,
+	}
+	n.SetStats(input.ContentStats())
+	n.SetLocation(input.Location)
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) InsertNote(_ context.Context, note store.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[note.ID]; ok {
+		return fmt.Errorf("insert note: note %s already exists", note.ID)
+	}
+	note.Language = store.LanguageOr(note.Language, store.DefaultLanguage)
+	note.Version = max(note.Version, 1)
+	note.SetStats(store.TextStats{Words: note.WordCount, Chars: note.CharCount})
+	s.put(cloneNote(note))
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) InsertNotes(_ context.Context, notes []store.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, note := range notes {
+		if _, ok := s.notes[note.ID]; ok {
+			return fmt.Errorf("insert notes: note %s already exists", note.ID)
+		}
+	}
+	for _, note := range notes {
+		note.Language = store.LanguageOr(note.Language, store.DefaultLanguage)
+		note.Version = max(note.Version, 1)
+		note.SetStats(store.TextStats{Words: note.WordCount, Chars: note.CharCount})
+		s.put(cloneNote(note))
+	}
+	if len(notes) > 0 {
+		s.changeSeq++
+	}
+	return nil
+}
+
+func (s *Store) InsertSnapshot(_ context.Context, notebooks []store.Notebook, notes []store.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, note := range notes {
+		if _, ok := s.notes[note.ID]; ok {
+			return fmt.Errorf("insert snapshot: note %s already exists", note.ID)
+		}
+	}
+	for _, nb := range notebooks {
+		if _, ok := s.notebooks[nb.ID]; ok {
+			return fmt.Errorf("insert snapshot: notebook %s already exists", nb.ID)
+		}
+	}
+	for _, nb := range notebooks {
+		s.notebooks[nb.ID] = nb
+	}
+	for _, note := range notes {
+		note.Language = store.LanguageOr(note.Language, store.DefaultLanguage)
+		note.Version = max(note.Version, 1)
+		note.SetStats(store.TextStats{Words: note.WordCount, Chars: note.CharCount})
+		s.put(cloneNote(note))
+	}
+	if len(notes) > 0 {
+		s.changeSeq++
+	}
+	return nil
+}
+
+func (s *Store) UpdateNote(_ context.Context, id uuid.UUID, input store.NoteInput, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	if input.IfVersion != 0 && input.IfVersion != n.Version {
+		return store.Note{}, store.ErrConflict
+	}
+	n = applyInput(n, input, now)
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func applyInput(n store.Note, input store.NoteInput, now time.Time) store.Note {
+	n.Title = input.Title
+	n.Content = input.Content
+	n.Tags = slices.Clone(input.Tags)
+	n.IsFavorite = input.IsFavorite
+	n.Language = store.LanguageOr(input.Language, n.Language)
+	if input.NotebookID != nil {
+		n.NotebookID = notebookRef(input.NotebookID)
+	}
+	if input.SetLocation {
+		n.SetLocation(input.Location)
+	}
+	n.SetStats(input.ContentStats())
+	n.UpdatedAt = now
+	n.Version++
+	return n
+}
+
+func (s *Store) DeleteNote(_ context.Context, id uuid.UUID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.ErrNotFound
+	}
+	n.DeletedAt = &now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) RestoreNote(_ context.Context, id uuid.UUID) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[id]
+	if !ok || n.DeletedAt == nil {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.DeletedAt = nil
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) PurgeNote(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[id]; !ok {
+		return store.ErrNotFound
+	}
+	s.purge(id)
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) PurgeDeleted(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, n := range s.notes {
+		if n.DeletedAt != nil && n.DeletedAt.Before(before) {
+			s.purge(id)
+			purged++
+		}
+	}
+	if purged > 0 {
+		s.changeSeq++
+	}
+	return purged, nil
+}
+
+// purge drops a note with its revisions, share, links, opens and days and
+// detaches its attachments, as the foreign keys do in the SQL stores.
+func (s *Store) purge(id uuid.UUID) {
+	delete(s.notes, id)
+	delete(s.noteSeqs, id)
+	s.tombstones[id] = s.changeSeq + 1
+	delete(s.revisions, id)
+	delete(s.access, id)
+	delete(s.shares, id)
+	delete(s.links, id)
+	for day, noteID := range s.daily {
+		if noteID == id {
+			delete(s.daily, day)
+		}
+	}
+	for _, a := range s.attachments {
+		if a.NoteID == id {
+			a.NoteID = uuid.Nil
+			s.attachments[a.ID] = a
+		}
+	}
+}
+
+func (s *Store) SetFavorite(_ context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.IsFavorite = value
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) SetPinned(_ context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.IsPinned = value
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) SetAppearance(_ context.Context, id uuid.UUID, color, icon string, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.Color = color
+	n.Icon = icon
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) SetSchedule(_ context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.DueAt = dueAt
+	n.ReminderAt = reminderAt
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) ListScheduledNotes(_ context.Context) ([]store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []store.Note{}
+	for _, n := range s.notes {
+		if n.DeletedAt == nil && (n.DueAt != nil || n.ReminderAt != nil) {
+			items = append(items, cloneNote(n))
+		}
+	}
+	slices.SortFunc(items, func(a, b store.Note) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items, nil
+}
+
+func (s *Store) SetArchived(_ context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	n.IsArchived = value
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) SetEncrypted(_ context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.live(id)
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	if n.Version != ifVersion {
+		return store.Note{}, store.ErrConflict
+	}
+	n.Content = content
+	n.IsEncrypted = value
+	n.UpdatedAt = now
+	n.Version++
+	s.put(n)
+	if value {
+		delete(s.revisions, id)
+	}
+	s.changeSeq++
+	return cloneNote(n), nil
+}
+
+func (s *Store) ReorderNotes(_ context.Context, ids []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := s.live(id); !ok {
+			return store.ErrNotFound
+		}
+	}
+	for i, id := range ids {
+		n := s.notes[id]
+		n.SortPosition = int64(i + 1)
+		n.Version++
+		s.put(n)
+	}
+	if len(ids) > 0 {
+		s.changeSeq++
+	}
+	return nil
+}
+
+func (s *Store) ApplyBulk(_ context.Context, ops []store.BulkOp, now time.Time) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := make([]bool, len(ops))
+	for i, op := range ops {
+		n, ok := s.live(op.NoteID)
+		if !ok {
+			continue
+		}
+		switch op.Action {
+		case store.BulkDelete:
+			n.DeletedAt = &now
+		case store.BulkTag, store.BulkUntag:
+			n.Tags = op.ApplyTags(n.Tags)
+			n.UpdatedAt = now
+		case store.BulkFavorite:
+			n.IsFavorite = op.Favorite
+			n.UpdatedAt = now
+		case store.BulkMove:
+			n.NotebookID = notebookRef(op.NotebookID)
+			n.UpdatedAt = now
+		}
+		n.Version++
+		s.put(n)
+		applied[i] = true
+	}
+	if slices.Contains(applied, true) {
+		s.changeSeq++
+	}
+	return applied, nil
+}
+
+func (s *Store) MergeNotes(_ context.Context, merge store.NoteMerge, now time.Time) (store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target, ok := s.live(merge.TargetID)
+	source, sourceOK := s.live(merge.SourceID)
+	if !ok || !sourceOK {
+		return store.Note{}, store.ErrNotFound
+	}
+	if (merge.Input.IfVersion != 0 && merge.Input.IfVersion != target.Version) ||
+		(merge.SourceVersion != 0 && merge.SourceVersion != source.Version) {
+		return store.Note{}, store.ErrConflict
+	}
+	if merge.Revision != nil {
+		s.addRevision(*merge.Revision, merge.KeepRevisions)
+	}
+	target = applyInput(target, merge.Input, now)
+	s.put(target)
+	for id, a := range s.attachments {
+		if a.NoteID == source.ID {
+			a.NoteID = target.ID
+			s.attachments[id] = a
+		}
+	}
+	source.DeletedAt = &now
+	source.Version++
+	s.put(source)
+	s.changeSeq++
+	return cloneNote(target), nil
+}
+
+func (s *Store) SetNoteStats(_ context.Context, id uuid.UUID, stats store.TextStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	n.SetStats(stats)
+	s.put(n)
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) ListNoteSizes(_ context.Context) ([]store.NoteSize, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []store.NoteSize{}
+	for _, n := range s.notes {
+		if n.DeletedAt != nil {
+			continue
+		}
+		items = append(items, store.NoteSize{
+			NotebookID: n.NotebookID,
+			Tags:       slices.Clone(n.Tags),
+			Words:      n.WordCount,
+			Chars:      n.CharCount,
+			CreatedAt:  n.CreatedAt,
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) CountNotes(_ context.Context) (store.NoteCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var counter store.NoteCounter
+	for _, n := range s.notes {
+		counter.Add(n.IsFavorite, n.IsArchived, n.DeletedAt != nil, n.NotebookID, n.Tags)
+	}
+	return counter.Counts(), nil
+}
+
+func (s *Store) SuggestTitles(_ context.Context, prefix string, limit int) ([]store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix = store.FoldText(prefix)
+	var matched []store.Note
+	for _, n := range s.notes {
+		if n.DeletedAt == nil && store.ContainsTypo(store.FoldText(n.Title), prefix) {
+			matched = append(matched, cloneNote(n))
+		}
+	}
+	slices.SortFunc(matched, func(a, b store.Note) int {
+		if sa, sb := strings.HasPrefix(store.FoldText(a.Title), prefix), strings.HasPrefix(store.FoldText(b.Title), prefix); sa != sb {
+			if sa {
+				return -1
+			}
+			return 1
+		}
+		if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+	return matched[:min(len(matched), limit)], nil
+}
+
+func (s *Store) ListTags(_ context.Context) ([]store.TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, n := range s.notes {
+		if n.DeletedAt != nil {
+			continue
+		}
+		for _, t := range n.Tags {
+			counts[t]++
+		}
+	}
+	return store.SortTagCounts(counts), nil
+}
+
+func (s *Store) ReplaceTags(_ context.Context, from []string, to string, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := 0
+	for _, n := range s.notes {
+		tags, ok := store.ReplaceTags(n.Tags, from, to)
+		if !ok {
+			continue
+		}
+		n.Tags = tags
+		n.UpdatedAt = now
+		n.Version++
+		s.put(n)
+		changed++
+	}
+	if changed > 0 {
+		s.changeSeq++
+	}
+	return changed, nil
+}
+
+func (s *Store) AddRevision(_ context.Context, note store.Note, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addRevision(note, keep)
+	return nil
+}
+
+func (s *Store) addRevision(note store.Note, keep int) {
+	revs := s.revisions[note.ID]
+	next := 1
+	if len(revs) > 0 {
+		next = revs[len(revs)-1].Rev + 1
+	}
+	revs = append(revs, store.Revision{
+		NoteID:  note.ID,
+		Rev:     next,
+		Title:   note.Title,
+		Content: note.Content,
+		Tags:    slices.Clone(note.Tags),
+		SavedAt: note.UpdatedAt,
+	})
+	if len(revs) > keep {
+		revs = slices.Clone(revs[len(revs)-keep:])
+	}
+	s.revisions[note.ID] = revs
+}
+
+func (s *Store) ListRevisions(_ context.Context, noteID uuid.UUID) ([]store.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revs := slices.Clone(s.revisions[noteID])
+	slices.Reverse(revs)
+	if revs == nil {
+		revs = []store.Revision{}
+	}
+	return revs, nil
+}
+
+func (s *Store) GetRevision(_ context.Context, noteID uuid.UUID, rev int) (store.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.revisions[noteID] {
+		if r.Rev == rev {
+			r.Tags = slices.Clone(r.Tags)
+			return r, nil
+		}
+	}
+	return store.Revision{}, store.ErrNotFound
+}
+
+func (s *Store) SetRevisionContent(_ context.Context, noteID uuid.UUID, rev int, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.revisions[noteID] {
+		if r.Rev == rev {
+			s.revisions[noteID][i].Content = content
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) CreateAttachment(_ context.Context, a store.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[a.NoteID]; !ok {
+		return store.ErrNotFound
+	}
+	a.Seq = s.changeSeq + 1
+	s.attachments[a.ID] = a
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) GetAttachment(_ context.Context, id uuid.UUID) (store.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.attachments[id]
+	if !ok || a.NoteID == uuid.Nil {
+		return store.Attachment{}, store.ErrNotFound
+	}
+	return a, nil
+}
+
+func (s *Store) ListAttachments(_ context.Context, noteID uuid.UUID) ([]store.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.attachmentsWhere(func(a store.Attachment) bool { return a.NoteID == noteID }, 0), nil
+}
+
+func (s *Store) DetachedAttachments(_ context.Context, limit int) ([]store.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.attachmentsWhere(func(a store.Attachment) bool { return a.NoteID == uuid.Nil }, limit), nil
+}
+
+func (s *Store) attachmentsWhere(match func(store.Attachment) bool, limit int) []store.Attachment {
+	items := []store.Attachment{}
+	for _, a := range s.attachments {
+		if match(a) {
+			items = append(items, a)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (s *Store) DeleteAttachment(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attachments[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.attachments, id)
+	s.changeSeq++
+	return nil
+}
+
+func (s *Store) SearchAttachments(_ context.Context, filter store.AttachmentFilter) ([]store.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := s.attachmentsWhere(func(a store.Attachment) bool {
+		n, ok := s.notes[a.NoteID]
+		return ok && n.DeletedAt == nil && (filter.IDs == nil || slices.Contains(filter.IDs, a.ID)) &&
+			matchesTerms(filter.Query, a.Filename, a.Text)
+	}, 0)
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID.String() > items[j].ID.String()
+	})
+	if filter.Limit > 0 && len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	return items, nil
+}
+
+func (s *Store) ListAttachmentTexts(_ context.Context, seq int64, id uuid.UUID, limit int) ([]store.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := s.attachmentsWhere(func(a store.Attachment) bool {
+		return a.NoteID != uuid.Nil && a.Text != "" && (a.Seq > seq || a.Seq == seq && a.ID.String() > id.String())
+	}, 0)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Seq != items[j].Seq {
+			return items[i].Seq < items[j].Seq
+		}
+		return items[i].ID.String() < items[j].ID.String()
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (s *Store) CreateSession(_ context.Context, token string, session store.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[token] = session
+	return nil
+}
+
+func (s *Store) SessionActive(_ context.Context, token string, now time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[token]
+	return ok && session.ExpiresAt.After(now), nil
+}
+
+func (s *Store) GetSession(_ context.Context, token string, now time.Time) (store.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[token]
+	if !ok || !session.ExpiresAt.After(now) {
+		return store.Session{}, store.ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *Store) TouchSession(_ context.Context, token string, lastSeenAt, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return store.ErrNotFound
+	}
+	session.LastSeenAt = lastSeenAt
+	session.ExpiresAt = expiresAt
+	s.sessions[token] = session
+	return nil
+}
+
+func (s *Store) ListSessions(_ context.Context, now time.Time) ([]store.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []store.Session{}
+	for _, session := range s.sessions {
+		if session.ExpiresAt.After(now) {
+			items = append(items, session)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].LastSeenAt.Equal(items[j].LastSeenAt) {
+			return items[i].LastSeenAt.After(items[j].LastSeenAt)
+		}
+		return items[i].ID.String() < items[j].ID.String()
+	})
+	return items, nil
+}
+
+func (s *Store) DeleteSessionByID(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, session := range s.sessions {
+		if session.ID == id {
+			delete(s.sessions, token)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) DeleteOtherSessions(_ context.Context, token string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for other := range s.sessions {
+		if other != token {
+			delete(s.sessions, other)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) DeleteSession(_ context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, token)
+	return nil
+}
+
+func (s *Store) DeleteExpiredSessions(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for token, session := range s.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(s.sessions, token)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) CreateAPIToken(_ context.Context, token store.APIToken, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[hash] = cloneToken(token)
+	return nil
+}
+
+func (s *Store) ListAPITokens(_ context.Context) ([]store.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]store.APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		items = append(items, cloneToken(t))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID.String() > items[j].ID.String()
+	})
+	return items, nil
+}
+
+func (s *Store) APITokenByHash(_ context.Context, hash string) (store.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[hash]
+	if !ok {
+		return store.APIToken{}, store.ErrNotFound
+	}
+	return cloneToken(t), nil
+}
+
+func (s *Store) TouchAPIToken(_ context.Context, id uuid.UUID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, t := range s.tokens {
+		if t.ID == id {
+			t.LastUsedAt = &now
+			s.tokens[hash] = t
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) DeleteAPIToken(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, t := range s.tokens {
+		if t.ID == id {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *Store) ShareNote(_ context.Context, share store.NoteShare) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.live(share.NoteID); !ok {
+		return store.ErrNotFound
+	}
+	s.shares[share.NoteID] = cloneShare(share)
+	return nil
+}
+
+func (s *Store) ShareBySlug(_ context.Context, slug string) (store.NoteShare, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, share := range s.shares {
+		if share.Slug == slug {
+			return cloneShare(share), nil
+		}
+	}
+	return store.NoteShare{}, store.ErrNotFound
+}
+
+func (s *Store) DeleteShare(_ context.Context, noteID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shares[noteID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.shares, noteID)
+	return nil
+}
+
+func (s *Store) CreateWebhook(_ context.Context, hook store.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook.Events = slices.Clone(hook.Events)
+	s.webhooks[hook.ID] = hook
+	return nil
+}
+
+func (s *Store) ListWebhooks(_ context.Context) ([]store.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]store.Webhook, 0, len(s.webhooks))
+	for _, hook := range s.webhooks {
+		hook.Events = slices.Clone(hook.Events)
+		items = append(items, hook)
+	}
+	slices.SortFunc(items, func(a, b store.Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items, nil
+}
+
+func (s *Store) DeleteWebhook(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *Store) ListTemplates(_ context.Context) ([]store.Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]store.Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		t.Tags = slices.Clone(t.Tags)
+		items = append(items, t)
+	}
+	slices.SortFunc(items, func(a, b store.Template) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items, nil
+}
+
+func (s *Store) GetTemplate(_ context.Context, id uuid.UUID) (store.Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.templates[id]
+	if !ok {
+		return store.Template{}, store.ErrNotFound
+	}
+	t.Tags = slices.Clone(t.Tags)
+	return t, nil
+}
+
+func (s *Store) CreateTemplate(_ context.Context, input store.TemplateInput, now time.Time) (store.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := store.Template{
+		ID:        uuid.New(),
+		Name:      input.Name,
+		Title:     input.Title,
+		Content:   input.Content,
+		Tags:      slices.Clone(input.Tags),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.templates[t.ID] = t
+	t.Tags = slices.Clone(t.Tags)
+	return t, nil
+}
+
+func (s *Store) UpdateTemplate(_ context.Context, id uuid.UUID, input store.TemplateInput, now time.Time) (store.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.templates[id]
+	if !ok {
+		return store.Template{}, store.ErrNotFound
+	}
+	t.Name = input.Name
+	t.Title = input.Title
+	t.Content = input.Content
+	t.Tags = slices.Clone(input.Tags)
+	t.UpdatedAt = now
+	s.templates[id] = t
+	t.Tags = slices.Clone(t.Tags)
+	return t, nil
+}
+
+func (s *Store) DeleteTemplate(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.templates, id)
+	return nil
+}
+
+func (s *Store) ListSavedSearches(_ context.Context) ([]store.SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]store.SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		items = append(items, cloneSavedSearch(search))
+	}
+	slices.SortFunc(items, func(a, b store.SavedSearch) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items, nil
+}
+
+func (s *Store) GetSavedSearch(_ context.Context, id uuid.UUID) (store.SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search, ok := s.searches[id]
+	if !ok {
+		return store.SavedSearch{}, store.ErrNotFound
+	}
+	return cloneSavedSearch(search), nil
+}
+
+func (s *Store) CreateSavedSearch(_ context.Context, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	search := store.SavedSearch{ID: uuid.New(), CreatedAt: now}
+	setSavedSearch(&search, input, now)
+	s.searches[search.ID] = search
+	return cloneSavedSearch(search), nil
+}
+
+func (s *Store) UpdateSavedSearch(_ context.Context, id uuid.UUID, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	search, ok := s.searches[id]
+	if !ok {
+		return store.SavedSearch{}, store.ErrNotFound
+	}
+	setSavedSearch(&search, input, now)
+	s.searches[id] = search
+	return cloneSavedSearch(search), nil
+}
+
+func (s *Store) DeleteSavedSearch(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.searches[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.searches, id)
+	return nil
+}
+
+func setSavedSearch(search *store.SavedSearch, input store.SavedSearchInput, now time.Time) {
+	search.Name = input.Name
+	search.Query = input.Query
+	search.Tag = input.Tag
+	search.Favorite = input.Favorite
+	search.Notebook = input.Notebook
+	search.UpdatedAt = now
+}
+
+// cloneSavedSearch copies Favorite, which callers could otherwise change
+// in the stored search through the pointer.
+func cloneSavedSearch(search store.SavedSearch) store.SavedSearch {
+	if search.Favorite != nil {
+		favorite := *search.Favorite
+		search.Favorite = &favorite
+	}
+	return search
+}
+
+func (s *Store) SetLinks(_ context.Context, noteID uuid.UUID, targets []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[noteID]; !ok {
+		return store.ErrNotFound
+	}
+	if len(targets) == 0 {
+		delete(s.links, noteID)
+	} else {
+		s.links[noteID] = slices.Clone(targets)
+	}
+	return nil
+}
+
+func (s *Store) Links(_ context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	targets := s.links[noteID]
+	return s.liveNotesWhere(func(n store.Note) bool {
+		return slices.Contains(targets, n.ID.String()) || slices.Contains(targets, n.Title)
+	}), nil
+}
+
+func (s *Store) Backlinks(_ context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []string{noteID.String()}
+	if n, ok := s.notes[noteID]; ok {
+		keys = append(keys, n.Title)
+	}
+	return s.liveNotesWhere(func(n store.Note) bool {
+		return slices.ContainsFunc(s.links[n.ID], func(target string) bool { return slices.Contains(keys, target) })
+	}), nil
+}
+
+func (s *Store) ListLinks(_ context.Context) ([]store.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := []store.Link{}
+	for source, targets := range s.links {
+		if _, ok := s.live(source); !ok {
+			continue
+		}
+		for _, n := range s.notes {
+			if n.DeletedAt == nil && n.ID != source && (slices.Contains(targets, n.ID.String()) || slices.Contains(targets, n.Title)) {
+				links = append(links, store.Link{Source: source, Target: n.ID})
+			}
+		}
+	}
+	slices.SortFunc(links, func(a, b store.Link) int {
+		if c := strings.Compare(a.Source.String(), b.Source.String()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Target.String(), b.Target.String())
+	})
+	return links, nil
+}
+
+// liveNotesWhere returns the live notes match accepts ordered by title.
+func (s *Store) liveNotesWhere(match func(store.Note) bool) []store.Note {
+	items := []store.Note{}
+	for _, n := range s.notes {
+		if n.DeletedAt == nil && match(n) {
+			items = append(items, cloneNote(n))
+		}
+	}
+	slices.SortFunc(items, func(a, b store.Note) int {
+		if c := strings.Compare(a.Title, b.Title); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items
+}
+
+func cloneShare(share store.NoteShare) store.NoteShare {
+	if share.ExpiresAt != nil {
+		at := *share.ExpiresAt
+		share.ExpiresAt = &at
+	}
+	return share
+}
+
+func cloneToken(t store.APIToken) store.APIToken {
+	if t.LastUsedAt != nil {
+		at := *t.LastUsedAt
+		t.LastUsedAt = &at
+	}
+	return t
+}
+
+func (s *Store) ListNotebooks(_ context.Context) ([]store.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]store.Notebook, 0, len(s.notebooks))
+	for _, nb := range s.notebooks {
+		items = append(items, nb)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID.String() < items[j].ID.String()
+	})
+	return items, nil
+}
+
+func (s *Store) GetNotebook(_ context.Context, id uuid.UUID) (store.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nb, ok := s.notebooks[id]
+	if !ok {
+		return store.Notebook{}, store.ErrNotFound
+	}
+	return nb, nil
+}
+
+func (s *Store) CreateNotebook(_ context.Context, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb := store.Notebook{
+		ID:        uuid.New(),
+		ParentID:  input.ParentID,
+		Name:      input.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.notebooks[nb.ID] = nb
+	return nb, nil
+}
+
+func (s *Store) InsertNotebook(_ context.Context, nb store.Notebook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notebooks[nb.ID] = nb
+	return nil
+}
+
+func (s *Store) UpdateNotebook(_ context.Context, id uuid.UUID, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb, ok := s.notebooks[id]
+	if !ok {
+		return store.Notebook{}, store.ErrNotFound
+	}
+	nb.Name = input.Name
+	nb.ParentID = input.ParentID
+	nb.UpdatedAt = now
+	s.notebooks[id] = nb
+	return nb, nil
+}
+
+func (s *Store) DeleteNotebook(_ context.Context, id uuid.UUID, moveTo *uuid.UUID, trashNotes bool, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notebooks[id]; !ok {
+		return store.ErrNotFound
+	}
+	all := make([]store.Notebook, 0, len(s.notebooks))
+	for _, nb := range s.notebooks {
+		all = append(all, nb)
+	}
+	subtree := store.Subtree(all, id)
+	for _, n := range s.notes {
+		if n.NotebookID == nil || !slices.Contains(subtree, *n.NotebookID) {
+			continue
+		}
+		n.NotebookID = moveTo
+		if trashNotes && n.DeletedAt == nil {
+			n.DeletedAt = &now
+		}
+		n.Version++
+		s.put(n)
+	}
+	for _, nbID := range subtree {
+		delete(s.notebooks, nbID)
+	}
+	s.changeSeq++
+	return nil
+}
+
+// notebookOf returns the note's notebook, uuid.Nil for none.
+func notebookOf(n store.Note) uuid.UUID {
+	if n.NotebookID == nil {
+		return uuid.Nil
+	}
+	return *n.NotebookID
+}
+
+// notebookRef maps a NoteInput notebook, where uuid.Nil means none, to what
+// a note stores.
+func notebookRef(id *uuid.UUID) *uuid.UUID {
+	if id == nil || *id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+// within reports whether n is placed inside near.
+func within(n store.Note, near store.Near) bool {
+	l := n.Location()
+	return l != nil && l.DistanceKm(near.Center) <= near.RadiusKm
+}
+
+func cloneNote(n store.Note) store.Note {
+	n.Tags = slices.Clone(n.Tags)
+	if n.Tags == nil {
+		n.Tags = []string{}
+	}
+	return n
+}
+
+func (s *Store) AddAuditEntry(_ context.Context, entry store.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *Store) ListAuditEntries(_ context.Context, filter store.AuditFilter) ([]store.AuditEntry, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := make([]store.AuditEntry, 0)
+	for _, e := range s.audit {
+		if (!filter.From.IsZero() && e.At.Before(filter.From)) || (!filter.To.IsZero() && !e.At.Before(filter.To)) ||
+			(filter.Entity != "" && e.Entity != filter.Entity) || (filter.EntityID != "" && e.EntityID != filter.EntityID) ||
+			(filter.Action != "" && e.Action != filter.Action) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	slices.SortStableFunc(matched, func(a, b store.AuditEntry) int {
+		if c := b.At.Compare(a.At); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+
+	start := min(filter.Offset, len(matched))
+	end := len(matched)
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, len(matched))
+	}
+	return slices.Clone(matched[start:end]), len(matched), nil
+}
+
+func (s *Store) DeleteAuditEntries(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.audit[:0]
+	for _, e := range s.audit {
+		if !e.At.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := len(s.audit) - len(kept)
+	s.audit = kept
+	return deleted, nil
+}
+
+func (s *Store) RecordNoteAccess(_ context.Context, noteID uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.notes[noteID]; !ok {
+		return store.ErrNotFound
+	}
+	s.access[noteID] = append(s.access[noteID], at)
+	return nil
+}
+
+func (s *Store) ListAccessedNotes(_ context.Context, filter store.AccessFilter) ([]store.AccessedNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []store.AccessedNote{}
+	for id, opens := range s.access {
+		n, ok := s.notes[id]
+		if !ok || n.DeletedAt != nil {
+			continue
+		}
+		item := store.AccessedNote{Note: n}
+		for _, at := range opens {
+			if at.Before(filter.Since) {
+				continue
+			}
+			item.Opens++
+			if at.After(item.LastOpenedAt) {
+				item.LastOpenedAt = at
+			}
+		}
+		if item.Opens > 0 {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b store.AccessedNote) int {
+		if filter.ByOpens && a.Opens != b.Opens {
+			return b.Opens - a.Opens
+		}
+		if c := b.LastOpenedAt.Compare(a.LastOpenedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	if filter.Limit > 0 && len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	for i := range items {
+		items[i].Note = cloneNote(items[i].Note)
+	}
+	return items, nil
+}
+
+func (s *Store) GetDailyNote(_ context.Context, day string) (store.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.live(s.daily[day])
+	if !ok {
+		return store.Note{}, store.ErrNotFound
+	}
+	return cloneNote(n), nil
+}
+
+func (s *Store) SetDailyNote(_ context.Context, day string, noteID uuid.UUID) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.live(s.daily[day]); ok {
+		return existing.ID, nil
+	}
+	if _, ok := s.live(noteID); !ok {
+		return uuid.Nil, store.ErrNotFound
+	}
+	s.daily[day] = noteID
+	return noteID, nil
+}
+
+func (s *Store) ListDailyNotes(_ context.Context, from, to string) ([]store.DailyNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := []store.DailyNote{}
+	for day, id := range s.daily {
+		n, ok := s.live(id)
+		if !ok || day < from || day > to {
+			continue
+		}
+		items = append(items, store.DailyNote{Date: day, NoteID: id, Title: n.Title, WordCount: n.WordCount})
+	}
+	slices.SortFunc(items, func(a, b store.DailyNote) int { return strings.Compare(a.Date, b.Date) })
+	return items, nil
+}
+
+func (s *Store) DeleteNoteAccess(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for id, opens := range s.access {
+		kept := slices.DeleteFunc(opens, func(at time.Time) bool { return at.Before(before) })
+		deleted += len(opens) - len(kept)
+		if len(kept) == 0 {
+			delete(s.access, id)
+		} else {
+			s.access[id] = kept
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) ClaimIdempotencyKey(_ context.Context, req store.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (store.IdempotentRequest, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if held, ok := s.idempotency[req.Key]; ok {
+		cutoff := expiredBefore
+		if held.Status == 0 {
+			cutoff = abandonedBefore
+		}
+		if !held.CreatedAt.Before(cutoff) {
+			held.Headers = maps.Clone(held.Headers)
+			return held, false, nil
+		}
+	}
+	req.Status, req.Headers, req.Body = 0, nil, ""
+	s.idempotency[req.Key] = req
+	return req, true, nil
+}
+
+func (s *Store) FinishIdempotentRequest(_ context.Context, req store.IdempotentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held, ok := s.idempotency[req.Key]
+	if !ok || held.Status != 0 {
+		return store.ErrNotFound
+	}
+	held.Fingerprint, held.Status, held.Headers, held.Body = req.Fingerprint, req.Status, maps.Clone(req.Headers), req.Body
+	s.idempotency[req.Key] = held
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req, ok := s.idempotency[key]; ok && req.Status == 0 {
+		delete(s.idempotency, key)
+	}
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKeys(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, req := range s.idempotency {
+		if req.CreatedAt.Before(before) {
+			delete(s.idempotency, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) GetTwoFactor(_ context.Context) (store.TwoFactor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.twoFactor == nil {
+		return store.TwoFactor{}, store.ErrNotFound
+	}
+	tf := *s.twoFactor
+	tf.RecoveryCodes = len(s.recoveryCodes)
+	return tf, nil
+}
+
+func (s *Store) SetupTwoFactor(_ context.Context, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.twoFactor = &store.TwoFactor{Secret: secret}
+	s.recoveryCodes = nil
+	return nil
+}
+
+func (s *Store) EnableTwoFactor(_ context.Context, step int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.twoFactor == nil {
+		return store.ErrNotFound
+	}
+	s.twoFactor.Enabled = true
+	s.twoFactor.LastStep = step
+	s.recoveryCodes = make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		s.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (s *Store) DeleteTwoFactor(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.twoFactor = nil
+	s.recoveryCodes = nil
+	return nil
+}
+
+func (s *Store) UseTwoFactorStep(_ context.Context, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.twoFactor == nil || s.twoFactor.LastStep >= step {
+		return false, nil
+	}
+	s.twoFactor.LastStep = step
+	return true, nil
+}
+
+func (s *Store) UseRecoveryCode(_ context.Context, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recoveryCodes[hash] {
+		return false, nil
+	}
+	delete(s.recoveryCodes, hash)
+	return true, nil
+}
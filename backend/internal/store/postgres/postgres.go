@@ -0,0 +1,2594 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"notes-backend/internal/migrate"
+	"notes-backend/internal/store"
+	"notes-backend/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+type Store struct {
+	db        *pgxpool.Pool
+	cockroach bool
+}
+
+var (
+	_ store.Store         = (*Store)(nil)
+	_ store.NoteEstimator = (*Store)(nil)
+	_ store.HealthChecker = (*Store)(nil)
+)
+
+// Options tunes the connections Open makes.
+type Options struct {
+	// StatementTimeout has the server cancel statements that run longer;
+	// 0 leaves its own setting.
+	StatementTimeout time.Duration
+	// Tracer, if set, records a span for each query made within a traced
+	// request.
+	Tracer *tracing.Tracer
+	// MaxConns, MinConns, MaxConnLifetime and ConnectTimeout tune the pool;
+	// zero values keep pgx's defaults, or those of the URL's pool_ options.
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	ConnectTimeout  time.Duration
+}
+
+func Open(ctx context.Context, databaseURL string, opts Options) (*Store, error) {
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	if opts.MaxConns > 0 {
+		poolConfig.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		poolConfig.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.ConnectTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = opts.ConnectTimeout
+	}
+	var tracers []pgx.QueryTracer
+	if opts.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+		tracers = append(tracers, timeoutTracer{})
+	}
+	if opts.Tracer != nil {
+		tracers = append(tracers, spanTracer{opts.Tracer})
+	}
+	switch len(tracers) {
+	case 0:
+	case 1:
+		poolConfig.ConnConfig.Tracer = tracers[0]
+	default:
+		poolConfig.ConnConfig.Tracer = multitracer.New(tracers...)
+	}
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connect db: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.Ping(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	var version string
+	if err := db.QueryRow(ctx, `SELECT version()`).Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("read server version: %w", err)
+	}
+
+	return &Store{db: db, cockroach: strings.Contains(version, "CockroachDB")}, nil
+}
+
+// timeoutTracer reports statements that statement_timeout cancelled.
+type timeoutTracer struct{}
+
+func (timeoutTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (timeoutTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	var pgErr *pgconn.PgError
+	// 57014 is query_canceled.
+	if errors.As(data.Err, &pgErr) && pgErr.Code == "57014" {
+		store.ReportTimeout(ctx)
+	}
+}
+
+// spanTracer records queries as spans, the children of the request span in
+// their context; queries outside a request, such as the background jobs',
+// are not traced.
+type spanTracer struct {
+	tracer *tracing.Tracer
+}
+
+func (t spanTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if tracing.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+	operation := "QUERY"
+	if fields := strings.Fields(data.SQL); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	ctx, span := t.tracer.Start(ctx, operation, tracing.KindClient)
+	span.SetAttribute("db.system.name", "postgresql")
+	span.SetAttribute("db.operation.name", operation)
+	span.SetAttribute("db.query.text", data.SQL)
+	return ctx
+}
+
+func (t spanTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := tracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	if data.Err != nil {
+		span.Fail(data.Err.Error())
+	}
+	span.End()
+}
+
+func (s *Store) Pool() *pgxpool.Pool {
+	return s.db
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+func (s *Store) PoolStats() store.PoolStats {
+	stats := s.db.Stat()
+	return store.PoolStats{
+		MaxOpen:   int(stats.MaxConns()),
+		Open:      int(stats.TotalConns()),
+		InUse:     int(stats.AcquiredConns()),
+		Idle:      int(stats.IdleConns()),
+		WaitCount: stats.EmptyAcquireCount(),
+		WaitMS:    stats.EmptyAcquireWaitTime().Milliseconds(),
+	}
+}
+
+// Migrator runs migrations through a database/sql view of the pool; it
+// holds no idle connections of its own, so it needs no separate cleanup.
+func (s *Store) Migrator(fsys fs.FS) *migrate.Migrator {
+	dialect := migrate.Postgres
+	if s.cockroach {
+		dialect = migrate.Cockroach
+	}
+	return migrate.New(stdlib.OpenDBFromPool(s.db), dialect, fsys)
+}
+
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+const noteColumns = `id, title, content, tags, is_favorite, language, created_at, updated_at, deleted_at, version, notebook_id, is_pinned, sort_position, is_archived, is_encrypted, word_count, char_count, due_at, reminder_at, color, icon, latitude, longitude`
+
+// noteFilterClause binds $1 query, $2 tag, $3 favorite, $4/$5 the
+// created_at bounds, $6 whether the query may match content and $7/$8
+// whether to filter by notebook and which one, NULL for none, $9 the title
+// query and $10/$11 the tags to require and exclude. The tag tests use
+// containment and overlap rather than = ANY(tags) so that they can be
+// answered from the GIN (inverted, on CockroachDB) index on tags.
+//
+// On Postgres the query is a web-search expression matched against the
+// trigger-maintained search_vector; words are unaccented and stemmed with
+// the filter's language. CockroachDB keeps no search vector and falls back
+// to a case-insensitive substring match.
+func (s *Store) noteFilterClause(filter store.NoteFilter) string {
+	trash := "deleted_at IS NULL"
+	if filter.Trashed {
+		trash = "deleted_at IS NOT NULL"
+	}
+	// Archived is spliced in like the trash test, which keeps the numbered
+	// parameters as they are.
+	if filter.Archived != nil {
+		if *filter.Archived {
+			trash += " AND is_archived"
+		} else {
+			trash += " AND NOT is_archived"
+		}
+	}
+	// So is Color, which is safe as a literal once checked against the
+	// palette; any other color matches nothing.
+	if filter.Color != nil {
+		switch color := *filter.Color; {
+		case color == "" || slices.Contains(store.NoteColors, color):
+			trash += " AND color = '" + color + "'"
+		default:
+			trash += " AND false"
+		}
+	}
+	if filter.Near != nil {
+		trash += " AND " + s.nearClause(*filter.Near)
+	}
+	// So are IDs, which are safe as literals once formatted as UUIDs.
+	if filter.IDs != nil {
+		ids := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			ids[i] = id.String()
+		}
+		trash += " AND id = ANY('{" + strings.Join(ids, ",") + "}'::uuid[])"
+	}
+	text := `title ILIKE '%' || $1 || '%' OR ($6 AND NOT is_encrypted AND content ILIKE '%' || $1 || '%')`
+	title := `title ILIKE '%' || $9 || '%'`
+	if !s.cockroach {
+		// Titles carry weight A in the vector, which is all that is left to
+		// match when content is encrypted.
+		query := tsQuery(filter, "$1")
+		title = `ts_filter(search_vector, '{a}') @@ ` + tsQuery(filter, "$9")
+		text = `search_vector @@ ` + query + ` AND ($6 OR ts_filter(search_vector, '{a}') @@ ` + query + `)`
+		// A typo is forgiven with pg_trgm's word similarity, which the
+		// trigram indexes answer, in searches without operators.
+		if store.ForgivesTypo(filter.Query) && plainQuery(filter.Query) {
+			text += ` OR $1 <% title OR ($6 AND NOT is_encrypted AND $1 <% content)`
+		}
+	}
+	return `
+	WHERE ` + trash + `
+	  AND ($1 = '' OR (` + text + `))
+	  AND ($9 = '' OR (` + title + `))
+	  AND ($2 = '' OR tags @> ARRAY[$2]::text[])
+	  AND tags @> $10::text[] AND NOT tags && $11::text[]
+	  AND ($3::boolean IS NULL OR is_favorite = $3)
+	  AND (NOT $7 OR ($8::uuid IS NULL AND notebook_id IS NULL) OR notebook_id = $8)
+	  AND ($4::timestamptz IS NULL OR created_at >= $4)
+	  AND ($5::timestamptz IS NULL OR created_at < $5)
+`
+}
+
+// nearClause matches the notes within near, its numbers spliced in as
+// literals, which is safe once they are checked to be finite. Postgres
+// measures with earthdistance, whose earth_box the GiST index on
+// ll_to_earth answers; CockroachDB has no such extension and uses the
+// haversine formula, as SQLite and MySQL do.
+func (s *Store) nearClause(near store.Near) string {
+	if !near.Center.Valid() || !(near.RadiusKm >= 0) || math.IsInf(near.RadiusKm, 0) {
+		return "false"
+	}
+	lat, lng := literal(near.Center.Latitude), literal(near.Center.Longitude)
+	if s.cockroach {
+		// The latitude band is what the index on latitude answers.
+		band := near.RadiusKm / store.EarthRadiusKm * 180 / math.Pi
+		return `latitude BETWEEN ` + literal(near.Center.Latitude-band) + ` AND ` + literal(near.Center.Latitude+band) + ` AND 2 * ` + literal(store.EarthRadiusKm) + ` * asin(sqrt(least(1, ` +
+			`pow(sin(radians(latitude - ` + lat + `) / 2), 2) + cos(radians(` + lat + `)) * cos(radians(latitude)) * pow(sin(radians(longitude - ` + lng + `) / 2), 2)` +
+			`))) <= ` + literal(near.RadiusKm)
+	}
+	center, meters := `ll_to_earth(`+lat+`, `+lng+`)`, literal(near.RadiusKm*1000)
+	// latitude IS NOT NULL lets the planner use the partial index.
+	return `latitude IS NOT NULL AND earth_box(` + center + `, ` + meters + `) @> ll_to_earth(latitude, longitude)` +
+		` AND earth_distance(` + center + `, ll_to_earth(latitude, longitude)) <= ` + meters
+}
+
+func literal(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// tsQuery parses param with the filter's text search configuration. The
+// configuration is spliced in as a literal, which is safe because it is
+// checked against store.Languages.
+func tsQuery(filter store.NoteFilter, param string) string {
+	language := store.LanguageOr(filter.Language, store.DefaultLanguage)
+	if !slices.Contains(store.Languages, language) {
+		language = store.DefaultLanguage
+	}
+	return `websearch_to_tsquery('` + language + `', unaccent(` + param + `))`
+}
+
+// plainQuery reports whether query is only words, without the quotes,
+// exclusions and ORs of web search syntax, which similar words would
+// work around.
+func plainQuery(query string) bool {
+	for _, word := range strings.Fields(query) {
+		if strings.ContainsRune(word, '"') || strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+			return false
+		}
+	}
+	return true
+}
+
+// ranked reports whether a listing is a full-text search, which orders by
+// relevance and returns a score and snippet for each note.
+func (s *Store) ranked(filter store.NoteFilter) bool {
+	return !s.cockroach && filter.Query != ""
+}
+
+func (s *Store) listOrder(filter store.NoteFilter) string {
+	if filter.Trashed && filter.After == nil {
+		return "deleted_at DESC"
+	}
+	sortBy := filter.Sort
+	if filter.After != nil {
+		sortBy = store.SortUpdated
+	}
+	switch {
+	case sortBy == store.SortCreated:
+		return "is_pinned DESC, created_at DESC, updated_at DESC, id DESC"
+	case sortBy == store.SortTitle:
+		return "is_pinned DESC, lower(title), updated_at DESC, id DESC"
+	case sortBy == store.SortManual:
+		return "is_pinned DESC, sort_position, updated_at DESC, id DESC"
+	case sortBy == store.SortLength:
+		return "is_pinned DESC, word_count DESC, updated_at DESC, id DESC"
+	case sortBy == "" && s.ranked(filter):
+		return "is_pinned DESC, score DESC, updated_at DESC, id DESC"
+	}
+	return "is_pinned DESC, updated_at DESC, id DESC"
+}
+
+// keysetClause narrows a listing to the notes after its cursor, bound as
+// $14 to $16. It is kept out of noteFilterClause so that counts and
+// estimates still cover every page.
+func keysetClause(filter store.NoteFilter) (string, []any) {
+	if filter.After == nil || filter.After.UpdatedAt.IsZero() {
+		return "", nil
+	}
+	c := filter.After
+	return ` AND (is_pinned, updated_at, id) < ($14::boolean, $15::timestamptz, $16::uuid)`, []any{c.Pinned, c.UpdatedAt, c.ID}
+}
+
+// searchColumns adds the relevance and an excerpt around the matches to a
+// ranked listing. ts_headline marks matches with control characters so that
+// the excerpt can be HTML-escaped before the marks become <mark> tags.
+func searchColumns(filter store.NoteFilter) string {
+	query := tsQuery(filter, "$1")
+	source := "CASE WHEN $6 AND NOT is_encrypted THEN content ELSE title END"
+	return `, ts_rank_cd(search_vector, ` + query + `) AS score,
+		ts_headline(language::regconfig, ` + source + `, ` + query + `,
+			E'StartSel=\x02, StopSel=\x03, MaxFragments=2, MaxWords=20, MinWords=8, FragmentDelimiter=" ... "') AS snippet`
+}
+
+func filterArgs(filter store.NoteFilter) []any {
+	args := []any{filter.Query, filter.Tag, filter.Favorite, nil, nil, !filter.TitleOnly,
+		filter.Notebook != nil, nullNotebook(filter.Notebook),
+		filter.TitleQuery, nonNil(filter.Tags), nonNil(filter.ExcludeTags)}
+	if !filter.CreatedFrom.IsZero() {
+		args[3] = filter.CreatedFrom
+	}
+	if !filter.CreatedTo.IsZero() {
+		args[4] = filter.CreatedTo
+	}
+	return args
+}
+
+// nonNil keeps an empty list of tags from being bound as NULL, which
+// containment and overlap would turn into NULL rather than true or false.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func (s *Store) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	var total int
+	if !filter.SkipCount {
+		err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM notes`+s.noteFilterClause(filter), filterArgs(filter)...).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("count notes: %w", err)
+		}
+	}
+
+	ranked := s.ranked(filter)
+	columns := noteColumns
+	if ranked {
+		columns += searchColumns(filter)
+	}
+	keyset, keysetArgs := keysetClause(filter)
+	rows, err := s.db.Query(ctx, `
+		SELECT `+columns+`
+		FROM notes`+s.noteFilterClause(filter)+keyset+`
+		ORDER BY `+s.listOrder(filter)+`
+		LIMIT $12 OFFSET $13
+	`, append(append(filterArgs(filter), filter.Limit, filter.Offset), keysetArgs...)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]store.Note, 0, filter.Limit)
+	for rows.Next() {
+		var (
+			n   store.Note
+			err error
+		)
+		if ranked {
+			n, err = scanSearchResult(rows)
+		} else {
+			n, err = scanNote(rows)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list notes: %w", err)
+	}
+	return items, total, nil
+}
+
+// EstimateNotes reads pg_class.reltuples for unfiltered listings and the
+// planner's row estimate otherwise. CockroachDB keeps neither in a usable
+// form, so it never estimates.
+func (s *Store) EstimateNotes(ctx context.Context, filter store.NoteFilter) (int, error) {
+	if s.cockroach {
+		return -1, nil
+	}
+
+	if !filter.Trashed && filter.Query == "" && filter.TitleQuery == "" && filter.Tag == "" && filter.Tags == nil && filter.ExcludeTags == nil && filter.Favorite == nil && filter.Archived == nil && filter.Notebook == nil &&
+		filter.Color == nil && filter.Near == nil && filter.CreatedFrom.IsZero() && filter.CreatedTo.IsZero() {
+		var estimate float64
+		err := s.db.QueryRow(ctx, `SELECT reltuples FROM pg_class WHERE oid = 'notes'::regclass`).Scan(&estimate)
+		if err != nil {
+			return 0, fmt.Errorf("estimate notes: %w", err)
+		}
+		// reltuples is -1 until the table has been vacuumed or analyzed.
+		return int(estimate), nil
+	}
+
+	// EXPLAIN returns its JSON as a text column.
+	var raw string
+	err := s.db.QueryRow(ctx, `EXPLAIN (FORMAT JSON) SELECT 1 FROM notes`+s.noteFilterClause(filter), filterArgs(filter)...).Scan(&raw)
+	if err != nil {
+		return 0, fmt.Errorf("estimate notes: %w", err)
+	}
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		return 0, fmt.Errorf("decode query plan: %w", err)
+	}
+	if len(plan) == 0 {
+		return -1, nil
+	}
+	return int(plan[0].Plan.Rows), nil
+}
+
+func (s *Store) GetNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = $1 AND deleted_at IS NULL`, id)
+	return scanNoteRow(row)
+}
+
+func (s *Store) CreateNote(ctx context.Context, input store.NoteInput, now time.Time) (store.Note, error) {
+	stats := input.ContentStats()
+	lat, lng := nullLocation(input.Location)
+	row := s.db.QueryRow(ctx, `
+		INSERT INTO notes (id, title, content, tags, is_favorite, language, created_at, updated_at, notebook_id, word_count, char_count, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11, $12)
+		RETURNING `+noteColumns,
+		uuid.New(), input.Title, input.Content, input.Tags, input.IsFavorite,
+		store.LanguageOr(input.Language, store.DefaultLanguage), now, nullNotebook(input.NotebookID), stats.Words, stats.Chars, lat, lng)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) InsertNote(ctx context.Context, note store.Note) error {
+	if err := insertNote(ctx, s.db, note); err != nil {
+		return err
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) InsertNotes(ctx context.Context, notes []store.Note) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("insert notes: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, note := range notes {
+		if err := insertNote(ctx, tx, note); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("insert notes: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) InsertSnapshot(ctx context.Context, notebooks []store.Notebook, notes []store.Note) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, nb := range notebooks {
+		if err := insertNotebook(ctx, tx, nb); err != nil {
+			return err
+		}
+	}
+	for _, note := range notes {
+		if err := insertNote(ctx, tx, note); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertNote(ctx context.Context, e execer, note store.Note) error {
+	_, err := e.Exec(ctx, `
+		INSERT INTO notes (id, title, content, tags, is_favorite, language, created_at, updated_at, deleted_at, version, notebook_id, is_pinned, sort_position, is_archived, is_encrypted, word_count, char_count, due_at, reminder_at, color, icon, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
+	`, note.ID, note.Title, note.Content, note.Tags, note.IsFavorite,
+		store.LanguageOr(note.Language, store.DefaultLanguage), note.CreatedAt, note.UpdatedAt, note.DeletedAt,
+		max(note.Version, 1), nullNotebook(note.NotebookID), note.IsPinned, note.SortPosition, note.IsArchived, note.IsEncrypted, note.WordCount, note.CharCount,
+		note.DueAt, note.ReminderAt, note.Color, note.Icon, note.Latitude, note.Longitude)
+	if err != nil {
+		return fmt.Errorf("insert note: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateNote(ctx context.Context, id uuid.UUID, input store.NoteInput, now time.Time) (store.Note, error) {
+	n, err := s.changed(ctx, updateNote(ctx, s.db, id, input, now))
+	if errors.Is(err, store.ErrNotFound) && input.IfVersion != 0 {
+		// Tell a stale version apart from a missing note.
+		if _, err := s.GetNote(ctx, id); err != nil {
+			return store.Note{}, err
+		}
+		return store.Note{}, store.ErrConflict
+	}
+	return n, err
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// updateNote writes input over the live note id, at version
+// input.IfVersion unless that is 0, returning the note it leaves.
+func updateNote(ctx context.Context, q rowQuerier, id uuid.UUID, input store.NoteInput, now time.Time) pgx.Row {
+	stats := input.ContentStats()
+	lat, lng := nullLocation(input.Location)
+	return q.QueryRow(ctx, `
+		UPDATE notes
+		SET title = $2,
+		    content = $3,
+		    tags = $4,
+		    is_favorite = $5,
+		    language = COALESCE(NULLIF($6, ''), language),
+		    notebook_id = CASE WHEN $9 THEN $10::uuid ELSE notebook_id END,
+		    word_count = $11,
+		    char_count = $12,
+		    latitude = CASE WHEN $13 THEN $14::double precision ELSE latitude END,
+		    longitude = CASE WHEN $13 THEN $15::double precision ELSE longitude END,
+		    updated_at = $7,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL AND ($8 = 0 OR version = $8)
+		RETURNING `+noteColumns,
+		id, input.Title, input.Content, input.Tags, input.IsFavorite, input.Language, now, input.IfVersion,
+		input.NotebookID != nil, nullNotebook(input.NotebookID), stats.Words, stats.Chars,
+		input.SetLocation, lat, lng)
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id uuid.UUID, now time.Time) error {
+	result, err := s.db.Exec(ctx, `UPDATE notes SET deleted_at = $2, version = version + 1, change_seq = NULL WHERE id = $1 AND deleted_at IS NULL`, id, now)
+	if err != nil {
+		return fmt.Errorf("delete note: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET deleted_at = NULL,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+noteColumns, id)
+	return s.changed(ctx, row)
+}
+
+// purgeNotes deletes the notes matching where and leaves a tombstone for
+// sync in place of each.
+const purgeNotes = `
+	WITH purged AS (DELETE FROM notes WHERE %s RETURNING id)
+	INSERT INTO note_tombstones (id) SELECT id FROM purged
+	ON CONFLICT (id) DO UPDATE SET change_seq = NULL`
+
+func (s *Store) PurgeNote(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, fmt.Sprintf(purgeNotes, `id = $1`), id)
+	if err != nil {
+		return fmt.Errorf("purge note: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, fmt.Sprintf(purgeNotes, `deleted_at < $1`), before)
+	if err != nil {
+		return 0, fmt.Errorf("purge trash: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (s *Store) ChangeSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	if err := s.db.QueryRow(ctx, `SELECT seq FROM note_changes WHERE id = 1`).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("read change seq: %w", err)
+	}
+	return seq, nil
+}
+
+// bumpChangeSeq stamps the notes and tombstones written since the last
+// bump, and the attachments uploaded, with the new seq in the statement
+// that takes it, so that a seq is visible only along with everything it
+// counted.
+func (s *Store) bumpChangeSeq(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, `
+		WITH bumped AS (UPDATE note_changes SET seq = seq + 1 WHERE id = 1 RETURNING seq),
+		     counted AS (UPDATE notes SET change_seq = (SELECT seq FROM bumped) WHERE change_seq IS NULL),
+		     attached AS (UPDATE attachments SET change_seq = (SELECT seq FROM bumped) WHERE change_seq IS NULL AND note_id IS NOT NULL)
+		UPDATE note_tombstones SET change_seq = (SELECT seq FROM bumped) WHERE change_seq IS NULL`)
+	if err != nil {
+		return fmt.Errorf("bump change seq: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListNoteChanges(ctx context.Context, since int64, limit int) (store.ChangePage, error) {
+	return store.PageChanges(ctx, since, limit, s.ChangeSeq, s.noteChanges)
+}
+
+func (s *Store) noteChanges(ctx context.Context, q store.ChangeQuery) ([]store.NoteChange, error) {
+	where, args, limit := `change_seq > $1`, []any{q.After}, ""
+	switch {
+	case q.Pending:
+		where, args = `change_seq IS NULL`, nil
+	case q.At > 0:
+		where, args = `change_seq = $1`, []any{q.At}
+	case q.Limit > 0:
+		limit = fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	var changes []store.NoteChange
+	rows, err := s.db.Query(ctx, `SELECT change_seq, `+noteColumns+` FROM notes WHERE `+where+` ORDER BY change_seq`+limit, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list note changes: %w", err)
+	}
+	for rows.Next() {
+		var seq *int64
+		n, err := scanNote(seqScanner{rows, &seq})
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan note change: %w", err)
+		}
+		changes = append(changes, store.NoteChange{Seq: deref(seq), ID: n.ID, Note: &n})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list note changes: %w", err)
+	}
+
+	purges, err := s.db.Query(ctx, `SELECT change_seq, id FROM note_tombstones WHERE `+where+` ORDER BY change_seq`+limit, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list note purges: %w", err)
+	}
+	defer purges.Close()
+	for purges.Next() {
+		var (
+			seq *int64
+			id  uuid.UUID
+		)
+		if err := purges.Scan(&seq, &id); err != nil {
+			return nil, fmt.Errorf("scan note purge: %w", err)
+		}
+		changes = append(changes, store.NoteChange{Seq: deref(seq), ID: id})
+	}
+	if err := purges.Err(); err != nil {
+		return nil, fmt.Errorf("list note purges: %w", err)
+	}
+	return store.SortChanges(changes, q.Limit), nil
+}
+
+// seqScanner reads the change_seq column ahead of a note's.
+type seqScanner struct {
+	pgx.Row
+	seq **int64
+}
+
+func (r seqScanner) Scan(dest ...any) error {
+	return r.Row.Scan(append([]any{r.seq}, dest...)...)
+}
+
+func deref(seq *int64) int64 {
+	if seq == nil {
+		return 0
+	}
+	return *seq
+}
+
+// changed scans the note returned by a write and bumps the change counter
+// if the write hit a row.
+func (s *Store) changed(ctx context.Context, row pgx.Row) (store.Note, error) {
+	n, err := scanNoteRow(row)
+	if err != nil {
+		return store.Note{}, err
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return n, nil
+}
+
+func (s *Store) SetFavorite(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET is_favorite = $2,
+		    updated_at = $3,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+noteColumns,
+		id, value, now)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) SetPinned(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET is_pinned = $2,
+		    updated_at = $3,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+noteColumns,
+		id, value, now)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) SetAppearance(ctx context.Context, id uuid.UUID, color, icon string, now time.Time) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET color = $2,
+		    icon = $3,
+		    updated_at = $4,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+noteColumns,
+		id, color, icon, now)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) SetSchedule(ctx context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET due_at = $2,
+		    reminder_at = $3,
+		    updated_at = $4,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+noteColumns,
+		id, dueAt, reminderAt, now)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) ListScheduledNotes(ctx context.Context) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL AND (due_at IS NOT NULL OR reminder_at IS NOT NULL)
+		ORDER BY created_at, id
+	`)
+}
+
+func (s *Store) SetArchived(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		UPDATE notes
+		SET is_archived = $2,
+		    updated_at = $3,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+noteColumns,
+		id, value, now)
+	return s.changed(ctx, row)
+}
+
+func (s *Store) SetEncrypted(ctx context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (store.Note, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := scanNoteRow(tx.QueryRow(ctx, `
+		UPDATE notes
+		SET content = $2,
+		    is_encrypted = $3,
+		    updated_at = $4,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = $1 AND deleted_at IS NULL AND version = $5
+		RETURNING `+noteColumns,
+		id, content, value, now, ifVersion))
+	if errors.Is(err, store.ErrNotFound) {
+		// Tell a stale version apart from a missing note.
+		if _, err := s.GetNote(ctx, id); err != nil {
+			return store.Note{}, err
+		}
+		return store.Note{}, store.ErrConflict
+	}
+	if err != nil {
+		return store.Note{}, err
+	}
+	if value {
+		if _, err := tx.Exec(ctx, `DELETE FROM note_revisions WHERE note_id = $1`, id); err != nil {
+			return store.Note{}, fmt.Errorf("delete revisions: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return n, nil
+}
+
+func (s *Store) ReorderNotes(ctx context.Context, ids []uuid.UUID) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("reorder notes: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for i, id := range ids {
+		tag, err := tx.Exec(ctx, `UPDATE notes SET sort_position = $2, version = version + 1, change_seq = NULL WHERE id = $1 AND deleted_at IS NULL`, id, i+1)
+		if err != nil {
+			return fmt.Errorf("reorder notes: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return store.ErrNotFound
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("reorder notes: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) ApplyBulk(ctx context.Context, ops []store.BulkOp, now time.Time) ([]bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("bulk update: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	applied := make([]bool, len(ops))
+	for i, op := range ops {
+		var (
+			result pgconn.CommandTag
+			err    error
+		)
+		switch op.Action {
+		case store.BulkDelete:
+			result, err = tx.Exec(ctx, `UPDATE notes SET deleted_at = $2, version = version + 1, change_seq = NULL WHERE id = $1 AND deleted_at IS NULL`, op.NoteID, now)
+		case store.BulkTag, store.BulkUntag:
+			var current []string
+			err = tx.QueryRow(ctx, `SELECT tags FROM notes WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, op.NoteID).Scan(&current)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("bulk update: %w", err)
+			}
+			result, err = tx.Exec(ctx, `UPDATE notes SET tags = $2, updated_at = $3, version = version + 1, change_seq = NULL WHERE id = $1`, op.NoteID, op.ApplyTags(current), now)
+		case store.BulkFavorite:
+			result, err = tx.Exec(ctx, `UPDATE notes SET is_favorite = $2, updated_at = $3, version = version + 1, change_seq = NULL WHERE id = $1 AND deleted_at IS NULL`, op.NoteID, op.Favorite, now)
+		case store.BulkMove:
+			result, err = tx.Exec(ctx, `UPDATE notes SET notebook_id = $2, updated_at = $3, version = version + 1, change_seq = NULL WHERE id = $1 AND deleted_at IS NULL`, op.NoteID, nullNotebook(op.NotebookID), now)
+		default:
+			return nil, fmt.Errorf("unknown bulk action %q", op.Action)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bulk %s: %w", op.Action, err)
+		}
+		applied[i] = result.RowsAffected() > 0
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("bulk update: %w", err)
+	}
+	if slices.Contains(applied, true) {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return applied, nil
+}
+
+func (s *Store) MergeNotes(ctx context.Context, merge store.NoteMerge, now time.Time) (store.Note, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, check := range []struct {
+		id      uuid.UUID
+		version int64
+	}{{merge.TargetID, merge.Input.IfVersion}, {merge.SourceID, merge.SourceVersion}} {
+		var version int64
+		err := tx.QueryRow(ctx, `SELECT version FROM notes WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, check.id).Scan(&version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.Note{}, store.ErrNotFound
+		}
+		if err != nil {
+			return store.Note{}, fmt.Errorf("merge notes: %w", err)
+		}
+		if check.version != 0 && check.version != version {
+			return store.Note{}, store.ErrConflict
+		}
+	}
+	if merge.Revision != nil {
+		if err := addRevision(ctx, tx, *merge.Revision, merge.KeepRevisions); err != nil {
+			return store.Note{}, err
+		}
+	}
+	n, err := scanNoteRow(updateNote(ctx, tx, merge.TargetID, merge.Input, now))
+	if err != nil {
+		return store.Note{}, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE attachments SET note_id = $1 WHERE note_id = $2`, merge.TargetID, merge.SourceID); err != nil {
+		return store.Note{}, fmt.Errorf("move attachments: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE notes SET deleted_at = $2, version = version + 1, change_seq = NULL WHERE id = $1`, merge.SourceID, now); err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return n, nil
+}
+
+func (s *Store) SetNoteStats(ctx context.Context, id uuid.UUID, stats store.TextStats) error {
+	result, err := s.db.Exec(ctx, `UPDATE notes SET word_count = $2, char_count = $3, change_seq = NULL WHERE id = $1`, id, stats.Words, stats.Chars)
+	if err != nil {
+		return fmt.Errorf("set note stats: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) ListNoteSizes(ctx context.Context) ([]store.NoteSize, error) {
+	rows, err := s.db.Query(ctx, `SELECT notebook_id, tags, word_count, char_count, created_at FROM notes WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("list note sizes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.NoteSize{}
+	for rows.Next() {
+		var (
+			size       store.NoteSize
+			notebookID uuid.NullUUID
+		)
+		if err := rows.Scan(&notebookID, &size.Tags, &size.Words, &size.Chars, &size.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan note size: %w", err)
+		}
+		size.NotebookID = notebookPtr(notebookID)
+		items = append(items, size)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list note sizes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) CountNotes(ctx context.Context) (store.NoteCounts, error) {
+	rows, err := s.db.Query(ctx, `SELECT is_favorite, is_archived, deleted_at IS NOT NULL, notebook_id, tags FROM notes`)
+	if err != nil {
+		return store.NoteCounts{}, fmt.Errorf("count notes: %w", err)
+	}
+	defer rows.Close()
+
+	var counter store.NoteCounter
+	for rows.Next() {
+		var (
+			favorite, archived, trashed bool
+			notebookID                  uuid.NullUUID
+			tags                        []string
+		)
+		if err := rows.Scan(&favorite, &archived, &trashed, &notebookID, &tags); err != nil {
+			return store.NoteCounts{}, fmt.Errorf("scan note counts: %w", err)
+		}
+		counter.Add(favorite, archived, trashed, notebookPtr(notebookID), tags)
+	}
+	if err := rows.Err(); err != nil {
+		return store.NoteCounts{}, fmt.Errorf("count notes: %w", err)
+	}
+	return counter.Counts(), nil
+}
+
+// SuggestTitles finds titles by pg_trgm, whose indexes answer both the
+// substring match and the word similarity that forgives typos; CockroachDB
+// has no word similarity and only matches substrings.
+func (s *Store) SuggestTitles(ctx context.Context, prefix string, limit int) ([]store.Note, error) {
+	match := `title ILIKE '%' || $1 || '%'`
+	if !s.cockroach && store.ForgivesTypo(prefix) {
+		match += ` OR $1 <% title`
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL AND (`+match+`)
+		ORDER BY title ILIKE $1 || '%' DESC, updated_at DESC, id DESC
+		LIMIT $2
+	`, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("suggest titles: %w", err)
+	}
+	defer rows.Close()
+
+	var items []store.Note
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("suggest titles: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) ListTags(ctx context.Context) ([]store.TagCount, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT tag, COUNT(*)
+		FROM notes, unnest(tags) AS tag
+		WHERE deleted_at IS NULL
+		GROUP BY tag
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			tag   string
+			count int
+		)
+		if err := rows.Scan(&tag, &count); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		counts[tag] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	return store.SortTagCounts(counts), nil
+}
+
+func (s *Store) ReplaceTags(ctx context.Context, from []string, to string, now time.Time) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id, tags FROM notes WHERE tags && $1 FOR UPDATE`, from)
+	if err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	updates := make(map[uuid.UUID][]string)
+	for rows.Next() {
+		var (
+			id   uuid.UUID
+			tags []string
+		)
+		if err := rows.Scan(&id, &tags); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan tags: %w", err)
+		}
+		if tags, ok := store.ReplaceTags(tags, from, to); ok {
+			updates[id] = tags
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+
+	for id, tags := range updates {
+		if _, err := tx.Exec(ctx, `UPDATE notes SET tags = $2, updated_at = $3, version = version + 1, change_seq = NULL WHERE id = $1`, id, tags, now); err != nil {
+			return 0, fmt.Errorf("replace tags: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	if len(updates) > 0 {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(updates), nil
+}
+
+func (s *Store) AddRevision(ctx context.Context, note store.Note, keep int) error {
+	return addRevision(ctx, s.db, note, keep)
+}
+
+type queryExecer interface {
+	execer
+	rowQuerier
+}
+
+func addRevision(ctx context.Context, q queryExecer, note store.Note, keep int) error {
+	var rev int
+	err := q.QueryRow(ctx, `
+		INSERT INTO note_revisions (note_id, rev, title, content, tags, saved_at)
+		SELECT $1, COALESCE(MAX(rev), 0) + 1, $2, $3, $4, $5
+		FROM note_revisions
+		WHERE note_id = $1
+		RETURNING rev
+	`, note.ID, note.Title, note.Content, note.Tags, note.UpdatedAt).Scan(&rev)
+	if err != nil {
+		return fmt.Errorf("add revision: %w", err)
+	}
+	if _, err := q.Exec(ctx, `DELETE FROM note_revisions WHERE note_id = $1 AND rev <= $2`, note.ID, rev-keep); err != nil {
+		return fmt.Errorf("prune revisions: %w", err)
+	}
+	return nil
+}
+
+const revisionColumns = `note_id, rev, title, content, tags, saved_at`
+
+func (s *Store) ListRevisions(ctx context.Context, noteID uuid.UUID) ([]store.Revision, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+revisionColumns+`
+		FROM note_revisions
+		WHERE note_id = $1
+		ORDER BY rev DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revs := []store.Revision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	return revs, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, noteID uuid.UUID, rev int) (store.Revision, error) {
+	r, err := scanRevision(s.db.QueryRow(ctx, `
+		SELECT `+revisionColumns+`
+		FROM note_revisions
+		WHERE note_id = $1 AND rev = $2
+	`, noteID, rev))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Revision{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Revision{}, fmt.Errorf("get revision: %w", err)
+	}
+	return r, nil
+}
+
+func (s *Store) SetRevisionContent(ctx context.Context, noteID uuid.UUID, rev int, content string) error {
+	result, err := s.db.Exec(ctx, `UPDATE note_revisions SET content = $3 WHERE note_id = $1 AND rev = $2`, noteID, rev, content)
+	if err != nil {
+		return fmt.Errorf("update revision: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func scanRevision(row pgx.Row) (store.Revision, error) {
+	var r store.Revision
+	err := row.Scan(&r.NoteID, &r.Rev, &r.Title, &r.Content, &r.Tags, &r.SavedAt)
+	return r, err
+}
+
+const attachmentColumns = `id, note_id, filename, content_type, size, created_at, COALESCE(extracted_text, '')`
+
+func (s *Store) CreateAttachment(ctx context.Context, a store.Attachment) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO attachments (id, note_id, filename, content_type, size, created_at, extracted_text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, a.ID, a.NoteID, a.Filename, a.ContentType, a.Size, a.CreatedAt, a.Text)
+	if err != nil {
+		return fmt.Errorf("create attachment: %w", err)
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) GetAttachment(ctx context.Context, id uuid.UUID) (store.Attachment, error) {
+	a, err := scanAttachment(s.db.QueryRow(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE id = $1 AND note_id IS NOT NULL
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Attachment{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Attachment{}, fmt.Errorf("get attachment: %w", err)
+	}
+	return a, nil
+}
+
+func (s *Store) ListAttachments(ctx context.Context, noteID uuid.UUID) ([]store.Attachment, error) {
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id = $1
+		ORDER BY created_at, id
+	`, noteID)
+}
+
+func (s *Store) DetachedAttachments(ctx context.Context, limit int) ([]store.Attachment, error) {
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id IS NULL
+		ORDER BY created_at, id
+		LIMIT $1
+	`, limit)
+}
+
+func (s *Store) queryAttachments(ctx context.Context, query string, args ...any) ([]store.Attachment, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteAttachment(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete attachment: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+// SearchAttachments matches each term as a substring ignoring case, and
+// accents too on Postgres, where unaccent is installed.
+func (s *Store) SearchAttachments(ctx context.Context, filter store.AttachmentFilter) ([]store.Attachment, error) {
+	fold := func(expr string) string {
+		if s.cockroach {
+			return expr
+		}
+		return "unaccent(" + expr + ")"
+	}
+	var clause string
+	var args []any
+	for _, term := range store.ParseTerms(filter.Query) {
+		args = append(args, term.Text)
+		param := fold("$" + strconv.Itoa(len(args)))
+		match := fold("filename") + ` ILIKE '%' || ` + param + ` || '%' OR ` + fold("COALESCE(extracted_text, '')") + ` ILIKE '%' || ` + param + ` || '%'`
+		if term.Exclude {
+			clause += " AND NOT (" + match + ")"
+		} else {
+			clause += " AND (" + match + ")"
+		}
+	}
+	// IDs are safe as literals once formatted as UUIDs.
+	if filter.IDs != nil {
+		ids := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			ids[i] = id.String()
+		}
+		clause += " AND id = ANY('{" + strings.Join(ids, ",") + "}'::uuid[])"
+	}
+	args = append(args, filter.Limit)
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id IN (SELECT id FROM notes WHERE deleted_at IS NULL)`+clause+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+}
+
+func (s *Store) ListAttachmentTexts(ctx context.Context, seq int64, id uuid.UUID, limit int) ([]store.Attachment, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+attachmentColumns+`, change_seq
+		FROM attachments
+		WHERE note_id IS NOT NULL AND extracted_text <> ''
+		  AND (change_seq, id) > ($1, $2)
+		ORDER BY change_seq, id
+		LIMIT $3
+	`, seq, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list attachment texts: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Attachment{}
+	for rows.Next() {
+		var counted int64
+		a, err := scanAttachment(rows, &counted)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		a.Seq = counted
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list attachment texts: %w", err)
+	}
+	return items, nil
+}
+
+// scanAttachment reads attachmentColumns, and then extra columns into
+// their destinations.
+func scanAttachment(row pgx.Row, extra ...any) (store.Attachment, error) {
+	var (
+		a      store.Attachment
+		noteID uuid.NullUUID
+	)
+	if err := row.Scan(append([]any{&a.ID, &noteID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt, &a.Text}, extra...)...); err != nil {
+		return store.Attachment{}, err
+	}
+	a.NoteID = noteID.UUID
+	return a, nil
+}
+
+const notebookColumns = `id, parent_id, name, created_at, updated_at`
+
+func (s *Store) ListNotebooks(ctx context.Context) ([]store.Notebook, error) {
+	return listNotebooks(ctx, s.db)
+}
+
+// querier is what listNotebooks needs from the pool, so DeleteNotebook can
+// run it inside its transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func listNotebooks(ctx context.Context, q querier) ([]store.Notebook, error) {
+	rows, err := q.Query(ctx, `SELECT `+notebookColumns+` FROM notebooks ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list notebooks: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Notebook{}
+	for rows.Next() {
+		nb, err := scanNotebook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan notebook: %w", err)
+		}
+		items = append(items, nb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list notebooks: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetNotebook(ctx context.Context, id uuid.UUID) (store.Notebook, error) {
+	return scanNotebookRow(s.db.QueryRow(ctx, `SELECT `+notebookColumns+` FROM notebooks WHERE id = $1`, id))
+}
+
+func (s *Store) CreateNotebook(ctx context.Context, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	return scanNotebookRow(s.db.QueryRow(ctx, `
+		INSERT INTO notebooks (`+notebookColumns+`)
+		VALUES ($1, $2, $3, $4, $4)
+		RETURNING `+notebookColumns,
+		uuid.New(), nullNotebook(input.ParentID), input.Name, now))
+}
+
+func (s *Store) InsertNotebook(ctx context.Context, nb store.Notebook) error {
+	return insertNotebook(ctx, s.db, nb)
+}
+
+func insertNotebook(ctx context.Context, e execer, nb store.Notebook) error {
+	_, err := e.Exec(ctx, `
+		INSERT INTO notebooks (`+notebookColumns+`)
+		VALUES ($1, $2, $3, $4, $5)
+	`, nb.ID, nullNotebook(nb.ParentID), nb.Name, nb.CreatedAt, nb.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert notebook: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateNotebook(ctx context.Context, id uuid.UUID, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	return scanNotebookRow(s.db.QueryRow(ctx, `
+		UPDATE notebooks
+		SET name = $2,
+		    parent_id = $3,
+		    updated_at = $4
+		WHERE id = $1
+		RETURNING `+notebookColumns,
+		id, input.Name, nullNotebook(input.ParentID), now))
+}
+
+func (s *Store) DeleteNotebook(ctx context.Context, id uuid.UUID, moveTo *uuid.UUID, trashNotes bool, now time.Time) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	all, err := listNotebooks(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(all, func(nb store.Notebook) bool { return nb.ID == id }) {
+		return store.ErrNotFound
+	}
+	var ids []string
+	for _, nbID := range store.Subtree(all, id) {
+		ids = append(ids, nbID.String())
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE notes
+		SET notebook_id = $2,
+		    deleted_at = CASE WHEN $3 THEN COALESCE(deleted_at, $4) ELSE deleted_at END,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE notebook_id = ANY($1::uuid[])
+	`, ids, nullNotebook(moveTo), trashNotes, now)
+	if err != nil {
+		return fmt.Errorf("move notebook notes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM notebooks WHERE id = ANY($1::uuid[])`, ids); err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func scanNotebook(row pgx.Row) (store.Notebook, error) {
+	var (
+		nb       store.Notebook
+		parentID uuid.NullUUID
+	)
+	err := row.Scan(&nb.ID, &parentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt)
+	nb.ParentID = notebookPtr(parentID)
+	return nb, err
+}
+
+func scanNotebookRow(row pgx.Row) (store.Notebook, error) {
+	nb, err := scanNotebook(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Notebook{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Notebook{}, fmt.Errorf("scan notebook: %w", err)
+	}
+	return nb, nil
+}
+
+// nullNotebook maps a notebook reference, where uuid.Nil means none, to
+// the column value.
+func nullNotebook(id *uuid.UUID) any {
+	if id == nil || *id == uuid.Nil {
+		return nil
+	}
+	return *id
+}
+
+// nullLocation splits a location into its columns, both NULL for none.
+func nullLocation(l *store.Location) (any, any) {
+	if l == nil {
+		return nil, nil
+	}
+	return l.Latitude, l.Longitude
+}
+
+func notebookPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func (s *Store) Settings(ctx context.Context) ([]byte, error) {
+	var data string
+	if err := s.db.QueryRow(ctx, `SELECT data FROM settings WHERE id = 1`).Scan(&data); err != nil {
+		return nil, fmt.Errorf("read settings: %w", err)
+	}
+	return []byte(data), nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, data []byte) error {
+	if _, err := s.db.Exec(ctx, `UPDATE settings SET data = $1 WHERE id = 1`, string(data)); err != nil {
+		return fmt.Errorf("save settings: %w", err)
+	}
+	return nil
+}
+
+const sessionColumns = `id, created_at, expires_at, last_seen_at, user_agent, ip`
+
+func scanSession(row pgx.Row) (store.Session, error) {
+	var session store.Session
+	err := row.Scan(&session.ID, &session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt, &session.UserAgent, &session.IP)
+	return session, err
+}
+
+func (s *Store) CreateSession(ctx context.Context, token string, session store.Session) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO sessions (id, token, created_at, expires_at, last_seen_at, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, session.ID, token, session.CreatedAt, session.ExpiresAt, session.LastSeenAt, session.UserAgent, session.IP)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) SessionActive(ctx context.Context, token string, now time.Time) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM sessions
+			WHERE token = $1
+			  AND expires_at > $2
+		)
+	`, token, now).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check session: %w", err)
+	}
+	return exists, nil
+}
+
+func (s *Store) GetSession(ctx context.Context, token string, now time.Time) (store.Session, error) {
+	session, err := scanSession(s.db.QueryRow(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE token = $1
+		  AND expires_at > $2
+	`, token, now))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Session{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Session{}, fmt.Errorf("get session: %w", err)
+	}
+	return session, nil
+}
+
+func (s *Store) TouchSession(ctx context.Context, token string, lastSeenAt, expiresAt time.Time) error {
+	result, err := s.db.Exec(ctx, `UPDATE sessions SET last_seen_at = $1, expires_at = $2 WHERE token = $3`, lastSeenAt, expiresAt, token)
+	if err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ListSessions(ctx context.Context, now time.Time) ([]store.Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE expires_at > $1
+		ORDER BY last_seen_at DESC, id
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		items = append(items, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, token string) error {
+	if _, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE token = $1`, token); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteSessionByID(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteOtherSessions(ctx context.Context, token string) (int, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE token <> $1`, token)
+	if err != nil {
+		return 0, fmt.Errorf("delete other sessions: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (s *Store) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (s *Store) GetTwoFactor(ctx context.Context) (store.TwoFactor, error) {
+	var tf store.TwoFactor
+	err := s.db.QueryRow(ctx, `
+		SELECT secret, enabled, last_step, (SELECT COUNT(*) FROM two_factor_recovery_codes)
+		FROM two_factor
+		WHERE id = 1
+	`).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep, &tf.RecoveryCodes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.TwoFactor{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.TwoFactor{}, fmt.Errorf("get two-factor: %w", err)
+	}
+	return tf, nil
+}
+
+func (s *Store) SetupTwoFactor(ctx context.Context, secret string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM two_factor_recovery_codes`); err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO two_factor (id, secret) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET secret = EXCLUDED.secret, enabled = false, last_step = 0
+	`, secret)
+	if err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) EnableTwoFactor(ctx context.Context, step int64, codeHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `UPDATE two_factor SET enabled = true, last_step = $1 WHERE id = 1`, step)
+	if err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM two_factor_recovery_codes`); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO two_factor_recovery_codes (code_hash) SELECT unnest($1::text[])`, codeHashes); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteTwoFactor(ctx context.Context) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("delete two-factor: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range []string{`DELETE FROM two_factor_recovery_codes`, `DELETE FROM two_factor`} {
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return fmt.Errorf("delete two-factor: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("delete two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UseTwoFactorStep(ctx context.Context, step int64) (bool, error) {
+	result, err := s.db.Exec(ctx, `UPDATE two_factor SET last_step = $1 WHERE id = 1 AND enabled AND last_step < $1`, step)
+	if err != nil {
+		return false, fmt.Errorf("use two-factor code: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, hash string) (bool, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM two_factor_recovery_codes WHERE code_hash = $1`, hash)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (s *Store) ShareNote(ctx context.Context, share store.NoteShare) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM note_shares WHERE note_id = $1`, share.NoteID); err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	var password *string
+	if share.PasswordHash != "" {
+		password = &share.PasswordHash
+	}
+	result, err := tx.Exec(ctx, `
+		INSERT INTO note_shares (note_id, slug, password_hash, expires_at, created_at)
+		SELECT id, $2::text, $3::text, $4::timestamptz, $5::timestamptz FROM notes WHERE id = $1 AND deleted_at IS NULL
+	`, share.NoteID, share.Slug, password, share.ExpiresAt, share.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ShareBySlug(ctx context.Context, slug string) (store.NoteShare, error) {
+	var (
+		share    store.NoteShare
+		password *string
+	)
+	err := s.db.QueryRow(ctx, `
+		SELECT note_id, slug, password_hash, expires_at, created_at
+		FROM note_shares
+		WHERE slug = $1
+	`, slug).Scan(&share.NoteID, &share.Slug, &password, &share.ExpiresAt, &share.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.NoteShare{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.NoteShare{}, fmt.Errorf("get share: %w", err)
+	}
+	if password != nil {
+		share.PasswordHash = *password
+	}
+	return share, nil
+}
+
+func (s *Store) DeleteShare(ctx context.Context, noteID uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM note_shares WHERE note_id = $1`, noteID)
+	if err != nil {
+		return fmt.Errorf("delete share: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) SetLinks(ctx context.Context, noteID uuid.UUID, targets []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM notes WHERE id = $1`, noteID).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM note_links WHERE source_id = $1`, noteID); err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	if len(targets) > 0 {
+		_, err := tx.Exec(ctx, `INSERT INTO note_links (source_id, target) SELECT $1, unnest($2::text[])`, noteID, targets)
+		if err != nil {
+			return fmt.Errorf("set links: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Links(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL
+		  AND (id::text IN (SELECT target FROM note_links WHERE source_id = $1)
+		    OR title IN (SELECT target FROM note_links WHERE source_id = $1))
+		ORDER BY title, id
+	`, noteID)
+}
+
+func (s *Store) Backlinks(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL
+		  AND id IN (
+		    SELECT source_id FROM note_links
+		    WHERE target = $1::text OR target IN (SELECT title FROM notes WHERE id = $2)
+		  )
+		ORDER BY title, id
+	`, noteID.String(), noteID)
+}
+
+func (s *Store) ListLinks(ctx context.Context) ([]store.Link, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT l.source_id, n.id
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		JOIN notes n ON n.id::text = l.target
+		WHERE src.deleted_at IS NULL AND n.deleted_at IS NULL AND n.id <> l.source_id
+		UNION
+		SELECT l.source_id, n.id
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		JOIN notes n ON n.title = l.target
+		WHERE src.deleted_at IS NULL AND n.deleted_at IS NULL AND n.id <> l.source_id
+		ORDER BY 1, 2
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []store.Link{}
+	for rows.Next() {
+		var l store.Link
+		if err := rows.Scan(&l.Source, &l.Target); err != nil {
+			return nil, fmt.Errorf("scan link: %w", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	return links, nil
+}
+
+func (s *Store) queryNotes(ctx context.Context, query string, args ...any) ([]store.Note, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list notes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, hook store.Webhook) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO webhooks (id, url, events, secret, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hook.ID, hook.URL, strings.Join(hook.Events, ","), hook.Secret, hook.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := s.db.Query(ctx, `SELECT id, url, events, secret, created_at FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Webhook{}
+	for rows.Next() {
+		var (
+			hook   store.Webhook
+			events string
+		)
+		if err := rows.Scan(&hook.ID, &hook.URL, &events, &hook.Secret, &hook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hook.Events = strings.Split(events, ",")
+		items = append(items, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) AddAuditEntry(ctx context.Context, e store.AuditEntry) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO audit_log (id, at, actor, action, entity, entity_id, summary, ip, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, e.ID, e.At, e.Actor, e.Action, e.Entity, e.EntityID, e.Summary, e.IP, e.RequestID)
+	if err != nil {
+		return fmt.Errorf("add audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, filter store.AuditFilter) ([]store.AuditEntry, int, error) {
+	const where = `
+		WHERE ($1::timestamptz IS NULL OR at >= $1)
+		  AND ($2::timestamptz IS NULL OR at < $2)
+		  AND ($3 = '' OR entity = $3)
+		  AND ($4 = '' OR entity_id = $4)
+		  AND ($5 = '' OR action = $5)
+	`
+	args := []any{nil, nil, filter.Entity, filter.EntityID, filter.Action}
+	if !filter.From.IsZero() {
+		args[0] = filter.From
+	}
+	if !filter.To.IsZero() {
+		args[1] = filter.To
+	}
+
+	var total int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit entries: %w", err)
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT id, at, actor, action, entity, entity_id, summary, ip, request_id
+		FROM audit_log`+where+`
+		ORDER BY at DESC, id DESC
+		LIMIT $6 OFFSET $7
+	`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.AuditEntry{}
+	for rows.Next() {
+		var e store.AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &e.Summary, &e.IP, &e.RequestID); err != nil {
+			return nil, 0, fmt.Errorf("scan audit entry: %w", err)
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	return items, total, nil
+}
+
+func (s *Store) DeleteAuditEntries(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM audit_log WHERE at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete audit entries: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (s *Store) RecordNoteAccess(ctx context.Context, noteID uuid.UUID, at time.Time) error {
+	result, err := s.db.Exec(ctx, `
+		INSERT INTO note_access (note_id, accessed_at)
+		SELECT id, $2 FROM notes WHERE id = $1
+	`, noteID, at)
+	if err != nil {
+		return fmt.Errorf("record note access: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ListAccessedNotes(ctx context.Context, filter store.AccessFilter) ([]store.AccessedNote, error) {
+	order := "last_opened DESC, id"
+	if filter.ByOpens {
+		order = "opens DESC, " + order
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT `+noteColumns+`, last_opened, opens
+		FROM notes
+		JOIN (
+		  SELECT note_id, MAX(accessed_at) AS last_opened, COUNT(*) AS opens
+		  FROM note_access
+		  WHERE accessed_at >= $1
+		  GROUP BY note_id
+		) a ON a.note_id = notes.id
+		WHERE deleted_at IS NULL
+		ORDER BY `+order+`
+		LIMIT $2
+	`, filter.Since, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list accessed notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.AccessedNote{}
+	for rows.Next() {
+		item, err := scanAccessedNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan accessed note: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list accessed notes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteNoteAccess(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM note_access WHERE accessed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete note access: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+const idempotencyColumns = `idempotency_key, fingerprint, status, headers, body, created_at`
+
+func scanIdempotentRequest(row pgx.Row) (store.IdempotentRequest, error) {
+	var (
+		req     store.IdempotentRequest
+		headers string
+	)
+	if err := row.Scan(&req.Key, &req.Fingerprint, &req.Status, &headers, &req.Body, &req.CreatedAt); err != nil {
+		return store.IdempotentRequest{}, err
+	}
+	if err := json.Unmarshal([]byte(headers), &req.Headers); err != nil {
+		return store.IdempotentRequest{}, fmt.Errorf("decode headers: %w", err)
+	}
+	return req, nil
+}
+
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, req store.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (store.IdempotentRequest, bool, error) {
+	result, err := s.db.Exec(ctx, `
+		INSERT INTO idempotency_keys (`+idempotencyColumns+`)
+		VALUES ($1, $2, 0, '{}', '', $3)
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = 0, headers = '{}', body = '', created_at = EXCLUDED.created_at
+		WHERE (idempotency_keys.status <> 0 AND idempotency_keys.created_at < $4)
+		   OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < $5)
+	`, req.Key, req.Fingerprint, req.CreatedAt, expiredBefore, abandonedBefore)
+	if err != nil {
+		return store.IdempotentRequest{}, false, fmt.Errorf("claim idempotency key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		held, err := scanIdempotentRequest(s.db.QueryRow(ctx, `SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE idempotency_key = $1`, req.Key))
+		if err != nil {
+			return store.IdempotentRequest{}, false, fmt.Errorf("claim idempotency key: %w", err)
+		}
+		return held, false, nil
+	}
+	req.Status, req.Headers, req.Body = 0, nil, ""
+	return req, true, nil
+}
+
+func (s *Store) FinishIdempotentRequest(ctx context.Context, req store.IdempotentRequest) error {
+	headers, err := json.Marshal(req.Headers)
+	if err != nil {
+		return fmt.Errorf("finish idempotent request: %w", err)
+	}
+	result, err := s.db.Exec(ctx, `
+		UPDATE idempotency_keys SET fingerprint = $2, status = $3, headers = $4, body = $5
+		WHERE idempotency_key = $1 AND status = 0
+	`, req.Key, req.Fingerprint, req.Status, string(headers), req.Body)
+	if err != nil {
+		return fmt.Errorf("finish idempotent request: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if _, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND status = 0`, key); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete idempotency keys: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+func (s *Store) GetDailyNote(ctx context.Context, day string) (store.Note, error) {
+	row := s.db.QueryRow(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		JOIN daily_notes ON daily_notes.note_id = notes.id
+		WHERE daily_notes.day = $1 AND deleted_at IS NULL
+	`, day)
+	return scanNoteRow(row)
+}
+
+func (s *Store) SetDailyNote(ctx context.Context, day string, noteID uuid.UUID) (uuid.UUID, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM daily_notes
+		WHERE day = $1 AND note_id IN (SELECT id FROM notes WHERE deleted_at IS NOT NULL)
+	`, day); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	// A concurrent insert of the day waits for this one to commit and then
+	// does nothing, reading the note inserted here below.
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO daily_notes (day, note_id)
+		SELECT $1::text, id FROM notes WHERE id = $2 AND deleted_at IS NULL
+		ON CONFLICT (day) DO NOTHING
+	`, day, noteID); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	var dayNoteID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT note_id FROM daily_notes WHERE day = $1`, day).Scan(&dayNoteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, store.ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	return dayNoteID, nil
+}
+
+func (s *Store) ListDailyNotes(ctx context.Context, from, to string) ([]store.DailyNote, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT daily_notes.day, notes.id, notes.title, notes.word_count
+		FROM daily_notes
+		JOIN notes ON notes.id = daily_notes.note_id
+		WHERE daily_notes.day BETWEEN $1 AND $2 AND notes.deleted_at IS NULL
+		ORDER BY daily_notes.day
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list daily notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.DailyNote{}
+	for rows.Next() {
+		var d store.DailyNote
+		if err := rows.Scan(&d.Date, &d.NoteID, &d.Title, &d.WordCount); err != nil {
+			return nil, fmt.Errorf("scan daily note: %w", err)
+		}
+		items = append(items, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list daily notes: %w", err)
+	}
+	return items, nil
+}
+
+const templateColumns = `id, name, title, content, tags, created_at, updated_at`
+
+func (s *Store) ListTemplates(ctx context.Context) ([]store.Template, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+templateColumns+` FROM templates ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan template: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetTemplate(ctx context.Context, id uuid.UUID) (store.Template, error) {
+	return scanTemplateRow(s.db.QueryRow(ctx, `SELECT `+templateColumns+` FROM templates WHERE id = $1`, id))
+}
+
+func (s *Store) CreateTemplate(ctx context.Context, input store.TemplateInput, now time.Time) (store.Template, error) {
+	return scanTemplateRow(s.db.QueryRow(ctx, `
+		INSERT INTO templates (`+templateColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		RETURNING `+templateColumns,
+		uuid.New(), input.Name, input.Title, input.Content, input.Tags, now))
+}
+
+func (s *Store) UpdateTemplate(ctx context.Context, id uuid.UUID, input store.TemplateInput, now time.Time) (store.Template, error) {
+	return scanTemplateRow(s.db.QueryRow(ctx, `
+		UPDATE templates
+		SET name = $2,
+		    title = $3,
+		    content = $4,
+		    tags = $5,
+		    updated_at = $6
+		WHERE id = $1
+		RETURNING `+templateColumns,
+		id, input.Name, input.Title, input.Content, input.Tags, now))
+}
+
+func (s *Store) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete template: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func scanTemplate(row pgx.Row) (store.Template, error) {
+	var t store.Template
+	err := row.Scan(&t.ID, &t.Name, &t.Title, &t.Content, &t.Tags, &t.CreatedAt, &t.UpdatedAt)
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	return t, err
+}
+
+func scanTemplateRow(row pgx.Row) (store.Template, error) {
+	t, err := scanTemplate(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Template{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Template{}, fmt.Errorf("scan template: %w", err)
+	}
+	return t, nil
+}
+
+const savedSearchColumns = `id, name, query, tag, favorite, notebook, created_at, updated_at`
+
+func (s *Store) ListSavedSearches(ctx context.Context) ([]store.SavedSearch, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan saved search: %w", err)
+		}
+		items = append(items, search)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list saved searches: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetSavedSearch(ctx context.Context, id uuid.UUID) (store.SavedSearch, error) {
+	return scanSavedSearchRow(s.db.QueryRow(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = $1`, id))
+}
+
+func (s *Store) CreateSavedSearch(ctx context.Context, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	return scanSavedSearchRow(s.db.QueryRow(ctx, `
+		INSERT INTO saved_searches (`+savedSearchColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING `+savedSearchColumns,
+		uuid.New(), input.Name, input.Query, input.Tag, input.Favorite, input.Notebook, now))
+}
+
+func (s *Store) UpdateSavedSearch(ctx context.Context, id uuid.UUID, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	return scanSavedSearchRow(s.db.QueryRow(ctx, `
+		UPDATE saved_searches
+		SET name = $2,
+		    query = $3,
+		    tag = $4,
+		    favorite = $5,
+		    notebook = $6,
+		    updated_at = $7
+		WHERE id = $1
+		RETURNING `+savedSearchColumns,
+		id, input.Name, input.Query, input.Tag, input.Favorite, input.Notebook, now))
+}
+
+func (s *Store) DeleteSavedSearch(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM saved_searches WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete saved search: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func scanSavedSearch(row pgx.Row) (store.SavedSearch, error) {
+	var search store.SavedSearch
+	err := row.Scan(&search.ID, &search.Name, &search.Query, &search.Tag, &search.Favorite, &search.Notebook, &search.CreatedAt, &search.UpdatedAt)
+	return search, err
+}
+
+func scanSavedSearchRow(row pgx.Row) (store.SavedSearch, error) {
+	search, err := scanSavedSearch(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.SavedSearch{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.SavedSearch{}, fmt.Errorf("scan saved search: %w", err)
+	}
+	return search, nil
+}
+
+const tokenColumns = `id, name, scope, created_at, last_used_at`
+
+func (s *Store) CreateAPIToken(ctx context.Context, token store.APIToken, hash string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO api_tokens (id, name, token_hash, scope, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token.ID, token.Name, hash, token.Scope, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListAPITokens(ctx context.Context) ([]store.APIToken, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+tokenColumns+` FROM api_tokens ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) APITokenByHash(ctx context.Context, hash string) (store.APIToken, error) {
+	t, err := scanToken(s.db.QueryRow(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE token_hash = $1`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.APIToken{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.APIToken{}, fmt.Errorf("get api token: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Store) TouchAPIToken(ctx context.Context, id uuid.UUID, now time.Time) error {
+	result, err := s.db.Exec(ctx, `UPDATE api_tokens SET last_used_at = $2 WHERE id = $1`, id, now)
+	if err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteAPIToken(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.Exec(ctx, `DELETE FROM api_tokens WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func scanToken(row pgx.Row) (store.APIToken, error) {
+	var t store.APIToken
+	err := row.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt)
+	return t, err
+}
+
+func scanNote(row pgx.Row) (store.Note, error) {
+	var (
+		n          store.Note
+		notebookID uuid.NullUUID
+	)
+	var stats store.TextStats
+	err := row.Scan(&n.ID, &n.Title, &n.Content, &n.Tags, &n.IsFavorite, &n.Language, &n.CreatedAt, &n.UpdatedAt, &n.DeletedAt, &n.Version, &notebookID, &n.IsPinned, &n.SortPosition, &n.IsArchived, &n.IsEncrypted,
+		&stats.Words, &stats.Chars, &n.DueAt, &n.ReminderAt, &n.Color, &n.Icon, &n.Latitude, &n.Longitude)
+	n.NotebookID = notebookPtr(notebookID)
+	n.SetStats(stats)
+	return n, err
+}
+
+func scanSearchResult(row pgx.Row) (store.Note, error) {
+	var (
+		n          store.Note
+		notebookID uuid.NullUUID
+		stats      store.TextStats
+		score      float32
+		snippet    string
+	)
+	err := row.Scan(&n.ID, &n.Title, &n.Content, &n.Tags, &n.IsFavorite, &n.Language, &n.CreatedAt, &n.UpdatedAt, &n.DeletedAt, &n.Version, &notebookID,
+		&n.IsPinned, &n.SortPosition, &n.IsArchived, &n.IsEncrypted, &stats.Words, &stats.Chars, &n.DueAt, &n.ReminderAt, &n.Color, &n.Icon, &n.Latitude, &n.Longitude, &score, &snippet)
+	if err != nil {
+		return store.Note{}, err
+	}
+	n.NotebookID = notebookPtr(notebookID)
+	n.SetStats(stats)
+	n.Score = float64(score)
+	n.Snippet = markMatches(snippet)
+	return n, nil
+}
+
+func scanAccessedNote(row pgx.Row) (store.AccessedNote, error) {
+	var (
+		a          store.AccessedNote
+		notebookID uuid.NullUUID
+		stats      store.TextStats
+	)
+	err := row.Scan(&a.ID, &a.Title, &a.Content, &a.Tags, &a.IsFavorite, &a.Language, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt, &a.Version, &notebookID,
+		&a.IsPinned, &a.SortPosition, &a.IsArchived, &a.IsEncrypted, &stats.Words, &stats.Chars, &a.DueAt, &a.ReminderAt, &a.Color, &a.Icon, &a.Latitude, &a.Longitude, &a.LastOpenedAt, &a.Opens)
+	a.NotebookID = notebookPtr(notebookID)
+	a.SetStats(stats)
+	return a, err
+}
+
+var matchMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// markMatches escapes a ts_headline excerpt and turns its match delimiters
+// into <mark> tags, so clients can render it as HTML.
+func markMatches(snippet string) string {
+	return matchMarks.Replace(html.EscapeString(snippet))
+}
+
+func scanNoteRow(row pgx.Row) (store.Note, error) {
+	n, err := scanNote(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return store.Note{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Note{}, fmt.Errorf("scan note: %w", err)
+	}
+	return n, nil
+}
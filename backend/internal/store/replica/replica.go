@@ -0,0 +1,196 @@
+// Package replica sends the reads of read-only requests to a replica of
+// the database, leaving everything else to the primary it wraps.
+package replica
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// RetryAfter is how long a replica that failed is left alone before
+// reads try it again.
+const RetryAfter = 30 * time.Second
+
+type preferKey struct{}
+
+// Prefer returns a context under which the Store reads from the replica.
+// Only requests that write nothing should be given one: what they read may
+// lag behind the primary.
+func Prefer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preferKey{}, true)
+}
+
+func preferred(ctx context.Context) bool {
+	prefer, _ := ctx.Value(preferKey{}).(bool)
+	return prefer
+}
+
+// Store is the primary, with the reads made under Prefer sent to the
+// replica instead. The replica is opened in the background on the first
+// of them, so that a replica that is down only costs reads falling back
+// to the primary: until it opens, for RetryAfter after it fails, and for
+// the read that failed, which is run again on the primary.
+type Store struct {
+	store.Store
+	open func(ctx context.Context) (store.Store, error)
+	now  func() time.Time
+
+	mu        sync.Mutex
+	replica   store.Store
+	opening   bool
+	downUntil time.Time
+	closed    bool
+}
+
+// New returns a Store reading from the primary and from the replica open
+// connects to.
+func New(primary store.Store, open func(ctx context.Context) (store.Store, error)) *Store {
+	return &Store{Store: primary, open: open, now: time.Now}
+}
+
+// pick returns the replica if ctx prefers it and it is up.
+func (s *Store) pick(ctx context.Context) (store.Store, bool) {
+	if !preferred(ctx) {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.now().Before(s.downUntil) {
+		return nil, false
+	}
+	if s.replica == nil {
+		if !s.opening {
+			s.opening = true
+			go s.connect()
+		}
+		return nil, false
+	}
+	return s.replica, true
+}
+
+func (s *Store) connect() {
+	ctx, cancel := context.WithTimeout(context.Background(), RetryAfter)
+	defer cancel()
+	replica, err := s.open(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opening = false
+	switch {
+	case err != nil:
+		log.Printf("replica: open: %v", err)
+		s.downUntil = s.now().Add(RetryAfter)
+	case s.closed:
+		replica.Close()
+	default:
+		s.replica = replica
+	}
+}
+
+// failed reports whether the replica's err calls for the read to run on
+// the primary, marking the replica down unless the note was only missing,
+// as it is while the replica catches up on it.
+func (s *Store) failed(ctx context.Context, err error) bool {
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return false
+	case errors.Is(err, store.ErrNotFound):
+		return true
+	}
+	log.Printf("replica: %v; reading from the primary for %s", err, RetryAfter)
+	s.mu.Lock()
+	s.downUntil = s.now().Add(RetryAfter)
+	s.mu.Unlock()
+	return true
+}
+
+// read runs fn on the replica when ctx prefers it, and on the primary
+// otherwise or when the replica fails.
+func read[T any](s *Store, ctx context.Context, fn func(store.Store) (T, error)) (T, error) {
+	if replica, ok := s.pick(ctx); ok {
+		v, err := fn(replica)
+		if !s.failed(ctx, err) {
+			return v, err
+		}
+	}
+	return fn(s.Store)
+}
+
+func (s *Store) GetNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	return read(s, ctx, func(st store.Store) (store.Note, error) { return st.GetNote(ctx, id) })
+}
+
+// ListNotes returns notes and total together, as read one place.
+func (s *Store) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	type page struct {
+		notes []store.Note
+		total int
+	}
+	p, err := read(s, ctx, func(st store.Store) (page, error) {
+		notes, total, err := st.ListNotes(ctx, filter)
+		return page{notes, total}, err
+	})
+	return p.notes, p.total, err
+}
+
+func (s *Store) EstimateNotes(ctx context.Context, filter store.NoteFilter) (int, error) {
+	return read(s, ctx, func(st store.Store) (int, error) {
+		estimator, ok := st.(store.NoteEstimator)
+		if !ok {
+			return -1, nil
+		}
+		return estimator.EstimateNotes(ctx, filter)
+	})
+}
+
+func (s *Store) SuggestTitles(ctx context.Context, prefix string, limit int) ([]store.Note, error) {
+	return read(s, ctx, func(st store.Store) ([]store.Note, error) { return st.SuggestTitles(ctx, prefix, limit) })
+}
+
+func (s *Store) ListTags(ctx context.Context) ([]store.TagCount, error) {
+	return read(s, ctx, func(st store.Store) ([]store.TagCount, error) { return st.ListTags(ctx) })
+}
+
+func (s *Store) ChangeSeq(ctx context.Context) (int64, error) {
+	return read(s, ctx, func(st store.Store) (int64, error) { return st.ChangeSeq(ctx) })
+}
+
+func (s *Store) SearchAttachments(ctx context.Context, filter store.AttachmentFilter) ([]store.Attachment, error) {
+	return read(s, ctx, func(st store.Store) ([]store.Attachment, error) { return st.SearchAttachments(ctx, filter) })
+}
+
+// Ping and PoolStats describe the primary, which the server cannot do
+// without; the replica only costs speed while it is down.
+func (s *Store) Ping(ctx context.Context) error {
+	checker, ok := s.Store.(store.HealthChecker)
+	if !ok {
+		return nil
+	}
+	return checker.Ping(ctx)
+}
+
+func (s *Store) PoolStats() store.PoolStats {
+	checker, ok := s.Store.(store.HealthChecker)
+	if !ok {
+		return store.PoolStats{}
+	}
+	return checker.PoolStats()
+}
+
+func (s *Store) Close() {
+	s.mu.Lock()
+	replica := s.replica
+	s.replica, s.closed = nil, true
+	s.mu.Unlock()
+	if replica != nil {
+		replica.Close()
+	}
+	s.Store.Close()
+}
@@ -0,0 +1,121 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+
+	"github.com/google/uuid"
+)
+
+// flakyStore fails its reads while down is set.
+type flakyStore struct {
+	*memory.Store
+	mu   sync.Mutex
+	down bool
+}
+
+func (s *flakyStore) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func (s *flakyStore) GetNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	s.mu.Lock()
+	down := s.down
+	s.mu.Unlock()
+	if down {
+		return store.Note{}, errors.New("connection refused")
+	}
+	return s.Store.GetNote(ctx, id)
+}
+
+func TestStore(t *testing.T) {
+	ctx, now := context.Background(), time.Now()
+	primary, secondary := memory.New(), &flakyStore{Store: memory.New()}
+	opens := make(chan error, 1)
+	opens <- errors.New("replica starting up")
+	st := New(primary, func(context.Context) (store.Store, error) {
+		if err := <-opens; err != nil {
+			return nil, err
+		}
+		return secondary, nil
+	})
+	clock := now
+	st.now = func() time.Time { return clock }
+	defer st.Close()
+
+	n, err := st.CreateNote(ctx, store.NoteInput{Title: "On the primary"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The replica has its own, older copy.
+	secondary.Store.CreateNote(ctx, store.NoteInput{Title: "On the replica"}, now)
+	read := Prefer(ctx)
+	waitOpen := func() {
+		t.Helper()
+		for range 100 {
+			st.mu.Lock()
+			opening := st.opening
+			st.mu.Unlock()
+			if !opening {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("the replica did not open")
+	}
+	titles := func(ctx context.Context) string {
+		t.Helper()
+		notes, _, err := st.ListNotes(ctx, store.NoteFilter{})
+		if err != nil || len(notes) != 1 {
+			t.Fatalf("ListNotes = %v, %v", notes, err)
+		}
+		return notes[0].Title
+	}
+
+	if got := titles(read); got != "On the primary" {
+		t.Errorf("ListNotes before the replica opens = %q", got)
+	}
+	waitOpen()
+	if got := titles(read); got != "On the primary" {
+		t.Errorf("ListNotes after the replica failed to open = %q", got)
+	}
+	clock = clock.Add(RetryAfter)
+	opens <- nil
+	titles(read)
+	waitOpen()
+	if got := titles(read); got != "On the replica" {
+		t.Errorf("ListNotes preferring the replica = %q", got)
+	}
+	if got := titles(ctx); got != "On the primary" {
+		t.Errorf("ListNotes without preferring the replica = %q", got)
+	}
+
+	// The note is not on the replica yet, so it is read from the primary.
+	if got, err := st.GetNote(read, n.ID); err != nil || got.Title != "On the primary" {
+		t.Errorf("GetNote missing on the replica = %q, %v", got.Title, err)
+	}
+	if got := titles(read); got != "On the replica" {
+		t.Errorf("ListNotes after a missing note = %q", got)
+	}
+
+	secondary.setDown(true)
+	if got, err := st.GetNote(read, n.ID); err != nil || got.Title != "On the primary" {
+		t.Errorf("GetNote with the replica down = %q, %v", got.Title, err)
+	}
+	if got := titles(read); got != "On the primary" {
+		t.Errorf("ListNotes after the replica failed = %q", got)
+	}
+	secondary.setDown(false)
+	clock = clock.Add(RetryAfter)
+	if got := titles(read); got != "On the replica" {
+		t.Errorf("ListNotes after RetryAfter = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"notes-backend/internal/migrate"
+	"notes-backend/internal/store"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+)
+
+// fold_text gives SQLite the same accent folding the other stores use.
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("fold_text", 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			text, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			return store.FoldText(text), nil
+		})
+}
+
+// dialect holds the few SQL fragments that differ between the database/sql
+// backends. Everything else is written in the common subset of both.
+type dialect struct {
+	migrate migrate.Dialect
+	// hasTag is a predicate matching notes whose JSON tags array contains
+	// the single bound tag argument.
+	hasTag string
+	// fold wraps a text column for accent- and case-insensitive matching
+	// against a pattern built with store.FoldText.
+	fold func(column string) string
+	// forUpdate locks the rows a SELECT reads inside a transaction. SQLite
+	// has no row locks and needs none, its transactions being serialized.
+	forUpdate string
+	// insertIgnore begins an INSERT that skips rows whose key is taken.
+	insertIgnore string
+}
+
+var (
+	sqliteDialect = dialect{
+		migrate:      migrate.SQLite,
+		hasTag:       `EXISTS (SELECT 1 FROM json_each(notes.tags) WHERE json_each.value = ?)`,
+		fold:         func(column string) string { return "fold_text(" + column + ")" },
+		insertIgnore: "INSERT OR IGNORE",
+	}
+	mysqlDialect = dialect{
+		migrate: migrate.MySQL,
+		hasTag:  `JSON_CONTAINS(tags, JSON_QUOTE(?))`,
+		// utf8mb4_0900_ai_ci, the MySQL 8 default, already ignores accents.
+		fold:         func(column string) string { return "lower(" + column + ")" },
+		forUpdate:    " FOR UPDATE",
+		insertIgnore: "INSERT IGNORE",
+	}
+)
+
+// OpenSQLite accepts either a plain file path or a file: URI. Foreign keys,
+// WAL and a busy timeout are always enabled on top of whatever the DSN sets.
+func OpenSQLite(ctx context.Context, path string) (*Store, error) {
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	dsn += separator + "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY
+	// errors under concurrent requests at no real cost for a personal app.
+	db.SetMaxOpenConns(1)
+
+	return open(ctx, db, sqliteDialect)
+}
+
+// OpenMySQL takes a go-sql-driver DSN (user:pass@tcp(host:3306)/notes) and
+// forces the options the store relies on: parsed UTC timestamps and
+// multi-statement migrations.
+func OpenMySQL(ctx context.Context, dsn string) (*Store, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse mysql dsn: %w", err)
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.MultiStatements = true
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql: %w", err)
+	}
+	return open(ctx, sql.OpenDB(connector), mysqlDialect)
+}
+
+func open(ctx context.Context, db *sql.DB, d dialect) (*Store, error) {
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+	return &Store{db: db, dialect: d}, nil
+}
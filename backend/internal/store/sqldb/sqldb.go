@@ -0,0 +1,2591 @@
+package sqldb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"notes-backend/internal/migrate"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Store implements the storage layer on top of database/sql for SQLite and
+// MySQL/MariaDB. Tags are kept as a JSON array and timestamps are generated
+// in Go, and writes are followed by a read instead of RETURNING, which MySQL
+// does not support.
+type Store struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+var (
+	_ store.Store         = (*Store)(nil)
+	_ store.HealthChecker = (*Store)(nil)
+)
+
+func (s *Store) Migrator(fsys fs.FS) *migrate.Migrator {
+	return migrate.New(s.db, s.dialect.migrate, fsys)
+}
+
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) PoolStats() store.PoolStats {
+	stats := s.db.Stats()
+	return store.PoolStats{
+		MaxOpen:   stats.MaxOpenConnections,
+		Open:      stats.OpenConnections,
+		InUse:     stats.InUse,
+		Idle:      stats.Idle,
+		WaitCount: stats.WaitCount,
+		WaitMS:    stats.WaitDuration.Milliseconds(),
+	}
+}
+
+const noteColumns = `id, title, content, tags, is_favorite, language, created_at, updated_at, deleted_at, version, notebook_id, is_pinned, sort_position, is_archived, is_encrypted, word_count, char_count, due_at, reminder_at, color, icon, latitude, longitude`
+
+// searchPatterns returns the LIKE patterns that find query in text: as a
+// substring, or with a typo by the variants of store.TypoPatterns.
+func searchPatterns(query string) []string {
+	query = store.FoldText(query)
+	return append([]string{"%" + query + "%"}, store.TypoPatterns(query)...)
+}
+
+// likeAny matches column against any of n patterns.
+func likeAny(column string, n int) string {
+	return "(" + strings.Repeat(column+" LIKE ? OR ", n-1) + column + " LIKE ?)"
+}
+
+func (s *Store) noteFilter(filter store.NoteFilter) (string, []any) {
+	trash := "deleted_at IS NULL"
+	if filter.Trashed {
+		trash = "deleted_at IS NOT NULL"
+	}
+	clause := `
+		WHERE ` + trash + `
+		  AND (? = '' OR ` + s.dialect.hasTag + `)
+		  AND (? IS NULL OR is_favorite = ?)
+		  AND (? IS NULL OR is_archived = ?)
+		  AND (? = 0 OR (? IS NULL AND notebook_id IS NULL) OR notebook_id = ?)
+		  AND (? IS NULL OR color = ?)
+		  AND (? IS NULL OR created_at >= ?)
+		  AND (? IS NULL OR created_at < ?)
+	`
+	from, to := nullTime(filter.CreatedFrom), nullTime(filter.CreatedTo)
+	notebook := nullNotebook(filter.Notebook)
+	args := []any{
+		filter.Tag, filter.Tag,
+		filter.Favorite, filter.Favorite,
+		filter.Archived, filter.Archived,
+		filter.Notebook != nil, notebook, notebook,
+		filter.Color, filter.Color,
+		from, from,
+		to, to,
+	}
+	columns := []string{"title", "CASE WHEN is_encrypted THEN '' ELSE content END"}
+	if filter.TitleOnly {
+		columns = columns[:1]
+	}
+	textClause, textArgs := s.termsClause(filter.Query, columns...)
+	titleClause, titleArgs := s.termsClause(filter.TitleQuery, "title")
+	clause += textClause + titleClause
+	args = append(append(args, textArgs...), titleArgs...)
+	for _, tag := range filter.Tags {
+		clause += "	  AND " + s.dialect.hasTag + "\n"
+		args = append(args, tag)
+	}
+	for _, tag := range filter.ExcludeTags {
+		clause += "	  AND NOT " + s.dialect.hasTag + "\n"
+		args = append(args, tag)
+	}
+	if len(filter.IDs) > 0 {
+		clause += "	  AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(filter.IDs)), ", ") + ")\n"
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	} else if filter.IDs != nil {
+		clause += "	  AND 1 = 0\n"
+	}
+	if filter.Near != nil {
+		// The latitude band can be read from the index on it; the haversine
+		// distance then settles each note in the band.
+		near := filter.Near
+		band := near.RadiusKm / store.EarthRadiusKm * 180 / math.Pi
+		clause += `	  AND latitude BETWEEN ? AND ?
+		  AND 2 * ? * ASIN(SQRT(POWER(SIN(RADIANS(latitude - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2))) <= ?
+	`
+		args = append(args, near.Center.Latitude-band, near.Center.Latitude+band,
+			store.EarthRadiusKm, near.Center.Latitude, near.Center.Latitude, near.Center.Longitude, near.RadiusKm)
+	}
+	return clause, args
+}
+
+// termsClause matches the terms of query in any of columns, which may be
+// expressions.
+func (s *Store) termsClause(query string, columns ...string) (string, []any) {
+	var clause string
+	var args []any
+	for _, term := range store.ParseTerms(query) {
+		patterns := searchPatterns(term.Text)
+		if term.Exclude {
+			patterns = []string{"%" + store.FoldText(term.Text) + "%"}
+		}
+		matches := make([]string, len(columns))
+		for i, column := range columns {
+			matches[i] = likeAny(s.dialect.fold(column), len(patterns))
+			for _, p := range patterns {
+				args = append(args, p)
+			}
+		}
+		if term.Exclude {
+			clause += "	  AND NOT (" + strings.Join(matches, " OR ") + ")\n"
+		} else {
+			clause += "	  AND (" + strings.Join(matches, " OR ") + ")\n"
+		}
+	}
+	return clause, args
+}
+
+// nullLocation splits a location into its columns, both NULL for none.
+func nullLocation(l *store.Location) (any, any) {
+	if l == nil {
+		return nil, nil
+	}
+	return l.Latitude, l.Longitude
+}
+
+// nullTime maps an open filter bound to NULL. Bounds are stored in UTC like
+// every other timestamp, which keeps SQLite's text comparison in order.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+func (s *Store) listOrder(filter store.NoteFilter) string {
+	if filter.Trashed && filter.After == nil {
+		return "deleted_at DESC"
+	}
+	sortBy := filter.Sort
+	if filter.After != nil {
+		sortBy = store.SortUpdated
+	}
+	switch sortBy {
+	case store.SortCreated:
+		return "is_pinned DESC, created_at DESC, updated_at DESC, id DESC"
+	case store.SortTitle:
+		return "is_pinned DESC, " + s.dialect.fold("title") + ", updated_at DESC, id DESC"
+	case store.SortManual:
+		return "is_pinned DESC, sort_position, updated_at DESC, id DESC"
+	case store.SortLength:
+		return "is_pinned DESC, word_count DESC, updated_at DESC, id DESC"
+	}
+	return "is_pinned DESC, updated_at DESC, id DESC"
+}
+
+// keysetClause narrows a listing to the notes after its cursor. It is kept
+// out of noteFilter so that counts still cover every page.
+func keysetClause(filter store.NoteFilter) (string, []any) {
+	if filter.After == nil || filter.After.UpdatedAt.IsZero() {
+		return "", nil
+	}
+	c := filter.After
+	at := c.UpdatedAt.UTC()
+	return ` AND (is_pinned < ? OR (is_pinned = ? AND (updated_at < ? OR (updated_at = ? AND id < ?))))`,
+		[]any{c.Pinned, c.Pinned, at, at, c.ID}
+}
+
+// nullNotebook maps a notebook reference, where uuid.Nil means none, to
+// the column value.
+func nullNotebook(id *uuid.UUID) any {
+	if id == nil || *id == uuid.Nil {
+		return nil
+	}
+	return *id
+}
+
+func nullTimePtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func (s *Store) ListNotes(ctx context.Context, filter store.NoteFilter) ([]store.Note, int, error) {
+	where, args := s.noteFilter(filter)
+
+	var total int
+	if !filter.SkipCount {
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notes`+where, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("count notes: %w", err)
+		}
+	}
+
+	keyset, keysetArgs := keysetClause(filter)
+	args = append(args, keysetArgs...)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes`+where+keyset+`
+		ORDER BY `+s.listOrder(filter)+`
+		LIMIT ? OFFSET ?
+	`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]store.Note, 0, filter.Limit)
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list notes: %w", err)
+	}
+	return items, total, nil
+}
+
+func (s *Store) GetNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = ? AND deleted_at IS NULL`, id)
+	n, err := scanNote(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Note{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Note{}, fmt.Errorf("scan note: %w", err)
+	}
+	return n, nil
+}
+
+func (s *Store) CreateNote(ctx context.Context, input store.NoteInput, now time.Time) (store.Note, error) {
+	tags, err := encodeTags(input.Tags)
+	if err != nil {
+		return store.Note{}, err
+	}
+	id := uuid.New()
+	now = now.UTC()
+	stats := input.ContentStats()
+	lat, lng := nullLocation(input.Location)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO notes (id, title, content, tags, is_favorite, language, notebook_id, created_at, updated_at, word_count, char_count, latitude, longitude)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, input.Title, input.Content, tags, input.IsFavorite,
+		store.LanguageOr(input.Language, store.DefaultLanguage), nullNotebook(input.NotebookID), now, now, stats.Words, stats.Chars, lat, lng)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("create note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) InsertNote(ctx context.Context, note store.Note) error {
+	if err := insertNote(ctx, s.db, note); err != nil {
+		return err
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) InsertNotes(ctx context.Context, notes []store.Note) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("insert notes: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, note := range notes {
+		if err := insertNote(ctx, tx, note); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("insert notes: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) InsertSnapshot(ctx context.Context, notebooks []store.Notebook, notes []store.Note) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, nb := range notebooks {
+		if err := insertNotebook(ctx, tx, nb); err != nil {
+			return err
+		}
+	}
+	for _, note := range notes {
+		if err := insertNote(ctx, tx, note); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertNote(ctx context.Context, e execer, note store.Note) error {
+	tags, err := encodeTags(note.Tags)
+	if err != nil {
+		return err
+	}
+	_, err = e.ExecContext(ctx, `
+		INSERT INTO notes (id, title, content, tags, is_favorite, language, created_at, updated_at, deleted_at, version, notebook_id, is_pinned, sort_position, is_archived, is_encrypted, word_count, char_count, due_at, reminder_at, color, icon, latitude, longitude)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, note.ID, note.Title, note.Content, tags, note.IsFavorite,
+		store.LanguageOr(note.Language, store.DefaultLanguage), note.CreatedAt.UTC(), note.UpdatedAt.UTC(), nullTimePtr(note.DeletedAt),
+		max(note.Version, 1), nullNotebook(note.NotebookID), note.IsPinned, note.SortPosition, note.IsArchived, note.IsEncrypted, note.WordCount, note.CharCount,
+		nullTimePtr(note.DueAt), nullTimePtr(note.ReminderAt), note.Color, note.Icon, note.Latitude, note.Longitude)
+	if err != nil {
+		return fmt.Errorf("insert note: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateNote(ctx context.Context, id uuid.UUID, input store.NoteInput, now time.Time) (store.Note, error) {
+	affected, err := updateNote(ctx, s.db, id, input, now)
+	if err != nil {
+		return store.Note{}, err
+	}
+	if affected == 0 {
+		if input.IfVersion == 0 {
+			return store.Note{}, store.ErrNotFound
+		}
+		// Tell a stale version apart from a missing note.
+		if _, err := s.GetNote(ctx, id); err != nil {
+			return store.Note{}, err
+		}
+		return store.Note{}, store.ErrConflict
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+// updateNote writes input over the live note id, at version
+// input.IfVersion unless that is 0, and returns how many rows it hit.
+func updateNote(ctx context.Context, e execer, id uuid.UUID, input store.NoteInput, now time.Time) (int64, error) {
+	tags, err := encodeTags(input.Tags)
+	if err != nil {
+		return 0, err
+	}
+	stats := input.ContentStats()
+	lat, lng := nullLocation(input.Location)
+	result, err := e.ExecContext(ctx, `
+		UPDATE notes
+		SET title = ?,
+		    content = ?,
+		    tags = ?,
+		    is_favorite = ?,
+		    language = COALESCE(NULLIF(?, ''), language),
+		    notebook_id = CASE WHEN ? THEN ? ELSE notebook_id END,
+		    latitude = CASE WHEN ? THEN ? ELSE latitude END,
+		    longitude = CASE WHEN ? THEN ? ELSE longitude END,
+		    word_count = ?,
+		    char_count = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+	`, input.Title, input.Content, tags, input.IsFavorite, input.Language,
+		input.NotebookID != nil, nullNotebook(input.NotebookID),
+		input.SetLocation, lat, input.SetLocation, lng, stats.Words, stats.Chars,
+		now.UTC(), id, input.IfVersion, input.IfVersion)
+	if err != nil {
+		return 0, fmt.Errorf("update note: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("update note: %w", err)
+	}
+	return affected, nil
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id uuid.UUID, now time.Time) error {
+	err := s.execOne(ctx, "delete note", `UPDATE notes SET deleted_at = ?, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NULL`, now.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id uuid.UUID) (store.Note, error) {
+	err := s.execOne(ctx, "restore note", `UPDATE notes SET deleted_at = NULL, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return store.Note{}, err
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) PurgeNote(ctx context.Context, id uuid.UUID) error {
+	purged, err := s.purgeNotes(ctx, "purge note", `id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return store.ErrNotFound
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	purged, err := s.purgeNotes(ctx, "purge trash", `deleted_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return purged, nil
+}
+
+// purgeNotes deletes the notes matching where, leaving a tombstone for
+// sync in place of each, and returns how many there were.
+func (s *Store) purgeNotes(ctx context.Context, what, where string, args ...any) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", what, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM notes WHERE `+where+s.dialect.forUpdate, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", what, err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", what, err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", what, err)
+	}
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_tombstones WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("%s: %w", what, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO note_tombstones (id) VALUES (?)`, id); err != nil {
+			return 0, fmt.Errorf("%s: %w", what, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM notes WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("%s: %w", what, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", what, err)
+	}
+	return len(ids), nil
+}
+
+// execOne runs a statement that must hit exactly one row and maps a miss
+// to store.ErrNotFound.
+func (s *Store) execOne(ctx context.Context, what, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ChangeSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	if err := s.db.QueryRowContext(ctx, `SELECT seq FROM note_changes WHERE id = 1`).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("read change seq: %w", err)
+	}
+	return seq, nil
+}
+
+// bumpChangeSeq runs after a note write has succeeded. A failed bump only
+// costs clients a cache hit they could have had, never a stale response on
+// the next change. It stamps the notes and tombstones written since the
+// last bump, and the attachments uploaded, with the new seq while holding
+// the counter's row, so that a seq is visible only along with everything
+// it counted.
+func (s *Store) bumpChangeSeq(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("bump change seq: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`UPDATE note_changes SET seq = seq + 1 WHERE id = 1`,
+		`UPDATE notes SET change_seq = (SELECT seq FROM note_changes WHERE id = 1) WHERE change_seq IS NULL`,
+		`UPDATE note_tombstones SET change_seq = (SELECT seq FROM note_changes WHERE id = 1) WHERE change_seq IS NULL`,
+		`UPDATE attachments SET change_seq = (SELECT seq FROM note_changes WHERE id = 1) WHERE change_seq IS NULL AND note_id IS NOT NULL`,
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("bump change seq: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("bump change seq: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListNoteChanges(ctx context.Context, since int64, limit int) (store.ChangePage, error) {
+	return store.PageChanges(ctx, since, limit, s.ChangeSeq, s.noteChanges)
+}
+
+func (s *Store) noteChanges(ctx context.Context, q store.ChangeQuery) ([]store.NoteChange, error) {
+	where, args, limit := `change_seq > ?`, []any{q.After}, ""
+	switch {
+	case q.Pending:
+		where, args = `change_seq IS NULL`, nil
+	case q.At > 0:
+		where, args = `change_seq = ?`, []any{q.At}
+	case q.Limit > 0:
+		limit = fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	var changes []store.NoteChange
+	rows, err := s.db.QueryContext(ctx, `SELECT change_seq, `+noteColumns+` FROM notes WHERE `+where+` ORDER BY change_seq`+limit, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list note changes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq sql.NullInt64
+		n, err := scanNote(seqScanner{rows, &seq})
+		if err != nil {
+			return nil, fmt.Errorf("scan note change: %w", err)
+		}
+		changes = append(changes, store.NoteChange{Seq: seq.Int64, ID: n.ID, Note: &n})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list note changes: %w", err)
+	}
+
+	purges, err := s.db.QueryContext(ctx, `SELECT change_seq, id FROM note_tombstones WHERE `+where+` ORDER BY change_seq`+limit, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list note purges: %w", err)
+	}
+	defer purges.Close()
+	for purges.Next() {
+		var (
+			seq sql.NullInt64
+			id  uuid.UUID
+		)
+		if err := purges.Scan(&seq, &id); err != nil {
+			return nil, fmt.Errorf("scan note purge: %w", err)
+		}
+		changes = append(changes, store.NoteChange{Seq: seq.Int64, ID: id})
+	}
+	if err := purges.Err(); err != nil {
+		return nil, fmt.Errorf("list note purges: %w", err)
+	}
+	return store.SortChanges(changes, q.Limit), nil
+}
+
+// seqScanner reads the change_seq column ahead of a note's.
+type seqScanner struct {
+	rowScanner
+	seq *sql.NullInt64
+}
+
+func (r seqScanner) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append([]any{r.seq}, dest...)...)
+}
+
+func (s *Store) SetFavorite(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notes
+		SET is_favorite = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL
+	`, value, now.UTC(), id)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("favorite note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) SetPinned(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notes
+		SET is_pinned = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL
+	`, value, now.UTC(), id)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("pin note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) SetArchived(ctx context.Context, id uuid.UUID, value bool, now time.Time) (store.Note, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notes
+		SET is_archived = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL
+	`, value, now.UTC(), id)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("archive note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) SetAppearance(ctx context.Context, id uuid.UUID, color, icon string, now time.Time) (store.Note, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notes
+		SET color = ?,
+		    icon = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL
+	`, color, icon, now.UTC(), id)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("set note appearance: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) SetSchedule(ctx context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (store.Note, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notes
+		SET due_at = ?,
+		    reminder_at = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL
+	`, nullTimePtr(dueAt), nullTimePtr(reminderAt), now.UTC(), id)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("schedule note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) ListScheduledNotes(ctx context.Context) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL AND (due_at IS NOT NULL OR reminder_at IS NOT NULL)
+		ORDER BY created_at, id
+	`)
+}
+
+func (s *Store) SetEncrypted(ctx context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (store.Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE notes
+		SET content = ?,
+		    is_encrypted = ?,
+		    updated_at = ?,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE id = ? AND deleted_at IS NULL AND version = ?
+	`, content, value, now.UTC(), id, ifVersion)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	if affected == 0 {
+		// Tell a stale version apart from a missing note, outside the
+		// transaction, which may hold the only connection.
+		_ = tx.Rollback()
+		if _, err := s.GetNote(ctx, id); err != nil {
+			return store.Note{}, err
+		}
+		return store.Note{}, store.ErrConflict
+	}
+	if value {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_revisions WHERE note_id = ?`, id); err != nil {
+			return store.Note{}, fmt.Errorf("delete revisions: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return store.Note{}, fmt.Errorf("encrypt note: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, id)
+}
+
+func (s *Store) ReorderNotes(ctx context.Context, ids []uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("reorder notes: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		result, err := tx.ExecContext(ctx, `UPDATE notes SET sort_position = ?, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NULL`, i+1, id)
+		if err != nil {
+			return fmt.Errorf("reorder notes: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("reorder notes: %w", err)
+		}
+		if affected == 0 {
+			return store.ErrNotFound
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("reorder notes: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) ApplyBulk(ctx context.Context, ops []store.BulkOp, now time.Time) ([]bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("bulk update: %w", err)
+	}
+	defer tx.Rollback()
+
+	now = now.UTC()
+	applied := make([]bool, len(ops))
+	for i, op := range ops {
+		var (
+			result sql.Result
+			err    error
+		)
+		switch op.Action {
+		case store.BulkDelete:
+			result, err = tx.ExecContext(ctx, `UPDATE notes SET deleted_at = ?, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NULL`, now, op.NoteID)
+		case store.BulkTag, store.BulkUntag:
+			var raw string
+			err = tx.QueryRowContext(ctx, `SELECT tags FROM notes WHERE id = ? AND deleted_at IS NULL`+s.dialect.forUpdate, op.NoteID).Scan(&raw)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("bulk update: %w", err)
+			}
+			var current []string
+			if err := json.Unmarshal([]byte(raw), &current); err != nil {
+				return nil, fmt.Errorf("decode tags: %w", err)
+			}
+			tags, err := encodeTags(op.ApplyTags(current))
+			if err != nil {
+				return nil, err
+			}
+			result, err = tx.ExecContext(ctx, `UPDATE notes SET tags = ?, updated_at = ?, version = version + 1, change_seq = NULL WHERE id = ?`, tags, now, op.NoteID)
+		case store.BulkFavorite:
+			result, err = tx.ExecContext(ctx, `UPDATE notes SET is_favorite = ?, updated_at = ?, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NULL`, op.Favorite, now, op.NoteID)
+		case store.BulkMove:
+			result, err = tx.ExecContext(ctx, `UPDATE notes SET notebook_id = ?, updated_at = ?, version = version + 1, change_seq = NULL WHERE id = ? AND deleted_at IS NULL`, nullNotebook(op.NotebookID), now, op.NoteID)
+		default:
+			return nil, fmt.Errorf("unknown bulk action %q", op.Action)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bulk %s: %w", op.Action, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("bulk %s: %w", op.Action, err)
+		}
+		applied[i] = affected > 0
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("bulk update: %w", err)
+	}
+	if slices.Contains(applied, true) {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return applied, nil
+}
+
+func (s *Store) MergeNotes(ctx context.Context, merge store.NoteMerge, now time.Time) (store.Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, check := range []struct {
+		id      uuid.UUID
+		version int64
+	}{{merge.TargetID, merge.Input.IfVersion}, {merge.SourceID, merge.SourceVersion}} {
+		var version int64
+		err := tx.QueryRowContext(ctx, `SELECT version FROM notes WHERE id = ? AND deleted_at IS NULL`+s.dialect.forUpdate, check.id).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Note{}, store.ErrNotFound
+		}
+		if err != nil {
+			return store.Note{}, fmt.Errorf("merge notes: %w", err)
+		}
+		if check.version != 0 && check.version != version {
+			return store.Note{}, store.ErrConflict
+		}
+	}
+	if merge.Revision != nil {
+		if err := addRevision(ctx, tx, *merge.Revision, merge.KeepRevisions); err != nil {
+			return store.Note{}, err
+		}
+	}
+	if _, err := updateNote(ctx, tx, merge.TargetID, merge.Input, now); err != nil {
+		return store.Note{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE attachments SET note_id = ? WHERE note_id = ?`, merge.TargetID, merge.SourceID); err != nil {
+		return store.Note{}, fmt.Errorf("move attachments: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE notes SET deleted_at = ?, version = version + 1, change_seq = NULL WHERE id = ?`, now.UTC(), merge.SourceID); err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return store.Note{}, fmt.Errorf("merge notes: %w", err)
+	}
+	if err := s.bumpChangeSeq(ctx); err != nil {
+		return store.Note{}, err
+	}
+	return s.GetNote(ctx, merge.TargetID)
+}
+
+func (s *Store) SetNoteStats(ctx context.Context, id uuid.UUID, stats store.TextStats) error {
+	err := s.execOne(ctx, "set note stats", `UPDATE notes SET word_count = ?, char_count = ?, change_seq = NULL WHERE id = ?`, stats.Words, stats.Chars, id)
+	if err != nil {
+		return err
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) ListNoteSizes(ctx context.Context) ([]store.NoteSize, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT notebook_id, tags, word_count, char_count, created_at FROM notes WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("list note sizes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.NoteSize{}
+	for rows.Next() {
+		var (
+			size       store.NoteSize
+			notebookID uuid.NullUUID
+			tags       string
+		)
+		if err := rows.Scan(&notebookID, &tags, &size.Words, &size.Chars, &size.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan note size: %w", err)
+		}
+		if notebookID.Valid {
+			size.NotebookID = &notebookID.UUID
+		}
+		if err := json.Unmarshal([]byte(tags), &size.Tags); err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+		items = append(items, size)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list note sizes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) CountNotes(ctx context.Context) (store.NoteCounts, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT is_favorite, is_archived, deleted_at IS NOT NULL, notebook_id, tags FROM notes`)
+	if err != nil {
+		return store.NoteCounts{}, fmt.Errorf("count notes: %w", err)
+	}
+	defer rows.Close()
+
+	var counter store.NoteCounter
+	for rows.Next() {
+		var (
+			favorite, archived, trashed bool
+			notebookID                  uuid.NullUUID
+			raw                         string
+			tags                        []string
+		)
+		if err := rows.Scan(&favorite, &archived, &trashed, &notebookID, &raw); err != nil {
+			return store.NoteCounts{}, fmt.Errorf("scan note counts: %w", err)
+		}
+		if err := json.Unmarshal([]byte(raw), &tags); err != nil {
+			return store.NoteCounts{}, fmt.Errorf("decode tags: %w", err)
+		}
+		var notebook *uuid.UUID
+		if notebookID.Valid {
+			notebook = &notebookID.UUID
+		}
+		counter.Add(favorite, archived, trashed, notebook, tags)
+	}
+	if err := rows.Err(); err != nil {
+		return store.NoteCounts{}, fmt.Errorf("count notes: %w", err)
+	}
+	return counter.Counts(), nil
+}
+
+func (s *Store) SuggestTitles(ctx context.Context, prefix string, limit int) ([]store.Note, error) {
+	patterns := searchPatterns(prefix)
+	args := make([]any, 0, len(patterns)+2)
+	for _, p := range patterns {
+		args = append(args, p)
+	}
+	// The first pattern without its leading % finds the titles that start
+	// with prefix.
+	args = append(args, patterns[0][1:], limit)
+	title := s.dialect.fold("title")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL AND `+likeAny(title, len(patterns))+`
+		ORDER BY CASE WHEN `+title+` LIKE ? THEN 0 ELSE 1 END, updated_at DESC, id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("suggest titles: %w", err)
+	}
+	defer rows.Close()
+
+	var items []store.Note
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("suggest titles: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) ListTags(ctx context.Context) ([]store.TagCount, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tags FROM notes WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("scan tags: %w", err)
+		}
+		var tags []string
+		if err := json.Unmarshal([]byte(raw), &tags); err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+		for _, t := range tags {
+			counts[t]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	return store.SortTagCounts(counts), nil
+}
+
+// ReplaceTags narrows the notes down with LIKE on the encoded arrays, which
+// every dialect can do, and leaves the exact match to store.ReplaceTags.
+// Each tag is looked for as encodeTags writes it and as MySQL prints its
+// JSON type, which does not escape <, > and &.
+func (s *Store) ReplaceTags(ctx context.Context, from []string, to string, now time.Time) (int, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	for _, tag := range from {
+		escaped, err := json.Marshal(tag)
+		if err != nil {
+			return 0, fmt.Errorf("encode tag: %w", err)
+		}
+		var plain bytes.Buffer
+		enc := json.NewEncoder(&plain)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(tag); err != nil {
+			return 0, fmt.Errorf("encode tag: %w", err)
+		}
+		for _, encoded := range slices.Compact([]string{string(escaped), strings.TrimSuffix(plain.String(), "\n")}) {
+			conditions = append(conditions, `tags LIKE ? ESCAPE '!'`)
+			args = append(args, "%"+likeEscaper.Replace(encoded)+"%")
+		}
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, tags FROM notes WHERE `+strings.Join(conditions, " OR ")+s.dialect.forUpdate, args...)
+	if err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	updates := make(map[string][]string)
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan tags: %w", err)
+		}
+		var tags []string
+		if err := json.Unmarshal([]byte(raw), &tags); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("decode tags: %w", err)
+		}
+		if tags, ok := store.ReplaceTags(tags, from, to); ok {
+			updates[id] = tags
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+
+	now = now.UTC()
+	for id, tags := range updates {
+		encoded, err := encodeTags(tags)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE notes SET tags = ?, updated_at = ?, version = version + 1, change_seq = NULL WHERE id = ?`, encoded, now, id); err != nil {
+			return 0, fmt.Errorf("replace tags: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("replace tags: %w", err)
+	}
+	if len(updates) > 0 {
+		if err := s.bumpChangeSeq(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(updates), nil
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (s *Store) AddRevision(ctx context.Context, note store.Note, keep int) error {
+	return addRevision(ctx, s.db, note, keep)
+}
+
+type queryExecer interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func addRevision(ctx context.Context, q queryExecer, note store.Note, keep int) error {
+	tags, err := encodeTags(note.Tags)
+	if err != nil {
+		return err
+	}
+	var rev int
+	err = q.QueryRowContext(ctx, `SELECT COALESCE(MAX(rev), 0) + 1 FROM note_revisions WHERE note_id = ?`, note.ID).Scan(&rev)
+	if err != nil {
+		return fmt.Errorf("add revision: %w", err)
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO note_revisions (note_id, rev, title, content, tags, saved_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, note.ID, rev, note.Title, note.Content, tags, note.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("add revision: %w", err)
+	}
+	if _, err := q.ExecContext(ctx, `DELETE FROM note_revisions WHERE note_id = ? AND rev <= ?`, note.ID, rev-keep); err != nil {
+		return fmt.Errorf("prune revisions: %w", err)
+	}
+	return nil
+}
+
+const revisionColumns = `note_id, rev, title, content, tags, saved_at`
+
+func (s *Store) ListRevisions(ctx context.Context, noteID uuid.UUID) ([]store.Revision, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+revisionColumns+`
+		FROM note_revisions
+		WHERE note_id = ?
+		ORDER BY rev DESC
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revs := []store.Revision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	return revs, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, noteID uuid.UUID, rev int) (store.Revision, error) {
+	r, err := scanRevision(s.db.QueryRowContext(ctx, `
+		SELECT `+revisionColumns+`
+		FROM note_revisions
+		WHERE note_id = ? AND rev = ?
+	`, noteID, rev))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Revision{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Revision{}, fmt.Errorf("get revision: %w", err)
+	}
+	return r, nil
+}
+
+func (s *Store) SetRevisionContent(ctx context.Context, noteID uuid.UUID, rev int, content string) error {
+	return s.execOne(ctx, "update revision", `UPDATE note_revisions SET content = ? WHERE note_id = ? AND rev = ?`, content, noteID, rev)
+}
+
+func scanRevision(row rowScanner) (store.Revision, error) {
+	var (
+		r    store.Revision
+		tags string
+	)
+	if err := row.Scan(&r.NoteID, &r.Rev, &r.Title, &r.Content, &tags, &r.SavedAt); err != nil {
+		return store.Revision{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &r.Tags); err != nil {
+		return store.Revision{}, fmt.Errorf("decode tags: %w", err)
+	}
+	return r, nil
+}
+
+const attachmentColumns = `id, note_id, filename, content_type, size, created_at, COALESCE(extracted_text, '')`
+
+func (s *Store) CreateAttachment(ctx context.Context, a store.Attachment) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO attachments (id, note_id, filename, content_type, size, created_at, extracted_text)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.NoteID, a.Filename, a.ContentType, a.Size, a.CreatedAt.UTC(), a.Text)
+	if err != nil {
+		return fmt.Errorf("create attachment: %w", err)
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) GetAttachment(ctx context.Context, id uuid.UUID) (store.Attachment, error) {
+	a, err := scanAttachment(s.db.QueryRowContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE id = ? AND note_id IS NOT NULL
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Attachment{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Attachment{}, fmt.Errorf("get attachment: %w", err)
+	}
+	return a, nil
+}
+
+func (s *Store) ListAttachments(ctx context.Context, noteID uuid.UUID) ([]store.Attachment, error) {
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id = ?
+		ORDER BY created_at, id
+	`, noteID)
+}
+
+func (s *Store) DetachedAttachments(ctx context.Context, limit int) ([]store.Attachment, error) {
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id IS NULL
+		ORDER BY created_at, id
+		LIMIT ?
+	`, limit)
+}
+
+func (s *Store) queryAttachments(ctx context.Context, query string, args ...any) ([]store.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteAttachment(ctx context.Context, id uuid.UUID) error {
+	if err := s.execOne(ctx, "delete attachment", `DELETE FROM attachments WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func (s *Store) SearchAttachments(ctx context.Context, filter store.AttachmentFilter) ([]store.Attachment, error) {
+	clause, args := s.termsClause(filter.Query, "filename", "COALESCE(extracted_text, '')")
+	if len(filter.IDs) > 0 {
+		clause += "	  AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(filter.IDs)), ", ") + ")\n"
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	} else if filter.IDs != nil {
+		clause += "	  AND 1 = 0\n"
+	}
+	return s.queryAttachments(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE note_id IN (SELECT id FROM notes WHERE deleted_at IS NULL)
+	`+clause+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, append(args, filter.Limit)...)
+}
+
+func (s *Store) ListAttachmentTexts(ctx context.Context, seq int64, id uuid.UUID, limit int) ([]store.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`, change_seq
+		FROM attachments
+		WHERE note_id IS NOT NULL AND extracted_text <> ''
+		  AND (change_seq > ? OR (change_seq = ? AND id > ?))
+		ORDER BY change_seq, id
+		LIMIT ?
+	`, seq, seq, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list attachment texts: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Attachment{}
+	for rows.Next() {
+		var counted int64
+		a, err := scanAttachment(rows, &counted)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		a.Seq = counted
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list attachment texts: %w", err)
+	}
+	return items, nil
+}
+
+// scanAttachment reads attachmentColumns, and then extra columns into
+// their destinations.
+func scanAttachment(row rowScanner, extra ...any) (store.Attachment, error) {
+	var (
+		a      store.Attachment
+		noteID uuid.NullUUID
+	)
+	if err := row.Scan(append([]any{&a.ID, &noteID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt, &a.Text}, extra...)...); err != nil {
+		return store.Attachment{}, err
+	}
+	a.NoteID = noteID.UUID
+	return a, nil
+}
+
+const notebookColumns = `id, parent_id, name, created_at, updated_at`
+
+func (s *Store) ListNotebooks(ctx context.Context) ([]store.Notebook, error) {
+	return listNotebooks(ctx, s.db)
+}
+
+// querier is what listNotebooks needs from *sql.DB, so DeleteNotebook can
+// run it inside its transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func listNotebooks(ctx context.Context, q querier) ([]store.Notebook, error) {
+	rows, err := q.QueryContext(ctx, `SELECT `+notebookColumns+` FROM notebooks ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list notebooks: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Notebook{}
+	for rows.Next() {
+		nb, err := scanNotebook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan notebook: %w", err)
+		}
+		items = append(items, nb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list notebooks: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetNotebook(ctx context.Context, id uuid.UUID) (store.Notebook, error) {
+	nb, err := scanNotebook(s.db.QueryRowContext(ctx, `SELECT `+notebookColumns+` FROM notebooks WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Notebook{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Notebook{}, fmt.Errorf("get notebook: %w", err)
+	}
+	return nb, nil
+}
+
+func (s *Store) CreateNotebook(ctx context.Context, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	nb := store.Notebook{
+		ID:        uuid.New(),
+		ParentID:  input.ParentID,
+		Name:      input.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.InsertNotebook(ctx, nb); err != nil {
+		return store.Notebook{}, err
+	}
+	return s.GetNotebook(ctx, nb.ID)
+}
+
+func (s *Store) InsertNotebook(ctx context.Context, nb store.Notebook) error {
+	return insertNotebook(ctx, s.db, nb)
+}
+
+func insertNotebook(ctx context.Context, e execer, nb store.Notebook) error {
+	_, err := e.ExecContext(ctx, `
+		INSERT INTO notebooks (`+notebookColumns+`)
+		VALUES (?, ?, ?, ?, ?)
+	`, nb.ID, nullNotebook(nb.ParentID), nb.Name, nb.CreatedAt.UTC(), nb.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("insert notebook: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateNotebook(ctx context.Context, id uuid.UUID, input store.NotebookInput, now time.Time) (store.Notebook, error) {
+	err := s.execOne(ctx, "update notebook", `
+		UPDATE notebooks
+		SET name = ?,
+		    parent_id = ?,
+		    updated_at = ?
+		WHERE id = ?
+	`, input.Name, nullNotebook(input.ParentID), now.UTC(), id)
+	if err != nil {
+		return store.Notebook{}, err
+	}
+	return s.GetNotebook(ctx, id)
+}
+
+func (s *Store) DeleteNotebook(ctx context.Context, id uuid.UUID, moveTo *uuid.UUID, trashNotes bool, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	defer tx.Rollback()
+
+	all, err := listNotebooks(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(all, func(nb store.Notebook) bool { return nb.ID == id }) {
+		return store.ErrNotFound
+	}
+	subtree := store.Subtree(all, id)
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(subtree)), ", ")
+	ids := make([]any, 0, len(subtree))
+	for _, nbID := range subtree {
+		ids = append(ids, nbID)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE notes
+		SET notebook_id = ?,
+		    deleted_at = CASE WHEN ? THEN COALESCE(deleted_at, ?) ELSE deleted_at END,
+		    version = version + 1,
+		    change_seq = NULL
+		WHERE notebook_id IN (`+in+`)
+	`, append([]any{nullNotebook(moveTo), trashNotes, now.UTC()}, ids...)...)
+	if err != nil {
+		return fmt.Errorf("move notebook notes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notebooks WHERE id IN (`+in+`)`, ids...); err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	return s.bumpChangeSeq(ctx)
+}
+
+func scanNotebook(row rowScanner) (store.Notebook, error) {
+	var (
+		nb       store.Notebook
+		parentID uuid.NullUUID
+	)
+	if err := row.Scan(&nb.ID, &parentID, &nb.Name, &nb.CreatedAt, &nb.UpdatedAt); err != nil {
+		return store.Notebook{}, err
+	}
+	if parentID.Valid {
+		nb.ParentID = &parentID.UUID
+	}
+	return nb, nil
+}
+
+func (s *Store) Settings(ctx context.Context) ([]byte, error) {
+	var data string
+	if err := s.db.QueryRowContext(ctx, `SELECT data FROM settings WHERE id = 1`).Scan(&data); err != nil {
+		return nil, fmt.Errorf("read settings: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// SaveSettings binds a string because MySQL rejects JSON built from a
+// binary argument.
+func (s *Store) SaveSettings(ctx context.Context, data []byte) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE settings SET data = ? WHERE id = 1`, string(data)); err != nil {
+		return fmt.Errorf("save settings: %w", err)
+	}
+	return nil
+}
+
+const sessionColumns = `id, created_at, expires_at, last_seen_at, user_agent, ip`
+
+func scanSession(row rowScanner) (store.Session, error) {
+	var session store.Session
+	err := row.Scan(&session.ID, &session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt, &session.UserAgent, &session.IP)
+	return session, err
+}
+
+func (s *Store) CreateSession(ctx context.Context, token string, session store.Session) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sessions (id, token, created_at, expires_at, last_seen_at, user_agent, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, session.ID, token, session.CreatedAt.UTC(), session.ExpiresAt.UTC(), session.LastSeenAt.UTC(), session.UserAgent, session.IP)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) SessionActive(ctx context.Context, token string, now time.Time) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE token = ?
+		  AND expires_at > ?
+	`, token, now.UTC()).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("check session: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *Store) GetSession(ctx context.Context, token string, now time.Time) (store.Session, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE token = ?
+		  AND expires_at > ?
+	`, token, now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Session{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Session{}, fmt.Errorf("get session: %w", err)
+	}
+	return session, nil
+}
+
+func (s *Store) TouchSession(ctx context.Context, token string, lastSeenAt, expiresAt time.Time) error {
+	return s.execOne(ctx, "touch session", `UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE token = ?`, lastSeenAt.UTC(), expiresAt.UTC(), token)
+}
+
+func (s *Store) ListSessions(ctx context.Context, now time.Time) ([]store.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE expires_at > ?
+		ORDER BY last_seen_at DESC, id
+	`, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		items = append(items, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, token string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token = ?`, token); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteSessionByID(ctx context.Context, id uuid.UUID) error {
+	return s.execOne(ctx, "delete session", `DELETE FROM sessions WHERE id = ?`, id)
+}
+
+func (s *Store) DeleteOtherSessions(ctx context.Context, token string) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token <> ?`, token)
+	if err != nil {
+		return 0, fmt.Errorf("delete other sessions: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete other sessions: %w", err)
+	}
+	return int(affected), nil
+}
+
+func (s *Store) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return int(affected), nil
+}
+
+func (s *Store) GetTwoFactor(ctx context.Context) (store.TwoFactor, error) {
+	var tf store.TwoFactor
+	err := s.db.QueryRowContext(ctx, `
+		SELECT secret, enabled, last_step, (SELECT COUNT(*) FROM two_factor_recovery_codes)
+		FROM two_factor
+		WHERE id = 1
+	`).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep, &tf.RecoveryCodes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.TwoFactor{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.TwoFactor{}, fmt.Errorf("get two-factor: %w", err)
+	}
+	return tf, nil
+}
+
+func (s *Store) SetupTwoFactor(ctx context.Context, secret string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{`DELETE FROM two_factor_recovery_codes`, `DELETE FROM two_factor`} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("set up two-factor: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO two_factor (id, secret) VALUES (1, ?)`, secret); err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("set up two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) EnableTwoFactor(ctx context.Context, step int64, codeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE two_factor SET enabled = ?, last_step = ? WHERE id = 1`, true, step)
+	if err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	} else if affected == 0 {
+		return store.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes`); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO two_factor_recovery_codes (code_hash) VALUES (?)`, hash); err != nil {
+			return fmt.Errorf("enable two-factor: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("enable two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteTwoFactor(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("delete two-factor: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{`DELETE FROM two_factor_recovery_codes`, `DELETE FROM two_factor`} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("delete two-factor: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("delete two-factor: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UseTwoFactorStep(ctx context.Context, step int64) (bool, error) {
+	err := s.execOne(ctx, "use two-factor code", `UPDATE two_factor SET last_step = ? WHERE id = 1 AND enabled = ? AND last_step < ?`, step, true, step)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, hash string) (bool, error) {
+	err := s.execOne(ctx, "use recovery code", `DELETE FROM two_factor_recovery_codes WHERE code_hash = ?`, hash)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) ShareNote(ctx context.Context, share store.NoteShare) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM note_shares WHERE note_id = ?`, share.NoteID); err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	var password any
+	if share.PasswordHash != "" {
+		password = share.PasswordHash
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO note_shares (note_id, slug, password_hash, expires_at, created_at)
+		SELECT id, ?, ?, ?, ? FROM notes WHERE id = ? AND deleted_at IS NULL
+	`, share.Slug, password, nullTimePtr(share.ExpiresAt), share.CreatedAt.UTC(), share.NoteID)
+	if err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	if affected == 0 {
+		return store.ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("share note: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ShareBySlug(ctx context.Context, slug string) (store.NoteShare, error) {
+	var (
+		share     store.NoteShare
+		password  sql.NullString
+		expiresAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT note_id, slug, password_hash, expires_at, created_at
+		FROM note_shares
+		WHERE slug = ?
+	`, slug).Scan(&share.NoteID, &share.Slug, &password, &expiresAt, &share.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.NoteShare{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.NoteShare{}, fmt.Errorf("get share: %w", err)
+	}
+	share.PasswordHash = password.String
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	return share, nil
+}
+
+func (s *Store) DeleteShare(ctx context.Context, noteID uuid.UUID) error {
+	return s.execOne(ctx, "delete share", `DELETE FROM note_shares WHERE note_id = ?`, noteID)
+}
+
+func (s *Store) SetLinks(ctx context.Context, noteID uuid.UUID, targets []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM notes WHERE id = ?`, noteID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM note_links WHERE source_id = ?`, noteID); err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	for _, target := range targets {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO note_links (source_id, target) VALUES (?, ?)`, noteID, target); err != nil {
+			return fmt.Errorf("set links: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("set links: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Links(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL
+		  AND (id IN (SELECT target FROM note_links WHERE source_id = ?)
+		    OR title IN (SELECT target FROM note_links WHERE source_id = ?))
+		ORDER BY title, id
+	`, noteID, noteID)
+}
+
+func (s *Store) Backlinks(ctx context.Context, noteID uuid.UUID) ([]store.Note, error) {
+	return s.queryNotes(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE deleted_at IS NULL
+		  AND id IN (
+		    SELECT source_id FROM note_links
+		    WHERE target = ? OR target IN (SELECT title FROM notes WHERE id = ?)
+		  )
+		ORDER BY title, id
+	`, noteID.String(), noteID)
+}
+
+func (s *Store) ListLinks(ctx context.Context) ([]store.Link, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT l.source_id, n.id
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		JOIN notes n ON n.id = l.target
+		WHERE src.deleted_at IS NULL AND n.deleted_at IS NULL AND n.id <> l.source_id
+		UNION
+		SELECT l.source_id, n.id
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		JOIN notes n ON n.title = l.target
+		WHERE src.deleted_at IS NULL AND n.deleted_at IS NULL AND n.id <> l.source_id
+		ORDER BY 1, 2
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []store.Link{}
+	for rows.Next() {
+		var l store.Link
+		if err := rows.Scan(&l.Source, &l.Target); err != nil {
+			return nil, fmt.Errorf("scan link: %w", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	return links, nil
+}
+
+func (s *Store) queryNotes(ctx context.Context, query string, args ...any) ([]store.Note, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list notes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, hook store.Webhook) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhooks (id, url, events, secret, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hook.ID, hook.URL, strings.Join(hook.Events, ","), hook.Secret, hook.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, url, events, secret, created_at FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Webhook{}
+	for rows.Next() {
+		var (
+			hook   store.Webhook
+			events string
+		)
+		if err := rows.Scan(&hook.ID, &hook.URL, &events, &hook.Secret, &hook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hook.Events = strings.Split(events, ",")
+		items = append(items, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return s.execOne(ctx, "delete webhook", `DELETE FROM webhooks WHERE id = ?`, id)
+}
+
+func (s *Store) AddAuditEntry(ctx context.Context, e store.AuditEntry) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (id, at, actor, action, entity, entity_id, summary, ip, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.At.UTC(), e.Actor, e.Action, e.Entity, e.EntityID, e.Summary, e.IP, e.RequestID)
+	if err != nil {
+		return fmt.Errorf("add audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, filter store.AuditFilter) ([]store.AuditEntry, int, error) {
+	from, to := nullTime(filter.From), nullTime(filter.To)
+	where := `
+		WHERE (? IS NULL OR at >= ?)
+		  AND (? IS NULL OR at < ?)
+		  AND (? = '' OR entity = ?)
+		  AND (? = '' OR entity_id = ?)
+		  AND (? = '' OR action = ?)
+	`
+	args := []any{from, from, to, to, filter.Entity, filter.Entity, filter.EntityID, filter.EntityID, filter.Action, filter.Action}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit entries: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, at, actor, action, entity, entity_id, summary, ip, request_id
+		FROM audit_log`+where+`
+		ORDER BY at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.AuditEntry{}
+	for rows.Next() {
+		var e store.AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &e.Summary, &e.IP, &e.RequestID); err != nil {
+			return nil, 0, fmt.Errorf("scan audit entry: %w", err)
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	return items, total, nil
+}
+
+func (s *Store) DeleteAuditEntries(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM audit_log WHERE at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete audit entries: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete audit entries: %w", err)
+	}
+	return int(affected), nil
+}
+
+func (s *Store) RecordNoteAccess(ctx context.Context, noteID uuid.UUID, at time.Time) error {
+	return s.execOne(ctx, "record note access", `
+		INSERT INTO note_access (note_id, accessed_at)
+		SELECT id, ? FROM notes WHERE id = ?
+	`, at.UTC(), noteID)
+}
+
+func (s *Store) ListAccessedNotes(ctx context.Context, filter store.AccessFilter) ([]store.AccessedNote, error) {
+	order := "last_opened DESC, id"
+	if filter.ByOpens {
+		order = "opens DESC, " + order
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`, last_opened, opens
+		FROM notes
+		JOIN (
+		  SELECT note_id, MAX(accessed_at) AS last_opened, COUNT(*) AS opens
+		  FROM note_access
+		  WHERE accessed_at >= ?
+		  GROUP BY note_id
+		) a ON a.note_id = notes.id
+		WHERE deleted_at IS NULL
+		ORDER BY `+order+`
+		LIMIT ?
+	`, filter.Since.UTC(), filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list accessed notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.AccessedNote{}
+	for rows.Next() {
+		var (
+			item       store.AccessedNote
+			lastOpened aggregateTime
+		)
+		item.Note, err = scanNote(withColumns{rows, []any{&lastOpened, &item.Opens}})
+		if err != nil {
+			return nil, fmt.Errorf("scan accessed note: %w", err)
+		}
+		item.LastOpenedAt = lastOpened.Time
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list accessed notes: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) DeleteNoteAccess(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM note_access WHERE accessed_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete note access: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete note access: %w", err)
+	}
+	return int(affected), nil
+}
+
+const idempotencyColumns = `idempotency_key, fingerprint, status, headers, body, created_at`
+
+func scanIdempotentRequest(row rowScanner) (store.IdempotentRequest, error) {
+	var (
+		req     store.IdempotentRequest
+		headers []byte
+	)
+	if err := row.Scan(&req.Key, &req.Fingerprint, &req.Status, &headers, &req.Body, &req.CreatedAt); err != nil {
+		return store.IdempotentRequest{}, err
+	}
+	if err := json.Unmarshal(headers, &req.Headers); err != nil {
+		return store.IdempotentRequest{}, fmt.Errorf("decode headers: %w", err)
+	}
+	return req, nil
+}
+
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, req store.IdempotentRequest, expiredBefore, abandonedBefore time.Time) (store.IdempotentRequest, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.IdempotentRequest{}, false, fmt.Errorf("claim idempotency key: %w", err)
+	}
+	defer tx.Rollback()
+
+	held, err := scanIdempotentRequest(tx.QueryRowContext(ctx, `
+		SELECT `+idempotencyColumns+`
+		FROM idempotency_keys
+		WHERE idempotency_key = ?`+s.dialect.forUpdate, req.Key))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (`+idempotencyColumns+`)
+			VALUES (?, ?, 0, '{}', '', ?)
+		`, req.Key, req.Fingerprint, req.CreatedAt.UTC())
+	case err != nil:
+		return store.IdempotentRequest{}, false, fmt.Errorf("claim idempotency key: %w", err)
+	case (held.Status != 0 && held.CreatedAt.Before(expiredBefore)) || (held.Status == 0 && held.CreatedAt.Before(abandonedBefore)):
+		_, err = tx.ExecContext(ctx, `
+			UPDATE idempotency_keys SET fingerprint = ?, status = 0, headers = '{}', body = '', created_at = ?
+			WHERE idempotency_key = ?
+		`, req.Fingerprint, req.CreatedAt.UTC(), req.Key)
+	default:
+		return held, false, nil
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		// A request claiming the key at the same time got the insert in
+		// first.
+		tx.Rollback()
+		if held, lookupErr := scanIdempotentRequest(s.db.QueryRowContext(ctx, `
+			SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE idempotency_key = ?
+		`, req.Key)); lookupErr == nil {
+			return held, false, nil
+		}
+		return store.IdempotentRequest{}, false, fmt.Errorf("claim idempotency key: %w", err)
+	}
+	req.Status, req.Headers, req.Body = 0, nil, ""
+	return req, true, nil
+}
+
+func (s *Store) FinishIdempotentRequest(ctx context.Context, req store.IdempotentRequest) error {
+	headers, err := json.Marshal(req.Headers)
+	if err != nil {
+		return fmt.Errorf("finish idempotent request: %w", err)
+	}
+	return s.execOne(ctx, "finish idempotent request", `
+		UPDATE idempotency_keys SET fingerprint = ?, status = ?, headers = ?, body = ?
+		WHERE idempotency_key = ? AND status = 0
+	`, req.Fingerprint, req.Status, string(headers), req.Body, req.Key)
+}
+
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = ? AND status = 0`, key); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete idempotency keys: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete idempotency keys: %w", err)
+	}
+	return int(affected), nil
+}
+
+func (s *Store) GetDailyNote(ctx context.Context, day string) (store.Note, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		JOIN daily_notes ON daily_notes.note_id = notes.id
+		WHERE daily_notes.day = ? AND deleted_at IS NULL
+	`, day)
+	n, err := scanNote(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Note{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Note{}, fmt.Errorf("scan daily note: %w", err)
+	}
+	return n, nil
+}
+
+func (s *Store) SetDailyNote(ctx context.Context, day string, noteID uuid.UUID) (uuid.UUID, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM daily_notes
+		WHERE day = ? AND note_id IN (SELECT id FROM notes WHERE deleted_at IS NOT NULL)
+	`, day); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.dialect.insertIgnore+` INTO daily_notes (day, note_id)
+		SELECT ?, id FROM notes WHERE id = ? AND deleted_at IS NULL
+	`, day, noteID); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	var dayNoteID uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT note_id FROM daily_notes WHERE day = ?`+s.dialect.forUpdate, day).Scan(&dayNoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, store.ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("set daily note: %w", err)
+	}
+	return dayNoteID, nil
+}
+
+func (s *Store) ListDailyNotes(ctx context.Context, from, to string) ([]store.DailyNote, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT daily_notes.day, notes.id, notes.title, notes.word_count
+		FROM daily_notes
+		JOIN notes ON notes.id = daily_notes.note_id
+		WHERE daily_notes.day BETWEEN ? AND ? AND notes.deleted_at IS NULL
+		ORDER BY daily_notes.day
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list daily notes: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.DailyNote{}
+	for rows.Next() {
+		var d store.DailyNote
+		if err := rows.Scan(&d.Date, &d.NoteID, &d.Title, &d.WordCount); err != nil {
+			return nil, fmt.Errorf("scan daily note: %w", err)
+		}
+		items = append(items, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list daily notes: %w", err)
+	}
+	return items, nil
+}
+
+const templateColumns = `id, name, title, content, tags, created_at, updated_at`
+
+func (s *Store) ListTemplates(ctx context.Context) ([]store.Template, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+templateColumns+` FROM templates ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan template: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetTemplate(ctx context.Context, id uuid.UUID) (store.Template, error) {
+	t, err := scanTemplate(s.db.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM templates WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Template{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.Template{}, fmt.Errorf("get template: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Store) CreateTemplate(ctx context.Context, input store.TemplateInput, now time.Time) (store.Template, error) {
+	tags, err := encodeTags(input.Tags)
+	if err != nil {
+		return store.Template{}, err
+	}
+	id := uuid.New()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO templates (`+templateColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, input.Name, input.Title, input.Content, tags, now.UTC(), now.UTC())
+	if err != nil {
+		return store.Template{}, fmt.Errorf("create template: %w", err)
+	}
+	return s.GetTemplate(ctx, id)
+}
+
+func (s *Store) UpdateTemplate(ctx context.Context, id uuid.UUID, input store.TemplateInput, now time.Time) (store.Template, error) {
+	tags, err := encodeTags(input.Tags)
+	if err != nil {
+		return store.Template{}, err
+	}
+	err = s.execOne(ctx, "update template", `
+		UPDATE templates
+		SET name = ?,
+		    title = ?,
+		    content = ?,
+		    tags = ?,
+		    updated_at = ?
+		WHERE id = ?
+	`, input.Name, input.Title, input.Content, tags, now.UTC(), id)
+	if err != nil {
+		return store.Template{}, err
+	}
+	return s.GetTemplate(ctx, id)
+}
+
+func (s *Store) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	return s.execOne(ctx, "delete template", `DELETE FROM templates WHERE id = ?`, id)
+}
+
+func scanTemplate(row rowScanner) (store.Template, error) {
+	var (
+		t    store.Template
+		tags string
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Title, &t.Content, &tags, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return store.Template{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+		return store.Template{}, fmt.Errorf("decode tags: %w", err)
+	}
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	return t, nil
+}
+
+const savedSearchColumns = `id, name, query, tag, favorite, notebook, created_at, updated_at`
+
+func (s *Store) ListSavedSearches(ctx context.Context) ([]store.SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan saved search: %w", err)
+		}
+		items = append(items, search)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list saved searches: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) GetSavedSearch(ctx context.Context, id uuid.UUID) (store.SavedSearch, error) {
+	search, err := scanSavedSearch(s.db.QueryRowContext(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.SavedSearch{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.SavedSearch{}, fmt.Errorf("get saved search: %w", err)
+	}
+	return search, nil
+}
+
+func (s *Store) CreateSavedSearch(ctx context.Context, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	id := uuid.New()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO saved_searches (`+savedSearchColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, input.Name, input.Query, input.Tag, input.Favorite, input.Notebook, now.UTC(), now.UTC())
+	if err != nil {
+		return store.SavedSearch{}, fmt.Errorf("create saved search: %w", err)
+	}
+	return s.GetSavedSearch(ctx, id)
+}
+
+func (s *Store) UpdateSavedSearch(ctx context.Context, id uuid.UUID, input store.SavedSearchInput, now time.Time) (store.SavedSearch, error) {
+	err := s.execOne(ctx, "update saved search", `
+		UPDATE saved_searches
+		SET name = ?,
+		    query = ?,
+		    tag = ?,
+		    favorite = ?,
+		    notebook = ?,
+		    updated_at = ?
+		WHERE id = ?
+	`, input.Name, input.Query, input.Tag, input.Favorite, input.Notebook, now.UTC(), id)
+	if err != nil {
+		return store.SavedSearch{}, err
+	}
+	return s.GetSavedSearch(ctx, id)
+}
+
+func (s *Store) DeleteSavedSearch(ctx context.Context, id uuid.UUID) error {
+	return s.execOne(ctx, "delete saved search", `DELETE FROM saved_searches WHERE id = ?`, id)
+}
+
+func scanSavedSearch(row rowScanner) (store.SavedSearch, error) {
+	var (
+		search   store.SavedSearch
+		favorite sql.NullBool
+	)
+	err := row.Scan(&search.ID, &search.Name, &search.Query, &search.Tag, &favorite, &search.Notebook, &search.CreatedAt, &search.UpdatedAt)
+	if err != nil {
+		return store.SavedSearch{}, err
+	}
+	if favorite.Valid {
+		search.Favorite = &favorite.Bool
+	}
+	return search, nil
+}
+
+const tokenColumns = `id, name, scope, created_at, last_used_at`
+
+func (s *Store) CreateAPIToken(ctx context.Context, token store.APIToken, hash string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, name, token_hash, scope, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, token.ID, token.Name, hash, token.Scope, token.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListAPITokens(ctx context.Context) ([]store.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	items := []store.APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) APITokenByHash(ctx context.Context, hash string) (store.APIToken, error) {
+	t, err := scanToken(s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE token_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.APIToken{}, store.ErrNotFound
+	}
+	if err != nil {
+		return store.APIToken{}, fmt.Errorf("get api token: %w", err)
+	}
+	return t, nil
+}
+
+// TouchAPIToken does not report missing tokens: MySQL counts only rows it
+// changed, and the time may already be stored.
+func (s *Store) TouchAPIToken(ctx context.Context, id uuid.UUID, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.UTC(), id); err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteAPIToken(ctx context.Context, id uuid.UUID) error {
+	return s.execOne(ctx, "delete api token", `DELETE FROM api_tokens WHERE id = ?`, id)
+}
+
+func scanToken(row rowScanner) (store.APIToken, error) {
+	var (
+		t          store.APIToken
+		lastUsedAt sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &lastUsedAt); err != nil {
+		return store.APIToken{}, err
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return t, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// withColumns scans the columns a query selects after a row's usual ones
+// into extra.
+type withColumns struct {
+	rowScanner
+	extra []any
+}
+
+func (r withColumns) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append(dest, r.extra...)...)
+}
+
+// aggregateTime scans a time computed by an aggregate such as MAX. SQLite
+// has no column type to convert such a value by and returns the stored
+// text, which the driver wrote with time.Time.String.
+type aggregateTime struct {
+	time.Time
+}
+
+func (t *aggregateTime) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("unsupported time value %T", src)
+	}
+	// A monotonic clock reading, when one was written, follows the zone.
+	text, _, _ = strings.Cut(text, " m=")
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999 -0700 MST", "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"} {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("parse time %q", text)
+}
+
+func scanNote(row rowScanner) (store.Note, error) {
+	var (
+		n    store.Note
+		tags string
+	)
+	var (
+		deletedAt, dueAt, reminderAt sql.NullTime
+		notebookID                   uuid.NullUUID
+	)
+	var stats store.TextStats
+	if err := row.Scan(&n.ID, &n.Title, &n.Content, &tags, &n.IsFavorite, &n.Language, &n.CreatedAt, &n.UpdatedAt, &deletedAt, &n.Version, &notebookID, &n.IsPinned, &n.SortPosition, &n.IsArchived, &n.IsEncrypted, &stats.Words, &stats.Chars, &dueAt, &reminderAt, &n.Color, &n.Icon, &n.Latitude, &n.Longitude); err != nil {
+		return store.Note{}, err
+	}
+	n.SetStats(stats)
+	if deletedAt.Valid {
+		n.DeletedAt = &deletedAt.Time
+	}
+	if dueAt.Valid {
+		n.DueAt = &dueAt.Time
+	}
+	if reminderAt.Valid {
+		n.ReminderAt = &reminderAt.Time
+	}
+	if notebookID.Valid {
+		n.NotebookID = &notebookID.UUID
+	}
+	if err := json.Unmarshal([]byte(tags), &n.Tags); err != nil {
+		return store.Note{}, fmt.Errorf("decode tags: %w", err)
+	}
+	if n.Tags == nil {
+		n.Tags = []string{}
+	}
+	return n, nil
+}
+
+func encodeTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("encode tags: %w", err)
+	}
+	return string(encoded), nil
+}
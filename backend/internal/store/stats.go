@@ -0,0 +1,50 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wordsPerMinute is the reading speed reading times assume.
+const wordsPerMinute = 200
+
+// TextStats measures a note's content.
+type TextStats struct {
+	Words int
+	Chars int
+}
+
+// MeasureText counts the words of content, runs of non-space characters
+// with a letter or digit in them so that Markdown such as "#" or "-" is
+// left out, and its characters.
+func MeasureText(content string) TextStats {
+	stats := TextStats{Chars: utf8.RuneCountInString(content)}
+	for _, field := range strings.Fields(content) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			stats.Words++
+		}
+	}
+	return stats
+}
+
+// ReadingTime is how many seconds reading that many words takes, rounded
+// up.
+func ReadingTime(words int) int {
+	return (words*60 + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// SetStats fills in the note's counts and the reading time that follows.
+func (n *Note) SetStats(stats TextStats) {
+	n.WordCount = stats.Words
+	n.CharCount = stats.Chars
+	n.ReadingTimeSeconds = ReadingTime(stats.Words)
+}
+
+// ContentStats is Stats if it is set and otherwise measures Content.
+func (in NoteInput) ContentStats() TextStats {
+	if in.Stats != nil {
+		return *in.Stats
+	}
+	return MeasureText(in.Content)
+}
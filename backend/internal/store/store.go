@@ -0,0 +1,1046 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a conditional update finds the note at a
+// different version than the caller expected.
+var ErrConflict = errors.New("version conflict")
+
+type Note struct {
+	ID         uuid.UUID `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Tags       []string  `json:"tags"`
+	IsFavorite bool      `json:"is_favorite"`
+	// IsPinned notes list before the others, whatever the sort.
+	IsPinned bool `json:"is_pinned"`
+	// IsArchived notes are left out of listings unless asked for.
+	IsArchived bool `json:"is_archived"`
+	// IsEncrypted notes hold content locked under a passphrase, which
+	// search leaves out.
+	IsEncrypted bool   `json:"is_encrypted"`
+	Language    string `json:"language"`
+	// SortPosition is the note's place in the manual order, 0 for notes
+	// never reordered, which come first.
+	SortPosition int64 `json:"sort_position"`
+	// NotebookID is nil for notes that are in no notebook.
+	NotebookID *uuid.UUID `json:"notebook_id"`
+	// Color is one of NoteColors and Icon an emoji; both are empty when
+	// unset.
+	Color string `json:"color"`
+	Icon  string `json:"icon"`
+	// Latitude and Longitude, in degrees, place the note on the map; they
+	// are set or nil together.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	// DueAt and ReminderAt, when set, put the note on the calendar feed.
+	DueAt      *time.Time `json:"due_at"`
+	ReminderAt *time.Time `json:"reminder_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// Version counts writes to the note, starting at 1.
+	Version int64 `json:"version"`
+	// WordCount and CharCount measure the content as written, before any
+	// encryption at rest or locking. ReadingTimeSeconds follows from
+	// WordCount.
+	WordCount          int `json:"word_count"`
+	CharCount          int `json:"char_count"`
+	ReadingTimeSeconds int `json:"reading_time_seconds"`
+	// DeletedAt is set while the note is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Score and Snippet are filled in by stores that rank text searches:
+	// the relevance and an HTML-escaped excerpt with matches in <mark>.
+	Score   float64 `json:"score,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+	// HTML is the content rendered from Markdown, filled in by the API for
+	// requests that ask for it.
+	HTML string `json:"html,omitempty"`
+}
+
+// Revision is an earlier version of a note, saved when an update replaced
+// it. Revs count up from 1 per note; SavedAt is when that version was
+// written, i.e. the note's updated_at at the time.
+type Revision struct {
+	NoteID  uuid.UUID `json:"note_id"`
+	Rev     int       `json:"rev"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Tags    []string  `json:"tags"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// Attachment describes a file uploaded to a note; the bytes are kept in a
+// blob store under the attachment ID. NoteID is uuid.Nil once the note has
+// been purged and the blob is waiting to be deleted.
+type Attachment struct {
+	ID          uuid.UUID `json:"id"`
+	NoteID      uuid.UUID `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Text is what could be read of the file for search, empty for files
+	// without any.
+	Text string `json:"-"`
+	// Seq is the ChangeSeq value that counted the upload, set by
+	// ListAttachmentTexts.
+	Seq int64 `json:"-"`
+}
+
+// AttachmentFilter selects attachments of live notes by their filenames
+// and text.
+type AttachmentFilter struct {
+	// Query is text in web search syntax, as ParseTerms splits it.
+	Query string
+	// IDs, when not nil, lists only the attachments among them, as a search
+	// index picked them.
+	IDs   []uuid.UUID
+	Limit int
+}
+
+// Session is a signed-in browser, known to it by a secret token that is
+// not part of this.
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// LastSeenAt is only as precise as the app cares to record it.
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// UserAgent and IP are those of the login.
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// APIToken lets scripts call the API without a session. Stores keep only
+// a hash of its secret, which is shown once, when the token is created.
+type APIToken struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Scope     TokenScope `json:"scope"`
+	CreatedAt time.Time  `json:"created_at"`
+	// LastUsedAt is nil for tokens never used, and otherwise only as
+	// precise as the app cares to record it.
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type TokenScope string
+
+const (
+	// ScopeRead tokens may only make GET and HEAD requests.
+	ScopeRead  TokenScope = "read"
+	ScopeWrite TokenScope = "write"
+)
+
+// NoteShare is a public read-only link to a note, at most one per note.
+type NoteShare struct {
+	NoteID uuid.UUID `json:"note_id"`
+	Slug   string    `json:"slug"`
+	// PasswordHash, when set, is what viewers' passwords are checked
+	// against.
+	PasswordHash string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Webhook is a URL note events are posted to, signed with Secret.
+type Webhook struct {
+	ID  uuid.UUID `json:"id"`
+	URL string    `json:"url"`
+	// Events lists the event types delivered, such as "note.created".
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Template is a starting point for new notes. Title and Content may hold
+// placeholders such as {{date}}, which are filled in when a note is made
+// from it, not when the template is saved.
+type Template struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type TemplateInput struct {
+	Name    string
+	Title   string
+	Content string
+	Tags    []string
+}
+
+// SavedSearch is a note listing filter kept under a name. Its fields take
+// the values of the GET /notes parameters of the same names; Notebook is
+// a notebook ID, "none" or empty for any.
+type SavedSearch struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Tag       string    `json:"tag"`
+	Favorite  *bool     `json:"favorite"`
+	Notebook  string    `json:"notebook"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SavedSearchInput struct {
+	Name     string
+	Query    string
+	Tag      string
+	Favorite *bool
+	Notebook string
+}
+
+// AccessedNote is a note with how it was opened since the cutoff it was
+// listed with.
+type AccessedNote struct {
+	Note
+	LastOpenedAt time.Time `json:"last_opened_at"`
+	Opens        int       `json:"opens"`
+}
+
+// AccessFilter selects the notes opened since Since, the latest opened
+// first or, with ByOpens, the most opened.
+type AccessFilter struct {
+	Since   time.Time
+	ByOpens bool
+	Limit   int
+}
+
+// DailyNote is the journal note of a day, without its content. Date is
+// the day as YYYY-MM-DD.
+type DailyNote struct {
+	Date      string    `json:"date"`
+	NoteID    uuid.UUID `json:"note_id"`
+	Title     string    `json:"title"`
+	WordCount int       `json:"word_count"`
+}
+
+// AuditEntry records a change made through the API.
+type AuditEntry struct {
+	ID uuid.UUID `json:"id"`
+	At time.Time `json:"at"`
+	// Actor is "session" for signed-in sessions, "token:<id>" for API
+	// tokens and empty before signing in.
+	Actor string `json:"actor"`
+	// Action names what was done, such as "note.update" or "auth.login".
+	Action string `json:"action"`
+	// Entity is the kind of thing changed, such as "note", and EntityID
+	// which one, empty when the action is not about one.
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	// Summary says briefly what changed, such as the fields of an update.
+	Summary   string `json:"summary"`
+	IP        string `json:"ip"`
+	RequestID string `json:"request_id"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything; From
+// and To bound At to [From, To).
+type AuditFilter struct {
+	From     time.Time
+	To       time.Time
+	Entity   string
+	EntityID string
+	Action   string
+	Limit    int
+	Offset   int
+}
+
+// Notebook groups notes. Notebooks nest through ParentID, which is nil at
+// the top level.
+type Notebook struct {
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type NotebookInput struct {
+	Name     string
+	ParentID *uuid.UUID
+}
+
+// Subtree returns id followed by the IDs of every notebook nested in it,
+// however deep.
+func Subtree(notebooks []Notebook, id uuid.UUID) []uuid.UUID {
+	children := make(map[uuid.UUID][]uuid.UUID)
+	for _, nb := range notebooks {
+		if nb.ParentID != nil {
+			children[*nb.ParentID] = append(children[*nb.ParentID], nb.ID)
+		}
+	}
+	ids := []uuid.UUID{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// NoteInput holds the writable fields of a note. An empty Language means
+// DefaultLanguage on create and "keep the current one" on update, and so
+// does a nil NotebookID for no notebook and the current one; uuid.Nil takes
+// an updated note out of its notebook.
+type NoteInput struct {
+	Title      string
+	Content    string
+	Tags       []string
+	IsFavorite bool
+	Language   string
+	NotebookID *uuid.UUID
+	// Location places a created note. Updates leave the note where it is
+	// unless SetLocation is true, when Location replaces its place and nil
+	// takes it off the map.
+	Location    *Location
+	SetLocation bool
+	// IfVersion makes an update apply only to that version of the note,
+	// failing with ErrConflict otherwise; 0 updates unconditionally.
+	IfVersion int64
+	// Stats, when set, are the counts stored for Content in place of
+	// measuring it, for wrappers that store Content transformed.
+	Stats *TextStats
+}
+
+type BulkAction string
+
+const (
+	BulkDelete   BulkAction = "delete"
+	BulkTag      BulkAction = "tag"
+	BulkUntag    BulkAction = "untag"
+	BulkFavorite BulkAction = "favorite"
+	BulkMove     BulkAction = "move"
+)
+
+// BulkOp is one step of ApplyBulk. Tags is what BulkTag adds and BulkUntag
+// removes, Favorite the flag BulkFavorite sets and NotebookID where BulkMove
+// puts the note, nil or uuid.Nil for no notebook.
+type BulkOp struct {
+	Action     BulkAction
+	NoteID     uuid.UUID
+	Tags       []string
+	Favorite   bool
+	NotebookID *uuid.UUID
+}
+
+// ApplyTags returns tags after a BulkTag or BulkUntag op.
+func (op BulkOp) ApplyTags(tags []string) []string {
+	out := make([]string, 0, len(tags)+len(op.Tags))
+	for _, t := range tags {
+		if op.Action != BulkUntag || !slices.Contains(op.Tags, t) {
+			out = append(out, t)
+		}
+	}
+	if op.Action == BulkTag {
+		for _, t := range op.Tags {
+			if !slices.Contains(out, t) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// DefaultLanguage is the text-search configuration used when none is given.
+const DefaultLanguage = "simple"
+
+// EarthRadiusKm is the mean radius of the Earth, which distances between
+// notes are measured on.
+const EarthRadiusKm = 6371.0088
+
+// Location is a point on the Earth in degrees, as GPS reports it.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Valid reports whether l is a point on the Earth.
+func (l Location) Valid() bool {
+	return l.Latitude >= -90 && l.Latitude <= 90 && l.Longitude >= -180 && l.Longitude <= 180
+}
+
+// DistanceKm is the great-circle distance from l to other.
+func (l Location) DistanceKm(other Location) float64 {
+	lat1, lat2 := l.Latitude*math.Pi/180, other.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (other.Longitude - l.Longitude) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(min(h, 1)))
+}
+
+// Near is a circle on the map, RadiusKm around Center.
+type Near struct {
+	Center   Location
+	RadiusKm float64
+}
+
+// Location is where the note is placed, nil when it is not.
+func (n Note) Location() *Location {
+	if n.Latitude == nil || n.Longitude == nil {
+		return nil
+	}
+	return &Location{Latitude: *n.Latitude, Longitude: *n.Longitude}
+}
+
+// SetLocation places the note at l, or takes it off the map when l is nil.
+func (n *Note) SetLocation(l *Location) {
+	n.Latitude, n.Longitude = nil, nil
+	if l != nil {
+		lat, lng := l.Latitude, l.Longitude
+		n.Latitude, n.Longitude = &lat, &lng
+	}
+}
+
+// NoteColors is the palette notes are colored from.
+var NoteColors = []string{"red", "orange", "yellow", "green", "teal", "blue", "purple", "pink", "gray"}
+
+// Languages lists the accepted note languages. They are the text-search
+// configurations built into PostgreSQL, which picks stemming by this name.
+var Languages = []string{
+	"simple", "arabic", "armenian", "basque", "catalan", "danish", "dutch",
+	"english", "finnish", "french", "german", "greek", "hindi", "hungarian",
+	"indonesian", "irish", "italian", "lithuanian", "nepali", "norwegian",
+	"portuguese", "romanian", "russian", "serbian", "spanish", "swedish",
+	"tamil", "turkish", "yiddish",
+}
+
+// LanguageOr returns language, or fallback when it is empty.
+func LanguageOr(language, fallback string) string {
+	if language == "" {
+		return fallback
+	}
+	return language
+}
+
+type NoteFilter struct {
+	// Query is text in web search syntax, as ParseTerms splits it: words
+	// and "quoted phrases" to find, and -words not to.
+	Query string
+	// TitleOnly restricts Query to titles, for content the database cannot
+	// read.
+	TitleOnly bool
+	// TitleQuery is matched against titles alone, as Query is.
+	TitleQuery string
+	// Language is the text search configuration Query is parsed with where
+	// search is stemmed; empty means DefaultLanguage.
+	Language string
+	// IDs, when not nil, lists only the notes among them, as a search
+	// index picked them.
+	IDs []uuid.UUID
+	// Trashed lists deleted notes, most recently deleted first, instead of
+	// live ones.
+	Trashed bool
+	Tag     string
+	// Tags, when set, lists only the notes with every one of them, and
+	// ExcludeTags only those without any of its.
+	Tags        []string
+	ExcludeTags []string
+	Favorite    *bool
+	// Archived, when set, lists only archived notes or only the others; nil
+	// lists both.
+	Archived *bool
+	// Notebook restricts the listing to one notebook, leaving out notebooks
+	// nested in it; uuid.Nil selects notes that are in none.
+	Notebook *uuid.UUID
+	// Color, when set, lists only the notes of that color; "" selects the
+	// uncolored ones.
+	Color *string
+	// Near, when set, lists only the notes placed within its radius.
+	Near *Near
+	// CreatedFrom and CreatedTo bound created_at to [CreatedFrom, CreatedTo);
+	// a zero time leaves that side open.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Sort orders live listings after pinned notes, which always come
+	// first. The empty sort is SortUpdated, except that stores ranking text
+	// searches order those by relevance.
+	Sort   NoteSort
+	Limit  int
+	Offset int
+	// After, when set, lists the notes that come after it in the
+	// SortUpdated order, pinned notes first, whatever order the filter would
+	// otherwise have. A zero Cursor starts from the top. Totals still count
+	// every match.
+	After *Cursor
+	// SkipCount lets ListNotes skip counting matches when the caller already
+	// has an estimate; the returned total is then meaningless.
+	SkipCount bool
+}
+
+type NoteSort string
+
+const (
+	// SortUpdated is the most recently updated first.
+	SortUpdated NoteSort = "updated"
+	// SortCreated is the most recently created first.
+	SortCreated NoteSort = "created"
+	// SortTitle is by title, ignoring case.
+	SortTitle NoteSort = "title"
+	// SortManual is by SortPosition, then as SortUpdated.
+	SortManual NoteSort = "manual"
+	// SortLength is the most words first, then as SortUpdated.
+	SortLength NoteSort = "length"
+)
+
+// NoteSorts are the sorts ListNotes accepts besides the empty one.
+var NoteSorts = []NoteSort{SortUpdated, SortCreated, SortTitle, SortManual, SortLength}
+
+// NoteSize is a note's place and counts, without its text.
+type NoteSize struct {
+	NotebookID *uuid.UUID
+	Tags       []string
+	Words      int
+	Chars      int
+	CreatedAt  time.Time
+}
+
+// TagCount is how many live notes carry a tag.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NoteCounts are the numbers of notes a sidebar shows. All, Favorites,
+// Tags and Notebooks count the live notes out of the archive, as listings
+// show them by default; Archived the live archived ones and Trashed the
+// deleted ones.
+type NoteCounts struct {
+	All       int             `json:"all"`
+	Favorites int             `json:"favorites"`
+	Archived  int             `json:"archived"`
+	Trashed   int             `json:"trashed"`
+	Tags      []TagCount      `json:"tags"`
+	Notebooks []NotebookCount `json:"notebooks"`
+}
+
+// NotebookCount has a nil NotebookID for the notes in no notebook.
+type NotebookCount struct {
+	NotebookID *uuid.UUID `json:"notebook_id"`
+	Count      int        `json:"count"`
+}
+
+// NoteCounter adds up NoteCounts a note at a time.
+type NoteCounter struct {
+	counts    NoteCounts
+	tags      map[string]int
+	notebooks map[uuid.UUID]int
+}
+
+func (c *NoteCounter) Add(favorite, archived, trashed bool, notebookID *uuid.UUID, tags []string) {
+	switch {
+	case trashed:
+		c.counts.Trashed++
+		return
+	case archived:
+		c.counts.Archived++
+		return
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]int)
+		c.notebooks = make(map[uuid.UUID]int)
+	}
+	c.counts.All++
+	if favorite {
+		c.counts.Favorites++
+	}
+	for _, t := range tags {
+		c.tags[t]++
+	}
+	book := uuid.Nil
+	if notebookID != nil {
+		book = *notebookID
+	}
+	c.notebooks[book]++
+}
+
+// Counts returns the sums, tags most used first and notebooks by ID with
+// the notes in none first.
+func (c *NoteCounter) Counts() NoteCounts {
+	counts := c.counts
+	counts.Tags = SortTagCounts(c.tags)
+	counts.Notebooks = make([]NotebookCount, 0, len(c.notebooks))
+	for id, count := range c.notebooks {
+		counts.Notebooks = append(counts.Notebooks, NotebookCount{NotebookID: &id, Count: count})
+	}
+	slices.SortFunc(counts.Notebooks, func(a, b NotebookCount) int {
+		return strings.Compare(a.NotebookID.String(), b.NotebookID.String())
+	})
+	if len(counts.Notebooks) > 0 && *counts.Notebooks[0].NotebookID == uuid.Nil {
+		counts.Notebooks[0].NotebookID = nil
+	}
+	return counts
+}
+
+// SortTagCounts turns counts per tag into TagCounts, most used first and
+// then by name.
+func SortTagCounts(counts map[string]int) []TagCount {
+	items := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		items = append(items, TagCount{Name: name, Count: count})
+	}
+	slices.SortFunc(items, func(a, b TagCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return items
+}
+
+// ReplaceTags returns tags with every tag of from replaced by to, where the
+// first of them was, or removed when to is empty. changed reports whether
+// tags had any of from.
+func ReplaceTags(tags, from []string, to string) (out []string, changed bool) {
+	out = make([]string, 0, len(tags))
+	for _, t := range tags {
+		if slices.Contains(from, t) {
+			changed = true
+			t = to
+		}
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out, changed
+}
+
+// Cursor is a position in a listing by pinned, updated_at then id: that of
+// the last note of a page.
+// NoteMerge is what MergeNotes does: Input replaces the target note, as
+// UpdateNote would, and the source note goes to the trash, its revisions
+// with it, once its attachments have moved to the target. Revision, when
+// set, is saved first as the target's next revision, keeping KeepRevisions.
+type NoteMerge struct {
+	TargetID      uuid.UUID
+	Input         NoteInput
+	SourceID      uuid.UUID
+	SourceVersion int64
+	Revision      *Note
+	KeepRevisions int
+}
+
+type Cursor struct {
+	Pinned    bool
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Methods that stamp or compare against the current time take it as now, so
+// callers decide what time it is.
+type NoteStore interface {
+	ListNotes(ctx context.Context, filter NoteFilter) ([]Note, int, error)
+	GetNote(ctx context.Context, id uuid.UUID) (Note, error)
+	CreateNote(ctx context.Context, input NoteInput, now time.Time) (Note, error)
+	UpdateNote(ctx context.Context, id uuid.UUID, input NoteInput, now time.Time) (Note, error)
+	// DeleteNote moves a note to the trash. Trashed notes are left out of
+	// everything except listings with Trashed set, RestoreNote and the purges.
+	DeleteNote(ctx context.Context, id uuid.UUID, now time.Time) error
+	RestoreNote(ctx context.Context, id uuid.UUID) (Note, error)
+	// PurgeNote deletes a note for good, whether or not it is in the trash.
+	PurgeNote(ctx context.Context, id uuid.UUID) error
+	// PurgeDeleted permanently removes notes trashed before the cutoff and
+	// returns how many there were.
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+	SetFavorite(ctx context.Context, id uuid.UUID, value bool, now time.Time) (Note, error)
+	SetPinned(ctx context.Context, id uuid.UUID, value bool, now time.Time) (Note, error)
+	SetArchived(ctx context.Context, id uuid.UUID, value bool, now time.Time) (Note, error)
+	// SetAppearance replaces a note's color and icon; "" clears them.
+	SetAppearance(ctx context.Context, id uuid.UUID, color, icon string, now time.Time) (Note, error)
+	// SetSchedule replaces a note's due date and reminder; nil clears them.
+	SetSchedule(ctx context.Context, id uuid.UUID, dueAt, reminderAt *time.Time, now time.Time) (Note, error)
+	// ListScheduledNotes returns the live notes with a due date or a
+	// reminder, oldest first.
+	ListScheduledNotes(ctx context.Context) ([]Note, error)
+	// SetEncrypted replaces the content of version ifVersion of a note and
+	// records whether the new content is locked, failing with ErrConflict
+	// for any other version. Locking a note also deletes its revisions,
+	// which hold its plain text, in the same transaction.
+	SetEncrypted(ctx context.Context, id uuid.UUID, value bool, content string, ifVersion int64, now time.Time) (Note, error)
+	// ReorderNotes gives the notes of ids the sort positions 1, 2, ... in
+	// that order, in one transaction. It fails with ErrNotFound, changing
+	// nothing, when one of them is missing or trashed. Versions are bumped
+	// but updated_at is left alone, so reordering does not reshuffle the
+	// other sorts.
+	ReorderNotes(ctx context.Context, ids []uuid.UUID) error
+	// ApplyBulk runs ops in order in one transaction and reports for each
+	// whether it found its note live; ops on missing or trashed notes are
+	// skipped rather than failing the rest.
+	ApplyBulk(ctx context.Context, ops []BulkOp, now time.Time) ([]bool, error)
+	// MergeNotes applies merge in one transaction. It fails with ErrNotFound
+	// when either note is missing or trashed and with ErrConflict when one
+	// is not at its expected version, Input.IfVersion for the target,
+	// changing nothing.
+	MergeNotes(ctx context.Context, merge NoteMerge, now time.Time) (Note, error)
+	// SuggestTitles returns up to limit live notes whose titles contain
+	// prefix, or it with a typo, those starting with it first and then the
+	// most recently updated.
+	SuggestTitles(ctx context.Context, prefix string, limit int) ([]Note, error)
+	// ListTags counts the live notes carrying each tag, as SortTagCounts
+	// orders them.
+	ListTags(ctx context.Context) ([]TagCount, error)
+	// ReplaceTags replaces the tags of from with to, or removes them when to
+	// is empty, on every note that has one, trashed notes included so they
+	// do not bring an old tag back on restore. It runs in one transaction,
+	// stamps the notes like a bulk tag edit and returns how many changed.
+	ReplaceTags(ctx context.Context, from []string, to string, now time.Time) (int, error)
+	// InsertNote stores a fully formed note as is, keeping its ID,
+	// timestamps and counts. It is meant for seeding and bulk loads, not for
+	// API writes.
+	InsertNote(ctx context.Context, note Note) error
+	// InsertNotes inserts notes like InsertNote in one transaction: either
+	// all of them are stored or none is.
+	InsertNotes(ctx context.Context, notes []Note) error
+	// InsertSnapshot inserts notebooks, in order so each parent comes
+	// before its children, and then notes, like InsertNotebook and
+	// InsertNote, in one transaction.
+	InsertSnapshot(ctx context.Context, notebooks []Notebook, notes []Note) error
+	// SetNoteStats rewrites the counts of a note, trashed or not, leaving the
+	// rest alone; it exists for recounting, writes otherwise keep them.
+	SetNoteStats(ctx context.Context, id uuid.UUID, stats TextStats) error
+	// ListNoteSizes returns what GET /stats adds up about each live note.
+	ListNoteSizes(ctx context.Context) ([]NoteSize, error)
+	// CountNotes adds up NoteCounts over every note, trashed included, in
+	// one pass.
+	CountNotes(ctx context.Context) (NoteCounts, error)
+	// ChangeSeq returns a counter that grows with every note write,
+	// including deletes and those of attachments, so equal values mean an
+	// unchanged collection.
+	ChangeSeq(ctx context.Context) (int64, error)
+}
+
+// NoteEstimator is implemented by stores that can cheaply estimate how many
+// notes match a filter from planner statistics. A negative estimate means
+// none is available.
+type NoteEstimator interface {
+	EstimateNotes(ctx context.Context, filter NoteFilter) (int, error)
+}
+
+// HealthChecker is implemented by stores backed by a database, which the
+// readiness probe pings.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+	PoolStats() PoolStats
+}
+
+// PoolStats describes a store's connection pool. MaxOpen is 0 when the
+// pool is unbounded.
+type PoolStats struct {
+	MaxOpen int `json:"max_open"`
+	Open    int `json:"open"`
+	InUse   int `json:"in_use"`
+	Idle    int `json:"idle"`
+	// WaitCount is how many times a caller has had to wait for a
+	// connection since the pool was opened, and WaitMS how long they
+	// waited in all.
+	WaitCount int64 `json:"wait_count"`
+	WaitMS    int64 `json:"wait_ms"`
+}
+
+type NotebookStore interface {
+	// ListNotebooks returns every notebook ordered by name; callers build
+	// the tree from ParentID.
+	ListNotebooks(ctx context.Context) ([]Notebook, error)
+	GetNotebook(ctx context.Context, id uuid.UUID) (Notebook, error)
+	CreateNotebook(ctx context.Context, input NotebookInput, now time.Time) (Notebook, error)
+	UpdateNotebook(ctx context.Context, id uuid.UUID, input NotebookInput, now time.Time) (Notebook, error)
+	// DeleteNotebook deletes a notebook together with its Subtree. Their
+	// notes, trashed ones included, move to moveTo, or out of any notebook
+	// when it is nil; trashNotes also moves the live ones to the trash.
+	DeleteNotebook(ctx context.Context, id uuid.UUID, moveTo *uuid.UUID, trashNotes bool, now time.Time) error
+	// InsertNotebook stores a notebook as is, like InsertNote; its parent
+	// must already exist.
+	InsertNotebook(ctx context.Context, nb Notebook) error
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, token string, session Session) error
+	SessionActive(ctx context.Context, token string, now time.Time) (bool, error)
+	// GetSession returns the session for token, or ErrNotFound when there
+	// is none active at now.
+	GetSession(ctx context.Context, token string, now time.Time) (Session, error)
+	// TouchSession records activity on the session for token, moving its
+	// expiry as sliding expiration does.
+	TouchSession(ctx context.Context, token string, lastSeenAt, expiresAt time.Time) error
+	// ListSessions returns the sessions active at now, most recently seen
+	// first.
+	ListSessions(ctx context.Context, now time.Time) ([]Session, error)
+	DeleteSession(ctx context.Context, token string) error
+	// DeleteSessionByID ends a session without its token, or returns
+	// ErrNotFound.
+	DeleteSessionByID(ctx context.Context, id uuid.UUID) error
+	// DeleteOtherSessions ends every session but the one for token and
+	// reports how many there were.
+	DeleteOtherSessions(ctx context.Context, token string) (int, error)
+	// DeleteExpiredSessions removes the sessions no longer active at now and
+	// reports how many there were.
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
+
+// TwoFactor is the TOTP second factor of logins.
+type TwoFactor struct {
+	// Secret is the base32 TOTP key.
+	Secret string
+	// Enabled is false between setup and the code that confirms it.
+	Enabled bool
+	// LastStep is the time step of the last code accepted; codes for it
+	// or earlier steps are refused, so that none works twice.
+	LastStep int64
+	// RecoveryCodes is how many unused recovery codes are left.
+	RecoveryCodes int
+}
+
+type TwoFactorStore interface {
+	// GetTwoFactor returns ErrNotFound while no second factor is set up.
+	GetTwoFactor(ctx context.Context) (TwoFactor, error)
+	// SetupTwoFactor replaces the second factor with a disabled one for
+	// secret, discarding recovery codes.
+	SetupTwoFactor(ctx context.Context, secret string) error
+	// EnableTwoFactor turns it on, with the code accepted for step and
+	// recovery codes given by their hashes, or returns ErrNotFound.
+	EnableTwoFactor(ctx context.Context, step int64, codeHashes []string) error
+	DeleteTwoFactor(ctx context.Context) error
+	// UseTwoFactorStep records a code accepted for step, reporting false
+	// when one for it or a later step already was.
+	UseTwoFactorStep(ctx context.Context, step int64) (bool, error)
+	// UseRecoveryCode deletes the recovery code with hash, reporting
+	// whether there was one.
+	UseRecoveryCode(ctx context.Context, hash string) (bool, error)
+}
+
+type TokenStore interface {
+	// CreateAPIToken stores a token under hash, the SHA-256 of its secret
+	// in hex.
+	CreateAPIToken(ctx context.Context, token APIToken, hash string) error
+	// ListAPITokens returns every token, newest first.
+	ListAPITokens(ctx context.Context) ([]APIToken, error)
+	APITokenByHash(ctx context.Context, hash string) (APIToken, error)
+	TouchAPIToken(ctx context.Context, id uuid.UUID, now time.Time) error
+	DeleteAPIToken(ctx context.Context, id uuid.UUID) error
+}
+
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, hook Webhook) error
+	// ListWebhooks returns every webhook, oldest first.
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+}
+
+type TemplateStore interface {
+	// ListTemplates returns every template ordered by name.
+	ListTemplates(ctx context.Context) ([]Template, error)
+	GetTemplate(ctx context.Context, id uuid.UUID) (Template, error)
+	CreateTemplate(ctx context.Context, input TemplateInput, now time.Time) (Template, error)
+	UpdateTemplate(ctx context.Context, id uuid.UUID, input TemplateInput, now time.Time) (Template, error)
+	DeleteTemplate(ctx context.Context, id uuid.UUID) error
+}
+
+type SavedSearchStore interface {
+	// ListSavedSearches returns every saved search ordered by name.
+	ListSavedSearches(ctx context.Context) ([]SavedSearch, error)
+	GetSavedSearch(ctx context.Context, id uuid.UUID) (SavedSearch, error)
+	CreateSavedSearch(ctx context.Context, input SavedSearchInput, now time.Time) (SavedSearch, error)
+	UpdateSavedSearch(ctx context.Context, id uuid.UUID, input SavedSearchInput, now time.Time) (SavedSearch, error)
+	DeleteSavedSearch(ctx context.Context, id uuid.UUID) error
+}
+
+type ShareStore interface {
+	// ShareNote stores share in place of the note's previous one, if any.
+	// It fails with ErrNotFound when the note is missing or trashed.
+	ShareNote(ctx context.Context, share NoteShare) error
+	ShareBySlug(ctx context.Context, slug string) (NoteShare, error)
+	DeleteShare(ctx context.Context, noteID uuid.UUID) error
+}
+
+// Link is a resolved [[link]] from one note to another.
+type Link struct {
+	Source uuid.UUID `json:"source"`
+	Target uuid.UUID `json:"target"`
+}
+
+// LinkStore keeps the targets of each note's [[links]], as LinkTargets
+// finds them, and resolves them against the live notes when read: an ID
+// target links to that note and a title target to every note titled
+// exactly so, whether it existed when the link was written or not.
+type LinkStore interface {
+	// SetLinks replaces the targets of the note's links.
+	SetLinks(ctx context.Context, noteID uuid.UUID, targets []string) error
+	// Links returns the live notes the note links to, by title.
+	Links(ctx context.Context, noteID uuid.UUID) ([]Note, error)
+	// Backlinks returns the live notes linking to the note, by title.
+	Backlinks(ctx context.Context, noteID uuid.UUID) ([]Note, error)
+	// ListLinks returns every link between two different live notes, once
+	// per pair and direction, ordered by source then target.
+	ListLinks(ctx context.Context) ([]Link, error)
+}
+
+type RevisionStore interface {
+	// AddRevision saves note as its next revision and drops the oldest ones
+	// beyond keep.
+	AddRevision(ctx context.Context, note Note, keep int) error
+	// ListRevisions returns a note's revisions, newest first.
+	ListRevisions(ctx context.Context, noteID uuid.UUID) ([]Revision, error)
+	GetRevision(ctx context.Context, noteID uuid.UUID, rev int) (Revision, error)
+	// SetRevisionContent rewrites a stored revision's content in place; it
+	// exists for re-encryption, revisions are otherwise immutable.
+	SetRevisionContent(ctx context.Context, noteID uuid.UUID, rev int, content string) error
+}
+
+type AttachmentStore interface {
+	CreateAttachment(ctx context.Context, a Attachment) error
+	GetAttachment(ctx context.Context, id uuid.UUID) (Attachment, error)
+	// ListAttachments returns a note's attachments, oldest first.
+	ListAttachments(ctx context.Context, noteID uuid.UUID) ([]Attachment, error)
+	DeleteAttachment(ctx context.Context, id uuid.UUID) error
+	// DetachedAttachments returns up to limit attachments whose note has been
+	// purged, so their blobs can be deleted before the rows.
+	DetachedAttachments(ctx context.Context, limit int) ([]Attachment, error)
+	// SearchAttachments returns up to filter.Limit attachments of notes
+	// not in the trash whose filename or text match, newest first.
+	SearchAttachments(ctx context.Context, filter AttachmentFilter) ([]Attachment, error)
+	// ListAttachmentTexts returns up to limit attachments with text, by
+	// Seq and then ID, starting after seq and id, for a search index to
+	// follow. Uploads are counted as note writes are, and listed once
+	// counted.
+	ListAttachmentTexts(ctx context.Context, seq int64, id uuid.UUID, limit int) ([]Attachment, error)
+}
+
+type AuditStore interface {
+	AddAuditEntry(ctx context.Context, entry AuditEntry) error
+	// ListAuditEntries returns the entries matching filter, newest first,
+	// and how many match in all.
+	ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, int, error)
+	// DeleteAuditEntries removes the entries from before the cutoff and
+	// reports how many there were.
+	DeleteAuditEntries(ctx context.Context, before time.Time) (int, error)
+}
+
+// AccessStore logs when notes are opened, for listing the recent and
+// frequent ones.
+type AccessStore interface {
+	RecordNoteAccess(ctx context.Context, noteID uuid.UUID, at time.Time) error
+	// ListAccessedNotes returns the live notes matching filter.
+	ListAccessedNotes(ctx context.Context, filter AccessFilter) ([]AccessedNote, error)
+	// DeleteNoteAccess removes the opens from before the cutoff and reports
+	// how many there were.
+	DeleteNoteAccess(ctx context.Context, before time.Time) (int, error)
+}
+
+// DailyStore keeps which note is the journal of which day. Days are
+// written YYYY-MM-DD, in whatever time zone the caller counts them.
+type DailyStore interface {
+	// GetDailyNote returns the day's note, failing with ErrNotFound when it
+	// has none or its note is in the trash.
+	GetDailyNote(ctx context.Context, day string) (Note, error)
+	// SetDailyNote makes the note the day's unless the day already has a
+	// live one, as when another server made it first, and returns the ID of
+	// the day's note. A trashed note is replaced. It fails with ErrNotFound
+	// when the note is missing or trashed and the day has none.
+	SetDailyNote(ctx context.Context, day string, noteID uuid.UUID) (uuid.UUID, error)
+	// ListDailyNotes returns the days from from to to, both included, that
+	// have a live note, in order.
+	ListDailyNotes(ctx context.Context, from, to string) ([]DailyNote, error)
+}
+
+// IdempotentRequest is a request made with an Idempotency-Key and, once it
+// has finished, the response its retries are given.
+type IdempotentRequest struct {
+	Key string
+	// Fingerprint tells the request apart from others made with the same
+	// key, which are refused rather than given its response. It is only
+	// known once the request has been read, by the time it finishes.
+	Fingerprint string
+	// Status is 0 while the request is in progress.
+	Status int
+	// Headers are those of the response that are given again with it.
+	Headers   map[string]string
+	Body      string
+	CreatedAt time.Time
+}
+
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey records req as in progress and reports true,
+	// unless its key has a record that finished at or after expiredBefore
+	// or is in progress since abandonedBefore or later; then it returns
+	// that record and false.
+	ClaimIdempotencyKey(ctx context.Context, req IdempotentRequest, expiredBefore, abandonedBefore time.Time) (IdempotentRequest, bool, error)
+	// FinishIdempotentRequest stores the fingerprint and response of the
+	// request in progress under req.Key, or fails with ErrNotFound when
+	// there is none.
+	FinishIdempotentRequest(ctx context.Context, req IdempotentRequest) error
+	// ReleaseIdempotencyKey forgets the request in progress under key, so
+	// that a retry runs again.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	// DeleteIdempotencyKeys removes the records from before the cutoff and
+	// reports how many there were.
+	DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
+
+// NoteChange is a note write as sync reports it: the note as it now
+// stands, trashed or not, or with Note nil, the purge of note ID.
+type NoteChange struct {
+	// Seq is the ChangeSeq value that counted the write, 0 while it is yet
+	// to be counted.
+	Seq  int64
+	ID   uuid.UUID
+	Note *Note
+}
+
+// ChangeQuery selects the changes NoteChanges fetches: those not counted
+// yet when Pending is set, else those counted at seq At when that is set,
+// else the first Limit counted after seq After.
+type ChangeQuery struct {
+	After   int64
+	At      int64
+	Pending bool
+	Limit   int
+}
+
+type SyncStore interface {
+	// ListNoteChanges returns a page of the note writes counted after seq
+	// since, as PageChanges pages them.
+	ListNoteChanges(ctx context.Context, since int64, limit int) (ChangePage, error)
+}
+
+// SettingsStore keeps the single preferences document as opaque JSON; the
+// API owns its schema.
+type SettingsStore interface {
+	// Settings returns the stored document, "{}" until one has been saved.
+	Settings(ctx context.Context) ([]byte, error)
+	SaveSettings(ctx context.Context, data []byte) error
+}
+
+type Store interface {
+	NoteStore
+	NotebookStore
+	SessionStore
+	TwoFactorStore
+	TokenStore
+	ShareStore
+	LinkStore
+	WebhookStore
+	TemplateStore
+	SavedSearchStore
+	RevisionStore
+	AttachmentStore
+	SettingsStore
+	AuditStore
+	AccessStore
+	DailyStore
+	IdempotencyStore
+	SyncStore
+	Close()
+}
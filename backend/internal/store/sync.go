@@ -0,0 +1,81 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+)
+
+// ChangePage is one page of the note writes after a seq. A note written
+// more than once since is listed once, at its last write.
+type ChangePage struct {
+	Changes []NoteChange
+	// Seq is the seq the next page follows or, once More is false, the one
+	// the next sync starts from.
+	Seq  int64
+	More bool
+}
+
+// PageChanges pages the changes fetch finds after since, in the order they
+// were counted. A page ends between seqs, so that one write counted with
+// others is never split from them: it holds limit changes or fewer, or all
+// of the first seq when that alone has more than limit. The last page also
+// holds the changes still to be counted, and its Seq is the counter as
+// read before anything else, so that a write not yet visible to the
+// queries is listed again rather than missed.
+func PageChanges(ctx context.Context, since int64, limit int, seq func(context.Context) (int64, error),
+	fetch func(context.Context, ChangeQuery) ([]NoteChange, error)) (ChangePage, error) {
+	current, err := seq(ctx)
+	if err != nil {
+		return ChangePage{}, err
+	}
+	changes, err := fetch(ctx, ChangeQuery{After: since, Limit: limit + 1})
+	if err != nil {
+		return ChangePage{}, err
+	}
+	if len(changes) > limit {
+		last := changes[limit-1].Seq
+		if changes[limit].Seq != last {
+			return ChangePage{Changes: changes[:limit], Seq: last, More: true}, nil
+		}
+		if cut := slices.IndexFunc(changes, func(c NoteChange) bool { return c.Seq == last }); cut > 0 {
+			return ChangePage{Changes: changes[:cut], Seq: changes[cut-1].Seq, More: true}, nil
+		}
+		all, err := fetch(ctx, ChangeQuery{At: last})
+		if err != nil {
+			return ChangePage{}, err
+		}
+		return ChangePage{Changes: all, Seq: last, More: true}, nil
+	}
+	pending, err := fetch(ctx, ChangeQuery{Pending: true})
+	if err != nil {
+		return ChangePage{}, err
+	}
+	return ChangePage{Changes: append(changes, pending...), Seq: current}, nil
+}
+
+// SortChanges orders changes as they were counted, a purge before a note
+// counted with it, which can only be the note inserted again, then by ID,
+// and cuts them to limit unless that is 0.
+func SortChanges(changes []NoteChange, limit int) []NoteChange {
+	slices.SortFunc(changes, func(a, b NoteChange) int {
+		if c := cmp.Compare(a.Seq, b.Seq); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(boolOrder(a.Note != nil), boolOrder(b.Note != nil)); c != 0 {
+			return c
+		}
+		return slices.Compare(a.ID[:], b.ID[:])
+	})
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes
+}
+
+func boolOrder(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
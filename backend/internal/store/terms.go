@@ -0,0 +1,45 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Term is a word or phrase of a text search.
+type Term struct {
+	Text string
+	// Exclude is set for a -term, which matching notes do not contain.
+	Exclude bool
+}
+
+// ParseTerms splits query in web search syntax, as Postgres reads it, for
+// stores that match terms as substrings: words and "quoted phrases", each
+// to be found, those after a - not to be. An unclosed quote runs to the
+// end, and OR, which these stores do not support, is left out.
+func ParseTerms(query string) []Term {
+	var terms []Term
+	for rest := strings.TrimSpace(query); rest != ""; rest = strings.TrimSpace(rest) {
+		var term Term
+		if strings.HasPrefix(rest, "-") {
+			term.Exclude = true
+			rest = rest[1:]
+		}
+		if strings.HasPrefix(rest, `"`) {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			term.Text, rest = strings.TrimSpace(phrase), after
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(rest)
+			}
+			term.Text, rest = rest[:end], rest[end:]
+			if !term.Exclude && strings.EqualFold(term.Text, "or") {
+				continue
+			}
+		}
+		if term.Text != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type timeoutsKey struct{}
+
+// WatchTimeouts returns a context under which stores report statements the
+// database cancelled for running too long, and a func telling whether any
+// was. Handlers answer their errors alike, so this is how the server can
+// tell such a failure from others.
+func WatchTimeouts(ctx context.Context) (context.Context, func() bool) {
+	timedOut := new(atomic.Bool)
+	return context.WithValue(ctx, timeoutsKey{}, timedOut), timedOut.Load
+}
+
+// ReportTimeout records a statement timeout for WatchTimeouts.
+func ReportTimeout(ctx context.Context) {
+	if timedOut, ok := ctx.Value(timeoutsKey{}).(*atomic.Bool); ok {
+		timedOut.Store(true)
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import "strings"
+
+// Searches forgive one typo: a letter added, removed or replaced. They need
+// MinTypoLength letters for that, as shorter ones would match nearly
+// anything, and stop at MaxTypoLength, past which the variants of a search
+// cost more to try than they are worth.
+const (
+	MinTypoLength = 4
+	MaxTypoLength = 32
+)
+
+// ForgivesTypo reports whether a search for query forgives a typo in it.
+func ForgivesTypo(query string) bool {
+	n := len([]rune(query))
+	return n >= MinTypoLength && n <= MaxTypoLength
+}
+
+// WithinOneEdit reports whether a and b are the same or differ by one
+// letter added, removed or replaced.
+func WithinOneEdit(a, b string) bool {
+	x, y := []rune(a), []rune(b)
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	if len(y)-len(x) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(x) && x[i] == y[i] {
+		i++
+	}
+	if len(x) == len(y) {
+		i++
+	}
+	// Past the first difference, the rest must line up again.
+	return i >= len(x) || string(x[i:]) == string(y[len(y)-len(x)+i:])
+}
+
+// ContainsTypo reports whether text contains query, or query with one
+// typo when it forgives one. Both are compared as given, so they should be
+// folded first.
+func ContainsTypo(text, query string) bool {
+	if !ForgivesTypo(query) {
+		return strings.Contains(text, query)
+	}
+	// edits[i] is the fewest edits that turn query[:i] into text ending at
+	// the current letter, which may start anywhere.
+	q := []rune(query)
+	edits, next := make([]int, len(q)+1), make([]int, len(q)+1)
+	for i := range edits {
+		edits[i] = i
+	}
+	for _, r := range text {
+		next[0] = 0
+		for i := 1; i <= len(q); i++ {
+			cost := edits[i-1]
+			if q[i-1] != r {
+				cost++
+			}
+			next[i] = min(cost, edits[i]+1, next[i-1]+1)
+		}
+		if next[len(q)] <= 1 {
+			return true
+		}
+		edits, next = next, edits
+	}
+	return false
+}
+
+// TypoPatterns returns the LIKE patterns, to be ORed, that match text
+// containing query with one typo, when it forgives one; they leave query
+// itself to the caller's pattern. Like that pattern they leave % and _ in
+// query to act as wildcards.
+func TypoPatterns(query string) []string {
+	if !ForgivesTypo(query) {
+		return nil
+	}
+	q := []rune(query)
+	patterns := make([]string, 0, 3*len(q))
+	for i := range q {
+		// Replaced and removed letters, and letters added within query;
+		// those added at either end are already in the plain match.
+		patterns = append(patterns,
+			"%"+string(q[:i])+"_"+string(q[i+1:])+"%",
+			"%"+string(q[:i])+string(q[i+1:])+"%")
+		if i > 0 {
+			patterns = append(patterns, "%"+string(q[:i])+"_"+string(q[i:])+"%")
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,124 @@
+// Package telegram holds the parts of the Telegram Bot API the capture bot
+// uses: the updates its webhook receives, the replies it sends back in the
+// webhook response, and registering the webhook.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SecretHeader carries the secret_token the webhook was registered with on
+// every update Telegram posts.
+const SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// APIURL is where the Bot API is, without the bot token.
+var APIURL = "https://api.telegram.org"
+
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// Reply is a sendMessage call made by answering the update's request with
+// it, which spares a request to the API of its own.
+type Reply struct {
+	Method          string           `json:"method"`
+	ChatID          int64            `json:"chat_id"`
+	Text            string           `json:"text"`
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	// LinkPreviewOptions keeps the links to notes from unfurling.
+	LinkPreviewOptions *LinkPreviewOptions `json:"link_preview_options,omitempty"`
+}
+
+type ReplyParameters struct {
+	MessageID int64 `json:"message_id"`
+}
+
+type LinkPreviewOptions struct {
+	IsDisabled bool `json:"is_disabled"`
+}
+
+// ReplyTo answers m in its chat with text, quoting it.
+func ReplyTo(m *Message, text string) Reply {
+	return Reply{
+		Method:             "sendMessage",
+		ChatID:             m.Chat.ID,
+		Text:               text,
+		ReplyParameters:    &ReplyParameters{MessageID: m.MessageID},
+		LinkPreviewOptions: &LinkPreviewOptions{IsDisabled: true},
+	}
+}
+
+// WebhookSecret is the secret_token the webhook is registered with,
+// derived from the bot token so that it needs no configuration of its own.
+// It only uses the characters Telegram allows.
+func WebhookSecret(botToken string) string {
+	mac := hmac.New(sha256.New, []byte(botToken))
+	mac.Write([]byte("webhook"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SetWebhook points the bot's webhook at webhookURL, with WebhookSecret
+// as its secret_token, for messages only.
+func SetWebhook(ctx context.Context, client *http.Client, botToken, webhookURL string) error {
+	body, err := json.Marshal(map[string]any{
+		"url":             webhookURL,
+		"secret_token":    WebhookSecret(botToken),
+		"allowed_updates": []string{"message"},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, APIURL+"/bot"+botToken+"/setWebhook", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL holds the token; keep it out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("set webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("set webhook: %s", resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("set webhook: %s", result.Description)
+	}
+	return nil
+}
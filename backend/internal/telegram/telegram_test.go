@@ -0,0 +1,48 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetWebhook(t *testing.T) {
+	var got map[string]any
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:abc/setWebhook" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["url"] == "https://bad.example" {
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: bad webhook"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+	defer func(old string) { APIURL = old }(APIURL)
+	APIURL = api.URL
+
+	if err := SetWebhook(context.Background(), api.Client(), "123:abc", "https://notes.example/ingest/telegram"); err != nil {
+		t.Fatal(err)
+	}
+	if got["url"] != "https://notes.example/ingest/telegram" || got["secret_token"] != WebhookSecret("123:abc") {
+		t.Errorf("request = %v", got)
+	}
+	if err := SetWebhook(context.Background(), api.Client(), "123:abc", "https://bad.example"); err == nil || !strings.Contains(err.Error(), "bad webhook") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	secret := WebhookSecret("123:abc")
+	if secret == WebhookSecret("123:abd") {
+		t.Error("different tokens give the same secret")
+	}
+	if strings.Trim(secret, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-") != "" {
+		t.Errorf("secret %q has characters Telegram refuses", secret)
+	}
+}
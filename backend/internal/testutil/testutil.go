@@ -0,0 +1,210 @@
+// Package testutil starts real backends for handler tests. Each harness gets
+// its own database inside a Postgres container that is shared by every test
+// in the package, with migrations applied and a live HTTP listener in front
+// of the server.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"notes-backend/internal/app"
+	"notes-backend/internal/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+const (
+	Password     = "testutil-password"
+	postgresImg  = "postgres:16-alpine"
+	startTimeout = 2 * time.Minute
+)
+
+var (
+	containerOnce sync.Once
+	containerURL  string
+	containerErr  error
+	databaseSeq   atomic.Int64
+)
+
+// Harness is a running server backed by a fresh Postgres database.
+type Harness struct {
+	Server *app.Server
+	Config config.Config
+	URL    string
+}
+
+// NewPostgres returns a harness for t, skipping the test when no container
+// runtime is available. Everything is torn down when the test ends.
+func NewPostgres(t *testing.T) *Harness {
+	t.Helper()
+	cfg := config.Config{
+		DatabaseDriver:    "postgres",
+		DatabaseURL:       PostgresURL(t),
+		AppPassword:       Password,
+		SessionCookieName: "notes_session",
+		SessionTTL:        time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	server, err := app.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		listener.Close()
+		server.Close()
+	})
+	return &Harness{Server: server, Config: cfg, URL: listener.URL}
+}
+
+// PostgresURL creates an empty database for t in the shared container and
+// returns its connection string. The database is dropped on cleanup.
+func PostgresURL(t *testing.T) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	containerOnce.Do(func() {
+		containerURL, containerErr = startPostgres()
+	})
+	if containerErr != nil {
+		t.Fatalf("start postgres container: %v", containerErr)
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, containerURL)
+	if err != nil {
+		t.Fatalf("connect to postgres container: %v", err)
+	}
+	defer admin.Close(ctx)
+
+	name := fmt.Sprintf("test_%d", databaseSeq.Add(1))
+	if _, err := admin.Exec(ctx, `CREATE DATABASE `+name); err != nil {
+		t.Fatalf("create database %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(ctx, containerURL)
+		if err != nil {
+			return
+		}
+		defer conn.Close(ctx)
+		_, _ = conn.Exec(ctx, `DROP DATABASE IF EXISTS `+name+` WITH (FORCE)`)
+	})
+
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		t.Fatalf("parse container url: %v", err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+// startPostgres runs the container once per test binary. It is not
+// terminated explicitly; the testcontainers reaper removes it when the
+// process exits.
+func startPostgres() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	ctr, err := tcpostgres.Run(ctx, postgresImg,
+		tcpostgres.WithDatabase("notes"),
+		tcpostgres.WithUsername("notes"),
+		tcpostgres.WithPassword("notes"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		return "", err
+	}
+	return ctr.ConnectionString(ctx, "sslmode=disable")
+}
+
+// Client sends requests to a harness and keeps its session cookie.
+type Client struct {
+	t       *testing.T
+	baseURL string
+	http    *http.Client
+}
+
+// Client returns a client without a session.
+func (h *Harness) Client(t *testing.T) *Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookie jar: %v", err)
+	}
+	return &Client{t: t, baseURL: h.URL, http: &http.Client{Jar: jar, Timeout: 30 * time.Second}}
+}
+
+// Login returns a client that is signed in with the harness password.
+func (h *Harness) Login(t *testing.T) *Client {
+	t.Helper()
+	c := h.Client(t)
+	resp := c.Do(http.MethodPost, "/auth/login", map[string]string{"password": Password})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("login status = %d, body = %s", resp.StatusCode, body)
+	}
+	return c
+}
+
+// Do sends body encoded as JSON (if non-nil) and returns the response; the
+// caller closes its body.
+func (c *Client) Do(method, path string, body any) *http.Response {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatalf("encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, &buf)
+	if err != nil {
+		c.t.Fatalf("build request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// Expect sends a request, fails the test unless it answers with status and
+// decodes the JSON body into a T.
+func Expect[T any](c *Client, method, path string, body any, status int) T {
+	c.t.Helper()
+	resp := c.Do(method, path, body)
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("read response: %v", err)
+	}
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s: status = %d, want %d, body = %s", method, path, resp.StatusCode, status, raw)
+	}
+	var v T
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			c.t.Fatalf("decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return v
+}
@@ -0,0 +1,269 @@
+// Package tracing records spans of requests and the database queries they
+// make, and exports them to an OpenTelemetry collector, such as Jaeger or
+// Tempo, over OTLP/HTTP in its JSON encoding. Trace context comes in W3C
+// traceparent headers. Finished spans are sent in batches; when the
+// collector falls behind, the ones that do not fit the queue are dropped
+// rather than slowing requests down.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+// The kinds are numbered as in OTLP.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+const (
+	queueSize  = 2048
+	batchSize  = 512
+	flushEvery = 5 * time.Second
+)
+
+type Options struct {
+	// Endpoint is the URL spans are posted to, such as
+	// http://collector:4318/v1/traces.
+	Endpoint string
+	// Headers are sent with every export, for a collector's API key.
+	Headers        map[string]string
+	ServiceName    string
+	ServiceVersion string
+	// SampleRatio is the share of traces started here that are recorded;
+	// traces continued from a traceparent follow its sampled flag.
+	SampleRatio float64
+	Client      *http.Client
+}
+
+// Tracer starts spans and exports them. A nil Tracer starts none, so
+// callers need not check whether tracing is on.
+type Tracer struct {
+	opts   Options
+	client *http.Client
+	queue  chan *Span
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	droppedAt time.Time
+}
+
+func New(opts Options) *Tracer {
+	t := &Tracer{
+		opts:   opts,
+		client: opts.Client,
+		queue:  make(chan *Span, queueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if t.client == nil {
+		t.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	go t.export()
+	return t
+}
+
+// SpanContext identifies a span across processes.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent formats c as a W3C traceparent header value.
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(c.TraceID[:]) + "-" + hex.EncodeToString(c.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent reads a W3C traceparent header value. Versions after 00
+// are read as 00, as the specification asks.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	value = strings.TrimSpace(value)
+	if strings.ToLower(value) != value {
+		return SpanContext{}, false
+	}
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var c SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	c.Sampled = flags[0]&1 != 0
+	return c, c.IsValid()
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// Extract returns ctx carrying the trace context of the traceparent header
+// in h, if it has a valid one, for the next span to continue.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if c, ok := ParseTraceparent(h.Get("Traceparent")); ok {
+		return context.WithValue(ctx, remoteKey, c)
+	}
+	return ctx
+}
+
+// SpanFromContext returns the span ctx carries, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Span is one timed operation. Its methods may be called on a nil Span,
+// and do nothing on spans that are not sampled.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	kind   SpanKind
+	start  time.Time
+
+	mu     sync.Mutex
+	name   string
+	end    time.Time
+	attrs  []attribute
+	failed string
+	ended  bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+// Start begins a span named name, the child of the span in ctx or of the
+// remote one Extract put there, and returns ctx carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	parent, ok := ctx.Value(remoteKey).(SpanContext)
+	if p := SpanFromContext(ctx); p != nil {
+		parent, ok = p.sc, true
+	}
+	if ok {
+		span.sc.TraceID, span.sc.Sampled, span.parent = parent.TraceID, parent.Sampled, parent.SpanID
+	} else {
+		putUint64(span.sc.TraceID[:8], rand.Uint64())
+		putUint64(span.sc.TraceID[8:], rand.Uint64())
+		span.sc.Sampled = rand.Float64() < t.opts.SampleRatio
+	}
+	for span.sc.SpanID == [8]byte{} {
+		putUint64(span.sc.SpanID[:], rand.Uint64())
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range 8 {
+		b[i] = byte(v >> (56 - 8*i))
+	}
+}
+
+// SpanContext returns what identifies s to other processes.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) recording() bool {
+	return s != nil && s.sc.Sampled
+}
+
+// SetName renames s, for servers that learn the route only once it has
+// been matched.
+func (s *Span) SetName(name string) {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttribute records a string, bool, integer or float value under key.
+func (s *Span) SetAttribute(key string, value any) {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// Fail marks s as failed with message.
+func (s *Span) Fail(message string) {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = message
+}
+
+// End finishes s and queues it for export; later calls do nothing.
+func (s *Span) End() {
+	if !s.recording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+	select {
+	case s.tracer.queue <- s:
+	default:
+		s.tracer.dropped()
+	}
+}
+
+// dropped logs that the queue overflowed, at most once a minute.
+func (t *Tracer) dropped() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.droppedAt) >= time.Minute {
+		t.droppedAt = time.Now()
+		log.Printf("tracing: export queue full, dropping spans")
+	}
+}
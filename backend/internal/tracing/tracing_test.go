@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for value, ok := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":       true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":       false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01":        false,
+		"": false,
+	} {
+		c, got := ParseTraceparent(value)
+		if got != ok {
+			t.Errorf("ParseTraceparent(%q) ok = %v, want %v", value, got, ok)
+			continue
+		}
+		if ok && value[:2] == "00" && len(value) == 55 && c.Traceparent() != value {
+			t.Errorf("Traceparent() = %s, want %s", c.Traceparent(), value)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	requests := make(chan exportRequest, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("missing collector header")
+		}
+		var req exportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		requests <- req
+	}))
+	defer collector.Close()
+
+	tracer := New(Options{
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"Authorization": "Bearer k"},
+		ServiceName: "notes-test",
+		SampleRatio: 0,
+	})
+	h := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx, server := tracer.Start(Extract(context.Background(), h), "GET", KindServer)
+	server.SetName("GET /notes")
+	server.SetAttribute("http.response.status_code", 200)
+	_, query := tracer.Start(ctx, "SELECT", KindClient)
+	query.Fail("boom")
+	query.End()
+	server.End()
+	server.End()
+
+	// Traces started here are not sampled at a ratio of 0.
+	_, unsampled := tracer.Start(context.Background(), "GET", KindServer)
+	unsampled.End()
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(shutdown); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	var spans []spanData
+	close(requests)
+	for req := range requests {
+		if got := req.ResourceSpans[0].Resource.Attributes[0]; got.Key != "service.name" || *got.Value.StringValue != "notes-test" {
+			t.Errorf("resource attribute = %+v", got)
+		}
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	q, s := spans[0], spans[1]
+	if s.Name != "GET /notes" || s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != KindServer {
+		t.Errorf("server span = %+v", s)
+	}
+	if len(s.Attributes) != 1 || *s.Attributes[0].Value.IntValue != "200" {
+		t.Errorf("server attributes = %+v", s.Attributes)
+	}
+	if q.TraceID != s.TraceID || q.ParentSpanID != s.SpanID || q.Status == nil || q.Status.Code != statusError {
+		t.Errorf("query span = %+v", q)
+	}
+
+	var nilTracer *Tracer
+	if _, span := nilTracer.Start(context.Background(), "GET", KindServer); span != nil {
+		t.Errorf("nil tracer started a span")
+	}
+}
@@ -0,0 +1,77 @@
+// Package validate checks notes against the size limits they are stored
+// under, reporting every field over its limit at once.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Limits caps the fields of a note; a zero limit leaves its field alone.
+type Limits struct {
+	TitleChars   int
+	Tags         int
+	ContentBytes int
+}
+
+// DefaultLimits are the limits unless configured otherwise.
+var DefaultLimits = Limits{TitleChars: 500, Tags: 50, ContentBytes: 1 << 20}
+
+// FieldError is a problem with one field of a request: a body field, a
+// query parameter or a path parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// Note checks a note's fields as they are about to be stored, after
+// trimming and tag cleanup, and joins a FieldError for each one over its
+// limit; nil means the note fits.
+func (l Limits) Note(title, content string, tags []string) error {
+	var errs []error
+	if l.TitleChars > 0 && utf8.RuneCountInString(title) > l.TitleChars {
+		errs = append(errs, &FieldError{Field: "title", Message: fmt.Sprintf("title is longer than %d characters", l.TitleChars)})
+	}
+	if l.ContentBytes > 0 && len(content) > l.ContentBytes {
+		errs = append(errs, &FieldError{Field: "content", Message: fmt.Sprintf("content is larger than %s", size(l.ContentBytes))})
+	}
+	if l.Tags > 0 && len(tags) > l.Tags {
+		errs = append(errs, &FieldError{Field: "tags", Message: fmt.Sprintf("at most %d tags", l.Tags)})
+	}
+	return errors.Join(errs...)
+}
+
+// Prefix puts prefix and a dot before the field of every FieldError err
+// holds, for notes checked as part of a larger request, and before their
+// messages too.
+func Prefix(err error, prefix string) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		prefixed := make([]error, len(errs))
+		for i, err := range errs {
+			prefixed[i] = Prefix(err, prefix)
+		}
+		return errors.Join(prefixed...)
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		return &FieldError{Field: prefix + "." + fe.Field, Message: prefix + ": " + fe.Message}
+	}
+	return err
+}
+
+func size(bytes int) string {
+	switch {
+	case bytes >= 1<<20 && bytes%(1<<20) == 0:
+		return fmt.Sprintf("%d MiB", bytes>>20)
+	case bytes >= 1<<10 && bytes%(1<<10) == 0:
+		return fmt.Sprintf("%d KiB", bytes>>10)
+	default:
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+}
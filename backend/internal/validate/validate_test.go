@@ -0,0 +1,36 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNote(t *testing.T) {
+	limits := Limits{TitleChars: 5, Tags: 2, ContentBytes: 2 << 10}
+	if err := limits.Note("héllo", strings.Repeat("x", 2<<10), []string{"a", "b"}); err != nil {
+		t.Fatalf("a note at the limits: %v", err)
+	}
+	if err := (Limits{}).Note(strings.Repeat("x", 1000), strings.Repeat("x", 1<<21), make([]string, 100)); err != nil {
+		t.Fatalf("zero limits: %v", err)
+	}
+
+	err := limits.Note("héllo!", strings.Repeat("x", 2<<10+1), []string{"a", "b", "c"})
+	var fields []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("%v is not a FieldError", err)
+		}
+		fields = append(fields, fe.Field+": "+fe.Message)
+	}
+	want := "title: title is longer than 5 characters\ncontent: content is larger than 2 KiB\ntags: at most 2 tags"
+	if got := strings.Join(fields, "\n"); got != want {
+		t.Errorf("errors =\n%s\nwant\n%s", got, want)
+	}
+
+	var fe *FieldError
+	if !errors.As(Prefix(limits.Note("too long", "", nil), "notes[3]"), &fe) || fe.Field != "notes[3].title" || fe.Message != "notes[3]: title is longer than 5 characters" {
+		t.Errorf("prefixed = %+v", fe)
+	}
+}
@@ -0,0 +1,224 @@
+// Package webhook posts note events to the URLs registered for them. A
+// Dispatcher follows the event bus, so it delivers the writes this process
+// made; deliveries are retried with exponential backoff but live only in
+// memory, and those pending when the process stops are lost.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"notes-backend/internal/clock"
+	"notes-backend/internal/events"
+	"notes-backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Events are the event types a webhook can subscribe to: those about a
+// single note.
+var Events = []string{
+	events.NoteCreated,
+	events.NoteUpdated,
+	events.NoteDeleted,
+	events.NoteRestored,
+	events.NotePurged,
+	events.NoteFavorited,
+	events.NotePinned,
+	events.NoteArchived,
+}
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body
+	// under the webhook's secret.
+	SignatureHeader = "X-Notes-Signature-256"
+	EventHeader     = "X-Notes-Event"
+	DeliveryHeader  = "X-Notes-Delivery"
+
+	maxAttempts    = 6
+	initialBackoff = time.Second
+	// maxInFlight bounds the deliveries being attempted or waiting to be
+	// retried; events past it are dropped.
+	maxInFlight = 256
+)
+
+// Payload is the JSON body of a delivery. Note is the note as written,
+// absent for deletes and purges.
+type Payload struct {
+	ID         uuid.UUID   `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	NoteID     uuid.UUID   `json:"note_id"`
+	Note       *store.Note `json:"note,omitempty"`
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type Dispatcher struct {
+	store  store.WebhookStore
+	bus    *events.Bus
+	sub    *events.Subscription
+	client *http.Client
+	clock  clock.Clock
+	// backoff is the wait before the first retry; it doubles for each
+	// retry after.
+	backoff time.Duration
+
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher subscribes to bus right away, so that Run delivers every
+// event published after it returns.
+func NewDispatcher(st store.WebhookStore, bus *events.Bus, clk clock.Clock) *Dispatcher {
+	return &Dispatcher{
+		store: st,
+		bus:   bus,
+		sub:   bus.Subscribe(),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		clock:    clk,
+		backoff:  initialBackoff,
+		inFlight: make(chan struct{}, maxInFlight),
+	}
+}
+
+// Run delivers the events published on the bus until ctx is done, and
+// then waits for the attempts under way to give up. When it falls behind
+// and the bus drops it, it resubscribes and catches up on the events the
+// bus still remembers.
+func (d *Dispatcher) Run(ctx context.Context) {
+	defer d.wg.Wait()
+	var lastID string
+	for {
+		select {
+		case <-ctx.Done():
+			d.sub.Close()
+			return
+		case e, ok := <-d.sub.C:
+			if ok {
+				lastID = d.bus.EventID(e)
+				d.dispatch(ctx, e)
+				continue
+			}
+			// Events older than the bus's history are lost: SubscribeSince
+			// returns a NotesChanged for them, which is not delivered.
+			log.Printf("webhooks: fell behind the event bus; resubscribing")
+			var missed []events.Event
+			d.sub, missed = d.bus.SubscribeSince(lastID)
+			for _, e := range missed {
+				lastID = d.bus.EventID(e)
+				d.dispatch(ctx, e)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, e events.Event) {
+	if e.ID == nil || !slices.Contains(Events, e.Type) {
+		return
+	}
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("webhooks: list: %v", err)
+		}
+		return
+	}
+	for _, hook := range hooks {
+		if !slices.Contains(hook.Events, e.Type) {
+			continue
+		}
+		payload := Payload{ID: uuid.New(), Type: e.Type, OccurredAt: d.clock.Now(), NoteID: *e.ID, Note: e.Note}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("webhooks: encode %s: %v", e.Type, err)
+			return
+		}
+		select {
+		case d.inFlight <- struct{}{}:
+		default:
+			log.Printf("webhooks: too many pending deliveries; dropped %s for %s", e.Type, hook.ID)
+			continue
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer func() { <-d.inFlight }()
+			d.deliver(ctx, hook, payload, body)
+		}()
+	}
+}
+
+// deliver posts body until the receiver answers 2xx, refuses it with a
+// client error other than 408 or 429, or the attempts run out.
+func (d *Dispatcher) deliver(ctx context.Context, hook store.Webhook, payload Payload, body []byte) {
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, hook, payload, body)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		var refused *refusedError
+		if errors.As(err, &refused) || attempt == maxAttempts {
+			log.Printf("webhooks: giving up on %s to %s after %d attempt(s): %v", payload.Type, hook.ID, attempt, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// refusedError is a failure retrying cannot fix.
+type refusedError struct{ err error }
+
+func (e *refusedError) Error() string { return e.err.Error() }
+
+func (d *Dispatcher) post(ctx context.Context, hook store.Webhook, payload Payload, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return &refusedError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notes-webhooks")
+	req.Header.Set(EventHeader, payload.Type)
+	req.Header.Set(DeliveryHeader, payload.ID.String())
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return &refusedError{fmt.Errorf("refused with status %d", resp.StatusCode)}
+	}
+	return fmt.Errorf("status %d", resp.StatusCode)
+}
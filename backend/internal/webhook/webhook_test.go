@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"notes-backend/internal/clock"
+	"notes-backend/internal/events"
+	"notes-backend/internal/store"
+	"notes-backend/internal/store/memory"
+
+	"github.com/google/uuid"
+)
+
+func TestSign(t *testing.T) {
+	// From the HMAC-SHA256 test vectors of RFC 4231, case 2.
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	if want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+		bodies   = make(chan Payload, 10)
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("s3cret", body) {
+			t.Errorf("%s: bad signature %q", r.URL.Path, r.Header.Get(SignatureHeader))
+		}
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/flaky" && n < 3:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case r.URL.Path == "/gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		bodies <- p
+	}))
+	defer receiver.Close()
+
+	st := memory.New()
+	ctx := context.Background()
+	for _, hook := range []struct {
+		path   string
+		events []string
+	}{
+		{"/flaky", []string{events.NoteCreated}},
+		{"/gone", []string{events.NoteCreated}},
+		{"/other", []string{events.NoteDeleted}},
+	} {
+		err := st.CreateWebhook(ctx, store.Webhook{ID: uuid.New(), URL: receiver.URL + hook.path, Events: hook.events, Secret: "s3cret", CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bus := events.NewBus()
+	d := NewDispatcher(st, bus, clock.System)
+	d.backoff = time.Millisecond
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		d.Run(runCtx)
+		close(done)
+	}()
+
+	n := store.Note{ID: uuid.New(), Title: "hello"}
+	bus.Publish(events.Event{Type: events.NoteCreated, ID: &n.ID, Note: &n})
+	bus.Publish(events.Event{Type: events.NotesChanged})
+
+	select {
+	case p := <-bodies:
+		if p.Type != events.NoteCreated || p.NoteID != n.ID || p.Note == nil || p.Note.Title != "hello" {
+			t.Errorf("payload = %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	stop()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["/flaky"] != 3 || attempts["/gone"] != 1 || attempts["/other"] != 0 {
+		t.Errorf("attempts = %v", attempts)
+	}
+}
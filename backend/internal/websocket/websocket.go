@@ -0,0 +1,250 @@
+// Package websocket is the server side of RFC 6455, as much of it as pushing
+// messages to browsers needs: the handshake, unfragmented text messages
+// out, and pings, pongs and closes both ways. Messages from the client are
+// read and discarded.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	ClosePolicy        = 1008
+	CloseTooLarge      = 1009
+	CloseTryAgainLater = 1013
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+const (
+	// acceptGUID is appended to the client's key to prove the server
+	// understood the handshake.
+	acceptGUID   = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	writeTimeout = 10 * time.Second
+	// readTimeout is how long a client may stay silent, pongs included,
+	// before Read gives up on it; pinging more often keeps it alive.
+	readTimeout = time.Minute
+	// maxMessage bounds what a client may send; nothing it sends is used.
+	maxMessage = 4 << 10
+)
+
+// ErrHandshake marks a request that is not a valid WebSocket upgrade; no
+// response has been written for it yet.
+var ErrHandshake = errors.New("not a websocket handshake")
+
+// ErrClosed is returned by Conn.Read once the client closed the connection.
+var ErrClosed = errors.New("websocket closed")
+
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Accept completes the handshake and takes the connection over from the
+// HTTP server. On ErrHandshake the caller still owns w and should answer
+// 400; any other error means the connection is already gone.
+func Accept(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, fmt.Errorf("%w: method %s", ErrHandshake, r.Method)
+	case !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket"):
+		return nil, fmt.Errorf("%w: missing upgrade headers", ErrHandshake)
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrHandshake, r.Header.Get("Sec-WebSocket-Version"))
+	case key == "":
+		return nil, fmt.Errorf("%w: missing Sec-WebSocket-Key", ErrHandshake)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijack: %w", err)
+	}
+	// The HTTP server's timeouts were meant for one request.
+	conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+	return &Conn{conn: conn, r: rw.Reader}, nil
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends data as one text message.
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(opText, data)
+}
+
+func (c *Conn) Ping() error {
+	return c.write(opPing, nil)
+}
+
+// Close sends a close frame with code and reason and closes the connection.
+// Closing again does nothing.
+func (c *Conn) Close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	err := c.writeFrame(opClose, payload)
+	c.closed = true
+	if closeErr := c.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *Conn) write(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeFrame(op, payload)
+}
+
+// writeFrame sends one unmasked final frame; c.mu must be held.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Read reads from the client until it closes the connection or goes quiet
+// for readTimeout, answering pings along the way and discarding messages.
+// It returns ErrClosed after a close from the client, or the error that
+// ended the connection. Only one goroutine may call it.
+func (c *Conn) Read() error {
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opPing:
+			if err := c.write(opPong, payload); err != nil {
+				return err
+			}
+		case opClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code, "")
+			return ErrClosed
+		}
+	}
+}
+
+func (c *Conn) readFrame() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+	if !masked {
+		c.Close(CloseProtocolError, "client frames must be masked")
+		return 0, nil, errors.New("websocket: unmasked client frame")
+	}
+	switch op {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		c.Close(CloseProtocolError, "unknown opcode")
+		return 0, nil, fmt.Errorf("websocket: unknown opcode %#x", op)
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessage || (op >= opClose && length > 125) {
+		c.Close(CloseTooLarge, "message too large")
+		return 0, nil, fmt.Errorf("websocket: %d byte frame", length)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
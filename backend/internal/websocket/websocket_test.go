@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+	return &Conn{conn: server, r: bufio.NewReader(server)}, client
+}
+
+func masked(op byte, payload []byte) []byte {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | op, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func readFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	payload := make([]byte, head[1]&0x7F)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestReadAnswersPingsAndCloses(t *testing.T) {
+	conn, client := pipe(t)
+	done := make(chan error, 1)
+	go func() { done <- conn.Read() }()
+
+	go client.Write(masked(opText, []byte("ignored")))
+	go client.Write(masked(opPing, []byte("hi")))
+	if op, payload := readFrame(t, client); op != opPong || string(payload) != "hi" {
+		t.Fatalf("reply to ping = %#x %q", op, payload)
+	}
+
+	go client.Write(masked(opClose, []byte{0x03, 0xE8}))
+	if op, payload := readFrame(t, client); op != opClose || string(payload) != "\x03\xE8" {
+		t.Fatalf("reply to close = %#x %q", op, payload)
+	}
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Fatalf("Read = %v, want ErrClosed", err)
+	}
+	if err := conn.WriteText([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("WriteText after close = %v", err)
+	}
+}
+
+func TestReadRejectsUnmaskedFrames(t *testing.T) {
+	conn, client := pipe(t)
+	done := make(chan error, 1)
+	go func() { done <- conn.Read() }()
+
+	go client.Write([]byte{0x81, 0x02, 'h', 'i'})
+	if op, payload := readFrame(t, client); op != opClose || payload[1] != CloseProtocolError&0xFF {
+		t.Fatalf("reply = %#x %q, want close 1002", op, payload)
+	}
+	if err := <-done; err == nil || errors.Is(err, ErrClosed) {
+		t.Fatalf("Read = %v, want a protocol error", err)
+	}
+}
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS notes (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid NULL,
+  title text NOT NULL,
+  content text NOT NULL,
+  tags text[] NOT NULL DEFAULT '{}',
+  is_favorite boolean NOT NULL DEFAULT false,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  token text UNIQUE NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at_desc ON notes (updated_at DESC);
+CREATE INVERTED INDEX IF NOT EXISTS idx_notes_tags_gin ON notes (tags);
+CREATE INVERTED INDEX IF NOT EXISTS idx_notes_title_trgm ON notes (title gin_trgm_ops);
+CREATE INVERTED INDEX IF NOT EXISTS idx_notes_content_trgm ON notes (content gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
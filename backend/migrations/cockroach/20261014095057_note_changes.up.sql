@@ -0,0 +1,7 @@
+-- 20261014095057_note_changes (cockroach, up)
+CREATE TABLE IF NOT EXISTS note_changes (
+  id smallint PRIMARY KEY,
+  seq bigint NOT NULL
+);
+
+INSERT INTO note_changes (id, seq) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
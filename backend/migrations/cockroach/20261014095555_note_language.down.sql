@@ -0,0 +1,2 @@
+-- 20261014095555_note_language (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS language;
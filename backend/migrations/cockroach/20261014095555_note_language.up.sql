@@ -0,0 +1,2 @@
+-- 20261014095555_note_language (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS language STRING NOT NULL DEFAULT 'simple';
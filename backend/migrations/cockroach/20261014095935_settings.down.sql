@@ -0,0 +1,2 @@
+-- 20261014095935_settings (cockroach, down)
+DROP TABLE IF EXISTS settings;
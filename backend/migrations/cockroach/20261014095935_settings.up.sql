@@ -0,0 +1,7 @@
+-- 20261014095935_settings (cockroach, up)
+CREATE TABLE IF NOT EXISTS settings (
+  id smallint PRIMARY KEY,
+  data jsonb NOT NULL
+);
+
+INSERT INTO settings (id, data) VALUES (1, '{}') ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,2 @@
+-- 20261014100720_note_revisions (cockroach, down)
+DROP TABLE IF EXISTS note_revisions;
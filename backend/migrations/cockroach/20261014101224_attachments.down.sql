@@ -0,0 +1,2 @@
+-- 20261014101224_attachments (cockroach, down)
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,11 @@
+-- 20261014101224_attachments (cockroach, up)
+CREATE TABLE IF NOT EXISTS attachments (
+  id uuid PRIMARY KEY,
+  note_id uuid NULL REFERENCES notes (id) ON DELETE SET NULL,
+  filename text NOT NULL,
+  content_type text NOT NULL,
+  size bigint NOT NULL,
+  created_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments (note_id);
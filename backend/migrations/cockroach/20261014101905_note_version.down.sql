@@ -0,0 +1,2 @@
+-- 20261014101905_note_version (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS version;
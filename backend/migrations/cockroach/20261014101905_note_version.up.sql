@@ -0,0 +1,2 @@
+-- 20261014101905_note_version (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS version INT8 NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- 20261014103512_note_list_keyset (cockroach, up)
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at_id ON notes (updated_at DESC, id DESC);
+
+DROP INDEX IF EXISTS notes@idx_notes_updated_at_desc;
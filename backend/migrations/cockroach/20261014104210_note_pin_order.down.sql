@@ -0,0 +1,3 @@
+-- 20261014104210_note_pin_order (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS sort_position;
+ALTER TABLE notes DROP COLUMN IF EXISTS is_pinned;
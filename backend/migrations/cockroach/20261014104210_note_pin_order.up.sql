@@ -0,0 +1,3 @@
+-- 20261014104210_note_pin_order (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_pinned boolean NOT NULL DEFAULT false;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS sort_position INT8 NOT NULL DEFAULT 0;
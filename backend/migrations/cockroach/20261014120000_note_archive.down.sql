@@ -0,0 +1,2 @@
+-- 20261014120000_note_archive (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS is_archived;
@@ -0,0 +1,2 @@
+-- 20261014120000_note_archive (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_archived boolean NOT NULL DEFAULT false;
@@ -0,0 +1,9 @@
+-- 20261014121500_api_tokens (cockroach, up)
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  token_hash text UNIQUE NOT NULL,
+  scope text NOT NULL,
+  created_at timestamptz NOT NULL,
+  last_used_at timestamptz NULL
+);
@@ -0,0 +1,2 @@
+-- 20261014123000_note_shares (cockroach, down)
+DROP TABLE IF EXISTS note_shares;
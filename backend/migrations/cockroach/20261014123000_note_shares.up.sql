@@ -0,0 +1,8 @@
+-- 20261014123000_note_shares (cockroach, up)
+CREATE TABLE IF NOT EXISTS note_shares (
+  note_id uuid PRIMARY KEY REFERENCES notes (id) ON DELETE CASCADE,
+  slug text UNIQUE NOT NULL,
+  password_hash text NULL,
+  expires_at timestamptz NULL,
+  created_at timestamptz NOT NULL
+);
@@ -0,0 +1,2 @@
+-- 20261014130000_webhooks (cockroach, down)
+DROP TABLE IF EXISTS webhooks;
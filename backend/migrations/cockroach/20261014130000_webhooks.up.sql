@@ -0,0 +1,8 @@
+-- 20261014130000_webhooks (cockroach, up)
+CREATE TABLE IF NOT EXISTS webhooks (
+  id uuid PRIMARY KEY,
+  url text NOT NULL,
+  events text NOT NULL,
+  secret text NOT NULL,
+  created_at timestamptz NOT NULL
+);
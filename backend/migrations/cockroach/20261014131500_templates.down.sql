@@ -0,0 +1,2 @@
+-- 20261014131500_templates (cockroach, down)
+DROP TABLE IF EXISTS templates;
@@ -0,0 +1,10 @@
+-- 20261014131500_templates (cockroach, up)
+CREATE TABLE IF NOT EXISTS templates (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  title text NOT NULL,
+  content text NOT NULL,
+  tags text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL
+);
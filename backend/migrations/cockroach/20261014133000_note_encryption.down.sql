@@ -0,0 +1,2 @@
+-- 20261014133000_note_encryption (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS is_encrypted;
@@ -0,0 +1,2 @@
+-- 20261014133000_note_encryption (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_encrypted boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- 20261014134500_audit_log (cockroach, down)
+DROP TABLE IF EXISTS audit_log;
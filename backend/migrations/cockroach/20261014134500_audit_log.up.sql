@@ -0,0 +1,14 @@
+-- 20261014134500_audit_log (cockroach, up)
+CREATE TABLE IF NOT EXISTS audit_log (
+  id uuid PRIMARY KEY,
+  at timestamptz NOT NULL,
+  actor text NOT NULL,
+  action text NOT NULL,
+  entity text NOT NULL,
+  entity_id text NOT NULL,
+  summary text NOT NULL,
+  ip text NOT NULL,
+  request_id text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log (at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id, at);
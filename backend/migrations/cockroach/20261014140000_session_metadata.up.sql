@@ -0,0 +1,5 @@
+-- 20261014140000_session_metadata (cockroach, up)
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_seen_at timestamptz;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip text NOT NULL DEFAULT '';
+UPDATE sessions SET last_seen_at = created_at WHERE last_seen_at IS NULL;
@@ -0,0 +1,11 @@
+-- 20261014141500_two_factor (cockroach, up)
+CREATE TABLE IF NOT EXISTS two_factor (
+  id smallint PRIMARY KEY,
+  secret text NOT NULL,
+  enabled boolean NOT NULL DEFAULT false,
+  last_step bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  code_hash text PRIMARY KEY
+);
@@ -0,0 +1,11 @@
+-- 20261014143000_saved_searches (cockroach, up)
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  query text NOT NULL DEFAULT '',
+  tag text NOT NULL DEFAULT '',
+  favorite boolean,
+  notebook text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL
+);
@@ -0,0 +1,6 @@
+-- 20261014144500_note_access (cockroach, up)
+CREATE TABLE IF NOT EXISTS note_access (
+  note_id uuid NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  accessed_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_note_access_accessed_at ON note_access (accessed_at, note_id);
@@ -0,0 +1,3 @@
+-- 20261014150000_note_stats (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS char_count;
+ALTER TABLE notes DROP COLUMN IF EXISTS word_count;
@@ -0,0 +1,3 @@
+-- 20261014150000_note_stats (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS word_count integer NOT NULL DEFAULT 0;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS char_count integer NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- 20261014153000_daily_notes (cockroach, up)
+CREATE TABLE IF NOT EXISTS daily_notes (
+  day text PRIMARY KEY,
+  note_id uuid NOT NULL REFERENCES notes (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_daily_notes_note_id ON daily_notes (note_id);
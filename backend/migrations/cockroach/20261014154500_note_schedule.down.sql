@@ -0,0 +1,3 @@
+-- 20261014154500_note_schedule (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS reminder_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS due_at;
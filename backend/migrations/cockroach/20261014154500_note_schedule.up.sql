@@ -0,0 +1,3 @@
+-- 20261014154500_note_schedule (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS due_at timestamptz NULL;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS reminder_at timestamptz NULL;
@@ -0,0 +1,3 @@
+-- 20261014160000_note_appearance (cockroach, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS icon;
+ALTER TABLE notes DROP COLUMN IF EXISTS color;
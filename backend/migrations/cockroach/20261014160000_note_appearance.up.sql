@@ -0,0 +1,3 @@
+-- 20261014160000_note_appearance (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS color text NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS icon text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- 20261014161500_note_location (cockroach, down)
+DROP INDEX IF EXISTS notes@idx_notes_latitude;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS longitude;
+ALTER TABLE notes DROP COLUMN IF EXISTS latitude;
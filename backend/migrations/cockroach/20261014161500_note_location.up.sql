@@ -0,0 +1,5 @@
+-- 20261014161500_note_location (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS latitude double precision NULL;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS longitude double precision NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_latitude ON notes (latitude) WHERE latitude IS NOT NULL;
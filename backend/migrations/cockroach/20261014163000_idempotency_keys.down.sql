@@ -0,0 +1,2 @@
+-- 20261014163000_idempotency_keys (cockroach, down)
+DROP TABLE IF EXISTS idempotency_keys;
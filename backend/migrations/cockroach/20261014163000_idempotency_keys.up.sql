@@ -0,0 +1,10 @@
+-- 20261014163000_idempotency_keys (cockroach, up)
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  idempotency_key text PRIMARY KEY,
+  fingerprint text NOT NULL,
+  status integer NOT NULL DEFAULT 0,
+  headers text NOT NULL DEFAULT '{}',
+  body text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
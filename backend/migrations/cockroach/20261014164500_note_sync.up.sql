@@ -0,0 +1,13 @@
+-- 20261014164500_note_sync (cockroach, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS change_seq bigint NULL;
+
+UPDATE note_changes SET seq = seq + 1 WHERE id = 1;
+UPDATE notes SET change_seq = (SELECT seq FROM note_changes WHERE id = 1);
+
+CREATE INDEX IF NOT EXISTS idx_notes_change_seq ON notes (change_seq);
+
+CREATE TABLE IF NOT EXISTS note_tombstones (
+  id uuid PRIMARY KEY,
+  change_seq bigint NULL
+);
+CREATE INDEX IF NOT EXISTS idx_note_tombstones_change_seq ON note_tombstones (change_seq);
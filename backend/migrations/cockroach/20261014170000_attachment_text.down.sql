@@ -0,0 +1,4 @@
+-- 20261014170000_attachment_text (cockroach, down)
+DROP INDEX IF EXISTS attachments@idx_attachments_change_seq;
+ALTER TABLE attachments DROP COLUMN IF EXISTS change_seq;
+ALTER TABLE attachments DROP COLUMN IF EXISTS extracted_text;
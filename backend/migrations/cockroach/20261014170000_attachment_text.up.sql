@@ -0,0 +1,5 @@
+-- 20261014170000_attachment_text (cockroach, up)
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS extracted_text text NULL;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS change_seq bigint NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_change_seq ON attachments (change_seq);
@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds the SQL migrations for every supported driver, one directory per
+// DATABASE_DRIVER value.
+//
+//go:embed */*.sql
+var FS embed.FS
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS notes (
+  id CHAR(36) PRIMARY KEY,
+  user_id CHAR(36) NULL,
+  title TEXT NOT NULL,
+  content LONGTEXT NOT NULL,
+  tags JSON NOT NULL,
+  is_favorite BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL,
+  INDEX idx_notes_updated_at_desc (updated_at DESC)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id CHAR(36) PRIMARY KEY,
+  token VARCHAR(64) NOT NULL UNIQUE,
+  created_at DATETIME(6) NOT NULL,
+  expires_at DATETIME(6) NOT NULL,
+  INDEX idx_sessions_expires_at (expires_at)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
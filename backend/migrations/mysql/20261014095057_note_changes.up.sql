@@ -0,0 +1,7 @@
+-- 20261014095057_note_changes (mysql, up)
+CREATE TABLE IF NOT EXISTS note_changes (
+  id SMALLINT PRIMARY KEY,
+  seq BIGINT NOT NULL
+);
+
+INSERT IGNORE INTO note_changes (id, seq) VALUES (1, 0);
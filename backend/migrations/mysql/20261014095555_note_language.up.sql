@@ -0,0 +1,2 @@
+-- 20261014095555_note_language (mysql, up)
+ALTER TABLE notes ADD COLUMN language VARCHAR(32) NOT NULL DEFAULT 'simple';
@@ -0,0 +1,7 @@
+-- 20261014095935_settings (mysql, up)
+CREATE TABLE IF NOT EXISTS settings (
+  id SMALLINT PRIMARY KEY,
+  data JSON NOT NULL
+);
+
+INSERT IGNORE INTO settings (id, data) VALUES (1, '{}');
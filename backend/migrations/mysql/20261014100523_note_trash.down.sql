@@ -0,0 +1,2 @@
+-- 20261014100523_note_trash (mysql, down)
+ALTER TABLE notes DROP INDEX idx_notes_deleted_at, DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+-- 20261014100523_note_trash (mysql, up)
+ALTER TABLE notes ADD COLUMN deleted_at DATETIME(6) NULL, ADD INDEX idx_notes_deleted_at (deleted_at);
@@ -0,0 +1,11 @@
+-- 20261014100720_note_revisions (mysql, up)
+CREATE TABLE IF NOT EXISTS note_revisions (
+  note_id CHAR(36) NOT NULL,
+  rev INT NOT NULL,
+  title TEXT NOT NULL,
+  content LONGTEXT NOT NULL,
+  tags JSON NOT NULL,
+  saved_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (note_id, rev),
+  CONSTRAINT fk_note_revisions_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
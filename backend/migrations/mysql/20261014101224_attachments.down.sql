@@ -0,0 +1,2 @@
+-- 20261014101224_attachments (mysql, down)
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,11 @@
+-- 20261014101224_attachments (mysql, up)
+CREATE TABLE IF NOT EXISTS attachments (
+  id CHAR(36) PRIMARY KEY,
+  note_id CHAR(36) NULL,
+  filename VARCHAR(255) NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  size BIGINT NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  INDEX idx_attachments_note_id (note_id),
+  CONSTRAINT fk_attachments_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE SET NULL
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+-- 20261014101905_note_version (mysql, up)
+ALTER TABLE notes ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
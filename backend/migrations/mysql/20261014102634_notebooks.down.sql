@@ -0,0 +1,7 @@
+-- 20261014102634_notebooks (mysql, down)
+ALTER TABLE notes
+  DROP FOREIGN KEY fk_notes_notebook,
+  DROP INDEX idx_notes_notebook_id,
+  DROP COLUMN notebook_id;
+
+DROP TABLE IF EXISTS notebooks;
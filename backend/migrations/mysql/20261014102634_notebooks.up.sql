@@ -0,0 +1,15 @@
+-- 20261014102634_notebooks (mysql, up)
+CREATE TABLE IF NOT EXISTS notebooks (
+  id CHAR(36) PRIMARY KEY,
+  parent_id CHAR(36) NULL,
+  name VARCHAR(255) NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL,
+  INDEX idx_notebooks_parent_id (parent_id),
+  CONSTRAINT fk_notebooks_parent FOREIGN KEY (parent_id) REFERENCES notebooks (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+ALTER TABLE notes
+  ADD COLUMN notebook_id CHAR(36) NULL,
+  ADD INDEX idx_notes_notebook_id (notebook_id),
+  ADD CONSTRAINT fk_notes_notebook FOREIGN KEY (notebook_id) REFERENCES notebooks (id) ON DELETE SET NULL;
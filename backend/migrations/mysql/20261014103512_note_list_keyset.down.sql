@@ -0,0 +1,2 @@
+-- 20261014103512_note_list_keyset (mysql, down)
+ALTER TABLE notes ADD INDEX idx_notes_updated_at_desc (updated_at DESC), DROP INDEX idx_notes_updated_at_id;
@@ -0,0 +1,2 @@
+-- 20261014103512_note_list_keyset (mysql, up)
+ALTER TABLE notes ADD INDEX idx_notes_updated_at_id (updated_at DESC, id DESC), DROP INDEX idx_notes_updated_at_desc;
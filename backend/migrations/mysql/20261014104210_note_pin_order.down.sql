@@ -0,0 +1,2 @@
+-- 20261014104210_note_pin_order (mysql, down)
+ALTER TABLE notes DROP COLUMN sort_position, DROP COLUMN is_pinned;
@@ -0,0 +1,2 @@
+-- 20261014104210_note_pin_order (mysql, up)
+ALTER TABLE notes ADD COLUMN is_pinned BOOLEAN NOT NULL DEFAULT FALSE, ADD COLUMN sort_position BIGINT NOT NULL DEFAULT 0;
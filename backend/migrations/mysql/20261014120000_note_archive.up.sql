@@ -0,0 +1,2 @@
+-- 20261014120000_note_archive (mysql, up)
+ALTER TABLE notes ADD COLUMN is_archived BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- 20261014121500_api_tokens (mysql, down)
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,10 @@
+-- 20261014121500_api_tokens (mysql, up)
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id CHAR(36) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  scope VARCHAR(16) NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  last_used_at DATETIME(6) NULL,
+  UNIQUE INDEX idx_api_tokens_token_hash (token_hash)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
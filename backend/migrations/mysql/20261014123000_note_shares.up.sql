@@ -0,0 +1,10 @@
+-- 20261014123000_note_shares (mysql, up)
+CREATE TABLE IF NOT EXISTS note_shares (
+  note_id CHAR(36) PRIMARY KEY,
+  slug VARCHAR(64) NOT NULL,
+  password_hash VARCHAR(255) NULL,
+  expires_at DATETIME(6) NULL,
+  created_at DATETIME(6) NOT NULL,
+  UNIQUE INDEX idx_note_shares_slug (slug),
+  CONSTRAINT fk_note_shares_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
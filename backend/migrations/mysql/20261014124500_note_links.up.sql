@@ -0,0 +1,8 @@
+-- 20261014124500_note_links (mysql, up)
+CREATE TABLE IF NOT EXISTS note_links (
+  source_id CHAR(36) NOT NULL,
+  target VARCHAR(500) NOT NULL,
+  PRIMARY KEY (source_id, target),
+  INDEX idx_note_links_target (target),
+  CONSTRAINT fk_note_links_source FOREIGN KEY (source_id) REFERENCES notes (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+-- 20261014130000_webhooks (mysql, down)
+DROP TABLE IF EXISTS webhooks;
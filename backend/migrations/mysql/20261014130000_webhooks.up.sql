@@ -0,0 +1,8 @@
+-- 20261014130000_webhooks (mysql, up)
+CREATE TABLE IF NOT EXISTS webhooks (
+  id CHAR(36) PRIMARY KEY,
+  url TEXT NOT NULL,
+  events TEXT NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  created_at DATETIME(6) NOT NULL
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
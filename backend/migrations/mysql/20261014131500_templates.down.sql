@@ -0,0 +1,2 @@
+-- 20261014131500_templates (mysql, down)
+DROP TABLE IF EXISTS templates;
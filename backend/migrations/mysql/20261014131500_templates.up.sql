@@ -0,0 +1,10 @@
+-- 20261014131500_templates (mysql, up)
+CREATE TABLE IF NOT EXISTS templates (
+  id CHAR(36) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  title TEXT NOT NULL,
+  content LONGTEXT NOT NULL,
+  tags JSON NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+-- 20261014133000_note_encryption (mysql, up)
+ALTER TABLE notes ADD COLUMN is_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
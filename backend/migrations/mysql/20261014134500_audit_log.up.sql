@@ -0,0 +1,14 @@
+-- 20261014134500_audit_log (mysql, up)
+CREATE TABLE IF NOT EXISTS audit_log (
+  id CHAR(36) PRIMARY KEY,
+  at DATETIME(6) NOT NULL,
+  actor VARCHAR(64) NOT NULL,
+  action VARCHAR(64) NOT NULL,
+  entity VARCHAR(32) NOT NULL,
+  entity_id VARCHAR(255) NOT NULL,
+  summary TEXT NOT NULL,
+  ip VARCHAR(64) NOT NULL,
+  request_id VARCHAR(128) NOT NULL,
+  INDEX idx_audit_log_at (at),
+  INDEX idx_audit_log_entity (entity, entity_id, at)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,5 @@
+-- 20261014140000_session_metadata (mysql, down)
+ALTER TABLE sessions
+  DROP COLUMN ip,
+  DROP COLUMN user_agent,
+  DROP COLUMN last_seen_at;
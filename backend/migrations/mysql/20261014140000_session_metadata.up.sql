@@ -0,0 +1,6 @@
+-- 20261014140000_session_metadata (mysql, up)
+ALTER TABLE sessions
+  ADD COLUMN last_seen_at DATETIME(6) NULL,
+  ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  ADD COLUMN ip VARCHAR(64) NOT NULL DEFAULT '';
+UPDATE sessions SET last_seen_at = created_at;
@@ -0,0 +1,11 @@
+-- 20261014141500_two_factor (mysql, up)
+CREATE TABLE IF NOT EXISTS two_factor (
+  id SMALLINT PRIMARY KEY,
+  secret TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  last_step BIGINT NOT NULL DEFAULT 0
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  code_hash CHAR(64) PRIMARY KEY
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
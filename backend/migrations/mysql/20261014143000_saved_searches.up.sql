@@ -0,0 +1,11 @@
+-- 20261014143000_saved_searches (mysql, up)
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id CHAR(36) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  query TEXT NOT NULL,
+  tag VARCHAR(255) NOT NULL DEFAULT '',
+  favorite BOOLEAN NULL,
+  notebook VARCHAR(36) NOT NULL DEFAULT '',
+  created_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
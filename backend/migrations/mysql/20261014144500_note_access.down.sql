@@ -0,0 +1,2 @@
+-- 20261014144500_note_access (mysql, down)
+DROP TABLE IF EXISTS note_access;
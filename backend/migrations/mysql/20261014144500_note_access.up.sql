@@ -0,0 +1,7 @@
+-- 20261014144500_note_access (mysql, up)
+CREATE TABLE IF NOT EXISTS note_access (
+  note_id CHAR(36) NOT NULL,
+  accessed_at DATETIME(6) NOT NULL,
+  INDEX idx_note_access_accessed_at (accessed_at, note_id),
+  CONSTRAINT fk_note_access_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+-- 20261014150000_note_stats (mysql, down)
+ALTER TABLE notes DROP COLUMN char_count, DROP COLUMN word_count;
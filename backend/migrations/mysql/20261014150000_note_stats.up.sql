@@ -0,0 +1,2 @@
+-- 20261014150000_note_stats (mysql, up)
+ALTER TABLE notes ADD COLUMN word_count INT NOT NULL DEFAULT 0, ADD COLUMN char_count INT NOT NULL DEFAULT 0;
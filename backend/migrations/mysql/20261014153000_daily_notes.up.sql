@@ -0,0 +1,7 @@
+-- 20261014153000_daily_notes (mysql, up)
+CREATE TABLE IF NOT EXISTS daily_notes (
+  day CHAR(10) PRIMARY KEY,
+  note_id CHAR(36) NOT NULL,
+  INDEX idx_daily_notes_note_id (note_id),
+  CONSTRAINT fk_daily_notes_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+-- 20261014154500_note_schedule (mysql, down)
+ALTER TABLE notes DROP COLUMN reminder_at, DROP COLUMN due_at;
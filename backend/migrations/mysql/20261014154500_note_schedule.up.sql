@@ -0,0 +1,2 @@
+-- 20261014154500_note_schedule (mysql, up)
+ALTER TABLE notes ADD COLUMN due_at DATETIME(6) NULL, ADD COLUMN reminder_at DATETIME(6) NULL;
@@ -0,0 +1,2 @@
+-- 20261014160000_note_appearance (mysql, down)
+ALTER TABLE notes DROP COLUMN icon, DROP COLUMN color;
@@ -0,0 +1,2 @@
+-- 20261014160000_note_appearance (mysql, up)
+ALTER TABLE notes ADD COLUMN color VARCHAR(16) NOT NULL DEFAULT '', ADD COLUMN icon VARCHAR(64) NOT NULL DEFAULT '';
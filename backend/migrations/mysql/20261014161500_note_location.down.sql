@@ -0,0 +1,2 @@
+-- 20261014161500_note_location (mysql, down)
+ALTER TABLE notes DROP INDEX idx_notes_latitude, DROP COLUMN longitude, DROP COLUMN latitude;
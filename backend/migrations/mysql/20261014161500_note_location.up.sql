@@ -0,0 +1,5 @@
+-- 20261014161500_note_location (mysql, up)
+ALTER TABLE notes
+  ADD COLUMN latitude DOUBLE NULL,
+  ADD COLUMN longitude DOUBLE NULL,
+  ADD INDEX idx_notes_latitude (latitude);
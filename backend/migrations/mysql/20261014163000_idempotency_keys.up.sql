@@ -0,0 +1,10 @@
+-- 20261014163000_idempotency_keys (mysql, up)
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  idempotency_key VARCHAR(255) PRIMARY KEY,
+  fingerprint CHAR(64) NOT NULL,
+  status INT NOT NULL DEFAULT 0,
+  headers TEXT NOT NULL,
+  body LONGTEXT NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  INDEX idx_idempotency_keys_created_at (created_at)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
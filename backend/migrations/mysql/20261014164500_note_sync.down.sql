@@ -0,0 +1,4 @@
+-- 20261014164500_note_sync (mysql, down)
+DROP TABLE IF EXISTS note_tombstones;
+
+ALTER TABLE notes DROP INDEX idx_notes_change_seq, DROP COLUMN change_seq;
@@ -0,0 +1,13 @@
+-- 20261014164500_note_sync (mysql, up)
+ALTER TABLE notes
+  ADD COLUMN change_seq BIGINT NULL,
+  ADD INDEX idx_notes_change_seq (change_seq);
+
+UPDATE note_changes SET seq = seq + 1 WHERE id = 1;
+UPDATE notes SET change_seq = (SELECT seq FROM note_changes WHERE id = 1);
+
+CREATE TABLE IF NOT EXISTS note_tombstones (
+  id CHAR(36) PRIMARY KEY,
+  change_seq BIGINT NULL,
+  INDEX idx_note_tombstones_change_seq (change_seq)
+);
@@ -0,0 +1,2 @@
+-- 20261014170000_attachment_text (mysql, down)
+ALTER TABLE attachments DROP INDEX idx_attachments_change_seq, DROP COLUMN change_seq, DROP COLUMN extracted_text;
@@ -0,0 +1,5 @@
+-- 20261014170000_attachment_text (mysql, up)
+ALTER TABLE attachments
+  ADD COLUMN extracted_text MEDIUMTEXT NULL,
+  ADD COLUMN change_seq BIGINT NULL,
+  ADD INDEX idx_attachments_change_seq (change_seq);
@@ -0,0 +1,9 @@
+-- 20261014095057_note_changes (postgres, up)
+-- Single-row counter bumped on every note write; list ETags are derived
+-- from it so that deletes invalidate them too.
+CREATE TABLE IF NOT EXISTS note_changes (
+  id smallint PRIMARY KEY,
+  seq bigint NOT NULL
+);
+
+INSERT INTO note_changes (id, seq) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
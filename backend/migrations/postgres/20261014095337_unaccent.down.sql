@@ -0,0 +1,2 @@
+-- 20261014095337_unaccent (postgres, down)
+DROP EXTENSION IF EXISTS unaccent;
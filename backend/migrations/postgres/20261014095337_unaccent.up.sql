@@ -0,0 +1,4 @@
+-- 20261014095337_unaccent (postgres, up)
+-- Accent-insensitive search. unaccent ships with the contrib package that
+-- the official images include; other drivers fold accents without it.
+CREATE EXTENSION IF NOT EXISTS unaccent;
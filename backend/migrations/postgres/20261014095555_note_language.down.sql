@@ -0,0 +1,6 @@
+-- 20261014095555_note_language (postgres, down)
+DROP INDEX IF EXISTS idx_notes_search_vector;
+DROP TRIGGER IF EXISTS notes_search_vector_update ON notes;
+DROP FUNCTION IF EXISTS notes_search_vector_update();
+ALTER TABLE notes DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE notes DROP COLUMN IF EXISTS language;
@@ -0,0 +1,23 @@
+-- 20261014095555_note_language (postgres, up)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT 'simple';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+-- The vector is built with the note's own text-search configuration, so
+-- stemming follows its language. Accents are stripped as in ILIKE search.
+CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.title, ''))), 'A') ||
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.content, ''))), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_search_vector_update ON notes;
+CREATE TRIGGER notes_search_vector_update
+  BEFORE INSERT OR UPDATE OF title, content, language ON notes
+  FOR EACH ROW EXECUTE FUNCTION notes_search_vector_update();
+
+UPDATE notes SET language = language;
+
+CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector);
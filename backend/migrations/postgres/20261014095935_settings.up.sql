@@ -0,0 +1,9 @@
+-- 20261014095935_settings (postgres, up)
+-- Single-row document of client preferences (theme, editor options, ...),
+-- validated by the API before it is stored.
+CREATE TABLE IF NOT EXISTS settings (
+  id smallint PRIMARY KEY,
+  data jsonb NOT NULL
+);
+
+INSERT INTO settings (id, data) VALUES (1, '{}') ON CONFLICT (id) DO NOTHING;
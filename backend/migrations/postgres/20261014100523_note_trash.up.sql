@@ -0,0 +1,7 @@
+-- 20261014100523_note_trash (postgres, up)
+-- Deleted notes keep their row with deleted_at set until restored or
+-- purged. The partial index serves the trash listing and the purge job
+-- without growing with live notes.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS deleted_at timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,12 @@
+-- 20261014100720_note_revisions (postgres, up)
+-- Earlier versions of notes, written by the API before each update. Revs
+-- count up per note; the oldest are pruned past the configured maximum.
+CREATE TABLE IF NOT EXISTS note_revisions (
+  note_id uuid NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  rev integer NOT NULL,
+  title text NOT NULL,
+  content text NOT NULL,
+  tags text[] NOT NULL DEFAULT '{}',
+  saved_at timestamptz NOT NULL,
+  PRIMARY KEY (note_id, rev)
+);
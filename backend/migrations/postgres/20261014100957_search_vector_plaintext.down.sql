@@ -0,0 +1,11 @@
+-- 20261014100957_search_vector_plaintext (postgres, down)
+CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.title, ''))), 'A') ||
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.content, ''))), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+UPDATE notes SET language = language WHERE content LIKE 'enc:v1:%';
@@ -0,0 +1,13 @@
+-- 20261014100957_search_vector_plaintext (postgres, up)
+-- Content sealed by application-level encryption is ciphertext; indexing it
+-- would only add noise, so such notes are searchable by title alone.
+CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.title, ''))), 'A') ||
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(CASE WHEN NEW.content LIKE 'enc:v1:%' THEN '' ELSE NEW.content END)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+UPDATE notes SET language = language WHERE content LIKE 'enc:v1:%';
@@ -0,0 +1,14 @@
+-- 20261014101224_attachments (postgres, up)
+-- Files uploaded to notes. The bytes live in the configured blob store under
+-- the attachment id; purging a note only detaches its rows, and the server
+-- deletes the blobs of detached rows before dropping them.
+CREATE TABLE IF NOT EXISTS attachments (
+  id uuid PRIMARY KEY,
+  note_id uuid NULL REFERENCES notes (id) ON DELETE SET NULL,
+  filename text NOT NULL,
+  content_type text NOT NULL,
+  size bigint NOT NULL,
+  created_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments (note_id);
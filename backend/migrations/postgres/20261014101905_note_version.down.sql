@@ -0,0 +1,2 @@
+-- 20261014101905_note_version (postgres, down)
+ALTER TABLE notes DROP COLUMN IF EXISTS version;
@@ -0,0 +1,4 @@
+-- 20261014101905_note_version (postgres, up)
+-- Counts writes to each note so clients can send back the version they
+-- edited (If-Match) and get 412 instead of overwriting a newer one.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
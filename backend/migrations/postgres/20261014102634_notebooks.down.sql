@@ -0,0 +1,6 @@
+-- 20261014102634_notebooks (postgres, down)
+DROP INDEX IF EXISTS idx_notes_notebook_id;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS notebook_id;
+
+DROP TABLE IF EXISTS notebooks;
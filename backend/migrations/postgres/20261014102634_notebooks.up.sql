@@ -0,0 +1,17 @@
+-- 20261014102634_notebooks (postgres, up)
+-- Notebooks group notes and nest through parent_id. Deleting a notebook
+-- takes its nested notebooks with it; the server moves or trashes their
+-- notes first, and the foreign key only covers notes it did not see.
+CREATE TABLE IF NOT EXISTS notebooks (
+  id uuid PRIMARY KEY,
+  parent_id uuid NULL REFERENCES notebooks (id) ON DELETE CASCADE,
+  name text NOT NULL,
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notebooks_parent_id ON notebooks (parent_id);
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS notebook_id uuid NULL REFERENCES notebooks (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_notebook_id ON notes (notebook_id);
@@ -0,0 +1,7 @@
+-- 20261014103512_note_list_keyset (postgres, up)
+-- Listings page by (updated_at, id) to stay stable when notes share an
+-- updated_at; the id column lets the index serve both the order and the
+-- keyset condition of cursor pages.
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at_id ON notes (updated_at DESC, id DESC);
+
+DROP INDEX IF EXISTS idx_notes_updated_at_desc;
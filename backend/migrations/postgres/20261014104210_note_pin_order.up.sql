@@ -0,0 +1,6 @@
+-- 20261014104210_note_pin_order (postgres, up)
+-- Pinned notes list before the others whatever the sort. sort_position is
+-- the manual order set by POST /notes/reorder; 0, for notes never moved,
+-- puts them first.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_pinned boolean NOT NULL DEFAULT false;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS sort_position bigint NOT NULL DEFAULT 0;
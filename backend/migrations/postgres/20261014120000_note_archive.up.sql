@@ -0,0 +1,4 @@
+-- 20261014120000_note_archive (postgres, up)
+-- Archived notes are kept out of listings unless asked for, without being
+-- trashed.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_archived boolean NOT NULL DEFAULT false;
@@ -0,0 +1,12 @@
+-- 20261014121500_api_tokens (postgres, up)
+-- Bearer tokens for scripts. Only the SHA-256 of each secret is kept; the
+-- secret itself is shown once, when the token is created. scope is read or
+-- write.
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  token_hash text UNIQUE NOT NULL,
+  scope text NOT NULL,
+  created_at timestamptz NOT NULL,
+  last_used_at timestamptz NULL
+);
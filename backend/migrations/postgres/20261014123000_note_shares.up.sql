@@ -0,0 +1,11 @@
+-- 20261014123000_note_shares (postgres, up)
+-- Public read-only links, at most one per note; sharing again replaces the
+-- slug. password_hash is an argon2id hash viewers' passwords are checked
+-- against, NULL for open links.
+CREATE TABLE IF NOT EXISTS note_shares (
+  note_id uuid PRIMARY KEY REFERENCES notes (id) ON DELETE CASCADE,
+  slug text UNIQUE NOT NULL,
+  password_hash text NULL,
+  expires_at timestamptz NULL,
+  created_at timestamptz NOT NULL
+);
@@ -0,0 +1,2 @@
+-- 20261014124500_note_links (postgres, down)
+DROP TABLE IF EXISTS note_links;
@@ -0,0 +1,10 @@
+-- 20261014124500_note_links (postgres, up)
+-- The [[links]] in each note's content. target is the canonical text of a
+-- note ID or a title, resolved against notes when read so that links to
+-- notes created or renamed later find them.
+CREATE TABLE IF NOT EXISTS note_links (
+  source_id uuid NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  target text NOT NULL,
+  PRIMARY KEY (source_id, target)
+);
+CREATE INDEX IF NOT EXISTS idx_note_links_target ON note_links (target);
@@ -0,0 +1,2 @@
+-- 20261014130000_webhooks (postgres, down)
+DROP TABLE IF EXISTS webhooks;
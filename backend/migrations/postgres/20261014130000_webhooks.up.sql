@@ -0,0 +1,10 @@
+-- 20261014130000_webhooks (postgres, up)
+-- URLs note events are posted to. events is a comma-separated list of
+-- event types; secret signs the payloads, so it is kept as given.
+CREATE TABLE IF NOT EXISTS webhooks (
+  id uuid PRIMARY KEY,
+  url text NOT NULL,
+  events text NOT NULL,
+  secret text NOT NULL,
+  created_at timestamptz NOT NULL
+);
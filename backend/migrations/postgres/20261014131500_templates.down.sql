@@ -0,0 +1,2 @@
+-- 20261014131500_templates (postgres, down)
+DROP TABLE IF EXISTS templates;
@@ -0,0 +1,12 @@
+-- 20261014131500_templates (postgres, up)
+-- Starting points for new notes. Placeholders in title and content are
+-- kept as written and filled in when a note is made from the template.
+CREATE TABLE IF NOT EXISTS templates (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  title text NOT NULL,
+  content text NOT NULL,
+  tags text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL
+);
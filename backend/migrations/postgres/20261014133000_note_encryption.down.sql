@@ -0,0 +1,11 @@
+-- 20261014133000_note_encryption (postgres, down)
+CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.title, ''))), 'A') ||
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(CASE WHEN NEW.content LIKE 'enc:v1:%' THEN '' ELSE NEW.content END)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS is_encrypted;
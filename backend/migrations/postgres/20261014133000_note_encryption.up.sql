@@ -0,0 +1,14 @@
+-- 20261014133000_note_encryption (postgres, up)
+-- Encrypted notes hold content locked under a passphrase. Like content
+-- sealed under the master key it is ciphertext, so only the title is
+-- indexed.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS is_encrypted boolean NOT NULL DEFAULT false;
+
+CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(coalesce(NEW.title, ''))), 'A') ||
+    setweight(to_tsvector(NEW.language::regconfig, unaccent(CASE WHEN NEW.is_encrypted OR NEW.content LIKE 'enc:v1:%' THEN '' ELSE NEW.content END)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+-- 20261014134500_audit_log (postgres, down)
+DROP TABLE IF EXISTS audit_log;
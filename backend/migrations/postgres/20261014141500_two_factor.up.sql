@@ -0,0 +1,14 @@
+-- 20261014141500_two_factor (postgres, up)
+-- Single row holding the TOTP secret of the login, sealed like note
+-- content when ENCRYPTION_KEY is set, and the last time step a code was
+-- accepted for. Recovery codes are kept as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS two_factor (
+  id smallint PRIMARY KEY,
+  secret text NOT NULL,
+  enabled boolean NOT NULL DEFAULT false,
+  last_step bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  code_hash text PRIMARY KEY
+);
@@ -0,0 +1,2 @@
+-- 20261014143000_saved_searches (postgres, down)
+DROP TABLE IF EXISTS saved_searches;
@@ -0,0 +1,13 @@
+-- 20261014143000_saved_searches (postgres, up)
+-- Named note listing filters. Each column holds the GET /notes parameter
+-- of the same name as it is sent; favorite is NULL for either.
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id uuid PRIMARY KEY,
+  name text NOT NULL,
+  query text NOT NULL DEFAULT '',
+  tag text NOT NULL DEFAULT '',
+  favorite boolean,
+  notebook text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL
+);
@@ -0,0 +1,6 @@
+-- 20261014150000_note_stats (postgres, up)
+-- Word and character counts of each note's content, measured by the API
+-- before any encryption so listings can sort by length. Notes written
+-- earlier are counted by the recount command.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS word_count integer NOT NULL DEFAULT 0;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS char_count integer NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- 20261014153000_daily_notes (postgres, down)
+DROP TABLE IF EXISTS daily_notes;
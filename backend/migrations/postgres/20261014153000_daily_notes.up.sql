@@ -0,0 +1,8 @@
+-- 20261014153000_daily_notes (postgres, up)
+-- The journal note of each day, the day written YYYY-MM-DD in TIME_ZONE.
+-- Text rather than date so that every store compares days the same way.
+CREATE TABLE IF NOT EXISTS daily_notes (
+  day text PRIMARY KEY,
+  note_id uuid NOT NULL REFERENCES notes (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_daily_notes_note_id ON daily_notes (note_id);
@@ -0,0 +1,5 @@
+-- 20261014154500_note_schedule (postgres, up)
+-- Optional due date and reminder of each note, which the calendar feed
+-- exports as events with alarms.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS due_at timestamptz NULL;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS reminder_at timestamptz NULL;
@@ -0,0 +1,5 @@
+-- 20261014160000_note_appearance (postgres, up)
+-- Color from a fixed palette and an emoji icon, both empty when unset, for
+-- telling notes apart at a glance.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS color text NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS icon text NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- 20261014161500_note_location (postgres, down)
+DROP INDEX IF EXISTS idx_notes_location;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS longitude;
+ALTER TABLE notes DROP COLUMN IF EXISTS latitude;
+
+DROP EXTENSION IF EXISTS earthdistance;
+DROP EXTENSION IF EXISTS cube;
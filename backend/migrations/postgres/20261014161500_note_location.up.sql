@@ -0,0 +1,11 @@
+-- 20261014161500_note_location (postgres, up)
+-- Where each note was written, for browsing notes by place. earthdistance
+-- (built on cube) measures the distances, and the GiST index on its earth
+-- points narrows a search to the notes in the bounding box.
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS latitude double precision NULL;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS longitude double precision NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_location ON notes USING gist (ll_to_earth(latitude, longitude)) WHERE latitude IS NOT NULL;
@@ -0,0 +1,13 @@
+-- 20261014163000_idempotency_keys (postgres, up)
+-- Requests made with an Idempotency-Key header and the responses their
+-- retries are given. status is 0 while the first request is in progress;
+-- rows past the configured window are deleted.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  idempotency_key text PRIMARY KEY,
+  fingerprint text NOT NULL,
+  status integer NOT NULL DEFAULT 0,
+  headers text NOT NULL DEFAULT '{}',
+  body text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
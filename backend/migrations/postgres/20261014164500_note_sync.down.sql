@@ -0,0 +1,5 @@
+-- 20261014164500_note_sync (postgres, down)
+DROP TABLE IF EXISTS note_tombstones;
+
+DROP INDEX IF EXISTS idx_notes_change_seq;
+ALTER TABLE notes DROP COLUMN IF EXISTS change_seq;
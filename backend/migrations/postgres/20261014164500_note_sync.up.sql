@@ -0,0 +1,17 @@
+-- 20261014164500_note_sync (postgres, up)
+-- change_seq is the note_changes seq that counted a note's last write, so
+-- that sync can list what changed after a client's last seq; writes set it
+-- to NULL and the counter bump that follows stamps it. Tombstones stand in
+-- for purged notes. Notes already there are counted as one change.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS change_seq bigint NULL;
+
+UPDATE note_changes SET seq = seq + 1 WHERE id = 1;
+UPDATE notes SET change_seq = (SELECT seq FROM note_changes WHERE id = 1);
+
+CREATE INDEX IF NOT EXISTS idx_notes_change_seq ON notes (change_seq);
+
+CREATE TABLE IF NOT EXISTS note_tombstones (
+  id uuid PRIMARY KEY,
+  change_seq bigint NULL
+);
+CREATE INDEX IF NOT EXISTS idx_note_tombstones_change_seq ON note_tombstones (change_seq);
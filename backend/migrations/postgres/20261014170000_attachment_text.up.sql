@@ -0,0 +1,9 @@
+-- 20261014170000_attachment_text (postgres, up)
+-- The text read from uploaded PDFs and text files, for search, and the
+-- note_changes seq that counted each upload, so that a search index can
+-- follow new attachments as it follows notes. Attachments uploaded before
+-- keep no text.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS extracted_text text NULL;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS change_seq bigint NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_change_seq ON attachments (change_seq);
@@ -0,0 +1,2 @@
+-- 20261014095057_note_changes (sqlite, down)
+DROP TABLE IF EXISTS note_changes;
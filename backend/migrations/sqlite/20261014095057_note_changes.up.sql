@@ -0,0 +1,7 @@
+-- 20261014095057_note_changes (sqlite, up)
+CREATE TABLE IF NOT EXISTS note_changes (
+  id INTEGER PRIMARY KEY,
+  seq INTEGER NOT NULL
+);
+
+INSERT OR IGNORE INTO note_changes (id, seq) VALUES (1, 0);
@@ -0,0 +1,2 @@
+-- 20261014095555_note_language (sqlite, up)
+ALTER TABLE notes ADD COLUMN language TEXT NOT NULL DEFAULT 'simple';
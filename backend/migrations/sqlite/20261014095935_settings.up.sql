@@ -0,0 +1,7 @@
+-- 20261014095935_settings (sqlite, up)
+CREATE TABLE IF NOT EXISTS settings (
+  id INTEGER PRIMARY KEY,
+  data TEXT NOT NULL
+);
+
+INSERT OR IGNORE INTO settings (id, data) VALUES (1, '{}');
@@ -0,0 +1,4 @@
+-- 20261014100523_note_trash (sqlite, down)
+DROP INDEX IF EXISTS idx_notes_deleted_at;
+
+ALTER TABLE notes DROP COLUMN deleted_at;
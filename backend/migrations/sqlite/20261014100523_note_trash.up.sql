@@ -0,0 +1,4 @@
+-- 20261014100523_note_trash (sqlite, up)
+ALTER TABLE notes ADD COLUMN deleted_at DATETIME NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
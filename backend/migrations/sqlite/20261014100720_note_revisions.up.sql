@@ -0,0 +1,10 @@
+-- 20261014100720_note_revisions (sqlite, up)
+CREATE TABLE IF NOT EXISTS note_revisions (
+  note_id TEXT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  rev INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  tags TEXT NOT NULL DEFAULT '[]',
+  saved_at DATETIME NOT NULL,
+  PRIMARY KEY (note_id, rev)
+);
@@ -0,0 +1,2 @@
+-- 20261014101224_attachments (sqlite, down)
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,2 @@
+-- 20261014101905_note_version (sqlite, up)
+ALTER TABLE notes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+-- 20261014102634_notebooks (sqlite, down)
+DROP INDEX IF EXISTS idx_notes_notebook_id;
+
+ALTER TABLE notes DROP COLUMN notebook_id;
+
+DROP TABLE IF EXISTS notebooks;
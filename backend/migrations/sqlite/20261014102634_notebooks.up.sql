@@ -0,0 +1,14 @@
+-- 20261014102634_notebooks (sqlite, up)
+CREATE TABLE IF NOT EXISTS notebooks (
+  id TEXT PRIMARY KEY,
+  parent_id TEXT NULL REFERENCES notebooks (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notebooks_parent_id ON notebooks (parent_id);
+
+ALTER TABLE notes ADD COLUMN notebook_id TEXT NULL REFERENCES notebooks (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_notebook_id ON notes (notebook_id);
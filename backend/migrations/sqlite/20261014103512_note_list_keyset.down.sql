@@ -0,0 +1,4 @@
+-- 20261014103512_note_list_keyset (sqlite, down)
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at_desc ON notes (updated_at DESC);
+
+DROP INDEX IF EXISTS idx_notes_updated_at_id;
@@ -0,0 +1,3 @@
+-- 20261014104210_note_pin_order (sqlite, down)
+ALTER TABLE notes DROP COLUMN sort_position;
+ALTER TABLE notes DROP COLUMN is_pinned;
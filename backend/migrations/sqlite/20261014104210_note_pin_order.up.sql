@@ -0,0 +1,3 @@
+-- 20261014104210_note_pin_order (sqlite, up)
+ALTER TABLE notes ADD COLUMN is_pinned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE notes ADD COLUMN sort_position INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- 20261014120000_note_archive (sqlite, down)
+ALTER TABLE notes DROP COLUMN is_archived;
@@ -0,0 +1,2 @@
+-- 20261014120000_note_archive (sqlite, up)
+ALTER TABLE notes ADD COLUMN is_archived INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- 20261014121500_api_tokens (sqlite, up)
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL,
+  scope TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  last_used_at DATETIME NULL
+);
@@ -0,0 +1,8 @@
+-- 20261014123000_note_shares (sqlite, up)
+CREATE TABLE IF NOT EXISTS note_shares (
+  note_id TEXT PRIMARY KEY REFERENCES notes (id) ON DELETE CASCADE,
+  slug TEXT UNIQUE NOT NULL,
+  password_hash TEXT NULL,
+  expires_at DATETIME NULL,
+  created_at DATETIME NOT NULL
+);
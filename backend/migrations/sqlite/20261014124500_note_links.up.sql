@@ -0,0 +1,7 @@
+-- 20261014124500_note_links (sqlite, up)
+CREATE TABLE IF NOT EXISTS note_links (
+  source_id TEXT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  target TEXT NOT NULL,
+  PRIMARY KEY (source_id, target)
+);
+CREATE INDEX IF NOT EXISTS idx_note_links_target ON note_links (target);
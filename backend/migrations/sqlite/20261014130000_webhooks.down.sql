@@ -0,0 +1,2 @@
+-- 20261014130000_webhooks (sqlite, down)
+DROP TABLE IF EXISTS webhooks;
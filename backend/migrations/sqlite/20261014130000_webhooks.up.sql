@@ -0,0 +1,8 @@
+-- 20261014130000_webhooks (sqlite, up)
+CREATE TABLE IF NOT EXISTS webhooks (
+  id TEXT PRIMARY KEY,
+  url TEXT NOT NULL,
+  events TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  created_at DATETIME NOT NULL
+);
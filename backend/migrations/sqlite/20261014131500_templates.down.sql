@@ -0,0 +1,2 @@
+-- 20261014131500_templates (sqlite, down)
+DROP TABLE IF EXISTS templates;
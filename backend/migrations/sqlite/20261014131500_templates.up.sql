@@ -0,0 +1,10 @@
+-- 20261014131500_templates (sqlite, up)
+CREATE TABLE IF NOT EXISTS templates (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  tags TEXT NOT NULL DEFAULT '[]',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
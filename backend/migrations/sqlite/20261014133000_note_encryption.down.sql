@@ -0,0 +1,2 @@
+-- 20261014133000_note_encryption (sqlite, down)
+ALTER TABLE notes DROP COLUMN is_encrypted;
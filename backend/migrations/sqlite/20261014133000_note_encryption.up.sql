@@ -0,0 +1,2 @@
+-- 20261014133000_note_encryption (sqlite, up)
+ALTER TABLE notes ADD COLUMN is_encrypted INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- 20261014140000_session_metadata (sqlite, down)
+ALTER TABLE sessions DROP COLUMN ip;
+ALTER TABLE sessions DROP COLUMN user_agent;
+ALTER TABLE sessions DROP COLUMN last_seen_at;
@@ -0,0 +1,5 @@
+-- 20261014140000_session_metadata (sqlite, up)
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+UPDATE sessions SET last_seen_at = created_at;
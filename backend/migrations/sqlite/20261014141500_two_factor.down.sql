@@ -0,0 +1,3 @@
+-- 20261014141500_two_factor (sqlite, down)
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS two_factor;
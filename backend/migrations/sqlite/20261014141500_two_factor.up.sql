@@ -0,0 +1,11 @@
+-- 20261014141500_two_factor (sqlite, up)
+CREATE TABLE IF NOT EXISTS two_factor (
+  id INTEGER PRIMARY KEY,
+  secret TEXT NOT NULL,
+  enabled INTEGER NOT NULL DEFAULT 0,
+  last_step INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  code_hash TEXT PRIMARY KEY
+);
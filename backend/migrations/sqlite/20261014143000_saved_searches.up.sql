@@ -0,0 +1,11 @@
+-- 20261014143000_saved_searches (sqlite, up)
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  query TEXT NOT NULL DEFAULT '',
+  tag TEXT NOT NULL DEFAULT '',
+  favorite INTEGER,
+  notebook TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
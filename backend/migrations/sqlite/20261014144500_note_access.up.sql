@@ -0,0 +1,6 @@
+-- 20261014144500_note_access (sqlite, up)
+CREATE TABLE IF NOT EXISTS note_access (
+  note_id TEXT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+  accessed_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_note_access_accessed_at ON note_access (accessed_at, note_id);
@@ -0,0 +1,3 @@
+-- 20261014150000_note_stats (sqlite, down)
+ALTER TABLE notes DROP COLUMN char_count;
+ALTER TABLE notes DROP COLUMN word_count;
@@ -0,0 +1,3 @@
+-- 20261014150000_note_stats (sqlite, up)
+ALTER TABLE notes ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE notes ADD COLUMN char_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- 20261014153000_daily_notes (sqlite, up)
+CREATE TABLE IF NOT EXISTS daily_notes (
+  day TEXT PRIMARY KEY,
+  note_id TEXT NOT NULL REFERENCES notes (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_daily_notes_note_id ON daily_notes (note_id);
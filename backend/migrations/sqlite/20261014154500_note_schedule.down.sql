@@ -0,0 +1,3 @@
+-- 20261014154500_note_schedule (sqlite, down)
+ALTER TABLE notes DROP COLUMN reminder_at;
+ALTER TABLE notes DROP COLUMN due_at;
@@ -0,0 +1,3 @@
+-- 20261014154500_note_schedule (sqlite, up)
+ALTER TABLE notes ADD COLUMN due_at DATETIME NULL;
+ALTER TABLE notes ADD COLUMN reminder_at DATETIME NULL;
@@ -0,0 +1,3 @@
+-- 20261014160000_note_appearance (sqlite, down)
+ALTER TABLE notes DROP COLUMN icon;
+ALTER TABLE notes DROP COLUMN color;
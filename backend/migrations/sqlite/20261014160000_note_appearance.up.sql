@@ -0,0 +1,3 @@
+-- 20261014160000_note_appearance (sqlite, up)
+ALTER TABLE notes ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN icon TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- 20261014161500_note_location (sqlite, down)
+DROP INDEX IF EXISTS idx_notes_latitude;
+
+ALTER TABLE notes DROP COLUMN longitude;
+ALTER TABLE notes DROP COLUMN latitude;
@@ -0,0 +1,5 @@
+-- 20261014161500_note_location (sqlite, up)
+ALTER TABLE notes ADD COLUMN latitude REAL NULL;
+ALTER TABLE notes ADD COLUMN longitude REAL NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notes_latitude ON notes (latitude);
@@ -0,0 +1,2 @@
+-- 20261014163000_idempotency_keys (sqlite, down)
+DROP TABLE IF EXISTS idempotency_keys;
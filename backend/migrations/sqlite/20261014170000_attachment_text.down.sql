@@ -0,0 +1,4 @@
+-- 20261014170000_attachment_text (sqlite, down)
+DROP INDEX IF EXISTS idx_attachments_change_seq;
+ALTER TABLE attachments DROP COLUMN change_seq;
+ALTER TABLE attachments DROP COLUMN extracted_text;
@@ -0,0 +1,5 @@
+-- 20261014170000_attachment_text (sqlite, up)
+ALTER TABLE attachments ADD COLUMN extracted_text TEXT NULL;
+ALTER TABLE attachments ADD COLUMN change_seq INTEGER NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_change_seq ON attachments (change_seq);
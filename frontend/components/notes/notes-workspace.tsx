@@ -122,6 +122,7 @@ export function NotesWorkspace() {
 
   const selectedIdRef = useRef<string | null>(null);
   const draftRef = useRef<DraftState | null>(null);
+  const notesRef = useRef<Note[]>([]);
   const previousSelectionRef = useRef<string | null>(null);
 
   useEffect(() => {
@@ -132,6 +133,10 @@ export function NotesWorkspace() {
     draftRef.current = draft;
   }, [draft]);
 
+  useEffect(() => {
+    notesRef.current = notes;
+  }, [notes]);
+
   const handleUnauthorized = useCallback(() => {
     router.replace("/login");
   }, [router]);
@@ -247,8 +252,9 @@ export function NotesWorkspace() {
 
     const timeout = setTimeout(async () => {
       setIsSaving(true);
+      const version = notesRef.current.find((item) => item.id === selectedId)?.version ?? 1;
       try {
-        const updated = await updateNote(selectedId, toPayload(snapshot));
+        const updated = await updateNote(selectedId, toPayload(snapshot), version);
         setNotes((prev) => prev.map((item) => (item.id === updated.id ? updated : item)));
         setLastSavedAt(new Date(updated.updated_at));
         if (isDraftEqual(snapshot, draftRef.current)) {
@@ -259,6 +265,14 @@ export function NotesWorkspace() {
           handleUnauthorized();
           return;
         }
+        if (error instanceof ApiError && error.status === 412) {
+          // Keep the draft but take the server's version, so the next edit
+          // saves over the other change deliberately rather than silently.
+          const current = error.payload as Note;
+          setNotes((prev) => prev.map((item) => (item.id === current.id ? current : item)));
+          toast.error("This note was changed elsewhere. Edit again to overwrite it with your version.");
+          return;
+        }
         toast.error(error instanceof Error ? error.message : "Failed to save");
       } finally {
         setIsSaving(false);
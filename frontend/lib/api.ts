@@ -2,10 +2,12 @@ import { Note, NotePayload, NotesListResponse, SessionStatus } from "@/lib/types
 
 class ApiError extends Error {
   status: number;
+  payload: unknown;
 
-  constructor(message: string, status: number) {
+  constructor(message: string, status: number, payload?: unknown) {
     super(message);
     this.status = status;
+    this.payload = payload;
   }
 }
 
@@ -22,15 +24,17 @@ async function apiFetch<T>(path: string, init?: RequestInit): Promise<T> {
 
   if (!response.ok) {
     let message = `Request failed: ${response.status}`;
+    let payload: unknown;
     try {
-      const payload = (await response.json()) as { error?: string };
-      if (payload.error) {
-        message = payload.error;
+      payload = await response.json();
+      const { error } = payload as { error?: string };
+      if (error) {
+        message = error;
       }
     } catch {
       // No-op: fallback error message is enough.
     }
-    throw new ApiError(message, response.status);
+    throw new ApiError(message, response.status, payload);
   }
 
   if (response.status === 204) {
@@ -88,9 +92,12 @@ export async function getNote(id: string): Promise<Note> {
   return apiFetch<Note>(`/notes/${id}`);
 }
 
-export async function updateNote(id: string, payload: NotePayload): Promise<Note> {
+// updateNote only applies when the note is still at version; otherwise it
+// throws an ApiError with status 412 whose payload is the current note.
+export async function updateNote(id: string, payload: NotePayload, version: number): Promise<Note> {
   return apiFetch<Note>(`/notes/${id}`, {
     method: "PUT",
+    headers: { "If-Match": `"${version}"` },
     body: JSON.stringify(payload),
   });
 }
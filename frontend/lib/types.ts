@@ -4,6 +4,11 @@ export interface Note {
   content: string;
   tags: string[];
   is_favorite: boolean;
+  is_pinned: boolean;
+  is_archived: boolean;
+  sort_position: number;
+  notebook_id: string | null;
+  version: number;
   created_at: string;
   updated_at: string;
 }